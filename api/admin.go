@@ -159,6 +159,17 @@ func saveConfig(c *Context, w http.ResponseWriter, r *http.Request) {
 
 	utils.SaveConfig(utils.CfgFileName, cfg)
 	utils.LoadConfig(utils.CfgFileName)
+	InitFileBackend()
+
+	if !*utils.Cfg.ServiceSettings.EnableUserAccessTokens {
+		RemoveAllUserAccessTokensFromCache()
+	}
+
+	if err := ConfigureSaml(); err != nil {
+		c.Err = err
+		return
+	}
+
 	json := utils.Cfg.ToJson()
 	w.Write([]byte(json))
 }
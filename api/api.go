@@ -16,17 +16,32 @@ import (
 func InitApi() {
 	r := Srv.Router.PathPrefix("/api/v1").Subrouter()
 	InitUser(r)
+	InitUserAccessToken(r)
 	InitTeam(r)
-	InitChannel(r)
-	InitPost(r)
-	InitWebSocket(r)
-	InitFile(r)
-	InitCommand(r)
 	InitAdmin(r)
 	InitOAuth(r)
-	InitWebhook(r)
+	InitSaml(r)
 	InitPreference(r)
 	InitLicense(r)
+	InitWebSocket(r)
+
+	// everything that belongs to a team can be reached either through the
+	// session's current team or through /teams/{team_id}
+	tr := r.PathPrefix("/teams/{team_id:[A-Za-z0-9]+}").Subrouter()
+	InitChannel(r, tr)
+	InitPost(r, tr)
+	InitReaction(r, tr)
+	InitScheduledPost(r, tr)
+	InitFile(r, tr)
+	InitUpload(r, tr)
+	InitCommand(r, tr)
+	InitWebhook(r, tr)
+	InitBot(r, tr)
+	InitRole(r, tr)
+
+	InitSearchEngine()
+	InitFileBackend()
+
 	// 404 on any api route before web.go has a chance to serve it
 	Srv.Router.Handle("/api/{anything:.*}", http.HandlerFunc(Handle404))
 
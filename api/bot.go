@@ -0,0 +1,330 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package api
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	l4g "github.com/alecthomas/log4go"
+	"github.com/gorilla/mux"
+	"github.com/mattermost/platform/model"
+	"github.com/mattermost/platform/utils"
+)
+
+const (
+	BOT_MESSAGE_MAX_RESPONSE = 64 * 1024
+)
+
+func InitBot(routers ...*mux.Router) {
+	l4g.Debug(utils.T("api.bot.init.debug"))
+
+	for _, r := range routers {
+		sr := r.PathPrefix("/bots").Subrouter()
+		sr.Handle("/", ApiUserRequired(getBots)).Methods("GET")
+		sr.Handle("/create", ApiUserRequired(createBot)).Methods("POST")
+		sr.Handle("/{id:[A-Za-z0-9]+}/update", ApiUserRequired(updateBot)).Methods("POST")
+	}
+}
+
+// createBot makes a bot in the current team. It is owned by the user making it
+// unless an OAuth app that they registered is given as the owner instead.
+func createBot(c *Context, w http.ResponseWriter, r *http.Request) {
+	// a bot is a full member of the team so guests can't use one to get around
+	// what they're limited to
+	if c.IsGuest() || !c.HasPermission(model.PERMISSION_MANAGE_BOTS, c.Session.TeamId) {
+		c.Err = model.NewLocAppError("createBot", "api.bot.create.permissions.app_error", nil, "user_id="+c.Session.UserId)
+		c.Err.StatusCode = http.StatusForbidden
+		return
+	}
+
+	props := model.MapFromJson(r.Body)
+
+	username := props["username"]
+	if !model.IsValidUsername(username) {
+		c.SetInvalidParam("createBot", "username")
+		return
+	}
+
+	ownerId := c.Session.UserId
+	if appId := props["oauth_app_id"]; len(appId) > 0 {
+		if result := <-Srv.Store.OAuth().GetApp(appId); result.Err != nil {
+			c.Err = result.Err
+			return
+		} else if result.Data.(*model.OAuthApp).CreatorId != c.Session.UserId && !c.IsSystemAdmin() {
+			c.Err = model.NewLocAppError("createBot", "api.bot.create.app_owner.app_error", nil, "app_id="+appId)
+			c.Err.StatusCode = http.StatusForbidden
+			return
+		}
+
+		ownerId = appId
+	}
+
+	callbackURL := props["callback_url"]
+	if len(callbackURL) > 0 && !canSetBotCallback(c, callbackURL, "createBot") {
+		return
+	}
+
+	var team *model.Team
+	if result := <-Srv.Store.Team().Get(c.Session.TeamId); result.Err != nil {
+		c.Err = result.Err
+		return
+	} else {
+		team = result.Data.(*model.Team)
+	}
+
+	bot := model.NewBotUser(team.Id, username, ownerId)
+	bot.Nickname = props["nickname"]
+	if len(callbackURL) > 0 {
+		bot.AddProp(model.USER_PROP_BOT_CALLBACK_URL, callbackURL)
+		bot.AddProp(model.USER_PROP_BOT_SECRET, model.NewId())
+	}
+
+	secret := bot.Props[model.USER_PROP_BOT_SECRET]
+
+	if ruser, err := CreateUser(team, bot); err != nil {
+		c.Err = err
+		return
+	} else {
+		c.LogAudit("bot_id=" + ruser.Id + " owner_id=" + ownerId)
+
+		// the owner needs the secret to check that messages came from this server
+		if len(secret) > 0 {
+			ruser.AddProp(model.USER_PROP_BOT_SECRET, secret)
+		}
+
+		w.Write([]byte(ruser.ToJson()))
+	}
+}
+
+// getBots returns the bots owned by the current user or by any of the OAuth
+// apps that they have registered.
+func getBots(c *Context, w http.ResponseWriter, r *http.Request) {
+	ownerIds := []string{c.Session.UserId}
+
+	if result := <-Srv.Store.OAuth().GetAppByUser(c.Session.UserId); result.Err != nil {
+		c.Err = result.Err
+		return
+	} else {
+		for _, app := range result.Data.([]*model.OAuthApp) {
+			ownerIds = append(ownerIds, app.Id)
+		}
+	}
+
+	bots := make(map[string]*model.User)
+	for _, ownerId := range ownerIds {
+		if result := <-Srv.Store.User().GetBotsByOwner(ownerId); result.Err != nil {
+			c.Err = result.Err
+			return
+		} else {
+			for _, bot := range result.Data.([]*model.User) {
+				bot.Sanitize(map[string]bool{"email": true, "fullname": true, "passwordupdate": true, "botsecret": true})
+				bots[bot.Id] = bot
+			}
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	w.Write([]byte(model.UserMapToJson(bots)))
+}
+
+// updateBot changes a bot's nickname and the URL that direct messages to it
+// are forwarded to. Only the fields that are given are changed.
+func updateBot(c *Context, w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	botId := params["id"]
+
+	props := model.MapFromJson(r.Body)
+
+	var bot *model.User
+	if result := <-Srv.Store.User().Get(botId); result.Err != nil {
+		c.Err = result.Err
+		return
+	} else {
+		bot = result.Data.(*model.User)
+	}
+
+	if !bot.IsBot {
+		c.SetInvalidParam("updateBot", "id")
+		return
+	}
+
+	if !hasPermissionsToUserOrBot(c, bot.Id, "updateBot") {
+		return
+	}
+
+	if nickname, ok := props["nickname"]; ok {
+		bot.Nickname = nickname
+	}
+
+	// an empty callback URL turns forwarding off while leaving it out keeps
+	// the one the bot has
+	if callbackURL, ok := props["callback_url"]; ok {
+		if len(callbackURL) > 0 {
+			if !canSetBotCallback(c, callbackURL, "updateBot") {
+				return
+			}
+
+			bot.AddProp(model.USER_PROP_BOT_CALLBACK_URL, callbackURL)
+			if len(bot.Props[model.USER_PROP_BOT_SECRET]) == 0 {
+				bot.AddProp(model.USER_PROP_BOT_SECRET, model.NewId())
+			}
+		} else {
+			delete(bot.Props, model.USER_PROP_BOT_CALLBACK_URL)
+			delete(bot.Props, model.USER_PROP_BOT_SECRET)
+		}
+	}
+
+	if result := <-Srv.Store.User().Update(bot, false); result.Err != nil {
+		c.Err = result.Err
+		return
+	} else {
+		c.LogAudit("bot_id=" + bot.Id)
+
+		rbot := result.Data.([2]*model.User)[0]
+		rbot.Sanitize(map[string]bool{})
+		w.Write([]byte(rbot.ToJson()))
+	}
+}
+
+// canSetBotCallback checks that bot callbacks are enabled, that the current
+// user is allowed to manage integrations and that the URL isn't on the
+// server's internal network. Direct messages to the bot are sent to this URL
+// and the response is posted back, so it is treated like an outgoing webhook.
+func canSetBotCallback(c *Context, callbackURL string, where string) bool {
+	if !*utils.Cfg.ServiceSettings.EnableBotCallbacks {
+		c.Err = model.NewLocAppError(where, "api.bot.callbacks_disabled.app_error", nil, "")
+		c.Err.StatusCode = http.StatusNotImplemented
+		return false
+	}
+
+	if !c.HasPermission(model.PERMISSION_MANAGE_WEBHOOKS, c.Session.TeamId) {
+		c.Err = model.NewLocAppError(where, "api.bot.callback_permissions.app_error", nil, "user_id="+c.Session.UserId)
+		c.Err.StatusCode = http.StatusForbidden
+		return false
+	}
+
+	if !utils.IsValidUntrustedUrl(callbackURL) {
+		c.SetInvalidParam(where, "callback_url")
+		return false
+	}
+
+	return true
+}
+
+// isBotOwner returns true if the user owns the bot themselves or registered the
+// OAuth app that owns it.
+func isBotOwner(userId string, bot *model.User) bool {
+	if !bot.IsBot {
+		return false
+	}
+
+	if bot.BotOwnerId == userId {
+		return true
+	}
+
+	if result := <-Srv.Store.OAuth().GetApp(bot.BotOwnerId); result.Err == nil {
+		return result.Data.(*model.OAuthApp).CreatorId == userId
+	}
+
+	return false
+}
+
+// hasPermissionsToUserOrBot is like HasPermissionsToUser but also lets the
+// owner of a bot act on it.
+func hasPermissionsToUserOrBot(c *Context, userId string, where string) bool {
+	if c.Session.UserId != userId && !c.IsSystemAdmin() {
+		if result := <-Srv.Store.User().Get(userId); result.Err == nil && isBotOwner(c.Session.UserId, result.Data.(*model.User)) {
+			return true
+		}
+	}
+
+	return c.HasPermissionsToUser(userId, where)
+}
+
+// forwardDirectMessageToBot sends a direct message that was posted to a bot on
+// to the bot's integration. If the integration replies with some text then
+// that is posted back to the channel by the bot.
+func forwardDirectMessageToBot(c *Context, post *model.Post, channel *model.Channel, sender *model.User) {
+	botId := channel.GetOtherUserIdForDM(sender.Id)
+	if len(botId) == 0 {
+		return
+	}
+
+	var bot *model.User
+	if result := <-Srv.Store.User().Get(botId); result.Err != nil {
+		l4g.Error(utils.T("api.bot.forward_direct_message.get_bot.error"), botId, result.Err)
+		return
+	} else {
+		bot = result.Data.(*model.User)
+	}
+
+	callbackURL := bot.Props[model.USER_PROP_BOT_CALLBACK_URL]
+	secret := bot.Props[model.USER_PROP_BOT_SECRET]
+	if !*utils.Cfg.ServiceSettings.EnableBotCallbacks || !bot.IsBot || bot.DeleteAt != 0 || len(callbackURL) == 0 || len(secret) == 0 {
+		return
+	}
+
+	if !utils.IsValidUntrustedUrl(callbackURL) {
+		l4g.Error(utils.T("api.bot.forward_direct_message.url.error"), bot.Id)
+		return
+	}
+
+	payload := model.StringInterface{
+		"bot_id":     bot.Id,
+		"team_id":    channel.TeamId,
+		"channel_id": channel.Id,
+		"post_id":    post.Id,
+		"timestamp":  post.CreateAt,
+		"user_id":    sender.Id,
+		"user_name":  sender.Username,
+		"text":       post.Message,
+	}
+
+	body := []byte(model.StringInterfaceToJson(payload))
+
+	req, _ := http.NewRequest("POST", callbackURL, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set(model.HEADER_WEBHOOK_SIGNATURE, model.SignOutgoingWebhookPayload(secret, body))
+
+	client := utils.NewUntrustedHttpClient(time.Duration(*utils.Cfg.ServiceSettings.OutgoingWebhookTimeout) * time.Second)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		l4g.Error(utils.T("api.bot.forward_direct_message.request.error"), bot.Id, err.Error())
+		return
+	}
+
+	respBody, err := ioutil.ReadAll(io.LimitReader(resp.Body, BOT_MESSAGE_MAX_RESPONSE))
+	resp.Body.Close()
+
+	if err != nil || resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		l4g.Error(utils.T("api.bot.forward_direct_message.response.error"), bot.Id, resp.Status)
+		return
+	}
+
+	respProps := model.MapFromJson(strings.NewReader(string(respBody)))
+	if text, ok := respProps["text"]; !ok || len(text) == 0 {
+		return
+	}
+
+	// create a mock session for the bot to reply with
+	bc := &Context{
+		Session:   model.Session{UserId: bot.Id, TeamId: c.Session.TeamId, IsOAuth: false},
+		RequestId: model.NewId(),
+		siteURL:   c.GetSiteURL(),
+		T:         utils.TfuncWithFallback(model.DEFAULT_LOCALE),
+		Locale:    model.DEFAULT_LOCALE,
+	}
+
+	reply := &model.Post{ChannelId: channel.Id, Message: respProps["text"], UserId: bot.Id}
+	if _, err := CreatePost(bc, reply, false); err != nil {
+		l4g.Error(utils.T("api.bot.forward_direct_message.reply.error"), bot.Id, err)
+	}
+}
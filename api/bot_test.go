@@ -0,0 +1,184 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package api
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattermost/platform/model"
+	"github.com/mattermost/platform/store"
+	"github.com/mattermost/platform/utils"
+)
+
+func TestBots(t *testing.T) {
+	Setup()
+
+	enableUserAccessTokens := *utils.Cfg.ServiceSettings.EnableUserAccessTokens
+	enableBotCallbacks := *utils.Cfg.ServiceSettings.EnableBotCallbacks
+	allowedInternalConnections := *utils.Cfg.ServiceSettings.AllowedUntrustedInternalConnections
+	defer func() {
+		*utils.Cfg.ServiceSettings.EnableUserAccessTokens = enableUserAccessTokens
+		*utils.Cfg.ServiceSettings.EnableBotCallbacks = enableBotCallbacks
+		*utils.Cfg.ServiceSettings.AllowedUntrustedInternalConnections = allowedInternalConnections
+	}()
+	*utils.Cfg.ServiceSettings.EnableUserAccessTokens = true
+	*utils.Cfg.ServiceSettings.EnableBotCallbacks = false
+	*utils.Cfg.ServiceSettings.AllowedUntrustedInternalConnections = "127.0.0.1"
+
+	adminEmail := strings.ToLower(model.NewId()) + "success+test@simulator.amazonses.com"
+	team := &model.Team{DisplayName: "Name", Name: "z-z-" + model.NewId() + "a", Email: adminEmail, Type: model.TEAM_OPEN}
+	team = Client.Must(Client.CreateTeam(team)).Data.(*model.Team)
+
+	user := &model.User{TeamId: team.Id, Email: adminEmail, Nickname: "Corey Hulen", Password: "pwd"}
+	user = Client.Must(Client.CreateUser(user, "")).Data.(*model.User)
+	store.Must(Srv.Store.User().VerifyEmail(user.Id))
+
+	user2 := &model.User{TeamId: team.Id, Email: strings.ToLower(model.NewId()) + "success+test@simulator.amazonses.com", Nickname: "Corey Hulen", Password: "pwd"}
+	user2 = Client.Must(Client.CreateUser(user2, "")).Data.(*model.User)
+	store.Must(Srv.Store.User().VerifyEmail(user2.Id))
+
+	guest := &model.User{TeamId: team.Id, Email: strings.ToLower(model.NewId()) + "success+test@simulator.amazonses.com", Nickname: "Corey Hulen", Password: "pwd"}
+	guest = Client.Must(Client.CreateUser(guest, "")).Data.(*model.User)
+	store.Must(Srv.Store.User().VerifyEmail(guest.Id))
+	guest.Roles = model.ROLE_GUEST
+	store.Must(Srv.Store.User().Update(guest, true))
+
+	username := "bot" + strings.ToLower(model.NewId())[:10]
+
+	Client.Must(Client.LoginByEmail(team.Name, user2.Email, "pwd"))
+
+	if _, err := Client.CreateBot(map[string]string{"username": username}); err == nil {
+		t.Fatal("should have failed, only team admins can create bots")
+	}
+
+	Client.Must(Client.LoginByEmail(team.Name, guest.Email, "pwd"))
+
+	if _, err := Client.CreateBot(map[string]string{"username": username}); err == nil {
+		t.Fatal("should have failed, guests can't create bots")
+	}
+
+	Client.Must(Client.LoginByEmail(team.Name, user.Email, "pwd"))
+
+	// stands in for the bot's integration, which echoes back what it is sent
+	messages := make(chan string, 1)
+	signatures := make(chan string, 1)
+	bodies := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		props := model.MapFromJson(bytes.NewReader(body))
+		messages <- props["text"]
+		signatures <- r.Header.Get(model.HEADER_WEBHOOK_SIGNATURE)
+		bodies <- body
+
+		w.Write([]byte(model.MapToJson(map[string]string{"text": "echo " + props["text"]})))
+	}))
+	defer server.Close()
+
+	if _, err := Client.CreateBot(map[string]string{"username": "not a username"}); err == nil {
+		t.Fatal("should have failed, bad username")
+	}
+
+	if _, err := Client.CreateBot(map[string]string{"username": username, "callback_url": server.URL}); err == nil {
+		t.Fatal("should have failed, bot callbacks are disabled")
+	}
+
+	*utils.Cfg.ServiceSettings.EnableBotCallbacks = true
+
+	if _, err := Client.CreateBot(map[string]string{"username": username, "callback_url": "http://10.0.0.1/bot"}); err == nil {
+		t.Fatal("should have failed, internal URL")
+	}
+
+	bot := Client.Must(Client.CreateBot(map[string]string{"username": username, "callback_url": server.URL})).Data.(*model.User)
+	if !bot.IsBot || bot.BotOwnerId != user.Id || bot.Username != username {
+		t.Fatal("should have made a bot owned by the user")
+	}
+
+	secret := bot.Props[model.USER_PROP_BOT_SECRET]
+	if len(secret) == 0 {
+		t.Fatal("should have given the owner the bot's secret")
+	}
+
+	if bots := Client.Must(Client.GetBots()).Data.(map[string]*model.User); len(bots) != 1 || bots[bot.Id] == nil || bots[bot.Id].Props[model.USER_PROP_BOT_SECRET] != secret {
+		t.Fatal("should have listed the bot with its secret")
+	}
+
+	if _, err := Client.LoginByUsername(team.Name, username, ""); err == nil {
+		t.Fatal("bots shouldn't be able to log in")
+	}
+
+	token := Client.Must(Client.CreateUserAccessToken(bot.Id, &model.UserAccessToken{Scopes: model.USER_ACCESS_TOKEN_SCOPE_READ})).Data.(*model.UserAccessToken)
+
+	BotClient := model.NewClient(Client.Url)
+	BotClient.MockSession(token.Token)
+	if me := BotClient.Must(BotClient.GetMe("")).Data.(*model.User); me.Id != bot.Id {
+		t.Fatal("should have acted as the bot")
+	} else if len(me.Props[model.USER_PROP_BOT_SECRET]) != 0 {
+		t.Fatal("should only have shown the secret to the bot's owner")
+	}
+
+	channel := Client.Must(Client.CreateDirectChannel(map[string]string{"user_id": bot.Id})).Data.(*model.Channel)
+	Client.Must(Client.CreatePost(&model.Post{ChannelId: channel.Id, Message: "hello"}))
+
+	select {
+	case message := <-messages:
+		if message != "hello" {
+			t.Fatal("should have forwarded the message")
+		}
+
+		if signature := <-signatures; signature != model.SignOutgoingWebhookPayload(secret, <-bodies) {
+			t.Fatal("should have signed the message with the bot's secret")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the message wasn't forwarded to the bot")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	posts := Client.Must(Client.GetPosts(channel.Id, 0, 1, "")).Data.(*model.PostList)
+	if reply := posts.Posts[posts.Order[0]]; reply.UserId != bot.Id || reply.Message != "echo hello" {
+		t.Fatal("the bot should have replied")
+	}
+
+	Client.LoginByEmail(team.Name, user2.Email, "pwd")
+
+	if bots := Client.Must(Client.GetBots()).Data.(map[string]*model.User); len(bots) != 0 {
+		t.Fatal("shouldn't have listed someone else's bot")
+	}
+
+	if _, err := Client.UpdateBot(bot.Id, map[string]string{"nickname": "mine"}); err == nil {
+		t.Fatal("should have failed, not the bot's owner")
+	}
+
+	if _, err := Client.GetUserAccessTokens(bot.Id); err == nil {
+		t.Fatal("should have failed, not the bot's owner")
+	}
+
+	Client.LoginByEmail(team.Name, user.Email, "pwd")
+
+	if rbot := Client.Must(Client.UpdateBot(bot.Id, map[string]string{"nickname": "Echo"})).Data.(*model.User); rbot.Nickname != "Echo" || !rbot.IsBot {
+		t.Fatal("should have updated the bot")
+	}
+
+	if rbot := store.Must(Srv.Store.User().Get(bot.Id)).(*model.User); rbot.Props[model.USER_PROP_BOT_CALLBACK_URL] != server.URL || rbot.Props[model.USER_PROP_BOT_SECRET] != secret {
+		t.Fatal("should have kept the callback when only the nickname was changed")
+	}
+
+	Client.Must(Client.UpdateBot(bot.Id, map[string]string{"callback_url": ""}))
+
+	if rbot := store.Must(Srv.Store.User().Get(bot.Id)).(*model.User); rbot.Nickname != "Echo" || len(rbot.Props[model.USER_PROP_BOT_CALLBACK_URL]) != 0 || len(rbot.Props[model.USER_PROP_BOT_SECRET]) != 0 {
+		t.Fatal("should have only removed the callback")
+	}
+
+	if result := <-Srv.Store.User().AnalyticsUniqueUserCount(team.Id); result.Err != nil {
+		t.Fatal(result.Err)
+	} else if result.Data.(int64) != 3 {
+		t.Fatal("bots shouldn't have been counted")
+	}
+}
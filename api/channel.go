@@ -18,29 +18,30 @@ const (
 	defaultExtraMemberLimit = 100
 )
 
-func InitChannel(r *mux.Router) {
+func InitChannel(routers ...*mux.Router) {
 	l4g.Debug(utils.T("api.channel.init.debug"))
 
-	sr := r.PathPrefix("/channels").Subrouter()
-	sr.Handle("/", ApiUserRequiredActivity(getChannels, false)).Methods("GET")
-	sr.Handle("/more", ApiUserRequired(getMoreChannels)).Methods("GET")
-	sr.Handle("/counts", ApiUserRequiredActivity(getChannelCounts, false)).Methods("GET")
-	sr.Handle("/create", ApiUserRequired(createChannel)).Methods("POST")
-	sr.Handle("/create_direct", ApiUserRequired(createDirectChannel)).Methods("POST")
-	sr.Handle("/update", ApiUserRequired(updateChannel)).Methods("POST")
-	sr.Handle("/update_header", ApiUserRequired(updateChannelHeader)).Methods("POST")
-	sr.Handle("/update_purpose", ApiUserRequired(updateChannelPurpose)).Methods("POST")
-	sr.Handle("/update_notify_props", ApiUserRequired(updateNotifyProps)).Methods("POST")
-	sr.Handle("/{id:[A-Za-z0-9]+}/", ApiUserRequiredActivity(getChannel, false)).Methods("GET")
-	sr.Handle("/{id:[A-Za-z0-9]+}/extra_info", ApiUserRequired(getChannelExtraInfo)).Methods("GET")
-	sr.Handle("/{id:[A-Za-z0-9]+}/extra_info/{member_limit:-?[0-9]+}", ApiUserRequired(getChannelExtraInfo)).Methods("GET")
-	sr.Handle("/{id:[A-Za-z0-9]+}/join", ApiUserRequired(join)).Methods("POST")
-	sr.Handle("/{id:[A-Za-z0-9]+}/leave", ApiUserRequired(leave)).Methods("POST")
-	sr.Handle("/{id:[A-Za-z0-9]+}/delete", ApiUserRequired(deleteChannel)).Methods("POST")
-	sr.Handle("/{id:[A-Za-z0-9]+}/add", ApiUserRequired(addMember)).Methods("POST")
-	sr.Handle("/{id:[A-Za-z0-9]+}/remove", ApiUserRequired(removeMember)).Methods("POST")
-	sr.Handle("/{id:[A-Za-z0-9]+}/update_last_viewed_at", ApiUserRequired(updateLastViewedAt)).Methods("POST")
-
+	for _, r := range routers {
+		sr := r.PathPrefix("/channels").Subrouter()
+		sr.Handle("/", ApiUserRequiredActivity(getChannels, false)).Methods("GET")
+		sr.Handle("/more", ApiUserRequired(getMoreChannels)).Methods("GET")
+		sr.Handle("/counts", ApiUserRequiredActivity(getChannelCounts, false)).Methods("GET")
+		sr.Handle("/create", ApiUserRequired(createChannel)).Methods("POST")
+		sr.Handle("/create_direct", ApiUserRequired(createDirectChannel)).Methods("POST")
+		sr.Handle("/update", ApiUserRequired(updateChannel)).Methods("POST")
+		sr.Handle("/update_header", ApiUserRequired(updateChannelHeader)).Methods("POST")
+		sr.Handle("/update_purpose", ApiUserRequired(updateChannelPurpose)).Methods("POST")
+		sr.Handle("/update_notify_props", ApiUserRequired(updateNotifyProps)).Methods("POST")
+		sr.Handle("/{id:[A-Za-z0-9]+}/", ApiUserRequiredActivity(getChannel, false)).Methods("GET")
+		sr.Handle("/{id:[A-Za-z0-9]+}/extra_info", ApiUserRequired(getChannelExtraInfo)).Methods("GET")
+		sr.Handle("/{id:[A-Za-z0-9]+}/extra_info/{member_limit:-?[0-9]+}", ApiUserRequired(getChannelExtraInfo)).Methods("GET")
+		sr.Handle("/{id:[A-Za-z0-9]+}/join", ApiUserRequired(join)).Methods("POST")
+		sr.Handle("/{id:[A-Za-z0-9]+}/leave", ApiUserRequired(leave)).Methods("POST")
+		sr.Handle("/{id:[A-Za-z0-9]+}/delete", ApiUserRequired(deleteChannel)).Methods("POST")
+		sr.Handle("/{id:[A-Za-z0-9]+}/add", ApiUserRequired(addMember)).Methods("POST")
+		sr.Handle("/{id:[A-Za-z0-9]+}/remove", ApiUserRequired(removeMember)).Methods("POST")
+		sr.Handle("/{id:[A-Za-z0-9]+}/update_last_viewed_at", ApiUserRequired(updateLastViewedAt)).Methods("POST")
+	}
 }
 
 func createChannel(c *Context, w http.ResponseWriter, r *http.Request) {
@@ -66,6 +67,17 @@ func createChannel(c *Context, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	permission := model.PERMISSION_CREATE_PUBLIC_CHANNEL
+	if channel.Type == model.CHANNEL_PRIVATE {
+		permission = model.PERMISSION_CREATE_PRIVATE_CHANNEL
+	}
+
+	if !c.HasPermission(permission, channel.TeamId) {
+		c.Err = model.NewLocAppError("createChannel", "api.channel.create_channel.permissions.app_error", nil, "")
+		c.Err.StatusCode = http.StatusForbidden
+		return
+	}
+
 	channel.CreatorId = c.Session.UserId
 
 	if sc, err := CreateChannel(c, channel, true); err != nil {
@@ -139,6 +151,17 @@ func CreateDirectChannel(c *Context, otherUserId string) (*model.Channel, *model
 		return nil, model.NewLocAppError("CreateDirectChannel", "api.channel.create_direct_channel.invalid_user.app_error", nil, otherUserId)
 	}
 
+	// guests can only message the people in their channels
+	if c.IsGuest() {
+		if result := <-Srv.Store.Channel().GetUserIdsInSharedChannels(c.Session.TeamId, c.Session.UserId); result.Err != nil {
+			return nil, result.Err
+		} else if !result.Data.(map[string]bool)[otherUserId] {
+			err := model.NewLocAppError("CreateDirectChannel", "api.channel.create_direct_channel.guest.app_error", nil, otherUserId)
+			err.StatusCode = http.StatusForbidden
+			return nil, err
+		}
+	}
+
 	cm1 := &model.ChannelMember{
 		UserId:      c.Session.UserId,
 		Roles:       model.CHANNEL_ROLE_ADMIN,
@@ -199,7 +222,7 @@ func updateChannel(c *Context, w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		if !strings.Contains(channelMember.Roles, model.CHANNEL_ROLE_ADMIN) && !strings.Contains(c.Session.Roles, model.ROLE_TEAM_ADMIN) {
+		if !strings.Contains(channelMember.Roles, model.CHANNEL_ROLE_ADMIN) && !c.HasPermission(model.PERMISSION_MANAGE_CHANNELS, oldChannel.TeamId) {
 			c.Err = model.NewLocAppError("updateChannel", "api.channel.update_channel.permission.app_error", nil, "")
 			c.Err.StatusCode = http.StatusForbidden
 			return
@@ -392,6 +415,12 @@ func getMoreChannels(c *Context, w http.ResponseWriter, r *http.Request) {
 
 	// user is already in the team
 
+	// guests only see the channels that they've been added to
+	if c.IsGuest() {
+		w.Write([]byte((&model.ChannelList{Channels: []*model.Channel{}, Members: make(map[string]*model.ChannelMember)}).ToJson()))
+		return
+	}
+
 	if result := <-Srv.Store.Channel().GetMoreChannels(c.Session.TeamId, c.Session.UserId); result.Err != nil {
 		c.Err = result.Err
 		return
@@ -455,6 +484,12 @@ func JoinChannel(c *Context, channelId string, role string) {
 			return
 		}
 
+		if user.IsGuest() {
+			c.Err = model.NewLocAppError("join", "api.channel.join_channel.guest.app_error", nil, "")
+			c.Err.StatusCode = http.StatusForbidden
+			return
+		}
+
 		if channel.Type == model.CHANNEL_OPEN {
 			if _, err := AddUserToChannel(user, channel); err != nil {
 				c.Err = err
@@ -507,12 +542,12 @@ func AddUserToChannel(user *model.User, channel *model.Channel) (*model.ChannelM
 	return newMember, nil
 }
 
-func JoinDefaultChannels(user *model.User, channelRole string) *model.AppError {
+func JoinDefaultChannels(teamId string, user *model.User, channelRole string) *model.AppError {
 	// We don't call JoinChannel here since c.Session is not populated on user creation
 
 	var err *model.AppError = nil
 
-	if result := <-Srv.Store.Channel().GetByName(user.TeamId, "town-square"); result.Err != nil {
+	if result := <-Srv.Store.Channel().GetByName(teamId, "town-square"); result.Err != nil {
 		err = result.Err
 	} else {
 		cm := &model.ChannelMember{ChannelId: result.Data.(*model.Channel).Id, UserId: user.Id,
@@ -523,7 +558,7 @@ func JoinDefaultChannels(user *model.User, channelRole string) *model.AppError {
 		}
 	}
 
-	if result := <-Srv.Store.Channel().GetByName(user.TeamId, "off-topic"); result.Err != nil {
+	if result := <-Srv.Store.Channel().GetByName(teamId, "off-topic"); result.Err != nil {
 		err = result.Err
 	} else {
 		cm := &model.ChannelMember{ChannelId: result.Data.(*model.Channel).Id, UserId: user.Id,
@@ -623,7 +658,7 @@ func deleteChannel(c *Context, w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		if !strings.Contains(channelMember.Roles, model.CHANNEL_ROLE_ADMIN) && !strings.Contains(c.Session.Roles, model.ROLE_TEAM_ADMIN) {
+		if !strings.Contains(channelMember.Roles, model.CHANNEL_ROLE_ADMIN) && !c.HasPermission(model.PERMISSION_MANAGE_CHANNELS, channel.TeamId) {
 			c.Err = model.NewLocAppError("deleteChannel", "api.channel.delete_channel.permissions.app_error", nil, "")
 			c.Err.StatusCode = http.StatusForbidden
 			return
@@ -766,6 +801,7 @@ func getChannelExtraInfo(c *Context, w http.ResponseWriter, r *http.Request) {
 	scm := Srv.Store.Channel().GetMember(id, c.Session.UserId)
 	ecm := Srv.Store.Channel().GetExtraMembers(id, memberLimit)
 	ccm := Srv.Store.Channel().GetMemberCount(id)
+	pcm := Srv.Store.Post().GetPinnedPostCount(id)
 
 	if cmresult := <-scm; cmresult.Err != nil {
 		c.Err = cmresult.Err
@@ -776,10 +812,14 @@ func getChannelExtraInfo(c *Context, w http.ResponseWriter, r *http.Request) {
 	} else if ccmresult := <-ccm; ccmresult.Err != nil {
 		c.Err = ccmresult.Err
 		return
+	} else if pcmresult := <-pcm; pcmresult.Err != nil {
+		c.Err = pcmresult.Err
+		return
 	} else {
 		member := cmresult.Data.(model.ChannelMember)
 		extraMembers := ecmresult.Data.([]model.ExtraMember)
 		memberCount := ccmresult.Data.(int64)
+		pinnedPostCount := pcmresult.Data.(int64)
 
 		if !c.HasPermissionsToTeam(channel.TeamId, "getChannelExtraInfo") {
 			return
@@ -795,7 +835,7 @@ func getChannelExtraInfo(c *Context, w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		data := model.ChannelExtra{Id: channel.Id, Members: extraMembers, MemberCount: memberCount}
+		data := model.ChannelExtra{Id: channel.Id, Members: extraMembers, MemberCount: memberCount, PinnedPostCount: pinnedPostCount}
 		w.Header().Set(model.HEADER_ETAG_SERVER, extraEtag)
 		w.Write([]byte(data.ToJson()))
 	}
@@ -884,7 +924,7 @@ func removeMember(c *Context, w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		if !strings.Contains(removerChannelMember.Roles, model.CHANNEL_ROLE_ADMIN) && !c.IsTeamAdmin() {
+		if !strings.Contains(removerChannelMember.Roles, model.CHANNEL_ROLE_ADMIN) && !c.HasPermission(model.PERMISSION_MANAGE_CHANNELS, channel.TeamId) {
 			c.Err = model.NewLocAppError("updateChannel", "api.channel.remove_member.permissions.app_error", nil, "")
 			c.Err.StatusCode = http.StatusForbidden
 			return
@@ -965,6 +1005,18 @@ func updateNotifyProps(c *Context, w http.ResponseWriter, r *http.Request) {
 		member.NotifyProps["desktop"] = desktop
 	}
 
+	if email, exists := data["email"]; exists {
+		member.NotifyProps["email"] = email
+	}
+
+	if push, exists := data["push"]; exists {
+		member.NotifyProps["push"] = push
+	}
+
+	if mute, exists := data["mute"]; exists {
+		member.NotifyProps["mute"] = mute
+	}
+
 	if result := <-Srv.Store.Channel().UpdateMember(&member); result.Err != nil {
 		c.Err = result.Err
 		return
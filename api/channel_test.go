@@ -985,6 +985,30 @@ func TestUpdateNotifyProps(t *testing.T) {
 		t.Fatal("NotifyProps[\"mark_unread\"] did not update properly")
 	}
 
+	// test updating email, push and mute
+	data["email"] = model.CHANNEL_NOTIFY_ALL
+	data["push"] = model.CHANNEL_NOTIFY_NONE
+	data["mute"] = "true"
+
+	if result, err := Client.UpdateNotifyProps(data); err != nil {
+		t.Fatal(err)
+	} else if notifyProps := result.Data.(map[string]string); notifyProps["email"] != model.CHANNEL_NOTIFY_ALL {
+		t.Fatal("NotifyProps[\"email\"] did not update properly")
+	} else if notifyProps["push"] != model.CHANNEL_NOTIFY_NONE {
+		t.Fatal("NotifyProps[\"push\"] did not update properly")
+	} else if notifyProps["mute"] != "true" {
+		t.Fatal("NotifyProps[\"mute\"] did not update properly")
+	}
+
+	data["push"] = "junk"
+	if _, err := Client.UpdateNotifyProps(data); err == nil {
+		t.Fatal("Should have errored - bad push level")
+	}
+
+	delete(data, "email")
+	delete(data, "push")
+	delete(data, "mute")
+
 	// test error cases
 	data["user_id"] = "junk"
 	if _, err := Client.UpdateNotifyProps(data); err == nil {
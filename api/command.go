@@ -4,7 +4,10 @@
 package api
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
 	"crypto/tls"
+	"encoding/hex"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -38,23 +41,27 @@ func GetCommandProvider(name string) CommandProvider {
 	return nil
 }
 
-func InitCommand(r *mux.Router) {
+func InitCommand(routers ...*mux.Router) {
 	l4g.Debug(utils.T("api.command.init.debug"))
 
-	sr := r.PathPrefix("/commands").Subrouter()
+	for _, r := range routers {
+		sr := r.PathPrefix("/commands").Subrouter()
 
-	sr.Handle("/execute", ApiUserRequired(executeCommand)).Methods("POST")
-	sr.Handle("/list", ApiUserRequired(listCommands)).Methods("GET")
+		sr.Handle("/execute", ApiUserRequired(executeCommand)).Methods("POST")
+		sr.Handle("/list", ApiUserRequired(listCommands)).Methods("GET")
 
-	sr.Handle("/create", ApiUserRequired(createCommand)).Methods("POST")
-	sr.Handle("/list_team_commands", ApiUserRequired(listTeamCommands)).Methods("GET")
-	sr.Handle("/regen_token", ApiUserRequired(regenCommandToken)).Methods("POST")
-	sr.Handle("/delete", ApiUserRequired(deleteCommand)).Methods("POST")
+		sr.Handle("/create", ApiUserRequired(createCommand)).Methods("POST")
+		sr.Handle("/list_team_commands", ApiUserRequired(listTeamCommands)).Methods("GET")
+		sr.Handle("/regen_token", ApiUserRequired(regenCommandToken)).Methods("POST")
+		sr.Handle("/delete", ApiUserRequired(deleteCommand)).Methods("POST")
 
-	sr.Handle("/test", ApiAppHandler(testCommand)).Methods("POST")
-	sr.Handle("/test", ApiAppHandler(testCommand)).Methods("GET")
-	sr.Handle("/test_e", ApiAppHandler(testEphemeralCommand)).Methods("POST")
-	sr.Handle("/test_e", ApiAppHandler(testEphemeralCommand)).Methods("GET")
+		sr.Handle("/response/{id:[A-Za-z0-9]+}/{signature:[a-f0-9]+}", ApiAppHandler(commandResponse)).Methods("POST")
+
+		sr.Handle("/test", ApiAppHandler(testCommand)).Methods("POST")
+		sr.Handle("/test", ApiAppHandler(testCommand)).Methods("GET")
+		sr.Handle("/test_e", ApiAppHandler(testEphemeralCommand)).Methods("POST")
+		sr.Handle("/test_e", ApiAppHandler(testEphemeralCommand)).Methods("GET")
+	}
 }
 
 func listCommands(c *Context, w http.ResponseWriter, r *http.Request) {
@@ -176,7 +183,13 @@ func executeCommand(c *Context, w http.ResponseWriter, r *http.Request) {
 
 					p.Set("command", "/"+trigger)
 					p.Set("text", message)
-					p.Set("response_url", "not supported yet")
+
+					if responseURL, err := createCommandResponseURL(c, cmd, channelId); err != nil {
+						c.Err = err
+						return
+					} else {
+						p.Set("response_url", responseURL)
+					}
 
 					method := "POST"
 					if cmd.Method == model.COMMAND_METHOD_GET {
@@ -245,6 +258,11 @@ func handleResponse(c *Context, w http.ResponseWriter, response *model.CommandRe
 		}
 	}
 
+	if response.Attachments != nil {
+		post.Type = model.POST_SLACK_ATTACHMENT
+		post.AddProp("attachments", response.Attachments)
+	}
+
 	if response.ResponseType == model.COMMAND_RESPONSE_TYPE_IN_CHANNEL {
 		post.Message = response.Text
 		if _, err := CreatePost(c, post, true); err != nil {
@@ -263,6 +281,107 @@ func handleResponse(c *Context, w http.ResponseWriter, response *model.CommandRe
 	w.Write([]byte(response.ToJson()))
 }
 
+// createCommandResponseURL mints the URL that a custom command can use to post
+// a delayed response after answering the original request.
+func createCommandResponseURL(c *Context, cmd *model.Command, channelId string) (string, *model.AppError) {
+	hook := &model.CommandWebhook{
+		CommandId: cmd.Id,
+		UserId:    c.Session.UserId,
+		TeamId:    c.Session.TeamId,
+		ChannelId: channelId,
+		SiteURL:   c.GetSiteURL(),
+	}
+
+	if result := <-Srv.Store.Command().SaveWebhook(hook); result.Err != nil {
+		return "", result.Err
+	}
+
+	return c.GetSiteURL() + model.API_URL_SUFFIX + "/commands/response/" + hook.Id + "/" + signCommandWebhookId(hook.Id), nil
+}
+
+// signCommandWebhookId signs the id of a delayed response hook. The key is
+// derived from AtRestEncryptKey rather than being that key itself, so it is
+// only ever used to sign response URLs.
+func signCommandWebhookId(id string) string {
+	keyMac := hmac.New(sha256.New, []byte(utils.Cfg.SqlSettings.AtRestEncryptKey))
+	keyMac.Write([]byte("command_response_url"))
+
+	mac := hmac.New(sha256.New, keyMac.Sum(nil))
+	mac.Write([]byte(id))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func commandResponse(c *Context, w http.ResponseWriter, r *http.Request) {
+	if !*utils.Cfg.ServiceSettings.EnableCommands {
+		c.Err = model.NewLocAppError("commandResponse", "api.command.disabled.app_error", nil, "")
+		c.Err.StatusCode = http.StatusNotImplemented
+		return
+	}
+
+	params := mux.Vars(r)
+	id := params["id"]
+
+	if !hmac.Equal([]byte(params["signature"]), []byte(signCommandWebhookId(id))) {
+		c.Err = model.NewLocAppError("commandResponse", "api.command.response.invalid.app_error", nil, "id="+id)
+		c.Err.StatusCode = http.StatusForbidden
+		return
+	}
+
+	response := model.CommandResponseFromJson(r.Body)
+	if response == nil {
+		c.SetInvalidParam("commandResponse", "response")
+		return
+	}
+
+	var hook *model.CommandWebhook
+	if result := <-Srv.Store.Command().GetWebhook(id); result.Err != nil {
+		c.Err = model.NewLocAppError("commandResponse", "api.command.response.invalid.app_error", nil, "id="+id)
+		c.Err.StatusCode = http.StatusForbidden
+		return
+	} else {
+		hook = result.Data.(*model.CommandWebhook)
+	}
+
+	if hook.IsExpired(model.GetMillis()) {
+		c.Err = model.NewLocAppError("commandResponse", "api.command.response.expired.app_error", nil, "id="+id)
+		c.Err.StatusCode = http.StatusForbidden
+		return
+	}
+
+	cchan := Srv.Store.Channel().CheckPermissionsTo(hook.TeamId, hook.ChannelId, hook.UserId)
+
+	var cmd *model.Command
+	if result := <-Srv.Store.Command().Get(hook.CommandId); result.Err != nil {
+		c.Err = result.Err
+		return
+	} else {
+		cmd = result.Data.(*model.Command)
+	}
+
+	// the user who ran the command may have left the channel since
+	if result := <-cchan; result.Err != nil || result.Data.(int64) != 1 {
+		c.Err = model.NewLocAppError("commandResponse", "api.command.response.permissions.app_error", nil, "id="+id)
+		c.Err.StatusCode = http.StatusForbidden
+		return
+	}
+
+	if result := <-Srv.Store.Command().UseWebhook(id); result.Err != nil {
+		c.Err = result.Err
+		return
+	} else if !result.Data.(bool) {
+		c.Err = model.NewLocAppError("commandResponse", "api.command.response.expired.app_error", nil, "id="+id)
+		c.Err.StatusCode = http.StatusForbidden
+		return
+	}
+
+	// respond on behalf of the user who ran the command
+	c.Session.UserId = hook.UserId
+	c.Session.TeamId = hook.TeamId
+
+	handleResponse(c, w, response, hook.ChannelId, cmd, false)
+}
+
 func createCommand(c *Context, w http.ResponseWriter, r *http.Request) {
 	if !*utils.Cfg.ServiceSettings.EnableCommands {
 		c.Err = model.NewLocAppError("createCommand", "api.command.disabled.app_error", nil, "")
@@ -270,12 +389,10 @@ func createCommand(c *Context, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if *utils.Cfg.ServiceSettings.EnableOnlyAdminIntegrations {
-		if !(c.IsSystemAdmin() || c.IsTeamAdmin()) {
-			c.Err = model.NewLocAppError("createCommand", "api.command.admin_only.app_error", nil, "")
-			c.Err.StatusCode = http.StatusForbidden
-			return
-		}
+	if !c.HasPermission(model.PERMISSION_MANAGE_SLASH_COMMANDS, c.Session.TeamId) {
+		c.Err = model.NewLocAppError("createCommand", "api.command.admin_only.app_error", nil, "")
+		c.Err.StatusCode = http.StatusForbidden
+		return
 	}
 
 	c.LogAudit("attempt")
@@ -307,12 +424,10 @@ func listTeamCommands(c *Context, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if *utils.Cfg.ServiceSettings.EnableOnlyAdminIntegrations {
-		if !(c.IsSystemAdmin() || c.IsTeamAdmin()) {
-			c.Err = model.NewLocAppError("listTeamCommands", "api.command.admin_only.app_error", nil, "")
-			c.Err.StatusCode = http.StatusForbidden
-			return
-		}
+	if !c.HasPermission(model.PERMISSION_MANAGE_SLASH_COMMANDS, c.Session.TeamId) {
+		c.Err = model.NewLocAppError("listTeamCommands", "api.command.admin_only.app_error", nil, "")
+		c.Err.StatusCode = http.StatusForbidden
+		return
 	}
 
 	if result := <-Srv.Store.Command().GetByTeam(c.Session.TeamId); result.Err != nil {
@@ -331,12 +446,10 @@ func regenCommandToken(c *Context, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if *utils.Cfg.ServiceSettings.EnableOnlyAdminIntegrations {
-		if !(c.IsSystemAdmin() || c.IsTeamAdmin()) {
-			c.Err = model.NewLocAppError("regenCommandToken", "api.command.admin_only.app_error", nil, "")
-			c.Err.StatusCode = http.StatusForbidden
-			return
-		}
+	if !c.HasPermission(model.PERMISSION_MANAGE_SLASH_COMMANDS, c.Session.TeamId) {
+		c.Err = model.NewLocAppError("regenCommandToken", "api.command.admin_only.app_error", nil, "")
+		c.Err.StatusCode = http.StatusForbidden
+		return
 	}
 
 	c.LogAudit("attempt")
@@ -356,7 +469,7 @@ func regenCommandToken(c *Context, w http.ResponseWriter, r *http.Request) {
 	} else {
 		cmd = result.Data.(*model.Command)
 
-		if c.Session.TeamId != cmd.TeamId || (c.Session.UserId != cmd.CreatorId && !c.IsTeamAdmin()) {
+		if c.Session.TeamId != cmd.TeamId || (c.Session.UserId != cmd.CreatorId && !c.HasPermission(model.PERMISSION_MANAGE_OTHERS_SLASH_COMMANDS, c.Session.TeamId)) {
 			c.LogAudit("fail - inappropriate permissions")
 			c.Err = model.NewLocAppError("regenToken", "api.command.regen.app_error", nil, "user_id="+c.Session.UserId)
 			return
@@ -380,12 +493,10 @@ func deleteCommand(c *Context, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if *utils.Cfg.ServiceSettings.EnableOnlyAdminIntegrations {
-		if !(c.IsSystemAdmin() || c.IsTeamAdmin()) {
-			c.Err = model.NewLocAppError("deleteCommand", "api.command.admin_only.app_error", nil, "")
-			c.Err.StatusCode = http.StatusForbidden
-			return
-		}
+	if !c.HasPermission(model.PERMISSION_MANAGE_SLASH_COMMANDS, c.Session.TeamId) {
+		c.Err = model.NewLocAppError("deleteCommand", "api.command.admin_only.app_error", nil, "")
+		c.Err.StatusCode = http.StatusForbidden
+		return
 	}
 
 	c.LogAudit("attempt")
@@ -402,7 +513,7 @@ func deleteCommand(c *Context, w http.ResponseWriter, r *http.Request) {
 		c.Err = result.Err
 		return
 	} else {
-		if c.Session.TeamId != result.Data.(*model.Command).TeamId || (c.Session.UserId != result.Data.(*model.Command).CreatorId && !c.IsTeamAdmin()) {
+		if c.Session.TeamId != result.Data.(*model.Command).TeamId || (c.Session.UserId != result.Data.(*model.Command).CreatorId && !c.HasPermission(model.PERMISSION_MANAGE_OTHERS_SLASH_COMMANDS, c.Session.TeamId)) {
 			c.LogAudit("fail - inappropriate permissions")
 			c.Err = model.NewLocAppError("deleteCommand", "api.command.delete.app_error", nil, "user_id="+c.Session.UserId)
 			return
@@ -4,6 +4,12 @@
 package api
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -272,3 +278,107 @@ func TestTestCommand(t *testing.T) {
 		t.Fatal("Test command failed to send")
 	}
 }
+
+func TestSignCommandWebhookId(t *testing.T) {
+	Setup()
+
+	id := model.NewId()
+	signature := signCommandWebhookId(id)
+
+	if signature != signCommandWebhookId(id) {
+		t.Fatal("signature should be stable")
+	}
+
+	if signature == signCommandWebhookId(model.NewId()) {
+		t.Fatal("different ids should have different signatures")
+	}
+
+	mac := hmac.New(sha256.New, []byte(utils.Cfg.SqlSettings.AtRestEncryptKey))
+	mac.Write([]byte(id))
+	if signature == hex.EncodeToString(mac.Sum(nil)) {
+		t.Fatal("shouldn't sign with the at rest encryption key directly")
+	}
+}
+
+func TestCommandResponseURL(t *testing.T) {
+	Setup()
+	enableCommands := *utils.Cfg.ServiceSettings.EnableCommands
+	defer func() {
+		utils.Cfg.ServiceSettings.EnableCommands = &enableCommands
+	}()
+	*utils.Cfg.ServiceSettings.EnableCommands = true
+
+	team := &model.Team{DisplayName: "Name", Name: "z-z-" + model.NewId() + "a", Email: "test@nowhere.com", Type: model.TEAM_OPEN}
+	team = Client.Must(Client.CreateTeam(team)).Data.(*model.Team)
+
+	user := &model.User{TeamId: team.Id, Email: model.NewId() + "success+test@simulator.amazonses.com", Nickname: "Corey Hulen", Password: "pwd"}
+	user = Client.Must(Client.CreateUser(user, "")).Data.(*model.User)
+	store.Must(Srv.Store.User().VerifyEmail(user.Id))
+
+	c := &Context{}
+	c.RequestId = model.NewId()
+	c.IpAddress = "cmd_line"
+	UpdateRoles(c, user, model.ROLE_SYSTEM_ADMIN)
+	Client.LoginByEmail(team.Name, user.Email, "pwd")
+
+	channel1 := &model.Channel{DisplayName: "AA", Name: "aa" + model.NewId() + "a", Type: model.CHANNEL_OPEN, TeamId: team.Id}
+	channel1 = Client.Must(Client.CreateChannel(channel1)).Data.(*model.Channel)
+
+	// stands in for a slow service that acknowledges the command and answers later
+	responseURLs := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		responseURLs <- r.FormValue("response_url")
+
+		rc := &model.CommandResponse{ResponseType: model.COMMAND_RESPONSE_TYPE_EPHEMERAL, Text: "working on it"}
+		w.Write([]byte(rc.ToJson()))
+	}))
+	defer server.Close()
+
+	cmd := &model.Command{URL: server.URL, Method: model.COMMAND_METHOD_POST, Trigger: "slow"}
+	cmd = Client.Must(Client.CreateCommand(cmd)).Data.(*model.Command)
+
+	Client.Must(Client.Command(channel1.Id, "/slow", false))
+
+	responseURL := <-responseURLs
+	if !strings.HasPrefix(responseURL, "http") {
+		t.Fatalf("should have been given a response url %v", responseURL)
+	}
+
+	delayed := `{"response_type": "in_channel", "text": "done", "attachments": [{"text": "details"}]}`
+
+	badURL := responseURL[:len(responseURL)-1] + "0"
+	if badURL == responseURL {
+		badURL = responseURL[:len(responseURL)-1] + "1"
+	}
+
+	if resp, err := http.Post(badURL, "application/json", strings.NewReader(delayed)); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode == http.StatusOK {
+		t.Fatal("shouldn't accept a response url with a bad signature")
+	}
+
+	if resp, err := http.Post(responseURL, "application/json", strings.NewReader(delayed)); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode != http.StatusOK {
+		t.Fatalf("should have accepted the delayed response %v", resp.StatusCode)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	posts := Client.Must(Client.GetPosts(channel1.Id, 0, 2, "")).Data.(*model.PostList)
+	if len(posts.Order) != 1 {
+		t.Fatal("should have posted the delayed response")
+	}
+
+	post := posts.Posts[posts.Order[0]]
+	if post.Message != "done" || post.UserId != user.Id || post.Type != model.POST_SLACK_ATTACHMENT || post.Props["attachments"] == nil {
+		t.Fatal("delayed response was posted incorrectly")
+	}
+
+	if resp, err := http.Post(responseURL, "application/json", strings.NewReader(delayed)); err != nil {
+		t.Fatal(err)
+	} else if resp.StatusCode == http.StatusOK {
+		t.Fatal("shouldn't be able to use a response url twice")
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"strings"
 
 	l4g "github.com/alecthomas/log4go"
+	"github.com/gorilla/mux"
 	"github.com/mattermost/platform/model"
 	"github.com/mattermost/platform/store"
 	"github.com/mattermost/platform/utils"
@@ -150,6 +151,15 @@ func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	if len(token) != 0 {
 		session := GetSession(token)
+		if session != nil && session.IsUserAccessToken() && !*utils.Cfg.ServiceSettings.EnableUserAccessTokens {
+			// the token was cached before access tokens were turned off
+			RemoveAllUserAccessTokensFromCache()
+			session = nil
+		}
+
+		if session == nil && !isTokenFromQueryString {
+			session = GetSessionForUserAccessToken(token, c.IpAddress, r.URL.Path)
+		}
 
 		if session == nil || session.IsExpired() {
 			c.RemoveSessionCookie(w, r)
@@ -160,6 +170,9 @@ func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		} else if !session.IsOAuth && isTokenFromQueryString {
 			c.Err = model.NewLocAppError("ServeHTTP", "api.context.token_provided.app_error", nil, "token="+token)
 			c.Err.StatusCode = http.StatusUnauthorized
+		} else if !session.HasUserAccessTokenScope(requiredUserAccessTokenScope(r)) {
+			c.Err = model.NewLocAppError("ServeHTTP", "api.context.user_access_token_scope.app_error", nil, "token_id="+session.Id)
+			c.Err.StatusCode = http.StatusForbidden
 		} else {
 			c.Session = *session
 		}
@@ -178,6 +191,12 @@ func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		c.UserRequired()
 	}
 
+	// routes under /teams/{team_id} act on that team rather than the one the
+	// session was started in
+	if teamId := mux.Vars(r)["team_id"]; c.Err == nil && len(teamId) > 0 && len(c.Session.UserId) > 0 {
+		c.SetTeamFromRequest(teamId)
+	}
+
 	if c.Err == nil && h.requireSystemAdmin {
 		c.SystemAdminRequired()
 	}
@@ -213,6 +232,16 @@ func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// requiredUserAccessTokenScope returns the scope an access token needs to make
+// the request. Anything that isn't a plain read needs the write scope.
+func requiredUserAccessTokenScope(r *http.Request) string {
+	if r.Method == "GET" || r.Method == "HEAD" {
+		return model.USER_ACCESS_TOKEN_SCOPE_READ
+	}
+
+	return model.USER_ACCESS_TOKEN_SCOPE_WRITE
+}
+
 func (cw *CorsWrapper) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if len(*utils.Cfg.ServiceSettings.AllowCorsFrom) > 0 {
 		origin := r.Header.Get("Origin")
@@ -307,8 +336,21 @@ func (c *Context) HasPermissionsToUser(userId string, where string) bool {
 	return false
 }
 
+// SetTeamFromRequest makes teamId the current team for the rest of the request
+// as long as the user belongs to it.
+func (c *Context) SetTeamFromRequest(teamId string) {
+	if c.Session.GetTeamByTeamId(teamId) == nil && !c.IsSystemAdmin() {
+		c.Err = model.NewLocAppError("SetTeamFromRequest", "api.context.permissions.app_error", nil, "userId="+c.Session.UserId+", teamId="+teamId)
+		c.Err.StatusCode = http.StatusForbidden
+		return
+	}
+
+	c.Session.TeamId = teamId
+}
+
 func (c *Context) HasPermissionsToTeam(teamId string, where string) bool {
-	if c.Session.TeamId == teamId {
+	// the session's team may be one that the user has since left
+	if c.Session.GetTeamByTeamId(teamId) != nil {
 		return true
 	}
 
@@ -352,10 +394,50 @@ func (c *Context) IsSystemAdmin() bool {
 	return false
 }
 
+// IsGuest returns true if the user can only see the channels they've been added
+// to and the people in them.
+func (c *Context) IsGuest() bool {
+	return model.IsInRole(c.Session.Roles, model.ROLE_GUEST)
+}
+
 func (c *Context) IsTeamAdmin() bool {
-	if model.IsInRole(c.Session.Roles, model.ROLE_TEAM_ADMIN) || c.IsSystemAdmin() {
+	if member := c.Session.GetTeamByTeamId(c.Session.TeamId); member != nil && member.IsTeamAdmin() {
 		return true
 	}
+	return c.IsSystemAdmin()
+}
+
+// HasPermission returns true if any of the user's system roles, or the roles
+// they have in the team with teamId, grant the permission. System admins have
+// every permission.
+func (c *Context) HasPermission(permission string, teamId string) bool {
+	if c.IsSystemAdmin() {
+		return true
+	}
+
+	roleNames := model.GetSystemRoleNames(c.Session.Roles)
+	if member := c.Session.GetTeamByTeamId(teamId); member != nil {
+		roleNames = append(roleNames, model.GetTeamRoleNames(member, c.IsGuest())...)
+	}
+
+	roles, err := GetRolesForTeam(teamId)
+	if err != nil {
+		l4g.Error(utils.T("api.context.has_permission.roles.error"), teamId, err)
+		return false
+	}
+
+	onlyAdmins := *utils.Cfg.ServiceSettings.EnableOnlyAdminIntegrations && model.IsIntegrationPermission(permission)
+
+	for _, name := range roleNames {
+		if onlyAdmins && name != model.ROLE_TEAM_ADMIN && name != model.ROLE_SYSTEM_ADMIN {
+			continue
+		}
+
+		if role, ok := roles[name]; ok && role.HasPermission(permission) {
+			return true
+		}
+	}
+
 	return false
 }
 
@@ -542,6 +624,36 @@ func GetSession(token string) *model.Session {
 	return session
 }
 
+// RemoveAllSessionsForUserIdFromCache makes the user's sessions load again the
+// next time they're used, eg after the user joins a team. Every app server in
+// the cluster is told to do the same.
+func RemoveAllSessionsForUserIdFromCache(userId string) {
+	messageBus.RemoveAllSessionsForUserIdFromCache(userId)
+}
+
+func removeAllSessionsForUserIdFromLocalCache(userId string) {
+	if result := <-Srv.Store.Session().GetSessions(userId); result.Err != nil {
+		l4g.Error(result.Err)
+	} else {
+		for _, session := range result.Data.([]*model.Session) {
+			sessionCache.Remove(session.Token)
+		}
+	}
+
+	// sessions made from access tokens are only ever cached
+	removeUserAccessTokensFromLocalCache(func(session *model.Session) bool {
+		return session.UserId == userId
+	})
+}
+
+// AddSessionToCache also loads the teams the session's user belongs to so that
+// permission checks don't have to go to the database.
 func AddSessionToCache(session *model.Session) {
+	if result := <-Srv.Store.Team().GetTeamsForUser(session.UserId); result.Err != nil {
+		l4g.Error(utils.T("api.context.team_members.error"), session.UserId, result.Err)
+	} else {
+		session.TeamMembers = result.Data.([]*model.TeamMember)
+	}
+
 	sessionCache.AddWithExpiresInSecs(session.Token, session, int64(*utils.Cfg.ServiceSettings.SessionCacheInMinutes*60))
 }
@@ -0,0 +1,227 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package api
+
+import (
+	"fmt"
+	"html/template"
+	"time"
+
+	l4g "github.com/alecthomas/log4go"
+	"github.com/mattermost/platform/model"
+	"github.com/mattermost/platform/utils"
+)
+
+const (
+	EMAIL_BATCHING_POLL_INTERVAL = 60 * time.Second
+	EMAIL_BATCHING_BATCH_SIZE    = 100
+	EMAIL_BATCHING_CLAIM_LEASE   = 5 * time.Minute
+)
+
+var stopEmailBatching chan bool
+
+// queueEmailNotification holds on to a mention for a user who only wants to
+// be emailed every so often. It's sent as part of their next digest.
+func queueEmailNotification(c *Context, user *model.User, post *model.Post, team *model.Team, channel *model.Channel, senderName string, message string, interval int64) {
+	notification := &model.EmailNotification{
+		SendAt:          model.GetMillis() + interval,
+		UserId:          user.Id,
+		TeamId:          team.Id,
+		ChannelId:       channel.Id,
+		PostId:          post.Id,
+		TeamName:        team.Name,
+		TeamDisplayName: team.DisplayName,
+		ChannelName:     channel.Name,
+		ChannelType:     channel.Type,
+		SenderName:      senderName,
+		Message:         message,
+		SiteURL:         c.GetSiteURL(),
+	}
+
+	if channel.Type != model.CHANNEL_DIRECT {
+		notification.ChannelDisplayName = channel.DisplayName
+	}
+
+	if result := <-Srv.Store.EmailNotification().Save(notification); result.Err != nil {
+		l4g.Error(utils.T("api.email_batching.queue.save.error"), user.Id, result.Err)
+	}
+}
+
+// StartEmailBatchingJob starts the background job that sends digest emails to
+// users once their oldest queued notification is due.
+func StartEmailBatchingJob() {
+	if stopEmailBatching != nil {
+		return
+	}
+
+	stop := make(chan bool)
+	stopEmailBatching = stop
+
+	go func() {
+		ticker := time.NewTicker(EMAIL_BATCHING_POLL_INTERVAL)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				sendDueEmailDigests()
+			}
+		}
+	}()
+}
+
+func StopEmailBatchingJob() {
+	if stopEmailBatching != nil {
+		close(stopEmailBatching)
+		stopEmailBatching = nil
+	}
+}
+
+func sendDueEmailDigests() {
+	if result := <-Srv.Store.EmailNotification().GetDueUserIds(model.GetMillis(), EMAIL_BATCHING_BATCH_SIZE); result.Err != nil {
+		l4g.Error(utils.T("api.email_batching.get_due.error"), result.Err)
+	} else {
+		for _, userId := range result.Data.([]string) {
+			sendEmailDigest(userId)
+		}
+	}
+}
+
+func sendEmailDigest(userId string) {
+	var notifications []*model.EmailNotification
+	if result := <-Srv.Store.EmailNotification().GetForUser(userId); result.Err != nil {
+		l4g.Error(utils.T("api.email_batching.get_for_user.error"), userId, result.Err)
+		return
+	} else {
+		notifications = result.Data.([]*model.EmailNotification)
+	}
+
+	// another server may already be sending some of these
+	leaseUntil := model.GetMillis() + int64(EMAIL_BATCHING_CLAIM_LEASE/time.Millisecond)
+	claimed := []*model.EmailNotification{}
+	for _, notification := range notifications {
+		if result := <-Srv.Store.EmailNotification().Claim(notification.Id, leaseUntil); result.Err != nil {
+			l4g.Error(utils.T("api.email_batching.claim.error"), notification.Id, result.Err)
+		} else if result.Data.(bool) {
+			claimed = append(claimed, notification)
+		}
+	}
+
+	if len(claimed) == 0 {
+		return
+	}
+
+	var user *model.User
+	if result := <-Srv.Store.User().Get(userId); result.Err != nil {
+		l4g.Error(utils.T("api.email_batching.get_user.error"), userId, result.Err)
+		releaseEmailNotifications(claimed, leaseUntil)
+		return
+	} else {
+		user = result.Data.(*model.User)
+	}
+
+	// the user may have turned off emails or been deactivated since, in which
+	// case the digest is dropped rather than held on to
+	if user.DeleteAt > 0 || user.NotifyProps["email"] == "false" || !utils.Cfg.EmailSettings.SendEmailNotifications {
+		deleteEmailNotifications(claimed)
+		return
+	}
+
+	subject, body := renderEmailDigest(user, claimed)
+
+	if err := utils.SendMail(user.Email, subject, body); err != nil {
+		l4g.Error(utils.T("api.email_batching.send.error"), user.Email, err)
+		releaseEmailNotifications(claimed, leaseUntil)
+		return
+	}
+
+	deleteEmailNotifications(claimed)
+}
+
+// releaseEmailNotifications unlocks notifications that couldn't be sent so that
+// they go out with the user's next digest.
+func releaseEmailNotifications(notifications []*model.EmailNotification, leaseUntil int64) {
+	for _, notification := range notifications {
+		if result := <-Srv.Store.EmailNotification().Release(notification.Id, leaseUntil); result.Err != nil {
+			l4g.Error(utils.T("api.email_batching.release.error"), notification.Id, result.Err)
+		}
+	}
+}
+
+func deleteEmailNotifications(notifications []*model.EmailNotification) {
+	for _, notification := range notifications {
+		if result := <-Srv.Store.EmailNotification().Delete(notification.Id); result.Err != nil {
+			l4g.Error(utils.T("api.email_batching.delete.error"), notification.Id, result.Err)
+		}
+	}
+}
+
+// renderEmailDigest builds a single email out of the notifications, grouping
+// them by the channel they were posted in.
+func renderEmailDigest(user *model.User, notifications []*model.EmailNotification) (string, string) {
+	userLocale := utils.GetUserTranslations(user.Locale)
+
+	channelIds := []string{}
+	byChannel := map[string][]*model.EmailNotification{}
+	for _, notification := range notifications {
+		if _, ok := byChannel[notification.ChannelId]; !ok {
+			channelIds = append(channelIds, notification.ChannelId)
+		}
+
+		byChannel[notification.ChannelId] = append(byChannel[notification.ChannelId], notification)
+	}
+
+	var channels template.HTML
+	for _, channelId := range channelIds {
+		channelNotifications := byChannel[channelId]
+		first := channelNotifications[0]
+
+		var messages template.HTML
+		for _, notification := range channelNotifications {
+			tm := time.Unix(notification.CreateAt/1000, 0)
+			month := userLocale(tm.Month().String())
+			zone, _ := tm.Zone()
+
+			messagePage := utils.NewHTMLTemplate("digest_message", user.Locale)
+			messagePage.Props["PostMessage"] = model.ClearMentionTags(notification.Message)
+			messagePage.Props["Info"] = userLocale("api.templates.digest_body.info",
+				map[string]interface{}{"SenderName": notification.SenderName,
+					"Hour": fmt.Sprintf("%02d", tm.Hour()), "Minute": fmt.Sprintf("%02d", tm.Minute()),
+					"TimeZone": zone, "Month": month, "Day": fmt.Sprintf("%d", tm.Day())})
+
+			messages += template.HTML(messagePage.Render())
+		}
+
+		channelPage := utils.NewHTMLTemplate("digest_channel", user.Locale)
+		if first.ChannelType == model.CHANNEL_DIRECT {
+			channelPage.Props["ChannelName"] = userLocale("api.templates.digest_body.direct_channel",
+				map[string]interface{}{"SenderName": first.SenderName})
+		} else {
+			channelPage.Props["ChannelName"] = userLocale("api.templates.digest_body.channel",
+				map[string]interface{}{"ChannelName": first.ChannelDisplayName, "TeamDisplayName": first.TeamDisplayName})
+		}
+		channelPage.Props["ChannelLink"] = first.SiteURL + "/" + first.TeamName + "/channels/" + first.ChannelName
+		channelPage.Props["Button"] = userLocale("api.templates.post_body.button")
+		channelPage.Html["Messages"] = messages
+
+		channels += template.HTML(channelPage.Render())
+	}
+
+	tm := time.Unix(notifications[0].CreateAt/1000, 0)
+	month := userLocale(tm.Month().String())
+
+	subjectPage := utils.NewHTMLTemplate("digest_subject", user.Locale)
+	subjectPage.Props["Subject"] = userLocale("api.templates.digest_subject",
+		map[string]interface{}{"Month": month[:3], "Day": fmt.Sprintf("%d", tm.Day()), "Year": fmt.Sprintf("%d", tm.Year())})
+	subjectPage.Props["SiteName"] = utils.Cfg.TeamSettings.SiteName
+
+	bodyPage := utils.NewHTMLTemplate("digest_body", user.Locale)
+	bodyPage.Props["SiteURL"] = notifications[0].SiteURL
+	bodyPage.Props["BodyText"] = userLocale("api.templates.digest_body.title")
+	bodyPage.Html["Channels"] = channels
+
+	return subjectPage.Render(), bodyPage.Render()
+}
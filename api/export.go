@@ -9,7 +9,7 @@ import (
 	"github.com/mattermost/platform/model"
 	"github.com/mattermost/platform/utils"
 	"io"
-	"os"
+	"strings"
 )
 
 const (
@@ -52,12 +52,24 @@ func ExportOptionsFromJson(data io.Reader) *ExportOptions {
 }
 
 func ExportToFile(options *ExportOptions) (link string, err *model.AppError) {
-	// Open file for export
-	if file, err := openFileWriteStream(EXPORT_PATH + EXPORT_FILENAME); err != nil {
+	backend, err := getFileBackend("ExportToFile")
+	if err != nil {
+		return "", err
+	}
+
+	// stream the zip straight into the file backend as it's written
+	pr, pw := io.Pipe()
+	go func() {
+		if err := ExportToWriter(pw, options); err != nil {
+			pw.CloseWithError(err)
+		} else {
+			pw.Close()
+		}
+	}()
+
+	if err := backend.Write(EXPORT_PATH+EXPORT_FILENAME, pr); err != nil {
+		pr.CloseWithError(err)
 		return "", err
-	} else {
-		defer closeFileWriteStream(file)
-		ExportToWriter(file, options)
 	}
 
 	return "/api/v1/files/get_export", nil
@@ -207,6 +219,21 @@ func ExportPosts(writer ExportWriter, options *ExportOptions, channelId string)
 		posts = result.Data.([]*model.Post)
 	}
 
+	if result := <-Srv.Store.Reaction().GetForExport(channelId); result.Err != nil {
+		return result.Err
+	} else {
+		postMap := make(map[string]*model.Post, len(posts))
+		for _, post := range posts {
+			postMap[post.Id] = post
+		}
+
+		for _, reaction := range result.Data.([]*model.Reaction) {
+			if post, ok := postMap[reaction.PostId]; ok {
+				post.Reactions = append(post.Reactions, reaction)
+			}
+		}
+	}
+
 	// Export the posts
 	if postsFile, err := writer.Create(EXPORT_POSTS_FOLDER + "/" + channelId + "_posts.json"); err != nil {
 		return model.NewLocAppError("ExportPosts", "api.export.open_file.app_error", nil, err.Error())
@@ -247,29 +274,28 @@ func ExportUsers(writer ExportWriter, options *ExportOptions, teamId string) *mo
 	return nil
 }
 
-func copyDirToExportWriter(writer ExportWriter, inPath string, outPath string) *model.AppError {
-	dir, err := os.Open(inPath)
-	if err != nil {
-		return model.NewLocAppError("copyDirToExportWriter", "api.export.open_dir.app_error", nil, err.Error())
-	}
-
-	fileInfoList, err := dir.Readdir(0)
+func copyDirToExportWriter(writer ExportWriter, backend utils.FileBackend, inPath string, outPath string) *model.AppError {
+	names, err := backend.List(inPath)
 	if err != nil {
-		return model.NewLocAppError("copyDirToExportWriter", "api.export.read_dir.app_error", nil, err.Error())
+		return err
 	}
 
-	for _, fileInfo := range fileInfoList {
-		if fileInfo.IsDir() {
-			copyDirToExportWriter(writer, inPath+"/"+fileInfo.Name(), outPath+"/"+fileInfo.Name())
+	for _, name := range names {
+		if strings.HasSuffix(name, "/") {
+			name = strings.TrimSuffix(name, "/")
+			if err := copyDirToExportWriter(writer, backend, inPath+"/"+name, outPath+"/"+name); err != nil {
+				return err
+			}
 		} else {
-			if toFile, err := writer.Create(outPath + "/" + fileInfo.Name()); err != nil {
+			if toFile, err := writer.Create(outPath + "/" + name); err != nil {
 				return model.NewLocAppError("copyDirToExportWriter", "api.export.open_file.app_error", nil, err.Error())
 			} else {
-				fromFile, err := os.Open(inPath + "/" + fileInfo.Name())
+				fromFile, err := backend.Read(inPath + "/" + name)
 				if err != nil {
-					return model.NewLocAppError("copyDirToExportWriter", "api.export.open.app_error", nil, err.Error())
+					return err
 				}
 				io.Copy(toFile, fromFile)
+				fromFile.Close()
 			}
 		}
 	}
@@ -278,15 +304,10 @@ func copyDirToExportWriter(writer ExportWriter, inPath string, outPath string) *
 }
 
 func ExportLocalStorage(writer ExportWriter, options *ExportOptions, teamId string) *model.AppError {
-	teamDir := utils.Cfg.FileSettings.Directory + "teams/" + teamId
-
-	if utils.Cfg.FileSettings.DriverName == model.IMAGE_DRIVER_S3 {
-		return model.NewLocAppError("ExportLocalStorage", "api.export.s3.app_error", nil, "")
-	} else if utils.Cfg.FileSettings.DriverName == model.IMAGE_DRIVER_LOCAL {
-		if err := copyDirToExportWriter(writer, teamDir, EXPORT_LOCAL_STORAGE_FOLDER); err != nil {
-			return err
-		}
+	backend, err := getFileBackend("ExportLocalStorage")
+	if err != nil {
+		return err
 	}
 
-	return nil
+	return copyDirToExportWriter(writer, backend, "teams/"+teamId, EXPORT_LOCAL_STORAGE_FOLDER)
 }
@@ -8,8 +8,6 @@ import (
 	"fmt"
 	l4g "github.com/alecthomas/log4go"
 	"github.com/disintegration/imaging"
-	"github.com/goamz/goamz/aws"
-	"github.com/goamz/goamz/s3"
 	"github.com/gorilla/mux"
 	"github.com/mattermost/platform/model"
 	"github.com/mattermost/platform/utils"
@@ -22,14 +20,12 @@ import (
 	_ "image/gif"
 	"image/jpeg"
 	"io"
-	"io/ioutil"
 	"net/http"
 	"net/url"
-	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
-	"time"
+	"sync"
 )
 
 const (
@@ -57,15 +53,19 @@ const (
 
 var fileInfoCache *utils.Cache = utils.NewLru(1000)
 
-func InitFile(r *mux.Router) {
+func InitFile(routers ...*mux.Router) {
 	l4g.Debug(utils.T("api.file.init.debug"))
 
-	sr := r.PathPrefix("/files").Subrouter()
-	sr.Handle("/upload", ApiUserRequired(uploadFile)).Methods("POST")
-	sr.Handle("/get/{channel_id:[A-Za-z0-9]+}/{user_id:[A-Za-z0-9]+}/{filename:([A-Za-z0-9]+/)?.+(\\.[A-Za-z0-9]{3,})?}", ApiAppHandlerTrustRequester(getFile)).Methods("GET")
-	sr.Handle("/get_info/{channel_id:[A-Za-z0-9]+}/{user_id:[A-Za-z0-9]+}/{filename:([A-Za-z0-9]+/)?.+(\\.[A-Za-z0-9]{3,})?}", ApiAppHandler(getFileInfo)).Methods("GET")
-	sr.Handle("/get_public_link", ApiUserRequired(getPublicLink)).Methods("POST")
-	sr.Handle("/get_export", ApiUserRequired(getExport)).Methods("GET")
+	for _, r := range routers {
+		sr := r.PathPrefix("/files").Subrouter()
+		sr.Handle("/upload", ApiUserRequired(uploadFile)).Methods("POST")
+		sr.Handle("/get/{channel_id:[A-Za-z0-9]+}/{user_id:[A-Za-z0-9]+}/{filename:([A-Za-z0-9]+/)?.+(\\.[A-Za-z0-9]{3,})?}", ApiAppHandlerTrustRequester(getFile)).Methods("GET")
+		sr.Handle("/get_info/{channel_id:[A-Za-z0-9]+}/{user_id:[A-Za-z0-9]+}/{filename:([A-Za-z0-9]+/)?.+(\\.[A-Za-z0-9]{3,})?}", ApiAppHandler(getFileInfo)).Methods("GET")
+		sr.Handle("/channel/{channel_id:[A-Za-z0-9]+}/{offset:[0-9]+}/{limit:[0-9]+}", ApiUserRequired(getFileInfosForChannel)).Methods("GET")
+		sr.Handle("/search", ApiUserRequired(searchFiles)).Methods("GET")
+		sr.Handle("/get_public_link", ApiUserRequired(getPublicLink)).Methods("POST")
+		sr.Handle("/get_export", ApiUserRequired(getExport)).Methods("GET")
+	}
 }
 
 func uploadFile(c *Context, w http.ResponseWriter, r *http.Request) {
@@ -110,8 +110,8 @@ func uploadFile(c *Context, w http.ResponseWriter, r *http.Request) {
 		ClientIds: []string{},
 	}
 
-	imageNameList := []string{}
-	imageDataList := [][]byte{}
+	infos := []*model.FileInfo{}
+	fileDataList := [][]byte{}
 
 	if !c.HasPermissionsToChannel(cchan, "uploadFile") {
 		return
@@ -132,10 +132,13 @@ func uploadFile(c *Context, w http.ResponseWriter, r *http.Request) {
 
 		uid := model.NewId()
 
-		if model.IsFileExtImage(filepath.Ext(files[i].Filename)) {
-			imageNameList = append(imageNameList, uid+"/"+filename)
-			imageDataList = append(imageDataList, buf.Bytes())
+		info, appErr := model.GetInfoForBytes(filename, buf.Bytes())
+		if appErr != nil {
+			c.Err = appErr
+			return
+		}
 
+		if model.IsFileExtImage(filepath.Ext(files[i].Filename)) {
 			// Decode image config first to check dimensions before loading the whole thing into memory later on
 			config, _, err := image.DecodeConfig(bytes.NewReader(buf.Bytes()))
 			if err != nil {
@@ -145,6 +148,9 @@ func uploadFile(c *Context, w http.ResponseWriter, r *http.Request) {
 				c.Err = model.NewLocAppError("uploadFile", "api.file.upload_file.large_image.app_error", nil, c.T("api.file.file_upload.exceeds"))
 				return
 			}
+
+			info.Width = config.Width
+			info.Height = config.Height
 		}
 
 		path := "teams/" + c.Session.TeamId + "/channels/" + channelId + "/users/" + c.Session.UserId + "/" + uid + "/" + filename
@@ -154,6 +160,19 @@ func uploadFile(c *Context, w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		info.Id = uid
+		info.CreatorId = c.Session.UserId
+		info.ChannelId = channelId
+		info.Path = path
+
+		if result := <-Srv.Store.FileInfo().Save(info); result.Err != nil {
+			c.Err = result.Err
+			return
+		}
+
+		infos = append(infos, info)
+		fileDataList = append(fileDataList, buf.Bytes())
+
 		encName := utils.UrlEncode(filename)
 
 		fileUrl := "/" + channelId + "/" + c.Session.UserId + "/" + uid + "/" + encName
@@ -164,108 +183,185 @@ func uploadFile(c *Context, w http.ResponseWriter, r *http.Request) {
 		resStruct.ClientIds = append(resStruct.ClientIds, clientId)
 	}
 
-	handleImagesAndForget(imageNameList, imageDataList, c.Session.TeamId, channelId, c.Session.UserId)
+	handlePreviewsAndForget(infos, fileDataList)
+	extractFileContentsAndForget(infos, fileDataList)
 
 	w.Write([]byte(resStruct.ToJson()))
 }
 
-func handleImagesAndForget(filenames []string, fileData [][]byte, teamId, channelId, userId string) {
+func init() {
+	// gifs are left to the generator in utils which only draws their first frame
+	for _, extension := range model.IMAGE_EXTENSIONS {
+		if extension != ".gif" {
+			utils.RegisterPreviewGenerator(extension, imagePreviewGenerator{})
+		}
+	}
+}
+
+// imagePreviewGenerator decodes an image and turns it the right way up based on
+// its EXIF orientation. Pngs are drawn onto a white background since the
+// thumbnail and preview are saved as jpegs which can't be transparent.
+type imagePreviewGenerator struct{}
+
+func (g imagePreviewGenerator) GeneratePreview(data []byte) (image.Image, *model.AppError) {
+	img, imgType, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, model.NewLocAppError("imagePreviewGenerator.GeneratePreview", "api.file.upload_file.image.app_error", nil, err.Error())
+	}
+
+	// Get the image's orientation and ignore any errors since not all images will have orientation data
+	orientation, _ := getImageOrientation(data)
+
+	if imgType == "png" {
+		dst := image.NewRGBA(img.Bounds())
+		draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+		draw.Draw(dst, dst.Bounds(), img, img.Bounds().Min, draw.Over)
+		img = dst
+	}
+
+	switch orientation {
+	case UprightMirrored:
+		img = imaging.FlipH(img)
+	case UpsideDown:
+		img = imaging.Rotate180(img)
+	case UpsideDownMirrored:
+		img = imaging.FlipV(img)
+	case RotatedCWMirrored:
+		img = imaging.Transpose(img)
+	case RotatedCCW:
+		img = imaging.Rotate270(img)
+	case RotatedCCWMirrored:
+		img = imaging.Transverse(img)
+	case RotatedCW:
+		img = imaging.Rotate90(img)
+	}
+
+	return img, nil
+}
+
+// handlePreviewsAndForget draws each file that has a preview generator for its
+// type and saves a thumbnail and preview of it next to the file itself.
+func handlePreviewsAndForget(infos []*model.FileInfo, fileData [][]byte) {
+	for i, info := range infos {
+		go handlePreviewAndForget(info, fileData[i])
+	}
+}
+
+func handlePreviewAndForget(info *model.FileInfo, data []byte) {
+	generator := utils.GetPreviewGenerator(info.Filename)
+	if generator == nil {
+		return
+	}
+
+	img, err := generator.GeneratePreview(data)
+	if err != nil {
+		l4g.Error(utils.T("api.file.handle_images_forget.decode.error"), info.ChannelId, info.CreatorId, info.Filename, err)
+		return
+	}
+
+	width := img.Bounds().Dx()
+	height := img.Bounds().Dy()
+
+	name := strings.TrimSuffix(info.Path, filepath.Ext(info.Path))
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	thumbnailPath := ""
+	previewPath := ""
+
+	// Create thumbnail
+	go func() {
+		defer wg.Done()
+
+		thumbWidth := float64(utils.Cfg.FileSettings.ThumbnailWidth)
+		thumbHeight := float64(utils.Cfg.FileSettings.ThumbnailHeight)
+		imgWidth := float64(width)
+		imgHeight := float64(height)
+
+		var thumbnail image.Image
+		if imgHeight < thumbHeight && imgWidth < thumbWidth {
+			thumbnail = img
+		} else if imgHeight/imgWidth < thumbHeight/thumbWidth {
+			thumbnail = imaging.Resize(img, 0, utils.Cfg.FileSettings.ThumbnailHeight, imaging.Lanczos)
+		} else {
+			thumbnail = imaging.Resize(img, utils.Cfg.FileSettings.ThumbnailWidth, 0, imaging.Lanczos)
+		}
+
+		buf := new(bytes.Buffer)
+		if err := jpeg.Encode(buf, thumbnail, &jpeg.Options{Quality: 90}); err != nil {
+			l4g.Error(utils.T("api.file.handle_images_forget.encode_jpeg.error"), info.ChannelId, info.CreatorId, info.Filename, err)
+			return
+		}
+
+		if err := WriteFile(buf.Bytes(), name+"_thumb.jpg"); err != nil {
+			l4g.Error(utils.T("api.file.handle_images_forget.upload_thumb.error"), info.ChannelId, info.CreatorId, info.Filename, err)
+			return
+		}
 
+		thumbnailPath = name + "_thumb.jpg"
+	}()
+
+	// Create preview
 	go func() {
-		dest := "teams/" + teamId + "/channels/" + channelId + "/users/" + userId + "/"
-
-		for i, filename := range filenames {
-			name := filename[:strings.LastIndex(filename, ".")]
-			go func() {
-				// Decode image bytes into Image object
-				img, imgType, err := image.Decode(bytes.NewReader(fileData[i]))
-				if err != nil {
-					l4g.Error(utils.T("api.file.handle_images_forget.decode.error"), channelId, userId, filename, err)
-					return
-				}
-
-				width := img.Bounds().Dx()
-				height := img.Bounds().Dy()
-
-				// Get the image's orientation and ignore any errors since not all images will have orientation data
-				orientation, _ := getImageOrientation(fileData[i])
-
-				if imgType == "png" {
-					dst := image.NewRGBA(img.Bounds())
-					draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
-					draw.Draw(dst, dst.Bounds(), img, img.Bounds().Min, draw.Over)
-					img = dst
-				}
-
-				switch orientation {
-				case UprightMirrored:
-					img = imaging.FlipH(img)
-				case UpsideDown:
-					img = imaging.Rotate180(img)
-				case UpsideDownMirrored:
-					img = imaging.FlipV(img)
-				case RotatedCWMirrored:
-					img = imaging.Transpose(img)
-				case RotatedCCW:
-					img = imaging.Rotate270(img)
-				case RotatedCCWMirrored:
-					img = imaging.Transverse(img)
-				case RotatedCW:
-					img = imaging.Rotate90(img)
-				}
-
-				// Create thumbnail
-				go func() {
-					thumbWidth := float64(utils.Cfg.FileSettings.ThumbnailWidth)
-					thumbHeight := float64(utils.Cfg.FileSettings.ThumbnailHeight)
-					imgWidth := float64(width)
-					imgHeight := float64(height)
-
-					var thumbnail image.Image
-					if imgHeight < thumbHeight && imgWidth < thumbWidth {
-						thumbnail = img
-					} else if imgHeight/imgWidth < thumbHeight/thumbWidth {
-						thumbnail = imaging.Resize(img, 0, utils.Cfg.FileSettings.ThumbnailHeight, imaging.Lanczos)
-					} else {
-						thumbnail = imaging.Resize(img, utils.Cfg.FileSettings.ThumbnailWidth, 0, imaging.Lanczos)
-					}
-
-					buf := new(bytes.Buffer)
-					err = jpeg.Encode(buf, thumbnail, &jpeg.Options{Quality: 90})
-					if err != nil {
-						l4g.Error(utils.T("api.file.handle_images_forget.encode_jpeg.error"), channelId, userId, filename, err)
-						return
-					}
-
-					if err := WriteFile(buf.Bytes(), dest+name+"_thumb.jpg"); err != nil {
-						l4g.Error(utils.T("api.file.handle_images_forget.upload_thumb.error"), channelId, userId, filename, err)
-						return
-					}
-				}()
-
-				// Create preview
-				go func() {
-					var preview image.Image
-					if width > int(utils.Cfg.FileSettings.PreviewWidth) {
-						preview = imaging.Resize(img, utils.Cfg.FileSettings.PreviewWidth, utils.Cfg.FileSettings.PreviewHeight, imaging.Lanczos)
-					} else {
-						preview = img
-					}
-
-					buf := new(bytes.Buffer)
-
-					err = jpeg.Encode(buf, preview, &jpeg.Options{Quality: 90})
-					if err != nil {
-						l4g.Error(utils.T("api.file.handle_images_forget.encode_preview.error"), channelId, userId, filename, err)
-						return
-					}
-
-					if err := WriteFile(buf.Bytes(), dest+name+"_preview.jpg"); err != nil {
-						l4g.Error(utils.T("api.file.handle_images_forget.upload_preview.error"), channelId, userId, filename, err)
-						return
-					}
-				}()
-			}()
+		defer wg.Done()
+
+		var preview image.Image
+		if width > int(utils.Cfg.FileSettings.PreviewWidth) {
+			preview = imaging.Resize(img, utils.Cfg.FileSettings.PreviewWidth, utils.Cfg.FileSettings.PreviewHeight, imaging.Lanczos)
+		} else {
+			preview = img
+		}
+
+		buf := new(bytes.Buffer)
+		if err := jpeg.Encode(buf, preview, &jpeg.Options{Quality: 90}); err != nil {
+			l4g.Error(utils.T("api.file.handle_images_forget.encode_preview.error"), info.ChannelId, info.CreatorId, info.Filename, err)
+			return
+		}
+
+		if err := WriteFile(buf.Bytes(), name+"_preview.jpg"); err != nil {
+			l4g.Error(utils.T("api.file.handle_images_forget.upload_preview.error"), info.ChannelId, info.CreatorId, info.Filename, err)
+			return
+		}
+
+		previewPath = name + "_preview.jpg"
+	}()
+
+	wg.Wait()
+
+	// images keep the size they're shown at once they've been turned the right
+	// way up, but the picture drawn of any other file isn't the file's own size
+	hasPreviewImage := previewPath != ""
+	if model.IsFileExtImage(filepath.Ext(info.Filename)) {
+		hasPreviewImage = hasPreviewImage && info.HasPreviewImage
+	} else {
+		width = 0
+		height = 0
+	}
+
+	if result := <-Srv.Store.FileInfo().SetPreviewInfo(info.Id, width, height, thumbnailPath, previewPath, hasPreviewImage); result.Err != nil {
+		l4g.Error(utils.T("api.file.handle_images_forget.save_info.error"), info.Id, result.Err)
+	}
+}
+
+// extractFileContentsAndForget reads the text out of each file that it can so
+// that the posts the files are attached to can be found by what's in them.
+func extractFileContentsAndForget(infos []*model.FileInfo, fileData [][]byte) {
+	go func() {
+		for i, info := range infos {
+			if !utils.CanExtractText(info.Filename) {
+				continue
+			}
+
+			text, err := utils.ExtractText(info.Filename, fileData[i])
+			if err != nil {
+				l4g.Error(utils.T("api.file.extract_contents_forget.extract.error"), info.Id, err)
+				continue
+			}
+
+			if result := <-Srv.Store.FileContent().Save(&model.FileContent{FileId: info.Id, Content: text}); result.Err != nil {
+				l4g.Error(utils.T("api.file.extract_contents_forget.save.error"), info.Id, result.Err)
+			}
 		}
 	}()
 }
@@ -324,7 +420,10 @@ func getFileInfo(c *Context, w http.ResponseWriter, r *http.Request) {
 	path := "teams/" + c.Session.TeamId + "/channels/" + channelId + "/users/" + userId + "/" + filename
 	var info *model.FileInfo
 
-	if cached, ok := fileInfoCache.Get(path); ok {
+	// files uploaded before FileInfos were saved have to be read to get their info
+	if result := <-Srv.Store.FileInfo().Get(strings.Split(filename, "/")[0]); result.Err == nil && result.Data.(*model.FileInfo).Path == path {
+		info = result.Data.(*model.FileInfo)
+	} else if cached, ok := fileInfoCache.Get(path); ok {
 		info = cached.(*model.FileInfo)
 	} else {
 		fileData := make(chan []byte)
@@ -349,6 +448,82 @@ func getFileInfo(c *Context, w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(info.ToJson()))
 }
 
+func getFileInfosForChannel(c *Context, w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+
+	channelId := params["channel_id"]
+	if len(channelId) != 26 {
+		c.SetInvalidParam("getFileInfosForChannel", "channel_id")
+		return
+	}
+
+	offset, err := strconv.Atoi(params["offset"])
+	if err != nil {
+		c.SetInvalidParam("getFileInfosForChannel", "offset")
+		return
+	}
+
+	limit, err := strconv.Atoi(params["limit"])
+	if err != nil || limit <= 0 {
+		c.SetInvalidParam("getFileInfosForChannel", "limit")
+		return
+	} else if limit > SEARCH_MAX_LIMIT {
+		limit = SEARCH_MAX_LIMIT
+	}
+
+	cchan := Srv.Store.Channel().CheckPermissionsTo(c.Session.TeamId, channelId, c.Session.UserId)
+	fchan := Srv.Store.FileInfo().GetForChannel(channelId, offset, limit)
+
+	if !c.HasPermissionsToChannel(cchan, "getFileInfosForChannel") {
+		return
+	}
+
+	if result := <-fchan; result.Err != nil {
+		c.Err = result.Err
+		return
+	} else {
+		w.Write([]byte(model.FileInfosToJson(result.Data.([]*model.FileInfo))))
+	}
+}
+
+func searchFiles(c *Context, w http.ResponseWriter, r *http.Request) {
+	terms := r.FormValue("terms")
+
+	if len(terms) == 0 {
+		c.SetInvalidParam("searchFiles", "terms")
+		return
+	}
+
+	offset := 0
+	if value := r.FormValue("offset"); len(value) > 0 {
+		if val, err := strconv.Atoi(value); err != nil || val < 0 {
+			c.SetInvalidParam("searchFiles", "offset")
+			return
+		} else {
+			offset = val
+		}
+	}
+
+	limit := SEARCH_DEFAULT_LIMIT
+	if value := r.FormValue("limit"); len(value) > 0 {
+		if val, err := strconv.Atoi(value); err != nil || val <= 0 {
+			c.SetInvalidParam("searchFiles", "limit")
+			return
+		} else if val > SEARCH_MAX_LIMIT {
+			limit = SEARCH_MAX_LIMIT
+		} else {
+			limit = val
+		}
+	}
+
+	if result := <-Srv.Store.FileInfo().Search(c.Session.TeamId, c.Session.UserId, terms, offset, limit); result.Err != nil {
+		c.Err = result.Err
+		return
+	} else {
+		w.Write([]byte(model.FileInfosToJson(result.Data.([]*model.FileInfo))))
+	}
+}
+
 func getFile(c *Context, w http.ResponseWriter, r *http.Request) {
 	if len(utils.Cfg.FileSettings.DriverName) == 0 {
 		c.Err = model.NewLocAppError("uploadFile", "api.file.upload_file.storage.app_error", nil, "")
@@ -501,7 +676,7 @@ func getPublicLink(c *Context, w http.ResponseWriter, r *http.Request) {
 }
 
 func getExport(c *Context, w http.ResponseWriter, r *http.Request) {
-	if !c.HasPermissionsToTeam(c.Session.TeamId, "export") || !c.IsTeamAdmin() {
+	if !c.HasPermissionsToTeam(c.Session.TeamId, "export") || !c.HasPermission(model.PERMISSION_MANAGE_TEAM, c.Session.TeamId) {
 		c.Err = model.NewLocAppError("getExport", "api.file.get_export.team_admin.app_error", nil, "userId="+c.Session.UserId)
 		c.Err.StatusCode = http.StatusForbidden
 		return
@@ -517,158 +692,65 @@ func getExport(c *Context, w http.ResponseWriter, r *http.Request) {
 	w.Write(data)
 }
 
-func WriteFile(f []byte, path string) *model.AppError {
-
-	if utils.Cfg.FileSettings.DriverName == model.IMAGE_DRIVER_S3 {
-		var auth aws.Auth
-		auth.AccessKey = utils.Cfg.FileSettings.AmazonS3AccessKeyId
-		auth.SecretKey = utils.Cfg.FileSettings.AmazonS3SecretAccessKey
-
-		s := s3.New(auth, awsRegion())
-		bucket := s.Bucket(utils.Cfg.FileSettings.AmazonS3Bucket)
-
-		ext := filepath.Ext(path)
+// fileBackend stores uploaded files using the driver from FileSettings. It's
+// nil when no driver is configured. It's replaced when the config is saved
+// while requests are using it, so it's only read through getFileBackend.
+var fileBackend utils.FileBackend
+var fileBackendLock sync.RWMutex
 
-		var err error
-		if model.IsFileExtImage(ext) {
-			options := s3.Options{}
-			err = bucket.Put(path, f, model.GetImageMimeType(ext), s3.Private, options)
+// InitFileBackend sets up the configured file backend. It's run on start up and
+// whenever the config is saved.
+func InitFileBackend() {
+	var backend utils.FileBackend
 
+	if len(utils.Cfg.FileSettings.DriverName) > 0 {
+		if newBackend, err := utils.NewFileBackend(&utils.Cfg.FileSettings); err != nil {
+			l4g.Error(utils.T("api.file.init_file_backend.error"), err.Error())
 		} else {
-			options := s3.Options{}
-			err = bucket.Put(path, f, "binary/octet-stream", s3.Private, options)
+			backend = newBackend
 		}
-
-		if err != nil {
-			return model.NewLocAppError("WriteFile", "api.file.write_file.s3.app_error", nil, err.Error())
-		}
-	} else if utils.Cfg.FileSettings.DriverName == model.IMAGE_DRIVER_LOCAL {
-		if err := WriteFileLocally(f, utils.Cfg.FileSettings.Directory+path); err != nil {
-			return err
-		}
-	} else {
-		return model.NewLocAppError("WriteFile", "api.file.write_file.configured.app_error", nil, "")
 	}
 
-	return nil
-}
-
-func moveFile(oldPath, newPath string) *model.AppError {
-	if utils.Cfg.FileSettings.DriverName == model.IMAGE_DRIVER_S3 {
-		fileData := make(chan []byte)
-		getFileAndForget(oldPath, fileData)
-		fileBytes := <-fileData
-
-		if fileBytes == nil {
-			return model.NewLocAppError("moveFile", "api.file.move_file.get_from_s3.app_error", nil, "")
-		}
+	fileBackendLock.Lock()
+	defer fileBackendLock.Unlock()
 
-		var auth aws.Auth
-		auth.AccessKey = utils.Cfg.FileSettings.AmazonS3AccessKeyId
-		auth.SecretKey = utils.Cfg.FileSettings.AmazonS3SecretAccessKey
-
-		s := s3.New(auth, awsRegion())
-		bucket := s.Bucket(utils.Cfg.FileSettings.AmazonS3Bucket)
-
-		if err := bucket.Del(oldPath); err != nil {
-			return model.NewLocAppError("moveFile", "api.file.move_file.delete_from_s3.app_error", nil, err.Error())
-		}
-
-		if err := WriteFile(fileBytes, newPath); err != nil {
-			return err
-		}
-	} else if utils.Cfg.FileSettings.DriverName == model.IMAGE_DRIVER_LOCAL {
-		if err := os.Rename(utils.Cfg.FileSettings.Directory+oldPath, utils.Cfg.FileSettings.Directory+newPath); err != nil {
-			return model.NewLocAppError("moveFile", "api.file.move_file.rename.app_error", nil, err.Error())
-		}
-	} else {
-		return model.NewLocAppError("moveFile", "api.file.move_file.configured.app_error", nil, "")
-	}
-
-	return nil
+	fileBackend = backend
 }
 
-func WriteFileLocally(f []byte, path string) *model.AppError {
-	if err := os.MkdirAll(filepath.Dir(path), 0774); err != nil {
-		return model.NewLocAppError("WriteFile", "api.file.write_file_locally.create_dir.app_error", nil, err.Error())
-	}
+func getFileBackend(where string) (utils.FileBackend, *model.AppError) {
+	fileBackendLock.RLock()
+	defer fileBackendLock.RUnlock()
 
-	if err := ioutil.WriteFile(path, f, 0644); err != nil {
-		return model.NewLocAppError("WriteFile", "api.file.write_file_locally.writing.app_error", nil, err.Error())
+	if fileBackend == nil {
+		return nil, model.NewLocAppError(where, "api.file.file_backend.configured.app_error", nil, "")
 	}
 
-	return nil
+	return fileBackend, nil
 }
 
-func ReadFile(path string) ([]byte, *model.AppError) {
-
-	if utils.Cfg.FileSettings.DriverName == model.IMAGE_DRIVER_S3 {
-		var auth aws.Auth
-		auth.AccessKey = utils.Cfg.FileSettings.AmazonS3AccessKeyId
-		auth.SecretKey = utils.Cfg.FileSettings.AmazonS3SecretAccessKey
-
-		s := s3.New(auth, awsRegion())
-		bucket := s.Bucket(utils.Cfg.FileSettings.AmazonS3Bucket)
-
-		// try to get the file from S3 with some basic retry logic
-		tries := 0
-		for {
-			tries++
-
-			f, err := bucket.Get(path)
-
-			if f != nil {
-				return f, nil
-			} else if tries >= 3 {
-				return nil, model.NewLocAppError("ReadFile", "api.file.read_file.get.app_error", nil, "path="+path+", err="+err.Error())
-			}
-			time.Sleep(3000 * time.Millisecond)
-		}
-	} else if utils.Cfg.FileSettings.DriverName == model.IMAGE_DRIVER_LOCAL {
-		if f, err := ioutil.ReadFile(utils.Cfg.FileSettings.Directory + path); err != nil {
-			return nil, model.NewLocAppError("ReadFile", "api.file.read_file.reading_local.app_error", nil, err.Error())
-		} else {
-			return f, nil
-		}
-	} else {
-		return nil, model.NewLocAppError("ReadFile", "api.file.read_file.configured.app_error", nil, "")
+func WriteFile(f []byte, path string) *model.AppError {
+	backend, err := getFileBackend("WriteFile")
+	if err != nil {
+		return err
 	}
-}
-
-func openFileWriteStream(path string) (io.Writer, *model.AppError) {
-	if utils.Cfg.FileSettings.DriverName == model.IMAGE_DRIVER_S3 {
-		return nil, model.NewLocAppError("openFileWriteStream", "api.file.open_file_write_stream.s3.app_error", nil, "")
-	} else if utils.Cfg.FileSettings.DriverName == model.IMAGE_DRIVER_LOCAL {
-		if err := os.MkdirAll(filepath.Dir(utils.Cfg.FileSettings.Directory+path), 0774); err != nil {
-			return nil, model.NewLocAppError("openFileWriteStream", "api.file.open_file_write_stream.creating_dir.app_error", nil, err.Error())
-		}
 
-		if fileHandle, err := os.Create(utils.Cfg.FileSettings.Directory + path); err != nil {
-			return nil, model.NewLocAppError("openFileWriteStream", "api.file.open_file_write_stream.local_server.app_error", nil, err.Error())
-		} else {
-			fileHandle.Chmod(0644)
-			return fileHandle, nil
-		}
+	return backend.Write(path, bytes.NewReader(f))
+}
 
+func moveFile(oldPath, newPath string) *model.AppError {
+	backend, err := getFileBackend("moveFile")
+	if err != nil {
+		return err
 	}
 
-	return nil, model.NewLocAppError("openFileWriteStream", "api.file.open_file_write_stream.configured.app_error", nil, "")
+	return backend.Move(oldPath, newPath)
 }
 
-func closeFileWriteStream(file io.Writer) {
-	file.(*os.File).Close()
-}
-
-func awsRegion() aws.Region {
-	if region, ok := aws.Regions[utils.Cfg.FileSettings.AmazonS3Region]; ok {
-		return region
+func ReadFile(path string) ([]byte, *model.AppError) {
+	backend, err := getFileBackend("ReadFile")
+	if err != nil {
+		return nil, err
 	}
 
-	return aws.Region{
-		Name:                 utils.Cfg.FileSettings.AmazonS3Region,
-		S3Endpoint:           utils.Cfg.FileSettings.AmazonS3Endpoint,
-		S3BucketEndpoint:     utils.Cfg.FileSettings.AmazonS3BucketEndpoint,
-		S3LocationConstraint: *utils.Cfg.FileSettings.AmazonS3LocationConstraint,
-		S3LowercaseBucket:    *utils.Cfg.FileSettings.AmazonS3LowercaseBucket,
-	}
+	return utils.ReadFile(backend, path)
 }
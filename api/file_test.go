@@ -468,3 +468,210 @@ func TestGetPublicLink(t *testing.T) {
 		}
 	}
 }
+
+func TestFileInfos(t *testing.T) {
+	Setup()
+
+	team := &model.Team{DisplayName: "Name", Name: "z-z-" + model.NewId() + "a", Email: "test@nowhere.com", Type: model.TEAM_OPEN}
+	team = Client.Must(Client.CreateTeam(team)).Data.(*model.Team)
+
+	user1 := &model.User{TeamId: team.Id, Email: model.NewId() + "success+test@simulator.amazonses.com", Nickname: "Corey Hulen", Password: "pwd"}
+	user1 = Client.Must(Client.CreateUser(user1, "")).Data.(*model.User)
+	store.Must(Srv.Store.User().VerifyEmail(user1.Id))
+
+	Client.LoginByEmail(team.Name, user1.Email, "pwd")
+
+	channel1 := &model.Channel{DisplayName: "Test API Name", Name: "a" + model.NewId() + "a", Type: model.CHANNEL_OPEN, TeamId: team.Id}
+	channel1 = Client.Must(Client.CreateChannel(channel1)).Data.(*model.Channel)
+
+	if utils.Cfg.FileSettings.DriverName != "" {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, err := writer.CreateFormFile("files", "test.png")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		file, err := os.Open(utils.FindDir("tests") + "/test.png")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+
+		if _, err := io.Copy(part, file); err != nil {
+			t.Fatal(err)
+		}
+
+		writer.WriteField("channel_id", channel1.Id)
+		writer.Close()
+
+		filenames := Client.Must(Client.UploadFile("/files/upload", body.Bytes(), writer.FormDataContentType())).Data.(*model.FileUploadResponse).Filenames
+
+		if infos := Client.Must(Client.GetFileInfosForChannel(channel1.Id, 0, 10)).Data.([]*model.FileInfo); len(infos) != 0 {
+			t.Fatal("shouldn't list files that haven't been posted")
+		}
+
+		if infos := Client.Must(Client.SearchFiles("test")).Data.([]*model.FileInfo); len(infos) != 1 {
+			t.Fatal("should have found the user's own upload")
+		}
+
+		post1 := &model.Post{ChannelId: channel1.Id, Message: "a file", Filenames: filenames}
+		post1 = Client.Must(Client.CreatePost(post1)).Data.(*model.Post)
+
+		// wait a bit for the thumbnail and preview to be made
+		time.Sleep(5 * time.Second)
+
+		if infos := Client.Must(Client.GetFileInfosForChannel(channel1.Id, 0, 10)).Data.([]*model.FileInfo); len(infos) != 1 {
+			t.Fatal("should have listed the posted file")
+		} else if info := infos[0]; info.PostId != post1.Id || info.CreatorId != user1.Id || info.Filename != "test.png" || info.Width == 0 || info.Height == 0 {
+			t.Fatal("got incorrect info", info.ToJson())
+		}
+
+		if resp, err := Client.GetFileInfo(filenames[0]); err != nil {
+			t.Fatal(err)
+		} else if info := resp.Data.(*model.FileInfo); info.PostId != post1.Id {
+			t.Fatal("should have gotten the saved info")
+		}
+
+		Client.Must(Client.DeletePost(channel1.Id, post1.Id))
+		time.Sleep(time.Second)
+
+		if infos := Client.Must(Client.GetFileInfosForChannel(channel1.Id, 0, 10)).Data.([]*model.FileInfo); len(infos) != 0 {
+			t.Fatal("shouldn't list the files of deleted posts")
+		}
+	} else {
+		if _, err := Client.GetFileInfosForChannel(channel1.Id, 0, 10); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	channel2 := &model.Channel{DisplayName: "Test API Name", Name: "a" + model.NewId() + "a", Type: model.CHANNEL_PRIVATE, TeamId: team.Id}
+	channel2 = Client.Must(Client.CreateChannel(channel2)).Data.(*model.Channel)
+
+	user2 := &model.User{TeamId: team.Id, Email: model.NewId() + "success+test@simulator.amazonses.com", Nickname: "Corey Hulen", Password: "pwd"}
+	user2 = Client.Must(Client.CreateUser(user2, "")).Data.(*model.User)
+	store.Must(Srv.Store.User().VerifyEmail(user2.Id))
+
+	Client.LoginByEmail(team.Name, user2.Email, "pwd")
+
+	if _, err := Client.GetFileInfosForChannel(channel2.Id, 0, 10); err == nil {
+		t.Fatal("should have failed, not a member of the channel")
+	}
+}
+
+func TestFilePreviews(t *testing.T) {
+	Setup()
+
+	if _, ok := utils.GetPreviewGenerator("photo.JPG").(imagePreviewGenerator); !ok {
+		t.Fatal("should have registered the image generator")
+	}
+
+	team := &model.Team{DisplayName: "Name", Name: "z-z-" + model.NewId() + "a", Email: "test@nowhere.com", Type: model.TEAM_OPEN}
+	team = Client.Must(Client.CreateTeam(team)).Data.(*model.Team)
+
+	user1 := &model.User{TeamId: team.Id, Email: model.NewId() + "success+test@simulator.amazonses.com", Nickname: "Corey Hulen", Password: "pwd"}
+	user1 = Client.Must(Client.CreateUser(user1, "")).Data.(*model.User)
+	store.Must(Srv.Store.User().VerifyEmail(user1.Id))
+
+	Client.LoginByEmail(team.Name, user1.Email, "pwd")
+
+	channel1 := &model.Channel{DisplayName: "Test API Name", Name: "a" + model.NewId() + "a", Type: model.CHANNEL_OPEN, TeamId: team.Id}
+	channel1 = Client.Must(Client.CreateChannel(channel1)).Data.(*model.Channel)
+
+	if utils.Cfg.FileSettings.DriverName != "" {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, err := writer.CreateFormFile("files", "notes.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		part.Write([]byte("some notes\nabout the test\n"))
+
+		writer.WriteField("channel_id", channel1.Id)
+		writer.Close()
+
+		filenames := Client.Must(Client.UploadFile("/files/upload", body.Bytes(), writer.FormDataContentType())).Data.(*model.FileUploadResponse).Filenames
+		fileId := strings.Split(filenames[0], "/")[3]
+
+		// wait a bit for the thumbnail and preview to be made
+		time.Sleep(5 * time.Second)
+
+		info := store.Must(Srv.Store.FileInfo().Get(fileId)).(*model.FileInfo)
+		if !info.HasPreviewImage || info.Width != 0 || info.Height != 0 {
+			t.Fatal("should have flagged the preview of the text file", info.ToJson())
+		}
+
+		path := "teams/" + team.Id + "/channels/" + channel1.Id + "/users/" + user1.Id + "/" + fileId + "/notes"
+		if info.ThumbnailPath != path+"_thumb.jpg" || info.PreviewPath != path+"_preview.jpg" {
+			t.Fatal("should have saved the thumbnail and preview next to the file", info.ThumbnailPath, info.PreviewPath)
+		}
+
+		for _, p := range []string{info.Path, info.ThumbnailPath, info.PreviewPath} {
+			if _, err := ReadFile(p); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if utils.Cfg.FileSettings.DriverName == model.IMAGE_DRIVER_LOCAL {
+			os.RemoveAll(utils.Cfg.FileSettings.Directory + "teams/" + team.Id + "/channels/" + channel1.Id + "/users/" + user1.Id + "/" + fileId)
+		}
+	}
+}
+
+func TestSearchFileContents(t *testing.T) {
+	Setup()
+
+	team := &model.Team{DisplayName: "Name", Name: "z-z-" + model.NewId() + "a", Email: "test@nowhere.com", Type: model.TEAM_OPEN}
+	team = Client.Must(Client.CreateTeam(team)).Data.(*model.Team)
+
+	user1 := &model.User{TeamId: team.Id, Email: model.NewId() + "success+test@simulator.amazonses.com", Nickname: "Corey Hulen", Password: "pwd"}
+	user1 = Client.Must(Client.CreateUser(user1, "")).Data.(*model.User)
+	store.Must(Srv.Store.User().VerifyEmail(user1.Id))
+
+	Client.LoginByEmail(team.Name, user1.Email, "pwd")
+
+	channel1 := &model.Channel{DisplayName: "Test API Name", Name: "a" + model.NewId() + "a", Type: model.CHANNEL_OPEN, TeamId: team.Id}
+	channel1 = Client.Must(Client.CreateChannel(channel1)).Data.(*model.Channel)
+
+	if utils.Cfg.FileSettings.DriverName != "" {
+		body := &bytes.Buffer{}
+		writer := multipart.NewWriter(body)
+		part, err := writer.CreateFormFile("files", "minutes.md")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		part.Write([]byte("# Minutes\n\nThe zeppelin budget was approved.\n"))
+
+		writer.WriteField("channel_id", channel1.Id)
+		writer.Close()
+
+		filenames := Client.Must(Client.UploadFile("/files/upload", body.Bytes(), writer.FormDataContentType())).Data.(*model.FileUploadResponse).Filenames
+
+		post1 := &model.Post{ChannelId: channel1.Id, Message: "the minutes", Filenames: filenames}
+		post1 = Client.Must(Client.CreatePost(post1)).Data.(*model.Post)
+
+		post2 := &model.Post{ChannelId: channel1.Id, Message: "the zeppelin"}
+		post2 = Client.Must(Client.CreatePost(post2)).Data.(*model.Post)
+
+		// wait a bit for the text to be read out of the file
+		time.Sleep(5 * time.Second)
+
+		if list := Client.Must(Client.SearchPosts("file:zeppelin")).Data.(*model.PostList); len(list.Order) != 1 || list.Order[0] != post1.Id {
+			t.Fatal("should have found the post by what's in its attachment", list.Order)
+		}
+
+		if list := Client.Must(Client.SearchPosts("minutes ext:md")).Data.(*model.PostList); len(list.Order) != 1 || list.Order[0] != post1.Id {
+			t.Fatal("should have found the post by the type of its attachment", list.Order)
+		}
+
+		if list := Client.Must(Client.SearchPosts("zeppelin")).Data.(*model.PostList); len(list.Order) != 1 || list.Order[0] != post2.Id {
+			t.Fatal("shouldn't have searched attachments without the flag", list.Order)
+		}
+
+		if utils.Cfg.FileSettings.DriverName == model.IMAGE_DRIVER_LOCAL {
+			os.RemoveAll(utils.Cfg.FileSettings.Directory + "teams/" + team.Id)
+		}
+	}
+}
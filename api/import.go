@@ -19,6 +19,8 @@ func ImportPost(post *model.Post) {
 
 	if result := <-Srv.Store.Post().Save(post); result.Err != nil {
 		l4g.Debug(utils.T("api.import.import_post.saving.debug"), post.UserId, post.Message)
+	} else {
+		searchEngine.IndexPost(result.Data.(*model.Post))
 	}
 }
 
@@ -31,7 +33,11 @@ func ImportUser(user *model.User) *model.User {
 	} else {
 		ruser := result.Data.(*model.User)
 
-		if err := JoinDefaultChannels(ruser, ""); err != nil {
+		if err := JoinUserToTeam(ruser.TeamId, ruser, ""); err != nil {
+			l4g.Error(utils.T("api.import.import_user.join_team.error"), ruser.Id, ruser.TeamId, err)
+		}
+
+		if err := JoinDefaultChannels(ruser.TeamId, ruser, ""); err != nil {
 			l4g.Error(utils.T("api.import.import_user.joining_default.error"), ruser.Id, ruser.TeamId, err)
 		}
 
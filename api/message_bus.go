@@ -0,0 +1,539 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package api
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	l4g "github.com/alecthomas/log4go"
+	"github.com/mattermost/platform/model"
+	"github.com/mattermost/platform/utils"
+)
+
+const (
+	CLUSTER_DIAL_TIMEOUT         = 5 * time.Second
+	CLUSTER_WRITE_WAIT           = 10 * time.Second
+	CLUSTER_RECONNECT_WAIT       = 2 * time.Second
+	CLUSTER_HANDSHAKE_WAIT       = 10 * time.Second
+	CLUSTER_NONCE_SIZE           = 32
+	CLUSTER_PEER_QUEUE_SIZE      = 1024
+	CLUSTER_EVENT_MESSAGE        = "message"
+	CLUSTER_EVENT_CHANNEL_ACCESS = "channel_access"
+	CLUSTER_EVENT_USER_SESSIONS  = "user_sessions"
+	CLUSTER_EVENT_ACCESS_TOKEN   = "access_token"
+	CLUSTER_EVENT_ROLES          = "roles"
+)
+
+// MessageBus carries websocket events from the node that produced them to
+// every node that may be holding a connection interested in them.
+type MessageBus interface {
+	Start() *model.AppError
+	Stop()
+	Publish(message *model.Message)
+	UpdateChannelAccessCache(teamId, userId, channelId string)
+	RemoveAllSessionsForUserIdFromCache(userId string)
+	RemoveUserAccessTokenFromCache(tokenId string)
+	InvalidateRoleCache(teamId string)
+}
+
+var messageBus MessageBus = NewLocalMessageBus()
+
+func GetMessageBus() MessageBus {
+	return messageBus
+}
+
+func SetMessageBus(bus MessageBus) {
+	messageBus = bus
+}
+
+func NewMessageBusFromConfig() MessageBus {
+	local := NewLocalMessageBus()
+
+	if !*utils.Cfg.ClusterSettings.Enable {
+		return local
+	}
+
+	return NewClusterMessageBus(*utils.Cfg.ClusterSettings.InterNodeListenAddress, utils.Cfg.ClusterSettings.InterNodeAddresses, *utils.Cfg.ClusterSettings.InterNodeSecret, local)
+}
+
+// LocalMessageBus delivers events only to the connections held by this process.
+type LocalMessageBus struct{}
+
+func NewLocalMessageBus() *LocalMessageBus {
+	return &LocalMessageBus{}
+}
+
+func (b *LocalMessageBus) Start() *model.AppError {
+	return nil
+}
+
+func (b *LocalMessageBus) Stop() {
+}
+
+func (b *LocalMessageBus) Publish(message *model.Message) {
+	hub.Broadcast(message)
+}
+
+func (b *LocalMessageBus) UpdateChannelAccessCache(teamId, userId, channelId string) {
+	UpdateChannelAccessCache(teamId, userId, channelId)
+}
+
+func (b *LocalMessageBus) RemoveAllSessionsForUserIdFromCache(userId string) {
+	removeAllSessionsForUserIdFromLocalCache(userId)
+}
+
+func (b *LocalMessageBus) RemoveUserAccessTokenFromCache(tokenId string) {
+	removeUserAccessTokensFromLocalCache(func(session *model.Session) bool {
+		return session.Props[model.SESSION_PROP_USER_ACCESS_TOKEN_ID] == tokenId
+	})
+}
+
+func (b *LocalMessageBus) InvalidateRoleCache(teamId string) {
+	invalidateLocalRoleCache(teamId)
+}
+
+type clusterEvent struct {
+	NodeId    string         `json:"node_id"`
+	Event     string         `json:"event"`
+	Message   *model.Message `json:"message,omitempty"`
+	TeamId    string         `json:"team_id,omitempty"`
+	UserId    string         `json:"user_id,omitempty"`
+	ChannelId string         `json:"channel_id,omitempty"`
+	TokenId   string         `json:"token_id,omitempty"`
+}
+
+type clusterPeer struct {
+	address string
+	send    chan *clusterEvent
+	stop    chan bool
+}
+
+// ClusterMessageBus delivers events locally and relays them over TCP to the
+// other app servers listed in ClusterSettings. Events received from a peer are
+// only delivered locally so they are never relayed a second time.
+//
+// Every connection starts with a handshake where both nodes send a random nonce
+// and each proves it knows the shared secret by answering with an HMAC over
+// both of them. Events are only sent and read once that succeeds, and each one
+// carries an HMAC keyed for that connection so it can't be forged or replayed.
+type ClusterMessageBus struct {
+	NodeId        string
+	listenAddress string
+	secret        []byte
+	local         MessageBus
+	peers         []*clusterPeer
+	listener      net.Listener
+	conns         map[net.Conn]bool
+	connsLock     sync.Mutex
+	stopOnce      sync.Once
+}
+
+func NewClusterMessageBus(listenAddress string, peerAddresses []string, secret string, local MessageBus) *ClusterMessageBus {
+	b := &ClusterMessageBus{
+		NodeId:        model.NewId(),
+		listenAddress: listenAddress,
+		secret:        []byte(secret),
+		local:         local,
+		peers:         make([]*clusterPeer, 0, len(peerAddresses)),
+		conns:         make(map[net.Conn]bool),
+	}
+
+	for _, address := range peerAddresses {
+		b.peers = append(b.peers, &clusterPeer{
+			address: address,
+			send:    make(chan *clusterEvent, CLUSTER_PEER_QUEUE_SIZE),
+			stop:    make(chan bool),
+		})
+	}
+
+	return b
+}
+
+func (b *ClusterMessageBus) Start() *model.AppError {
+	l4g.Info(utils.T("api.message_bus.start.info"), b.listenAddress, len(b.peers))
+
+	listener, err := net.Listen("tcp", b.listenAddress)
+	if err != nil {
+		return model.NewLocAppError("ClusterMessageBus.Start", "api.message_bus.start.listen.app_error", nil, err.Error())
+	}
+
+	b.listener = listener
+
+	go b.acceptPump()
+
+	for _, peer := range b.peers {
+		go b.peerPump(peer)
+	}
+
+	return nil
+}
+
+func (b *ClusterMessageBus) Stop() {
+	b.stopOnce.Do(func() {
+		if b.listener != nil {
+			b.listener.Close()
+		}
+
+		b.connsLock.Lock()
+		for conn := range b.conns {
+			conn.Close()
+		}
+		b.connsLock.Unlock()
+
+		for _, peer := range b.peers {
+			close(peer.stop)
+		}
+	})
+}
+
+// ListenAddr returns the address the bus is accepting peer connections on.
+func (b *ClusterMessageBus) ListenAddr() string {
+	if b.listener == nil {
+		return b.listenAddress
+	}
+
+	return b.listener.Addr().String()
+}
+
+func (b *ClusterMessageBus) Publish(message *model.Message) {
+	b.local.Publish(message)
+	b.relay(&clusterEvent{NodeId: b.NodeId, Event: CLUSTER_EVENT_MESSAGE, Message: message})
+}
+
+func (b *ClusterMessageBus) UpdateChannelAccessCache(teamId, userId, channelId string) {
+	b.local.UpdateChannelAccessCache(teamId, userId, channelId)
+	b.relay(&clusterEvent{NodeId: b.NodeId, Event: CLUSTER_EVENT_CHANNEL_ACCESS, TeamId: teamId, UserId: userId, ChannelId: channelId})
+}
+
+func (b *ClusterMessageBus) RemoveAllSessionsForUserIdFromCache(userId string) {
+	b.local.RemoveAllSessionsForUserIdFromCache(userId)
+	b.relay(&clusterEvent{NodeId: b.NodeId, Event: CLUSTER_EVENT_USER_SESSIONS, UserId: userId})
+}
+
+func (b *ClusterMessageBus) RemoveUserAccessTokenFromCache(tokenId string) {
+	b.local.RemoveUserAccessTokenFromCache(tokenId)
+	b.relay(&clusterEvent{NodeId: b.NodeId, Event: CLUSTER_EVENT_ACCESS_TOKEN, TokenId: tokenId})
+}
+
+func (b *ClusterMessageBus) InvalidateRoleCache(teamId string) {
+	b.local.InvalidateRoleCache(teamId)
+	b.relay(&clusterEvent{NodeId: b.NodeId, Event: CLUSTER_EVENT_ROLES, TeamId: teamId})
+}
+
+func (b *ClusterMessageBus) relay(event *clusterEvent) {
+	for _, peer := range b.peers {
+		select {
+		case peer.send <- event:
+		default:
+			l4g.Warn(utils.T("api.message_bus.relay.queue_full.warn"), peer.address)
+		}
+	}
+}
+
+func (b *ClusterMessageBus) deliver(event *clusterEvent) {
+	if event.NodeId == b.NodeId {
+		return
+	}
+
+	switch event.Event {
+	case CLUSTER_EVENT_MESSAGE:
+		if event.Message != nil {
+			b.local.Publish(event.Message)
+		}
+	case CLUSTER_EVENT_CHANNEL_ACCESS:
+		b.local.UpdateChannelAccessCache(event.TeamId, event.UserId, event.ChannelId)
+	case CLUSTER_EVENT_USER_SESSIONS:
+		b.local.RemoveAllSessionsForUserIdFromCache(event.UserId)
+	case CLUSTER_EVENT_ACCESS_TOKEN:
+		b.local.RemoveUserAccessTokenFromCache(event.TokenId)
+	case CLUSTER_EVENT_ROLES:
+		b.local.InvalidateRoleCache(event.TeamId)
+	}
+}
+
+func (b *ClusterMessageBus) acceptPump() {
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		b.connsLock.Lock()
+		b.conns[conn] = true
+		b.connsLock.Unlock()
+
+		go b.readPump(conn)
+	}
+}
+
+func (b *ClusterMessageBus) readPump(conn net.Conn) {
+	defer func() {
+		b.connsLock.Lock()
+		delete(b.conns, conn)
+		b.connsLock.Unlock()
+		conn.Close()
+	}()
+
+	reader := bufio.NewReader(conn)
+	key, ok := b.acceptHandshake(conn, reader)
+	if !ok {
+		l4g.Warn(utils.T("api.message_bus.handshake.rejected.warn"), conn.RemoteAddr().String())
+		return
+	}
+
+	in := &clusterConn{key: key}
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			return
+		}
+
+		event, ok := in.open(line)
+		if !ok {
+			l4g.Warn(utils.T("api.message_bus.read.rejected.warn"), conn.RemoteAddr().String())
+			return
+		}
+
+		b.deliver(event)
+	}
+}
+
+func (b *ClusterMessageBus) peerPump(peer *clusterPeer) {
+	var conn net.Conn
+	var out *clusterConn
+
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+
+	for {
+		select {
+		case <-peer.stop:
+			return
+		case event := <-peer.send:
+			for conn == nil {
+				var err error
+				if conn, err = net.DialTimeout("tcp", peer.address, CLUSTER_DIAL_TIMEOUT); err != nil {
+					l4g.Error(utils.T("api.message_bus.peer.dial.error"), peer.address, err)
+					conn = nil
+
+					select {
+					case <-peer.stop:
+						return
+					case <-time.After(CLUSTER_RECONNECT_WAIT):
+					}
+				} else if key, err := b.dialHandshake(conn); err != nil {
+					l4g.Error(utils.T("api.message_bus.peer.handshake.error"), peer.address, err)
+					conn.Close()
+					conn = nil
+
+					select {
+					case <-peer.stop:
+						return
+					case <-time.After(CLUSTER_RECONNECT_WAIT):
+					}
+				} else {
+					out = &clusterConn{key: key}
+				}
+			}
+
+			if line, err := out.seal(event); err != nil {
+				l4g.Error(utils.T("api.message_bus.peer.write.error"), peer.address, err)
+			} else {
+				conn.SetWriteDeadline(time.Now().Add(CLUSTER_WRITE_WAIT))
+				if _, err := conn.Write(line); err != nil {
+					l4g.Error(utils.T("api.message_bus.peer.write.error"), peer.address, err)
+					conn.Close()
+					conn = nil
+				}
+			}
+		}
+	}
+}
+
+// sign returns an HMAC of the given handshake fields keyed with the shared secret.
+func (b *ClusterMessageBus) sign(fields ...string) string {
+	mac := hmac.New(sha256.New, b.secret)
+	mac.Write([]byte(strings.Join(fields, ":")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// sessionKey derives the key that events on a connection are signed with from
+// the nonces both nodes sent during the handshake.
+func (b *ClusterMessageBus) sessionKey(acceptNonce, dialNonce string) []byte {
+	mac := hmac.New(sha256.New, b.secret)
+	mac.Write([]byte(strings.Join([]string{"session", acceptNonce, dialNonce}, ":")))
+	return mac.Sum(nil)
+}
+
+func newClusterNonce() (string, error) {
+	nonce := make([]byte, CLUSTER_NONCE_SIZE)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(nonce), nil
+}
+
+func isClusterNonce(nonce string) bool {
+	if len(nonce) != CLUSTER_NONCE_SIZE*2 {
+		return false
+	}
+
+	_, err := hex.DecodeString(nonce)
+	return err == nil
+}
+
+// acceptHandshake challenges a node that has connected to this one to prove it
+// knows the shared secret and then proves the same back to it. It returns the
+// key that events on the connection are signed with.
+func (b *ClusterMessageBus) acceptHandshake(conn net.Conn, reader *bufio.Reader) ([]byte, bool) {
+	if len(b.secret) == 0 {
+		return nil, false
+	}
+
+	acceptNonce, err := newClusterNonce()
+	if err != nil {
+		return nil, false
+	}
+
+	conn.SetDeadline(time.Now().Add(CLUSTER_HANDSHAKE_WAIT))
+	defer conn.SetDeadline(time.Time{})
+
+	if _, err := conn.Write([]byte(acceptNonce + "\n")); err != nil {
+		return nil, false
+	}
+
+	answer, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, false
+	}
+
+	fields := strings.Fields(answer)
+	if len(fields) != 2 || !isClusterNonce(fields[0]) {
+		return nil, false
+	}
+	dialNonce := fields[0]
+
+	if !hmac.Equal([]byte(fields[1]), []byte(b.sign("dial", acceptNonce, dialNonce))) {
+		return nil, false
+	}
+
+	if _, err := conn.Write([]byte(b.sign("accept", acceptNonce, dialNonce) + "\n")); err != nil {
+		return nil, false
+	}
+
+	return b.sessionKey(acceptNonce, dialNonce), true
+}
+
+// dialHandshake answers the challenge sent by the node that this one connected
+// to along with a nonce of its own, and checks that the other node answers that
+// in turn before anything is sent to it. It returns the key that events on the
+// connection are signed with.
+func (b *ClusterMessageBus) dialHandshake(conn net.Conn) ([]byte, error) {
+	if len(b.secret) == 0 {
+		return nil, errors.New("no inter-node secret is configured")
+	}
+
+	conn.SetDeadline(time.Now().Add(CLUSTER_HANDSHAKE_WAIT))
+	defer conn.SetDeadline(time.Time{})
+
+	reader := bufio.NewReader(conn)
+
+	challenge, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	acceptNonce := strings.TrimSpace(challenge)
+	if !isClusterNonce(acceptNonce) {
+		return nil, errors.New("peer sent an invalid challenge")
+	}
+
+	dialNonce, err := newClusterNonce()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := conn.Write([]byte(dialNonce + " " + b.sign("dial", acceptNonce, dialNonce) + "\n")); err != nil {
+		return nil, err
+	}
+
+	answer, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	if !hmac.Equal([]byte(strings.TrimSpace(answer)), []byte(b.sign("accept", acceptNonce, dialNonce))) {
+		return nil, errors.New("peer didn't present the inter-node secret")
+	}
+
+	return b.sessionKey(acceptNonce, dialNonce), nil
+}
+
+// clusterConn signs and checks the events sent over one authenticated
+// connection. Each event is written as a line holding an HMAC of its position
+// on the connection and its JSON, so events can't be altered, replayed or
+// reordered without the other end noticing.
+type clusterConn struct {
+	key []byte
+	seq uint64
+}
+
+func (c *clusterConn) mac(payload []byte) string {
+	var seq [8]byte
+	binary.BigEndian.PutUint64(seq[:], c.seq)
+
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write(seq[:])
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (c *clusterConn) seal(event *clusterEvent) ([]byte, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+
+	line := []byte(c.mac(payload) + " ")
+	line = append(line, payload...)
+	line = append(line, '\n')
+	c.seq++
+
+	return line, nil
+}
+
+func (c *clusterConn) open(line []byte) (*clusterEvent, bool) {
+	parts := strings.SplitN(strings.TrimSpace(string(line)), " ", 2)
+	if len(parts) != 2 {
+		return nil, false
+	}
+
+	payload := []byte(parts[1])
+	if !hmac.Equal([]byte(parts[0]), []byte(c.mac(payload))) {
+		return nil, false
+	}
+	c.seq++
+
+	var event clusterEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, false
+	}
+
+	return &event, true
+}
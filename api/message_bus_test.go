@@ -0,0 +1,242 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package api
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattermost/platform/model"
+	"github.com/mattermost/platform/utils"
+)
+
+type recordingMessageBus struct {
+	messages chan *model.Message
+	access   chan string
+	sessions chan string
+	tokens   chan string
+	roles    chan string
+}
+
+func newRecordingMessageBus() *recordingMessageBus {
+	return &recordingMessageBus{messages: make(chan *model.Message, 10), access: make(chan string, 10), sessions: make(chan string, 10), tokens: make(chan string, 10), roles: make(chan string, 10)}
+}
+
+func (b *recordingMessageBus) Start() *model.AppError {
+	return nil
+}
+
+func (b *recordingMessageBus) Stop() {
+}
+
+func (b *recordingMessageBus) Publish(message *model.Message) {
+	b.messages <- message
+}
+
+func (b *recordingMessageBus) UpdateChannelAccessCache(teamId, userId, channelId string) {
+	b.access <- teamId + userId + channelId
+}
+
+func (b *recordingMessageBus) RemoveAllSessionsForUserIdFromCache(userId string) {
+	b.sessions <- userId
+}
+
+func (b *recordingMessageBus) RemoveUserAccessTokenFromCache(tokenId string) {
+	b.tokens <- tokenId
+}
+
+func (b *recordingMessageBus) InvalidateRoleCache(teamId string) {
+	b.roles <- teamId
+}
+
+func TestClusterMessageBus(t *testing.T) {
+	utils.InitTranslations()
+
+	localA := newRecordingMessageBus()
+	busA := NewClusterMessageBus("127.0.0.1:0", []string{}, "clustersecret1234", localA)
+	if err := busA.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer busA.Stop()
+
+	localB := newRecordingMessageBus()
+	busB := NewClusterMessageBus("127.0.0.1:0", []string{busA.ListenAddr()}, "clustersecret1234", localB)
+	if err := busB.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer busB.Stop()
+
+	message := model.NewMessage(model.NewId(), model.NewId(), model.NewId(), model.ACTION_TYPING)
+	busB.Publish(message)
+
+	select {
+	case m := <-localB.messages:
+		if m.ChannelId != message.ChannelId {
+			t.Fatal("local delivery should have been the same message")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("message was not delivered locally")
+	}
+
+	select {
+	case m := <-localA.messages:
+		if m.TeamId != message.TeamId || m.ChannelId != message.ChannelId || m.UserId != message.UserId || m.Action != message.Action {
+			t.Fatal("relayed message did not match")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("message was not relayed to peer")
+	}
+
+	busB.UpdateChannelAccessCache("team", "user", "channel")
+
+	select {
+	case key := <-localA.access:
+		if key != "teamuserchannel" {
+			t.Fatal("relayed channel access update did not match")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("channel access update was not relayed to peer")
+	}
+
+	busB.RemoveAllSessionsForUserIdFromCache("user")
+
+	select {
+	case userId := <-localA.sessions:
+		if userId != "user" {
+			t.Fatal("relayed session removal did not match")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("session removal was not relayed to peer")
+	}
+
+	busB.RemoveUserAccessTokenFromCache("token")
+
+	select {
+	case tokenId := <-localA.tokens:
+		if tokenId != "token" {
+			t.Fatal("relayed token removal did not match")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("token removal was not relayed to peer")
+	}
+
+	busB.InvalidateRoleCache("team")
+
+	select {
+	case teamId := <-localA.roles:
+		if teamId != "team" {
+			t.Fatal("relayed role invalidation did not match")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("role invalidation was not relayed to peer")
+	}
+
+	// events that originated on this node are never delivered twice
+	busA.deliver(&clusterEvent{NodeId: busA.NodeId, Event: CLUSTER_EVENT_MESSAGE, Message: message})
+
+	select {
+	case <-localA.messages:
+		t.Fatal("should have ignored an event from its own node")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestClusterMessageBusSecret(t *testing.T) {
+	utils.InitTranslations()
+
+	localA := newRecordingMessageBus()
+	busA := NewClusterMessageBus("127.0.0.1:0", []string{}, "clustersecret1234", localA)
+	if err := busA.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer busA.Stop()
+
+	localB := newRecordingMessageBus()
+	busB := NewClusterMessageBus("127.0.0.1:0", []string{busA.ListenAddr()}, "wrongsecret12345", localB)
+	if err := busB.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	busB.Publish(model.NewMessage(model.NewId(), model.NewId(), model.NewId(), model.ACTION_TYPING))
+
+	select {
+	case <-localA.messages:
+		t.Fatal("shouldn't have accepted an event from a peer with the wrong secret")
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	// stopping more than once shouldn't panic
+	busB.Stop()
+	busB.Stop()
+}
+
+func TestClusterMessageBusMutualHandshake(t *testing.T) {
+	utils.InitTranslations()
+
+	// a node pretending to be a peer without knowing the secret
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	localB := newRecordingMessageBus()
+	busB := NewClusterMessageBus("127.0.0.1:0", []string{listener.Addr().String()}, "clustersecret1234", localB)
+	if err := busB.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer busB.Stop()
+
+	busB.Publish(model.NewMessage(model.NewId(), model.NewId(), model.NewId(), model.ACTION_TYPING))
+
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	reader := bufio.NewReader(conn)
+
+	conn.Write([]byte(strings.Repeat("ab", CLUSTER_NONCE_SIZE) + "\n"))
+	if _, err := reader.ReadString('\n'); err != nil {
+		t.Fatal("should have answered the challenge", err)
+	}
+
+	conn.Write([]byte(strings.Repeat("00", 32) + "\n"))
+	if line, err := reader.ReadString('\n'); err == nil {
+		t.Fatal("shouldn't have sent an event to a peer that didn't prove it knows the secret", line)
+	}
+
+	// a peer that knows the secret but sends an event that wasn't signed for the connection
+	localA := newRecordingMessageBus()
+	busA := NewClusterMessageBus("127.0.0.1:0", []string{}, "clustersecret1234", localA)
+	if err := busA.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer busA.Stop()
+
+	conn2, err := net.Dial("tcp", busA.ListenAddr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn2.Close()
+
+	if _, err := busB.dialHandshake(conn2); err != nil {
+		t.Fatal("should have completed the handshake", err)
+	}
+
+	forged := &clusterConn{key: []byte("notthesessionkey")}
+	line, _ := forged.seal(&clusterEvent{NodeId: model.NewId(), Event: CLUSTER_EVENT_USER_SESSIONS, UserId: "user"})
+	conn2.Write(line)
+
+	select {
+	case <-localA.sessions:
+		t.Fatal("shouldn't have delivered an event with a bad signature")
+	case <-time.After(500 * time.Millisecond):
+	}
+}
@@ -4,7 +4,6 @@
 package api
 
 import (
-	"crypto/tls"
 	"fmt"
 	l4g "github.com/alecthomas/log4go"
 	"github.com/gorilla/mux"
@@ -22,21 +21,35 @@ import (
 	"time"
 )
 
-func InitPost(r *mux.Router) {
+func InitPost(routers ...*mux.Router) {
 	l4g.Debug(utils.T("api.post.init.debug"))
 
-	r.Handle("/posts/search", ApiUserRequired(searchPosts)).Methods("GET")
-	r.Handle("/posts/{post_id}", ApiUserRequired(getPostById)).Methods("GET")
-
-	sr := r.PathPrefix("/channels/{id:[A-Za-z0-9]+}").Subrouter()
-	sr.Handle("/create", ApiUserRequired(createPost)).Methods("POST")
-	sr.Handle("/update", ApiUserRequired(updatePost)).Methods("POST")
-	sr.Handle("/posts/{offset:[0-9]+}/{limit:[0-9]+}", ApiUserRequiredActivity(getPosts, false)).Methods("GET")
-	sr.Handle("/posts/{time:[0-9]+}", ApiUserRequiredActivity(getPostsSince, false)).Methods("GET")
-	sr.Handle("/post/{post_id:[A-Za-z0-9]+}", ApiUserRequired(getPost)).Methods("GET")
-	sr.Handle("/post/{post_id:[A-Za-z0-9]+}/delete", ApiUserRequired(deletePost)).Methods("POST")
-	sr.Handle("/post/{post_id:[A-Za-z0-9]+}/before/{offset:[0-9]+}/{num_posts:[0-9]+}", ApiUserRequired(getPostsBefore)).Methods("GET")
-	sr.Handle("/post/{post_id:[A-Za-z0-9]+}/after/{offset:[0-9]+}/{num_posts:[0-9]+}", ApiUserRequired(getPostsAfter)).Methods("GET")
+	for _, r := range routers {
+		r.Handle("/posts/search", ApiUserRequired(searchPosts)).Methods("GET")
+		r.Handle("/posts/threads/{offset:[0-9]+}/{limit:[0-9]+}", ApiUserRequired(getFollowedThreads)).Methods("GET")
+		r.Handle("/posts/flagged/{offset:[0-9]+}/{limit:[0-9]+}", ApiUserRequired(getFlaggedPosts)).Methods("GET")
+		r.Handle("/posts/{post_id}", ApiUserRequired(getPostById)).Methods("GET")
+		r.Handle("/posts/{post_id:[A-Za-z0-9]+}/thread", ApiUserRequired(getPostThread)).Methods("GET")
+		r.Handle("/posts/{post_id:[A-Za-z0-9]+}/thread/follow", ApiUserRequired(followThread)).Methods("POST")
+		r.Handle("/posts/{post_id:[A-Za-z0-9]+}/thread/unfollow", ApiUserRequired(unfollowThread)).Methods("POST")
+		r.Handle("/posts/{post_id:[A-Za-z0-9]+}/flag", ApiUserRequired(flagPost)).Methods("POST")
+		r.Handle("/posts/{post_id:[A-Za-z0-9]+}/unflag", ApiUserRequired(unflagPost)).Methods("POST")
+		r.Handle("/posts/{post_id:[A-Za-z0-9]+}/actions/{action_id:[A-Za-z0-9]+}", ApiUserRequired(doPostAction)).Methods("POST")
+
+		sr := r.PathPrefix("/channels/{id:[A-Za-z0-9]+}").Subrouter()
+		sr.Handle("/create", ApiUserRequired(createPost)).Methods("POST")
+		sr.Handle("/update", ApiUserRequired(updatePost)).Methods("POST")
+		sr.Handle("/posts/{offset:[0-9]+}/{limit:[0-9]+}", ApiUserRequiredActivity(getPosts, false)).Methods("GET")
+		sr.Handle("/posts/{time:[0-9]+}", ApiUserRequiredActivity(getPostsSince, false)).Methods("GET")
+		sr.Handle("/post/{post_id:[A-Za-z0-9]+}", ApiUserRequired(getPost)).Methods("GET")
+		sr.Handle("/pinned", ApiUserRequired(getPinnedPosts)).Methods("GET")
+		sr.Handle("/post/{post_id:[A-Za-z0-9]+}/delete", ApiUserRequired(deletePost)).Methods("POST")
+		sr.Handle("/post/{post_id:[A-Za-z0-9]+}/history", ApiUserRequired(getPostHistory)).Methods("GET")
+		sr.Handle("/post/{post_id:[A-Za-z0-9]+}/pin", ApiUserRequired(pinPost)).Methods("POST")
+		sr.Handle("/post/{post_id:[A-Za-z0-9]+}/unpin", ApiUserRequired(unpinPost)).Methods("POST")
+		sr.Handle("/post/{post_id:[A-Za-z0-9]+}/before/{offset:[0-9]+}/{num_posts:[0-9]+}", ApiUserRequired(getPostsBefore)).Methods("GET")
+		sr.Handle("/post/{post_id:[A-Za-z0-9]+}/after/{offset:[0-9]+}/{num_posts:[0-9]+}", ApiUserRequired(getPostsAfter)).Methods("GET")
+	}
 }
 
 func createPost(c *Context, w http.ResponseWriter, r *http.Request) {
@@ -46,6 +59,9 @@ func createPost(c *Context, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// only integrations can add actions that call out to other servers
+	post.StripActionIntegrations()
+
 	// Create and save post object to channel
 	cchan := Srv.Store.Channel().CheckPermissionsTo(c.Session.TeamId, post.ChannelId, c.Session.UserId)
 
@@ -104,6 +120,7 @@ func CreatePost(c *Context, post *model.Post, triggerWebhooks bool) (*model.Post
 	post.CreateAt = 0
 
 	post.Hashtags, _ = model.ParseHashtags(post.Message)
+	post.GenerateActionIds()
 
 	post.UserId = c.Session.UserId
 
@@ -146,13 +163,40 @@ func CreatePost(c *Context, post *model.Post, triggerWebhooks bool) (*model.Post
 	} else {
 		rpost = result.Data.(*model.Post)
 
+		if fileIds := getFileIdsFromFilenames(rpost.Filenames); len(fileIds) > 0 {
+			if result := <-Srv.Store.FileInfo().AttachToPost(fileIds, rpost.Id, rpost.ChannelId, rpost.UserId); result.Err != nil {
+				l4g.Error(utils.T("api.post.create_post.attach_files.error"), rpost.Id, result.Err)
+			}
+		}
+
+		searchEngine.IndexPost(rpost)
 		handlePostEventsAndForget(c, rpost, triggerWebhooks)
 
+		if len(rpost.RootId) > 0 {
+			followThreadAndForget(rpost.RootId, rpost.UserId, rpost.CreateAt)
+		}
+
 	}
 
 	return rpost, nil
 }
 
+// getFileIdsFromFilenames gets the ids of the FileInfos for the files that were
+// uploaded to the server, which are the directories that the files are in.
+func getFileIdsFromFilenames(filenames []string) []string {
+	fileIds := []string{}
+
+	for _, filename := range filenames {
+		if matches := model.PartialUrlRegex.FindStringSubmatch(filename); len(matches) >= 4 {
+			if parts := strings.Split(matches[3], "/"); len(parts) == 2 && len(parts[0]) == 26 {
+				fileIds = append(fileIds, parts[0])
+			}
+		}
+	}
+
+	return fileIds
+}
+
 func CreateWebhookPost(c *Context, channelId, text, overrideUsername, overrideIconUrl string, props model.StringInterface, postType string) (*model.Post, *model.AppError) {
 	// parse links into Markdown format
 	linkWithTextRegex := regexp.MustCompile(`<([^<\|]+)\|([^>]+)>`)
@@ -283,6 +327,12 @@ func handlePostEventsAndForget(c *Context, post *model.Post, triggerWebhooks boo
 
 		if channel.Type == model.CHANNEL_DIRECT {
 			go makeDirectChannelVisible(c.Session.TeamId, post.ChannelId)
+
+			// bots don't forward messages to each other so they can't get stuck
+			// replying to one another
+			if !user.IsBot {
+				go forwardDirectMessageToBot(c, post, channel, user)
+			}
 		}
 	}()
 }
@@ -382,53 +432,26 @@ func handleWebhookEventsAndForget(c *Context, post *model.Post, team *model.Team
 		}
 
 		for _, hook := range relevantHooks {
-			go func(hook *model.OutgoingWebhook) {
-				p := url.Values{}
-				p.Set("token", hook.Token)
+			p := url.Values{}
+			p.Set("token", hook.Token)
 
-				p.Set("team_id", hook.TeamId)
-				p.Set("team_domain", team.Name)
+			p.Set("team_id", hook.TeamId)
+			p.Set("team_domain", team.Name)
 
-				p.Set("channel_id", post.ChannelId)
-				p.Set("channel_name", channel.Name)
+			p.Set("channel_id", post.ChannelId)
+			p.Set("channel_name", channel.Name)
 
-				p.Set("timestamp", strconv.FormatInt(post.CreateAt/1000, 10))
+			p.Set("timestamp", strconv.FormatInt(post.CreateAt/1000, 10))
 
-				p.Set("user_id", post.UserId)
-				p.Set("user_name", user.Username)
+			p.Set("user_id", post.UserId)
+			p.Set("user_name", user.Username)
 
-				p.Set("text", post.Message)
-				p.Set("trigger_word", firstWord)
-
-				tr := &http.Transport{
-					TLSClientConfig: &tls.Config{InsecureSkipVerify: *utils.Cfg.ServiceSettings.EnableInsecureOutgoingConnections},
-				}
-				client := &http.Client{Transport: tr}
-
-				for _, url := range hook.CallbackURLs {
-					go func(url string) {
-						req, _ := http.NewRequest("POST", url, strings.NewReader(p.Encode()))
-						req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-						req.Header.Set("Accept", "application/json")
-						if resp, err := client.Do(req); err != nil {
-							l4g.Error(utils.T("api.post.handle_webhook_events_and_forget.event_post.error"), err.Error())
-						} else {
-							respProps := model.MapFromJson(resp.Body)
-
-							// copy the context and create a mock session for posting the message
-							mockSession := model.Session{UserId: hook.CreatorId, TeamId: hook.TeamId, IsOAuth: false}
-							newContext := &Context{mockSession, model.NewId(), "", c.Path, nil, c.teamURLValid, c.teamURL, c.siteURL, c.T, c.Locale}
-
-							if text, ok := respProps["text"]; ok {
-								if _, err := CreateWebhookPost(newContext, post.ChannelId, text, respProps["username"], respProps["icon_url"], post.Props, post.Type); err != nil {
-									l4g.Error(utils.T("api.post.handle_webhook_events_and_forget.create_post.error"), err)
-								}
-							}
-						}
-					}(url)
-				}
+			p.Set("text", post.Message)
+			p.Set("trigger_word", firstWord)
 
-			}(hook)
+			for _, callbackURL := range hook.CallbackURLs {
+				go queueWebhookDelivery(c, hook, post, callbackURL, p)
+			}
 		}
 
 	}()
@@ -448,7 +471,7 @@ func sendNotifications(c *Context, post *model.Post, team *model.Team, channel *
 	}
 	senderName := profileMap[post.UserId].Username
 
-	toEmailMap := make(map[string]bool)
+	mentionedUserIds := make(map[string]bool)
 
 	if channel.Type == model.CHANNEL_DIRECT {
 
@@ -461,14 +484,7 @@ func sendNotifications(c *Context, post *model.Post, team *model.Team, channel *
 			channelName = profileMap[userIds[0]].Username
 		}
 
-		otherUser := profileMap[otherUserId]
-		sendEmail := true
-		if _, ok := otherUser.NotifyProps["email"]; ok && otherUser.NotifyProps["email"] == "false" {
-			sendEmail = false
-		}
-		if sendEmail && (otherUser.IsOffline() || otherUser.IsAway()) {
-			toEmailMap[otherUserId] = true
-		}
+		mentionedUserIds[otherUserId] = true
 
 	} else {
 		// Find out who is a member of the channel, only keep those profiles
@@ -547,42 +563,89 @@ func sendNotifications(c *Context, post *model.Post, team *model.Team, channel *
 				if post.UserId == userId && post.Props["from_webhook"] != "true" {
 					continue
 				}
-				sendEmail := true
-				if _, ok := profileMap[userId].NotifyProps["email"]; ok && profileMap[userId].NotifyProps["email"] == "false" {
-					sendEmail = false
-				}
-				if sendEmail && (profileMap[userId].IsAway() || profileMap[userId].IsOffline()) {
-					toEmailMap[userId] = true
-				} else {
-					toEmailMap[userId] = false
-				}
+				mentionedUserIds[userId] = true
 			}
 		}
+	}
+
+	// work out who should be emailed or sent a push notification, letting each
+	// channel member override their account settings for this channel
+	toEmailMap := make(map[string]bool)
+	toPushMap := make(map[string]bool)
+	for _, member := range members {
+		profile, ok := profileMap[member.UserId]
+		if !ok || profile == nil || (member.UserId == post.UserId && post.Props["from_webhook"] != "true") {
+			continue
+		}
+
+		if member.IsMuted() {
+			delete(mentionedUserIds, member.UserId)
+			continue
+		}
+
+		if !profile.IsAway() && !profile.IsOffline() {
+			continue
+		}
+
+		// by default both are sent for mentions if the user has email notifications turned on
+		defaultLevel := model.CHANNEL_NOTIFY_MENTION
+		if profile.NotifyProps["email"] == "false" {
+			defaultLevel = model.CHANNEL_NOTIFY_NONE
+		}
+
+		if shouldSendChannelNotification(member.NotifyProps["email"], defaultLevel, mentionedUserIds[member.UserId]) {
+			toEmailMap[member.UserId] = true
+		}
 
-		for id := range toEmailMap {
-			updateMentionCountAndForget(post.ChannelId, id)
+		if shouldSendChannelNotification(member.NotifyProps["push"], defaultLevel, mentionedUserIds[member.UserId]) {
+			toPushMap[member.UserId] = true
 		}
 	}
 
-	if len(toEmailMap) != 0 {
-		mentionedUsers = make([]string, 0, len(toEmailMap))
-		for k := range toEmailMap {
+	if len(mentionedUserIds) != 0 {
+		mentionedUsers = make([]string, 0, len(mentionedUserIds))
+		for k := range mentionedUserIds {
 			mentionedUsers = append(mentionedUsers, k)
+
+			if channel.Type != model.CHANNEL_DIRECT {
+				updateMentionCountAndForget(post.ChannelId, k)
+			}
 		}
+	}
+
+	toNotifyIds := []string{}
+	for id := range toEmailMap {
+		toNotifyIds = append(toNotifyIds, id)
+	}
+	for id := range toPushMap {
+		if !toEmailMap[id] {
+			toNotifyIds = append(toNotifyIds, id)
+		}
+	}
 
+	if len(toNotifyIds) != 0 {
 		teamURL := c.GetSiteURL() + "/" + team.Name
 
+		statuses := map[string]*model.Status{}
+		if result := <-Srv.Store.Status().GetByUserIds(toNotifyIds); result.Err != nil {
+			l4g.Error(utils.T("api.post.send_notifications_and_forget.statuses.error"), result.Err)
+		} else {
+			statuses = result.Data.(map[string]*model.Status)
+		}
+
 		// Build and send the emails
 		tm := time.Unix(post.CreateAt/1000, 0)
+		now := model.GetMillis()
 
-		for id, doSend := range toEmailMap {
+		for _, id := range toNotifyIds {
 
-			if !doSend {
+			// skip if inactive, and bots hear about messages through their integration instead
+			if profileMap[id].DeleteAt > 0 || profileMap[id].IsBot {
 				continue
 			}
 
-			// skip if inactive
-			if profileMap[id].DeleteAt > 0 {
+			// skip both the email and push notification if the user doesn't want to be disturbed
+			if status, ok := statuses[id]; ok && status.IsDndActive(now) {
 				continue
 			}
 
@@ -597,64 +660,68 @@ func sendNotifications(c *Context, post *model.Post, team *model.Team, channel *
 				channelName = channel.DisplayName
 			}
 
-			month := userLocale(tm.Month().String())
-			day := fmt.Sprintf("%d", tm.Day())
-			year := fmt.Sprintf("%d", tm.Year())
-			zone, _ := tm.Zone()
-
-			subjectPage := utils.NewHTMLTemplate("post_subject", profileMap[id].Locale)
-			subjectPage.Props["Subject"] = userLocale("api.templates.post_subject",
-				map[string]interface{}{"SubjectText": subjectText, "TeamDisplayName": team.DisplayName,
-					"Month": month[:3], "Day": day, "Year": year})
-			subjectPage.Props["SiteName"] = utils.Cfg.TeamSettings.SiteName
-
-			bodyPage := utils.NewHTMLTemplate("post_body", profileMap[id].Locale)
-			bodyPage.Props["SiteURL"] = c.GetSiteURL()
-			bodyPage.Props["PostMessage"] = model.ClearMentionTags(post.Message)
-			bodyPage.Props["TeamLink"] = teamURL + "/channels/" + channel.Name
-			bodyPage.Props["BodyText"] = bodyText
-			bodyPage.Props["Button"] = userLocale("api.templates.post_body.button")
-			bodyPage.Html["Info"] = template.HTML(userLocale("api.templates.post_body.info",
-				map[string]interface{}{"ChannelName": channelName, "SenderName": senderName,
-					"Hour": fmt.Sprintf("%02d", tm.Hour()), "Minute": fmt.Sprintf("%02d", tm.Minute()),
-					"TimeZone": zone, "Month": month, "Day": day}))
-
-			// attempt to fill in a message body if the post doesn't have any text
-			if len(strings.TrimSpace(bodyPage.Props["PostMessage"])) == 0 && len(post.Filenames) > 0 {
-				// extract the filenames from their paths and determine what type of files are attached
-				filenames := make([]string, len(post.Filenames))
-				onlyImages := true
-				for i, filename := range post.Filenames {
-					var err error
-					if filenames[i], err = url.QueryUnescape(filepath.Base(filename)); err != nil {
-						// this should never error since filepath was escaped using url.QueryEscape
-						filenames[i] = filepath.Base(filename)
+			if toEmailMap[id] {
+				month := userLocale(tm.Month().String())
+				day := fmt.Sprintf("%d", tm.Day())
+				year := fmt.Sprintf("%d", tm.Year())
+				zone, _ := tm.Zone()
+
+				subjectPage := utils.NewHTMLTemplate("post_subject", profileMap[id].Locale)
+				subjectPage.Props["Subject"] = userLocale("api.templates.post_subject",
+					map[string]interface{}{"SubjectText": subjectText, "TeamDisplayName": team.DisplayName,
+						"Month": month[:3], "Day": day, "Year": year})
+				subjectPage.Props["SiteName"] = utils.Cfg.TeamSettings.SiteName
+
+				bodyPage := utils.NewHTMLTemplate("post_body", profileMap[id].Locale)
+				bodyPage.Props["SiteURL"] = c.GetSiteURL()
+				bodyPage.Props["PostMessage"] = model.ClearMentionTags(post.Message)
+				bodyPage.Props["TeamLink"] = teamURL + "/channels/" + channel.Name
+				bodyPage.Props["BodyText"] = bodyText
+				bodyPage.Props["Button"] = userLocale("api.templates.post_body.button")
+				bodyPage.Html["Info"] = template.HTML(userLocale("api.templates.post_body.info",
+					map[string]interface{}{"ChannelName": channelName, "SenderName": senderName,
+						"Hour": fmt.Sprintf("%02d", tm.Hour()), "Minute": fmt.Sprintf("%02d", tm.Minute()),
+						"TimeZone": zone, "Month": month, "Day": day}))
+
+				// attempt to fill in a message body if the post doesn't have any text
+				if len(strings.TrimSpace(bodyPage.Props["PostMessage"])) == 0 && len(post.Filenames) > 0 {
+					// extract the filenames from their paths and determine what type of files are attached
+					filenames := make([]string, len(post.Filenames))
+					onlyImages := true
+					for i, filename := range post.Filenames {
+						var err error
+						if filenames[i], err = url.QueryUnescape(filepath.Base(filename)); err != nil {
+							// this should never error since filepath was escaped using url.QueryEscape
+							filenames[i] = filepath.Base(filename)
+						}
+
+						ext := filepath.Ext(filename)
+						onlyImages = onlyImages && model.IsFileExtImage(ext)
 					}
+					filenamesString := strings.Join(filenames, ", ")
 
-					ext := filepath.Ext(filename)
-					onlyImages = onlyImages && model.IsFileExtImage(ext)
-				}
-				filenamesString := strings.Join(filenames, ", ")
+					var attachmentPrefix string
+					if onlyImages {
+						attachmentPrefix = "Image"
+					} else {
+						attachmentPrefix = "File"
+					}
+					if len(post.Filenames) > 1 {
+						attachmentPrefix += "s"
+					}
 
-				var attachmentPrefix string
-				if onlyImages {
-					attachmentPrefix = "Image"
-				} else {
-					attachmentPrefix = "File"
-				}
-				if len(post.Filenames) > 1 {
-					attachmentPrefix += "s"
+					bodyPage.Props["PostMessage"] = userLocale("api.post.send_notifications_and_forget.sent",
+						map[string]interface{}{"Prefix": attachmentPrefix, "Filenames": filenamesString})
 				}
 
-				bodyPage.Props["PostMessage"] = userLocale("api.post.send_notifications_and_forget.sent",
-					map[string]interface{}{"Prefix": attachmentPrefix, "Filenames": filenamesString})
-			}
-
-			if err := utils.SendMail(profileMap[id].Email, subjectPage.Render(), bodyPage.Render()); err != nil {
-				l4g.Error(utils.T("api.post.send_notifications_and_forget.send.error"), profileMap[id].Email, err)
+				if interval := model.GetEmailInterval(profileMap[id].NotifyProps["email_interval"]); interval > 0 {
+					queueEmailNotification(c, profileMap[id], post, team, channel, senderName, bodyPage.Props["PostMessage"], interval)
+				} else if err := utils.SendMail(profileMap[id].Email, subjectPage.Render(), bodyPage.Render()); err != nil {
+					l4g.Error(utils.T("api.post.send_notifications_and_forget.send.error"), profileMap[id].Email, err)
+				}
 			}
 
-			if *utils.Cfg.EmailSettings.SendPushNotifications {
+			if toPushMap[id] && *utils.Cfg.EmailSettings.SendPushNotifications {
 				sessionChan := Srv.Store.Session().GetSessions(id)
 				if result := <-sessionChan; result.Err != nil {
 					l4g.Error(utils.T("api.post.send_notifications_and_forget.sessions.error"), id, result.Err)
@@ -702,16 +769,7 @@ func sendNotifications(c *Context, post *model.Post, team *model.Team, channel *
 								}
 							}
 
-							tr := &http.Transport{
-								TLSClientConfig: &tls.Config{InsecureSkipVerify: *utils.Cfg.ServiceSettings.EnableInsecureOutgoingConnections},
-							}
-							httpClient := &http.Client{Transport: tr}
-							request, _ := http.NewRequest("POST", *utils.Cfg.EmailSettings.PushNotificationServer+"/api/v1/send_push", strings.NewReader(msg.ToJson()))
-
-							l4g.Debug(utils.T("api.post.send_notifications_and_forget.push_notification.debug"), msg.DeviceId, msg.Message)
-							if _, err := httpClient.Do(request); err != nil {
-								l4g.Error(utils.T("api.post.send_notifications_and_forget.push_notification.error"), id, err)
-							}
+							sendPushNotificationAndForget(session, &msg)
 						}
 					}
 				}
@@ -742,6 +800,17 @@ func sendNotifications(c *Context, post *model.Post, team *model.Team, channel *
 	PublishAndForget(message)
 }
 
+// shouldSendChannelNotification decides whether to send an email or push
+// notification based on the level set for the channel, falling back to the
+// default level when the member hasn't overridden it.
+func shouldSendChannelNotification(level string, defaultLevel string, mentioned bool) bool {
+	if level == "" || level == model.CHANNEL_NOTIFY_DEFAULT {
+		level = defaultLevel
+	}
+
+	return level == model.CHANNEL_NOTIFY_ALL || (level == model.CHANNEL_NOTIFY_MENTION && mentioned)
+}
+
 func updateMentionCountAndForget(channelId, userId string) {
 	go func() {
 		if result := <-Srv.Store.Channel().IncrementMentionCount(channelId, userId); result.Err != nil {
@@ -888,6 +957,7 @@ func updatePost(c *Context, w http.ResponseWriter, r *http.Request) {
 		return
 	} else {
 		rpost := result.Data.(*model.Post)
+		searchEngine.IndexPost(rpost)
 
 		message := model.NewMessage(c.Session.TeamId, rpost.ChannelId, c.Session.UserId, model.ACTION_POST_EDITED)
 		message.Add("post", rpost.ToJson())
@@ -898,6 +968,159 @@ func updatePost(c *Context, w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func doPostAction(c *Context, w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+
+	postId := params["post_id"]
+	if len(postId) != 26 {
+		c.SetInvalidParam("doPostAction", "postId")
+		return
+	}
+
+	actionId := params["action_id"]
+	if len(actionId) != 26 {
+		c.SetInvalidParam("doPostAction", "actionId")
+		return
+	}
+
+	selectedOption := ""
+	if props := model.MapFromJson(r.Body); props != nil {
+		selectedOption = props["selected_option"]
+	}
+
+	var post *model.Post
+	if result := <-Srv.Store.Post().Get(postId); result.Err != nil {
+		c.Err = result.Err
+		return
+	} else {
+		post = result.Data.(*model.PostList).Posts[postId]
+	}
+
+	if post == nil || post.DeleteAt != 0 {
+		c.Err = model.NewLocAppError("doPostAction", "api.post.do_action.post.app_error", nil, "post_id="+postId)
+		c.Err.StatusCode = http.StatusNotFound
+		return
+	}
+
+	cchan := Srv.Store.Channel().CheckPermissionsTo(c.Session.TeamId, post.ChannelId, c.Session.UserId)
+	uchan := Srv.Store.User().Get(c.Session.UserId)
+
+	if !c.HasPermissionsToChannel(cchan, "doPostAction") {
+		return
+	}
+
+	// users can't add integrations to their own posts but posts made before
+	// that was enforced may still have them
+	if post.Props["from_webhook"] != "true" {
+		c.Err = model.NewLocAppError("doPostAction", "api.post.do_action.action_id.app_error", nil, "action_id="+actionId)
+		c.Err.StatusCode = http.StatusNotFound
+		return
+	}
+
+	action := post.GetAction(actionId)
+	if action == nil || action.Integration == nil {
+		c.Err = model.NewLocAppError("doPostAction", "api.post.do_action.action_id.app_error", nil, "action_id="+actionId)
+		c.Err.StatusCode = http.StatusNotFound
+		return
+	}
+
+	if !utils.IsValidUntrustedUrl(action.Integration.URL) {
+		c.Err = model.NewLocAppError("doPostAction", "api.post.do_action.url.app_error", nil, "action_id="+actionId)
+		c.Err.StatusCode = http.StatusBadRequest
+		return
+	}
+
+	if !action.IsValidSelection(selectedOption) {
+		c.SetInvalidParam("doPostAction", "selected_option")
+		return
+	}
+
+	var user *model.User
+	if result := <-uchan; result.Err != nil {
+		c.Err = result.Err
+		return
+	} else {
+		user = result.Data.(*model.User)
+	}
+
+	request := &model.PostActionIntegrationRequest{
+		UserId:         user.Id,
+		UserName:       user.Username,
+		TeamId:         c.Session.TeamId,
+		ChannelId:      post.ChannelId,
+		PostId:         post.Id,
+		ActionId:       action.Id,
+		Type:           action.Type,
+		SelectedOption: selectedOption,
+		Context:        action.Integration.Context,
+	}
+
+	req, _ := http.NewRequest("POST", action.Integration.URL, strings.NewReader(request.ToJson()))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	client := utils.NewUntrustedHttpClient(time.Duration(*utils.Cfg.ServiceSettings.OutgoingWebhookTimeout) * time.Second)
+
+	var response *model.PostActionIntegrationResponse
+	if resp, err := client.Do(req); err != nil {
+		c.Err = model.NewLocAppError("doPostAction", "api.post.do_action.action_integration.app_error", nil, err.Error())
+		return
+	} else {
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			c.Err = model.NewLocAppError("doPostAction", "api.post.do_action.action_integration.app_error", nil, "status="+resp.Status)
+			return
+		}
+
+		// an integration doesn't have to send anything back
+		if response = model.PostActionIntegrationResponseFromJson(resp.Body); response == nil {
+			response = &model.PostActionIntegrationResponse{}
+		}
+	}
+
+	if response.Update != nil {
+		props := response.Update.Props
+		if props == nil {
+			props = post.Props
+		}
+
+		update := &model.Post{Message: response.Update.Message, Props: props}
+		update.AddProp("from_webhook", "true")
+		update.GenerateActionIds()
+
+		hashtags, _ := model.ParseHashtags(update.Message)
+
+		if result := <-Srv.Store.Post().UpdateWithProps(post, update.Message, hashtags, update.Props); result.Err != nil {
+			c.Err = result.Err
+			return
+		} else {
+			rpost := result.Data.(*model.Post)
+			searchEngine.IndexPost(rpost)
+
+			message := model.NewMessage(c.Session.TeamId, rpost.ChannelId, c.Session.UserId, model.ACTION_POST_EDITED)
+			message.Add("post", rpost.ToJson())
+
+			PublishAndForget(message)
+		}
+	}
+
+	if len(response.EphemeralText) > 0 {
+		SendEphemeralPost(
+			c.Session.TeamId,
+			c.Session.UserId,
+			&model.Post{
+				ChannelId: post.ChannelId,
+				RootId:    post.RootId,
+				Message:   response.EphemeralText,
+				CreateAt:  model.GetMillis(),
+			},
+		)
+	}
+
+	w.Write([]byte(model.MapToJson(map[string]string{"status": "OK"})))
+}
+
 func getPosts(c *Context, w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
 
@@ -939,6 +1162,7 @@ func getPosts(c *Context, w http.ResponseWriter, r *http.Request) {
 		return
 	} else {
 		list := result.Data.(*model.PostList)
+		addReactionsToPostList(list)
 
 		w.Header().Set(model.HEADER_ETAG_SERVER, etag)
 		w.Write([]byte(list.ToJson()))
@@ -973,6 +1197,7 @@ func getPostsSince(c *Context, w http.ResponseWriter, r *http.Request) {
 		return
 	} else {
 		list := result.Data.(*model.PostList)
+		addReactionsToPostList(list)
 
 		w.Write([]byte(list.ToJson()))
 	}
@@ -1015,6 +1240,8 @@ func getPost(c *Context, w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		addReactionsToPostList(list)
+
 		w.Header().Set(model.HEADER_ETAG_SERVER, list.Etag())
 		w.Write([]byte(list.ToJson()))
 	}
@@ -1050,6 +1277,8 @@ func getPostById(c *Context, w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		addReactionsToPostList(list)
+
 		w.Header().Set(model.HEADER_ETAG_SERVER, list.Etag())
 		w.Write([]byte(list.ToJson()))
 	}
@@ -1072,6 +1301,24 @@ func deletePost(c *Context, w http.ResponseWriter, r *http.Request) {
 
 	cchan := Srv.Store.Channel().CheckPermissionsTo(c.Session.TeamId, channelId, c.Session.UserId)
 	pchan := Srv.Store.Post().Get(postId)
+	chchan := Srv.Store.Channel().Get(channelId)
+
+	var channel *model.Channel
+	if result := <-chchan; result.Err != nil {
+		c.Err = result.Err
+		return
+	} else {
+		channel = result.Data.(*model.Channel)
+	}
+
+	// admins are only able to delete others' posts in the teams they manage
+	canDeleteOthers := c.HasPermission(model.PERMISSION_DELETE_OTHERS_POSTS, channel.TeamId)
+
+	if result := <-cchan; (result.Err != nil || result.Data.(int64) != 1) && !canDeleteOthers {
+		c.Err = model.NewLocAppError("deletePost", "api.post.delete_post.permissions.app_error", nil, "")
+		c.Err.StatusCode = http.StatusForbidden
+		return
+	}
 
 	if result := <-pchan; result.Err != nil {
 		c.Err = result.Err
@@ -1080,10 +1327,6 @@ func deletePost(c *Context, w http.ResponseWriter, r *http.Request) {
 
 		post := result.Data.(*model.PostList).Posts[postId]
 
-		if !c.HasPermissionsToChannel(cchan, "deletePost") && !c.IsTeamAdmin() {
-			return
-		}
-
 		if post == nil {
 			c.SetInvalidParam("deletePost", "postId")
 			return
@@ -1095,7 +1338,7 @@ func deletePost(c *Context, w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		if post.UserId != c.Session.UserId && !c.IsTeamAdmin() {
+		if post.UserId != c.Session.UserId && !canDeleteOthers {
 			c.Err = model.NewLocAppError("deletePost", "api.post.delete_post.permissions.app_error", nil, "")
 			c.Err.StatusCode = http.StatusForbidden
 			return
@@ -1106,11 +1349,13 @@ func deletePost(c *Context, w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		message := model.NewMessage(c.Session.TeamId, post.ChannelId, c.Session.UserId, model.ACTION_POST_DELETED)
+		searchEngine.DeletePost(post)
+
+		message := model.NewMessage(channel.TeamId, post.ChannelId, c.Session.UserId, model.ACTION_POST_DELETED)
 		message.Add("post", post.ToJson())
 
 		PublishAndForget(message)
-		DeletePostFilesAndForget(c.Session.TeamId, post)
+		DeletePostFilesAndForget(channel.TeamId, post)
 
 		result := make(map[string]string)
 		result["id"] = postId
@@ -1118,6 +1363,76 @@ func deletePost(c *Context, w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func getPostHistory(c *Context, w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+
+	channelId := params["id"]
+	if len(channelId) != 26 {
+		c.SetInvalidParam("getPostHistory", "channelId")
+		return
+	}
+
+	postId := params["post_id"]
+	if len(postId) != 26 {
+		c.SetInvalidParam("getPostHistory", "postId")
+		return
+	}
+
+	var post *model.Post
+	if result := <-Srv.Store.Post().Get(postId); result.Err != nil {
+		c.Err = result.Err
+		return
+	} else {
+		post = result.Data.(*model.PostList).Posts[postId]
+	}
+
+	if post == nil {
+		c.SetInvalidParam("getPostHistory", "postId")
+		return
+	}
+
+	if post.ChannelId != channelId {
+		c.Err = model.NewLocAppError("getPostHistory", "api.post.get_post_history.permissions.app_error", nil, "")
+		c.Err.StatusCode = http.StatusForbidden
+		return
+	}
+
+	// only the author and admins are allowed to see what a post used to say
+	if post.UserId == c.Session.UserId {
+		cchan := Srv.Store.Channel().CheckPermissionsTo(c.Session.TeamId, channelId, c.Session.UserId)
+		if !c.HasPermissionsToChannel(cchan, "getPostHistory") {
+			return
+		}
+	} else if result := <-Srv.Store.Channel().Get(channelId); result.Err != nil {
+		c.Err = result.Err
+		return
+	} else if !c.HasPermission(model.PERMISSION_DELETE_OTHERS_POSTS, result.Data.(*model.Channel).TeamId) {
+		// an admin of one team can't look at the history of another's posts
+		c.Err = model.NewLocAppError("getPostHistory", "api.post.get_post_history.permissions.app_error", nil, "")
+		c.Err.StatusCode = http.StatusForbidden
+		return
+	}
+
+	if result := <-Srv.Store.Post().GetEditHistory(postId); result.Err != nil {
+		c.Err = result.Err
+		return
+	} else {
+		revisions := result.Data.([]*model.Post)
+
+		list := &model.PostList{Order: make([]string, 0, len(revisions)+1)}
+		list.AddPost(post)
+		list.AddOrder(post.Id)
+
+		for _, revision := range revisions {
+			list.AddPost(revision)
+			list.AddOrder(revision.Id)
+		}
+
+		w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+		w.Write([]byte(list.ToJson()))
+	}
+}
+
 func DeletePostFilesAndForget(teamId string, post *model.Post) {
 	go func() {
 		if len(post.Filenames) == 0 {
@@ -1132,6 +1447,19 @@ func DeletePostFilesAndForget(teamId string, post *model.Post) {
 			moveFile(oldPath, newPath)
 		}
 
+		if result := <-Srv.Store.FileInfo().GetForPost(post.Id); result.Err != nil {
+			l4g.Error(utils.T("api.post.delete_post_files_and_forget.get_infos.error"), post.Id, result.Err)
+		} else {
+			for _, info := range result.Data.([]*model.FileInfo) {
+				dir, name := filepath.Split(info.Path)
+				info.Path = dir + "deleted_" + name
+				info.DeleteAt = model.GetMillis()
+
+				if result := <-Srv.Store.FileInfo().Update(info); result.Err != nil {
+					l4g.Error(utils.T("api.post.delete_post_files_and_forget.update_info.error"), info.Id, result.Err)
+				}
+			}
+		}
 	}()
 }
 
@@ -1195,6 +1523,7 @@ func getPostsBeforeOrAfter(c *Context, w http.ResponseWriter, r *http.Request, b
 		return
 	} else {
 		list := result.Data.(*model.PostList)
+		addReactionsToPostList(list)
 
 		w.Header().Set(model.HEADER_ETAG_SERVER, etag)
 		w.Write([]byte(list.ToJson()))
@@ -1209,27 +1538,375 @@ func searchPosts(c *Context, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	offset := 0
+	if value := r.FormValue("offset"); len(value) > 0 {
+		if val, err := strconv.Atoi(value); err != nil || val < 0 {
+			c.SetInvalidParam("search", "offset")
+			return
+		} else {
+			offset = val
+		}
+	}
+
+	limit := SEARCH_DEFAULT_LIMIT
+	if value := r.FormValue("limit"); len(value) > 0 {
+		if val, err := strconv.Atoi(value); err != nil || val <= 0 {
+			c.SetInvalidParam("search", "limit")
+			return
+		} else if val > SEARCH_MAX_LIMIT {
+			limit = SEARCH_MAX_LIMIT
+		} else {
+			limit = val
+		}
+	}
+
 	paramsList := model.ParseSearchParams(terms)
-	channels := []store.StoreChannel{}
 
-	for _, params := range paramsList {
-		// don't allow users to search for everything
-		if params.Terms != "*" {
-			channels = append(channels, Srv.Store.Post().Search(c.Session.TeamId, c.Session.UserId, params))
+	var posts *model.PostList
+	if list, err := searchEngine.SearchPosts(c.Session.TeamId, c.Session.UserId, paramsList, offset, limit); err != nil {
+		c.Err = err
+		return
+	} else {
+		posts = list
+	}
+
+	addReactionsToPostList(posts)
+
+	results := model.NewPostSearchResults(posts)
+	results.AddHighlights(paramsList)
+
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	w.Write([]byte(results.ToJson()))
+}
+
+func followThreadAndForget(rootId string, replierId string, replyAt int64) {
+	go func() {
+		if result := <-Srv.Store.Thread().SaveMember(&model.ThreadMember{PostId: rootId, UserId: replierId, Following: true, LastViewedAt: replyAt}); result.Err != nil {
+			l4g.Error(utils.T("api.post.follow_thread.save_member.error"), rootId, replierId, result.Err)
+		}
+
+		var root *model.Post
+		if result := <-Srv.Store.Post().Get(rootId); result.Err != nil {
+			l4g.Error(utils.T("api.post.follow_thread.get_root.error"), rootId, result.Err)
+			return
+		} else {
+			root = result.Data.(*model.PostList).Posts[rootId]
+		}
+
+		if root == nil || root.UserId == replierId {
+			return
+		}
+
+		// the author of the root post follows the thread unless they've explicitly unfollowed it
+		if result := <-Srv.Store.Thread().GetMember(rootId, root.UserId); result.Err == nil {
+			return
 		}
+
+		if result := <-Srv.Store.Thread().SaveMember(&model.ThreadMember{PostId: rootId, UserId: root.UserId, Following: true, LastViewedAt: root.CreateAt}); result.Err != nil {
+			l4g.Error(utils.T("api.post.follow_thread.save_member.error"), rootId, root.UserId, result.Err)
+		}
+	}()
+}
+
+func getThreadRoot(c *Context, where string, postId string) *model.Post {
+	var post *model.Post
+	if result := <-Srv.Store.Post().Get(postId); result.Err != nil {
+		c.Err = result.Err
+		return nil
+	} else {
+		post = result.Data.(*model.PostList).Posts[postId]
+	}
+
+	if post == nil {
+		c.SetInvalidParam(where, "postId")
+		return nil
+	}
+
+	if len(post.RootId) > 0 {
+		c.Err = model.NewLocAppError(where, "api.post.thread.not_root.app_error", nil, "id="+postId)
+		c.Err.StatusCode = http.StatusBadRequest
+		return nil
+	}
+
+	cchan := Srv.Store.Channel().CheckPermissionsTo(c.Session.TeamId, post.ChannelId, c.Session.UserId)
+	if !c.HasPermissionsToChannel(cchan, where) {
+		return nil
+	}
+
+	return post
+}
+
+func getPostThread(c *Context, w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+
+	postId := params["post_id"]
+	if len(postId) != 26 {
+		c.SetInvalidParam("getPostThread", "postId")
+		return
+	}
+
+	if root := getThreadRoot(c, "getPostThread", postId); root == nil {
+		return
+	}
+
+	if result := <-Srv.Store.Post().GetThread(postId); result.Err != nil {
+		c.Err = result.Err
+		return
+	} else {
+		list := result.Data.(*model.PostList)
+		addReactionsToPostList(list)
+
+		if tresult := <-Srv.Store.Thread().UpdateLastViewedAt(postId, c.Session.UserId); tresult.Err != nil {
+			l4g.Error(utils.T("api.post.get_post_thread.last_viewed.error"), postId, c.Session.UserId, tresult.Err)
+		}
+
+		w.Header().Set(model.HEADER_ETAG_SERVER, list.Etag())
+		w.Write([]byte(list.ToJson()))
+	}
+}
+
+func followThread(c *Context, w http.ResponseWriter, r *http.Request) {
+	setThreadFollowing(c, w, r, true)
+}
+
+func unfollowThread(c *Context, w http.ResponseWriter, r *http.Request) {
+	setThreadFollowing(c, w, r, false)
+}
+
+func setThreadFollowing(c *Context, w http.ResponseWriter, r *http.Request, following bool) {
+	params := mux.Vars(r)
+
+	postId := params["post_id"]
+	if len(postId) != 26 {
+		c.SetInvalidParam("setThreadFollowing", "postId")
+		return
+	}
+
+	if root := getThreadRoot(c, "setThreadFollowing", postId); root == nil {
+		return
+	}
+
+	member := &model.ThreadMember{PostId: postId, UserId: c.Session.UserId, Following: following, LastViewedAt: model.GetMillis()}
+
+	if result := <-Srv.Store.Thread().SaveMember(member); result.Err != nil {
+		c.Err = result.Err
+		return
+	} else {
+		w.Write([]byte(result.Data.(*model.ThreadMember).ToJson()))
+	}
+}
+
+func getFollowedThreads(c *Context, w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+
+	offset, err := strconv.Atoi(params["offset"])
+	if err != nil {
+		c.SetInvalidParam("getFollowedThreads", "offset")
+		return
+	}
+
+	limit, err := strconv.Atoi(params["limit"])
+	if err != nil || limit <= 0 || limit > 200 {
+		c.SetInvalidParam("getFollowedThreads", "limit")
+		return
+	}
+
+	if result := <-Srv.Store.Thread().GetThreadsForUser(c.Session.TeamId, c.Session.UserId, offset, limit); result.Err != nil {
+		c.Err = result.Err
+		return
+	} else {
+		w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+		w.Write([]byte(result.Data.(model.ThreadList).ToJson()))
+	}
+}
+
+func pinPost(c *Context, w http.ResponseWriter, r *http.Request) {
+	setPostPinned(c, w, r, true)
+}
+
+func unpinPost(c *Context, w http.ResponseWriter, r *http.Request) {
+	setPostPinned(c, w, r, false)
+}
+
+func setPostPinned(c *Context, w http.ResponseWriter, r *http.Request, pinned bool) {
+	params := mux.Vars(r)
+
+	channelId := params["id"]
+	if len(channelId) != 26 {
+		c.SetInvalidParam("setPostPinned", "channelId")
+		return
+	}
+
+	postId := params["post_id"]
+	if len(postId) != 26 {
+		c.SetInvalidParam("setPostPinned", "postId")
+		return
+	}
+
+	cchan := Srv.Store.Channel().CheckPermissionsTo(c.Session.TeamId, channelId, c.Session.UserId)
+	pchan := Srv.Store.Post().Get(postId)
+
+	// any member of the channel is allowed to pin or unpin its posts
+	if !c.HasPermissionsToChannel(cchan, "setPostPinned") {
+		return
+	}
+
+	var post *model.Post
+	if result := <-pchan; result.Err != nil {
+		c.Err = result.Err
+		return
+	} else {
+		post = result.Data.(*model.PostList).Posts[postId]
+	}
+
+	if post == nil {
+		c.SetInvalidParam("setPostPinned", "postId")
+		return
+	}
+
+	if post.ChannelId != channelId {
+		c.Err = model.NewLocAppError("setPostPinned", "api.post.set_post_pinned.channel.app_error", nil, "")
+		c.Err.StatusCode = http.StatusForbidden
+		return
+	}
+
+	if result := <-Srv.Store.Post().UpdatePinned(post, pinned); result.Err != nil {
+		c.Err = result.Err
+		return
+	}
+
+	action := model.ACTION_POST_PINNED
+	if !pinned {
+		action = model.ACTION_POST_UNPINNED
+	}
+
+	message := model.NewMessage(c.Session.TeamId, post.ChannelId, c.Session.UserId, action)
+	message.Add("post", post.ToJson())
+
+	PublishAndForget(message)
+
+	w.Write([]byte(post.ToJson()))
+}
+
+func getPinnedPosts(c *Context, w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+
+	channelId := params["id"]
+	if len(channelId) != 26 {
+		c.SetInvalidParam("getPinnedPosts", "channelId")
+		return
+	}
+
+	cchan := Srv.Store.Channel().CheckPermissionsTo(c.Session.TeamId, channelId, c.Session.UserId)
+	pchan := Srv.Store.Post().GetPinnedPosts(channelId)
+
+	if !c.HasPermissionsToChannel(cchan, "getPinnedPosts") {
+		return
+	}
+
+	if result := <-pchan; result.Err != nil {
+		c.Err = result.Err
+		return
+	} else {
+		list := result.Data.(*model.PostList)
+		addReactionsToPostList(list)
+
+		w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+		w.Write([]byte(list.ToJson()))
+	}
+}
+
+func flagPost(c *Context, w http.ResponseWriter, r *http.Request) {
+	setPostFlagged(c, w, r, true)
+}
+
+func unflagPost(c *Context, w http.ResponseWriter, r *http.Request) {
+	setPostFlagged(c, w, r, false)
+}
+
+func setPostFlagged(c *Context, w http.ResponseWriter, r *http.Request, flagged bool) {
+	params := mux.Vars(r)
+
+	postId := params["post_id"]
+	if len(postId) != 26 {
+		c.SetInvalidParam("setPostFlagged", "postId")
+		return
+	}
+
+	var post *model.Post
+	if result := <-Srv.Store.Post().Get(postId); result.Err != nil {
+		c.Err = result.Err
+		return
+	} else {
+		post = result.Data.(*model.PostList).Posts[postId]
 	}
 
-	posts := &model.PostList{}
-	for _, channel := range channels {
-		if result := <-channel; result.Err != nil {
+	if post == nil {
+		c.SetInvalidParam("setPostFlagged", "postId")
+		return
+	}
+
+	cchan := Srv.Store.Channel().CheckPermissionsTo(c.Session.TeamId, post.ChannelId, c.Session.UserId)
+	if !c.HasPermissionsToChannel(cchan, "setPostFlagged") {
+		return
+	}
+
+	preference := model.Preference{
+		UserId:   c.Session.UserId,
+		Category: model.PREFERENCE_CATEGORY_FLAGGED_POST,
+		Name:     postId,
+		Value:    "true",
+	}
+
+	var action string
+	if flagged {
+		if result := <-Srv.Store.Preference().Save(&model.Preferences{preference}); result.Err != nil {
 			c.Err = result.Err
 			return
-		} else {
-			data := result.Data.(*model.PostList)
-			posts.Extend(data)
 		}
+
+		action = model.ACTION_PREFERENCE_CHANGED
+	} else {
+		if result := <-Srv.Store.Preference().Delete(c.Session.UserId, model.PREFERENCE_CATEGORY_FLAGGED_POST, postId); result.Err != nil {
+			c.Err = result.Err
+			return
+		}
+
+		action = model.ACTION_PREFERENCE_DELETED
 	}
 
-	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
-	w.Write([]byte(posts.ToJson()))
+	// flagged posts are private so only the user's own sessions are told about the change
+	message := model.NewMessage(c.Session.TeamId, "", c.Session.UserId, action)
+	message.Add("preference", preference.ToJson())
+
+	PublishAndForget(message)
+
+	w.Write([]byte(preference.ToJson()))
+}
+
+func getFlaggedPosts(c *Context, w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+
+	offset, err := strconv.Atoi(params["offset"])
+	if err != nil {
+		c.SetInvalidParam("getFlaggedPosts", "offset")
+		return
+	}
+
+	limit, err := strconv.Atoi(params["limit"])
+	if err != nil || limit <= 0 || limit > 200 {
+		c.SetInvalidParam("getFlaggedPosts", "limit")
+		return
+	}
+
+	if result := <-Srv.Store.Post().GetFlaggedPosts(c.Session.TeamId, c.Session.UserId, offset, limit); result.Err != nil {
+		c.Err = result.Err
+		return
+	} else {
+		list := result.Data.(*model.PostList)
+		addReactionsToPostList(list)
+
+		w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+		w.Write([]byte(list.ToJson()))
+	}
 }
@@ -8,6 +8,9 @@ import (
 	"github.com/mattermost/platform/store"
 	"github.com/mattermost/platform/utils"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -648,6 +651,90 @@ func TestSearchPostsFromUser(t *testing.T) {
 	}
 }
 
+func TestSearchPostsWithOptions(t *testing.T) {
+	Setup()
+
+	team := &model.Team{DisplayName: "Name", Name: "z-z-" + model.NewId() + "a", Email: "test@nowhere.com", Type: model.TEAM_OPEN}
+	team = Client.Must(Client.CreateTeam(team)).Data.(*model.Team)
+
+	user1 := &model.User{TeamId: team.Id, Email: model.NewId() + "success+test@simulator.amazonses.com", Nickname: "Corey Hulen", Password: "pwd"}
+	user1 = Client.Must(Client.CreateUser(user1, "")).Data.(*model.User)
+	store.Must(Srv.Store.User().VerifyEmail(user1.Id))
+
+	Client.LoginByEmail(team.Name, user1.Email, "pwd")
+
+	channel1 := &model.Channel{DisplayName: "TestGetPosts", Name: "a" + model.NewId() + "a", Type: model.CHANNEL_OPEN, TeamId: team.Id}
+	channel1 = Client.Must(Client.CreateChannel(channel1)).Data.(*model.Channel)
+
+	post1 := &model.Post{ChannelId: channel1.Id, Message: "paging pineapple"}
+	post1 = Client.Must(Client.CreatePost(post1)).Data.(*model.Post)
+
+	post2 := &model.Post{ChannelId: channel1.Id, Message: "paging pineapple pineapple"}
+	post2 = Client.Must(Client.CreatePost(post2)).Data.(*model.Post)
+
+	post3 := &model.Post{ChannelId: channel1.Id, Message: "paging mango"}
+	post3 = Client.Must(Client.CreatePost(post3)).Data.(*model.Post)
+
+	r1 := Client.Must(Client.SearchPostsWithOptions("paging", 0, 2)).Data.(*model.PostSearchResults)
+	if len(r1.Order) != 2 || r1.Order[0] != post3.Id || r1.Order[1] != post2.Id {
+		t.Fatal("should have returned the newest page of results")
+	}
+
+	if highlights := r1.Highlights[post3.Id]; len(highlights) != 1 || highlights[0].Start != 0 || highlights[0].End != 6 {
+		t.Fatal("should have highlighted the search term")
+	}
+
+	r2 := Client.Must(Client.SearchPostsWithOptions("paging", 2, 2)).Data.(*model.PostSearchResults)
+	if len(r2.Order) != 1 || r2.Order[0] != post1.Id {
+		t.Fatal("should have returned the second page of results")
+	}
+
+	today := time.Now().UTC().Format(model.SEARCH_DATE_FORMAT)
+	if r3 := Client.Must(Client.SearchPostsWithOptions("paging on:"+today, 0, 10)).Data.(*model.PostSearchResults); len(r3.Order) != 3 {
+		t.Fatal("should have found today's posts")
+	}
+
+	if r4 := Client.Must(Client.SearchPostsWithOptions("paging before:"+today, 0, 10)).Data.(*model.PostSearchResults); len(r4.Order) != 0 {
+		t.Fatal("shouldn't have found any posts from before today")
+	}
+
+	if _, err := Client.SearchPostsWithOptions("paging", -1, 10); err == nil {
+		t.Fatal("should have failed with a negative offset")
+	}
+
+	// the index engine ranks posts by relevance instead of date
+	oldEngine := GetSearchEngine()
+	defer SetSearchEngine(oldEngine)
+
+	engine := NewIndexSearchEngine(filepath.Join(os.TempDir(), "search-"+model.NewId()))
+	defer os.RemoveAll(engine.directory)
+
+	if err := engine.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Stop()
+
+	engine.IndexPost(post1)
+	engine.IndexPost(post2)
+	engine.IndexPost(post3)
+	SetSearchEngine(engine)
+
+	r5 := Client.Must(Client.SearchPostsWithOptions("pineapple", 0, 10)).Data.(*model.PostSearchResults)
+	if len(r5.Order) != 2 || r5.Order[0] != post2.Id || r5.Order[1] != post1.Id {
+		t.Fatal("should have ranked the more relevant post first")
+	}
+
+	if highlights := r5.Highlights[post2.Id]; len(highlights) != 2 {
+		t.Fatal("should have highlighted every match")
+	}
+
+	Client.Must(Client.DeletePost(channel1.Id, post2.Id))
+
+	if r6 := Client.Must(Client.SearchPostsWithOptions("pineapple", 0, 10)).Data.(*model.PostSearchResults); len(r6.Order) != 1 || r6.Order[0] != post1.Id {
+		t.Fatal("deleted post should have been removed from the index")
+	}
+}
+
 func TestGetPostsCache(t *testing.T) {
 	Setup()
 
@@ -758,13 +845,85 @@ func TestDeletePosts(t *testing.T) {
 	Client.Must(Client.DeletePost(channel1.Id, post4.Id))
 }
 
+func TestPostThreads(t *testing.T) {
+	Setup()
+
+	team := &model.Team{DisplayName: "Name", Name: "z-z-" + model.NewId() + "a", Email: "test@nowhere.com", Type: model.TEAM_OPEN}
+	team = Client.Must(Client.CreateTeam(team)).Data.(*model.Team)
+
+	user1 := &model.User{TeamId: team.Id, Email: model.NewId() + "success+test@simulator.amazonses.com", Nickname: "Corey Hulen", Password: "pwd"}
+	user1 = Client.Must(Client.CreateUser(user1, "")).Data.(*model.User)
+	store.Must(Srv.Store.User().VerifyEmail(user1.Id))
+
+	user2 := &model.User{TeamId: team.Id, Email: model.NewId() + "success+test@simulator.amazonses.com", Nickname: "Corey Hulen", Password: "pwd"}
+	user2 = Client.Must(Client.CreateUser(user2, "")).Data.(*model.User)
+	store.Must(Srv.Store.User().VerifyEmail(user2.Id))
+
+	Client.LoginByEmail(team.Name, user1.Email, "pwd")
+
+	channel1 := &model.Channel{DisplayName: "TestThreads", Name: "a" + model.NewId() + "a", Type: model.CHANNEL_OPEN, TeamId: team.Id}
+	channel1 = Client.Must(Client.CreateChannel(channel1)).Data.(*model.Channel)
+
+	post1 := &model.Post{ChannelId: channel1.Id, Message: "a" + model.NewId() + "a"}
+	post1 = Client.Must(Client.CreatePost(post1)).Data.(*model.Post)
+
+	Client.LoginByEmail(team.Name, user2.Email, "pwd")
+	Client.Must(Client.JoinChannel(channel1.Id))
+
+	time.Sleep(10 * time.Millisecond)
+	post1a1 := &model.Post{ChannelId: channel1.Id, Message: "a" + model.NewId() + "a", RootId: post1.Id}
+	post1a1 = Client.Must(Client.CreatePost(post1a1)).Data.(*model.Post)
+
+	thread := Client.Must(Client.GetPostThread(post1.Id)).Data.(*model.PostList)
+	if len(thread.Order) != 2 || thread.Order[0] != post1a1.Id {
+		t.Fatal("should have returned the whole thread")
+	}
+
+	if thread.Posts[post1.Id].ReplyCount != 1 {
+		t.Fatal("reply count should have been incremented")
+	}
+
+	if _, err := Client.GetPostThread(post1a1.Id); err == nil {
+		t.Fatal("should have failed for a reply")
+	}
+
+	// give the follow goroutine a chance to run
+	time.Sleep(100 * time.Millisecond)
+
+	Client.LoginByEmail(team.Name, user1.Email, "pwd")
+
+	threads := Client.Must(Client.GetFollowedThreads(0, 10)).Data.(model.ThreadList)
+	if len(threads) != 1 || threads[0].Post.Id != post1.Id || !threads[0].Unread {
+		t.Fatal("author should follow the thread with unread replies")
+	}
+
+	Client.Must(Client.GetPostThread(post1.Id))
+
+	threads = Client.Must(Client.GetFollowedThreads(0, 10)).Data.(model.ThreadList)
+	if len(threads) != 1 || threads[0].Unread {
+		t.Fatal("viewing the thread should have marked it read")
+	}
+
+	Client.Must(Client.UnfollowThread(post1.Id))
+
+	if threads := Client.Must(Client.GetFollowedThreads(0, 10)).Data.(model.ThreadList); len(threads) != 0 {
+		t.Fatal("should have unfollowed the thread")
+	}
+
+	Client.Must(Client.FollowThread(post1.Id))
+
+	if threads := Client.Must(Client.GetFollowedThreads(0, 10)).Data.(model.ThreadList); len(threads) != 1 {
+		t.Fatal("should have followed the thread")
+	}
+}
+
 func TestEmailMention(t *testing.T) {
 	Setup()
 
 	team := &model.Team{DisplayName: "Name", Name: "z-z-" + model.NewId() + "a", Email: "test@nowhere.com", Type: model.TEAM_OPEN}
 	team = Client.Must(Client.CreateTeam(team)).Data.(*model.Team)
 
-	user1 := &model.User{TeamId: team.Id, Email: "success+test@simulator.amazonses.com", Nickname: "Bob Bobby", Password: "pwd"}
+	user1 := &model.User{TeamId: team.Id, Email: strings.ToLower(model.NewId()) + "success+test@simulator.amazonses.com", Nickname: "Bob Bobby", Password: "pwd"}
 	user1 = Client.Must(Client.CreateUser(user1, "")).Data.(*model.User)
 	store.Must(Srv.Store.User().VerifyEmail(user1.Id))
 
@@ -861,15 +1020,15 @@ func TestGetOutOfChannelMentions(t *testing.T) {
 	team1 := &model.Team{DisplayName: "Name", Name: "z-z-" + model.NewId() + "a", Email: strings.ToLower(model.NewId()) + "success+test@simulator.amazonses.com", Type: model.TEAM_OPEN}
 	team1 = Client.Must(Client.CreateTeam(team1)).Data.(*model.Team)
 
-	user1 := &model.User{TeamId: team1.Id, Email: strings.ToLower(model.NewId()) + "success+test@simulator.amazonses.com", Nickname: "Corey Hulen", Password: "pwd", Username: "user1"}
+	user1 := &model.User{TeamId: team1.Id, Email: strings.ToLower(model.NewId()) + "success+test@simulator.amazonses.com", Nickname: "Corey Hulen", Password: "pwd", Username: "user1" + model.NewId()}
 	user1 = Client.Must(Client.CreateUser(user1, "")).Data.(*model.User)
 	store.Must(Srv.Store.User().VerifyEmail(user1.Id))
 
-	user2 := &model.User{TeamId: team1.Id, Email: strings.ToLower(model.NewId()) + "success+test@simulator.amazonses.com", Nickname: "Corey Hulen", Password: "pwd", Username: "user2"}
+	user2 := &model.User{TeamId: team1.Id, Email: strings.ToLower(model.NewId()) + "success+test@simulator.amazonses.com", Nickname: "Corey Hulen", Password: "pwd", Username: "user2" + model.NewId()}
 	user2 = Client.Must(Client.CreateUser(user2, "")).Data.(*model.User)
 	store.Must(Srv.Store.User().VerifyEmail(user2.Id))
 
-	user3 := &model.User{TeamId: team1.Id, Email: strings.ToLower(model.NewId()) + "success+test@simulator.amazonses.com", Nickname: "Corey Hulen", Password: "pwd", Username: "user3"}
+	user3 := &model.User{TeamId: team1.Id, Email: strings.ToLower(model.NewId()) + "success+test@simulator.amazonses.com", Nickname: "Corey Hulen", Password: "pwd", Username: "user3" + model.NewId()}
 	user3 = Client.Must(Client.CreateUser(user3, "")).Data.(*model.User)
 	store.Must(Srv.Store.User().VerifyEmail(user3.Id))
 
@@ -893,25 +1052,25 @@ func TestGetOutOfChannelMentions(t *testing.T) {
 	}
 
 	// test a post that doesn't @mention anybody
-	post1 := &model.Post{ChannelId: channel1.Id, Message: "user1 user2 user3"}
+	post1 := &model.Post{ChannelId: channel1.Id, Message: user1.Username + " " + user2.Username + " " + user3.Username}
 	if mentioned := getOutOfChannelMentions(post1, allProfiles, members); len(mentioned) != 0 {
 		t.Fatalf("getOutOfChannelMentions returned %v when no users were mentioned", mentioned)
 	}
 
 	// test a post that @mentions someone in the channel
-	post2 := &model.Post{ChannelId: channel1.Id, Message: "@user1 is user1"}
+	post2 := &model.Post{ChannelId: channel1.Id, Message: "@" + user1.Username + " is " + user1.Username}
 	if mentioned := getOutOfChannelMentions(post2, allProfiles, members); len(mentioned) != 0 {
 		t.Fatalf("getOutOfChannelMentions returned %v when only users in the channel were mentioned", mentioned)
 	}
 
 	// test a post that @mentions someone not in the channel
-	post3 := &model.Post{ChannelId: channel1.Id, Message: "@user2 and @user3 aren't in the channel"}
+	post3 := &model.Post{ChannelId: channel1.Id, Message: "@" + user2.Username + " and @" + user3.Username + " aren't in the channel"}
 	if mentioned := getOutOfChannelMentions(post3, allProfiles, members); len(mentioned) != 2 || (mentioned[0].Id != user2.Id && mentioned[0].Id != user3.Id) || (mentioned[1].Id != user2.Id && mentioned[1].Id != user3.Id) {
 		t.Fatalf("getOutOfChannelMentions returned %v when two users outside the channel were mentioned", mentioned)
 	}
 
 	// test a post that @mentions someone not in the channel as well as someone in the channel
-	post4 := &model.Post{ChannelId: channel1.Id, Message: "@user2 and @user1 might be in the channel"}
+	post4 := &model.Post{ChannelId: channel1.Id, Message: "@" + user2.Username + " and @" + user1.Username + " might be in the channel"}
 	if mentioned := getOutOfChannelMentions(post4, allProfiles, members); len(mentioned) != 1 || mentioned[0].Id != user2.Id {
 		t.Fatalf("getOutOfChannelMentions returned %v when someone in the channel and someone  outside the channel were mentioned", mentioned)
 	}
@@ -921,7 +1080,7 @@ func TestGetOutOfChannelMentions(t *testing.T) {
 	team2 := &model.Team{DisplayName: "Name", Name: "z-z-" + model.NewId() + "a", Email: strings.ToLower(model.NewId()) + "success+test@simulator.amazonses.com", Type: model.TEAM_OPEN}
 	team2 = Client.Must(Client.CreateTeam(team2)).Data.(*model.Team)
 
-	user4 := &model.User{TeamId: team2.Id, Email: strings.ToLower(model.NewId()) + "success+test@simulator.amazonses.com", Nickname: "Corey Hulen", Password: "pwd", Username: "user4"}
+	user4 := &model.User{TeamId: team2.Id, Email: strings.ToLower(model.NewId()) + "success+test@simulator.amazonses.com", Nickname: "Corey Hulen", Password: "pwd", Username: "user4" + model.NewId()}
 	user4 = Client.Must(Client.CreateUser(user4, "")).Data.(*model.User)
 	store.Must(Srv.Store.User().VerifyEmail(user4.Id))
 
@@ -943,8 +1102,321 @@ func TestGetOutOfChannelMentions(t *testing.T) {
 	}
 
 	// test a post that @mentions someone on a different team
-	post5 := &model.Post{ChannelId: channel2.Id, Message: "@user2 and @user3 might be in the channel"}
+	post5 := &model.Post{ChannelId: channel2.Id, Message: "@" + user2.Username + " and @" + user3.Username + " might be in the channel"}
 	if mentioned := getOutOfChannelMentions(post5, allProfiles, members); len(mentioned) != 0 {
 		t.Fatalf("getOutOfChannelMentions returned %v when two users on a different team were mentioned", mentioned)
 	}
 }
+
+func TestPinnedAndFlaggedPosts(t *testing.T) {
+	Setup()
+
+	team := &model.Team{DisplayName: "Name", Name: "z-z-" + model.NewId() + "a", Email: "test@nowhere.com", Type: model.TEAM_OPEN}
+	team = Client.Must(Client.CreateTeam(team)).Data.(*model.Team)
+
+	user1 := &model.User{TeamId: team.Id, Email: model.NewId() + "success+test@simulator.amazonses.com", Nickname: "Corey Hulen", Password: "pwd"}
+	user1 = Client.Must(Client.CreateUser(user1, "")).Data.(*model.User)
+	store.Must(Srv.Store.User().VerifyEmail(user1.Id))
+
+	user2 := &model.User{TeamId: team.Id, Email: model.NewId() + "success+test@simulator.amazonses.com", Nickname: "Corey Hulen", Password: "pwd"}
+	user2 = Client.Must(Client.CreateUser(user2, "")).Data.(*model.User)
+	store.Must(Srv.Store.User().VerifyEmail(user2.Id))
+
+	Client.LoginByEmail(team.Name, user1.Email, "pwd")
+
+	channel1 := &model.Channel{DisplayName: "TestPinned", Name: "a" + model.NewId() + "a", Type: model.CHANNEL_OPEN, TeamId: team.Id}
+	channel1 = Client.Must(Client.CreateChannel(channel1)).Data.(*model.Channel)
+
+	post1 := &model.Post{ChannelId: channel1.Id, Message: "a" + model.NewId() + "a", IsPinned: true}
+	post1 = Client.Must(Client.CreatePost(post1)).Data.(*model.Post)
+
+	if post1.IsPinned {
+		t.Fatal("a post shouldn't be pinned when it's created")
+	}
+
+	if pinned := Client.Must(Client.GetPinnedPosts(channel1.Id)).Data.(*model.PostList); len(pinned.Order) != 0 {
+		t.Fatal("a new post shouldn't be listed as pinned")
+	}
+
+	Client.LoginByEmail(team.Name, user2.Email, "pwd")
+
+	if _, err := Client.PinPost(channel1.Id, post1.Id); err == nil {
+		t.Fatal("should have failed for a non-member")
+	}
+
+	Client.Must(Client.JoinChannel(channel1.Id))
+
+	if post := Client.Must(Client.PinPost(channel1.Id, post1.Id)).Data.(*model.Post); !post.IsPinned {
+		t.Fatal("any member should be able to pin a post")
+	}
+
+	pinned := Client.Must(Client.GetPinnedPosts(channel1.Id)).Data.(*model.PostList)
+	if len(pinned.Order) != 1 || pinned.Order[0] != post1.Id {
+		t.Fatal("should have returned the pinned post")
+	}
+
+	extra := Client.Must(Client.GetChannelExtraInfo(channel1.Id, -1, "")).Data.(*model.ChannelExtra)
+	if extra.PinnedPostCount != 1 {
+		t.Fatal("extra info should have counted the pinned post")
+	}
+
+	Client.Must(Client.UnpinPost(channel1.Id, post1.Id))
+
+	if pinned := Client.Must(Client.GetPinnedPosts(channel1.Id)).Data.(*model.PostList); len(pinned.Order) != 0 {
+		t.Fatal("post should have been unpinned")
+	}
+
+	Client.Must(Client.FlagPost(post1.Id))
+
+	flagged := Client.Must(Client.GetFlaggedPosts(0, 10)).Data.(*model.PostList)
+	if len(flagged.Order) != 1 || flagged.Order[0] != post1.Id {
+		t.Fatal("should have returned the flagged post")
+	}
+
+	Client.LoginByEmail(team.Name, user1.Email, "pwd")
+
+	if flagged := Client.Must(Client.GetFlaggedPosts(0, 10)).Data.(*model.PostList); len(flagged.Order) != 0 {
+		t.Fatal("flagged posts should be private to each user")
+	}
+
+	Client.LoginByEmail(team.Name, user2.Email, "pwd")
+
+	Client.Must(Client.UnflagPost(post1.Id))
+
+	if flagged := Client.Must(Client.GetFlaggedPosts(0, 10)).Data.(*model.PostList); len(flagged.Order) != 0 {
+		t.Fatal("post should have been unflagged")
+	}
+}
+
+func TestGetPostHistory(t *testing.T) {
+	Setup()
+
+	adminEmail := model.NewId() + "success+test@simulator.amazonses.com"
+
+	team := &model.Team{DisplayName: "Name", Name: "z-z-" + model.NewId() + "a", Email: adminEmail, Type: model.TEAM_OPEN}
+	team = Client.Must(Client.CreateTeam(team)).Data.(*model.Team)
+
+	user1 := &model.User{TeamId: team.Id, Email: model.NewId() + "success+test@simulator.amazonses.com", Nickname: "Corey Hulen", Password: "pwd"}
+	user1 = Client.Must(Client.CreateUser(user1, "")).Data.(*model.User)
+	store.Must(Srv.Store.User().VerifyEmail(user1.Id))
+
+	user2 := &model.User{TeamId: team.Id, Email: model.NewId() + "success+test@simulator.amazonses.com", Nickname: "Corey Hulen", Password: "pwd"}
+	user2 = Client.Must(Client.CreateUser(user2, "")).Data.(*model.User)
+	store.Must(Srv.Store.User().VerifyEmail(user2.Id))
+
+	admin := &model.User{TeamId: team.Id, Email: adminEmail, Nickname: "Corey Hulen", Password: "pwd"}
+	admin = Client.Must(Client.CreateUser(admin, "")).Data.(*model.User)
+	store.Must(Srv.Store.User().VerifyEmail(admin.Id))
+
+	Client.LoginByEmail(team.Name, user1.Email, "pwd")
+
+	channel1 := &model.Channel{DisplayName: "TestHistory", Name: "a" + model.NewId() + "a", Type: model.CHANNEL_OPEN, TeamId: team.Id}
+	channel1 = Client.Must(Client.CreateChannel(channel1)).Data.(*model.Channel)
+
+	post1 := &model.Post{ChannelId: channel1.Id, Message: "a" + model.NewId() + "a"}
+	post1 = Client.Must(Client.CreatePost(post1)).Data.(*model.Post)
+	originalMessage := post1.Message
+
+	time.Sleep(10 * time.Millisecond)
+
+	post1.Message = "a" + model.NewId() + "a"
+	Client.Must(Client.UpdatePost(post1))
+
+	history := Client.Must(Client.GetPostHistory(channel1.Id, post1.Id)).Data.(*model.PostList)
+	if len(history.Order) != 2 || history.Order[0] != post1.Id {
+		t.Fatal("should have returned the current post followed by its revisions")
+	}
+
+	if revision := history.Posts[history.Order[1]]; revision.Message != originalMessage || revision.OriginalId != post1.Id {
+		t.Fatal("should have kept the original message")
+	}
+
+	Client.LoginByEmail(team.Name, user2.Email, "pwd")
+	Client.Must(Client.JoinChannel(channel1.Id))
+
+	if _, err := Client.GetPostHistory(channel1.Id, post1.Id); err == nil {
+		t.Fatal("only the author and admins should see the history")
+	}
+
+	Client.LoginByEmail(team.Name, admin.Email, "pwd")
+
+	if history := Client.Must(Client.GetPostHistory(channel1.Id, post1.Id)).Data.(*model.PostList); len(history.Order) != 2 {
+		t.Fatal("team admins should see the history")
+	}
+
+	// the admin of another team who is only a member of this one
+	admin2Email := model.NewId() + "success+test@simulator.amazonses.com"
+	team2 := &model.Team{DisplayName: "Name", Name: "z-z-" + model.NewId() + "a", Email: admin2Email, Type: model.TEAM_OPEN}
+	team2 = Client.Must(Client.CreateTeam(team2)).Data.(*model.Team)
+
+	admin2 := &model.User{TeamId: team2.Id, Email: admin2Email, Nickname: "Corey Hulen", Password: "pwd"}
+	admin2 = Client.Must(Client.CreateUser(admin2, "")).Data.(*model.User)
+	store.Must(Srv.Store.User().VerifyEmail(admin2.Id))
+
+	Client.LoginByEmail(team2.Name, admin2.Email, "pwd")
+	Client.Must(Client.JoinTeam(team.Id))
+
+	if _, err := Client.GetPostHistory(channel1.Id, post1.Id); err == nil {
+		t.Fatal("should have failed, not an admin of the post's team")
+	}
+
+	if _, err := Client.DeletePost(channel1.Id, post1.Id); err == nil {
+		t.Fatal("should have failed, not an admin of the post's team")
+	}
+}
+
+func TestDoPostAction(t *testing.T) {
+	Setup()
+
+	allowedInternalConnections := *utils.Cfg.ServiceSettings.AllowedUntrustedInternalConnections
+	defer func() {
+		*utils.Cfg.ServiceSettings.AllowedUntrustedInternalConnections = allowedInternalConnections
+	}()
+	*utils.Cfg.ServiceSettings.AllowedUntrustedInternalConnections = "127.0.0.1"
+
+	team := &model.Team{DisplayName: "Name", Name: "z-z-" + model.NewId() + "a", Email: "test@nowhere.com", Type: model.TEAM_OPEN}
+	team = Client.Must(Client.CreateTeam(team)).Data.(*model.Team)
+
+	user1 := &model.User{TeamId: team.Id, Email: model.NewId() + "success+test@simulator.amazonses.com", Nickname: "Corey Hulen", Password: "pwd"}
+	user1 = Client.Must(Client.CreateUser(user1, "")).Data.(*model.User)
+	store.Must(Srv.Store.User().VerifyEmail(user1.Id))
+
+	Client.LoginByEmail(team.Name, user1.Email, "pwd")
+
+	channel1 := &model.Channel{DisplayName: "TestActions", Name: "a" + model.NewId() + "a", Type: model.CHANNEL_OPEN, TeamId: team.Id}
+	channel1 = Client.Must(Client.CreateChannel(channel1)).Data.(*model.Channel)
+
+	var request *model.PostActionIntegrationRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request = model.PostActionIntegrationRequestFromJson(r.Body)
+
+		response := &model.PostActionIntegrationResponse{
+			Update:        &model.Post{Message: "approved"},
+			EphemeralText: "thanks",
+		}
+		w.Write([]byte(response.ToJson()))
+	}))
+	defer server.Close()
+
+	attachments := func(url string) model.StringInterface {
+		return model.StringInterface{"attachments": []interface{}{
+			map[string]interface{}{
+				"text": "approve?",
+				"actions": []interface{}{
+					map[string]interface{}{
+						"name":        "Approve",
+						"integration": map[string]interface{}{"url": url, "context": map[string]interface{}{"request": "123"}},
+					},
+					map[string]interface{}{
+						"name":        "Pick",
+						"type":        model.POST_ACTION_TYPE_SELECT,
+						"options":     []interface{}{map[string]interface{}{"text": "One", "value": "1"}},
+						"integration": map[string]interface{}{"url": url},
+					},
+				},
+			},
+		}}
+	}
+
+	// actions are only followed on posts made by integrations
+	c := &Context{Session: model.Session{UserId: user1.Id, TeamId: team.Id}, RequestId: model.NewId(), T: utils.T}
+
+	post1, err := CreateWebhookPost(c, channel1.Id, "approve?", "", "", attachments(server.URL), model.POST_SLACK_ATTACHMENT)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actions := post1.GetActions()
+	if len(actions) != 2 || len(actions[0].Id) != 26 {
+		t.Fatal("action should have been given an id")
+	}
+
+	Client.Must(Client.DoPostAction(post1.Id, actions[0].Id, ""))
+
+	if request == nil || request.UserId != user1.Id || request.PostId != post1.Id || request.Context["request"] != "123" {
+		t.Fatal("integration should have been sent the action's context")
+	}
+
+	updated := Client.Must(Client.GetPost(channel1.Id, post1.Id, "")).Data.(*model.PostList).Posts[post1.Id]
+	if updated.Message != "approved" {
+		t.Fatal("post should have been updated by the integration")
+	}
+
+	if action := updated.GetAction(actions[0].Id); action == nil {
+		t.Fatal("post should have kept its actions")
+	}
+
+	if _, err := Client.DoPostAction(post1.Id, model.NewId(), ""); err == nil {
+		t.Fatal("should have failed for an unknown action")
+	}
+
+	if _, err := Client.DoPostAction(post1.Id, actions[1].Id, "2"); err == nil {
+		t.Fatal("should have failed for an option that isn't on the menu")
+	}
+
+	Client.Must(Client.DoPostAction(post1.Id, actions[1].Id, "1"))
+
+	if request.SelectedOption != "1" {
+		t.Fatal("integration should have been sent the selected option")
+	}
+
+	userPost := &model.Post{ChannelId: channel1.Id, Message: "approve?", Props: attachments(server.URL)}
+	userPost = Client.Must(Client.CreatePost(userPost)).Data.(*model.Post)
+
+	if actions := userPost.GetActions(); len(actions) != 2 || actions[0].Integration != nil {
+		t.Fatal("should have removed the integration from a user's post")
+	}
+
+	if _, err := Client.DoPostAction(userPost.Id, userPost.GetActions()[0].Id, ""); err == nil {
+		t.Fatal("should have failed for a post made by a user")
+	}
+
+	internalPost, err := CreateWebhookPost(c, channel1.Id, "approve?", "", "", attachments("http://10.0.0.1/approve"), model.POST_SLACK_ATTACHMENT)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Client.DoPostAction(internalPost.Id, internalPost.GetActions()[0].Id, ""); err == nil {
+		t.Fatal("should have failed for an integration on the internal network")
+	}
+
+	user2 := &model.User{TeamId: team.Id, Email: model.NewId() + "success+test@simulator.amazonses.com", Nickname: "Corey Hulen", Password: "pwd"}
+	user2 = Client.Must(Client.CreateUser(user2, "")).Data.(*model.User)
+	store.Must(Srv.Store.User().VerifyEmail(user2.Id))
+
+	channel2 := &model.Channel{DisplayName: "TestActions", Name: "a" + model.NewId() + "a", Type: model.CHANNEL_PRIVATE, TeamId: team.Id}
+	channel2 = Client.Must(Client.CreateChannel(channel2)).Data.(*model.Channel)
+
+	post2, err := CreateWebhookPost(c, channel2.Id, "approve?", "", "", attachments(server.URL), model.POST_SLACK_ATTACHMENT)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Client.LoginByEmail(team.Name, user2.Email, "pwd")
+
+	if _, err := Client.DoPostAction(post2.Id, post2.GetActions()[0].Id, ""); err == nil {
+		t.Fatal("should have failed for a channel the user isn't in")
+	}
+}
+
+func TestShouldSendChannelNotification(t *testing.T) {
+	if !shouldSendChannelNotification("", model.CHANNEL_NOTIFY_MENTION, true) {
+		t.Fatal("should fall back to the default level when unset")
+	}
+
+	if shouldSendChannelNotification(model.CHANNEL_NOTIFY_DEFAULT, model.CHANNEL_NOTIFY_NONE, true) {
+		t.Fatal("should fall back to the default level")
+	}
+
+	if !shouldSendChannelNotification(model.CHANNEL_NOTIFY_ALL, model.CHANNEL_NOTIFY_NONE, false) {
+		t.Fatal("should notify for every post")
+	}
+
+	if shouldSendChannelNotification(model.CHANNEL_NOTIFY_MENTION, model.CHANNEL_NOTIFY_ALL, false) {
+		t.Fatal("should only notify for mentions")
+	}
+
+	if shouldSendChannelNotification(model.CHANNEL_NOTIFY_NONE, model.CHANNEL_NOTIFY_ALL, true) {
+		t.Fatal("should never notify")
+	}
+}
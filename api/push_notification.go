@@ -0,0 +1,341 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package api
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	l4g "github.com/alecthomas/log4go"
+	"github.com/mattermost/platform/model"
+	"github.com/mattermost/platform/utils"
+	"golang.org/x/net/http2"
+)
+
+const (
+	PUSH_SEND_SUCCESS        = "success"
+	PUSH_SEND_FAILED         = "failed"
+	PUSH_SEND_RETRY          = "retry"
+	PUSH_SEND_INVALID_DEVICE = "invalid_device"
+
+	PUSH_NOTIFICATION_TIMEOUT      = 30 * time.Second
+	PUSH_NOTIFICATION_MAX_ATTEMPTS = 3
+	PUSH_NOTIFICATION_MAX_RESPONSE = 64 * 1024
+)
+
+// the delay before the first retry, doubled after every failed attempt
+var pushNotificationRetryDelay = 2 * time.Second
+
+// PushNotificationSender delivers a push notification to a single mobile
+// device. Along with any error, it reports whether the attempt should be
+// retried or whether the device is no longer registered and shouldn't be sent
+// to again.
+type PushNotificationSender interface {
+	SendPushNotification(msg *model.PushNotification) (string, *model.AppError)
+}
+
+var pushNotificationSender PushNotificationSender
+var pushNotificationSenderSettings string
+var pushNotificationSenderMutex sync.Mutex
+
+// GetPushNotificationSender returns the sender for the push notification
+// driver in the config, creating a new one whenever the settings change.
+func GetPushNotificationSender() (PushNotificationSender, *model.AppError) {
+	pushNotificationSenderMutex.Lock()
+	defer pushNotificationSenderMutex.Unlock()
+
+	settings := utils.Cfg.EmailSettings
+	key := strings.Join([]string{*settings.PushNotificationDriver, *settings.PushNotificationServer, *settings.ApplePushServer,
+		*settings.ApplePushCertificate, *settings.ApplePushKey, *settings.ApplePushTopic, *settings.AndroidPushServer, *settings.AndroidPushKey}, "\n")
+
+	if pushNotificationSender != nil && pushNotificationSenderSettings == key {
+		return pushNotificationSender, nil
+	}
+
+	sender, err := NewPushNotificationSenderFromConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	pushNotificationSender = sender
+	pushNotificationSenderSettings = key
+
+	return sender, nil
+}
+
+func NewPushNotificationSenderFromConfig() (PushNotificationSender, *model.AppError) {
+	settings := utils.Cfg.EmailSettings
+
+	if *settings.PushNotificationDriver != model.PUSH_NOTIFICATION_DRIVER_NATIVE {
+		client := &http.Client{
+			Timeout: PUSH_NOTIFICATION_TIMEOUT,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: *utils.Cfg.ServiceSettings.EnableInsecureOutgoingConnections},
+			},
+		}
+
+		return NewProxyPushNotificationSender(*settings.PushNotificationServer, client), nil
+	}
+
+	sender := &NativePushNotificationSender{}
+
+	if len(*settings.ApplePushCertificate) > 0 {
+		cert, err := tls.LoadX509KeyPair(*settings.ApplePushCertificate, *settings.ApplePushKey)
+		if err != nil {
+			return nil, model.NewLocAppError("NewPushNotificationSenderFromConfig", "api.push_notification.apple_certificate.app_error", nil, err.Error())
+		}
+
+		// APNs only accepts HTTP/2 connections
+		client := &http.Client{
+			Timeout:   PUSH_NOTIFICATION_TIMEOUT,
+			Transport: &http2.Transport{TLSClientConfig: &tls.Config{Certificates: []tls.Certificate{cert}}},
+		}
+
+		sender.Apple = NewApplePushNotificationSender(*settings.ApplePushServer, *settings.ApplePushTopic, client)
+	}
+
+	if len(*settings.AndroidPushKey) > 0 {
+		client := &http.Client{Timeout: PUSH_NOTIFICATION_TIMEOUT}
+
+		sender.Android = NewAndroidPushNotificationSender(*settings.AndroidPushServer, *settings.AndroidPushKey, client)
+	}
+
+	return sender, nil
+}
+
+// sendPushNotificationAndForget delivers the message to the session's device in the
+// background, forgetting the device if it's no longer registered.
+func sendPushNotificationAndForget(session *model.Session, msg *model.PushNotification) {
+	go func() {
+		sender, err := GetPushNotificationSender()
+		if err != nil {
+			l4g.Error(utils.T("api.post.send_notifications_and_forget.push_notification.error"), session.UserId, err)
+			return
+		}
+
+		l4g.Debug(utils.T("api.post.send_notifications_and_forget.push_notification.debug"), msg.DeviceId, msg.Message)
+
+		if status, err := deliverPushNotification(sender, msg); status == PUSH_SEND_INVALID_DEVICE {
+			l4g.Info(utils.T("api.push_notification.invalid_device.info"), session.Id, session.UserId)
+
+			if result := <-Srv.Store.Session().UpdateDeviceId(session.Id, ""); result.Err != nil {
+				l4g.Error(utils.T("api.push_notification.clear_device.error"), session.Id, result.Err)
+			}
+
+			sessionCache.Remove(session.Token)
+		} else if err != nil {
+			l4g.Error(utils.T("api.post.send_notifications_and_forget.push_notification.error"), session.UserId, err)
+		}
+	}()
+}
+
+// deliverPushNotification sends the message, retrying with a backoff when the
+// push service reports a temporary failure.
+func deliverPushNotification(sender PushNotificationSender, msg *model.PushNotification) (string, *model.AppError) {
+	delay := pushNotificationRetryDelay
+
+	for attempt := 1; ; attempt++ {
+		status, err := sender.SendPushNotification(msg)
+		if status != PUSH_SEND_RETRY || attempt >= PUSH_NOTIFICATION_MAX_ATTEMPTS {
+			return status, err
+		}
+
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// ProxyPushNotificationSender sends notifications through a Mattermost push
+// proxy server which holds the credentials for the mobile apps.
+type ProxyPushNotificationSender struct {
+	ServerURL string
+	client    *http.Client
+}
+
+func NewProxyPushNotificationSender(serverURL string, client *http.Client) *ProxyPushNotificationSender {
+	return &ProxyPushNotificationSender{ServerURL: strings.TrimRight(serverURL, "/"), client: client}
+}
+
+func (s *ProxyPushNotificationSender) SendPushNotification(msg *model.PushNotification) (string, *model.AppError) {
+	request, _ := http.NewRequest("POST", s.ServerURL+"/api/v1/send_push", strings.NewReader(msg.ToJson()))
+	request.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(request)
+	if err != nil {
+		return PUSH_SEND_RETRY, model.NewLocAppError("ProxyPushNotificationSender.SendPushNotification", "api.push_notification.proxy.app_error", nil, err.Error())
+	}
+
+	body := readPushResponse(resp)
+
+	if resp.StatusCode == http.StatusOK {
+		return PUSH_SEND_SUCCESS, nil
+	}
+
+	return statusForPushResponse(resp), model.NewLocAppError("ProxyPushNotificationSender.SendPushNotification", "api.push_notification.proxy.app_error", nil, "status="+resp.Status+", "+body)
+}
+
+// NativePushNotificationSender talks to APNs and FCM directly, picking the
+// service based on the platform of the device.
+type NativePushNotificationSender struct {
+	Apple   *ApplePushNotificationSender
+	Android *AndroidPushNotificationSender
+}
+
+func (s *NativePushNotificationSender) SendPushNotification(msg *model.PushNotification) (string, *model.AppError) {
+	if msg.Platform == model.PUSH_NOTIFY_APPLE && s.Apple != nil {
+		return s.Apple.SendPushNotification(msg)
+	} else if msg.Platform == model.PUSH_NOTIFY_ANDROID && s.Android != nil {
+		return s.Android.SendPushNotification(msg)
+	}
+
+	return PUSH_SEND_FAILED, model.NewLocAppError("NativePushNotificationSender.SendPushNotification", "api.push_notification.platform.app_error", nil, "platform="+msg.Platform)
+}
+
+// ApplePushNotificationSender uses the HTTP/2 APNs provider API, authenticating
+// with the client certificate configured on its http.Client.
+type ApplePushNotificationSender struct {
+	ServerURL string
+	Topic     string
+	client    *http.Client
+}
+
+func NewApplePushNotificationSender(serverURL string, topic string, client *http.Client) *ApplePushNotificationSender {
+	return &ApplePushNotificationSender{ServerURL: strings.TrimRight(serverURL, "/"), Topic: topic, client: client}
+}
+
+func (s *ApplePushNotificationSender) SendPushNotification(msg *model.PushNotification) (string, *model.AppError) {
+	aps := map[string]interface{}{
+		"alert": msg.Message,
+		"badge": msg.Badge,
+		"sound": "default",
+	}
+
+	if len(msg.Category) > 0 {
+		aps["category"] = msg.Category
+	}
+
+	if msg.ContentAvailable != 0 {
+		aps["content-available"] = msg.ContentAvailable
+	}
+
+	payload, _ := json.Marshal(map[string]interface{}{
+		"aps":          aps,
+		"server_id":    msg.ServerId,
+		"channel_id":   msg.ChannelId,
+		"channel_name": msg.ChannelName,
+	})
+
+	request, _ := http.NewRequest("POST", s.ServerURL+"/3/device/"+msg.DeviceId, strings.NewReader(string(payload)))
+	request.Header.Set("Content-Type", "application/json")
+	if len(s.Topic) > 0 {
+		request.Header.Set("apns-topic", s.Topic)
+	}
+
+	resp, err := s.client.Do(request)
+	if err != nil {
+		return PUSH_SEND_RETRY, model.NewLocAppError("ApplePushNotificationSender.SendPushNotification", "api.push_notification.apple.app_error", nil, err.Error())
+	}
+
+	body := readPushResponse(resp)
+
+	if resp.StatusCode == http.StatusOK {
+		return PUSH_SEND_SUCCESS, nil
+	}
+
+	var reason struct {
+		Reason string `json:"reason"`
+	}
+	json.Unmarshal([]byte(body), &reason)
+
+	status := statusForPushResponse(resp)
+	if resp.StatusCode == http.StatusGone || reason.Reason == "BadDeviceToken" || reason.Reason == "Unregistered" || reason.Reason == "DeviceTokenNotForTopic" {
+		status = PUSH_SEND_INVALID_DEVICE
+	}
+
+	return status, model.NewLocAppError("ApplePushNotificationSender.SendPushNotification", "api.push_notification.apple.app_error", nil, "status="+resp.Status+", reason="+reason.Reason)
+}
+
+// AndroidPushNotificationSender uses the FCM HTTP API, authenticating with the
+// project's server key.
+type AndroidPushNotificationSender struct {
+	ServerURL string
+	Key       string
+	client    *http.Client
+}
+
+func NewAndroidPushNotificationSender(serverURL string, key string, client *http.Client) *AndroidPushNotificationSender {
+	return &AndroidPushNotificationSender{ServerURL: serverURL, Key: key, client: client}
+}
+
+func (s *AndroidPushNotificationSender) SendPushNotification(msg *model.PushNotification) (string, *model.AppError) {
+	payload, _ := json.Marshal(map[string]interface{}{
+		"to":       msg.DeviceId,
+		"priority": "high",
+		"data": map[string]interface{}{
+			"message":      msg.Message,
+			"badge":        msg.Badge,
+			"category":     msg.Category,
+			"server_id":    msg.ServerId,
+			"channel_id":   msg.ChannelId,
+			"channel_name": msg.ChannelName,
+		},
+	})
+
+	request, _ := http.NewRequest("POST", s.ServerURL, strings.NewReader(string(payload)))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Authorization", "key="+s.Key)
+
+	resp, err := s.client.Do(request)
+	if err != nil {
+		return PUSH_SEND_RETRY, model.NewLocAppError("AndroidPushNotificationSender.SendPushNotification", "api.push_notification.android.app_error", nil, err.Error())
+	}
+
+	body := readPushResponse(resp)
+
+	if resp.StatusCode != http.StatusOK {
+		return statusForPushResponse(resp), model.NewLocAppError("AndroidPushNotificationSender.SendPushNotification", "api.push_notification.android.app_error", nil, "status="+resp.Status)
+	}
+
+	// FCM reports errors for the individual message in the body of a successful response
+	var result struct {
+		Results []struct {
+			Error string `json:"error"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal([]byte(body), &result); err != nil || len(result.Results) == 0 || len(result.Results[0].Error) == 0 {
+		return PUSH_SEND_SUCCESS, nil
+	}
+
+	status := PUSH_SEND_FAILED
+	switch result.Results[0].Error {
+	case "NotRegistered", "InvalidRegistration", "MismatchSenderId":
+		status = PUSH_SEND_INVALID_DEVICE
+	case "Unavailable", "InternalServerError":
+		status = PUSH_SEND_RETRY
+	}
+
+	return status, model.NewLocAppError("AndroidPushNotificationSender.SendPushNotification", "api.push_notification.android.app_error", nil, "error="+result.Results[0].Error)
+}
+
+func readPushResponse(resp *http.Response) string {
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, PUSH_NOTIFICATION_MAX_RESPONSE))
+	return string(body)
+}
+
+// statusForPushResponse decides whether a failed request is worth retrying.
+func statusForPushResponse(resp *http.Response) string {
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return PUSH_SEND_RETRY
+	}
+
+	return PUSH_SEND_FAILED
+}
@@ -0,0 +1,195 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package api
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattermost/platform/model"
+	"golang.org/x/net/http2"
+)
+
+func TestApplePushNotificationSender(t *testing.T) {
+	var lastPayload map[string]interface{}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 {
+			t.Error("APNs requests should use HTTP/2")
+		}
+
+		if r.Header.Get("apns-topic") != "com.mattermost.test" {
+			t.Error("should have sent the topic")
+		}
+
+		json.NewDecoder(r.Body).Decode(&lastPayload)
+
+		switch strings.TrimPrefix(r.URL.Path, "/3/device/") {
+		case "good":
+			w.WriteHeader(http.StatusOK)
+		case "bad":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"reason": "BadDeviceToken"}`))
+		case "gone":
+			w.WriteHeader(http.StatusGone)
+			w.Write([]byte(`{"reason": "Unregistered"}`))
+		case "busy":
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"reason": "ServiceUnavailable"}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"reason": "BadTopic"}`))
+		}
+	}))
+	server.TLS = &tls.Config{NextProtos: []string{"h2"}}
+	if err := http2.ConfigureServer(server.Config, &http2.Server{}); err != nil {
+		t.Fatal(err)
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	client := &http.Client{Transport: &http2.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+
+	sender := NewApplePushNotificationSender(server.URL, "com.mattermost.test", client)
+	msg := &model.PushNotification{Platform: model.PUSH_NOTIFY_APPLE, DeviceId: "good", Message: "hello", Badge: 2, ChannelId: model.NewId()}
+
+	if status, err := sender.SendPushNotification(msg); status != PUSH_SEND_SUCCESS || err != nil {
+		t.Fatal("should have sent the notification", err)
+	}
+
+	if aps, ok := lastPayload["aps"].(map[string]interface{}); !ok || aps["alert"] != "hello" || aps["badge"] != float64(2) {
+		t.Fatal("should have sent the message in the aps dictionary")
+	} else if lastPayload["channel_id"] != msg.ChannelId {
+		t.Fatal("should have sent the channel id")
+	}
+
+	for deviceId, expected := range map[string]string{
+		"bad":   PUSH_SEND_INVALID_DEVICE,
+		"gone":  PUSH_SEND_INVALID_DEVICE,
+		"busy":  PUSH_SEND_RETRY,
+		"other": PUSH_SEND_FAILED,
+	} {
+		msg.DeviceId = deviceId
+		if status, err := sender.SendPushNotification(msg); status != expected || err == nil {
+			t.Fatalf("wrong status %v for %v", status, deviceId)
+		}
+	}
+}
+
+func TestAndroidPushNotificationSender(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "key=secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var payload map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&payload)
+
+		switch payload["to"] {
+		case "good":
+			w.Write([]byte(`{"success": 1, "failure": 0, "results": [{"message_id": "1"}]}`))
+		case "bad":
+			w.Write([]byte(`{"success": 0, "failure": 1, "results": [{"error": "NotRegistered"}]}`))
+		case "busy":
+			w.Write([]byte(`{"success": 0, "failure": 1, "results": [{"error": "Unavailable"}]}`))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	sender := NewAndroidPushNotificationSender(server.URL, "secret", &http.Client{})
+	msg := &model.PushNotification{Platform: model.PUSH_NOTIFY_ANDROID, DeviceId: "good", Message: "hello"}
+
+	if status, err := sender.SendPushNotification(msg); status != PUSH_SEND_SUCCESS || err != nil {
+		t.Fatal("should have sent the notification", err)
+	}
+
+	for deviceId, expected := range map[string]string{
+		"bad":   PUSH_SEND_INVALID_DEVICE,
+		"busy":  PUSH_SEND_RETRY,
+		"other": PUSH_SEND_RETRY,
+	} {
+		msg.DeviceId = deviceId
+		if status, err := sender.SendPushNotification(msg); status != expected || err == nil {
+			t.Fatalf("wrong status %v for %v", status, deviceId)
+		}
+	}
+
+	sender.Key = "wrong"
+	msg.DeviceId = "good"
+	if status, err := sender.SendPushNotification(msg); status != PUSH_SEND_FAILED || err == nil {
+		t.Fatal("should have failed with the wrong key")
+	}
+}
+
+func TestProxyPushNotificationSender(t *testing.T) {
+	var received *model.PushNotification
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/send_push" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		received = model.PushNotificationFromJson(r.Body)
+		w.Write([]byte(`{"status": "OK"}`))
+	}))
+	defer server.Close()
+
+	sender := NewProxyPushNotificationSender(server.URL+"/", &http.Client{})
+	msg := &model.PushNotification{Platform: model.PUSH_NOTIFY_APPLE, DeviceId: "good", Message: "hello"}
+
+	if status, err := sender.SendPushNotification(msg); status != PUSH_SEND_SUCCESS || err != nil {
+		t.Fatal("should have sent the notification", err)
+	}
+
+	if received == nil || received.DeviceId != "good" || received.Message != "hello" {
+		t.Fatal("should have forwarded the notification")
+	}
+}
+
+type testPushNotificationSender struct {
+	statuses []string
+	attempts int
+}
+
+func (s *testPushNotificationSender) SendPushNotification(msg *model.PushNotification) (string, *model.AppError) {
+	status := s.statuses[s.attempts]
+	s.attempts++
+
+	if status == PUSH_SEND_SUCCESS {
+		return status, nil
+	}
+
+	return status, model.NewLocAppError("testPushNotificationSender", "api.push_notification.proxy.app_error", nil, "")
+}
+
+func TestDeliverPushNotification(t *testing.T) {
+	defer func(delay time.Duration) {
+		pushNotificationRetryDelay = delay
+	}(pushNotificationRetryDelay)
+	pushNotificationRetryDelay = time.Millisecond
+
+	sender := &testPushNotificationSender{statuses: []string{PUSH_SEND_RETRY, PUSH_SEND_SUCCESS}}
+	if status, err := deliverPushNotification(sender, &model.PushNotification{}); status != PUSH_SEND_SUCCESS || err != nil || sender.attempts != 2 {
+		t.Fatal("should have retried after a temporary failure")
+	}
+
+	sender = &testPushNotificationSender{statuses: []string{PUSH_SEND_RETRY, PUSH_SEND_RETRY, PUSH_SEND_RETRY, PUSH_SEND_SUCCESS}}
+	if status, err := deliverPushNotification(sender, &model.PushNotification{}); status != PUSH_SEND_RETRY || err == nil || sender.attempts != PUSH_NOTIFICATION_MAX_ATTEMPTS {
+		t.Fatal("should have given up after the maximum number of attempts")
+	}
+
+	sender = &testPushNotificationSender{statuses: []string{PUSH_SEND_INVALID_DEVICE, PUSH_SEND_SUCCESS}}
+	if status, _ := deliverPushNotification(sender, &model.PushNotification{}); status != PUSH_SEND_INVALID_DEVICE || sender.attempts != 1 {
+		t.Fatal("shouldn't retry an invalid device")
+	}
+}
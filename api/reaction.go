@@ -0,0 +1,196 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package api
+
+import (
+	"net/http"
+
+	l4g "github.com/alecthomas/log4go"
+	"github.com/gorilla/mux"
+	"github.com/mattermost/platform/model"
+	"github.com/mattermost/platform/store"
+	"github.com/mattermost/platform/utils"
+)
+
+func InitReaction(routers ...*mux.Router) {
+	l4g.Debug(utils.T("api.reaction.init.debug"))
+
+	for _, r := range routers {
+		sr := r.PathPrefix("/channels/{id:[A-Za-z0-9]+}/post/{post_id:[A-Za-z0-9]+}/reactions").Subrouter()
+		sr.Handle("", ApiUserRequired(listReactions)).Methods("GET")
+		sr.Handle("/save", ApiUserRequired(saveReaction)).Methods("POST")
+		sr.Handle("/delete", ApiUserRequired(deleteReaction)).Methods("POST")
+	}
+}
+
+func saveReaction(c *Context, w http.ResponseWriter, r *http.Request) {
+	changeReaction(c, w, r, true)
+}
+
+func deleteReaction(c *Context, w http.ResponseWriter, r *http.Request) {
+	changeReaction(c, w, r, false)
+}
+
+func changeReaction(c *Context, w http.ResponseWriter, r *http.Request, add bool) {
+	params := mux.Vars(r)
+
+	channelId := params["id"]
+	if len(channelId) != 26 {
+		c.SetInvalidParam("changeReaction", "channelId")
+		return
+	}
+
+	postId := params["post_id"]
+	if len(postId) != 26 {
+		c.SetInvalidParam("changeReaction", "postId")
+		return
+	}
+
+	reaction := model.ReactionFromJson(r.Body)
+	if reaction == nil {
+		c.SetInvalidParam("changeReaction", "reaction")
+		return
+	}
+
+	if len(reaction.UserId) > 0 && reaction.UserId != c.Session.UserId {
+		c.Err = model.NewLocAppError("changeReaction", "api.reaction.change_reaction.user_id.app_error", nil, "")
+		c.Err.StatusCode = http.StatusForbidden
+		return
+	}
+
+	if len(reaction.PostId) > 0 && reaction.PostId != postId {
+		c.SetInvalidParam("changeReaction", "reaction")
+		return
+	}
+
+	reaction.UserId = c.Session.UserId
+	reaction.PostId = postId
+
+	if post := getReactionPost(c, "changeReaction", channelId, postId); post == nil {
+		return
+	}
+
+	var action string
+	var rchan store.StoreChannel
+	if add {
+		action = model.ACTION_REACTION_ADDED
+		rchan = Srv.Store.Reaction().Save(reaction)
+	} else {
+		action = model.ACTION_REACTION_REMOVED
+		rchan = Srv.Store.Reaction().Delete(reaction)
+	}
+
+	if result := <-rchan; result.Err != nil {
+		if add && result.Err.Id == store.REACTION_EXISTS_ERROR {
+			// reacting twice with the same emoji is a no-op, so the reaction
+			// that's already there is sent back and nobody else is told about it
+			if existing := getExistingReaction(c, reaction); existing != nil {
+				w.Write([]byte(existing.ToJson()))
+			}
+			return
+		}
+
+		c.Err = result.Err
+		return
+	} else {
+		reaction = result.Data.(*model.Reaction)
+
+		message := model.NewMessage(c.Session.TeamId, channelId, c.Session.UserId, action)
+		message.Add("reaction", reaction.ToJson())
+
+		PublishAndForget(message)
+
+		w.Write([]byte(reaction.ToJson()))
+	}
+}
+
+func getExistingReaction(c *Context, reaction *model.Reaction) *model.Reaction {
+	if result := <-Srv.Store.Reaction().GetForPost(reaction.PostId); result.Err != nil {
+		c.Err = result.Err
+		return nil
+	} else {
+		for _, existing := range result.Data.([]*model.Reaction) {
+			if existing.UserId == reaction.UserId && existing.EmojiName == reaction.EmojiName {
+				return existing
+			}
+		}
+	}
+
+	// the reaction was removed again in the meantime
+	return reaction
+}
+
+func listReactions(c *Context, w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+
+	channelId := params["id"]
+	if len(channelId) != 26 {
+		c.SetInvalidParam("listReactions", "channelId")
+		return
+	}
+
+	postId := params["post_id"]
+	if len(postId) != 26 {
+		c.SetInvalidParam("listReactions", "postId")
+		return
+	}
+
+	if post := getReactionPost(c, "listReactions", channelId, postId); post == nil {
+		return
+	}
+
+	if result := <-Srv.Store.Reaction().GetForPost(postId); result.Err != nil {
+		c.Err = result.Err
+		return
+	} else {
+		w.Write([]byte(model.ReactionsToJson(result.Data.([]*model.Reaction))))
+	}
+}
+
+func getReactionPost(c *Context, where string, channelId string, postId string) *model.Post {
+	cchan := Srv.Store.Channel().CheckPermissionsTo(c.Session.TeamId, channelId, c.Session.UserId)
+	pchan := Srv.Store.Post().Get(postId)
+
+	if !c.HasPermissionsToChannel(cchan, where) {
+		return nil
+	}
+
+	var post *model.Post
+	if result := <-pchan; result.Err != nil {
+		c.Err = result.Err
+		return nil
+	} else {
+		post = result.Data.(*model.PostList).Posts[postId]
+	}
+
+	if post == nil || post.ChannelId != channelId {
+		c.Err = model.NewLocAppError(where, "api.reaction.post.permissions.app_error", nil, "post_id="+postId)
+		c.Err.StatusCode = http.StatusForbidden
+		return nil
+	}
+
+	return post
+}
+
+// addReactionsToPostList fills in the reactions on every post in the list
+func addReactionsToPostList(list *model.PostList) {
+	if len(list.Posts) == 0 {
+		return
+	}
+
+	postIds := make([]string, 0, len(list.Posts))
+	for id := range list.Posts {
+		postIds = append(postIds, id)
+	}
+
+	if result := <-Srv.Store.Reaction().GetForPosts(postIds); result.Err != nil {
+		l4g.Error(utils.T("api.reaction.add_reactions_to_post_list.error"), result.Err)
+	} else {
+		for _, reaction := range result.Data.([]*model.Reaction) {
+			if post, ok := list.Posts[reaction.PostId]; ok {
+				post.Reactions = append(post.Reactions, reaction)
+			}
+		}
+	}
+}
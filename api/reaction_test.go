@@ -0,0 +1,95 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package api
+
+import (
+	"testing"
+
+	"github.com/mattermost/platform/model"
+	"github.com/mattermost/platform/store"
+)
+
+func TestReactions(t *testing.T) {
+	Setup()
+
+	team := &model.Team{DisplayName: "Name", Name: "z-z-" + model.NewId() + "a", Email: "test@nowhere.com", Type: model.TEAM_OPEN}
+	team = Client.Must(Client.CreateTeam(team)).Data.(*model.Team)
+
+	user1 := &model.User{TeamId: team.Id, Email: model.NewId() + "success+test@simulator.amazonses.com", Nickname: "Corey Hulen", Password: "pwd"}
+	user1 = Client.Must(Client.CreateUser(user1, "")).Data.(*model.User)
+	store.Must(Srv.Store.User().VerifyEmail(user1.Id))
+
+	user2 := &model.User{TeamId: team.Id, Email: model.NewId() + "success+test@simulator.amazonses.com", Nickname: "Corey Hulen", Password: "pwd"}
+	user2 = Client.Must(Client.CreateUser(user2, "")).Data.(*model.User)
+	store.Must(Srv.Store.User().VerifyEmail(user2.Id))
+
+	Client.LoginByEmail(team.Name, user1.Email, "pwd")
+
+	channel1 := &model.Channel{DisplayName: "TestReactions", Name: "a" + model.NewId() + "a", Type: model.CHANNEL_OPEN, TeamId: team.Id}
+	channel1 = Client.Must(Client.CreateChannel(channel1)).Data.(*model.Channel)
+
+	channel2 := &model.Channel{DisplayName: "TestReactions", Name: "a" + model.NewId() + "a", Type: model.CHANNEL_PRIVATE, TeamId: team.Id}
+	channel2 = Client.Must(Client.CreateChannel(channel2)).Data.(*model.Channel)
+
+	post1 := &model.Post{ChannelId: channel1.Id, Message: "a" + model.NewId() + "a"}
+	post1 = Client.Must(Client.CreatePost(post1)).Data.(*model.Post)
+
+	post2 := &model.Post{ChannelId: channel2.Id, Message: "a" + model.NewId() + "a"}
+	post2 = Client.Must(Client.CreatePost(post2)).Data.(*model.Post)
+
+	reaction := &model.Reaction{PostId: post1.Id, EmojiName: "smile", CreateAt: 1000}
+	rreaction := Client.Must(Client.SaveReaction(channel1.Id, reaction)).Data.(*model.Reaction)
+	if rreaction.UserId != user1.Id {
+		t.Fatal("reaction should belong to the current user")
+	}
+
+	if rreaction.CreateAt == 1000 {
+		t.Fatal("shouldn't be able to pick when the reaction was made")
+	}
+
+	// saving the same reaction twice is allowed and returns the one already saved
+	if again := Client.Must(Client.SaveReaction(channel1.Id, reaction)).Data.(*model.Reaction); again.CreateAt != rreaction.CreateAt {
+		t.Fatal("should have returned the existing reaction")
+	}
+
+	if _, err := Client.SaveReaction(channel1.Id, &model.Reaction{PostId: post1.Id, EmojiName: "bad name"}); err == nil {
+		t.Fatal("should have failed on an invalid emoji name")
+	}
+
+	if _, err := Client.SaveReaction(channel1.Id, &model.Reaction{PostId: post1.Id, UserId: user2.Id, EmojiName: "smile"}); err == nil {
+		t.Fatal("should not be able to react as another user")
+	}
+
+	if _, err := Client.SaveReaction(channel1.Id, &model.Reaction{PostId: post2.Id, EmojiName: "smile"}); err == nil {
+		t.Fatal("should not be able to react to a post in another channel")
+	}
+
+	if reactions := Client.Must(Client.ListReactions(channel1.Id, post1.Id)).Data.([]*model.Reaction); len(reactions) != 1 {
+		t.Fatal("should have one reaction")
+	}
+
+	list := Client.Must(Client.GetPosts(channel1.Id, 0, 10, "")).Data.(*model.PostList)
+	if len(list.Posts[post1.Id].Reactions) != 1 || list.Posts[post1.Id].Reactions[0].EmojiName != "smile" {
+		t.Fatal("post list should include reactions")
+	}
+
+	Client.LoginByEmail(team.Name, user2.Email, "pwd")
+
+	if _, err := Client.SaveReaction(channel2.Id, &model.Reaction{PostId: post2.Id, EmojiName: "smile"}); err == nil {
+		t.Fatal("should not be able to react in a channel without membership")
+	}
+
+	Client.Must(Client.JoinChannel(channel1.Id))
+	Client.Must(Client.SaveReaction(channel1.Id, &model.Reaction{PostId: post1.Id, EmojiName: "smile"}))
+
+	if reactions := Client.Must(Client.ListReactions(channel1.Id, post1.Id)).Data.([]*model.Reaction); len(reactions) != 2 {
+		t.Fatal("should have two reactions")
+	}
+
+	Client.Must(Client.DeleteReaction(channel1.Id, &model.Reaction{PostId: post1.Id, EmojiName: "smile"}))
+
+	if reactions := Client.Must(Client.ListReactions(channel1.Id, post1.Id)).Data.([]*model.Reaction); len(reactions) != 1 || reactions[0].UserId != user1.Id {
+		t.Fatal("should have only removed the current user's reaction")
+	}
+}
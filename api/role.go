@@ -0,0 +1,332 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	l4g "github.com/alecthomas/log4go"
+	"github.com/gorilla/mux"
+	"github.com/mattermost/platform/model"
+	"github.com/mattermost/platform/utils"
+)
+
+const (
+	ROLE_CACHE_SIZE = 1000
+	ROLE_CACHE_SEC  = 5 * 60
+)
+
+// roleCache holds the roles made in each team keyed by the team's id. The
+// built in roles are kept under the empty team id.
+var roleCache *utils.Cache = utils.NewLru(ROLE_CACHE_SIZE)
+
+func InitRole(routers ...*mux.Router) {
+	l4g.Debug(utils.T("api.role.init.debug"))
+
+	for _, r := range routers {
+		sr := r.PathPrefix("/roles").Subrouter()
+		sr.Handle("/", ApiUserRequired(getRoles)).Methods("GET")
+		sr.Handle("/create", ApiUserRequired(createRole)).Methods("POST")
+		sr.Handle("/update", ApiUserRequired(updateRole)).Methods("POST")
+		sr.Handle("/{id:[A-Za-z0-9]+}/delete", ApiUserRequired(deleteRole)).Methods("POST")
+	}
+}
+
+// InvalidateRoleCache makes every app server in the cluster load the team's
+// roles again. The built in roles are shared by every team so changing them
+// throws away every cached role.
+func InvalidateRoleCache(teamId string) {
+	messageBus.InvalidateRoleCache(teamId)
+}
+
+func invalidateLocalRoleCache(teamId string) {
+	if len(teamId) == 0 {
+		roleCache.Purge()
+	} else {
+		roleCache.Remove(teamId)
+	}
+}
+
+func getCachedRoles(teamId string) ([]*model.Role, *model.AppError) {
+	if cached, ok := roleCache.Get(teamId); ok {
+		return cached.([]*model.Role), nil
+	}
+
+	if result := <-Srv.Store.Role().GetByTeam(teamId); result.Err != nil {
+		return nil, result.Err
+	} else {
+		roles := result.Data.([]*model.Role)
+		roleCache.AddWithExpiresInSecs(teamId, roles, ROLE_CACHE_SEC)
+		return roles, nil
+	}
+}
+
+// GetRolesForTeam returns the built in roles along with the roles made in the
+// team, keyed by their names.
+func GetRolesForTeam(teamId string) (map[string]*model.Role, *model.AppError) {
+	roles := make(map[string]*model.Role)
+
+	teamIds := []string{""}
+	if len(teamId) > 0 {
+		teamIds = append(teamIds, teamId)
+	}
+
+	for _, id := range teamIds {
+		if list, err := getCachedRoles(id); err != nil {
+			return nil, err
+		} else {
+			for _, role := range list {
+				roles[role.Name] = role
+			}
+		}
+	}
+
+	return roles, nil
+}
+
+func getRoles(c *Context, w http.ResponseWriter, r *http.Request) {
+	var roles []*model.Role
+
+	for _, teamId := range []string{"", c.Session.TeamId} {
+		if list, err := getCachedRoles(teamId); err != nil {
+			c.Err = err
+			return
+		} else {
+			roles = append(roles, list...)
+		}
+	}
+
+	w.Write([]byte(model.RolesToJson(roles)))
+}
+
+func createRole(c *Context, w http.ResponseWriter, r *http.Request) {
+	role := model.RoleFromJson(r.Body)
+	if role == nil {
+		c.SetInvalidParam("createRole", "role")
+		return
+	}
+
+	if !c.HasPermission(model.PERMISSION_MANAGE_ROLES, c.Session.TeamId) {
+		c.Err = model.NewLocAppError("createRole", "api.role.permissions.app_error", nil, "")
+		c.Err.StatusCode = http.StatusForbidden
+		return
+	}
+
+	role.Id = ""
+	role.TeamId = c.Session.TeamId
+
+	if !checkCanGrantPermissions(c, role.TeamId, role.Permissions, "createRole") {
+		return
+	}
+
+	if result := <-Srv.Store.Role().Save(role); result.Err != nil {
+		c.Err = result.Err
+		return
+	} else {
+		InvalidateRoleCache(role.TeamId)
+
+		c.LogAudit("role_id=" + role.Id + " permissions=" + role.Permissions)
+		w.Write([]byte(result.Data.(*model.Role).ToJson()))
+	}
+}
+
+// updateRole changes a role's permissions. The built in roles are shared by
+// every team so only a system admin can change them.
+func updateRole(c *Context, w http.ResponseWriter, r *http.Request) {
+	role := model.RoleFromJson(r.Body)
+	if role == nil || len(role.Id) != 26 {
+		c.SetInvalidParam("updateRole", "role")
+		return
+	}
+
+	var oldRole *model.Role
+	if result := <-Srv.Store.Role().Get(role.Id); result.Err != nil {
+		c.Err = result.Err
+		return
+	} else {
+		oldRole = result.Data.(*model.Role)
+	}
+
+	if !checkCanManageRole(c, oldRole, "updateRole") {
+		return
+	}
+
+	if oldRole.Name == model.ROLE_SYSTEM_ADMIN {
+		c.Err = model.NewLocAppError("updateRole", "api.role.update.system_admin.app_error", nil, "")
+		c.Err.StatusCode = http.StatusBadRequest
+		return
+	}
+
+	if !checkCanGrantPermissions(c, oldRole.TeamId, role.Permissions, "updateRole") {
+		return
+	}
+
+	if result := <-Srv.Store.Role().Update(role); result.Err != nil {
+		c.Err = result.Err
+		return
+	} else {
+		InvalidateRoleCache(oldRole.TeamId)
+
+		c.LogAudit("role_id=" + role.Id + " permissions=" + role.Permissions)
+		w.Write([]byte(result.Data.(*model.Role).ToJson()))
+	}
+}
+
+// deleteRole deletes a custom role and takes it away from the team members
+// that had it.
+func deleteRole(c *Context, w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	id := params["id"]
+
+	var role *model.Role
+	if result := <-Srv.Store.Role().Get(id); result.Err != nil {
+		c.Err = result.Err
+		return
+	} else {
+		role = result.Data.(*model.Role)
+	}
+
+	if len(role.TeamId) == 0 {
+		c.Err = model.NewLocAppError("deleteRole", "api.role.delete.built_in.app_error", nil, "id="+id)
+		c.Err.StatusCode = http.StatusBadRequest
+		return
+	}
+
+	if !checkCanManageRole(c, role, "deleteRole") {
+		return
+	}
+
+	if result := <-Srv.Store.Team().GetMembers(role.TeamId); result.Err != nil {
+		c.Err = result.Err
+		return
+	} else {
+		for _, member := range result.Data.([]*model.TeamMember) {
+			if !model.IsInRole(member.Roles, role.Name) {
+				continue
+			}
+
+			member.Roles = removeRoleName(member.Roles, role.Name)
+			if uresult := <-Srv.Store.Team().UpdateMember(member); uresult.Err != nil {
+				c.Err = uresult.Err
+				return
+			}
+
+			RemoveAllSessionsForUserIdFromCache(member.UserId)
+		}
+	}
+
+	if result := <-Srv.Store.Role().Delete(role.Id); result.Err != nil {
+		c.Err = result.Err
+		return
+	}
+
+	InvalidateRoleCache(role.TeamId)
+
+	c.LogAudit("role_id=" + role.Id)
+	w.Write([]byte(model.MapToJson(map[string]string{"id": role.Id})))
+}
+
+func checkCanManageRole(c *Context, role *model.Role, where string) bool {
+	if len(role.TeamId) == 0 {
+		return c.HasSystemAdminPermissions(where)
+	}
+
+	if role.TeamId != c.Session.TeamId || !c.HasPermission(model.PERMISSION_MANAGE_ROLES, role.TeamId) {
+		c.Err = model.NewLocAppError(where, "api.role.permissions.app_error", nil, "id="+role.Id)
+		c.Err.StatusCode = http.StatusForbidden
+		return false
+	}
+
+	return true
+}
+
+// checkCanGrantPermissions makes sure that the current user has every one of
+// the permissions themselves so that they can't hand out more than they have.
+func checkCanGrantPermissions(c *Context, teamId string, permissions string, where string) bool {
+	for _, permission := range strings.Fields(permissions) {
+		if !c.HasPermission(permission, teamId) {
+			c.Err = model.NewLocAppError(where, "api.role.grant_permissions.app_error", map[string]interface{}{"Permission": permission}, "user_id="+c.Session.UserId)
+			c.Err.StatusCode = http.StatusForbidden
+			return false
+		}
+	}
+
+	return true
+}
+
+// checkCanGrantRoles makes sure that the current user has every permission that
+// comes with the team's custom roles that are in roles but not in oldRoles.
+func checkCanGrantRoles(c *Context, teamId string, roles string, oldRoles string, where string) bool {
+	teamRoles, err := GetRolesForTeam(teamId)
+	if err != nil {
+		c.Err = err
+		return false
+	}
+
+	for _, name := range strings.Fields(roles) {
+		if model.IsBuiltInRole(name) || model.IsInRole(oldRoles, name) {
+			continue
+		}
+
+		if role, ok := teamRoles[name]; ok && !checkCanGrantPermissions(c, teamId, role.Permissions, where) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isValidTeamRoles checks that roles only has roles that can be given to a
+// member of the team, which are the built in user roles and the team's own
+// custom roles.
+func isValidTeamRoles(teamId string, roles string) bool {
+	builtIn := []string{}
+	custom := []string{}
+	for _, name := range strings.Fields(roles) {
+		if model.IsBuiltInRole(name) {
+			builtIn = append(builtIn, name)
+		} else {
+			custom = append(custom, name)
+		}
+	}
+
+	if !model.IsValidRoles(strings.Join(builtIn, " ")) {
+		return false
+	}
+
+	if len(custom) == 0 {
+		return true
+	}
+
+	// guests can't be given any other role
+	if model.IsInRole(roles, model.ROLE_GUEST) {
+		return false
+	}
+
+	teamRoles, err := GetRolesForTeam(teamId)
+	if err != nil {
+		l4g.Error(utils.T("api.context.has_permission.roles.error"), teamId, err)
+		return false
+	}
+
+	for _, name := range custom {
+		if role, ok := teamRoles[name]; !ok || role.TeamId != teamId {
+			return false
+		}
+	}
+
+	return true
+}
+
+func removeRoleName(roles string, name string) string {
+	remaining := []string{}
+	for _, role := range strings.Fields(roles) {
+		if role != name {
+			remaining = append(remaining, role)
+		}
+	}
+
+	return strings.Join(remaining, " ")
+}
@@ -0,0 +1,124 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package api
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mattermost/platform/model"
+	"github.com/mattermost/platform/store"
+)
+
+func TestRoles(t *testing.T) {
+	Setup()
+
+	adminEmail := strings.ToLower(model.NewId()) + "success+test@simulator.amazonses.com"
+	team := &model.Team{DisplayName: "Name", Name: "z-z-" + model.NewId() + "a", Email: adminEmail, Type: model.TEAM_OPEN}
+	team = Client.Must(Client.CreateTeam(team)).Data.(*model.Team)
+
+	user := &model.User{TeamId: team.Id, Email: adminEmail, Nickname: "Corey Hulen", Password: "pwd"}
+	user = Client.Must(Client.CreateUser(user, "")).Data.(*model.User)
+	store.Must(Srv.Store.User().VerifyEmail(user.Id))
+
+	user2 := &model.User{TeamId: team.Id, Email: strings.ToLower(model.NewId()) + "success+test@simulator.amazonses.com", Nickname: "Corey Hulen", Password: "pwd"}
+	user2 = Client.Must(Client.CreateUser(user2, "")).Data.(*model.User)
+	store.Must(Srv.Store.User().VerifyEmail(user2.Id))
+
+	Client.Must(Client.LoginByEmail(team.Name, user2.Email, "pwd"))
+
+	moderator := &model.Role{Name: "moderator", DisplayName: "Moderator", Permissions: model.PERMISSION_DELETE_OTHERS_POSTS}
+	if _, err := Client.CreateRole(moderator); err == nil {
+		t.Fatal("should have failed, no permission to manage roles")
+	}
+
+	Client.Must(Client.LoginByEmail(team.Name, user.Email, "pwd"))
+
+	if _, err := Client.CreateRole(&model.Role{Name: model.ROLE_TEAM_ADMIN}); err == nil {
+		t.Fatal("should have failed, built in role name")
+	}
+
+	if _, err := Client.CreateRole(&model.Role{Name: "manager", Permissions: model.PERMISSION_MANAGE_SYSTEM}); err == nil {
+		t.Fatal("should have failed, team roles can't manage the system")
+	}
+
+	moderator = Client.Must(Client.CreateRole(moderator)).Data.(*model.Role)
+	if moderator.TeamId != team.Id {
+		t.Fatal("should have made the role in the team")
+	}
+
+	if roles := Client.Must(Client.GetRoles()).Data.([]*model.Role); len(roles) != len(model.MakeDefaultRoles())+1 {
+		t.Fatal("should have listed the built in roles and the team's role")
+	}
+
+	channel := &model.Channel{DisplayName: "AA", Name: "a" + model.NewId() + "a", Type: model.CHANNEL_OPEN, TeamId: team.Id}
+	channel = Client.Must(Client.CreateChannel(channel)).Data.(*model.Channel)
+	post := Client.Must(Client.CreatePost(&model.Post{ChannelId: channel.Id, Message: "a" + model.NewId() + "a"})).Data.(*model.Post)
+
+	Client.Must(Client.LoginByEmail(team.Name, user2.Email, "pwd"))
+	Client.Must(Client.JoinChannel(channel.Id))
+
+	if _, err := Client.DeletePost(channel.Id, post.Id); err == nil {
+		t.Fatal("should have failed, can't delete someone else's post")
+	}
+
+	if _, err := Client.UpdateRole(&model.Role{Id: moderator.Id, Permissions: model.PERMISSION_MANAGE_TEAM}); err == nil {
+		t.Fatal("should have failed, no permission to manage roles")
+	}
+
+	Client.Must(Client.LoginByEmail(team.Name, user.Email, "pwd"))
+
+	if _, err := Client.UpdateUserRoles(map[string]string{"user_id": user2.Id, "new_roles": "missing"}); err == nil {
+		t.Fatal("should have failed, no such role")
+	}
+
+	Client.Must(Client.UpdateUserRoles(map[string]string{"user_id": user2.Id, "new_roles": moderator.Name}))
+
+	for _, role := range Client.Must(Client.GetRoles()).Data.([]*model.Role) {
+		if role.Name != model.ROLE_TEAM_USER {
+			continue
+		}
+
+		role.Permissions = model.PERMISSION_MANAGE_TEAM
+		if _, err := Client.UpdateRole(role); err == nil {
+			t.Fatal("should have failed, only system admins can change built in roles")
+		}
+	}
+
+	Client.Must(Client.LoginByEmail(team.Name, user2.Email, "pwd"))
+
+	Client.Must(Client.DeletePost(channel.Id, post.Id))
+
+	Client.Must(Client.LoginByEmail(team.Name, user.Email, "pwd"))
+
+	if _, err := Client.DeleteRole(model.NewId()); err == nil {
+		t.Fatal("should have failed, no such role")
+	}
+
+	// someone who can manage roles can't use them to give out more than they have
+	roleManager := Client.Must(Client.CreateRole(&model.Role{Name: "role_manager", Permissions: model.PERMISSION_MANAGE_ROLES})).Data.(*model.Role)
+	Client.Must(Client.UpdateUserRoles(map[string]string{"user_id": user2.Id, "new_roles": roleManager.Name}))
+
+	Client.Must(Client.LoginByEmail(team.Name, user2.Email, "pwd"))
+
+	if _, err := Client.CreateRole(&model.Role{Name: "almost_admin", Permissions: model.PERMISSION_MANAGE_ROLES + " " + model.PERMISSION_MANAGE_TEAM}); err == nil {
+		t.Fatal("should have failed, can't grant a permission the user doesn't have")
+	}
+
+	if _, err := Client.UpdateRole(&model.Role{Id: roleManager.Id, Permissions: model.PERMISSION_MANAGE_ROLES + " " + model.PERMISSION_MANAGE_TEAM}); err == nil {
+		t.Fatal("should have failed, can't grant a permission the user doesn't have")
+	}
+
+	if _, err := Client.UpdateUserRoles(map[string]string{"user_id": user2.Id, "new_roles": roleManager.Name + " " + moderator.Name}); err == nil {
+		t.Fatal("should have failed, can't give out a role with permissions the user doesn't have")
+	}
+
+	Client.Must(Client.LoginByEmail(team.Name, user.Email, "pwd"))
+
+	Client.Must(Client.DeleteRole(moderator.Id))
+
+	if member := store.Must(Srv.Store.Team().GetMember(team.Id, user2.Id)).(*model.TeamMember); model.IsInRole(member.Roles, moderator.Name) {
+		t.Fatal("should have taken the role away from the member")
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package api
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+
+	l4g "github.com/alecthomas/log4go"
+	"github.com/gorilla/mux"
+	"github.com/mattermost/platform/einterfaces"
+	"github.com/mattermost/platform/model"
+	"github.com/mattermost/platform/store"
+	"github.com/mattermost/platform/utils"
+)
+
+func InitSaml(r *mux.Router) {
+	l4g.Debug(utils.T("api.saml.init.debug"))
+
+	sr := r.PathPrefix("/saml").Subrouter()
+	sr.Handle("/metadata", AppHandlerIndependent(getSamlMetadata)).Methods("GET")
+
+	// the IdP posts its response back to the same URL that the login starts from
+	mr := Srv.Router
+	mr.Handle("/login/sso/saml", AppHandlerIndependent(loginWithSaml)).Methods("GET")
+	mr.Handle("/login/sso/saml", AppHandlerIndependent(completeSaml)).Methods("POST")
+}
+
+// ConfigureSaml loads the service provider's settings and certificates so that
+// responses from the IdP can be checked. It's run on start up and whenever the
+// config is saved.
+func ConfigureSaml() *model.AppError {
+	if samlInterface := einterfaces.GetSamlInterface(); samlInterface != nil && *utils.Cfg.SamlSettings.Enable {
+		return samlInterface.ConfigureSP()
+	}
+
+	return nil
+}
+
+func getSamlInterface(c *Context, where string) einterfaces.SamlInterface {
+	samlInterface := einterfaces.GetSamlInterface()
+	if !*utils.Cfg.SamlSettings.Enable || !utils.IsLicensed || !*utils.License.Features.SAML || samlInterface == nil {
+		c.Err = model.NewLocAppError(where, "api.saml.not_available.app_error", nil, "")
+		c.Err.StatusCode = http.StatusNotImplemented
+		return nil
+	}
+
+	return samlInterface
+}
+
+func loginWithSaml(c *Context, w http.ResponseWriter, r *http.Request) {
+	samlInterface := getSamlInterface(c, "loginWithSaml")
+	if samlInterface == nil {
+		return
+	}
+
+	teamName := r.URL.Query().Get("team")
+	if len(teamName) == 0 {
+		c.Err = model.NewLocAppError("loginWithSaml", "api.saml.login.invalid_team.app_error", nil, "team_name="+teamName)
+		c.Err.StatusCode = http.StatusBadRequest
+		return
+	}
+
+	// Make sure team exists
+	if result := <-Srv.Store.Team().GetByName(teamName); result.Err != nil {
+		c.Err = result.Err
+		return
+	}
+
+	relayProps := map[string]string{"team": teamName}
+	relayState := base64.StdEncoding.EncodeToString([]byte(model.MapToJson(relayProps)))
+
+	if request, err := samlInterface.BuildRequest(relayState); err != nil {
+		c.Err = err
+		return
+	} else {
+		http.Redirect(w, r, request.URL, http.StatusFound)
+	}
+}
+
+// completeSaml is the assertion consumer service. The IdP posts the signed
+// response here once the user has signed in with it.
+func completeSaml(c *Context, w http.ResponseWriter, r *http.Request) {
+	samlInterface := getSamlInterface(c, "completeSaml")
+	if samlInterface == nil {
+		return
+	}
+
+	encodedXML := r.FormValue("SAMLResponse")
+	if len(encodedXML) == 0 {
+		c.SetInvalidParam("completeSaml", "SAMLResponse")
+		return
+	}
+
+	relayProps := make(map[string]string)
+	if relayState := r.FormValue("RelayState"); len(relayState) > 0 {
+		if b, err := base64.StdEncoding.DecodeString(relayState); err != nil {
+			c.SetInvalidParam("completeSaml", "RelayState")
+			return
+		} else {
+			relayProps = model.MapFromJson(strings.NewReader(string(b)))
+		}
+	}
+
+	var team *model.Team
+	if result := <-Srv.Store.Team().GetByName(relayProps["team"]); result.Err != nil {
+		c.Err = result.Err
+		return
+	} else {
+		team = result.Data.(*model.Team)
+	}
+
+	samlUser, err := samlInterface.DoLogin(encodedXML)
+	if err != nil {
+		c.LogAudit("fail - invalid saml response")
+		c.Err = err
+		c.Err.StatusCode = http.StatusForbidden
+		return
+	}
+
+	LoginBySaml(c, w, r, samlUser, team)
+	if c.Err == nil {
+		http.Redirect(w, r, GetProtocol(r)+"://"+r.Host+"/"+team.Name, http.StatusFound)
+	}
+}
+
+// LoginBySaml logs in the user that the IdP vouched for, creating their account
+// the first time they sign in as long as the team allows anyone to join.
+func LoginBySaml(c *Context, w http.ResponseWriter, r *http.Request, samlUser *model.User, team *model.Team) *model.User {
+	if len(samlUser.AuthData) == 0 {
+		c.Err = model.NewLocAppError("LoginBySaml", "api.saml.login.auth_data.app_error", nil, "")
+		c.Err.StatusCode = http.StatusBadRequest
+		return nil
+	}
+
+	if result := <-Srv.Store.User().GetByAuth(samlUser.AuthData, model.USER_AUTH_SERVICE_SAML); result.Err != nil {
+		if result.Err.Id == store.MISSING_AUTH_ACCOUNT_ERROR && team.AllowOpenInvite {
+			return CreateSamlUser(c, w, r, samlUser, team)
+		}
+		c.Err = result.Err
+		return nil
+	} else {
+		user := result.Data.(*model.User)
+		if !checkUserIsTeamMember(c, user, team) {
+			return nil
+		}
+
+		Login(c, w, r, user, "")
+		return user
+	}
+}
+
+// CreateSamlUser provisions an account for someone signing in through SAML for
+// the first time. Their profile comes from the attributes in the assertion.
+func CreateSamlUser(c *Context, w http.ResponseWriter, r *http.Request, samlUser *model.User, team *model.Team) *model.User {
+	if !utils.Cfg.TeamSettings.EnableUserCreation {
+		c.Err = model.NewLocAppError("CreateSamlUser", "api.saml.create_user.disabled.app_error", nil, "")
+		c.Err.StatusCode = http.StatusNotImplemented
+		return nil
+	}
+
+	if result := <-Srv.Store.User().GetByEmail(samlUser.Email); result.Err == nil {
+		c.Err = model.NewLocAppError("CreateSamlUser", "api.user.create_oauth_user.already_attached.app_error",
+			map[string]interface{}{"Service": model.USER_AUTH_SERVICE_SAML, "DisplayName": team.DisplayName}, "email="+samlUser.Email)
+		return nil
+	}
+
+	username := samlUser.Username
+	for count := 0; IsUsernameTaken(samlUser.Username); count++ {
+		samlUser.Username = username + strconv.Itoa(count)
+	}
+
+	samlUser.TeamId = team.Id
+	samlUser.AuthService = model.USER_AUTH_SERVICE_SAML
+	samlUser.Password = ""
+	samlUser.EmailVerified = true
+
+	ruser, err := CreateUser(team, samlUser)
+	if err != nil {
+		c.Err = err
+		return nil
+	}
+
+	Login(c, w, r, ruser, "")
+	if c.Err != nil {
+		return nil
+	}
+
+	return ruser
+}
+
+func getSamlMetadata(c *Context, w http.ResponseWriter, r *http.Request) {
+	samlInterface := getSamlInterface(c, "getSamlMetadata")
+	if samlInterface == nil {
+		return
+	}
+
+	if metadata, err := samlInterface.GetMetadata(); err != nil {
+		c.Err = err
+		return
+	} else {
+		w.Header().Set("Content-Type", "application/xml")
+		w.Header().Set("Content-Disposition", "attachment; filename=\"metadata.xml\"")
+		w.Write([]byte(metadata))
+	}
+}
@@ -0,0 +1,272 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package api
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattermost/platform/einterfaces"
+	"github.com/mattermost/platform/model"
+	"github.com/mattermost/platform/store"
+	"github.com/mattermost/platform/utils"
+)
+
+// testSamlResponse stands in for the XML that an IdP posts back. The assertion
+// holds the user's attributes and is signed with the IdP's private key.
+type testSamlResponse struct {
+	XMLName   xml.Name `xml:"Response"`
+	Assertion string   `xml:"Assertion"`
+	Signature string   `xml:"Signature"`
+}
+
+// testSamlProvider is a minimal SamlInterface that trusts responses signed by
+// the certificate in SamlSettings.IdpCertificateFile.
+type testSamlProvider struct {
+	idpCert *x509.Certificate
+}
+
+func (p *testSamlProvider) ConfigureSP() *model.AppError {
+	data, err := ioutil.ReadFile(*utils.Cfg.SamlSettings.IdpCertificateFile)
+	if err != nil {
+		return model.NewLocAppError("ConfigureSP", "test", nil, err.Error())
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return model.NewLocAppError("ConfigureSP", "test", nil, "no certificate")
+	}
+
+	if p.idpCert, err = x509.ParseCertificate(block.Bytes); err != nil {
+		return model.NewLocAppError("ConfigureSP", "test", nil, err.Error())
+	}
+
+	return nil
+}
+
+func (p *testSamlProvider) BuildRequest(relayState string) (*model.SamlAuthRequest, *model.AppError) {
+	return &model.SamlAuthRequest{URL: *utils.Cfg.SamlSettings.IdpUrl + "?RelayState=" + url.QueryEscape(relayState), RelayState: relayState}, nil
+}
+
+func (p *testSamlProvider) DoLogin(encodedXML string) (*model.User, *model.AppError) {
+	data, err := base64.StdEncoding.DecodeString(encodedXML)
+	if err != nil {
+		return nil, model.NewLocAppError("DoLogin", "test", nil, err.Error())
+	}
+
+	var response testSamlResponse
+	if err := xml.Unmarshal(data, &response); err != nil {
+		return nil, model.NewLocAppError("DoLogin", "test", nil, err.Error())
+	}
+
+	signature, _ := base64.StdEncoding.DecodeString(response.Signature)
+	hashed := sha256.Sum256([]byte(response.Assertion))
+	if err := rsa.VerifyPKCS1v15(p.idpCert.PublicKey.(*rsa.PublicKey), crypto.SHA256, hashed[:], signature); err != nil {
+		return nil, model.NewLocAppError("DoLogin", "test", nil, err.Error())
+	}
+
+	settings := utils.Cfg.SamlSettings
+	attributes := model.MapFromJson(strings.NewReader(response.Assertion))
+
+	user := &model.User{
+		AuthData:  attributes[*settings.UsernameAttribute],
+		Username:  attributes[*settings.UsernameAttribute],
+		Email:     attributes[*settings.EmailAttribute],
+		FirstName: attributes[*settings.FirstNameAttribute],
+	}
+
+	return user, nil
+}
+
+func (p *testSamlProvider) GetMetadata() (string, *model.AppError) {
+	return "<EntityDescriptor/>", nil
+}
+
+func makeTestIdpCertificate(t *testing.T) (*rsa.PrivateKey, string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp.test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := ioutil.TempFile("", "idp_cert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	pem.Encode(file, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+	return key, file.Name()
+}
+
+// makeTestSamlResponse builds a response holding the attributes. It's left
+// unsigned when there's no key.
+func makeTestSamlResponse(t *testing.T, key *rsa.PrivateKey, attributes map[string]string) string {
+	response := &testSamlResponse{Assertion: model.MapToJson(attributes)}
+
+	if key != nil {
+		hashed := sha256.Sum256([]byte(response.Assertion))
+		signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		response.Signature = base64.StdEncoding.EncodeToString(signature)
+	}
+
+	data, _ := xml.Marshal(response)
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+var errTestSamlRedirect = errors.New("redirect")
+
+func TestSaml(t *testing.T) {
+	Setup()
+
+	idpKey, certFile := makeTestIdpCertificate(t)
+	defer os.Remove(certFile)
+
+	samlSettings := utils.Cfg.SamlSettings
+	isLicensed := utils.IsLicensed
+	license := utils.License
+	defer func() {
+		utils.Cfg.SamlSettings = samlSettings
+		utils.IsLicensed = isLicensed
+		utils.License = license
+		einterfaces.RegisterSamlInterface(nil)
+	}()
+
+	enable := true
+	idpUrl := "https://idp.test/sso"
+	emailAttribute := "email"
+	usernameAttribute := "username"
+	firstNameAttribute := "first_name"
+	utils.Cfg.SamlSettings.Enable = &enable
+	utils.Cfg.SamlSettings.IdpUrl = &idpUrl
+	utils.Cfg.SamlSettings.IdpCertificateFile = &certFile
+	utils.Cfg.SamlSettings.EmailAttribute = &emailAttribute
+	utils.Cfg.SamlSettings.UsernameAttribute = &usernameAttribute
+	utils.Cfg.SamlSettings.FirstNameAttribute = &firstNameAttribute
+
+	utils.IsLicensed = true
+	utils.License = &model.License{Features: &model.Features{}}
+	utils.License.Features.SetDefaults()
+
+	// refuse to follow redirects so that where they go can be checked
+	httpClient := &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return errTestSamlRedirect
+	}}
+
+	redirect := func(r *http.Response, err error) string {
+		if urlErr, ok := err.(*url.Error); err != nil && (!ok || urlErr.Err != errTestSamlRedirect) {
+			t.Fatal(err)
+		}
+
+		return r.Header.Get("Location")
+	}
+
+	if r, err := httpClient.Get(Client.Url + "/api/v1/saml/metadata"); err != nil {
+		t.Fatal(err)
+	} else if r.StatusCode == http.StatusOK {
+		t.Fatal("should have failed, saml isn't available")
+	}
+
+	einterfaces.RegisterSamlInterface(&testSamlProvider{})
+
+	missingFile := certFile + ".missing"
+	utils.Cfg.SamlSettings.IdpCertificateFile = &missingFile
+	if err := ConfigureSaml(); err == nil {
+		t.Fatal("should have failed, the IdP certificate doesn't exist")
+	}
+
+	utils.Cfg.SamlSettings.IdpCertificateFile = &certFile
+	if err := ConfigureSaml(); err != nil {
+		t.Fatal(err)
+	}
+
+	if r, err := httpClient.Get(Client.Url + "/api/v1/saml/metadata"); err != nil {
+		t.Fatal(err)
+	} else if body, _ := ioutil.ReadAll(r.Body); r.StatusCode != http.StatusOK || string(body) != "<EntityDescriptor/>" {
+		t.Fatal("should have returned the metadata")
+	}
+
+	team := &model.Team{DisplayName: "Name", Name: "z-z-" + model.NewId() + "a", Email: strings.ToLower(model.NewId()) + "success+test@simulator.amazonses.com", Type: model.TEAM_OPEN, AllowOpenInvite: true}
+	team = Client.Must(Client.CreateTeam(team)).Data.(*model.Team)
+
+	if location := redirect(httpClient.Get(Client.Url + "/login/sso/saml?team=" + team.Name)); !strings.HasPrefix(location, idpUrl) {
+		t.Fatal("should have redirected to the IdP", location)
+	}
+
+	relayState := base64.StdEncoding.EncodeToString([]byte(model.MapToJson(map[string]string{"team": team.Name})))
+	username := "saml" + strings.ToLower(model.NewId())[:10]
+	attributes := map[string]string{
+		"email":      username + "success+test@simulator.amazonses.com",
+		"username":   username,
+		"first_name": "Sam",
+	}
+
+	if location := redirect(httpClient.PostForm(Client.Url+"/login/sso/saml", url.Values{"SAMLResponse": {makeTestSamlResponse(t, nil, attributes)}, "RelayState": {relayState}})); !strings.HasPrefix(location, "/error") {
+		t.Fatal("should have failed, the response isn't signed", location)
+	}
+
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	if location := redirect(httpClient.PostForm(Client.Url+"/login/sso/saml", url.Values{"SAMLResponse": {makeTestSamlResponse(t, otherKey, attributes)}, "RelayState": {relayState}})); !strings.HasPrefix(location, "/error") {
+		t.Fatal("should have failed, not signed by the IdP", location)
+	}
+
+	if r := <-Srv.Store.User().GetByAuth(username, model.USER_AUTH_SERVICE_SAML); r.Err == nil {
+		t.Fatal("shouldn't have made a user from a response the IdP didn't sign")
+	}
+
+	for i := 0; i < 2; i++ {
+		if location := redirect(httpClient.PostForm(Client.Url+"/login/sso/saml", url.Values{"SAMLResponse": {makeTestSamlResponse(t, idpKey, attributes)}, "RelayState": {relayState}})); !strings.HasSuffix(location, "/"+team.Name) {
+			t.Fatal("should have logged in", location)
+		}
+	}
+
+	user := store.Must(Srv.Store.User().GetByAuth(username, model.USER_AUTH_SERVICE_SAML)).(*model.User)
+	if user.Email != attributes["email"] || user.FirstName != "Sam" || !user.EmailVerified || user.TeamId != team.Id {
+		t.Fatal("should have made the user from the assertion's attributes")
+	}
+
+	// an account that already has the email can't be taken over through saml
+	other := "saml" + strings.ToLower(model.NewId())[:10]
+	otherAttributes := map[string]string{"email": attributes["email"], "username": other}
+
+	if location := redirect(httpClient.PostForm(Client.Url+"/login/sso/saml", url.Values{"SAMLResponse": {makeTestSamlResponse(t, idpKey, otherAttributes)}, "RelayState": {relayState}})); !strings.HasPrefix(location, "/error") {
+		t.Fatal("should have failed, the email is already in use", location)
+	}
+
+	if r := <-Srv.Store.User().GetByAuth(other, model.USER_AUTH_SERVICE_SAML); r.Err == nil {
+		t.Fatal("shouldn't have made a second user with the same email")
+	}
+}
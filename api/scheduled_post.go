@@ -0,0 +1,274 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package api
+
+import (
+	"net/http"
+	"time"
+
+	l4g "github.com/alecthomas/log4go"
+	"github.com/gorilla/mux"
+	"github.com/mattermost/platform/model"
+	"github.com/mattermost/platform/utils"
+)
+
+const (
+	SCHEDULED_POST_POLL_INTERVAL = 15 * time.Second
+	SCHEDULED_POST_BATCH_SIZE    = 100
+	SCHEDULED_POST_CLAIM_LEASE   = 5 * time.Minute
+)
+
+var stopPostScheduler chan bool
+
+func InitScheduledPost(routers ...*mux.Router) {
+	l4g.Debug(utils.T("api.scheduled_post.init.debug"))
+
+	for _, r := range routers {
+		sr := r.PathPrefix("/scheduled_posts").Subrouter()
+		sr.Handle("/", ApiUserRequired(getScheduledPosts)).Methods("GET")
+		sr.Handle("/create", ApiUserRequired(createScheduledPost)).Methods("POST")
+		sr.Handle("/update", ApiUserRequired(updateScheduledPost)).Methods("POST")
+		sr.Handle("/{id:[A-Za-z0-9]+}/delete", ApiUserRequired(deleteScheduledPost)).Methods("POST")
+	}
+}
+
+func getScheduledPosts(c *Context, w http.ResponseWriter, r *http.Request) {
+	if result := <-Srv.Store.ScheduledPost().GetForUser(c.Session.TeamId, c.Session.UserId); result.Err != nil {
+		c.Err = result.Err
+		return
+	} else {
+		w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+		w.Write([]byte(model.ScheduledPostsToJson(result.Data.([]*model.ScheduledPost))))
+	}
+}
+
+func createScheduledPost(c *Context, w http.ResponseWriter, r *http.Request) {
+	scheduledPost := model.ScheduledPostFromJson(r.Body)
+	if scheduledPost == nil {
+		c.SetInvalidParam("createScheduledPost", "scheduled_post")
+		return
+	}
+
+	cchan := Srv.Store.Channel().CheckPermissionsTo(c.Session.TeamId, scheduledPost.ChannelId, c.Session.UserId)
+	if !c.HasPermissionsToChannel(cchan, "createScheduledPost") {
+		return
+	}
+
+	if scheduledPost.ScheduledAt <= model.GetMillis() {
+		c.SetInvalidParam("createScheduledPost", "scheduled_at")
+		return
+	}
+
+	scheduledPost.Id = ""
+	scheduledPost.UserId = c.Session.UserId
+	scheduledPost.TeamId = c.Session.TeamId
+	scheduledPost.SiteURL = c.GetSiteURL()
+
+	if len(scheduledPost.Timezone) == 0 {
+		scheduledPost.Timezone = getUserTimezone(c.Session.UserId)
+	}
+
+	if result := <-Srv.Store.ScheduledPost().Save(scheduledPost); result.Err != nil {
+		c.Err = result.Err
+		return
+	} else {
+		w.Write([]byte(result.Data.(*model.ScheduledPost).ToJson()))
+	}
+}
+
+func updateScheduledPost(c *Context, w http.ResponseWriter, r *http.Request) {
+	scheduledPost := model.ScheduledPostFromJson(r.Body)
+	if scheduledPost == nil {
+		c.SetInvalidParam("updateScheduledPost", "scheduled_post")
+		return
+	}
+
+	oldScheduledPost := getOwnScheduledPost(c, "updateScheduledPost", scheduledPost.Id)
+	if oldScheduledPost == nil {
+		return
+	}
+
+	if scheduledPost.ScheduledAt <= model.GetMillis() {
+		c.SetInvalidParam("updateScheduledPost", "scheduled_at")
+		return
+	}
+
+	// only the content and timing of a scheduled post can be changed
+	oldScheduledPost.Message = scheduledPost.Message
+	oldScheduledPost.Filenames = scheduledPost.Filenames
+	oldScheduledPost.ScheduledAt = scheduledPost.ScheduledAt
+	oldScheduledPost.Recurrence = scheduledPost.Recurrence
+
+	if len(scheduledPost.Timezone) > 0 {
+		oldScheduledPost.Timezone = scheduledPost.Timezone
+	}
+
+	if result := <-Srv.Store.ScheduledPost().Update(oldScheduledPost); result.Err != nil {
+		c.Err = result.Err
+		return
+	} else {
+		w.Write([]byte(result.Data.(*model.ScheduledPost).ToJson()))
+	}
+}
+
+func deleteScheduledPost(c *Context, w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+
+	id := params["id"]
+	if len(id) != 26 {
+		c.SetInvalidParam("deleteScheduledPost", "id")
+		return
+	}
+
+	if scheduledPost := getOwnScheduledPost(c, "deleteScheduledPost", id); scheduledPost == nil {
+		return
+	}
+
+	if result := <-Srv.Store.ScheduledPost().Delete(id); result.Err != nil {
+		c.Err = result.Err
+		return
+	}
+
+	w.Write([]byte(model.MapToJson(map[string]string{"id": id})))
+}
+
+// getUserTimezone returns the timezone the user has set along with their status,
+// or an empty string for UTC if they haven't set one.
+func getUserTimezone(userId string) string {
+	if result := <-Srv.Store.Status().Get(userId); result.Err != nil {
+		return ""
+	} else {
+		return result.Data.(*model.Status).Timezone
+	}
+}
+
+func getOwnScheduledPost(c *Context, where string, id string) *model.ScheduledPost {
+	var scheduledPost *model.ScheduledPost
+	if result := <-Srv.Store.ScheduledPost().Get(id); result.Err != nil {
+		c.Err = result.Err
+		c.Err.StatusCode = http.StatusBadRequest
+		return nil
+	} else {
+		scheduledPost = result.Data.(*model.ScheduledPost)
+	}
+
+	if scheduledPost.UserId != c.Session.UserId {
+		c.Err = model.NewLocAppError(where, "api.scheduled_post.permissions.app_error", nil, "id="+id)
+		c.Err.StatusCode = http.StatusForbidden
+		return nil
+	}
+
+	return scheduledPost
+}
+
+// StartPostScheduler starts the background job that delivers scheduled posts
+// once they become due.
+func StartPostScheduler() {
+	if stopPostScheduler != nil {
+		return
+	}
+
+	stop := make(chan bool)
+	stopPostScheduler = stop
+
+	go func() {
+		ticker := time.NewTicker(SCHEDULED_POST_POLL_INTERVAL)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				deliverDueScheduledPosts()
+			}
+		}
+	}()
+}
+
+func StopPostScheduler() {
+	if stopPostScheduler != nil {
+		close(stopPostScheduler)
+		stopPostScheduler = nil
+	}
+}
+
+func deliverDueScheduledPosts() {
+	if result := <-Srv.Store.ScheduledPost().GetDue(model.GetMillis(), SCHEDULED_POST_BATCH_SIZE); result.Err != nil {
+		l4g.Error(utils.T("api.scheduled_post.deliver.get_due.error"), result.Err)
+	} else {
+		for _, scheduledPost := range result.Data.([]*model.ScheduledPost) {
+			deliverScheduledPost(scheduledPost)
+		}
+	}
+}
+
+func deliverScheduledPost(scheduledPost *model.ScheduledPost) {
+	next := scheduledPost.NextScheduledAt(model.GetMillis())
+
+	// another server may already be delivering this post
+	leaseUntil := model.GetMillis() + int64(SCHEDULED_POST_CLAIM_LEASE/time.Millisecond)
+	if result := <-Srv.Store.ScheduledPost().Claim(scheduledPost, leaseUntil); result.Err != nil {
+		l4g.Error(utils.T("api.scheduled_post.deliver.claim.error"), scheduledPost.Id, result.Err)
+		return
+	} else if !result.Data.(bool) {
+		return
+	}
+
+	uchan := Srv.Store.User().Get(scheduledPost.UserId)
+	cchan := Srv.Store.Channel().CheckPermissionsTo(scheduledPost.TeamId, scheduledPost.ChannelId, scheduledPost.UserId)
+
+	var user *model.User
+	if result := <-uchan; result.Err != nil {
+		l4g.Error(utils.T("api.scheduled_post.deliver.user.error"), scheduledPost.Id, result.Err)
+		scheduledPostDeliveryFailed(scheduledPost, result.Err)
+		return
+	} else {
+		user = result.Data.(*model.User)
+	}
+
+	// the author has been deactivated, is a guest whose access has run out or
+	// can no longer post in the channel so the post is cancelled rather than
+	// delivered on their behalf
+	if result := <-cchan; user.DeleteAt > 0 || user.IsGuestExpired() || result.Err != nil || result.Data.(int64) != 1 {
+		l4g.Warn(utils.T("api.scheduled_post.deliver.cancelled.warn"), scheduledPost.Id, scheduledPost.UserId, scheduledPost.ChannelId)
+
+		if dresult := <-Srv.Store.ScheduledPost().Delete(scheduledPost.Id); dresult.Err != nil {
+			l4g.Error(utils.T("api.scheduled_post.deliver.delete.error"), scheduledPost.Id, dresult.Err)
+		}
+
+		return
+	}
+
+	c := &Context{
+		Session:   model.Session{UserId: user.Id, TeamId: scheduledPost.TeamId},
+		RequestId: model.NewId(),
+		siteURL:   scheduledPost.SiteURL,
+		T:         utils.TfuncWithFallback(user.Locale),
+		Locale:    user.Locale,
+	}
+
+	if _, err := CreatePost(c, scheduledPost.ToPost(), true); err != nil {
+		l4g.Error(utils.T("api.scheduled_post.deliver.create_post.error"), scheduledPost.Id, err)
+		scheduledPostDeliveryFailed(scheduledPost, err)
+		return
+	}
+
+	if result := <-Srv.Store.ScheduledPost().Delivered(scheduledPost, next); result.Err != nil {
+		l4g.Error(utils.T("api.scheduled_post.deliver.delivered.error"), scheduledPost.Id, result.Err)
+	}
+}
+
+// scheduledPostDeliveryFailed keeps a post that couldn't be delivered so that it
+// is attempted again later, waiting longer after each failure. Once it has
+// failed too many times it stays where it is with the last error so that its
+// author can fix it, rather than being retried forever.
+func scheduledPostDeliveryFailed(scheduledPost *model.ScheduledPost, err *model.AppError) {
+	retryAt := model.GetMillis() + model.GetScheduledPostRetryDelay(scheduledPost.Attempts+1)
+	if result := <-Srv.Store.ScheduledPost().DeliveryFailed(scheduledPost, retryAt, err.Error()); result.Err != nil {
+		l4g.Error(utils.T("api.scheduled_post.deliver.failed.error"), scheduledPost.Id, result.Err)
+	} else if !scheduledPost.IsRetryable() {
+		l4g.Warn(utils.T("api.scheduled_post.deliver.gave_up.warn"), scheduledPost.Id, scheduledPost.Attempts)
+	}
+}
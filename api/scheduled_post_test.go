@@ -0,0 +1,131 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package api
+
+import (
+	"testing"
+
+	"github.com/mattermost/platform/model"
+	"github.com/mattermost/platform/store"
+)
+
+func TestScheduledPosts(t *testing.T) {
+	Setup()
+
+	team := &model.Team{DisplayName: "Name", Name: "z-z-" + model.NewId() + "a", Email: "test@nowhere.com", Type: model.TEAM_OPEN}
+	team = Client.Must(Client.CreateTeam(team)).Data.(*model.Team)
+
+	user1 := &model.User{TeamId: team.Id, Email: model.NewId() + "success+test@simulator.amazonses.com", Nickname: "Corey Hulen", Password: "pwd"}
+	user1 = Client.Must(Client.CreateUser(user1, "")).Data.(*model.User)
+	store.Must(Srv.Store.User().VerifyEmail(user1.Id))
+
+	user2 := &model.User{TeamId: team.Id, Email: model.NewId() + "success+test@simulator.amazonses.com", Nickname: "Corey Hulen", Password: "pwd"}
+	user2 = Client.Must(Client.CreateUser(user2, "")).Data.(*model.User)
+	store.Must(Srv.Store.User().VerifyEmail(user2.Id))
+
+	Client.LoginByEmail(team.Name, user1.Email, "pwd")
+
+	channel1 := &model.Channel{DisplayName: "TestScheduled", Name: "a" + model.NewId() + "a", Type: model.CHANNEL_OPEN, TeamId: team.Id}
+	channel1 = Client.Must(Client.CreateChannel(channel1)).Data.(*model.Channel)
+
+	if _, err := Client.CreateScheduledPost(&model.ScheduledPost{ChannelId: channel1.Id, Message: "too late", ScheduledAt: model.GetMillis() - 1000}); err == nil {
+		t.Fatal("shouldn't be able to schedule a post in the past")
+	}
+
+	sp1 := &model.ScheduledPost{ChannelId: channel1.Id, Message: "a" + model.NewId() + "a", ScheduledAt: model.GetMillis() + 60000}
+	sp1 = Client.Must(Client.CreateScheduledPost(sp1)).Data.(*model.ScheduledPost)
+
+	if sp1.UserId != user1.Id || sp1.TeamId != team.Id {
+		t.Fatal("scheduled post should belong to the session user")
+	}
+
+	sp1.Message = "a" + model.NewId() + "a"
+	sp1.Recurrence = model.SCHEDULED_POST_RECURRENCE_DAILY
+	sp1 = Client.Must(Client.UpdateScheduledPost(sp1)).Data.(*model.ScheduledPost)
+
+	list := Client.Must(Client.GetScheduledPosts()).Data.([]*model.ScheduledPost)
+	if len(list) != 1 || list[0].Message != sp1.Message || list[0].Recurrence != model.SCHEDULED_POST_RECURRENCE_DAILY {
+		t.Fatal("should have returned the updated scheduled post")
+	}
+
+	Client.LoginByEmail(team.Name, user2.Email, "pwd")
+
+	if _, err := Client.DeleteScheduledPost(sp1.Id); err == nil {
+		t.Fatal("shouldn't be able to cancel another user's scheduled post")
+	}
+
+	if _, err := Client.CreateScheduledPost(&model.ScheduledPost{ChannelId: channel1.Id, Message: "hello", ScheduledAt: model.GetMillis() + 60000}); err == nil {
+		t.Fatal("shouldn't be able to schedule a post in a channel the user isn't in")
+	}
+
+	Client.LoginByEmail(team.Name, user1.Email, "pwd")
+
+	// pretend the post has become due and let the scheduler deliver it
+	due := store.Must(Srv.Store.ScheduledPost().Get(sp1.Id)).(*model.ScheduledPost)
+	due.ScheduledAt = model.GetMillis() - 1000
+	store.Must(Srv.Store.ScheduledPost().Update(due))
+
+	deliverScheduledPost(due)
+
+	posts := Client.Must(Client.GetPosts(channel1.Id, 0, 10, "")).Data.(*model.PostList)
+	found := false
+	for _, post := range posts.Posts {
+		if post.Message == sp1.Message && post.UserId == user1.Id {
+			found = true
+		}
+	}
+
+	if !found {
+		t.Fatal("scheduled post should have been delivered")
+	}
+
+	if rescheduled := store.Must(Srv.Store.ScheduledPost().Get(sp1.Id)).(*model.ScheduledPost); rescheduled.ScheduledAt <= model.GetMillis() || rescheduled.LastDeliveredAt == 0 {
+		t.Fatal("recurring post should have been rescheduled")
+	}
+
+	// the author leaves the channel before the next delivery
+	Client.Must(Client.LeaveChannel(channel1.Id))
+
+	due = store.Must(Srv.Store.ScheduledPost().Get(sp1.Id)).(*model.ScheduledPost)
+	due.ScheduledAt = model.GetMillis() - 1000
+	store.Must(Srv.Store.ScheduledPost().Update(due))
+
+	deliverScheduledPost(due)
+
+	if result := <-Srv.Store.ScheduledPost().Get(sp1.Id); result.Err == nil {
+		t.Fatal("scheduled post should have been cancelled")
+	}
+
+	sp2 := &model.ScheduledPost{ChannelId: channel1.Id, Message: "a" + model.NewId() + "a", ScheduledAt: model.GetMillis() + 60000}
+	if _, err := Client.CreateScheduledPost(sp2); err == nil {
+		t.Fatal("shouldn't be able to schedule a post after leaving the channel")
+	}
+
+	Client.Must(Client.JoinChannel(channel1.Id))
+	sp2 = Client.Must(Client.CreateScheduledPost(sp2)).Data.(*model.ScheduledPost)
+
+	Client.Must(Client.DeleteScheduledPost(sp2.Id))
+
+	if list := Client.Must(Client.GetScheduledPosts()).Data.([]*model.ScheduledPost); len(list) != 0 {
+		t.Fatal("scheduled post should have been cancelled")
+	}
+
+	sp3 := &model.ScheduledPost{ChannelId: channel1.Id, Message: "a" + model.NewId() + "a", ScheduledAt: model.GetMillis() + 60000}
+	sp3 = Client.Must(Client.CreateScheduledPost(sp3)).Data.(*model.ScheduledPost)
+
+	// the author becomes a guest whose access runs out before the post is due
+	user1.Roles = model.ROLE_GUEST
+	store.Must(Srv.Store.User().Update(user1, true))
+	store.Must(Srv.Store.User().UpdateGuestExpiresAt(user1.Id, model.GetMillis()-1000))
+
+	due = store.Must(Srv.Store.ScheduledPost().Get(sp3.Id)).(*model.ScheduledPost)
+	due.ScheduledAt = model.GetMillis() - 1000
+	store.Must(Srv.Store.ScheduledPost().Update(due))
+
+	deliverScheduledPost(due)
+
+	if result := <-Srv.Store.ScheduledPost().Get(sp3.Id); result.Err == nil {
+		t.Fatal("scheduled post should have been cancelled since the guest has expired")
+	}
+}
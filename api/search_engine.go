@@ -0,0 +1,140 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package api
+
+import (
+	"sort"
+
+	l4g "github.com/alecthomas/log4go"
+	"github.com/mattermost/platform/model"
+	"github.com/mattermost/platform/store"
+	"github.com/mattermost/platform/utils"
+)
+
+const (
+	SEARCH_DEFAULT_LIMIT = 100
+	SEARCH_MAX_LIMIT     = 200
+)
+
+// SearchEngine finds the posts matching a user's search. Implementations are
+// told about every post that is saved, edited or deleted so they can keep an
+// index up to date.
+type SearchEngine interface {
+	Start() *model.AppError
+	Stop()
+	IndexPost(post *model.Post)
+	DeletePost(post *model.Post)
+	SearchPosts(teamId string, userId string, paramsList []*model.SearchParams, offset int, limit int) (*model.PostList, *model.AppError)
+}
+
+var searchEngine SearchEngine = NewSqlSearchEngine()
+
+func GetSearchEngine() SearchEngine {
+	return searchEngine
+}
+
+func SetSearchEngine(engine SearchEngine) {
+	searchEngine = engine
+}
+
+func NewSearchEngineFromConfig() SearchEngine {
+	if *utils.Cfg.SearchSettings.Engine == model.SEARCH_ENGINE_INDEX {
+		return NewIndexSearchEngine(*utils.Cfg.SearchSettings.IndexDirectory)
+	}
+
+	return NewSqlSearchEngine()
+}
+
+// InitSearchEngine starts the configured search engine, falling back to
+// searching the database if it can't be started.
+func InitSearchEngine() {
+	searchEngine.Stop()
+
+	searchEngine = NewSearchEngineFromConfig()
+	if err := searchEngine.Start(); err != nil {
+		l4g.Error(utils.T("api.search_engine.init.fallback.error"), err.Error())
+
+		searchEngine = NewSqlSearchEngine()
+		searchEngine.Start()
+	}
+}
+
+// SqlSearchEngine uses the database's own full text search. It doesn't rank
+// results so they are returned newest first.
+type SqlSearchEngine struct{}
+
+func NewSqlSearchEngine() *SqlSearchEngine {
+	return &SqlSearchEngine{}
+}
+
+func (e *SqlSearchEngine) Start() *model.AppError {
+	return nil
+}
+
+func (e *SqlSearchEngine) Stop() {
+}
+
+func (e *SqlSearchEngine) IndexPost(post *model.Post) {
+}
+
+func (e *SqlSearchEngine) DeletePost(post *model.Post) {
+}
+
+func (e *SqlSearchEngine) SearchPosts(teamId string, userId string, paramsList []*model.SearchParams, offset int, limit int) (*model.PostList, *model.AppError) {
+	channels := []store.StoreChannel{}
+
+	for _, params := range paramsList {
+		// don't allow users to search for everything
+		if params.Terms != "*" {
+			// every page before this one is needed to merge the results of each search correctly
+			channels = append(channels, Srv.Store.Post().Search(teamId, userId, params, 0, offset+limit))
+		}
+	}
+
+	posts := &model.PostList{}
+	posts.MakeNonNil()
+
+	for _, channel := range channels {
+		if result := <-channel; result.Err != nil {
+			return nil, result.Err
+		} else {
+			data := result.Data.(*model.PostList)
+			for _, id := range data.Order {
+				if _, ok := posts.Posts[id]; !ok {
+					posts.AddPost(data.Posts[id])
+					posts.AddOrder(id)
+				}
+			}
+		}
+	}
+
+	if len(channels) > 1 {
+		sort.Sort(postsByNewest{posts})
+	}
+
+	return getPostListPage(posts, offset, limit), nil
+}
+
+type postsByNewest struct {
+	*model.PostList
+}
+
+func (o postsByNewest) Len() int      { return len(o.Order) }
+func (o postsByNewest) Swap(i, j int) { o.Order[i], o.Order[j] = o.Order[j], o.Order[i] }
+func (o postsByNewest) Less(i, j int) bool {
+	return o.Posts[o.Order[i]].CreateAt > o.Posts[o.Order[j]].CreateAt
+}
+
+func getPostListPage(list *model.PostList, offset int, limit int) *model.PostList {
+	page := &model.PostList{}
+	page.MakeNonNil()
+
+	for i := offset; i < len(list.Order) && i < offset+limit; i++ {
+		id := list.Order[i]
+		page.AddPost(list.Posts[id])
+		page.AddOrder(id)
+	}
+
+	return page
+}
@@ -0,0 +1,755 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	l4g "github.com/alecthomas/log4go"
+	"github.com/mattermost/platform/model"
+	"github.com/mattermost/platform/utils"
+)
+
+const (
+	SEARCH_INDEX_JOURNAL_FILE  = "posts.journal"
+	SEARCH_INDEX_BACKFILL_FILE = "backfill.done"
+	SEARCH_INDEX_BACKFILL_SIZE = 1000
+
+	// the journal is rewritten once it has this many entries and more than
+	// twice as many as there are indexed posts
+	SEARCH_INDEX_COMPACT_MIN_ENTRIES = 10000
+
+	SEARCH_INDEX_OP_INDEX  = "index"
+	SEARCH_INDEX_OP_DELETE = "delete"
+)
+
+// IndexSearchEngine keeps an inverted index of every post in memory and ranks
+// results by how relevant they are to the search terms. Changes are appended to
+// a journal on disk so the index doesn't need to be rebuilt from the database
+// every time the server starts. Each server keeps its own index and only sees
+// the changes made through it, so the config doesn't allow it to be used when
+// clustering is enabled.
+type IndexSearchEngine struct {
+	directory string
+
+	lock           sync.RWMutex
+	index          *postIndex
+	journal        *os.File
+	journalEntries int
+
+	// ids of posts deleted while the index is being backfilled so that the
+	// backfill doesn't add them back
+	backfilling bool
+	removed     map[string]bool
+	stop        chan bool
+}
+
+func NewIndexSearchEngine(directory string) *IndexSearchEngine {
+	return &IndexSearchEngine{
+		directory: directory,
+		index:     newPostIndex(),
+	}
+}
+
+func (e *IndexSearchEngine) journalPath() string {
+	return filepath.Join(e.directory, SEARCH_INDEX_JOURNAL_FILE)
+}
+
+func (e *IndexSearchEngine) backfillPath() string {
+	return filepath.Join(e.directory, SEARCH_INDEX_BACKFILL_FILE)
+}
+
+func (e *IndexSearchEngine) Start() *model.AppError {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if err := os.MkdirAll(e.directory, 0700); err != nil {
+		return model.NewLocAppError("IndexSearchEngine.Start", "api.search_index.start.directory.app_error", nil, err.Error())
+	}
+
+	if err := e.index.load(e.journalPath()); err != nil {
+		return model.NewLocAppError("IndexSearchEngine.Start", "api.search_index.start.load.app_error", nil, err.Error())
+	}
+
+	if err := e.compactJournal(); err != nil {
+		return err
+	}
+
+	e.stop = make(chan bool)
+
+	if _, err := os.Stat(e.backfillPath()); os.IsNotExist(err) {
+		e.backfilling = true
+		e.removed = make(map[string]bool)
+
+		go e.backfill(e.stop)
+	}
+
+	return nil
+}
+
+func (e *IndexSearchEngine) Stop() {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if e.stop != nil {
+		close(e.stop)
+		e.stop = nil
+	}
+
+	if e.journal != nil {
+		e.journal.Close()
+		e.journal = nil
+	}
+}
+
+// compactJournal rewrites the journal so that it only contains the posts that
+// are still indexed.
+func (e *IndexSearchEngine) compactJournal() *model.AppError {
+	if e.journal != nil {
+		e.journal.Close()
+		e.journal = nil
+	}
+
+	if err := e.index.save(e.journalPath()); err != nil {
+		return model.NewLocAppError("IndexSearchEngine.compactJournal", "api.search_index.compact.save.app_error", nil, err.Error())
+	}
+
+	if journal, err := os.OpenFile(e.journalPath(), os.O_WRONLY|os.O_APPEND, 0600); err != nil {
+		return model.NewLocAppError("IndexSearchEngine.compactJournal", "api.search_index.compact.open.app_error", nil, err.Error())
+	} else {
+		e.journal = journal
+		e.journalEntries = len(e.index.posts)
+	}
+
+	return nil
+}
+
+// backfill adds every existing post to the index, oldest first.
+func (e *IndexSearchEngine) backfill(stop chan bool) {
+	l4g.Info(utils.T("api.search_index.backfill.start.info"))
+
+	afterTime := int64(0)
+	afterId := ""
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		var posts []*model.Post
+		if result := <-Srv.Store.Post().GetPostsForIndexing(afterTime, afterId, SEARCH_INDEX_BACKFILL_SIZE); result.Err != nil {
+			l4g.Error(utils.T("api.search_index.backfill.get_posts.error"), result.Err)
+			return
+		} else {
+			posts = result.Data.([]*model.Post)
+		}
+
+		e.lock.Lock()
+		for _, post := range posts {
+			if !e.removed[post.Id] {
+				e.indexPost(post)
+			}
+		}
+		e.lock.Unlock()
+
+		if len(posts) < SEARCH_INDEX_BACKFILL_SIZE {
+			break
+		}
+
+		// the next batch starts right after the last post of this one, which
+		// keeps posts created in the same millisecond from being skipped
+		last := posts[len(posts)-1]
+		afterTime = last.CreateAt
+		afterId = last.Id
+	}
+
+	e.lock.Lock()
+	e.backfilling = false
+	e.removed = nil
+	e.lock.Unlock()
+
+	if file, err := os.Create(e.backfillPath()); err != nil {
+		l4g.Error(utils.T("api.search_index.backfill.done.error"), err.Error())
+	} else {
+		file.Close()
+	}
+
+	l4g.Info(utils.T("api.search_index.backfill.finish.info"))
+}
+
+func (e *IndexSearchEngine) IndexPost(post *model.Post) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.indexPost(post)
+}
+
+func (e *IndexSearchEngine) indexPost(post *model.Post) {
+	if strings.HasPrefix(post.Type, model.POST_SYSTEM_MESSAGE_PREFIX) || post.DeleteAt != 0 {
+		return
+	}
+
+	doc := newIndexedPost(post)
+	if e.index.add(doc) {
+		e.writeJournal(&postIndexJournalEntry{Op: SEARCH_INDEX_OP_INDEX, Post: doc})
+	}
+}
+
+// DeletePost removes a post from the index along with its replies, since
+// deleting a post in the database deletes its whole thread.
+func (e *IndexSearchEngine) DeletePost(post *model.Post) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	ids := []string{post.Id}
+	for id := range e.index.replies[post.Id] {
+		ids = append(ids, id)
+	}
+
+	e.deletePosts(ids)
+}
+
+func (e *IndexSearchEngine) deletePosts(ids []string) {
+	for _, id := range ids {
+		if e.backfilling {
+			e.removed[id] = true
+		}
+
+		if e.index.remove(id) {
+			e.writeJournal(&postIndexJournalEntry{Op: SEARCH_INDEX_OP_DELETE, Id: id})
+		}
+	}
+}
+
+func (e *IndexSearchEngine) writeJournal(entry *postIndexJournalEntry) {
+	if e.journal == nil {
+		return
+	}
+
+	if b, err := json.Marshal(entry); err != nil {
+		l4g.Error(utils.T("api.search_index.journal.write.error"), err.Error())
+	} else if _, err := e.journal.Write(append(b, '\n')); err != nil {
+		l4g.Error(utils.T("api.search_index.journal.write.error"), err.Error())
+	} else {
+		e.journalEntries++
+	}
+
+	if e.journalEntries > SEARCH_INDEX_COMPACT_MIN_ENTRIES && e.journalEntries > 2*len(e.index.posts) {
+		if err := e.compactJournal(); err != nil {
+			l4g.Error(utils.T("api.search_index.journal.compact.error"), err.Error())
+		}
+	}
+}
+
+func (e *IndexSearchEngine) SearchPosts(teamId string, userId string, paramsList []*model.SearchParams, offset int, limit int) (*model.PostList, *model.AppError) {
+	var channels []*model.Channel
+	if result := <-Srv.Store.Channel().GetChannels(teamId, userId); result.Err != nil {
+		return nil, result.Err
+	} else {
+		channels = result.Data.(*model.ChannelList).Channels
+	}
+
+	scores := make(map[string]float64)
+
+	for _, params := range paramsList {
+		// don't allow users to search for everything
+		if params.Terms == "*" || (params.Terms == "" && !params.HasFilters()) {
+			continue
+		}
+
+		filter := &postIndexFilter{
+			channelIds: make(map[string]bool),
+		}
+		filter.startTime, filter.endTime = params.GetTimeRange()
+
+		inChannels := make(map[string]bool)
+		for _, name := range params.InChannels {
+			inChannels[name] = true
+		}
+
+		for _, channel := range channels {
+			if len(inChannels) == 0 || inChannels[channel.Name] {
+				filter.channelIds[channel.Id] = true
+			}
+		}
+
+		if len(params.FromUsers) > 0 {
+			filter.userIds = make(map[string]bool)
+
+			for _, username := range params.FromUsers {
+				if result := <-Srv.Store.User().GetByUsername(username); result.Err == nil {
+					filter.userIds[result.Data.(*model.User).Id] = true
+				}
+			}
+		}
+
+		// attachments aren't indexed so the posts with matching ones come from the database
+		if params.HasFileFilters() {
+			if result := <-Srv.Store.FileContent().SearchPostIds(teamId, userId, params); result.Err != nil {
+				return nil, result.Err
+			} else {
+				filter.postIds = make(map[string]bool)
+				for _, id := range result.Data.([]string) {
+					filter.postIds[id] = true
+				}
+			}
+		}
+
+		e.lock.RLock()
+		matches := e.index.search(params, filter)
+		e.lock.RUnlock()
+
+		for id, score := range matches {
+			if existing, ok := scores[id]; !ok || score > existing {
+				scores[id] = score
+			}
+		}
+	}
+
+	e.lock.RLock()
+	ids := e.index.rank(scores)
+	e.lock.RUnlock()
+
+	list := &model.PostList{}
+	list.MakeNonNil()
+
+	if offset >= len(ids) {
+		return list, nil
+	}
+
+	ids = ids[offset:]
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+
+	if result := <-Srv.Store.Post().GetPostsByIds(ids); result.Err != nil {
+		return nil, result.Err
+	} else {
+		posts := make(map[string]*model.Post)
+		for _, post := range result.Data.([]*model.Post) {
+			posts[post.Id] = post
+		}
+
+		// the index may be behind the database, such as when posts were removed
+		// along with their user, so skip any posts that are gone and drop them
+		// from the index
+		var gone []string
+		for _, id := range ids {
+			if post, ok := posts[id]; ok && post.DeleteAt == 0 {
+				list.AddPost(post)
+				list.AddOrder(id)
+			} else {
+				gone = append(gone, id)
+			}
+		}
+
+		if len(gone) > 0 {
+			e.lock.Lock()
+			e.deletePosts(gone)
+			e.lock.Unlock()
+		}
+	}
+
+	return list, nil
+}
+
+// indexedPost is the part of a post that is needed to search it.
+type indexedPost struct {
+	Id        string `json:"id"`
+	ChannelId string `json:"channel_id"`
+	RootId    string `json:"root_id,omitempty"`
+	UserId    string `json:"user_id"`
+	CreateAt  int64  `json:"create_at"`
+	UpdateAt  int64  `json:"update_at"`
+	Message   string `json:"message"`
+	Hashtags  string `json:"hashtags"`
+
+	words    map[string]int
+	hashtags map[string]int
+}
+
+func newIndexedPost(post *model.Post) *indexedPost {
+	return &indexedPost{
+		Id:        post.Id,
+		ChannelId: post.ChannelId,
+		RootId:    post.RootId,
+		UserId:    post.UserId,
+		CreateAt:  post.CreateAt,
+		UpdateAt:  post.UpdateAt,
+		Message:   post.Message,
+		Hashtags:  post.Hashtags,
+	}
+}
+
+func (p *indexedPost) tokenize() {
+	p.words = countSearchWords(p.Message)
+	p.hashtags = countSearchWords(p.Hashtags)
+}
+
+func countSearchWords(text string) map[string]int {
+	counts := make(map[string]int)
+	for _, word := range model.GetSearchWords(text) {
+		counts[word]++
+	}
+
+	return counts
+}
+
+type postIndexJournalEntry struct {
+	Op   string       `json:"op"`
+	Id   string       `json:"id,omitempty"`
+	Post *indexedPost `json:"post,omitempty"`
+}
+
+type postIndexFilter struct {
+	channelIds map[string]bool
+	userIds    map[string]bool
+	postIds    map[string]bool
+	startTime  int64
+	endTime    int64
+}
+
+func (f *postIndexFilter) matches(post *indexedPost) bool {
+	if !f.channelIds[post.ChannelId] {
+		return false
+	}
+
+	if f.userIds != nil && !f.userIds[post.UserId] {
+		return false
+	}
+
+	if f.postIds != nil && !f.postIds[post.Id] {
+		return false
+	}
+
+	if f.startTime > 0 && post.CreateAt < f.startTime {
+		return false
+	}
+
+	if f.endTime > 0 && post.CreateAt >= f.endTime {
+		return false
+	}
+
+	return true
+}
+
+// postIndex maps every word to the posts that contain it and how many times
+// it appears in each of them. It isn't safe for concurrent use.
+type postIndex struct {
+	posts    map[string]*indexedPost
+	words    map[string]map[string]int
+	hashtags map[string]map[string]int
+	replies  map[string]map[string]bool
+}
+
+func newPostIndex() *postIndex {
+	return &postIndex{
+		posts:    make(map[string]*indexedPost),
+		words:    make(map[string]map[string]int),
+		hashtags: make(map[string]map[string]int),
+		replies:  make(map[string]map[string]bool),
+	}
+}
+
+// add indexes a post, replacing any older version of it. It returns false if a
+// newer version of the post is already indexed.
+func (idx *postIndex) add(post *indexedPost) bool {
+	if existing, ok := idx.posts[post.Id]; ok {
+		if existing.UpdateAt > post.UpdateAt {
+			return false
+		}
+
+		idx.remove(post.Id)
+	}
+
+	post.tokenize()
+	idx.posts[post.Id] = post
+
+	addPostings(idx.words, post.Id, post.words)
+	addPostings(idx.hashtags, post.Id, post.hashtags)
+
+	if len(post.RootId) > 0 {
+		if idx.replies[post.RootId] == nil {
+			idx.replies[post.RootId] = make(map[string]bool)
+		}
+		idx.replies[post.RootId][post.Id] = true
+	}
+
+	return true
+}
+
+func (idx *postIndex) remove(id string) bool {
+	post, ok := idx.posts[id]
+	if !ok {
+		return false
+	}
+
+	delete(idx.posts, id)
+
+	removePostings(idx.words, id, post.words)
+	removePostings(idx.hashtags, id, post.hashtags)
+
+	if len(post.RootId) > 0 {
+		delete(idx.replies[post.RootId], id)
+		if len(idx.replies[post.RootId]) == 0 {
+			delete(idx.replies, post.RootId)
+		}
+	}
+
+	return true
+}
+
+func addPostings(postings map[string]map[string]int, id string, counts map[string]int) {
+	for word, count := range counts {
+		if postings[word] == nil {
+			postings[word] = make(map[string]int)
+		}
+		postings[word][id] = count
+	}
+}
+
+func removePostings(postings map[string]map[string]int, id string, counts map[string]int) {
+	for word := range counts {
+		delete(postings[word], id)
+		if len(postings[word]) == 0 {
+			delete(postings, word)
+		}
+	}
+}
+
+// search returns the score of every post that matches all of the search terms
+// and passes the filter.
+func (idx *postIndex) search(params *model.SearchParams, filter *postIndexFilter) map[string]float64 {
+	var scores map[string]float64
+
+	for _, term := range model.SplitSearchTerms(strings.ToLower(params.Terms)) {
+		words := model.GetSearchWords(term)
+		if len(words) == 0 {
+			continue
+		}
+
+		termScores := make(map[string]float64)
+
+		if strings.HasPrefix(term, "\"") {
+			// a phrase matches posts that contain all of its words and then
+			// those words in the right order
+			phraseScores := idx.matchWords(idx.words, words, false)
+			for id, score := range phraseScores {
+				if len(model.GetSearchHighlights(idx.posts[id].Message, term, false)) > 0 {
+					termScores[id] = score
+				}
+			}
+		} else {
+			prefix := strings.HasSuffix(term, "*")
+
+			postings := idx.words
+			if params.IsHashtag {
+				postings = idx.hashtags
+			}
+
+			termScores = idx.matchWords(postings, words, prefix)
+		}
+
+		scores = intersectScores(scores, termScores)
+		if len(scores) == 0 {
+			return scores
+		}
+	}
+
+	matches := make(map[string]float64)
+
+	if scores == nil && !params.HasFilters() {
+		return matches
+	} else if scores == nil {
+		// only filters were given so every post that passes them matches
+		for id, post := range idx.posts {
+			if filter.matches(post) {
+				matches[id] = 0
+			}
+		}
+	} else {
+		for id, score := range scores {
+			if filter.matches(idx.posts[id]) {
+				matches[id] = score
+			}
+		}
+	}
+
+	return matches
+}
+
+// matchWords scores the posts containing every one of the words, treating the
+// last word as a prefix if requested.
+func (idx *postIndex) matchWords(postings map[string]map[string]int, words []string, prefix bool) map[string]float64 {
+	var scores map[string]float64
+
+	for i, word := range words {
+		wordScores := make(map[string]float64)
+
+		if prefix && i == len(words)-1 {
+			for indexed, posts := range postings {
+				if strings.HasPrefix(indexed, word) {
+					idx.addWordScores(wordScores, posts)
+				}
+			}
+		} else {
+			idx.addWordScores(wordScores, postings[word])
+		}
+
+		scores = intersectScores(scores, wordScores)
+		if len(scores) == 0 {
+			break
+		}
+	}
+
+	if scores == nil {
+		scores = make(map[string]float64)
+	}
+
+	return scores
+}
+
+// addWordScores adds the tf-idf weight of a word to each post that contains it.
+func (idx *postIndex) addWordScores(scores map[string]float64, posts map[string]int) {
+	if len(posts) == 0 {
+		return
+	}
+
+	idf := math.Log(1 + float64(len(idx.posts))/float64(len(posts)))
+	for id, count := range posts {
+		tf := float64(count) / float64(len(idx.posts[id].words)+1)
+		scores[id] += tf * idf
+	}
+}
+
+// intersectScores returns the posts in both sets of scores with their scores
+// added together. A nil set of scores matches everything.
+func intersectScores(a map[string]float64, b map[string]float64) map[string]float64 {
+	if a == nil {
+		return b
+	}
+
+	result := make(map[string]float64)
+	for id, score := range a {
+		if other, ok := b[id]; ok {
+			result[id] = score + other
+		}
+	}
+
+	return result
+}
+
+// rank orders the scored posts from most to least relevant, with the newest
+// posts first when they are equally relevant.
+func (idx *postIndex) rank(scores map[string]float64) []string {
+	ids := make([]string, 0, len(scores))
+	for id := range scores {
+		if _, ok := idx.posts[id]; ok {
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Sort(rankedPosts{idx, scores, ids})
+
+	return ids
+}
+
+type rankedPosts struct {
+	idx    *postIndex
+	scores map[string]float64
+	ids    []string
+}
+
+func (r rankedPosts) Len() int      { return len(r.ids) }
+func (r rankedPosts) Swap(i, j int) { r.ids[i], r.ids[j] = r.ids[j], r.ids[i] }
+func (r rankedPosts) Less(i, j int) bool {
+	if a, b := r.scores[r.ids[i]], r.scores[r.ids[j]]; a != b {
+		return a > b
+	}
+
+	if a, b := r.idx.posts[r.ids[i]].CreateAt, r.idx.posts[r.ids[j]].CreateAt; a != b {
+		return a > b
+	}
+
+	return r.ids[i] < r.ids[j]
+}
+
+// load replays the journal at path into the index. Lines that can't be read,
+// such as one left half written by a crash, are skipped.
+func (idx *postIndex) load(path string) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		var entry postIndexJournalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+
+		switch entry.Op {
+		case SEARCH_INDEX_OP_INDEX:
+			if entry.Post != nil && len(entry.Post.Id) > 0 {
+				idx.add(entry.Post)
+			}
+		case SEARCH_INDEX_OP_DELETE:
+			idx.remove(entry.Id)
+		}
+	}
+
+	return scanner.Err()
+}
+
+// save writes every indexed post to a new journal at path, replacing the old one.
+func (idx *postIndex) save(path string) error {
+	tmpPath := path + ".tmp"
+
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+	for _, post := range idx.posts {
+		b, err := json.Marshal(&postIndexJournalEntry{Op: SEARCH_INDEX_OP_INDEX, Post: post})
+		if err != nil {
+			file.Close()
+			return err
+		}
+
+		writer.Write(b)
+		writer.WriteByte('\n')
+	}
+
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
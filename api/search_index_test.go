@@ -0,0 +1,202 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package api
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mattermost/platform/model"
+)
+
+func newTestIndexedPost(channelId string, createAt int64, message string) *indexedPost {
+	hashtags, _ := model.ParseHashtags(message)
+
+	return &indexedPost{
+		Id:        model.NewId(),
+		ChannelId: channelId,
+		UserId:    model.NewId(),
+		CreateAt:  createAt,
+		UpdateAt:  createAt,
+		Message:   message,
+		Hashtags:  hashtags,
+	}
+}
+
+func searchTestIndex(idx *postIndex, terms string, filter *postIndexFilter) []string {
+	scores := make(map[string]float64)
+	for _, params := range model.ParseSearchParams(terms) {
+		for id, score := range idx.search(params, filter) {
+			scores[id] = score
+		}
+	}
+
+	return idx.rank(scores)
+}
+
+func TestSearchIndexSearch(t *testing.T) {
+	channelId := model.NewId()
+	filter := &postIndexFilter{channelIds: map[string]bool{channelId: true}}
+
+	idx := newPostIndex()
+
+	p1 := newTestIndexedPost(channelId, 1000, "the quick brown fox")
+	p2 := newTestIndexedPost(channelId, 2000, "fox fox fox")
+	p3 := newTestIndexedPost(channelId, 3000, "a quicker #fox")
+	p4 := newTestIndexedPost(model.NewId(), 4000, "a fox in another channel")
+	idx.add(p1)
+	idx.add(p2)
+	idx.add(p3)
+	idx.add(p4)
+
+	if ids := searchTestIndex(idx, "fox", filter); len(ids) != 3 || ids[0] != p2.Id {
+		t.Fatalf("should have ranked the post mentioning fox most often first %v", ids)
+	}
+
+	if ids := searchTestIndex(idx, "quick fox", filter); len(ids) != 1 || ids[0] != p1.Id {
+		t.Fatalf("should have required every term to match %v", ids)
+	}
+
+	if ids := searchTestIndex(idx, "quick*", filter); len(ids) != 2 {
+		t.Fatalf("should have matched words by prefix %v", ids)
+	}
+
+	if ids := searchTestIndex(idx, "\"quick brown\"", filter); len(ids) != 1 || ids[0] != p1.Id {
+		t.Fatalf("should have matched the phrase %v", ids)
+	}
+
+	if ids := searchTestIndex(idx, "\"brown quick\"", filter); len(ids) != 0 {
+		t.Fatalf("shouldn't have matched words out of order %v", ids)
+	}
+
+	if ids := searchTestIndex(idx, "#fox", filter); len(ids) != 1 || ids[0] != p3.Id {
+		t.Fatalf("should have only matched the hashtag %v", ids)
+	}
+
+	if ids := searchTestIndex(idx, "fox after:1970-01-01 before:1970-01-02", &postIndexFilter{channelIds: filter.channelIds, startTime: 1500, endTime: 2500}); len(ids) != 1 || ids[0] != p2.Id {
+		t.Fatalf("should have filtered by date %v", ids)
+	}
+
+	if ids := searchTestIndex(idx, "fox", &postIndexFilter{channelIds: filter.channelIds, userIds: map[string]bool{p1.UserId: true}}); len(ids) != 1 || ids[0] != p1.Id {
+		t.Fatalf("should have filtered by user %v", ids)
+	}
+
+	if ids := searchTestIndex(idx, "ext:pdf", &postIndexFilter{channelIds: filter.channelIds, postIds: map[string]bool{p3.Id: true, p4.Id: true}}); len(ids) != 1 || ids[0] != p3.Id {
+		t.Fatalf("should have only matched posts with matching attachments %v", ids)
+	}
+
+	edited := *p2
+	edited.Message = "no longer about that animal"
+	edited.UpdateAt = 5000
+	idx.add(&edited)
+
+	if ids := searchTestIndex(idx, "fox", filter); len(ids) != 2 {
+		t.Fatalf("should have reindexed the edited post %v", ids)
+	}
+
+	if idx.add(p2) {
+		t.Fatal("shouldn't have replaced a newer version of a post")
+	}
+
+	idx.remove(p1.Id)
+
+	if ids := searchTestIndex(idx, "quick*", filter); len(ids) != 1 || ids[0] != p3.Id {
+		t.Fatalf("should have removed the deleted post %v", ids)
+	}
+
+	if _, ok := idx.words["brown"]; ok {
+		t.Fatal("should have removed words that no longer appear in any post")
+	}
+}
+
+func TestSearchIndexDeleteThread(t *testing.T) {
+	engine := NewIndexSearchEngine(filepath.Join(os.TempDir(), "search-"+model.NewId()))
+
+	root := &model.Post{Id: model.NewId(), ChannelId: model.NewId(), UserId: model.NewId(), CreateAt: 1000, UpdateAt: 1000, Message: "thread root"}
+	reply := &model.Post{Id: model.NewId(), ChannelId: root.ChannelId, RootId: root.Id, ParentId: root.Id, UserId: root.UserId, CreateAt: 2000, UpdateAt: 2000, Message: "thread reply"}
+	other := &model.Post{Id: model.NewId(), ChannelId: root.ChannelId, UserId: root.UserId, CreateAt: 3000, UpdateAt: 3000, Message: "another thread"}
+	engine.IndexPost(root)
+	engine.IndexPost(reply)
+	engine.IndexPost(other)
+
+	engine.DeletePost(root)
+
+	if len(engine.index.posts) != 1 || engine.index.posts[other.Id] == nil {
+		t.Fatalf("should have removed the replies along with the root post %v", engine.index.posts)
+	}
+
+	if len(engine.index.replies) != 0 {
+		t.Fatal("shouldn't have kept track of the deleted replies")
+	}
+}
+
+func TestSearchIndexJournal(t *testing.T) {
+	dir := filepath.Join(os.TempDir(), "search-"+model.NewId())
+	defer os.RemoveAll(dir)
+
+	engine := NewIndexSearchEngine(dir)
+
+	// mark the index as built so that it doesn't try to load posts from the database
+	os.MkdirAll(dir, 0700)
+	if file, err := os.Create(engine.backfillPath()); err != nil {
+		t.Fatal(err)
+	} else {
+		file.Close()
+	}
+
+	if err := engine.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	p1 := &model.Post{Id: model.NewId(), ChannelId: model.NewId(), UserId: model.NewId(), CreateAt: 1000, UpdateAt: 1000, Message: "journal one"}
+	p2 := &model.Post{Id: model.NewId(), ChannelId: p1.ChannelId, UserId: p1.UserId, CreateAt: 2000, UpdateAt: 2000, Message: "journal two"}
+	p3 := &model.Post{Id: model.NewId(), ChannelId: p1.ChannelId, UserId: p1.UserId, CreateAt: 3000, UpdateAt: 3000, Message: "joined the channel", Type: model.POST_JOIN_LEAVE}
+	engine.IndexPost(p1)
+	engine.IndexPost(p2)
+	engine.IndexPost(p3)
+	engine.DeletePost(p1)
+
+	p2.Message = "journal edited"
+	p2.UpdateAt = 4000
+	engine.IndexPost(p2)
+
+	engine.Stop()
+
+	// a partially written entry shouldn't stop the journal from loading
+	if file, err := os.OpenFile(engine.journalPath(), os.O_WRONLY|os.O_APPEND, 0600); err != nil {
+		t.Fatal(err)
+	} else {
+		file.WriteString("{\"op\":\"index\",\"po")
+		file.Close()
+	}
+
+	restarted := NewIndexSearchEngine(dir)
+	if err := restarted.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer restarted.Stop()
+
+	if len(restarted.index.posts) != 1 {
+		t.Fatalf("should have replayed the journal %v", restarted.index.posts)
+	}
+
+	if post := restarted.index.posts[p2.Id]; post == nil || post.Message != "journal edited" {
+		t.Fatal("should have kept the latest version of the post")
+	}
+
+	if _, ok := restarted.index.words["edited"]; !ok {
+		t.Fatal("should have rebuilt the word index")
+	}
+
+	// repeatedly editing a post shouldn't grow the journal without limit
+	for i := 0; i <= SEARCH_INDEX_COMPACT_MIN_ENTRIES; i++ {
+		p2.UpdateAt++
+		restarted.IndexPost(p2)
+	}
+
+	if restarted.journalEntries > SEARCH_INDEX_COMPACT_MIN_ENTRIES {
+		t.Fatalf("should have compacted the journal %v", restarted.journalEntries)
+	}
+}
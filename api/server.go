@@ -86,8 +86,14 @@ func StopServer() {
 
 	l4g.Info(utils.T("api.server.stop_server.stopping.info"))
 
+	StopPostScheduler()
+	StopWebhookDeliveryWorker()
+	StopEmailBatchingJob()
+	StopUploadSweepJob()
+	searchEngine.Stop()
 	manners.Close()
 	Srv.Store.Close()
+	messageBus.Stop()
 	hub.Stop()
 
 	l4g.Info(utils.T("api.server.stop_server.stopped.info"))
@@ -34,6 +34,11 @@ func InitTeam(r *mux.Router) {
 	sr.Handle("/invite_members", ApiUserRequired(inviteMembers)).Methods("POST")
 	sr.Handle("/update", ApiUserRequired(updateTeam)).Methods("POST")
 	sr.Handle("/me", ApiUserRequired(getMyTeam)).Methods("GET")
+	sr.Handle("/my_members", ApiUserRequired(getMyTeamMembers)).Methods("GET")
+	sr.Handle("/{id:[A-Za-z0-9]+}/join", ApiUserRequired(joinTeam)).Methods("POST")
+	sr.Handle("/{team_id:[A-Za-z0-9]+}/members", ApiUserRequired(getTeamMembers)).Methods("GET")
+	sr.Handle("/{team_id:[A-Za-z0-9]+}/add_user_to_team", ApiUserRequired(addUserToTeam)).Methods("POST")
+	sr.Handle("/{team_id:[A-Za-z0-9]+}/remove_user_from_team", ApiUserRequired(removeUserFromTeam)).Methods("POST")
 	sr.Handle("/get_invite_info", ApiAppHandler(getInviteInfo)).Methods("POST")
 	// These should be moved to the global admain console
 	sr.Handle("/import_team", ApiUserRequired(importTeam)).Methods("POST")
@@ -479,6 +484,12 @@ func inviteMembers(c *Context, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !c.HasPermission(model.PERMISSION_INVITE_USER, c.Session.TeamId) {
+		c.Err = model.NewLocAppError("Team.InviteMembers", "api.team.invite_members.permissions.app_error", nil, "userId="+c.Session.UserId)
+		c.Err.StatusCode = http.StatusForbidden
+		return
+	}
+
 	tchan := Srv.Store.Team().Get(c.Session.TeamId)
 	uchan := Srv.Store.User().Get(c.Session.UserId)
 
@@ -500,7 +511,16 @@ func inviteMembers(c *Context, w http.ResponseWriter, r *http.Request) {
 
 	var invNum int64 = 0
 	for i, invite := range invites.Invites {
-		if result := <-Srv.Store.User().GetByEmail(c.Session.TeamId, invite["email"]); result.Err == nil || result.Err.Id != store.MISSING_ACCOUNT_ERROR {
+		alreadyMember := false
+		if result := <-Srv.Store.User().GetByEmail(invite["email"]); result.Err == nil {
+			// people with an account on another team can still be invited to this one
+			mresult := <-Srv.Store.Team().GetMember(c.Session.TeamId, result.Data.(*model.User).Id)
+			alreadyMember = mresult.Err == nil && mresult.Data.(*model.TeamMember).DeleteAt == 0
+		} else if result.Err.Id != store.MISSING_ACCOUNT_ERROR {
+			alreadyMember = true
+		}
+
+		if alreadyMember {
 			invNum = int64(i)
 			c.Err = model.NewLocAppError("invite_members", "api.team.invite_members.already.app_error", nil, strconv.FormatInt(invNum, 10))
 			return
@@ -575,7 +595,7 @@ func updateTeam(c *Context, w http.ResponseWriter, r *http.Request) {
 
 	team.Id = c.Session.TeamId
 
-	if !c.IsTeamAdmin() {
+	if !c.HasPermission(model.PERMISSION_MANAGE_TEAM, c.Session.TeamId) {
 		c.Err = model.NewLocAppError("updateTeam", "api.team.update_team.permissions.app_error", nil, "userId="+c.Session.UserId)
 		c.Err.StatusCode = http.StatusForbidden
 		return
@@ -622,6 +642,11 @@ func PermanentDeleteTeam(c *Context, team *model.Team) *model.AppError {
 	} else {
 		users := result.Data.([]*model.User)
 		for _, user := range users {
+			// users that belong to other teams only lose their membership
+			if result := <-Srv.Store.Team().GetTeamsForUser(user.Id); result.Err == nil && len(result.Data.([]*model.TeamMember)) > 1 {
+				continue
+			}
+
 			PermanentDeleteUser(c, user)
 		}
 	}
@@ -658,8 +683,224 @@ func getMyTeam(c *Context, w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func getMyTeamMembers(c *Context, w http.ResponseWriter, r *http.Request) {
+	if result := <-Srv.Store.Team().GetTeamsForUser(c.Session.UserId); result.Err != nil {
+		c.Err = result.Err
+		return
+	} else {
+		w.Write([]byte(model.TeamMembersToJson(result.Data.([]*model.TeamMember))))
+	}
+}
+
+func getTeamMembers(c *Context, w http.ResponseWriter, r *http.Request) {
+	if result := <-Srv.Store.Team().GetMembers(c.Session.TeamId); result.Err != nil {
+		c.Err = result.Err
+		return
+	} else {
+		w.Write([]byte(model.TeamMembersToJson(result.Data.([]*model.TeamMember))))
+	}
+}
+
+func joinTeam(c *Context, w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	id := params["id"]
+
+	tchan := Srv.Store.Team().Get(id)
+	uchan := Srv.Store.User().Get(c.Session.UserId)
+
+	var team *model.Team
+	if result := <-tchan; result.Err != nil {
+		c.Err = result.Err
+		return
+	} else {
+		team = result.Data.(*model.Team)
+	}
+
+	var user *model.User
+	if result := <-uchan; result.Err != nil {
+		c.Err = result.Err
+		return
+	} else {
+		user = result.Data.(*model.User)
+	}
+
+	if (team.Type != model.TEAM_OPEN || user.IsGuest()) && !c.IsSystemAdmin() {
+		c.Err = model.NewLocAppError("joinTeam", "api.team.join_team.not_open.app_error", nil, "team_id="+team.Id)
+		c.Err.StatusCode = http.StatusForbidden
+		return
+	}
+
+	if err := AddUserToTeam(team, user); err != nil {
+		c.Err = err
+		return
+	}
+
+	c.LogAudit("team_id=" + team.Id)
+	w.Write([]byte(team.ToJson()))
+}
+
+func addUserToTeam(c *Context, w http.ResponseWriter, r *http.Request) {
+	props := model.MapFromJson(r.Body)
+
+	userId := props["user_id"]
+	if len(userId) != 26 {
+		c.SetInvalidParam("addUserToTeam", "user_id")
+		return
+	}
+
+	if !c.HasPermission(model.PERMISSION_ADD_USER_TO_TEAM, c.Session.TeamId) {
+		c.Err = model.NewLocAppError("addUserToTeam", "api.team.add_user_to_team.permissions.app_error", nil, "userId="+c.Session.UserId)
+		c.Err.StatusCode = http.StatusForbidden
+		return
+	}
+
+	tchan := Srv.Store.Team().Get(c.Session.TeamId)
+	uchan := Srv.Store.User().Get(userId)
+
+	var team *model.Team
+	if result := <-tchan; result.Err != nil {
+		c.Err = result.Err
+		return
+	} else {
+		team = result.Data.(*model.Team)
+	}
+
+	var user *model.User
+	if result := <-uchan; result.Err != nil {
+		c.Err = result.Err
+		return
+	} else {
+		user = result.Data.(*model.User)
+	}
+
+	if err := AddUserToTeam(team, user); err != nil {
+		c.Err = err
+		return
+	}
+
+	c.LogAudit("user_id=" + userId)
+	w.Write([]byte(model.MapToJson(props)))
+}
+
+// AddUserToTeam makes an existing user a member of the team and puts them in
+// its default channels.
+func AddUserToTeam(team *model.Team, user *model.User) *model.AppError {
+	if err := JoinUserToTeam(team.Id, user, ""); err != nil {
+		return err
+	}
+
+	// Soft error if there is an issue joining the default channels, which guests
+	// are only added to by hand
+	if !user.IsGuest() {
+		if err := JoinDefaultChannels(team.Id, user, ""); err != nil {
+			l4g.Error(utils.T("api.user.create_user.joining.error"), user.Id, team.Id, err)
+		}
+	}
+
+	message := model.NewMessage(team.Id, "", user.Id, model.ACTION_NEW_USER)
+	PublishAndForget(message)
+
+	return nil
+}
+
+// JoinUserToTeam records that the user belongs to the team, bringing them back
+// if they had left it before.
+func JoinUserToTeam(teamId string, user *model.User, roles string) *model.AppError {
+	if result := <-Srv.Store.Team().GetMember(teamId, user.Id); result.Err == nil {
+		member := result.Data.(*model.TeamMember)
+		if member.DeleteAt == 0 {
+			return nil
+		}
+
+		member.Roles = roles
+		member.DeleteAt = 0
+		if result := <-Srv.Store.Team().UpdateMember(member); result.Err != nil {
+			return result.Err
+		}
+	} else if result := <-Srv.Store.Team().SaveMember(&model.TeamMember{TeamId: teamId, UserId: user.Id, Roles: roles}); result.Err != nil {
+		return result.Err
+	}
+
+	// sessions carry the user's teams so make sure they are loaded again
+	RemoveAllSessionsForUserIdFromCache(user.Id)
+
+	return nil
+}
+
+func removeUserFromTeam(c *Context, w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	teamId := params["team_id"]
+
+	props := model.MapFromJson(r.Body)
+
+	userId := props["user_id"]
+	if len(userId) != 26 {
+		c.SetInvalidParam("removeUserFromTeam", "user_id")
+		return
+	}
+
+	if userId != c.Session.UserId && !c.HasPermission(model.PERMISSION_MANAGE_TEAM, teamId) {
+		c.Err = model.NewLocAppError("removeUserFromTeam", "api.team.remove_user_from_team.permissions.app_error", nil, "userId="+c.Session.UserId)
+		c.Err.StatusCode = http.StatusForbidden
+		return
+	}
+
+	var member *model.TeamMember
+	if result := <-Srv.Store.Team().GetMember(teamId, userId); result.Err != nil {
+		c.Err = result.Err
+		return
+	} else {
+		member = result.Data.(*model.TeamMember)
+	}
+
+	// don't leave the team without anyone who can manage it
+	if member.IsTeamAdmin() && member.DeleteAt == 0 {
+		if count, err := countOtherActiveTeamAdmins(teamId, userId); err != nil {
+			c.Err = err
+			return
+		} else if count == 0 {
+			c.Err = model.NewLocAppError("removeUserFromTeam", "api.team.remove_user_from_team.last_admin.app_error", nil, "teamId="+teamId)
+			c.Err.StatusCode = http.StatusBadRequest
+			return
+		}
+	}
+
+	if err := RemoveUserFromTeam(teamId, userId, c.Session.UserId); err != nil {
+		c.Err = err
+		return
+	}
+
+	c.LogAudit("team_id=" + teamId + " user_id=" + userId)
+	w.Write([]byte(model.MapToJson(props)))
+}
+
+// RemoveUserFromTeam takes the user out of the team and the team's channels.
+// Direct channels are left alone since they aren't part of the team.
+func RemoveUserFromTeam(teamId string, userId string, removerUserId string) *model.AppError {
+	if result := <-Srv.Store.Channel().GetChannels(teamId, userId); result.Err == nil {
+		for _, channel := range result.Data.(*model.ChannelList).Channels {
+			if channel.Type == model.CHANNEL_DIRECT {
+				continue
+			}
+
+			if err := RemoveUserFromChannel(userId, removerUserId, channel); err != nil {
+				return err
+			}
+		}
+	}
+
+	if result := <-Srv.Store.Team().RemoveMember(teamId, userId); result.Err != nil {
+		return result.Err
+	}
+
+	// sessions carry the user's teams so make sure they are loaded again
+	RemoveAllSessionsForUserIdFromCache(userId)
+
+	return nil
+}
+
 func importTeam(c *Context, w http.ResponseWriter, r *http.Request) {
-	if !c.HasPermissionsToTeam(c.Session.TeamId, "import") || !c.IsTeamAdmin() {
+	if !c.HasPermissionsToTeam(c.Session.TeamId, "import") || !c.HasPermission(model.PERMISSION_MANAGE_TEAM, c.Session.TeamId) {
 		c.Err = model.NewLocAppError("importTeam", "api.team.import_team.admin.app_error", nil, "userId="+c.Session.UserId)
 		c.Err.StatusCode = http.StatusForbidden
 		return
@@ -726,7 +967,7 @@ func importTeam(c *Context, w http.ResponseWriter, r *http.Request) {
 }
 
 func exportTeam(c *Context, w http.ResponseWriter, r *http.Request) {
-	if !c.HasPermissionsToTeam(c.Session.TeamId, "export") || !c.IsTeamAdmin() {
+	if !c.HasPermissionsToTeam(c.Session.TeamId, "export") || !c.HasPermission(model.PERMISSION_MANAGE_TEAM, c.Session.TeamId) {
 		c.Err = model.NewLocAppError("exportTeam", "api.team.export_team.admin.app_error", nil, "userId="+c.Session.UserId)
 		c.Err.StatusCode = http.StatusForbidden
 		return
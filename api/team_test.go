@@ -229,10 +229,11 @@ func TestInviteMembers(t *testing.T) {
 func TestUpdateTeamDisplayName(t *testing.T) {
 	Setup()
 
-	team := &model.Team{DisplayName: "Name", Name: "z-z-" + model.NewId() + "a", Email: "test@nowhere.com", Type: model.TEAM_OPEN}
+	adminEmail := strings.ToLower(model.NewId()) + "success+test@simulator.amazonses.com"
+	team := &model.Team{DisplayName: "Name", Name: "z-z-" + model.NewId() + "a", Email: adminEmail, Type: model.TEAM_OPEN}
 	team = Client.Must(Client.CreateTeam(team)).Data.(*model.Team)
 
-	user := &model.User{TeamId: team.Id, Email: "test@nowhere.com", Nickname: "Corey Hulen", Password: "pwd"}
+	user := &model.User{TeamId: team.Id, Email: adminEmail, Nickname: "Corey Hulen", Password: "pwd"}
 	user = Client.Must(Client.CreateUser(user, "")).Data.(*model.User)
 	store.Must(Srv.Store.User().VerifyEmail(user.Id))
 
@@ -309,3 +310,94 @@ func TestGetMyTeam(t *testing.T) {
 		}
 	}
 }
+
+func TestTeamMembers(t *testing.T) {
+	Setup()
+
+	adminEmail := strings.ToLower(model.NewId()) + "success+test@simulator.amazonses.com"
+	team := &model.Team{DisplayName: "Name", Name: "z-z-" + model.NewId() + "a", Email: adminEmail, Type: model.TEAM_INVITE}
+	team = Client.Must(Client.CreateTeam(team)).Data.(*model.Team)
+
+	user1 := &model.User{TeamId: team.Id, Email: adminEmail, Nickname: "Corey Hulen", Password: "pwd"}
+	user1 = Client.Must(Client.CreateUser(user1, "")).Data.(*model.User)
+	store.Must(Srv.Store.User().VerifyEmail(user1.Id))
+
+	team2 := &model.Team{DisplayName: "Name", Name: "z-z-" + model.NewId() + "a", Email: strings.ToLower(model.NewId()) + "success+test@simulator.amazonses.com", Type: model.TEAM_OPEN}
+	team2 = Client.Must(Client.CreateTeam(team2)).Data.(*model.Team)
+
+	user2 := &model.User{TeamId: team2.Id, Email: strings.ToLower(model.NewId()) + "success+test@simulator.amazonses.com", Nickname: "Corey Hulen", Password: "pwd"}
+	user2 = Client.Must(Client.CreateUser(user2, "")).Data.(*model.User)
+	store.Must(Srv.Store.User().VerifyEmail(user2.Id))
+
+	Client.LoginByEmail(team2.Name, user2.Email, "pwd")
+
+	if _, err := Client.JoinTeam(team.Id); err == nil {
+		t.Fatal("Should have errored, team isn't open")
+	}
+
+	if _, err := Client.GetTeamMembers(team.Id); err == nil {
+		t.Fatal("Should have errored, not a member")
+	}
+
+	if _, err := Client.DoApiGet("/teams/"+team.Id+"/channels/", "", ""); err == nil {
+		t.Fatal("Should have errored, not a member")
+	}
+
+	if _, err := Client.LoginByEmail(team.Name, user2.Email, "pwd"); err == nil {
+		t.Fatal("Should have errored, not a member")
+	}
+
+	Client.LoginByEmail(team.Name, user1.Email, "pwd")
+
+	if _, err := Client.JoinTeam(team2.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Client.AddUserToTeam(team.Id, user2.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	if members := Client.Must(Client.GetTeamMembers(team.Id)).Data.([]*model.TeamMember); len(members) != 2 {
+		t.Fatal("wrong number of members")
+	}
+
+	if members := Client.Must(Client.GetMyTeamMembers()).Data.([]*model.TeamMember); len(members) != 2 {
+		t.Fatal("should belong to both teams")
+	}
+
+	if _, err := Client.DoApiGet("/teams/"+team2.Id+"/channels/", "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	Client.LoginByEmail(team2.Name, user2.Email, "pwd")
+
+	if _, err := Client.AddUserToTeam(team2.Id, user1.Id); err == nil {
+		t.Fatal("Should have errored, not a team admin")
+	}
+
+	if _, err := Client.LoginByEmail(team.Name, user2.Email, "pwd"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Client.RemoveUserFromTeam(team.Id, user1.Id); err == nil {
+		t.Fatal("Should have errored, not a team admin")
+	}
+
+	if _, err := Client.RemoveUserFromTeam(team.Id, user2.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Client.DoApiGet("/teams/"+team.Id+"/channels/", "", ""); err == nil {
+		t.Fatal("Should have errored, removed from the team")
+	}
+
+	if _, err := Client.LoginByEmail(team.Name, user2.Email, "pwd"); err == nil {
+		t.Fatal("Should have errored, not a member")
+	}
+
+	Client.LoginByEmail(team.Name, user1.Email, "pwd")
+
+	if _, err := Client.RemoveUserFromTeam(team.Id, user1.Id); err == nil {
+		t.Fatal("Should have errored, last team admin")
+	}
+}
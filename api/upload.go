@@ -0,0 +1,400 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package api
+
+import (
+	"bytes"
+	"image"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	l4g "github.com/alecthomas/log4go"
+	"github.com/gorilla/mux"
+	"github.com/mattermost/platform/model"
+	"github.com/mattermost/platform/utils"
+)
+
+const (
+	// how long a request has to write its chunk before another may take over
+	UPLOAD_CHUNK_LEASE = 30 * time.Minute
+
+	UPLOAD_SWEEP_INTERVAL   = time.Hour
+	UPLOAD_SWEEP_BATCH_SIZE = 100
+)
+
+var stopUploadSweep chan bool
+
+// InitUpload adds the routes for uploading large files in chunks. Unlike
+// uploadFile, each chunk is streamed straight to the file backend so the
+// server never holds the whole file in memory, and an upload that's cut off
+// can be picked up again from the last chunk that was saved.
+func InitUpload(routers ...*mux.Router) {
+	l4g.Debug(utils.T("api.upload.init.debug"))
+
+	for _, r := range routers {
+		sr := r.PathPrefix("/files/uploads").Subrouter()
+		sr.Handle("/create", ApiUserRequired(createUploadSession)).Methods("POST")
+		sr.Handle("/{id:[A-Za-z0-9]+}", ApiUserRequired(getUploadSession)).Methods("GET")
+		sr.Handle("/{id:[A-Za-z0-9]+}", ApiUserRequired(uploadChunk)).Methods("PUT")
+		sr.Handle("/{id:[A-Za-z0-9]+}/finish", ApiUserRequired(finishUpload)).Methods("POST")
+		sr.Handle("/{id:[A-Za-z0-9]+}/cancel", ApiUserRequired(cancelUpload)).Methods("POST")
+	}
+}
+
+func createUploadSession(c *Context, w http.ResponseWriter, r *http.Request) {
+	backend, err := getFileBackend("createUploadSession")
+	if err != nil {
+		c.Err = err
+		c.Err.StatusCode = http.StatusNotImplemented
+		return
+	}
+
+	session := model.UploadSessionFromJson(r.Body)
+	if session == nil {
+		c.SetInvalidParam("createUploadSession", "upload_session")
+		return
+	}
+
+	if session.FileSize > *utils.Cfg.FileSettings.MaxUploadSize {
+		c.Err = model.NewLocAppError("createUploadSession", "api.upload.create.too_large.app_error", nil, "file_size="+strconv.FormatInt(session.FileSize, 10))
+		c.Err.StatusCode = http.StatusRequestEntityTooLarge
+		return
+	}
+
+	cchan := Srv.Store.Channel().CheckPermissionsTo(c.Session.TeamId, session.ChannelId, c.Session.UserId)
+	if !c.HasPermissionsToChannel(cchan, "createUploadSession") {
+		return
+	}
+
+	session.Id = ""
+	session.UserId = c.Session.UserId
+	session.TeamId = c.Session.TeamId
+	session.Filename = filepath.Base(session.Filename)
+	session.BackendId = ""
+
+	// the session has to be saved first since its id is part of the file's path
+	if result := <-Srv.Store.UploadSession().Save(session); result.Err != nil {
+		c.Err = result.Err
+		return
+	}
+
+	if backendId, err := backend.StartUpload(session.Path()); err != nil {
+		<-Srv.Store.UploadSession().Delete(session.Id)
+		c.Err = err
+		return
+	} else {
+		session.BackendId = backendId
+	}
+
+	if result := <-Srv.Store.UploadSession().Update(session); result.Err != nil {
+		// nothing else knows about the upload so throw it away now
+		if err := backend.AbortUpload(session.Path(), session.BackendId); err != nil {
+			l4g.Error(utils.T("api.upload.abort.error"), session.Id, err)
+		}
+		<-Srv.Store.UploadSession().Delete(session.Id)
+		c.Err = result.Err
+		return
+	}
+
+	c.LogAudit("upload_id=" + session.Id + " file_size=" + strconv.FormatInt(session.FileSize, 10))
+	w.Write([]byte(session.ToJson()))
+}
+
+// getUploadSessionForUser gets the upload session named in the request and
+// makes sure that it belongs to the user.
+func getUploadSessionForUser(c *Context, r *http.Request, where string) *model.UploadSession {
+	id := mux.Vars(r)["id"]
+
+	if result := <-Srv.Store.UploadSession().Get(id); result.Err != nil {
+		c.Err = result.Err
+		c.Err.StatusCode = http.StatusNotFound
+		return nil
+	} else if session := result.Data.(*model.UploadSession); session.UserId != c.Session.UserId {
+		c.Err = model.NewLocAppError(where, "api.upload.permissions.app_error", nil, "id="+id)
+		c.Err.StatusCode = http.StatusForbidden
+		return nil
+	} else {
+		return session
+	}
+}
+
+// getUploadSession lets a client find out how much of the file was saved
+// before the connection dropped so that it knows where to continue from.
+func getUploadSession(c *Context, w http.ResponseWriter, r *http.Request) {
+	if session := getUploadSessionForUser(c, r, "getUploadSession"); session != nil {
+		w.Write([]byte(session.ToJson()))
+	}
+}
+
+// uploadChunk saves the body of the request as the next chunk of the file. The
+// offset has to match how much of the file has been saved already.
+func uploadChunk(c *Context, w http.ResponseWriter, r *http.Request) {
+	backend, err := getFileBackend("uploadChunk")
+	if err != nil {
+		c.Err = err
+		c.Err.StatusCode = http.StatusNotImplemented
+		return
+	}
+
+	session := getUploadSessionForUser(c, r, "uploadChunk")
+	if session == nil {
+		return
+	}
+
+	offset, parseErr := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+	if parseErr != nil {
+		c.SetInvalidParam("uploadChunk", "offset")
+		return
+	}
+
+	if offset != session.FileOffset {
+		c.Err = model.NewLocAppError("uploadChunk", "api.upload.chunk.offset.app_error",
+			map[string]interface{}{"Offset": session.FileOffset}, "id="+session.Id+", offset="+strconv.FormatInt(offset, 10))
+		c.Err.StatusCode = http.StatusConflict
+		return
+	}
+
+	if !session.IsValidChunk(r.ContentLength) {
+		c.Err = model.NewLocAppError("uploadChunk", "api.upload.chunk.size.app_error",
+			map[string]interface{}{"MinSize": model.UPLOAD_CHUNK_MIN_SIZE}, "id="+session.Id+", size="+strconv.FormatInt(r.ContentLength, 10))
+		c.Err.StatusCode = http.StatusBadRequest
+		return
+	}
+
+	// only one chunk can be written at a time, otherwise two requests for the
+	// same offset could both be written and counted
+	leaseUntil := model.GetMillis() + int64(UPLOAD_CHUNK_LEASE/time.Millisecond)
+	if result := <-Srv.Store.UploadSession().ClaimChunk(session, leaseUntil); result.Err != nil {
+		c.Err = result.Err
+		return
+	} else if !result.Data.(bool) {
+		c.Err = model.NewLocAppError("uploadChunk", "api.upload.chunk.in_progress.app_error", nil, "id="+session.Id+", offset="+strconv.FormatInt(offset, 10))
+		c.Err.StatusCode = http.StatusConflict
+		return
+	}
+
+	if err := backend.WriteChunk(session.Path(), session.BackendId, session.Chunks+1, offset, r.Body); err != nil {
+		if result := <-Srv.Store.UploadSession().ReleaseChunk(session); result.Err != nil {
+			l4g.Error(utils.T("api.upload.chunk.release.error"), session.Id, result.Err)
+		}
+
+		c.Err = err
+		return
+	}
+
+	session.FileOffset += r.ContentLength
+	session.Chunks++
+
+	if result := <-Srv.Store.UploadSession().SaveChunk(session); result.Err != nil {
+		c.Err = result.Err
+		return
+	} else if !result.Data.(bool) {
+		// the upload was cancelled or the lease ran out while the chunk was sent
+		c.Err = model.NewLocAppError("uploadChunk", "api.upload.chunk.lost_lease.app_error", nil, "id="+session.Id)
+		c.Err.StatusCode = http.StatusConflict
+		return
+	}
+
+	w.Write([]byte(session.ToJson()))
+}
+
+func finishUpload(c *Context, w http.ResponseWriter, r *http.Request) {
+	backend, err := getFileBackend("finishUpload")
+	if err != nil {
+		c.Err = err
+		c.Err.StatusCode = http.StatusNotImplemented
+		return
+	}
+
+	session := getUploadSessionForUser(c, r, "finishUpload")
+	if session == nil {
+		return
+	}
+
+	if !session.IsComplete() {
+		c.Err = model.NewLocAppError("finishUpload", "api.upload.finish.incomplete.app_error", nil, "id="+session.Id)
+		c.Err.StatusCode = http.StatusBadRequest
+		return
+	}
+
+	// the user may have left the channel since the upload was started
+	cchan := Srv.Store.Channel().CheckPermissionsTo(session.TeamId, session.ChannelId, c.Session.UserId)
+	if !c.HasPermissionsToChannel(cchan, "finishUpload") {
+		return
+	}
+
+	// keeps a chunk from being written, or the upload swept, while the file is
+	// put together
+	leaseUntil := model.GetMillis() + int64(UPLOAD_CHUNK_LEASE/time.Millisecond)
+	if result := <-Srv.Store.UploadSession().ClaimChunk(session, leaseUntil); result.Err != nil {
+		c.Err = result.Err
+		return
+	} else if !result.Data.(bool) {
+		c.Err = model.NewLocAppError("finishUpload", "api.upload.finish.in_progress.app_error", nil, "id="+session.Id)
+		c.Err.StatusCode = http.StatusConflict
+		return
+	}
+
+	if err := backend.FinishUpload(session.Path(), session.BackendId); err != nil {
+		if result := <-Srv.Store.UploadSession().ReleaseChunk(session); result.Err != nil {
+			l4g.Error(utils.T("api.upload.chunk.release.error"), session.Id, result.Err)
+		}
+
+		c.Err = err
+		return
+	}
+
+	if result := <-Srv.Store.UploadSession().Delete(session.Id); result.Err != nil {
+		l4g.Error(utils.T("api.upload.finish.delete_session.error"), session.Id, result.Err)
+	}
+
+	info := model.GetInfoForFile(session.Filename, session.FileSize)
+	var fileData []byte
+
+	// only make previews and read the text of files that a normal upload would take
+	if (utils.GetPreviewGenerator(session.Filename) != nil || utils.CanExtractText(session.Filename)) && session.FileSize <= model.MAX_FILE_SIZE {
+		if data, err := utils.ReadFile(backend, session.Path()); err != nil {
+			l4g.Error(utils.T("api.upload.finish.read_image.error"), session.Id, err)
+		} else if !model.IsFileExtImage(filepath.Ext(session.Filename)) {
+			fileData = data
+		} else if config, _, err := image.DecodeConfig(bytes.NewReader(data)); err != nil || config.Width*config.Height > MaxImageSize {
+			l4g.Error(utils.T("api.upload.finish.read_image.error"), session.Id, err)
+		} else {
+			if bytesInfo, err := model.GetInfoForBytes(session.Filename, data); err == nil {
+				info = bytesInfo
+			}
+
+			info.Width = config.Width
+			info.Height = config.Height
+			fileData = data
+		}
+	}
+
+	info.Id = session.Id
+	info.CreatorId = session.UserId
+	info.ChannelId = session.ChannelId
+	info.Path = session.Path()
+
+	if result := <-Srv.Store.FileInfo().Save(info); result.Err != nil {
+		c.Err = result.Err
+		return
+	}
+
+	if fileData != nil {
+		handlePreviewsAndForget([]*model.FileInfo{info}, [][]byte{fileData})
+		extractFileContentsAndForget([]*model.FileInfo{info}, [][]byte{fileData})
+	}
+
+	c.LogAudit("upload_id=" + session.Id)
+
+	resStruct := &model.FileUploadResponse{
+		Filenames: []string{"/" + session.ChannelId + "/" + session.UserId + "/" + session.Id + "/" + utils.UrlEncode(session.Filename)},
+		ClientIds: []string{},
+	}
+
+	w.Write([]byte(resStruct.ToJson()))
+}
+
+func cancelUpload(c *Context, w http.ResponseWriter, r *http.Request) {
+	backend, err := getFileBackend("cancelUpload")
+	if err != nil {
+		c.Err = err
+		c.Err.StatusCode = http.StatusNotImplemented
+		return
+	}
+
+	session := getUploadSessionForUser(c, r, "cancelUpload")
+	if session == nil {
+		return
+	}
+
+	if err := backend.AbortUpload(session.Path(), session.BackendId); err != nil {
+		c.Err = err
+		return
+	}
+
+	if result := <-Srv.Store.UploadSession().Delete(session.Id); result.Err != nil {
+		c.Err = result.Err
+		return
+	}
+
+	c.LogAudit("upload_id=" + session.Id)
+	w.Write([]byte(model.MapToJson(map[string]string{"id": session.Id})))
+}
+
+// StartUploadSweepJob starts the background job that throws away uploads that
+// were started but never finished or cancelled.
+func StartUploadSweepJob() {
+	if stopUploadSweep != nil {
+		return
+	}
+
+	stop := make(chan bool)
+	stopUploadSweep = stop
+
+	go func() {
+		ticker := time.NewTicker(UPLOAD_SWEEP_INTERVAL)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				sweepExpiredUploads()
+			}
+		}
+	}()
+}
+
+func StopUploadSweepJob() {
+	if stopUploadSweep != nil {
+		close(stopUploadSweep)
+		stopUploadSweep = nil
+	}
+}
+
+// sweepExpiredUploads aborts the uploads that haven't had a chunk sent in a
+// while, which removes their chunks from the file backend, and then forgets
+// them. Each session is claimed first so that a chunk can't be written to it
+// while it's being thrown away.
+func sweepExpiredUploads() {
+	backend, err := getFileBackend("sweepExpiredUploads")
+	if err != nil {
+		return
+	}
+
+	var sessions []*model.UploadSession
+	if result := <-Srv.Store.UploadSession().GetExpired(model.GetMillis()-model.UPLOAD_SESSION_EXPIRY, UPLOAD_SWEEP_BATCH_SIZE); result.Err != nil {
+		l4g.Error(utils.T("api.upload.sweep.get_expired.error"), result.Err)
+		return
+	} else {
+		sessions = result.Data.([]*model.UploadSession)
+	}
+
+	for _, session := range sessions {
+		leaseUntil := model.GetMillis() + int64(UPLOAD_CHUNK_LEASE/time.Millisecond)
+		if result := <-Srv.Store.UploadSession().ClaimChunk(session, leaseUntil); result.Err != nil {
+			l4g.Error(utils.T("api.upload.sweep.claim.error"), session.Id, result.Err)
+			continue
+		} else if !result.Data.(bool) {
+			continue
+		}
+
+		if len(session.BackendId) > 0 {
+			if err := backend.AbortUpload(session.Path(), session.BackendId); err != nil {
+				// keep the session so that the upload is aborted on the next sweep
+				l4g.Error(utils.T("api.upload.abort.error"), session.Id, err)
+				<-Srv.Store.UploadSession().ReleaseChunk(session)
+				continue
+			}
+		}
+
+		if result := <-Srv.Store.UploadSession().Delete(session.Id); result.Err != nil {
+			l4g.Error(utils.T("api.upload.sweep.delete.error"), session.Id, result.Err)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package api
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/platform/model"
+	"github.com/mattermost/platform/store"
+)
+
+func TestResumableUpload(t *testing.T) {
+	Setup()
+
+	team := &model.Team{DisplayName: "Name", Name: "z-z-" + model.NewId() + "a", Email: "test@nowhere.com", Type: model.TEAM_OPEN}
+	team = Client.Must(Client.CreateTeam(team)).Data.(*model.Team)
+
+	user1 := &model.User{TeamId: team.Id, Email: model.NewId() + "success+test@simulator.amazonses.com", Nickname: "Corey Hulen", Password: "pwd"}
+	user1 = Client.Must(Client.CreateUser(user1, "")).Data.(*model.User)
+	store.Must(Srv.Store.User().VerifyEmail(user1.Id))
+
+	user2 := &model.User{TeamId: team.Id, Email: model.NewId() + "success+test@simulator.amazonses.com", Nickname: "Corey Hulen", Password: "pwd"}
+	user2 = Client.Must(Client.CreateUser(user2, "")).Data.(*model.User)
+	store.Must(Srv.Store.User().VerifyEmail(user2.Id))
+
+	Client.Must(Client.LoginByEmail(team.Name, user1.Email, "pwd"))
+
+	channel1 := &model.Channel{DisplayName: "Test API Name", Name: "a" + model.NewId() + "a", Type: model.CHANNEL_OPEN, TeamId: team.Id}
+	channel1 = Client.Must(Client.CreateChannel(channel1)).Data.(*model.Channel)
+
+	data := bytes.Repeat([]byte("a"), model.UPLOAD_CHUNK_MIN_SIZE+10)
+
+	session := &model.UploadSession{ChannelId: channel1.Id, Filename: "../build.log", FileSize: int64(len(data))}
+	session = Client.Must(Client.CreateUploadSession(session)).Data.(*model.UploadSession)
+	if session.Filename != "build.log" {
+		t.Fatal("relative path should have been sanitized out")
+	}
+
+	if _, err := Client.UploadChunk(session.Id, 0, data[:10]); err == nil {
+		t.Fatal("should have failed, only the last chunk can be small")
+	}
+
+	if _, err := Client.UploadChunk(session.Id, 10, data[10:]); err == nil {
+		t.Fatal("should have failed, chunk isn't at the end of what's been sent")
+	}
+
+	Client.Must(Client.UploadChunk(session.Id, 0, data[:model.UPLOAD_CHUNK_MIN_SIZE]))
+
+	if _, err := Client.FinishUpload(session.Id); err == nil {
+		t.Fatal("should have failed, upload isn't complete")
+	}
+
+	// pick the upload back up as if the connection had dropped
+	session = Client.Must(Client.GetUploadSession(session.Id)).Data.(*model.UploadSession)
+	if session.FileOffset != model.UPLOAD_CHUNK_MIN_SIZE {
+		t.Fatal("should have saved the first chunk", session.FileOffset)
+	}
+
+	Client.Must(Client.LoginByEmail(team.Name, user2.Email, "pwd"))
+
+	if _, err := Client.GetUploadSession(session.Id); err == nil {
+		t.Fatal("should have failed, someone else's upload")
+	}
+
+	if _, err := Client.UploadChunk(session.Id, session.FileOffset, data[session.FileOffset:]); err == nil {
+		t.Fatal("should have failed, someone else's upload")
+	}
+
+	Client.Must(Client.LoginByEmail(team.Name, user1.Email, "pwd"))
+
+	Client.Must(Client.UploadChunk(session.Id, session.FileOffset, data[session.FileOffset:]))
+
+	filename := Client.Must(Client.FinishUpload(session.Id)).Data.(*model.FileUploadResponse).Filenames[0]
+	if !strings.HasSuffix(filename, "/"+session.Id+"/build.log") {
+		t.Fatal("should have returned the file's url", filename)
+	}
+
+	if r, err := Client.GetFile(filename, false); err != nil {
+		t.Fatal(err)
+	} else if body, _ := ioutil.ReadAll(r.Data.(io.ReadCloser)); !bytes.Equal(body, data) {
+		t.Fatal("should have saved the whole file")
+	}
+
+	if _, err := Client.GetUploadSession(session.Id); err == nil {
+		t.Fatal("should have removed the finished upload")
+	}
+
+	backend, _ := getFileBackend("TestResumableUpload")
+	if err := backend.Remove(session.Path()); err != nil {
+		t.Fatal(err)
+	}
+
+	session2 := &model.UploadSession{ChannelId: channel1.Id, Filename: "build.log", FileSize: int64(len(data))}
+	session2 = Client.Must(Client.CreateUploadSession(session2)).Data.(*model.UploadSession)
+	Client.Must(Client.UploadChunk(session2.Id, 0, data[:model.UPLOAD_CHUNK_MIN_SIZE]))
+	Client.Must(Client.CancelUpload(session2.Id))
+
+	if _, err := Client.UploadChunk(session2.Id, model.UPLOAD_CHUNK_MIN_SIZE, data[model.UPLOAD_CHUNK_MIN_SIZE:]); err == nil {
+		t.Fatal("should have failed, upload was cancelled")
+	}
+
+	session3 := &model.UploadSession{ChannelId: channel1.Id, Filename: "build.log", FileSize: int64(len(data))}
+	session3 = Client.Must(Client.CreateUploadSession(session3)).Data.(*model.UploadSession)
+
+	// another request is still writing the first chunk
+	locked := store.Must(Srv.Store.UploadSession().Get(session3.Id)).(*model.UploadSession)
+	if !store.Must(Srv.Store.UploadSession().ClaimChunk(locked, model.GetMillis()+60000)).(bool) {
+		t.Fatal("should have claimed the upload")
+	}
+
+	if _, err := Client.UploadChunk(session3.Id, 0, data[:model.UPLOAD_CHUNK_MIN_SIZE]); err == nil {
+		t.Fatal("should have failed, another chunk is being written")
+	}
+
+	store.Must(Srv.Store.UploadSession().ReleaseChunk(locked))
+	Client.Must(Client.UploadChunk(session3.Id, 0, data[:model.UPLOAD_CHUNK_MIN_SIZE]))
+
+	Srv.Store.(*store.SqlStore).GetMaster().Exec("UPDATE UploadSessions SET UpdateAt = :UpdateAt WHERE Id = :Id",
+		map[string]interface{}{"UpdateAt": model.GetMillis() - model.UPLOAD_SESSION_EXPIRY - 1000, "Id": session3.Id})
+
+	sweepExpiredUploads()
+
+	if _, err := Client.GetUploadSession(session3.Id); err == nil {
+		t.Fatal("should have thrown away the abandoned upload")
+	}
+
+	session4 := &model.UploadSession{ChannelId: channel1.Id, Filename: "build.log", FileSize: int64(len(data))}
+	session4 = Client.Must(Client.CreateUploadSession(session4)).Data.(*model.UploadSession)
+	Client.Must(Client.UploadChunk(session4.Id, 0, data))
+
+	locked = store.Must(Srv.Store.UploadSession().Get(session4.Id)).(*model.UploadSession)
+	if !store.Must(Srv.Store.UploadSession().ClaimChunk(locked, model.GetMillis()+60000)).(bool) {
+		t.Fatal("should have claimed the upload")
+	}
+
+	if _, err := Client.FinishUpload(session4.Id); err == nil {
+		t.Fatal("should have failed, the upload is being worked on")
+	}
+
+	store.Must(Srv.Store.UploadSession().ReleaseChunk(locked))
+
+	channel2 := &model.Channel{DisplayName: "Test API Name", Name: "a" + model.NewId() + "a", Type: model.CHANNEL_OPEN, TeamId: team.Id}
+	channel2 = Client.Must(Client.CreateChannel(channel2)).Data.(*model.Channel)
+
+	session5 := &model.UploadSession{ChannelId: channel2.Id, Filename: "build.log", FileSize: int64(len(data))}
+	session5 = Client.Must(Client.CreateUploadSession(session5)).Data.(*model.UploadSession)
+	Client.Must(Client.UploadChunk(session5.Id, 0, data))
+	Client.Must(Client.LeaveChannel(channel2.Id))
+
+	if _, err := Client.FinishUpload(session5.Id); err == nil {
+		t.Fatal("should have failed, no longer a member of the channel")
+	}
+
+	Client.Must(Client.CancelUpload(session5.Id))
+	Client.Must(Client.FinishUpload(session4.Id))
+
+	if err := backend.Remove(session4.Path()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Client.CreateUploadSession(&model.UploadSession{ChannelId: model.NewId(), Filename: "build.log", FileSize: 10}); err == nil {
+		t.Fatal("should have failed, not a member of the channel")
+	}
+}
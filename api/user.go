@@ -29,6 +29,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -42,6 +43,7 @@ func InitUser(r *mux.Router) {
 	sr.Handle("/update", ApiUserRequired(updateUser)).Methods("POST")
 	sr.Handle("/update_roles", ApiUserRequired(updateRoles)).Methods("POST")
 	sr.Handle("/update_active", ApiUserRequired(updateActive)).Methods("POST")
+	sr.Handle("/update_guest_expiry", ApiUserRequired(updateGuestExpiry)).Methods("POST")
 	sr.Handle("/update_notify", ApiUserRequired(updateUserNotify)).Methods("POST")
 	sr.Handle("/newpassword", ApiUserRequired(updatePassword)).Methods("POST")
 	sr.Handle("/send_password_reset", ApiAppHandler(sendPasswordReset)).Methods("POST")
@@ -62,6 +64,8 @@ func InitUser(r *mux.Router) {
 	sr.Handle("/me", ApiAppHandler(getMe)).Methods("GET")
 	sr.Handle("/me_logged_in", ApiAppHandler(getMeLoggedIn)).Methods("GET")
 	sr.Handle("/status", ApiUserRequiredActivity(getStatuses, false)).Methods("POST")
+	sr.Handle("/status/me", ApiUserRequired(getMyStatus)).Methods("GET")
+	sr.Handle("/status/set", ApiUserRequired(setStatus)).Methods("POST")
 	sr.Handle("/profiles", ApiUserRequired(getProfiles)).Methods("GET")
 	sr.Handle("/profiles/{id:[A-Za-z0-9]+}", ApiUserRequired(getProfiles)).Methods("GET")
 	sr.Handle("/{id:[A-Za-z0-9]+}", ApiUserRequired(getUser)).Methods("GET")
@@ -199,8 +203,10 @@ func IsVerifyHashRequired(user *model.User, team *model.Team, hash string) bool
 func CreateUser(team *model.Team, user *model.User) (*model.User, *model.AppError) {
 
 	channelRole := ""
+	teamRole := ""
+	user.Roles = ""
 	if team.Email == user.Email {
-		user.Roles = model.ROLE_TEAM_ADMIN
+		teamRole = model.ROLE_TEAM_ADMIN
 		channelRole = model.CHANNEL_ROLE_ADMIN
 
 		// Below is a speical case where the first user in the entire
@@ -213,9 +219,6 @@ func CreateUser(team *model.Team, user *model.User) (*model.User, *model.AppErro
 				user.Roles = model.ROLE_SYSTEM_ADMIN
 			}
 		}
-
-	} else {
-		user.Roles = ""
 	}
 
 	user.MakeNonNil()
@@ -226,8 +229,17 @@ func CreateUser(team *model.Team, user *model.User) (*model.User, *model.AppErro
 	} else {
 		ruser := result.Data.(*model.User)
 
+		if err := JoinUserToTeam(team.Id, ruser, teamRole); err != nil {
+			// don't leave behind an account that isn't on any team
+			if result := <-Srv.Store.User().PermanentDelete(ruser.Id); result.Err != nil {
+				l4g.Error(result.Err)
+			}
+
+			return nil, err
+		}
+
 		// Soft error if there is an issue joining the default channels
-		if err := JoinDefaultChannels(ruser, channelRole); err != nil {
+		if err := JoinDefaultChannels(team.Id, ruser, channelRole); err != nil {
 			l4g.Error(utils.T("api.user.create_user.joining.error"), ruser.Id, ruser.TeamId, err)
 		}
 
@@ -270,8 +282,8 @@ func CreateOAuthUser(c *Context, w http.ResponseWriter, r *http.Request, service
 		return nil
 	}
 
-	suchan := Srv.Store.User().GetByAuth(team.Id, user.AuthData, service)
-	euchan := Srv.Store.User().GetByEmail(team.Id, user.Email)
+	suchan := Srv.Store.User().GetByAuth(user.AuthData, service)
+	euchan := Srv.Store.User().GetByEmail(user.Email)
 
 	if team.Email == "" {
 		team.Email = user.Email
@@ -283,7 +295,7 @@ func CreateOAuthUser(c *Context, w http.ResponseWriter, r *http.Request, service
 		found := true
 		count := 0
 		for found {
-			if found = IsUsernameTaken(user.Username, team.Id); c.Err != nil {
+			if found = IsUsernameTaken(user.Username); c.Err != nil {
 				return nil
 			} else if found {
 				user.Username = user.Username + strconv.Itoa(count)
@@ -434,7 +446,7 @@ func LoginByEmail(c *Context, w http.ResponseWriter, r *http.Request, email, nam
 		team = result.Data.(*model.Team)
 	}
 
-	if result := <-Srv.Store.User().GetByEmail(team.Id, email); result.Err != nil {
+	if result := <-Srv.Store.User().GetByEmail(email); result.Err != nil {
 		c.Err = result.Err
 		c.Err.StatusCode = http.StatusForbidden
 		return nil
@@ -447,7 +459,7 @@ func LoginByEmail(c *Context, w http.ResponseWriter, r *http.Request, email, nam
 			return nil
 		}
 
-		if authenticateUserPasswordAndToken(c, user, password, mfaToken) {
+		if authenticateUserPasswordAndToken(c, user, password, mfaToken) && checkUserIsTeamMember(c, user, team) {
 			Login(c, w, r, user, deviceId)
 			return user
 		}
@@ -466,7 +478,7 @@ func LoginByUsername(c *Context, w http.ResponseWriter, r *http.Request, usernam
 		team = result.Data.(*model.Team)
 	}
 
-	if result := <-Srv.Store.User().GetByUsername(team.Id, username); result.Err != nil {
+	if result := <-Srv.Store.User().GetByUsername(username); result.Err != nil {
 		c.Err = result.Err
 		c.Err.StatusCode = http.StatusForbidden
 		return nil
@@ -479,7 +491,7 @@ func LoginByUsername(c *Context, w http.ResponseWriter, r *http.Request, usernam
 			return nil
 		}
 
-		if authenticateUserPasswordAndToken(c, user, password, mfaToken) {
+		if authenticateUserPasswordAndToken(c, user, password, mfaToken) && checkUserIsTeamMember(c, user, team) {
 			Login(c, w, r, user, deviceId)
 			return user
 		}
@@ -509,7 +521,7 @@ func LoginByOAuth(c *Context, w http.ResponseWriter, r *http.Request, service st
 	}
 
 	var user *model.User
-	if result := <-Srv.Store.User().GetByAuth(team.Id, authData, service); result.Err != nil {
+	if result := <-Srv.Store.User().GetByAuth(authData, service); result.Err != nil {
 		if result.Err.Id == store.MISSING_AUTH_ACCOUNT_ERROR && team.AllowOpenInvite {
 			return CreateOAuthUser(c, w, r, service, bytes.NewReader(buf.Bytes()), team)
 		}
@@ -517,11 +529,30 @@ func LoginByOAuth(c *Context, w http.ResponseWriter, r *http.Request, service st
 		return nil
 	} else {
 		user = result.Data.(*model.User)
+		if !checkUserIsTeamMember(c, user, team) {
+			return nil
+		}
+
 		Login(c, w, r, user, "")
 		return user
 	}
 }
 
+// checkUserIsTeamMember makes sure that the user belongs to the team they're
+// signing in to, which then becomes the team that their session starts in.
+func checkUserIsTeamMember(c *Context, user *model.User, team *model.Team) bool {
+	if result := <-Srv.Store.Team().GetMember(team.Id, user.Id); result.Err != nil || result.Data.(*model.TeamMember).DeleteAt != 0 {
+		c.LogAuditWithUserId(user.Id, "fail - not a team member")
+		c.Err = model.NewLocAppError("checkUserIsTeamMember", "api.user.check_user_is_team_member.app_error",
+			map[string]interface{}{"TeamDisplayName": team.DisplayName}, "user_id="+user.Id+", team_id="+team.Id)
+		c.Err.StatusCode = http.StatusForbidden
+		return false
+	}
+
+	user.TeamId = team.Id
+	return true
+}
+
 func authenticateUserPasswordAndToken(c *Context, user *model.User, password string, token string) bool {
 	return checkUserLoginAttempts(c, user) && checkUserMfa(c, user, token) && checkUserPassword(c, user, password)
 }
@@ -596,6 +627,19 @@ func Login(c *Context, w http.ResponseWriter, r *http.Request, user *model.User,
 		return
 	}
 
+	// bots only ever use access tokens
+	if user.IsBot {
+		c.Err = model.NewLocAppError("Login", "api.user.login.bot.app_error", nil, "user_id="+user.Id)
+		c.Err.StatusCode = http.StatusForbidden
+		return
+	}
+
+	if user.IsGuestExpired() {
+		c.Err = model.NewLocAppError("Login", "api.user.login.guest_expired.app_error", nil, "user_id="+user.Id)
+		c.Err.StatusCode = http.StatusForbidden
+		return
+	}
+
 	session := &model.Session{UserId: user.Id, TeamId: user.TeamId, Roles: user.Roles, DeviceId: deviceId, IsOAuth: false}
 
 	maxAge := *utils.Cfg.ServiceSettings.SessionLengthWebInDays * 60 * 60 * 24
@@ -626,6 +670,11 @@ func Login(c *Context, w http.ResponseWriter, r *http.Request, user *model.User,
 		session.SetExpireInDays(*utils.Cfg.ServiceSettings.SessionLengthWebInDays)
 	}
 
+	// a guest's session can't outlast their access
+	if user.IsGuest() && user.GuestExpiresAt != 0 && (session.ExpiresAt == 0 || session.ExpiresAt > user.GuestExpiresAt) {
+		session.ExpiresAt = user.GuestExpiresAt
+	}
+
 	ua := user_agent.New(r.UserAgent())
 
 	plat := ua.Platform()
@@ -769,6 +818,10 @@ func loginLdap(c *Context, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !checkUserIsTeamMember(c, user, team) {
+		return
+	}
+
 	// User is authenticated at this point
 
 	Login(c, w, r, user, props["device_id"])
@@ -991,6 +1044,19 @@ func getProfiles(c *Context, w http.ResponseWriter, r *http.Request) {
 	}
 
 	etag := (<-Srv.Store.User().GetEtagForProfiles(id)).Data.(string)
+
+	// guests and the people they can see depend on who shares a channel
+	var sharedUserIds map[string]bool
+	if !c.IsSystemAdmin() {
+		if result := <-Srv.Store.Channel().GetUserIdsInSharedChannels(id, c.Session.UserId); result.Err != nil {
+			c.Err = result.Err
+			return
+		} else {
+			sharedUserIds = result.Data.(map[string]bool)
+			etag = model.Etag(etag, hashUserIds(sharedUserIds))
+		}
+	}
+
 	if HandleEtag(etag, w, r) {
 		return
 	}
@@ -1001,6 +1067,14 @@ func getProfiles(c *Context, w http.ResponseWriter, r *http.Request) {
 	} else {
 		profiles := result.Data.(map[string]*model.User)
 
+		if sharedUserIds != nil {
+			for k, p := range profiles {
+				if (c.IsGuest() || p.IsGuest()) && !sharedUserIds[p.Id] {
+					delete(profiles, k)
+				}
+			}
+		}
+
 		for k, p := range profiles {
 			options := utils.Cfg.GetSanitizeOptions()
 			options["passwordupdate"] = false
@@ -1021,6 +1095,20 @@ func getProfiles(c *Context, w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// hashUserIds makes a short, stable summary of a set of user ids for use in an
+// etag.
+func hashUserIds(userIds map[string]bool) string {
+	ids := make([]string, 0, len(userIds))
+	for id := range userIds {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	h := fnv.New64a()
+	h.Write([]byte(strings.Join(ids, ",")))
+	return strconv.FormatUint(h.Sum64(), 36)
+}
+
 func getAudits(c *Context, w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
 	id := params["id"]
@@ -1391,7 +1479,7 @@ func updateRoles(c *Context, w http.ResponseWriter, r *http.Request) {
 	}
 
 	new_roles := props["new_roles"]
-	if !model.IsValidRoles(new_roles) {
+	if !isValidTeamRoles(c.Session.TeamId, new_roles) {
 		c.SetInvalidParam("updateRoles", "new_roles")
 		return
 	}
@@ -1410,11 +1498,12 @@ func updateRoles(c *Context, w http.ResponseWriter, r *http.Request) {
 		user = result.Data.(*model.User)
 	}
 
-	if !c.HasPermissionsToTeam(user.TeamId, "updateRoles") {
+	if !checkIsTeamMember(c, c.Session.TeamId, user.Id, "updateRoles") {
 		return
 	}
 
-	if !c.IsTeamAdmin() {
+	// only team admins can make someone else one
+	if !c.HasPermission(model.PERMISSION_MANAGE_ROLES, c.Session.TeamId) || (model.IsInRole(new_roles, model.ROLE_TEAM_ADMIN) && !c.IsTeamAdmin()) {
 		c.Err = model.NewLocAppError("updateRoles", "api.user.update_roles.permissions.app_error", nil, "userId="+user_id)
 		c.Err.StatusCode = http.StatusForbidden
 		return
@@ -1426,61 +1515,86 @@ func updateRoles(c *Context, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ruser := UpdateRoles(c, user, new_roles)
-	if c.Err != nil {
+	var member *model.TeamMember
+	if result := <-Srv.Store.Team().GetMember(c.Session.TeamId, user.Id); result.Err != nil {
+		c.Err = result.Err
 		return
+	} else {
+		member = result.Data.(*model.TeamMember)
 	}
 
-	uchan := Srv.Store.Session().UpdateRoles(user.Id, new_roles)
-	gchan := Srv.Store.Session().GetSessions(user.Id)
+	// a custom role can't be used to give out more than the caller has
+	if !checkCanGrantRoles(c, c.Session.TeamId, new_roles, member.Roles, "updateRoles") {
+		return
+	}
 
-	if result := <-uchan; result.Err != nil {
-		// soft error since the user roles were still updated
-		l4g.Error(result.Err)
+	// team admins can only change the roles a user has in their team
+	if getSystemRoles(new_roles) != getSystemRoles(user.Roles) && !c.HasPermission(model.PERMISSION_MANAGE_SYSTEM, c.Session.TeamId) {
+		c.Err = model.NewLocAppError("updateRoles", "api.user.update_roles.system_roles.app_error", nil, "userId="+user_id)
+		c.Err.StatusCode = http.StatusForbidden
+		return
 	}
 
-	if result := <-gchan; result.Err != nil {
+	ruser := UpdateRoles(c, user, new_roles)
+	if c.Err != nil {
+		return
+	}
+
+	if result := <-Srv.Store.Session().UpdateRoles(user.Id, ruser.Roles); result.Err != nil {
 		// soft error since the user roles were still updated
 		l4g.Error(result.Err)
-	} else {
-		sessions := result.Data.([]*model.Session)
-		for _, s := range sessions {
-			sessionCache.Remove(s.Token)
-		}
 	}
 
+	RemoveAllSessionsForUserIdFromCache(user.Id)
+
 	options := utils.Cfg.GetSanitizeOptions()
 	options["passwordupdate"] = false
 	ruser.Sanitize(options)
 	w.Write([]byte(ruser.ToJson()))
 }
 
+// UpdateRoles gives the user the roles, putting the team admin role and any
+// custom roles on their membership of the current team and any system roles on
+// the user.
 func UpdateRoles(c *Context, user *model.User, roles string) *model.User {
-	// make sure there is at least 1 other active admin
+	var member *model.TeamMember
+	if result := <-Srv.Store.Team().GetMember(c.Session.TeamId, user.Id); result.Err != nil {
+		c.Err = result.Err
+		return nil
+	} else {
+		member = result.Data.(*model.TeamMember)
+	}
 
-	if !model.IsInRole(roles, model.ROLE_SYSTEM_ADMIN) {
-		if model.IsInRole(user.Roles, model.ROLE_TEAM_ADMIN) && !model.IsInRole(roles, model.ROLE_TEAM_ADMIN) {
-			if result := <-Srv.Store.User().GetProfiles(user.TeamId); result.Err != nil {
-				c.Err = result.Err
-				return nil
-			} else {
-				activeAdmins := -1
-				profileUsers := result.Data.(map[string]*model.User)
-				for _, profileUser := range profileUsers {
-					if profileUser.DeleteAt == 0 && model.IsInRole(profileUser.Roles, model.ROLE_TEAM_ADMIN) {
-						activeAdmins = activeAdmins + 1
-					}
-				}
+	teamRoleNames := []string{}
+	for _, role := range strings.Fields(roles) {
+		if role == model.ROLE_TEAM_ADMIN || !model.IsBuiltInRole(role) {
+			teamRoleNames = append(teamRoleNames, role)
+		}
+	}
+	teamRoles := strings.Join(teamRoleNames, " ")
 
-				if activeAdmins <= 0 {
-					c.Err = model.NewLocAppError("updateRoles", "api.user.update_roles.one_admin.app_error", nil, "")
-					return nil
-				}
-			}
+	userRoles := getSystemRoles(roles)
+
+	// make sure there is at least 1 other active admin
+	if !model.IsInRole(roles, model.ROLE_SYSTEM_ADMIN) && member.IsTeamAdmin() && !model.IsInRole(teamRoles, model.ROLE_TEAM_ADMIN) {
+		if count, err := countOtherActiveTeamAdmins(member.TeamId, user.Id); err != nil {
+			c.Err = err
+			return nil
+		} else if count == 0 {
+			c.Err = model.NewLocAppError("updateRoles", "api.user.update_roles.one_admin.app_error", nil, "")
+			return nil
 		}
 	}
 
-	user.Roles = roles
+	if member.Roles != teamRoles {
+		member.Roles = teamRoles
+		if result := <-Srv.Store.Team().UpdateMember(member); result.Err != nil {
+			c.Err = result.Err
+			return nil
+		}
+	}
+
+	user.Roles = userRoles
 
 	var ruser *model.User
 	if result := <-Srv.Store.User().Update(user, true); result.Err != nil {
@@ -1491,9 +1605,64 @@ func UpdateRoles(c *Context, user *model.User, roles string) *model.User {
 		ruser = result.Data.([2]*model.User)[0]
 	}
 
+	RemoveAllSessionsForUserIdFromCache(user.Id)
+
 	return ruser
 }
 
+// getSystemRoles returns the roles out of roles that are kept on the user
+// rather than on their team membership.
+func getSystemRoles(roles string) string {
+	if model.IsInRole(roles, model.ROLE_SYSTEM_ADMIN) {
+		return model.ROLE_SYSTEM_ADMIN
+	} else if model.IsInRole(roles, model.ROLE_GUEST) {
+		return model.ROLE_GUEST
+	}
+
+	return ""
+}
+
+// countOtherActiveTeamAdmins returns how many active users other than userId
+// are admins of the team.
+func countOtherActiveTeamAdmins(teamId string, userId string) (int, *model.AppError) {
+	mchan := Srv.Store.Team().GetMembers(teamId)
+	pchan := Srv.Store.User().GetProfiles(teamId)
+
+	var members []*model.TeamMember
+	if result := <-mchan; result.Err != nil {
+		return 0, result.Err
+	} else {
+		members = result.Data.([]*model.TeamMember)
+	}
+
+	var profiles map[string]*model.User
+	if result := <-pchan; result.Err != nil {
+		return 0, result.Err
+	} else {
+		profiles = result.Data.(map[string]*model.User)
+	}
+
+	count := 0
+	for _, member := range members {
+		if profile, ok := profiles[member.UserId]; ok && member.UserId != userId && member.IsTeamAdmin() && profile.DeleteAt == 0 {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// checkIsTeamMember makes sure that the user is an active member of the team.
+func checkIsTeamMember(c *Context, teamId string, userId string, where string) bool {
+	if result := <-Srv.Store.Team().GetMember(teamId, userId); result.Err != nil || result.Data.(*model.TeamMember).DeleteAt != 0 {
+		c.Err = model.NewLocAppError(where, "api.context.permissions.app_error", nil, "userId="+userId+", teamId="+teamId)
+		c.Err.StatusCode = http.StatusForbidden
+		return false
+	}
+
+	return true
+}
+
 func updateActive(c *Context, w http.ResponseWriter, r *http.Request) {
 	props := model.MapFromJson(r.Body)
 
@@ -1513,34 +1682,24 @@ func updateActive(c *Context, w http.ResponseWriter, r *http.Request) {
 		user = result.Data.(*model.User)
 	}
 
-	if !c.HasPermissionsToTeam(user.TeamId, "updateActive") {
+	if !checkIsTeamMember(c, c.Session.TeamId, user.Id, "updateActive") {
 		return
 	}
 
-	if !c.IsTeamAdmin() {
+	if !c.HasPermission(model.PERMISSION_MANAGE_USERS, c.Session.TeamId) {
 		c.Err = model.NewLocAppError("updateActive", "api.user.update_active.permissions.app_error", nil, "userId="+user_id)
 		c.Err.StatusCode = http.StatusForbidden
 		return
 	}
 
 	// make sure there is at least 1 other active admin
-	if !active && model.IsInRole(user.Roles, model.ROLE_TEAM_ADMIN) {
-		if result := <-Srv.Store.User().GetProfiles(user.TeamId); result.Err != nil {
-			c.Err = result.Err
+	if result := <-Srv.Store.Team().GetMember(c.Session.TeamId, user.Id); !active && result.Err == nil && result.Data.(*model.TeamMember).IsTeamAdmin() {
+		if count, err := countOtherActiveTeamAdmins(c.Session.TeamId, user.Id); err != nil {
+			c.Err = err
+			return
+		} else if count == 0 {
+			c.Err = model.NewLocAppError("updateRoles", "api.user.update_roles.one_admin.app_error", nil, "userId="+user_id)
 			return
-		} else {
-			activeAdmins := -1
-			profileUsers := result.Data.(map[string]*model.User)
-			for _, profileUser := range profileUsers {
-				if profileUser.DeleteAt == 0 && model.IsInRole(profileUser.Roles, model.ROLE_TEAM_ADMIN) {
-					activeAdmins = activeAdmins + 1
-				}
-			}
-
-			if activeAdmins <= 0 {
-				c.Err = model.NewLocAppError("updateRoles", "api.user.update_roles.one_admin.app_error", nil, "userId="+user_id)
-				return
-			}
 		}
 	}
 
@@ -1551,6 +1710,65 @@ func updateActive(c *Context, w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// updateGuestExpiry sets when a guest will no longer be able to log in, or
+// clears it if expires_at is 0. The guest is logged out so that their new
+// sessions end when their access does.
+func updateGuestExpiry(c *Context, w http.ResponseWriter, r *http.Request) {
+	props := model.MapFromJson(r.Body)
+
+	userId := props["user_id"]
+	if len(userId) != 26 {
+		c.SetInvalidParam("updateGuestExpiry", "user_id")
+		return
+	}
+
+	expiresAt, err := strconv.ParseInt(props["expires_at"], 10, 64)
+	if err != nil || expiresAt < 0 {
+		c.SetInvalidParam("updateGuestExpiry", "expires_at")
+		return
+	}
+
+	var user *model.User
+	if result := <-Srv.Store.User().Get(userId); result.Err != nil {
+		c.Err = result.Err
+		return
+	} else {
+		user = result.Data.(*model.User)
+	}
+
+	if !checkIsTeamMember(c, c.Session.TeamId, user.Id, "updateGuestExpiry") {
+		return
+	}
+
+	if !c.HasPermission(model.PERMISSION_MANAGE_USERS, c.Session.TeamId) {
+		c.Err = model.NewLocAppError("updateGuestExpiry", "api.user.update_guest_expiry.permissions.app_error", nil, "userId="+userId)
+		c.Err.StatusCode = http.StatusForbidden
+		return
+	}
+
+	if !user.IsGuest() {
+		c.Err = model.NewLocAppError("updateGuestExpiry", "api.user.update_guest_expiry.not_guest.app_error", nil, "userId="+userId)
+		c.Err.StatusCode = http.StatusBadRequest
+		return
+	}
+
+	if result := <-Srv.Store.User().UpdateGuestExpiresAt(user.Id, expiresAt); result.Err != nil {
+		c.Err = result.Err
+		return
+	}
+
+	c.LogAuditWithUserId(user.Id, fmt.Sprintf("guest_expires_at=%v", expiresAt))
+
+	RevokeAllSession(c, user.Id)
+	if c.Err != nil {
+		return
+	}
+
+	RemoveAllSessionsForUserIdFromCache(user.Id)
+
+	w.Write([]byte(model.MapToJson(props)))
+}
+
 func UpdateActive(c *Context, user *model.User, active bool) *model.User {
 	if active {
 		user.DeleteAt = 0
@@ -1566,6 +1784,9 @@ func UpdateActive(c *Context, user *model.User, active bool) *model.User {
 
 		if user.DeleteAt > 0 {
 			RevokeAllSession(c, user.Id)
+
+			// access tokens outlive sessions but stop working with the account
+			RemoveAllSessionsForUserIdFromCache(user.Id)
 		}
 
 		if extra := <-Srv.Store.Channel().ExtraUpdateByUser(user.Id, model.GetMillis()); extra.Err != nil {
@@ -1619,10 +1840,38 @@ func PermanentDeleteUser(c *Context, user *model.User) *model.AppError {
 		return result.Err
 	}
 
+	if result := <-Srv.Store.Thread().PermanentDeleteByUser(user.Id); result.Err != nil {
+		return result.Err
+	}
+
+	if result := <-Srv.Store.Reaction().PermanentDeleteByUser(user.Id); result.Err != nil {
+		return result.Err
+	}
+
+	if result := <-Srv.Store.ScheduledPost().PermanentDeleteByUser(user.Id); result.Err != nil {
+		return result.Err
+	}
+
+	if result := <-Srv.Store.EmailNotification().PermanentDeleteByUser(user.Id); result.Err != nil {
+		return result.Err
+	}
+
+	if result := <-Srv.Store.Status().PermanentDeleteByUser(user.Id); result.Err != nil {
+		return result.Err
+	}
+
 	if result := <-Srv.Store.Post().PermanentDeleteByUser(user.Id); result.Err != nil {
 		return result.Err
 	}
 
+	if result := <-Srv.Store.UserAccessToken().PermanentDeleteByUser(user.Id); result.Err != nil {
+		return result.Err
+	}
+
+	if result := <-Srv.Store.Team().RemoveAllMembersByUser(user.Id); result.Err != nil {
+		return result.Err
+	}
+
 	if result := <-Srv.Store.User().PermanentDelete(user.Id); result.Err != nil {
 		return result.Err
 	}
@@ -1661,7 +1910,7 @@ func sendPasswordReset(c *Context, w http.ResponseWriter, r *http.Request) {
 	}
 
 	var user *model.User
-	if result := <-Srv.Store.User().GetByEmail(team.Id, email); result.Err != nil {
+	if result := <-Srv.Store.User().GetByEmail(email); result.Err != nil {
 		c.Err = model.NewLocAppError("sendPasswordReset", "api.user.send_password_reset.find.app_error", nil, "email="+email+" team_id="+team.Id)
 		return
 	} else {
@@ -1886,6 +2135,11 @@ func updateUserNotify(c *Context, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if interval, ok := props["email_interval"]; ok && !model.IsValidEmailInterval(interval) {
+		c.SetInvalidParam("updateUserNotify", "email_interval")
+		return
+	}
+
 	desktop_sound := props["desktop_sound"]
 	if len(desktop_sound) == 0 {
 		c.SetInvalidParam("updateUserNotify", "desktop_sound")
@@ -1929,12 +2183,24 @@ func getStatuses(c *Context, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if result := <-Srv.Store.User().GetProfiles(c.Session.TeamId); result.Err != nil {
+	pchan := Srv.Store.User().GetProfiles(c.Session.TeamId)
+	schan := Srv.Store.Status().GetByUserIds(userIds)
+
+	var manualStatuses map[string]*model.Status
+	if result := <-schan; result.Err != nil {
+		c.Err = result.Err
+		return
+	} else {
+		manualStatuses = result.Data.(map[string]*model.Status)
+	}
+
+	if result := <-pchan; result.Err != nil {
 		c.Err = result.Err
 		return
 	} else {
 		profiles := result.Data.(map[string]*model.User)
 
+		now := model.GetMillis()
 		statuses := map[string]string{}
 		for _, profile := range profiles {
 			found := false
@@ -1948,13 +2214,7 @@ func getStatuses(c *Context, w http.ResponseWriter, r *http.Request) {
 				continue
 			}
 
-			if profile.IsOffline() {
-				statuses[profile.Id] = model.USER_OFFLINE
-			} else if profile.IsAway() {
-				statuses[profile.Id] = model.USER_AWAY
-			} else {
-				statuses[profile.Id] = model.USER_ONLINE
-			}
+			statuses[profile.Id] = manualStatuses[profile.Id].GetEffectiveStatus(profile, now)
 		}
 
 		//w.Header().Set("Cache-Control", "max-age=9, public") // 2 mins
@@ -1963,6 +2223,52 @@ func getStatuses(c *Context, w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func getMyStatus(c *Context, w http.ResponseWriter, r *http.Request) {
+	if result := <-Srv.Store.Status().Get(c.Session.UserId); result.Err != nil {
+		if result.Err.Id != "store.sql_status.get.missing.app_error" {
+			c.Err = result.Err
+			return
+		}
+
+		// the user has never set their status so it's entirely automatic
+		status := &model.Status{UserId: c.Session.UserId}
+		w.Write([]byte(status.ToJson()))
+	} else {
+		w.Write([]byte(result.Data.(*model.Status).ToJson()))
+	}
+}
+
+func setStatus(c *Context, w http.ResponseWriter, r *http.Request) {
+	status := model.StatusFromJson(r.Body)
+	if status == nil {
+		c.SetInvalidParam("setStatus", "status")
+		return
+	}
+
+	status.UserId = c.Session.UserId
+
+	uchan := Srv.Store.User().Get(c.Session.UserId)
+
+	if result := <-Srv.Store.Status().SaveOrUpdate(status); result.Err != nil {
+		c.Err = result.Err
+		return
+	}
+
+	if result := <-uchan; result.Err != nil {
+		c.Err = result.Err
+		return
+	} else {
+		user := result.Data.(*model.User)
+
+		message := model.NewMessage(c.Session.TeamId, "", c.Session.UserId, model.ACTION_STATUS_CHANGE)
+		message.Add("status", status.GetEffectiveStatus(user, model.GetMillis()))
+
+		PublishAndForget(message)
+	}
+
+	w.Write([]byte(status.ToJson()))
+}
+
 func GetAuthorizationCode(c *Context, service, teamName string, props map[string]string, loginHint string) (string, *model.AppError) {
 
 	sso := utils.Cfg.GetSSOService(service)
@@ -2075,13 +2381,13 @@ func AuthorizeOAuthUser(service, code, state, redirectUri string) (io.ReadCloser
 
 }
 
-func IsUsernameTaken(name string, teamId string) bool {
+func IsUsernameTaken(name string) bool {
 
 	if !model.IsValidUsername(name) {
 		return false
 	}
 
-	if result := <-Srv.Store.User().GetByUsername(teamId, name); result.Err != nil {
+	if result := <-Srv.Store.User().GetByUsername(name); result.Err != nil {
 		return false
 	} else {
 		return true
@@ -2129,7 +2435,7 @@ func emailToOAuth(c *Context, w http.ResponseWriter, r *http.Request) {
 	}
 
 	var user *model.User
-	if result := <-Srv.Store.User().GetByEmail(team.Id, email); result.Err != nil {
+	if result := <-Srv.Store.User().GetByEmail(email); result.Err != nil {
 		c.LogAudit("fail - couldn't get user")
 		c.Err = result.Err
 		return
@@ -2137,6 +2443,10 @@ func emailToOAuth(c *Context, w http.ResponseWriter, r *http.Request) {
 		user = result.Data.(*model.User)
 	}
 
+	if !checkUserIsTeamMember(c, user, team) {
+		return
+	}
+
 	if !checkUserLoginAttempts(c, user) || !checkUserPassword(c, user, password) {
 		c.LogAuditWithUserId(user.Id, "fail - invalid password")
 		return
@@ -2185,7 +2495,7 @@ func CompleteSwitchWithOAuth(c *Context, w http.ResponseWriter, r *http.Request,
 	}
 
 	var user *model.User
-	if result := <-Srv.Store.User().GetByEmail(team.Id, email); result.Err != nil {
+	if result := <-Srv.Store.User().GetByEmail(email); result.Err != nil {
 		c.Err = result.Err
 		return
 	} else {
@@ -2238,7 +2548,7 @@ func oauthToEmail(c *Context, w http.ResponseWriter, r *http.Request) {
 	}
 
 	var user *model.User
-	if result := <-Srv.Store.User().GetByEmail(team.Id, email); result.Err != nil {
+	if result := <-Srv.Store.User().GetByEmail(email); result.Err != nil {
 		c.LogAudit("fail - couldn't get user")
 		c.Err = result.Err
 		return
@@ -2318,7 +2628,7 @@ func emailToLdap(c *Context, w http.ResponseWriter, r *http.Request) {
 	}
 
 	var user *model.User
-	if result := <-Srv.Store.User().GetByEmail(team.Id, email); result.Err != nil {
+	if result := <-Srv.Store.User().GetByEmail(email); result.Err != nil {
 		c.LogAudit("fail - couldn't get user")
 		c.Err = result.Err
 		return
@@ -2397,7 +2707,7 @@ func ldapToEmail(c *Context, w http.ResponseWriter, r *http.Request) {
 	}
 
 	var user *model.User
-	if result := <-Srv.Store.User().GetByEmail(team.Id, email); result.Err != nil {
+	if result := <-Srv.Store.User().GetByEmail(email); result.Err != nil {
 		c.LogAudit("fail - couldn't get user")
 		c.Err = result.Err
 		return
@@ -2514,7 +2824,7 @@ func resendVerification(c *Context, w http.ResponseWriter, r *http.Request) {
 		team = result.Data.(*model.Team)
 	}
 
-	if result := <-Srv.Store.User().GetByEmail(team.Id, email); result.Err != nil {
+	if result := <-Srv.Store.User().GetByEmail(email); result.Err != nil {
 		c.Err = result.Err
 		return
 	} else {
@@ -2645,21 +2955,18 @@ func checkMfa(c *Context, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var team *model.Team
 	if result := <-Srv.Store.Team().GetByName(teamName); result.Err != nil {
 		c.Err = result.Err
 		return
-	} else {
-		team = result.Data.(*model.Team)
 	}
 
 	var uchan store.StoreChannel
 	if method == model.USER_AUTH_SERVICE_EMAIL {
-		uchan = Srv.Store.User().GetByEmail(team.Id, loginId)
+		uchan = Srv.Store.User().GetByEmail(loginId)
 	} else if method == model.USER_AUTH_SERVICE_USERNAME {
-		uchan = Srv.Store.User().GetByUsername(team.Id, loginId)
+		uchan = Srv.Store.User().GetByUsername(loginId)
 	} else if method == model.USER_AUTH_SERVICE_LDAP {
-		uchan = Srv.Store.User().GetByAuth(team.Id, loginId, model.USER_AUTH_SERVICE_LDAP)
+		uchan = Srv.Store.User().GetByAuth(loginId, model.USER_AUTH_SERVICE_LDAP)
 	}
 
 	rdata := map[string]string{}
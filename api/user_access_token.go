@@ -0,0 +1,226 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package api
+
+import (
+	"net/http"
+
+	l4g "github.com/alecthomas/log4go"
+	"github.com/gorilla/mux"
+	"github.com/mattermost/platform/model"
+	"github.com/mattermost/platform/utils"
+)
+
+func InitUserAccessToken(r *mux.Router) {
+	l4g.Debug(utils.T("api.user_access_token.init.debug"))
+
+	sr := r.PathPrefix("/users").Subrouter()
+	sr.Handle("/{id:[A-Za-z0-9]+}/tokens", ApiUserRequired(getUserAccessTokens)).Methods("GET")
+	sr.Handle("/{id:[A-Za-z0-9]+}/tokens/create", ApiUserRequired(createUserAccessToken)).Methods("POST")
+	sr.Handle("/tokens/revoke", ApiUserRequired(revokeUserAccessToken)).Methods("POST")
+}
+
+func checkUserAccessTokensEnabled(c *Context, where string) bool {
+	if !*utils.Cfg.ServiceSettings.EnableUserAccessTokens {
+		c.Err = model.NewLocAppError(where, "api.user_access_token.disabled.app_error", nil, "")
+		c.Err.StatusCode = http.StatusNotImplemented
+		return false
+	}
+
+	return true
+}
+
+func createUserAccessToken(c *Context, w http.ResponseWriter, r *http.Request) {
+	if !checkUserAccessTokensEnabled(c, "createUserAccessToken") {
+		return
+	}
+
+	params := mux.Vars(r)
+	userId := params["id"]
+
+	if !hasPermissionsToUserOrBot(c, userId, "createUserAccessToken") {
+		return
+	}
+
+	// otherwise a read only token could be used to make one that can write
+	if c.Session.IsUserAccessToken() {
+		c.Err = model.NewLocAppError("createUserAccessToken", "api.user_access_token.create.from_token.app_error", nil, "")
+		c.Err.StatusCode = http.StatusForbidden
+		return
+	}
+
+	token := model.UserAccessTokenFromJson(r.Body)
+	if token == nil {
+		c.SetInvalidParam("createUserAccessToken", "token")
+		return
+	}
+
+	token.Id = ""
+	token.UserId = userId
+
+	if result := <-Srv.Store.User().Get(userId); result.Err != nil {
+		c.Err = result.Err
+		return
+	} else if result.Data.(*model.User).DeleteAt != 0 {
+		c.SetInvalidParam("createUserAccessToken", "user_id")
+		return
+	} else if c.IsGuest() || result.Data.(*model.User).IsGuest() {
+		// a token would outlive the limits that a guest's session is held to
+		c.Err = model.NewLocAppError("createUserAccessToken", "api.user_access_token.create.guest.app_error", nil, "user_id="+userId)
+		c.Err.StatusCode = http.StatusForbidden
+		return
+	}
+
+	if result := <-Srv.Store.UserAccessToken().Save(token); result.Err != nil {
+		c.Err = result.Err
+		return
+	} else {
+		token = result.Data.(*model.UserAccessToken)
+	}
+
+	c.LogAuditWithUserId(userId, "token_id="+token.Id+" scopes="+token.Scopes)
+
+	// the only time the token itself is ever sent
+	w.Write([]byte(token.ToJson()))
+}
+
+func getUserAccessTokens(c *Context, w http.ResponseWriter, r *http.Request) {
+	if !checkUserAccessTokensEnabled(c, "getUserAccessTokens") {
+		return
+	}
+
+	params := mux.Vars(r)
+	userId := params["id"]
+
+	if !hasPermissionsToUserOrBot(c, userId, "getUserAccessTokens") {
+		return
+	}
+
+	if result := <-Srv.Store.UserAccessToken().GetByUser(userId); result.Err != nil {
+		c.Err = result.Err
+		return
+	} else {
+		w.Write([]byte(model.UserAccessTokensToJson(result.Data.([]*model.UserAccessToken))))
+	}
+}
+
+func revokeUserAccessToken(c *Context, w http.ResponseWriter, r *http.Request) {
+	if !checkUserAccessTokensEnabled(c, "revokeUserAccessToken") {
+		return
+	}
+
+	props := model.MapFromJson(r.Body)
+
+	tokenId := props["token_id"]
+	if len(tokenId) != 26 {
+		c.SetInvalidParam("revokeUserAccessToken", "token_id")
+		return
+	}
+
+	var token *model.UserAccessToken
+	if result := <-Srv.Store.UserAccessToken().Get(tokenId); result.Err != nil {
+		c.Err = result.Err
+		return
+	} else {
+		token = result.Data.(*model.UserAccessToken)
+	}
+
+	if !hasPermissionsToUserOrBot(c, token.UserId, "revokeUserAccessToken") {
+		return
+	}
+
+	if result := <-Srv.Store.UserAccessToken().Delete(token.Id); result.Err != nil {
+		c.Err = result.Err
+		return
+	}
+
+	RemoveUserAccessTokenFromCache(token.Id)
+
+	c.LogAuditWithUserId(token.UserId, "token_id="+token.Id)
+	w.Write([]byte(model.MapToJson(props)))
+}
+
+// GetSessionForUserAccessToken makes a session for a request that uses a
+// personal access token instead of logging in. The session isn't stored, only
+// cached, so the use is recorded in the user's audits whenever the token isn't
+// already in the cache rather than on every request.
+func GetSessionForUserAccessToken(tokenString string, ipAddress string, path string) *model.Session {
+	if !*utils.Cfg.ServiceSettings.EnableUserAccessTokens {
+		return nil
+	}
+
+	var token *model.UserAccessToken
+	if result := <-Srv.Store.UserAccessToken().GetByToken(tokenString); result.Err != nil {
+		return nil
+	} else {
+		token = result.Data.(*model.UserAccessToken)
+	}
+
+	var user *model.User
+	if result := <-Srv.Store.User().Get(token.UserId); result.Err != nil {
+		l4g.Error(utils.T("api.user_access_token.get_session.user.error"), token.Id, result.Err)
+		return nil
+	} else {
+		user = result.Data.(*model.User)
+	}
+
+	if user.DeleteAt != 0 || user.IsGuestExpired() {
+		return nil
+	}
+
+	now := model.GetMillis()
+
+	session := &model.Session{
+		Id:             token.Id,
+		Token:          tokenString,
+		CreateAt:       token.CreateAt,
+		LastActivityAt: now,
+		UserId:         user.Id,
+		TeamId:         user.TeamId,
+		Roles:          user.Roles,
+	}
+	session.AddProp(model.SESSION_PROP_TYPE, model.SESSION_TYPE_USER_ACCESS_TOKEN)
+	session.AddProp(model.SESSION_PROP_USER_ACCESS_TOKEN_ID, token.Id)
+	session.AddProp(model.SESSION_PROP_USER_ACCESS_TOKEN_SCOPE, token.Scopes)
+
+	if result := <-Srv.Store.UserAccessToken().UpdateLastUsedAt(token.Id, now); result.Err != nil {
+		l4g.Error(utils.T("api.user_access_token.get_session.last_used.error"), token.Id, result.Err)
+	}
+
+	audit := &model.Audit{UserId: user.Id, IpAddress: ipAddress, Action: path, ExtraInfo: "user_access_token_id=" + token.Id, SessionId: token.Id}
+	if result := <-Srv.Store.Audit().Save(audit); result.Err != nil {
+		l4g.Error(utils.T("api.user_access_token.get_session.audit.error"), token.Id, result.Err)
+	}
+
+	AddSessionToCache(session)
+
+	return session
+}
+
+// RemoveUserAccessTokenFromCache drops the cached session made from the token
+// on every app server in the cluster so that it is checked against the
+// database again.
+func RemoveUserAccessTokenFromCache(tokenId string) {
+	messageBus.RemoveUserAccessTokenFromCache(tokenId)
+}
+
+// removeUserAccessTokensFromLocalCache drops the sessions made from access
+// tokens that match out of this server's cache.
+func removeUserAccessTokensFromLocalCache(matches func(session *model.Session) bool) {
+	for _, key := range sessionCache.Keys() {
+		if ts, ok := sessionCache.Get(key); ok {
+			if session := ts.(*model.Session); session.IsUserAccessToken() && matches(session) {
+				sessionCache.Remove(key)
+			}
+		}
+	}
+}
+
+// RemoveAllUserAccessTokensFromCache drops every cached session made from an
+// access token, which is done when access tokens are turned off.
+func RemoveAllUserAccessTokensFromCache() {
+	removeUserAccessTokensFromLocalCache(func(session *model.Session) bool {
+		return true
+	})
+}
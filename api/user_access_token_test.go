@@ -0,0 +1,143 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package api
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mattermost/platform/model"
+	"github.com/mattermost/platform/store"
+	"github.com/mattermost/platform/utils"
+)
+
+func TestUserAccessTokens(t *testing.T) {
+	Setup()
+
+	enableUserAccessTokens := *utils.Cfg.ServiceSettings.EnableUserAccessTokens
+	defer func() {
+		*utils.Cfg.ServiceSettings.EnableUserAccessTokens = enableUserAccessTokens
+	}()
+	*utils.Cfg.ServiceSettings.EnableUserAccessTokens = false
+
+	team := &model.Team{DisplayName: "Name", Name: "z-z-" + model.NewId() + "a", Email: strings.ToLower(model.NewId()) + "success+test@simulator.amazonses.com", Type: model.TEAM_OPEN}
+	team = Client.Must(Client.CreateTeam(team)).Data.(*model.Team)
+
+	user := &model.User{TeamId: team.Id, Email: strings.ToLower(model.NewId()) + "success+test@simulator.amazonses.com", Nickname: "Corey Hulen", Password: "pwd"}
+	user = Client.Must(Client.CreateUser(user, "")).Data.(*model.User)
+	store.Must(Srv.Store.User().VerifyEmail(user.Id))
+
+	user2 := &model.User{TeamId: team.Id, Email: strings.ToLower(model.NewId()) + "success+test@simulator.amazonses.com", Nickname: "Corey Hulen", Password: "pwd"}
+	user2 = Client.Must(Client.CreateUser(user2, "")).Data.(*model.User)
+	store.Must(Srv.Store.User().VerifyEmail(user2.Id))
+
+	Client.Must(Client.LoginByEmail(team.Name, user.Email, "pwd"))
+
+	readToken := &model.UserAccessToken{Description: "read", Scopes: model.USER_ACCESS_TOKEN_SCOPE_READ}
+	if _, err := Client.CreateUserAccessToken(user.Id, readToken); err == nil {
+		t.Fatal("should have failed, tokens are disabled")
+	}
+
+	*utils.Cfg.ServiceSettings.EnableUserAccessTokens = true
+
+	if _, err := Client.CreateUserAccessToken(user2.Id, readToken); err == nil {
+		t.Fatal("should have failed, not the user's own token")
+	}
+
+	user2.Roles = model.ROLE_GUEST
+	store.Must(Srv.Store.User().Update(user2, true))
+	Client.Must(Client.LoginByEmail(team.Name, user2.Email, "pwd"))
+
+	if _, err := Client.CreateUserAccessToken(user2.Id, readToken); err == nil {
+		t.Fatal("should have failed, guests can't make tokens")
+	}
+
+	Client.Must(Client.LoginByEmail(team.Name, user.Email, "pwd"))
+
+	chosenId := model.NewId()
+	readToken.Id = chosenId
+	readToken = Client.Must(Client.CreateUserAccessToken(user.Id, readToken)).Data.(*model.UserAccessToken)
+	if len(readToken.Token) != 26 {
+		t.Fatal("should have been given the token")
+	}
+
+	if readToken.Id == chosenId {
+		t.Fatal("shouldn't be able to pick the token's id")
+	}
+
+	writeToken := &model.UserAccessToken{Description: "write", Scopes: model.USER_ACCESS_TOKEN_SCOPE_READ + " " + model.USER_ACCESS_TOKEN_SCOPE_WRITE}
+	writeToken = Client.Must(Client.CreateUserAccessToken(user.Id, writeToken)).Data.(*model.UserAccessToken)
+
+	if tokens := Client.Must(Client.GetUserAccessTokens(user.Id)).Data.([]*model.UserAccessToken); len(tokens) != 2 {
+		t.Fatal("should have listed both tokens")
+	} else if tokens[0].Token != "" || tokens[1].Token != "" {
+		t.Fatal("shouldn't have sent the tokens again")
+	}
+
+	TokenClient := model.NewClient(Client.Url)
+
+	TokenClient.MockSession(readToken.Token)
+	if me := TokenClient.Must(TokenClient.GetMe("")).Data.(*model.User); me.Id != user.Id {
+		t.Fatal("should have acted as the user")
+	}
+
+	if _, err := TokenClient.UpdateUserNotify(map[string]string{"user_id": user.Id, "email": "false", "desktop": "all", "desktop_sound": "false", "comments": "any"}); err == nil {
+		t.Fatal("should have failed, read only token")
+	}
+
+	TokenClient.MockSession(writeToken.Token)
+	if _, err := TokenClient.UpdateUserNotify(map[string]string{"user_id": user.Id, "email": "false", "desktop": "all", "desktop_sound": "false", "comments": "any"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := TokenClient.CreateUserAccessToken(user.Id, &model.UserAccessToken{Scopes: model.USER_ACCESS_TOKEN_SCOPE_READ}); err == nil {
+		t.Fatal("shouldn't be able to make a token with a token")
+	}
+
+	audits := Client.Must(Client.GetAudits(user.Id, "")).Data.(model.Audits)
+	found := false
+	for _, audit := range audits {
+		if strings.Contains(audit.ExtraInfo, "user_access_token_id="+readToken.Id) {
+			found = true
+		}
+	}
+
+	if !found {
+		t.Fatal("the use of the token should have been audited")
+	}
+
+	Client.Must(Client.RevokeUserAccessToken(readToken.Id))
+
+	TokenClient.MockSession(readToken.Token)
+	if _, err := TokenClient.GetUserAccessTokens(user.Id); err == nil {
+		t.Fatal("should have failed, token was revoked")
+	}
+
+	// tokens keep working when the user's sessions are revoked
+	RevokeAllSession(&Context{}, user.Id)
+
+	TokenClient.MockSession(writeToken.Token)
+	if _, err := TokenClient.GetUserAccessTokens(user.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	// the token's session has to pick up changes to the user's roles and teams
+	RemoveAllSessionsForUserIdFromCache(user.Id)
+
+	if _, ok := sessionCache.Get(writeToken.Token); ok {
+		t.Fatal("should have dropped the token's cached session along with the user's")
+	}
+
+	TokenClient.Must(TokenClient.GetMe(""))
+
+	*utils.Cfg.ServiceSettings.EnableUserAccessTokens = false
+
+	if _, err := TokenClient.GetMe(""); err == nil {
+		t.Fatal("should have failed, tokens are disabled even though this one was cached")
+	}
+
+	if _, err := Client.GetUserAccessTokens(user.Id); err == nil {
+		t.Fatal("should have failed, tokens are disabled")
+	}
+}
@@ -54,7 +54,7 @@ func TestCreateUser(t *testing.T) {
 		}
 	}
 
-	ruser.Data.(*model.User).Email = "test2@nowhere.com"
+	ruser.Data.(*model.User).Email = strings.ToLower(model.NewId()) + "test2@nowhere.com"
 	if _, err := Client.CreateUser(ruser.Data.(*model.User), ""); err != nil {
 		if err.Message != "An account with that username already exists." {
 			t.Fatal(err)
@@ -86,7 +86,7 @@ func TestCreateUserAllowedDomains(t *testing.T) {
 		t.Fatal("should have failed")
 	}
 
-	user.Email = "test@nowh.com"
+	user.Email = strings.ToLower(model.NewId()) + "test@nowh.com"
 	_, err = Client.CreateUser(&user, "")
 	if err != nil {
 		t.Fatal(err)
@@ -99,7 +99,7 @@ func TestLogin(t *testing.T) {
 	team := model.Team{DisplayName: "Name", Name: "z-z-" + model.NewId() + "a", Email: "test@nowhere.com", Type: model.TEAM_OPEN}
 	rteam, _ := Client.CreateTeam(&team)
 
-	user := model.User{TeamId: rteam.Data.(*model.Team).Id, Email: strings.ToLower(model.NewId()) + "success+test@simulator.amazonses.com", Nickname: "Corey Hulen", Username: "corey", Password: "pwd"}
+	user := model.User{TeamId: rteam.Data.(*model.Team).Id, Email: strings.ToLower(model.NewId()) + "success+test@simulator.amazonses.com", Nickname: "Corey Hulen", Username: "corey" + model.NewId(), Password: "pwd"}
 	ruser, _ := Client.CreateUser(&user, "")
 	store.Must(Srv.Store.User().VerifyEmail(ruser.Data.(*model.User).Id))
 
@@ -683,10 +683,11 @@ func TestUserUpdatePassword(t *testing.T) {
 func TestUserUpdateRoles(t *testing.T) {
 	Setup()
 
-	team := &model.Team{DisplayName: "Name", Name: "z-z-" + model.NewId() + "a", Email: "test@nowhere.com", Type: model.TEAM_OPEN}
+	adminEmail := strings.ToLower(model.NewId()) + "success+test@simulator.amazonses.com"
+	team := &model.Team{DisplayName: "Name", Name: "z-z-" + model.NewId() + "a", Email: adminEmail, Type: model.TEAM_OPEN}
 	team = Client.Must(Client.CreateTeam(team)).Data.(*model.Team)
 
-	user := &model.User{TeamId: team.Id, Email: "test@nowhere.com", Nickname: "Corey Hulen", Password: "pwd"}
+	user := &model.User{TeamId: team.Id, Email: adminEmail, Nickname: "Corey Hulen", Password: "pwd"}
 	user = Client.Must(Client.CreateUser(user, "")).Data.(*model.User)
 	store.Must(Srv.Store.User().VerifyEmail(user.Id))
 
@@ -708,10 +709,11 @@ func TestUserUpdateRoles(t *testing.T) {
 		t.Fatal("Should have errored, not admin")
 	}
 
-	team2 := &model.Team{DisplayName: "Name", Name: "z-z-" + model.NewId() + "a", Email: "test@nowhere.com", Type: model.TEAM_OPEN}
+	adminEmail2 := strings.ToLower(model.NewId()) + "success+test@simulator.amazonses.com"
+	team2 := &model.Team{DisplayName: "Name", Name: "z-z-" + model.NewId() + "a", Email: adminEmail2, Type: model.TEAM_OPEN}
 	team2 = Client.Must(Client.CreateTeam(team2)).Data.(*model.Team)
 
-	user3 := &model.User{TeamId: team2.Id, Email: "test@nowhere.com", Nickname: "Corey Hulen", Password: "pwd"}
+	user3 := &model.User{TeamId: team2.Id, Email: adminEmail2, Nickname: "Corey Hulen", Password: "pwd"}
 	user3 = Client.Must(Client.CreateUser(user3, "")).Data.(*model.User)
 	store.Must(Srv.Store.User().VerifyEmail(user3.Id))
 
@@ -740,23 +742,47 @@ func TestUserUpdateRoles(t *testing.T) {
 
 	data["user_id"] = user2.Id
 
-	if result, err := Client.UpdateUserRoles(data); err != nil {
+	if _, err := Client.UpdateUserRoles(data); err != nil {
 		t.Log(data["new_roles"])
 		t.Fatal(err)
-	} else {
-		if result.Data.(*model.User).Roles != "admin" {
-			t.Fatal("Roles did not update properly")
-		}
+	}
+
+	if result := <-Srv.Store.Team().GetMember(team.Id, user2.Id); result.Err != nil {
+		t.Fatal(result.Err)
+	} else if !result.Data.(*model.TeamMember).IsTeamAdmin() {
+		t.Fatal("Roles did not update properly")
+	}
+
+	data["new_roles"] = model.ROLE_GUEST
+
+	if _, err := Client.UpdateUserRoles(data); err == nil {
+		t.Fatal("Should have errored, only system admins can change system roles")
+	}
+
+	data["user_id"] = user.Id
+	data["new_roles"] = ""
+
+	if _, err := Client.UpdateUserRoles(data); err != nil {
+		t.Fatal(err)
+	}
+
+	Client.LoginByEmail(team.Name, user2.Email, "pwd")
+
+	data["user_id"] = user2.Id
+
+	if _, err := Client.UpdateUserRoles(data); err == nil {
+		t.Fatal("Should have errored, last admin")
 	}
 }
 
 func TestUserUpdateDeviceId(t *testing.T) {
 	Setup()
 
-	team := &model.Team{DisplayName: "Name", Name: "z-z-" + model.NewId() + "a", Email: "test@nowhere.com", Type: model.TEAM_OPEN}
+	adminEmail := strings.ToLower(model.NewId()) + "success+test@simulator.amazonses.com"
+	team := &model.Team{DisplayName: "Name", Name: "z-z-" + model.NewId() + "a", Email: adminEmail, Type: model.TEAM_OPEN}
 	team = Client.Must(Client.CreateTeam(team)).Data.(*model.Team)
 
-	user := &model.User{TeamId: team.Id, Email: "test@nowhere.com", Nickname: "Corey Hulen", Password: "pwd"}
+	user := &model.User{TeamId: team.Id, Email: adminEmail, Nickname: "Corey Hulen", Password: "pwd"}
 	user = Client.Must(Client.CreateUser(user, "")).Data.(*model.User)
 	store.Must(Srv.Store.User().VerifyEmail(user.Id))
 
@@ -781,10 +807,11 @@ func TestUserUpdateDeviceId(t *testing.T) {
 func TestUserUpdateActive(t *testing.T) {
 	Setup()
 
-	team := &model.Team{DisplayName: "Name", Name: "z-z-" + model.NewId() + "a", Email: "test@nowhere.com", Type: model.TEAM_OPEN}
+	adminEmail := strings.ToLower(model.NewId()) + "success+test@simulator.amazonses.com"
+	team := &model.Team{DisplayName: "Name", Name: "z-z-" + model.NewId() + "a", Email: adminEmail, Type: model.TEAM_OPEN}
 	team = Client.Must(Client.CreateTeam(team)).Data.(*model.Team)
 
-	user := &model.User{TeamId: team.Id, Email: "test@nowhere.com", Nickname: "Corey Hulen", Password: "pwd"}
+	user := &model.User{TeamId: team.Id, Email: adminEmail, Nickname: "Corey Hulen", Password: "pwd"}
 	user = Client.Must(Client.CreateUser(user, "")).Data.(*model.User)
 	store.Must(Srv.Store.User().VerifyEmail(user.Id))
 
@@ -802,10 +829,11 @@ func TestUserUpdateActive(t *testing.T) {
 		t.Fatal("Should have errored, not admin")
 	}
 
-	team2 := &model.Team{DisplayName: "Name", Name: "z-z-" + model.NewId() + "a", Email: "test@nowhere.com", Type: model.TEAM_OPEN}
+	adminEmail2 := strings.ToLower(model.NewId()) + "success+test@simulator.amazonses.com"
+	team2 := &model.Team{DisplayName: "Name", Name: "z-z-" + model.NewId() + "a", Email: adminEmail2, Type: model.TEAM_OPEN}
 	team2 = Client.Must(Client.CreateTeam(team2)).Data.(*model.Team)
 
-	user3 := &model.User{TeamId: team2.Id, Email: "test@nowhere.com", Nickname: "Corey Hulen", Password: "pwd"}
+	user3 := &model.User{TeamId: team2.Id, Email: adminEmail2, Nickname: "Corey Hulen", Password: "pwd"}
 	user3 = Client.Must(Client.CreateUser(user3, "")).Data.(*model.User)
 	store.Must(Srv.Store.User().VerifyEmail(user3.Id))
 
@@ -1096,6 +1124,19 @@ func TestUserUpdateNotify(t *testing.T) {
 	if _, err := Client.UpdateUserNotify(data); err == nil {
 		t.Fatal("Should have errored - empty email")
 	}
+
+	data["email"] = "true"
+	data["email_interval"] = "junk"
+	if _, err := Client.UpdateUserNotify(data); err == nil {
+		t.Fatal("Should have errored - bad email interval")
+	}
+
+	data["email_interval"] = model.EMAIL_INTERVAL_HOUR
+	if result, err := Client.UpdateUserNotify(data); err != nil {
+		t.Fatal(err)
+	} else if result.Data.(*model.User).NotifyProps["email_interval"] != model.EMAIL_INTERVAL_HOUR {
+		t.Fatal("NotifyProps did not update properly - email_interval")
+	}
 }
 
 func TestFuzzyUserCreate(t *testing.T) {
@@ -1154,13 +1195,57 @@ func TestStatuses(t *testing.T) {
 	}
 
 	for _, status := range statuses {
-		if status != model.USER_OFFLINE && status != model.USER_AWAY && status != model.USER_ONLINE {
+		if status != model.USER_OFFLINE && status != model.USER_AWAY && status != model.USER_ONLINE && status != model.USER_DND {
 			t.Fatal("one of the statuses had an invalid value")
 		}
 	}
 
 }
 
+func TestUserSetStatus(t *testing.T) {
+	Setup()
+
+	team := &model.Team{DisplayName: "Name", Name: "z-z-" + model.NewId() + "a", Email: "test@nowhere.com", Type: model.TEAM_OPEN}
+	team = Client.Must(Client.CreateTeam(team)).Data.(*model.Team)
+
+	user := &model.User{TeamId: team.Id, Email: strings.ToLower(model.NewId()) + "success+test@simulator.amazonses.com", Nickname: "Corey Hulen", Password: "pwd"}
+	user = Client.Must(Client.CreateUser(user, "")).Data.(*model.User)
+	store.Must(Srv.Store.User().VerifyEmail(user.Id))
+
+	Client.LoginByEmail(team.Name, user.Email, "pwd")
+
+	if status := Client.Must(Client.GetMyStatus()).Data.(*model.Status); status.UserId != user.Id || status.Manual != model.STATUS_AUTOMATIC {
+		t.Fatal("status should be automatic by default")
+	}
+
+	if _, err := Client.SetStatus(&model.Status{Manual: "junk"}); err == nil {
+		t.Fatal("should have failed with an invalid status")
+	}
+
+	status := &model.Status{UserId: model.NewId(), Manual: model.USER_DND, DndStartTime: "22:00", DndEndTime: "07:00"}
+	if rstatus := Client.Must(Client.SetStatus(status)).Data.(*model.Status); rstatus.UserId != user.Id || rstatus.Manual != model.USER_DND {
+		t.Fatal("should have set the status for the current user")
+	}
+
+	if status := Client.Must(Client.GetMyStatus()).Data.(*model.Status); status.Manual != model.USER_DND || status.DndStartTime != "22:00" {
+		t.Fatal("should have saved the status")
+	}
+
+	// a ping marks the user as connected
+	store.Must(Srv.Store.User().UpdateLastPingAt(user.Id, model.GetMillis()))
+	store.Must(Srv.Store.User().UpdateLastActivityAt(user.Id, model.GetMillis()))
+
+	if statuses := Client.Must(Client.GetStatuses([]string{user.Id})).Data.(map[string]string); statuses[user.Id] != model.USER_DND {
+		t.Fatal("should have returned the effective status")
+	}
+
+	Client.Must(Client.SetStatus(&model.Status{Manual: model.USER_AWAY}))
+
+	if statuses := Client.Must(Client.GetStatuses([]string{user.Id})).Data.(map[string]string); statuses[user.Id] != model.USER_AWAY {
+		t.Fatal("should have returned the manual status")
+	}
+}
+
 func TestEmailToOAuth(t *testing.T) {
 	Setup()
 
@@ -1487,3 +1572,82 @@ func TestCheckMfa(t *testing.T) {
 
 	// need to add more test cases when license and config can be configured for tests
 }
+
+func TestGuestAccounts(t *testing.T) {
+	Setup()
+
+	adminEmail := strings.ToLower(model.NewId()) + "success+test@simulator.amazonses.com"
+	team := &model.Team{DisplayName: "Name", Name: "z-z-" + model.NewId() + "a", Email: adminEmail, Type: model.TEAM_OPEN}
+	team = Client.Must(Client.CreateTeam(team)).Data.(*model.Team)
+
+	admin := &model.User{TeamId: team.Id, Email: adminEmail, Nickname: "Corey Hulen", Password: "pwd"}
+	admin = Client.Must(Client.CreateUser(admin, "")).Data.(*model.User)
+	store.Must(Srv.Store.User().VerifyEmail(admin.Id))
+
+	user := &model.User{TeamId: team.Id, Email: strings.ToLower(model.NewId()) + "success+test@simulator.amazonses.com", Nickname: "Corey Hulen", Password: "pwd"}
+	user = Client.Must(Client.CreateUser(user, "")).Data.(*model.User)
+	store.Must(Srv.Store.User().VerifyEmail(user.Id))
+
+	guest := &model.User{TeamId: team.Id, Email: strings.ToLower(model.NewId()) + "success+test@simulator.amazonses.com", Nickname: "Corey Hulen", Password: "pwd"}
+	guest = Client.Must(Client.CreateUser(guest, "")).Data.(*model.User)
+	store.Must(Srv.Store.User().VerifyEmail(guest.Id))
+
+	// start the guest off without any channels
+	for _, channel := range store.Must(Srv.Store.Channel().GetChannels(team.Id, guest.Id)).(*model.ChannelList).Channels {
+		store.Must(Srv.Store.Channel().RemoveMember(channel.Id, guest.Id))
+	}
+
+	Client.LoginByEmail(team.Name, admin.Email, "pwd")
+
+	if _, err := Client.UpdateGuestExpiry(guest.Id, 0); err == nil {
+		t.Fatal("should have failed, not a guest yet")
+	}
+
+	Client.Must(Client.UpdateUserRoles(map[string]string{"user_id": guest.Id, "new_roles": model.ROLE_GUEST}))
+
+	channel := &model.Channel{DisplayName: "AA", Name: "aa" + model.NewId() + "a", Type: model.CHANNEL_OPEN, TeamId: team.Id}
+	channel = Client.Must(Client.CreateChannel(channel)).Data.(*model.Channel)
+	Client.Must(Client.AddChannelMember(channel.Id, guest.Id))
+
+	Client.LoginByEmail(team.Name, user.Email, "pwd")
+
+	if profiles := Client.Must(Client.GetProfiles(team.Id, "")).Data.(map[string]*model.User); profiles[guest.Id] != nil {
+		t.Fatal("shouldn't see a guest that isn't in any of the same channels")
+	} else if profiles[admin.Id] == nil {
+		t.Fatal("should still see everyone else")
+	}
+
+	Client.LoginByEmail(team.Name, guest.Email, "pwd")
+
+	if channels := Client.Must(Client.GetMoreChannels("")).Data.(*model.ChannelList); len(channels.Channels) != 0 {
+		t.Fatal("guests shouldn't see any other channels")
+	}
+
+	otherChannel := store.Must(Srv.Store.Channel().GetByName(team.Id, "town-square")).(*model.Channel)
+	if _, err := Client.JoinChannel(otherChannel.Id); err == nil {
+		t.Fatal("guests shouldn't be able to join channels")
+	}
+
+	if profiles := Client.Must(Client.GetProfiles(team.Id, "")).Data.(map[string]*model.User); len(profiles) != 2 || profiles[admin.Id] == nil || profiles[guest.Id] == nil {
+		t.Fatal("guests should only see the people in their channels")
+	}
+
+	if _, err := Client.CreateDirectChannel(map[string]string{"user_id": user.Id}); err == nil {
+		t.Fatal("guests shouldn't be able to message people outside their channels")
+	}
+
+	Client.Must(Client.CreateDirectChannel(map[string]string{"user_id": admin.Id}))
+
+	Client.LoginByEmail(team.Name, admin.Email, "pwd")
+
+	Client.Must(Client.UpdateGuestExpiry(guest.Id, model.GetMillis()-1000))
+
+	if _, err := Client.LoginByEmail(team.Name, guest.Email, "pwd"); err == nil {
+		t.Fatal("should have failed, guest access has expired")
+	}
+
+	Client.LoginByEmail(team.Name, admin.Email, "pwd")
+
+	Client.Must(Client.UpdateGuestExpiry(guest.Id, 0))
+	Client.Must(Client.LoginByEmail(team.Name, guest.Email, "pwd"))
+}
@@ -27,7 +27,7 @@ var hub = &Hub{
 
 func PublishAndForget(message *model.Message) {
 	go func() {
-		hub.Broadcast(message)
+		messageBus.Publish(message)
 	}()
 }
 
@@ -39,7 +39,7 @@ func UpdateChannelAccessCache(teamId, userId, channelId string) {
 
 func UpdateChannelAccessCacheAndForget(teamId, userId, channelId string) {
 	go func() {
-		UpdateChannelAccessCache(teamId, userId, channelId)
+		messageBus.UpdateChannelAccessCache(teamId, userId, channelId)
 	}()
 }
 
@@ -16,6 +16,11 @@ func InitWebSocket(r *mux.Router) {
 	l4g.Debug(utils.T("api.web_socket.init.debug"))
 	r.Handle("/websocket", ApiUserRequiredTrustRequester(connect)).Methods("GET")
 	hub.Start()
+
+	messageBus = NewMessageBusFromConfig()
+	if err := messageBus.Start(); err != nil {
+		l4g.Critical(utils.T("api.web_socket.init.message_bus.critical"), err.Error())
+	}
 }
 
 func connect(c *Context, w http.ResponseWriter, r *http.Request) {
@@ -99,7 +99,7 @@ func ShouldSendEvent(webCon *WebConn, msg *model.Message) bool {
 		// Don't share a user's view or preference events with other users
 		if msg.Action == model.ACTION_CHANNEL_VIEWED {
 			return false
-		} else if msg.Action == model.ACTION_PREFERENCE_CHANGED {
+		} else if msg.Action == model.ACTION_PREFERENCE_CHANGED || msg.Action == model.ACTION_PREFERENCE_DELETED {
 			return false
 		} else if msg.Action == model.ACTION_EPHEMERAL_MESSAGE {
 			// For now, ephemeral messages are sent directly to individual users
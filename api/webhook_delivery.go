@@ -0,0 +1,263 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package api
+
+import (
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	l4g "github.com/alecthomas/log4go"
+	"github.com/mattermost/platform/model"
+	"github.com/mattermost/platform/utils"
+)
+
+const (
+	WEBHOOK_DELIVERY_POLL_INTERVAL = 10 * time.Second
+	WEBHOOK_DELIVERY_BATCH_SIZE    = 100
+	WEBHOOK_DELIVERY_CONCURRENCY   = 10
+	WEBHOOK_DELIVERY_MAX_RESPONSE  = 64 * 1024
+
+	// an attempt that hasn't finished within this long after its timeout is
+	// assumed to have been lost and is retried
+	WEBHOOK_DELIVERY_LEASE_MARGIN = 60 * 1000
+
+	WEBHOOK_DELIVERY_LOG_RETENTION  = 7 * 24 * 60 * 60 * 1000
+	WEBHOOK_DELIVERY_PRUNE_INTERVAL = 60 * 60 * 1000
+)
+
+var stopWebhookDeliveries chan bool
+
+// queueWebhookDelivery records that the post needs to be sent to the callback
+// URL and then makes the first attempt straight away. Failed attempts are
+// retried by the delivery worker.
+func queueWebhookDelivery(c *Context, hook *model.OutgoingWebhook, post *model.Post, callbackURL string, payload url.Values) {
+	delivery := &model.OutgoingWebhookDelivery{
+		HookId:    hook.Id,
+		TeamId:    hook.TeamId,
+		ChannelId: post.ChannelId,
+		PostId:    post.Id,
+		URL:       callbackURL,
+		Payload:   payload.Encode(),
+		SiteURL:   c.GetSiteURL(),
+	}
+
+	if result := <-Srv.Store.Webhook().SaveDelivery(delivery); result.Err != nil {
+		l4g.Error(utils.T("api.webhook_delivery.queue.save.error"), hook.Id, result.Err)
+		return
+	}
+
+	attemptWebhookDelivery(delivery)
+}
+
+// StartWebhookDeliveryWorker starts the background job that retries failed
+// outgoing webhook deliveries and clears out expired command response URLs.
+func StartWebhookDeliveryWorker() {
+	if stopWebhookDeliveries != nil {
+		return
+	}
+
+	stop := make(chan bool)
+	stopWebhookDeliveries = stop
+
+	go func() {
+		ticker := time.NewTicker(WEBHOOK_DELIVERY_POLL_INTERVAL)
+		defer ticker.Stop()
+
+		lastPruneAt := int64(0)
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				attemptDueWebhookDeliveries()
+
+				if now := model.GetMillis(); now-lastPruneAt > WEBHOOK_DELIVERY_PRUNE_INTERVAL {
+					lastPruneAt = now
+
+					if result := <-Srv.Store.Webhook().PermanentDeleteDeliveriesBefore(now - WEBHOOK_DELIVERY_LOG_RETENTION); result.Err != nil {
+						l4g.Error(utils.T("api.webhook_delivery.prune.error"), result.Err)
+					}
+
+					if result := <-Srv.Store.Command().PermanentDeleteWebhooksBefore(now - model.COMMAND_WEBHOOK_LIFETIME); result.Err != nil {
+						l4g.Error(utils.T("api.webhook_delivery.prune_command_webhooks.error"), result.Err)
+					}
+				}
+			}
+		}
+	}()
+}
+
+func StopWebhookDeliveryWorker() {
+	if stopWebhookDeliveries != nil {
+		close(stopWebhookDeliveries)
+		stopWebhookDeliveries = nil
+	}
+}
+
+func attemptDueWebhookDeliveries() {
+	if result := <-Srv.Store.Webhook().GetDueDeliveries(model.GetMillis(), WEBHOOK_DELIVERY_BATCH_SIZE); result.Err != nil {
+		l4g.Error(utils.T("api.webhook_delivery.get_due.error"), result.Err)
+	} else {
+		// a slow callback URL shouldn't hold up the deliveries to other ones
+		var wg sync.WaitGroup
+		limit := make(chan bool, WEBHOOK_DELIVERY_CONCURRENCY)
+
+		for _, delivery := range result.Data.([]*model.OutgoingWebhookDelivery) {
+			wg.Add(1)
+			limit <- true
+
+			go func(delivery *model.OutgoingWebhookDelivery) {
+				defer func() {
+					<-limit
+					wg.Done()
+				}()
+
+				attemptWebhookDelivery(delivery)
+			}(delivery)
+		}
+
+		wg.Wait()
+	}
+}
+
+func attemptWebhookDelivery(delivery *model.OutgoingWebhookDelivery) {
+	hresult := <-Srv.Store.Webhook().GetOutgoing(delivery.HookId)
+
+	timeout := time.Duration(*utils.Cfg.ServiceSettings.OutgoingWebhookTimeout) * time.Second
+	if hresult.Err == nil {
+		timeout = hresult.Data.(*model.OutgoingWebhook).GetTimeout(*utils.Cfg.ServiceSettings.OutgoingWebhookTimeout)
+	}
+
+	// another server may already be making this attempt
+	leaseUntil := model.GetMillis() + int64(timeout/time.Millisecond) + WEBHOOK_DELIVERY_LEASE_MARGIN
+	if result := <-Srv.Store.Webhook().ClaimDelivery(delivery, leaseUntil); result.Err != nil {
+		l4g.Error(utils.T("api.webhook_delivery.claim.error"), delivery.Id, result.Err)
+		return
+	} else if !result.Data.(bool) {
+		return
+	}
+
+	var hook *model.OutgoingWebhook
+	if hresult.Err != nil {
+		// the hook has been removed since the post was made
+		finishWebhookDelivery(delivery, model.OUTGOING_WEBHOOK_DELIVERY_FAILED, hresult.Err.Error())
+		return
+	} else {
+		hook = hresult.Data.(*model.OutgoingWebhook)
+	}
+
+	if !utils.Cfg.ServiceSettings.EnableOutgoingWebhooks || hook.DeleteAt != 0 {
+		finishWebhookDelivery(delivery, model.OUTGOING_WEBHOOK_DELIVERY_FAILED, "webhook disabled")
+		return
+	}
+
+	// the token may have been regenerated since the delivery was queued
+	payload, _ := url.ParseQuery(delivery.Payload)
+	payload.Set("token", hook.Token)
+	body := payload.Encode()
+
+	req, _ := http.NewRequest("POST", delivery.URL, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set(model.HEADER_WEBHOOK_SIGNATURE, model.SignOutgoingWebhookPayload(hook.Token, []byte(body)))
+	req.Header.Set(model.HEADER_WEBHOOK_DELIVERY, delivery.Id)
+
+	client := &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: *utils.Cfg.ServiceSettings.EnableInsecureOutgoingConnections},
+		},
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	delivery.Latency = int64(time.Since(start) / time.Millisecond)
+
+	if err != nil {
+		l4g.Error(utils.T("api.post.handle_webhook_events_and_forget.event_post.error"), err.Error())
+		delivery.StatusCode = 0
+		delivery.SetResponseSnippet("")
+		retryWebhookDelivery(delivery, err.Error())
+		return
+	}
+
+	respBody, err := ioutil.ReadAll(io.LimitReader(resp.Body, WEBHOOK_DELIVERY_MAX_RESPONSE))
+	resp.Body.Close()
+
+	delivery.StatusCode = resp.StatusCode
+	delivery.SetResponseSnippet(string(respBody))
+
+	if err != nil {
+		retryWebhookDelivery(delivery, err.Error())
+		return
+	} else if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		retryWebhookDelivery(delivery, resp.Status)
+		return
+	}
+
+	finishWebhookDelivery(delivery, model.OUTGOING_WEBHOOK_DELIVERY_SUCCESS, "")
+
+	respProps := model.MapFromJson(strings.NewReader(string(respBody)))
+	if text, ok := respProps["text"]; ok {
+		createWebhookResponsePost(hook, delivery, text, respProps["username"], respProps["icon_url"])
+	}
+}
+
+// retryWebhookDelivery schedules another attempt with an exponential backoff,
+// giving up once the configured number of attempts have been made.
+func retryWebhookDelivery(delivery *model.OutgoingWebhookDelivery, reason string) {
+	if delivery.Attempts >= *utils.Cfg.ServiceSettings.OutgoingWebhookMaxAttempts {
+		finishWebhookDelivery(delivery, model.OUTGOING_WEBHOOK_DELIVERY_FAILED, reason)
+		return
+	}
+
+	delivery.NextAttemptAt = model.GetMillis() + model.GetOutgoingWebhookRetryDelay(delivery.Attempts)
+	finishWebhookDelivery(delivery, model.OUTGOING_WEBHOOK_DELIVERY_PENDING, reason)
+}
+
+func finishWebhookDelivery(delivery *model.OutgoingWebhookDelivery, status string, reason string) {
+	delivery.Status = status
+
+	if len(reason) > 1024 {
+		reason = reason[:1024]
+	}
+	delivery.Error = reason
+
+	if result := <-Srv.Store.Webhook().UpdateDelivery(delivery); result.Err != nil {
+		l4g.Error(utils.T("api.webhook_delivery.update.error"), delivery.Id, result.Err)
+	}
+}
+
+func createWebhookResponsePost(hook *model.OutgoingWebhook, delivery *model.OutgoingWebhookDelivery, text, overrideUsername, overrideIconUrl string) {
+	var props model.StringInterface
+	postType := ""
+
+	if result := <-Srv.Store.Post().Get(delivery.PostId); result.Err != nil {
+		l4g.Error(utils.T("api.post.handle_webhook_events_and_forget.create_post.error"), result.Err)
+		return
+	} else if post, ok := result.Data.(*model.PostList).Posts[delivery.PostId]; ok {
+		props = post.Props
+		postType = post.Type
+	}
+
+	// create a mock session for posting the message
+	c := &Context{
+		Session:   model.Session{UserId: hook.CreatorId, TeamId: hook.TeamId, IsOAuth: false},
+		RequestId: model.NewId(),
+		siteURL:   delivery.SiteURL,
+		T:         utils.TfuncWithFallback(model.DEFAULT_LOCALE),
+		Locale:    model.DEFAULT_LOCALE,
+	}
+
+	if _, err := CreateWebhookPost(c, delivery.ChannelId, text, overrideUsername, overrideIconUrl, props, postType); err != nil {
+		l4g.Error(utils.T("api.post.handle_webhook_events_and_forget.create_post.error"), err)
+	}
+}
@@ -7,6 +7,10 @@ import (
 	"github.com/mattermost/platform/model"
 	"github.com/mattermost/platform/store"
 	"github.com/mattermost/platform/utils"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"testing"
 	"time"
 )
@@ -417,6 +421,123 @@ func TestRegenOutgoingHookToken(t *testing.T) {
 	}
 }
 
+func TestOutgoingHookDeliveries(t *testing.T) {
+	Setup()
+	enableOutgoingHooks := utils.Cfg.ServiceSettings.EnableOutgoingWebhooks
+	defer func() {
+		utils.Cfg.ServiceSettings.EnableOutgoingWebhooks = enableOutgoingHooks
+	}()
+	utils.Cfg.ServiceSettings.EnableOutgoingWebhooks = true
+
+	team := &model.Team{DisplayName: "Name", Name: "z-z-" + model.NewId() + "a", Email: "test@nowhere.com", Type: model.TEAM_OPEN}
+	team = Client.Must(Client.CreateTeam(team)).Data.(*model.Team)
+
+	user := &model.User{TeamId: team.Id, Email: model.NewId() + "success+test@simulator.amazonses.com", Nickname: "Corey Hulen", Password: "pwd"}
+	user = Client.Must(Client.CreateUser(user, "")).Data.(*model.User)
+	store.Must(Srv.Store.User().VerifyEmail(user.Id))
+
+	c := &Context{}
+	c.RequestId = model.NewId()
+	c.IpAddress = "cmd_line"
+	UpdateRoles(c, user, model.ROLE_SYSTEM_ADMIN)
+	Client.LoginByEmail(team.Name, user.Email, "pwd")
+
+	channel1 := &model.Channel{DisplayName: "Test API Name", Name: "a" + model.NewId() + "a", Type: model.CHANNEL_OPEN, TeamId: team.Id}
+	channel1 = Client.Must(Client.CreateChannel(channel1)).Data.(*model.Channel)
+
+	requests := make(chan *http.Request, 10)
+	failures := 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		values, _ := url.ParseQuery(string(body))
+		if r.Header.Get(model.HEADER_WEBHOOK_SIGNATURE) != model.SignOutgoingWebhookPayload(values.Get("token"), body) {
+			r.Header.Set("X-Bad-Signature", "true")
+		}
+		requests <- r
+
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("try again"))
+		} else {
+			w.Write([]byte(`{"text": "received"}`))
+		}
+	}))
+	defer server.Close()
+
+	hook := &model.OutgoingWebhook{ChannelId: channel1.Id, CallbackURLs: []string{server.URL}}
+	hook = Client.Must(Client.CreateOutgoingWebhook(hook)).Data.(*model.OutgoingWebhook)
+
+	post := &model.Post{ChannelId: channel1.Id, Message: "hello hook"}
+	post = Client.Must(Client.CreatePost(post)).Data.(*model.Post)
+
+	select {
+	case r := <-requests:
+		if r.Header.Get("X-Bad-Signature") != "" {
+			t.Fatal("request should have been signed with the hook's token")
+		}
+
+		if len(r.Header.Get(model.HEADER_WEBHOOK_DELIVERY)) != 26 {
+			t.Fatal("request should have included the delivery id")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook wasn't delivered")
+	}
+
+	// wait for the failed attempt to be recorded
+	time.Sleep(500 * time.Millisecond)
+
+	deliveries := Client.Must(Client.GetOutgoingWebhookDeliveries(hook.Id, 0, 10)).Data.([]*model.OutgoingWebhookDelivery)
+	if len(deliveries) != 1 {
+		t.Fatal("should have logged the delivery")
+	}
+
+	delivery := deliveries[0]
+	if delivery.PostId != post.Id || delivery.Status != model.OUTGOING_WEBHOOK_DELIVERY_PENDING || delivery.Attempts != 1 ||
+		delivery.StatusCode != http.StatusInternalServerError || delivery.ResponseSnippet != "try again" {
+		t.Fatal("should have logged the failed attempt")
+	}
+
+	if delivery.NextAttemptAt <= delivery.LastAttemptAt {
+		t.Fatal("should have scheduled a retry")
+	}
+
+	// make the retry due now rather than waiting for the backoff
+	if result := <-Srv.Store.Webhook().GetDueDeliveries(delivery.NextAttemptAt, 1000); result.Err != nil {
+		t.Fatal(result.Err)
+	} else {
+		for _, d := range result.Data.([]*model.OutgoingWebhookDelivery) {
+			if d.Id == delivery.Id {
+				d.NextAttemptAt = model.GetMillis()
+				store.Must(Srv.Store.Webhook().UpdateDelivery(d))
+			}
+		}
+	}
+
+	attemptDueWebhookDeliveries()
+
+	select {
+	case <-requests:
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook wasn't retried")
+	}
+
+	deliveries = Client.Must(Client.GetOutgoingWebhookDeliveries(hook.Id, 0, 10)).Data.([]*model.OutgoingWebhookDelivery)
+	if len(deliveries) != 1 || deliveries[0].Status != model.OUTGOING_WEBHOOK_DELIVERY_SUCCESS || deliveries[0].Attempts != 2 || deliveries[0].StatusCode != http.StatusOK {
+		t.Fatal("should have logged the successful retry")
+	}
+
+	user2 := &model.User{TeamId: team.Id, Email: model.NewId() + "success+test@simulator.amazonses.com", Nickname: "Corey Hulen", Password: "pwd"}
+	user2 = Client.Must(Client.CreateUser(user2, "")).Data.(*model.User)
+	store.Must(Srv.Store.User().VerifyEmail(user2.Id))
+
+	Client.LoginByEmail(team.Name, user2.Email, "pwd")
+
+	if _, err := Client.GetOutgoingWebhookDeliveries(hook.Id, 0, 10); err == nil {
+		t.Fatal("shouldn't be able to see another user's deliveries")
+	}
+}
+
 func TestZZWebSocketTearDown(t *testing.T) {
 	// *IMPORTANT* - Kind of hacky
 	// This should be the last function in any test file
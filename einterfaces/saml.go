@@ -0,0 +1,28 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package einterfaces
+
+import (
+	"github.com/mattermost/platform/model"
+)
+
+type SamlInterface interface {
+	ConfigureSP() *model.AppError
+	BuildRequest(relayState string) (*model.SamlAuthRequest, *model.AppError)
+	// DoLogin checks that the assertion in the IdP's response is signed with
+	// the IdP certificate and returns the user that it describes. The user
+	// isn't saved.
+	DoLogin(encodedXML string) (*model.User, *model.AppError)
+	GetMetadata() (string, *model.AppError)
+}
+
+var theSamlInterface SamlInterface
+
+func RegisterSamlInterface(newInterface SamlInterface) {
+	theSamlInterface = newInterface
+}
+
+func GetSamlInterface() SamlInterface {
+	return theSamlInterface
+}
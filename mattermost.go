@@ -93,11 +93,19 @@ func main() {
 
 		setDiagnosticId()
 		runSecurityAndDiagnosticsJobAndForget()
+		api.StartPostScheduler()
+		api.StartWebhookDeliveryWorker()
+		api.StartEmailBatchingJob()
+		api.StartUploadSweepJob()
 
 		if einterfaces.GetComplianceInterface() != nil {
 			einterfaces.GetComplianceInterface().StartComplianceDailyJob()
 		}
 
+		if err := api.ConfigureSaml(); err != nil {
+			l4g.Error(utils.T("mattermost.saml.configure.error"), err.Error())
+		}
+
 		// wait for kill signal before attempting to gracefully shutdown
 		// the running service
 		c := make(chan os.Signal)
@@ -330,6 +338,15 @@ func cmdCreateUser() {
 				l4g.Error("%v", err)
 				flushLogAndExit(1)
 			}
+
+			// the account already exists so just add it to the team
+			if result := <-api.Srv.Store.User().GetByEmail(flagEmail); result.Err != nil {
+				l4g.Error("%v", result.Err)
+				flushLogAndExit(1)
+			} else if err := api.AddUserToTeam(team, result.Data.(*model.User)); err != nil {
+				l4g.Error("%v", err)
+				flushLogAndExit(1)
+			}
 		}
 
 		os.Exit(0)
@@ -379,13 +396,16 @@ func cmdAssignRole() {
 		}
 
 		var user *model.User
-		if result := <-api.Srv.Store.User().GetByEmail(team.Id, flagEmail); result.Err != nil {
+		if result := <-api.Srv.Store.User().GetByEmail(flagEmail); result.Err != nil {
 			l4g.Error("%v", result.Err)
 			flushLogAndExit(1)
 		} else {
 			user = result.Data.(*model.User)
 		}
 
+		// team roles are given in the team named on the command line
+		c.Session.TeamId = team.Id
+
 		if !user.IsInRole(flagRole) {
 			api.UpdateRoles(c, user, flagRole)
 		}
@@ -396,12 +416,6 @@ func cmdAssignRole() {
 
 func cmdResetPassword() {
 	if flagCmdResetPassword {
-		if len(flagTeamName) == 0 {
-			fmt.Fprintln(os.Stderr, "flag needs an argument: -team_name")
-			flag.Usage()
-			os.Exit(1)
-		}
-
 		if len(flagEmail) == 0 {
 			fmt.Fprintln(os.Stderr, "flag needs an argument: -email")
 			flag.Usage()
@@ -420,16 +434,8 @@ func cmdResetPassword() {
 			os.Exit(1)
 		}
 
-		var team *model.Team
-		if result := <-api.Srv.Store.Team().GetByName(flagTeamName); result.Err != nil {
-			l4g.Error("%v", result.Err)
-			flushLogAndExit(1)
-		} else {
-			team = result.Data.(*model.Team)
-		}
-
 		var user *model.User
-		if result := <-api.Srv.Store.User().GetByEmail(team.Id, flagEmail); result.Err != nil {
+		if result := <-api.Srv.Store.User().GetByEmail(flagEmail); result.Err != nil {
 			l4g.Error("%v", result.Err)
 			flushLogAndExit(1)
 		} else {
@@ -447,12 +453,6 @@ func cmdResetPassword() {
 
 func cmdPermDeleteUser() {
 	if flagCmdPermanentDeleteUser {
-		if len(flagTeamName) == 0 {
-			fmt.Fprintln(os.Stderr, "flag needs an argument: -team_name")
-			flag.Usage()
-			os.Exit(1)
-		}
-
 		if len(flagEmail) == 0 {
 			fmt.Fprintln(os.Stderr, "flag needs an argument: -email")
 			flag.Usage()
@@ -461,16 +461,8 @@ func cmdPermDeleteUser() {
 
 		c := getMockContext()
 
-		var team *model.Team
-		if result := <-api.Srv.Store.Team().GetByName(flagTeamName); result.Err != nil {
-			l4g.Error("%v", result.Err)
-			flushLogAndExit(1)
-		} else {
-			team = result.Data.(*model.Team)
-		}
-
 		var user *model.User
-		if result := <-api.Srv.Store.User().GetByEmail(team.Id, flagEmail); result.Err != nil {
+		if result := <-api.Srv.Store.User().GetByEmail(flagEmail); result.Err != nil {
 			l4g.Error("%v", result.Err)
 			flushLogAndExit(1)
 		} else {
@@ -601,19 +593,20 @@ COMMANDS:
             platform -assign_role -team_name="name" -email="user@example.com" -role="admin"
 
     -reset_password                   Resets the password for a user.  It requires the
-                                      -team_name, -email and -password flag.
+                                      -email and -password flag.
         Example:
-            platform -reset_password -team_name="name" -email="user@example.com" -password="newpassword"
+            platform -reset_password -email="user@example.com" -password="newpassword"
 
     -permanent_delete_user            Permanently deletes a user and all related information
                                       including posts from the database.  It requires the 
-                                      -team_name, and -email flag.  You may need to restart the
+                                      -email flag.  You may need to restart the
                                       server to invalidate the cache
         Example:
-            platform -permanent_delete_user -team_name="name" -email="user@example.com"
+            platform -permanent_delete_user -email="user@example.com"
 
-    -permanent_delete_team            Permanently deletes a team and all users along with
-                                      all related information including posts from the database.
+    -permanent_delete_team            Permanently deletes a team and all users that don't belong
+                                      to another team along with all related information including
+                                      posts from the database.
                                       It requires the -team_name flag.  You may need to restart
                                       the server to invalidate the cache.
         Example:
@@ -6,6 +6,7 @@ package model
 import (
 	"encoding/json"
 	"io"
+	"strings"
 	"unicode/utf8"
 )
 
@@ -127,6 +128,27 @@ func (o *Channel) ExtraUpdated() {
 func (o *Channel) PreExport() {
 }
 
+// GetOtherUserIdForDM returns the id of the other user in a direct message
+// channel with userId, or an empty string if it isn't one.
+func (o *Channel) GetOtherUserIdForDM(userId string) string {
+	if o.Type != CHANNEL_DIRECT {
+		return ""
+	}
+
+	userIds := strings.Split(o.Name, "__")
+	if len(userIds) != 2 {
+		return ""
+	}
+
+	if userIds[0] == userId {
+		return userIds[1]
+	} else if userIds[1] == userId {
+		return userIds[0]
+	}
+
+	return ""
+}
+
 func GetDMNameFromIds(userId1, userId2 string) string {
 	if userId1 > userId2 {
 		return userId2 + "__" + userId1
@@ -23,9 +23,10 @@ func (o *ExtraMember) Sanitize(options map[string]bool) {
 }
 
 type ChannelExtra struct {
-	Id          string        `json:"id"`
-	Members     []ExtraMember `json:"members"`
-	MemberCount int64         `json:"member_count"`
+	Id              string        `json:"id"`
+	Members         []ExtraMember `json:"members"`
+	MemberCount     int64         `json:"member_count"`
+	PinnedPostCount int64         `json:"pinned_post_count"`
 }
 
 func (o *ChannelExtra) ToJson() string {
@@ -78,9 +78,30 @@ func (o *ChannelMember) IsValid() *AppError {
 			nil, "mark_unread_level="+markUnreadLevel)
 	}
 
+	if emailLevel, ok := o.NotifyProps["email"]; ok && !IsChannelNotifyLevelValid(emailLevel) {
+		return NewLocAppError("ChannelMember.IsValid", "model.channel_member.is_valid.email_level.app_error",
+			nil, "email_level="+emailLevel)
+	}
+
+	if pushLevel, ok := o.NotifyProps["push"]; ok && !IsChannelNotifyLevelValid(pushLevel) {
+		return NewLocAppError("ChannelMember.IsValid", "model.channel_member.is_valid.push_level.app_error",
+			nil, "push_level="+pushLevel)
+	}
+
+	if mute, ok := o.NotifyProps["mute"]; ok && !(mute == "true" || mute == "false") {
+		return NewLocAppError("ChannelMember.IsValid", "model.channel_member.is_valid.mute.app_error",
+			nil, "mute="+mute)
+	}
+
 	return nil
 }
 
+// IsMuted returns true if the member doesn't want to be notified about
+// anything posted in the channel.
+func (o *ChannelMember) IsMuted() bool {
+	return o.NotifyProps["mute"] == "true"
+}
+
 func (o *ChannelMember) PreSave() {
 	o.LastUpdateAt = GetMillis()
 }
@@ -103,6 +124,9 @@ func IsChannelMarkUnreadLevelValid(markUnreadLevel string) bool {
 func GetDefaultChannelNotifyProps() StringMap {
 	return StringMap{
 		"desktop":     CHANNEL_NOTIFY_DEFAULT,
+		"email":       CHANNEL_NOTIFY_DEFAULT,
+		"push":        CHANNEL_NOTIFY_DEFAULT,
 		"mark_unread": CHANNEL_MARK_UNREAD_ALL,
+		"mute":        "false",
 	}
 }
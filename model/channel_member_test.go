@@ -67,4 +67,36 @@ func TestChannelMemberIsValid(t *testing.T) {
 	if err := o.IsValid(); err != nil {
 		t.Fatal(err)
 	}
+
+	o.NotifyProps["email"] = "junk"
+	if err := o.IsValid(); err == nil {
+		t.Fatal("should be invalid")
+	}
+
+	o.NotifyProps["email"] = CHANNEL_NOTIFY_NONE
+	o.NotifyProps["push"] = "junk"
+	if err := o.IsValid(); err == nil {
+		t.Fatal("should be invalid")
+	}
+
+	o.NotifyProps["push"] = CHANNEL_NOTIFY_ALL
+	o.NotifyProps["mute"] = "junk"
+	if err := o.IsValid(); err == nil {
+		t.Fatal("should be invalid")
+	}
+
+	o.NotifyProps["mute"] = "true"
+	if err := o.IsValid(); err != nil {
+		t.Fatal(err)
+	} else if !o.IsMuted() {
+		t.Fatal("should be muted")
+	}
+
+	// members from before email and push levels were added are still valid
+	delete(o.NotifyProps, "email")
+	delete(o.NotifyProps, "push")
+	delete(o.NotifyProps, "mute")
+	if err := o.IsValid(); err != nil {
+		t.Fatal(err)
+	}
 }
@@ -89,6 +89,26 @@ func TestChannelIsValid(t *testing.T) {
 	}
 }
 
+func TestChannelGetOtherUserIdForDM(t *testing.T) {
+	userId1 := NewId()
+	userId2 := NewId()
+
+	o := Channel{Type: CHANNEL_DIRECT, Name: GetDMNameFromIds(userId1, userId2)}
+
+	if o.GetOtherUserIdForDM(userId1) != userId2 || o.GetOtherUserIdForDM(userId2) != userId1 {
+		t.Fatal("should have returned the other user")
+	}
+
+	if o.GetOtherUserIdForDM(NewId()) != "" {
+		t.Fatal("shouldn't have returned a user for someone outside the channel")
+	}
+
+	o.Type = CHANNEL_OPEN
+	if o.GetOtherUserIdForDM(userId1) != "" {
+		t.Fatal("shouldn't have returned a user for a channel that isn't a direct message")
+	}
+}
+
 func TestChannelPreSave(t *testing.T) {
 	o := Channel{Name: "test"}
 	o.PreSave()
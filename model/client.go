@@ -28,6 +28,8 @@ const (
 	HEADER_AUTH               = "Authorization"
 	HEADER_REQUESTED_WITH     = "X-Requested-With"
 	HEADER_REQUESTED_WITH_XML = "XMLHttpRequest"
+	HEADER_WEBHOOK_SIGNATURE  = "X-Mattermost-Signature"
+	HEADER_WEBHOOK_DELIVERY   = "X-Mattermost-Delivery"
 	API_URL_SUFFIX            = "/api/v1"
 )
 
@@ -349,6 +351,104 @@ func (c *Client) ClearOAuthToken() {
 	c.AuthType = HEADER_BEARER
 }
 
+// CreateUserAccessToken makes a personal access token for the user. The token
+// is only included in this result so it must be kept by the caller.
+func (c *Client) CreateUserAccessToken(userId string, token *UserAccessToken) (*Result, *AppError) {
+	if r, err := c.DoApiPost("/users/"+userId+"/tokens/create", token.ToJson()); err != nil {
+		return nil, err
+	} else {
+		return &Result{r.Header.Get(HEADER_REQUEST_ID),
+			r.Header.Get(HEADER_ETAG_SERVER), UserAccessTokenFromJson(r.Body)}, nil
+	}
+}
+
+func (c *Client) GetUserAccessTokens(userId string) (*Result, *AppError) {
+	if r, err := c.DoApiGet("/users/"+userId+"/tokens", "", ""); err != nil {
+		return nil, err
+	} else {
+		return &Result{r.Header.Get(HEADER_REQUEST_ID),
+			r.Header.Get(HEADER_ETAG_SERVER), UserAccessTokensFromJson(r.Body)}, nil
+	}
+}
+
+func (c *Client) RevokeUserAccessToken(tokenId string) (*Result, *AppError) {
+	m := make(map[string]string)
+	m["token_id"] = tokenId
+
+	if r, err := c.DoApiPost("/users/tokens/revoke", MapToJson(m)); err != nil {
+		return nil, err
+	} else {
+		return &Result{r.Header.Get(HEADER_REQUEST_ID),
+			r.Header.Get(HEADER_ETAG_SERVER), MapFromJson(r.Body)}, nil
+	}
+}
+
+// CreateBot makes a bot in the current team. The props are the bot's username,
+// nickname and callback_url, along with oauth_app_id if it should be owned by
+// an OAuth app instead of the current user.
+func (c *Client) CreateBot(props map[string]string) (*Result, *AppError) {
+	if r, err := c.DoApiPost("/bots/create", MapToJson(props)); err != nil {
+		return nil, err
+	} else {
+		return &Result{r.Header.Get(HEADER_REQUEST_ID),
+			r.Header.Get(HEADER_ETAG_SERVER), UserFromJson(r.Body)}, nil
+	}
+}
+
+func (c *Client) GetBots() (*Result, *AppError) {
+	if r, err := c.DoApiGet("/bots/", "", ""); err != nil {
+		return nil, err
+	} else {
+		return &Result{r.Header.Get(HEADER_REQUEST_ID),
+			r.Header.Get(HEADER_ETAG_SERVER), UserMapFromJson(r.Body)}, nil
+	}
+}
+
+func (c *Client) UpdateBot(botId string, props map[string]string) (*Result, *AppError) {
+	if r, err := c.DoApiPost("/bots/"+botId+"/update", MapToJson(props)); err != nil {
+		return nil, err
+	} else {
+		return &Result{r.Header.Get(HEADER_REQUEST_ID),
+			r.Header.Get(HEADER_ETAG_SERVER), UserFromJson(r.Body)}, nil
+	}
+}
+
+func (c *Client) GetRoles() (*Result, *AppError) {
+	if r, err := c.DoApiGet("/roles/", "", ""); err != nil {
+		return nil, err
+	} else {
+		return &Result{r.Header.Get(HEADER_REQUEST_ID),
+			r.Header.Get(HEADER_ETAG_SERVER), RolesFromJson(r.Body)}, nil
+	}
+}
+
+func (c *Client) CreateRole(role *Role) (*Result, *AppError) {
+	if r, err := c.DoApiPost("/roles/create", role.ToJson()); err != nil {
+		return nil, err
+	} else {
+		return &Result{r.Header.Get(HEADER_REQUEST_ID),
+			r.Header.Get(HEADER_ETAG_SERVER), RoleFromJson(r.Body)}, nil
+	}
+}
+
+func (c *Client) UpdateRole(role *Role) (*Result, *AppError) {
+	if r, err := c.DoApiPost("/roles/update", role.ToJson()); err != nil {
+		return nil, err
+	} else {
+		return &Result{r.Header.Get(HEADER_REQUEST_ID),
+			r.Header.Get(HEADER_ETAG_SERVER), RoleFromJson(r.Body)}, nil
+	}
+}
+
+func (c *Client) DeleteRole(roleId string) (*Result, *AppError) {
+	if r, err := c.DoApiPost("/roles/"+roleId+"/delete", ""); err != nil {
+		return nil, err
+	} else {
+		return &Result{r.Header.Get(HEADER_REQUEST_ID),
+			r.Header.Get(HEADER_ETAG_SERVER), MapFromJson(r.Body)}, nil
+	}
+}
+
 func (c *Client) RevokeSession(sessionAltId string) (*Result, *AppError) {
 	m := make(map[string]string)
 	m["id"] = sessionAltId
@@ -810,6 +910,180 @@ func (c *Client) DeletePost(channelId string, postId string) (*Result, *AppError
 	}
 }
 
+func (c *Client) GetPostThread(postId string) (*Result, *AppError) {
+	if r, err := c.DoApiGet(fmt.Sprintf("/posts/%v/thread", postId), "", ""); err != nil {
+		return nil, err
+	} else {
+		return &Result{r.Header.Get(HEADER_REQUEST_ID),
+			r.Header.Get(HEADER_ETAG_SERVER), PostListFromJson(r.Body)}, nil
+	}
+}
+
+func (c *Client) FollowThread(postId string) (*Result, *AppError) {
+	if r, err := c.DoApiPost(fmt.Sprintf("/posts/%v/thread/follow", postId), ""); err != nil {
+		return nil, err
+	} else {
+		return &Result{r.Header.Get(HEADER_REQUEST_ID),
+			r.Header.Get(HEADER_ETAG_SERVER), ThreadMemberFromJson(r.Body)}, nil
+	}
+}
+
+func (c *Client) UnfollowThread(postId string) (*Result, *AppError) {
+	if r, err := c.DoApiPost(fmt.Sprintf("/posts/%v/thread/unfollow", postId), ""); err != nil {
+		return nil, err
+	} else {
+		return &Result{r.Header.Get(HEADER_REQUEST_ID),
+			r.Header.Get(HEADER_ETAG_SERVER), ThreadMemberFromJson(r.Body)}, nil
+	}
+}
+
+func (c *Client) GetFollowedThreads(offset int, limit int) (*Result, *AppError) {
+	if r, err := c.DoApiGet(fmt.Sprintf("/posts/threads/%v/%v", offset, limit), "", ""); err != nil {
+		return nil, err
+	} else {
+		return &Result{r.Header.Get(HEADER_REQUEST_ID),
+			r.Header.Get(HEADER_ETAG_SERVER), ThreadListFromJson(r.Body)}, nil
+	}
+}
+
+func (c *Client) GetPostHistory(channelId string, postId string) (*Result, *AppError) {
+	if r, err := c.DoApiGet(fmt.Sprintf("/channels/%v/post/%v/history", channelId, postId), "", ""); err != nil {
+		return nil, err
+	} else {
+		return &Result{r.Header.Get(HEADER_REQUEST_ID),
+			r.Header.Get(HEADER_ETAG_SERVER), PostListFromJson(r.Body)}, nil
+	}
+}
+
+func (c *Client) PinPost(channelId string, postId string) (*Result, *AppError) {
+	if r, err := c.DoApiPost(fmt.Sprintf("/channels/%v/post/%v/pin", channelId, postId), ""); err != nil {
+		return nil, err
+	} else {
+		return &Result{r.Header.Get(HEADER_REQUEST_ID),
+			r.Header.Get(HEADER_ETAG_SERVER), PostFromJson(r.Body)}, nil
+	}
+}
+
+func (c *Client) UnpinPost(channelId string, postId string) (*Result, *AppError) {
+	if r, err := c.DoApiPost(fmt.Sprintf("/channels/%v/post/%v/unpin", channelId, postId), ""); err != nil {
+		return nil, err
+	} else {
+		return &Result{r.Header.Get(HEADER_REQUEST_ID),
+			r.Header.Get(HEADER_ETAG_SERVER), PostFromJson(r.Body)}, nil
+	}
+}
+
+func (c *Client) GetPinnedPosts(channelId string) (*Result, *AppError) {
+	if r, err := c.DoApiGet(fmt.Sprintf("/channels/%v/pinned", channelId), "", ""); err != nil {
+		return nil, err
+	} else {
+		return &Result{r.Header.Get(HEADER_REQUEST_ID),
+			r.Header.Get(HEADER_ETAG_SERVER), PostListFromJson(r.Body)}, nil
+	}
+}
+
+func (c *Client) FlagPost(postId string) (*Result, *AppError) {
+	if r, err := c.DoApiPost(fmt.Sprintf("/posts/%v/flag", postId), ""); err != nil {
+		return nil, err
+	} else {
+		return &Result{r.Header.Get(HEADER_REQUEST_ID),
+			r.Header.Get(HEADER_ETAG_SERVER), PreferenceFromJson(r.Body)}, nil
+	}
+}
+
+func (c *Client) UnflagPost(postId string) (*Result, *AppError) {
+	if r, err := c.DoApiPost(fmt.Sprintf("/posts/%v/unflag", postId), ""); err != nil {
+		return nil, err
+	} else {
+		return &Result{r.Header.Get(HEADER_REQUEST_ID),
+			r.Header.Get(HEADER_ETAG_SERVER), PreferenceFromJson(r.Body)}, nil
+	}
+}
+
+// DoPostAction clicks the action with the given id on one of the post's
+// attachments. selectedOption is only used by menu actions.
+func (c *Client) DoPostAction(postId, actionId, selectedOption string) (*Result, *AppError) {
+	data := map[string]string{"selected_option": selectedOption}
+	if r, err := c.DoApiPost(fmt.Sprintf("/posts/%v/actions/%v", postId, actionId), MapToJson(data)); err != nil {
+		return nil, err
+	} else {
+		return &Result{r.Header.Get(HEADER_REQUEST_ID),
+			r.Header.Get(HEADER_ETAG_SERVER), MapFromJson(r.Body)}, nil
+	}
+}
+
+func (c *Client) GetFlaggedPosts(offset int, limit int) (*Result, *AppError) {
+	if r, err := c.DoApiGet(fmt.Sprintf("/posts/flagged/%v/%v", offset, limit), "", ""); err != nil {
+		return nil, err
+	} else {
+		return &Result{r.Header.Get(HEADER_REQUEST_ID),
+			r.Header.Get(HEADER_ETAG_SERVER), PostListFromJson(r.Body)}, nil
+	}
+}
+
+func (c *Client) GetScheduledPosts() (*Result, *AppError) {
+	if r, err := c.DoApiGet("/scheduled_posts/", "", ""); err != nil {
+		return nil, err
+	} else {
+		return &Result{r.Header.Get(HEADER_REQUEST_ID),
+			r.Header.Get(HEADER_ETAG_SERVER), ScheduledPostsFromJson(r.Body)}, nil
+	}
+}
+
+func (c *Client) CreateScheduledPost(scheduledPost *ScheduledPost) (*Result, *AppError) {
+	if r, err := c.DoApiPost("/scheduled_posts/create", scheduledPost.ToJson()); err != nil {
+		return nil, err
+	} else {
+		return &Result{r.Header.Get(HEADER_REQUEST_ID),
+			r.Header.Get(HEADER_ETAG_SERVER), ScheduledPostFromJson(r.Body)}, nil
+	}
+}
+
+func (c *Client) UpdateScheduledPost(scheduledPost *ScheduledPost) (*Result, *AppError) {
+	if r, err := c.DoApiPost("/scheduled_posts/update", scheduledPost.ToJson()); err != nil {
+		return nil, err
+	} else {
+		return &Result{r.Header.Get(HEADER_REQUEST_ID),
+			r.Header.Get(HEADER_ETAG_SERVER), ScheduledPostFromJson(r.Body)}, nil
+	}
+}
+
+func (c *Client) DeleteScheduledPost(id string) (*Result, *AppError) {
+	if r, err := c.DoApiPost("/scheduled_posts/"+id+"/delete", ""); err != nil {
+		return nil, err
+	} else {
+		return &Result{r.Header.Get(HEADER_REQUEST_ID),
+			r.Header.Get(HEADER_ETAG_SERVER), MapFromJson(r.Body)}, nil
+	}
+}
+
+func (c *Client) SaveReaction(channelId string, reaction *Reaction) (*Result, *AppError) {
+	if r, err := c.DoApiPost(fmt.Sprintf("/channels/%v/post/%v/reactions/save", channelId, reaction.PostId), reaction.ToJson()); err != nil {
+		return nil, err
+	} else {
+		return &Result{r.Header.Get(HEADER_REQUEST_ID),
+			r.Header.Get(HEADER_ETAG_SERVER), ReactionFromJson(r.Body)}, nil
+	}
+}
+
+func (c *Client) DeleteReaction(channelId string, reaction *Reaction) (*Result, *AppError) {
+	if r, err := c.DoApiPost(fmt.Sprintf("/channels/%v/post/%v/reactions/delete", channelId, reaction.PostId), reaction.ToJson()); err != nil {
+		return nil, err
+	} else {
+		return &Result{r.Header.Get(HEADER_REQUEST_ID),
+			r.Header.Get(HEADER_ETAG_SERVER), ReactionFromJson(r.Body)}, nil
+	}
+}
+
+func (c *Client) ListReactions(channelId string, postId string) (*Result, *AppError) {
+	if r, err := c.DoApiGet(fmt.Sprintf("/channels/%v/post/%v/reactions", channelId, postId), "", ""); err != nil {
+		return nil, err
+	} else {
+		return &Result{r.Header.Get(HEADER_REQUEST_ID),
+			r.Header.Get(HEADER_ETAG_SERVER), ReactionsFromJson(r.Body)}, nil
+	}
+}
+
 func (c *Client) SearchPosts(terms string) (*Result, *AppError) {
 	if r, err := c.DoApiGet("/posts/search?terms="+url.QueryEscape(terms), "", ""); err != nil {
 		return nil, err
@@ -819,6 +1093,18 @@ func (c *Client) SearchPosts(terms string) (*Result, *AppError) {
 	}
 }
 
+// SearchPostsWithOptions returns a page of search results along with the parts
+// of each post that matched the search terms.
+func (c *Client) SearchPostsWithOptions(terms string, offset int, limit int) (*Result, *AppError) {
+	query := fmt.Sprintf("/posts/search?terms=%v&offset=%v&limit=%v", url.QueryEscape(terms), offset, limit)
+	if r, err := c.DoApiGet(query, "", ""); err != nil {
+		return nil, err
+	} else {
+		return &Result{r.Header.Get(HEADER_REQUEST_ID),
+			r.Header.Get(HEADER_ETAG_SERVER), PostSearchResultsFromJson(r.Body)}, nil
+	}
+}
+
 func (c *Client) UploadFile(url string, data []byte, contentType string) (*Result, *AppError) {
 	rq, _ := http.NewRequest("POST", c.ApiUrl+url, bytes.NewReader(data))
 	rq.Header.Set("Content-Type", contentType)
@@ -877,6 +1163,80 @@ func (c *Client) GetFileInfo(url string) (*Result, *AppError) {
 	}
 }
 
+// GetFileInfosForChannel returns a page of the files that have been posted in
+// a channel, newest first.
+func (c *Client) GetFileInfosForChannel(channelId string, offset int, limit int) (*Result, *AppError) {
+	if r, err := c.DoApiGet(fmt.Sprintf("/files/channel/%v/%v/%v", channelId, offset, limit), "", ""); err != nil {
+		return nil, err
+	} else {
+		return &Result{r.Header.Get(HEADER_REQUEST_ID),
+			r.Header.Get(HEADER_ETAG_SERVER), FileInfosFromJson(r.Body)}, nil
+	}
+}
+
+func (c *Client) SearchFiles(terms string) (*Result, *AppError) {
+	if r, err := c.DoApiGet("/files/search?terms="+url.QueryEscape(terms), "", ""); err != nil {
+		return nil, err
+	} else {
+		return &Result{r.Header.Get(HEADER_REQUEST_ID),
+			r.Header.Get(HEADER_ETAG_SERVER), FileInfosFromJson(r.Body)}, nil
+	}
+}
+
+func (c *Client) CreateUploadSession(session *UploadSession) (*Result, *AppError) {
+	if r, err := c.DoApiPost("/files/uploads/create", session.ToJson()); err != nil {
+		return nil, err
+	} else {
+		return &Result{r.Header.Get(HEADER_REQUEST_ID),
+			r.Header.Get(HEADER_ETAG_SERVER), UploadSessionFromJson(r.Body)}, nil
+	}
+}
+
+func (c *Client) GetUploadSession(id string) (*Result, *AppError) {
+	if r, err := c.DoApiGet("/files/uploads/"+id, "", ""); err != nil {
+		return nil, err
+	} else {
+		return &Result{r.Header.Get(HEADER_REQUEST_ID),
+			r.Header.Get(HEADER_ETAG_SERVER), UploadSessionFromJson(r.Body)}, nil
+	}
+}
+
+// UploadChunk sends the part of the file that starts offset bytes into it.
+func (c *Client) UploadChunk(id string, offset int64, data []byte) (*Result, *AppError) {
+	rq, _ := http.NewRequest("PUT", c.ApiUrl+"/files/uploads/"+id+"?offset="+strconv.FormatInt(offset, 10), bytes.NewReader(data))
+
+	if len(c.AuthToken) > 0 {
+		rq.Header.Set(HEADER_AUTH, c.AuthType+" "+c.AuthToken)
+	}
+
+	if rp, err := c.HttpClient.Do(rq); err != nil {
+		return nil, NewLocAppError("UploadChunk", "model.client.connecting.app_error", nil, err.Error())
+	} else if rp.StatusCode >= 300 {
+		return nil, AppErrorFromJson(rp.Body)
+	} else {
+		return &Result{rp.Header.Get(HEADER_REQUEST_ID),
+			rp.Header.Get(HEADER_ETAG_SERVER), UploadSessionFromJson(rp.Body)}, nil
+	}
+}
+
+func (c *Client) FinishUpload(id string) (*Result, *AppError) {
+	if r, err := c.DoApiPost("/files/uploads/"+id+"/finish", ""); err != nil {
+		return nil, err
+	} else {
+		return &Result{r.Header.Get(HEADER_REQUEST_ID),
+			r.Header.Get(HEADER_ETAG_SERVER), FileUploadResponseFromJson(r.Body)}, nil
+	}
+}
+
+func (c *Client) CancelUpload(id string) (*Result, *AppError) {
+	if r, err := c.DoApiPost("/files/uploads/"+id+"/cancel", ""); err != nil {
+		return nil, err
+	} else {
+		return &Result{r.Header.Get(HEADER_REQUEST_ID),
+			r.Header.Get(HEADER_ETAG_SERVER), MapFromJson(r.Body)}, nil
+	}
+}
+
 func (c *Client) GetPublicLink(data map[string]string) (*Result, *AppError) {
 	if r, err := c.DoApiPost("/files/get_public_link", MapToJson(data)); err != nil {
 		return nil, err
@@ -927,6 +1287,20 @@ func (c *Client) UpdateActive(userId string, active bool) (*Result, *AppError) {
 	}
 }
 
+// UpdateGuestExpiry sets the time in milliseconds after which the guest can no
+// longer log in. An expiry of 0 lets them log in indefinitely.
+func (c *Client) UpdateGuestExpiry(userId string, expiresAt int64) (*Result, *AppError) {
+	data := make(map[string]string)
+	data["user_id"] = userId
+	data["expires_at"] = strconv.FormatInt(expiresAt, 10)
+	if r, err := c.DoApiPost("/users/update_guest_expiry", MapToJson(data)); err != nil {
+		return nil, err
+	} else {
+		return &Result{r.Header.Get(HEADER_REQUEST_ID),
+			r.Header.Get(HEADER_ETAG_SERVER), MapFromJson(r.Body)}, nil
+	}
+}
+
 func (c *Client) UpdateUserNotify(data map[string]string) (*Result, *AppError) {
 	if r, err := c.DoApiPost("/users/update_notify", MapToJson(data)); err != nil {
 		return nil, err
@@ -977,6 +1351,27 @@ func (c *Client) GetStatuses(data []string) (*Result, *AppError) {
 	}
 }
 
+// GetMyStatus returns the status and do not disturb schedule set by the
+// current user.
+func (c *Client) GetMyStatus() (*Result, *AppError) {
+	if r, err := c.DoApiGet("/users/status/me", "", ""); err != nil {
+		return nil, err
+	} else {
+		return &Result{r.Header.Get(HEADER_REQUEST_ID),
+			r.Header.Get(HEADER_ETAG_SERVER), StatusFromJson(r.Body)}, nil
+	}
+}
+
+// SetStatus sets the current user's manual status and do not disturb schedule.
+func (c *Client) SetStatus(status *Status) (*Result, *AppError) {
+	if r, err := c.DoApiPost("/users/status/set", status.ToJson()); err != nil {
+		return nil, err
+	} else {
+		return &Result{r.Header.Get(HEADER_REQUEST_ID),
+			r.Header.Get(HEADER_ETAG_SERVER), StatusFromJson(r.Body)}, nil
+	}
+}
+
 func (c *Client) GetMyTeam(etag string) (*Result, *AppError) {
 	if r, err := c.DoApiGet("/teams/me", "", etag); err != nil {
 		return nil, err
@@ -986,6 +1381,56 @@ func (c *Client) GetMyTeam(etag string) (*Result, *AppError) {
 	}
 }
 
+func (c *Client) GetMyTeamMembers() (*Result, *AppError) {
+	if r, err := c.DoApiGet("/teams/my_members", "", ""); err != nil {
+		return nil, err
+	} else {
+		return &Result{r.Header.Get(HEADER_REQUEST_ID),
+			r.Header.Get(HEADER_ETAG_SERVER), TeamMembersFromJson(r.Body)}, nil
+	}
+}
+
+func (c *Client) GetTeamMembers(teamId string) (*Result, *AppError) {
+	if r, err := c.DoApiGet("/teams/"+teamId+"/members", "", ""); err != nil {
+		return nil, err
+	} else {
+		return &Result{r.Header.Get(HEADER_REQUEST_ID),
+			r.Header.Get(HEADER_ETAG_SERVER), TeamMembersFromJson(r.Body)}, nil
+	}
+}
+
+// JoinTeam adds the current user to an open team.
+func (c *Client) JoinTeam(teamId string) (*Result, *AppError) {
+	if r, err := c.DoApiPost("/teams/"+teamId+"/join", ""); err != nil {
+		return nil, err
+	} else {
+		return &Result{r.Header.Get(HEADER_REQUEST_ID),
+			r.Header.Get(HEADER_ETAG_SERVER), TeamFromJson(r.Body)}, nil
+	}
+}
+
+func (c *Client) AddUserToTeam(teamId string, userId string) (*Result, *AppError) {
+	data := make(map[string]string)
+	data["user_id"] = userId
+	if r, err := c.DoApiPost("/teams/"+teamId+"/add_user_to_team", MapToJson(data)); err != nil {
+		return nil, err
+	} else {
+		return &Result{r.Header.Get(HEADER_REQUEST_ID),
+			r.Header.Get(HEADER_ETAG_SERVER), MapFromJson(r.Body)}, nil
+	}
+}
+
+func (c *Client) RemoveUserFromTeam(teamId string, userId string) (*Result, *AppError) {
+	data := make(map[string]string)
+	data["user_id"] = userId
+	if r, err := c.DoApiPost("/teams/"+teamId+"/remove_user_from_team", MapToJson(data)); err != nil {
+		return nil, err
+	} else {
+		return &Result{r.Header.Get(HEADER_REQUEST_ID),
+			r.Header.Get(HEADER_ETAG_SERVER), MapFromJson(r.Body)}, nil
+	}
+}
+
 func (c *Client) RegisterApp(app *OAuthApp) (*Result, *AppError) {
 	if r, err := c.DoApiPost("/oauth/register", app.ToJson()); err != nil {
 		return nil, err
@@ -1111,6 +1556,15 @@ func (c *Client) ListOutgoingWebhooks() (*Result, *AppError) {
 	}
 }
 
+func (c *Client) GetOutgoingWebhookDeliveries(hookId string, offset int, limit int) (*Result, *AppError) {
+	if r, err := c.DoApiGet(fmt.Sprintf("/hooks/outgoing/%v/deliveries?offset=%v&limit=%v", hookId, offset, limit), "", ""); err != nil {
+		return nil, err
+	} else {
+		return &Result{r.Header.Get(HEADER_REQUEST_ID),
+			r.Header.Get(HEADER_ETAG_SERVER), OutgoingWebhookDeliveryListFromJson(r.Body)}, nil
+	}
+}
+
 func (c *Client) RegenOutgoingWebhookToken(data map[string]string) (*Result, *AppError) {
 	if r, err := c.DoApiPost("/hooks/outgoing/regen_token", MapToJson(data)); err != nil {
 		return nil, err
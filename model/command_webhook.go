@@ -0,0 +1,90 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package model
+
+import (
+	"encoding/json"
+	"io"
+)
+
+const (
+	COMMAND_WEBHOOK_LIFETIME = 30 * 60 * 1000
+)
+
+// CommandWebhook is the response URL handed to a custom slash command when it
+// is run. The command can post a single delayed response to it as long as it
+// hasn't expired.
+type CommandWebhook struct {
+	Id        string `json:"id"`
+	CreateAt  int64  `json:"create_at"`
+	CommandId string `json:"command_id"`
+	UserId    string `json:"user_id"`
+	TeamId    string `json:"team_id"`
+	ChannelId string `json:"channel_id"`
+	UseCount  int    `json:"use_count"`
+	SiteURL   string `json:"-"`
+}
+
+func (o *CommandWebhook) ToJson() string {
+	b, err := json.Marshal(o)
+	if err != nil {
+		return ""
+	} else {
+		return string(b)
+	}
+}
+
+func CommandWebhookFromJson(data io.Reader) *CommandWebhook {
+	decoder := json.NewDecoder(data)
+	var o CommandWebhook
+	err := decoder.Decode(&o)
+	if err == nil {
+		return &o
+	} else {
+		return nil
+	}
+}
+
+func (o *CommandWebhook) IsValid() *AppError {
+
+	if len(o.Id) != 26 {
+		return NewLocAppError("CommandWebhook.IsValid", "model.command_hook.is_valid.id.app_error", nil, "")
+	}
+
+	if o.CreateAt == 0 {
+		return NewLocAppError("CommandWebhook.IsValid", "model.command_hook.is_valid.create_at.app_error", nil, "id="+o.Id)
+	}
+
+	if len(o.CommandId) != 26 {
+		return NewLocAppError("CommandWebhook.IsValid", "model.command_hook.is_valid.command_id.app_error", nil, "id="+o.Id)
+	}
+
+	if len(o.UserId) != 26 {
+		return NewLocAppError("CommandWebhook.IsValid", "model.command_hook.is_valid.user_id.app_error", nil, "id="+o.Id)
+	}
+
+	if len(o.TeamId) != 26 {
+		return NewLocAppError("CommandWebhook.IsValid", "model.command_hook.is_valid.team_id.app_error", nil, "id="+o.Id)
+	}
+
+	if len(o.ChannelId) != 26 {
+		return NewLocAppError("CommandWebhook.IsValid", "model.command_hook.is_valid.channel_id.app_error", nil, "id="+o.Id)
+	}
+
+	return nil
+}
+
+func (o *CommandWebhook) PreSave() {
+	if o.Id == "" {
+		o.Id = NewId()
+	}
+
+	o.CreateAt = GetMillis()
+	o.UseCount = 0
+}
+
+// IsExpired returns true once the response URL can no longer be used.
+func (o *CommandWebhook) IsExpired(now int64) bool {
+	return now-o.CreateAt > COMMAND_WEBHOOK_LIFETIME
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package model
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCommandWebhookJson(t *testing.T) {
+	o := CommandWebhook{Id: NewId(), SiteURL: "http://localhost:8065"}
+	json := o.ToJson()
+	ro := CommandWebhookFromJson(strings.NewReader(json))
+
+	if o.Id != ro.Id {
+		t.Fatal("Ids do not match")
+	}
+
+	if ro.SiteURL != "" {
+		t.Fatal("site url shouldn't be serialized")
+	}
+}
+
+func TestCommandWebhookIsValid(t *testing.T) {
+	o := CommandWebhook{}
+
+	if err := o.IsValid(); err == nil {
+		t.Fatal("should be invalid")
+	}
+
+	o.CommandId = NewId()
+	o.UserId = NewId()
+	o.TeamId = NewId()
+	o.PreSave()
+
+	if err := o.IsValid(); err == nil {
+		t.Fatal("should be invalid")
+	}
+
+	o.ChannelId = NewId()
+	if err := o.IsValid(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCommandWebhookIsExpired(t *testing.T) {
+	o := CommandWebhook{}
+	o.PreSave()
+
+	if o.IsExpired(o.CreateAt + 1000) {
+		t.Fatal("shouldn't have expired yet")
+	}
+
+	if !o.IsExpired(o.CreateAt + COMMAND_WEBHOOK_LIFETIME + 1) {
+		t.Fatal("should have expired")
+	}
+}
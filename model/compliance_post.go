@@ -26,6 +26,7 @@ type CompliancePost struct {
 	PostId         string
 	PostCreateAt   int64
 	PostUpdateAt   int64
+	PostEditAt     int64
 	PostDeleteAt   int64
 	PostRootId     string
 	PostParentId   string
@@ -52,6 +53,7 @@ func CompliancePostHeader() []string {
 		"PostId",
 		"PostCreateAt",
 		"PostUpdateAt",
+		"PostEditAt",
 		"PostDeleteAt",
 		"PostRootId",
 		"PostParentId",
@@ -76,6 +78,11 @@ func (me *CompliancePost) Row() []string {
 		postUpdateAt = time.Unix(0, me.PostUpdateAt*int64(1000*1000)).Format(time.RFC3339)
 	}
 
+	postEditAt := ""
+	if me.PostEditAt > 0 {
+		postEditAt = time.Unix(0, me.PostEditAt*int64(1000*1000)).Format(time.RFC3339)
+	}
+
 	return []string{
 		me.TeamName,
 		me.TeamDisplayName,
@@ -90,6 +97,7 @@ func (me *CompliancePost) Row() []string {
 		me.PostId,
 		time.Unix(0, me.PostCreateAt*int64(1000*1000)).Format(time.RFC3339),
 		postUpdateAt,
+		postEditAt,
 		postDeleteAt,
 
 		me.PostRootId,
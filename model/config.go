@@ -6,6 +6,7 @@ package model
 import (
 	"encoding/json"
 	"io"
+	"net"
 )
 
 const (
@@ -13,8 +14,9 @@ const (
 	CONN_SECURITY_TLS      = "TLS"
 	CONN_SECURITY_STARTTLS = "STARTTLS"
 
-	IMAGE_DRIVER_LOCAL = "local"
-	IMAGE_DRIVER_S3    = "amazons3"
+	IMAGE_DRIVER_LOCAL  = "local"
+	IMAGE_DRIVER_S3     = "amazons3"
+	IMAGE_DRIVER_WEBDAV = "webdav"
 
 	DATABASE_DRIVER_MYSQL    = "mysql"
 	DATABASE_DRIVER_POSTGRES = "postgres"
@@ -28,33 +30,49 @@ const (
 
 	GENERIC_NOTIFICATION = "generic"
 	FULL_NOTIFICATION    = "full"
+
+	CLUSTER_SECRET_MIN_LENGTH = 16
+
+	SEARCH_ENGINE_DATABASE = "database"
+	SEARCH_ENGINE_INDEX    = "index"
+
+	PUSH_NOTIFICATION_DRIVER_PROXY  = "proxy"
+	PUSH_NOTIFICATION_DRIVER_NATIVE = "native"
+
+	APPLE_PUSH_SERVER   = "https://api.push.apple.com"
+	ANDROID_PUSH_SERVER = "https://fcm.googleapis.com/fcm/send"
 )
 
 type ServiceSettings struct {
-	ListenAddress                     string
-	MaximumLoginAttempts              int
-	SegmentDeveloperKey               string
-	GoogleDeveloperKey                string
-	EnableOAuthServiceProvider        bool
-	EnableIncomingWebhooks            bool
-	EnableOutgoingWebhooks            bool
-	EnableCommands                    *bool
-	EnableOnlyAdminIntegrations       *bool
-	EnablePostUsernameOverride        bool
-	EnablePostIconOverride            bool
-	EnableTesting                     bool
-	EnableDeveloper                   *bool
-	EnableSecurityFixAlert            *bool
-	EnableInsecureOutgoingConnections *bool
-	EnableMultifactorAuthentication   *bool
-	AllowCorsFrom                     *string
-	SessionLengthWebInDays            *int
-	SessionLengthMobileInDays         *int
-	SessionLengthSSOInDays            *int
-	SessionCacheInMinutes             *int
-	WebsocketSecurePort               *int
-	WebsocketPort                     *int
-	WebserverMode                     *string
+	ListenAddress                       string
+	MaximumLoginAttempts                int
+	SegmentDeveloperKey                 string
+	GoogleDeveloperKey                  string
+	EnableOAuthServiceProvider          bool
+	EnableIncomingWebhooks              bool
+	EnableOutgoingWebhooks              bool
+	EnableCommands                      *bool
+	EnableOnlyAdminIntegrations         *bool
+	EnablePostUsernameOverride          bool
+	EnablePostIconOverride              bool
+	EnableTesting                       bool
+	EnableDeveloper                     *bool
+	EnableSecurityFixAlert              *bool
+	EnableInsecureOutgoingConnections   *bool
+	EnableMultifactorAuthentication     *bool
+	AllowCorsFrom                       *string
+	SessionLengthWebInDays              *int
+	SessionLengthMobileInDays           *int
+	SessionLengthSSOInDays              *int
+	SessionCacheInMinutes               *int
+	WebsocketSecurePort                 *int
+	WebsocketPort                       *int
+	WebserverMode                       *string
+	OutgoingWebhookTimeout              *int
+	OutgoingWebhookMaxAttempts          *int
+	EnableUserAccessTokens              *bool
+	AllowedUntrustedInternalConnections *string
+	EnableBotCallbacks                  *bool
 }
 
 type SSOSettings struct {
@@ -106,6 +124,10 @@ type FileSettings struct {
 	AmazonS3BucketEndpoint     string
 	AmazonS3LocationConstraint *bool
 	AmazonS3LowercaseBucket    *bool
+	WebDAVUrl                  *string
+	WebDAVUsername             *string
+	WebDAVPassword             *string
+	MaxUploadSize              *int64
 }
 
 type EmailSettings struct {
@@ -126,6 +148,13 @@ type EmailSettings struct {
 	SendPushNotifications    *bool
 	PushNotificationServer   *string
 	PushNotificationContents *string
+	PushNotificationDriver   *string
+	ApplePushServer          *string
+	ApplePushCertificate     *string
+	ApplePushKey             *string
+	ApplePushTopic           *string
+	AndroidPushServer        *string
+	AndroidPushKey           *string
 }
 
 type RateLimitSettings struct {
@@ -191,12 +220,50 @@ type LdapSettings struct {
 	PasswordFieldName *string
 }
 
+type SamlSettings struct {
+	// Basic
+	Enable  *bool
+	Verify  *bool
+	Encrypt *bool
+
+	IdpUrl                      *string
+	IdpDescriptorUrl            *string
+	AssertionConsumerServiceURL *string
+
+	IdpCertificateFile    *string
+	PublicCertificateFile *string
+	PrivateKeyFile        *string
+
+	// User Mapping
+	FirstNameAttribute *string
+	LastNameAttribute  *string
+	EmailAttribute     *string
+	UsernameAttribute  *string
+	NicknameAttribute  *string
+	LocaleAttribute    *string
+
+	// Customization
+	LoginButtonText *string
+}
+
 type ComplianceSettings struct {
 	Enable      *bool
 	Directory   *string
 	EnableDaily *bool
 }
 
+type ClusterSettings struct {
+	Enable                 *bool
+	InterNodeListenAddress *string
+	InterNodeAddresses     []string
+	InterNodeSecret        *string
+}
+
+type SearchSettings struct {
+	Engine         *string
+	IndexDirectory *string
+}
+
 type Config struct {
 	ServiceSettings    ServiceSettings
 	TeamSettings       TeamSettings
@@ -210,7 +277,10 @@ type Config struct {
 	GitLabSettings     SSOSettings
 	GoogleSettings     SSOSettings
 	LdapSettings       LdapSettings
+	SamlSettings       SamlSettings
 	ComplianceSettings ComplianceSettings
+	ClusterSettings    ClusterSettings
+	SearchSettings     SearchSettings
 }
 
 func (o *Config) ToJson() string {
@@ -264,6 +334,26 @@ func (o *Config) SetDefaults() {
 		*o.FileSettings.AmazonS3LowercaseBucket = false
 	}
 
+	if o.FileSettings.WebDAVUrl == nil {
+		o.FileSettings.WebDAVUrl = new(string)
+		*o.FileSettings.WebDAVUrl = ""
+	}
+
+	if o.FileSettings.WebDAVUsername == nil {
+		o.FileSettings.WebDAVUsername = new(string)
+		*o.FileSettings.WebDAVUsername = ""
+	}
+
+	if o.FileSettings.WebDAVPassword == nil {
+		o.FileSettings.WebDAVPassword = new(string)
+		*o.FileSettings.WebDAVPassword = ""
+	}
+
+	if o.FileSettings.MaxUploadSize == nil {
+		o.FileSettings.MaxUploadSize = new(int64)
+		*o.FileSettings.MaxUploadSize = 10000000000 // 10 GB
+	}
+
 	if len(o.EmailSettings.InviteSalt) == 0 {
 		o.EmailSettings.InviteSalt = NewRandomString(32)
 	}
@@ -287,6 +377,16 @@ func (o *Config) SetDefaults() {
 		*o.ServiceSettings.EnableInsecureOutgoingConnections = false
 	}
 
+	if o.ServiceSettings.AllowedUntrustedInternalConnections == nil {
+		o.ServiceSettings.AllowedUntrustedInternalConnections = new(string)
+		*o.ServiceSettings.AllowedUntrustedInternalConnections = ""
+	}
+
+	if o.ServiceSettings.EnableBotCallbacks == nil {
+		o.ServiceSettings.EnableBotCallbacks = new(bool)
+		*o.ServiceSettings.EnableBotCallbacks = false
+	}
+
 	if o.ServiceSettings.EnableMultifactorAuthentication == nil {
 		o.ServiceSettings.EnableMultifactorAuthentication = new(bool)
 		*o.ServiceSettings.EnableMultifactorAuthentication = false
@@ -342,6 +442,41 @@ func (o *Config) SetDefaults() {
 		*o.EmailSettings.PushNotificationContents = GENERIC_NOTIFICATION
 	}
 
+	if o.EmailSettings.PushNotificationDriver == nil {
+		o.EmailSettings.PushNotificationDriver = new(string)
+		*o.EmailSettings.PushNotificationDriver = PUSH_NOTIFICATION_DRIVER_PROXY
+	}
+
+	if o.EmailSettings.ApplePushServer == nil {
+		o.EmailSettings.ApplePushServer = new(string)
+		*o.EmailSettings.ApplePushServer = APPLE_PUSH_SERVER
+	}
+
+	if o.EmailSettings.ApplePushCertificate == nil {
+		o.EmailSettings.ApplePushCertificate = new(string)
+		*o.EmailSettings.ApplePushCertificate = ""
+	}
+
+	if o.EmailSettings.ApplePushKey == nil {
+		o.EmailSettings.ApplePushKey = new(string)
+		*o.EmailSettings.ApplePushKey = ""
+	}
+
+	if o.EmailSettings.ApplePushTopic == nil {
+		o.EmailSettings.ApplePushTopic = new(string)
+		*o.EmailSettings.ApplePushTopic = ""
+	}
+
+	if o.EmailSettings.AndroidPushServer == nil {
+		o.EmailSettings.AndroidPushServer = new(string)
+		*o.EmailSettings.AndroidPushServer = ANDROID_PUSH_SERVER
+	}
+
+	if o.EmailSettings.AndroidPushKey == nil {
+		o.EmailSettings.AndroidPushKey = new(string)
+		*o.EmailSettings.AndroidPushKey = ""
+	}
+
 	if o.SupportSettings.TermsOfServiceLink == nil {
 		o.SupportSettings.TermsOfServiceLink = new(string)
 		*o.SupportSettings.TermsOfServiceLink = "/static/help/terms.html"
@@ -452,6 +587,21 @@ func (o *Config) SetDefaults() {
 		*o.ServiceSettings.WebserverMode = "regular"
 	}
 
+	if o.ServiceSettings.OutgoingWebhookTimeout == nil {
+		o.ServiceSettings.OutgoingWebhookTimeout = new(int)
+		*o.ServiceSettings.OutgoingWebhookTimeout = 10
+	}
+
+	if o.ServiceSettings.OutgoingWebhookMaxAttempts == nil {
+		o.ServiceSettings.OutgoingWebhookMaxAttempts = new(int)
+		*o.ServiceSettings.OutgoingWebhookMaxAttempts = 5
+	}
+
+	if o.ServiceSettings.EnableUserAccessTokens == nil {
+		o.ServiceSettings.EnableUserAccessTokens = new(bool)
+		*o.ServiceSettings.EnableUserAccessTokens = false
+	}
+
 	if o.ComplianceSettings.Enable == nil {
 		o.ComplianceSettings.Enable = new(bool)
 		*o.ComplianceSettings.Enable = false
@@ -476,6 +626,115 @@ func (o *Config) SetDefaults() {
 		o.LdapSettings.SkipCertificateVerification = new(bool)
 		*o.LdapSettings.SkipCertificateVerification = false
 	}
+
+	if o.SamlSettings.Enable == nil {
+		o.SamlSettings.Enable = new(bool)
+		*o.SamlSettings.Enable = false
+	}
+
+	if o.SamlSettings.Verify == nil {
+		o.SamlSettings.Verify = new(bool)
+		*o.SamlSettings.Verify = true
+	}
+
+	if o.SamlSettings.Encrypt == nil {
+		o.SamlSettings.Encrypt = new(bool)
+		*o.SamlSettings.Encrypt = true
+	}
+
+	if o.SamlSettings.IdpUrl == nil {
+		o.SamlSettings.IdpUrl = new(string)
+		*o.SamlSettings.IdpUrl = ""
+	}
+
+	if o.SamlSettings.IdpDescriptorUrl == nil {
+		o.SamlSettings.IdpDescriptorUrl = new(string)
+		*o.SamlSettings.IdpDescriptorUrl = ""
+	}
+
+	if o.SamlSettings.AssertionConsumerServiceURL == nil {
+		o.SamlSettings.AssertionConsumerServiceURL = new(string)
+		*o.SamlSettings.AssertionConsumerServiceURL = ""
+	}
+
+	if o.SamlSettings.IdpCertificateFile == nil {
+		o.SamlSettings.IdpCertificateFile = new(string)
+		*o.SamlSettings.IdpCertificateFile = ""
+	}
+
+	if o.SamlSettings.PublicCertificateFile == nil {
+		o.SamlSettings.PublicCertificateFile = new(string)
+		*o.SamlSettings.PublicCertificateFile = ""
+	}
+
+	if o.SamlSettings.PrivateKeyFile == nil {
+		o.SamlSettings.PrivateKeyFile = new(string)
+		*o.SamlSettings.PrivateKeyFile = ""
+	}
+
+	if o.SamlSettings.FirstNameAttribute == nil {
+		o.SamlSettings.FirstNameAttribute = new(string)
+		*o.SamlSettings.FirstNameAttribute = ""
+	}
+
+	if o.SamlSettings.LastNameAttribute == nil {
+		o.SamlSettings.LastNameAttribute = new(string)
+		*o.SamlSettings.LastNameAttribute = ""
+	}
+
+	if o.SamlSettings.EmailAttribute == nil {
+		o.SamlSettings.EmailAttribute = new(string)
+		*o.SamlSettings.EmailAttribute = ""
+	}
+
+	if o.SamlSettings.UsernameAttribute == nil {
+		o.SamlSettings.UsernameAttribute = new(string)
+		*o.SamlSettings.UsernameAttribute = ""
+	}
+
+	if o.SamlSettings.NicknameAttribute == nil {
+		o.SamlSettings.NicknameAttribute = new(string)
+		*o.SamlSettings.NicknameAttribute = ""
+	}
+
+	if o.SamlSettings.LocaleAttribute == nil {
+		o.SamlSettings.LocaleAttribute = new(string)
+		*o.SamlSettings.LocaleAttribute = ""
+	}
+
+	if o.SamlSettings.LoginButtonText == nil {
+		o.SamlSettings.LoginButtonText = new(string)
+		*o.SamlSettings.LoginButtonText = USER_AUTH_SERVICE_SAML_TEXT
+	}
+
+	if o.ClusterSettings.Enable == nil {
+		o.ClusterSettings.Enable = new(bool)
+		*o.ClusterSettings.Enable = false
+	}
+
+	if o.ClusterSettings.InterNodeListenAddress == nil {
+		o.ClusterSettings.InterNodeListenAddress = new(string)
+		*o.ClusterSettings.InterNodeListenAddress = "127.0.0.1:8075"
+	}
+
+	if o.ClusterSettings.InterNodeSecret == nil {
+		o.ClusterSettings.InterNodeSecret = new(string)
+		*o.ClusterSettings.InterNodeSecret = ""
+	}
+
+	if o.ClusterSettings.InterNodeAddresses == nil {
+		o.ClusterSettings.InterNodeAddresses = []string{}
+	}
+
+	if o.SearchSettings.Engine == nil {
+		o.SearchSettings.Engine = new(string)
+		*o.SearchSettings.Engine = SEARCH_ENGINE_DATABASE
+	}
+
+	if o.SearchSettings.IndexDirectory == nil {
+		o.SearchSettings.IndexDirectory = new(string)
+		*o.SearchSettings.IndexDirectory = "./data/search/"
+	}
 }
 
 func (o *Config) IsValid() *AppError {
@@ -488,6 +747,14 @@ func (o *Config) IsValid() *AppError {
 		return NewLocAppError("Config.IsValid", "model.config.is_valid.listen_address.app_error", nil, "")
 	}
 
+	if *o.ServiceSettings.OutgoingWebhookTimeout <= 0 {
+		return NewLocAppError("Config.IsValid", "model.config.is_valid.outgoing_webhook_timeout.app_error", nil, "")
+	}
+
+	if *o.ServiceSettings.OutgoingWebhookMaxAttempts <= 0 {
+		return NewLocAppError("Config.IsValid", "model.config.is_valid.outgoing_webhook_max_attempts.app_error", nil, "")
+	}
+
 	if o.TeamSettings.MaxUsersPerTeam <= 0 {
 		return NewLocAppError("Config.IsValid", "model.config.is_valid.max_users.app_error", nil, "")
 	}
@@ -512,10 +779,18 @@ func (o *Config) IsValid() *AppError {
 		return NewLocAppError("Config.IsValid", "model.config.is_valid.sql_max_conn.app_error", nil, "")
 	}
 
-	if !(o.FileSettings.DriverName == IMAGE_DRIVER_LOCAL || o.FileSettings.DriverName == IMAGE_DRIVER_S3) {
+	if !(o.FileSettings.DriverName == IMAGE_DRIVER_LOCAL || o.FileSettings.DriverName == IMAGE_DRIVER_S3 || o.FileSettings.DriverName == IMAGE_DRIVER_WEBDAV) {
 		return NewLocAppError("Config.IsValid", "model.config.is_valid.file_driver.app_error", nil, "")
 	}
 
+	if o.FileSettings.DriverName == IMAGE_DRIVER_WEBDAV && !IsValidHttpUrl(*o.FileSettings.WebDAVUrl) {
+		return NewLocAppError("Config.IsValid", "model.config.is_valid.webdav_url.app_error", nil, "")
+	}
+
+	if *o.FileSettings.MaxUploadSize <= 0 {
+		return NewLocAppError("Config.IsValid", "model.config.is_valid.max_upload_size.app_error", nil, "")
+	}
+
 	if o.FileSettings.PreviewHeight < 0 {
 		return NewLocAppError("Config.IsValid", "model.config.is_valid.file_preview_height.app_error", nil, "")
 	}
@@ -556,6 +831,22 @@ func (o *Config) IsValid() *AppError {
 		return NewLocAppError("Config.IsValid", "model.config.is_valid.email_reset_salt.app_error", nil, "")
 	}
 
+	if !(*o.EmailSettings.PushNotificationDriver == PUSH_NOTIFICATION_DRIVER_PROXY || *o.EmailSettings.PushNotificationDriver == PUSH_NOTIFICATION_DRIVER_NATIVE) {
+		return NewLocAppError("Config.IsValid", "model.config.is_valid.push_notification_driver.app_error", nil, "")
+	}
+
+	if *o.EmailSettings.PushNotificationDriver == PUSH_NOTIFICATION_DRIVER_NATIVE && !IsValidHttpUrl(*o.EmailSettings.ApplePushServer) {
+		return NewLocAppError("Config.IsValid", "model.config.is_valid.apple_push_server.app_error", nil, "")
+	}
+
+	if *o.EmailSettings.PushNotificationDriver == PUSH_NOTIFICATION_DRIVER_NATIVE && len(*o.EmailSettings.ApplePushCertificate) > 0 && len(*o.EmailSettings.ApplePushKey) == 0 {
+		return NewLocAppError("Config.IsValid", "model.config.is_valid.apple_push_key.app_error", nil, "")
+	}
+
+	if *o.EmailSettings.PushNotificationDriver == PUSH_NOTIFICATION_DRIVER_NATIVE && !IsValidHttpUrl(*o.EmailSettings.AndroidPushServer) {
+		return NewLocAppError("Config.IsValid", "model.config.is_valid.android_push_server.app_error", nil, "")
+	}
+
 	if o.RateLimitSettings.MemoryStoreSize <= 0 {
 		return NewLocAppError("Config.IsValid", "model.config.is_valid.rate_mem.app_error", nil, "")
 	}
@@ -568,6 +859,68 @@ func (o *Config) IsValid() *AppError {
 		return NewLocAppError("Config.IsValid", "model.config.is_valid.ldap_security.app_error", nil, "")
 	}
 
+	if *o.SamlSettings.Enable {
+		if len(*o.SamlSettings.IdpUrl) == 0 || !IsValidHttpUrl(*o.SamlSettings.IdpUrl) {
+			return NewLocAppError("Config.IsValid", "model.config.is_valid.saml_idp_url.app_error", nil, "")
+		}
+
+		if len(*o.SamlSettings.IdpDescriptorUrl) == 0 || !IsValidHttpUrl(*o.SamlSettings.IdpDescriptorUrl) {
+			return NewLocAppError("Config.IsValid", "model.config.is_valid.saml_idp_descriptor_url.app_error", nil, "")
+		}
+
+		if len(*o.SamlSettings.IdpCertificateFile) == 0 {
+			return NewLocAppError("Config.IsValid", "model.config.is_valid.saml_idp_cert.app_error", nil, "")
+		}
+
+		if len(*o.SamlSettings.EmailAttribute) == 0 {
+			return NewLocAppError("Config.IsValid", "model.config.is_valid.saml_email_attribute.app_error", nil, "")
+		}
+
+		if len(*o.SamlSettings.UsernameAttribute) == 0 {
+			return NewLocAppError("Config.IsValid", "model.config.is_valid.saml_username_attribute.app_error", nil, "")
+		}
+
+		if *o.SamlSettings.Verify {
+			if len(*o.SamlSettings.AssertionConsumerServiceURL) == 0 || !IsValidHttpUrl(*o.SamlSettings.AssertionConsumerServiceURL) {
+				return NewLocAppError("Config.IsValid", "model.config.is_valid.saml_assertion_consumer_service_url.app_error", nil, "")
+			}
+		}
+
+		if *o.SamlSettings.Encrypt {
+			if len(*o.SamlSettings.PrivateKeyFile) == 0 {
+				return NewLocAppError("Config.IsValid", "model.config.is_valid.saml_private_key.app_error", nil, "")
+			}
+
+			if len(*o.SamlSettings.PublicCertificateFile) == 0 {
+				return NewLocAppError("Config.IsValid", "model.config.is_valid.saml_public_cert.app_error", nil, "")
+			}
+		}
+	}
+
+	if *o.ClusterSettings.Enable {
+		// the port has to be bound to an internal interface rather than every interface
+		if host, _, err := net.SplitHostPort(*o.ClusterSettings.InterNodeListenAddress); err != nil || host == "" || net.ParseIP(host).IsUnspecified() {
+			return NewLocAppError("Config.IsValid", "model.config.is_valid.cluster_listen_address.app_error", nil, "")
+		}
+
+		if len(*o.ClusterSettings.InterNodeSecret) < CLUSTER_SECRET_MIN_LENGTH {
+			return NewLocAppError("Config.IsValid", "model.config.is_valid.cluster_secret.app_error", nil, "")
+		}
+	}
+
+	if !(*o.SearchSettings.Engine == SEARCH_ENGINE_DATABASE || *o.SearchSettings.Engine == SEARCH_ENGINE_INDEX) {
+		return NewLocAppError("Config.IsValid", "model.config.is_valid.search_engine.app_error", nil, "")
+	}
+
+	if *o.SearchSettings.Engine == SEARCH_ENGINE_INDEX && len(*o.SearchSettings.IndexDirectory) == 0 {
+		return NewLocAppError("Config.IsValid", "model.config.is_valid.search_index_directory.app_error", nil, "")
+	}
+
+	// the index is kept by each server so the others wouldn't see its changes
+	if *o.SearchSettings.Engine == SEARCH_ENGINE_INDEX && *o.ClusterSettings.Enable {
+		return NewLocAppError("Config.IsValid", "model.config.is_valid.search_index_cluster.app_error", nil, "")
+	}
+
 	return nil
 }
 
@@ -0,0 +1,132 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package model
+
+import (
+	"encoding/json"
+	"io"
+	"unicode/utf8"
+)
+
+const (
+	EMAIL_INTERVAL_IMMEDIATE = "immediate"
+	EMAIL_INTERVAL_FIFTEEN   = "fifteen"
+	EMAIL_INTERVAL_HOUR      = "hour"
+	EMAIL_INTERVAL_DAY       = "day"
+)
+
+// EmailNotification is a mention waiting to be sent to a user as part of their
+// next digest email.
+type EmailNotification struct {
+	Id                 string `json:"id"`
+	CreateAt           int64  `json:"create_at"`
+	SendAt             int64  `json:"send_at"`
+	UserId             string `json:"user_id"`
+	TeamId             string `json:"team_id"`
+	ChannelId          string `json:"channel_id"`
+	PostId             string `json:"post_id"`
+	TeamName           string `json:"team_name"`
+	TeamDisplayName    string `json:"team_display_name"`
+	ChannelName        string `json:"channel_name"`
+	ChannelType        string `json:"channel_type"`
+	ChannelDisplayName string `json:"channel_display_name"`
+	SenderName         string `json:"sender_name"`
+	Message            string `json:"message"`
+	SiteURL            string `json:"-"`
+	LockedUntil        int64  `json:"-"`
+}
+
+func (o *EmailNotification) ToJson() string {
+	b, err := json.Marshal(o)
+	if err != nil {
+		return ""
+	} else {
+		return string(b)
+	}
+}
+
+func EmailNotificationFromJson(data io.Reader) *EmailNotification {
+	decoder := json.NewDecoder(data)
+	var o EmailNotification
+	err := decoder.Decode(&o)
+	if err == nil {
+		return &o
+	} else {
+		return nil
+	}
+}
+
+func (o *EmailNotification) IsValid() *AppError {
+
+	if len(o.Id) != 26 {
+		return NewLocAppError("EmailNotification.IsValid", "model.email_notification.is_valid.id.app_error", nil, "")
+	}
+
+	if o.CreateAt == 0 {
+		return NewLocAppError("EmailNotification.IsValid", "model.email_notification.is_valid.create_at.app_error", nil, "id="+o.Id)
+	}
+
+	if len(o.UserId) != 26 {
+		return NewLocAppError("EmailNotification.IsValid", "model.email_notification.is_valid.user_id.app_error", nil, "id="+o.Id)
+	}
+
+	if len(o.TeamId) != 26 {
+		return NewLocAppError("EmailNotification.IsValid", "model.email_notification.is_valid.team_id.app_error", nil, "id="+o.Id)
+	}
+
+	if len(o.ChannelId) != 26 {
+		return NewLocAppError("EmailNotification.IsValid", "model.email_notification.is_valid.channel_id.app_error", nil, "id="+o.Id)
+	}
+
+	if len(o.PostId) != 26 {
+		return NewLocAppError("EmailNotification.IsValid", "model.email_notification.is_valid.post_id.app_error", nil, "id="+o.Id)
+	}
+
+	if utf8.RuneCountInString(o.Message) > 4000 {
+		return NewLocAppError("EmailNotification.IsValid", "model.email_notification.is_valid.message.app_error", nil, "id="+o.Id)
+	}
+
+	return nil
+}
+
+func (o *EmailNotification) PreSave() {
+	if o.Id == "" {
+		o.Id = NewId()
+	}
+
+	o.CreateAt = GetMillis()
+	o.LockedUntil = 0
+
+	if o.SendAt == 0 {
+		o.SendAt = o.CreateAt
+	}
+
+	// long messages are cut short since the digest links back to the channel
+	if utf8.RuneCountInString(o.Message) > 4000 {
+		o.Message = string([]rune(o.Message)[:4000])
+	}
+}
+
+// IsValidEmailInterval returns true if the value can be used for the
+// email_interval notify prop.
+func IsValidEmailInterval(interval string) bool {
+	return interval == EMAIL_INTERVAL_IMMEDIATE || interval == EMAIL_INTERVAL_FIFTEEN ||
+		interval == EMAIL_INTERVAL_HOUR || interval == EMAIL_INTERVAL_DAY
+}
+
+// GetEmailInterval returns how long, in milliseconds, mentions are collected
+// before being sent to the user in a single email. Zero means that every
+// mention is sent as soon as it happens.
+func GetEmailInterval(interval string) int64 {
+	switch interval {
+	case EMAIL_INTERVAL_FIFTEEN:
+		return 15 * 60 * 1000
+	case EMAIL_INTERVAL_HOUR:
+		return 60 * 60 * 1000
+	case EMAIL_INTERVAL_DAY:
+		return 24 * 60 * 60 * 1000
+	default:
+		return 0
+	}
+}
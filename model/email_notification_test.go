@@ -0,0 +1,65 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package model
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEmailNotificationJson(t *testing.T) {
+	o := EmailNotification{Id: NewId(), Message: NewId()}
+	json := o.ToJson()
+	ro := EmailNotificationFromJson(strings.NewReader(json))
+
+	if o.Id != ro.Id || o.Message != ro.Message {
+		t.Fatal("Ids do not match")
+	}
+}
+
+func TestEmailNotificationIsValid(t *testing.T) {
+	o := EmailNotification{}
+
+	if err := o.IsValid(); err == nil {
+		t.Fatal("should be invalid")
+	}
+
+	o.UserId = NewId()
+	o.TeamId = NewId()
+	o.ChannelId = NewId()
+	o.PostId = NewId()
+	o.Message = strings.Repeat("a", 5000)
+	o.PreSave()
+
+	if err := o.IsValid(); err != nil {
+		t.Fatal(err)
+	}
+
+	if o.SendAt != o.CreateAt {
+		t.Fatal("should be due immediately by default")
+	}
+
+	if len(o.Message) != 4000 {
+		t.Fatal("long messages should have been cut short")
+	}
+
+	o.PostId = "junk"
+	if err := o.IsValid(); err == nil {
+		t.Fatal("should be invalid")
+	}
+}
+
+func TestGetEmailInterval(t *testing.T) {
+	if GetEmailInterval(EMAIL_INTERVAL_IMMEDIATE) != 0 || GetEmailInterval("") != 0 {
+		t.Fatal("should send immediately by default")
+	}
+
+	if GetEmailInterval(EMAIL_INTERVAL_FIFTEEN) != 15*60*1000 || GetEmailInterval(EMAIL_INTERVAL_DAY) != 24*60*60*1000 {
+		t.Fatal("wrong interval")
+	}
+
+	if !IsValidEmailInterval(EMAIL_INTERVAL_HOUR) || IsValidEmailInterval("junk") {
+		t.Fatal("wrong validation")
+	}
+}
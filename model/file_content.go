@@ -0,0 +1,54 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package model
+
+import (
+	"unicode/utf8"
+)
+
+const (
+	// MySQL can't fit any more than this in a TEXT column
+	FILE_CONTENT_MAX_SIZE = 65000
+)
+
+// FileContent is the text that was read out of an uploaded file so that posts
+// can be found by what's in their attachments.
+type FileContent struct {
+	FileId   string `json:"file_id"`
+	CreateAt int64  `json:"create_at"`
+	Content  string `json:"content"`
+}
+
+func (o *FileContent) IsValid() *AppError {
+
+	if len(o.FileId) != 26 {
+		return NewLocAppError("FileContent.IsValid", "model.file_content.is_valid.file_id.app_error", nil, "")
+	}
+
+	if o.CreateAt == 0 {
+		return NewLocAppError("FileContent.IsValid", "model.file_content.is_valid.create_at.app_error", nil, "file_id="+o.FileId)
+	}
+
+	if len(o.Content) > FILE_CONTENT_MAX_SIZE {
+		return NewLocAppError("FileContent.IsValid", "model.file_content.is_valid.content.app_error", nil, "file_id="+o.FileId)
+	}
+
+	return nil
+}
+
+// PreSave cuts the content down to what can be stored, taking care not to cut
+// a character in half.
+func (o *FileContent) PreSave() {
+	if o.CreateAt == 0 {
+		o.CreateAt = GetMillis()
+	}
+
+	if len(o.Content) > FILE_CONTENT_MAX_SIZE {
+		end := FILE_CONTENT_MAX_SIZE
+		for end > 0 && !utf8.RuneStart(o.Content[end]) {
+			end--
+		}
+		o.Content = o.Content[:end]
+	}
+}
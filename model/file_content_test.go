@@ -0,0 +1,50 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package model
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestFileContentIsValid(t *testing.T) {
+	o := FileContent{}
+
+	if err := o.IsValid(); err == nil {
+		t.Fatal("should be invalid")
+	}
+
+	o.FileId = NewId()
+	if err := o.IsValid(); err == nil {
+		t.Fatal("should be invalid")
+	}
+
+	o.CreateAt = GetMillis()
+	if err := o.IsValid(); err != nil {
+		t.Fatal(err)
+	}
+
+	o.Content = strings.Repeat("a", FILE_CONTENT_MAX_SIZE+1)
+	if err := o.IsValid(); err == nil {
+		t.Fatal("should be invalid")
+	}
+}
+
+func TestFileContentPreSave(t *testing.T) {
+	o := FileContent{FileId: NewId(), Content: "a" + strings.Repeat("é", FILE_CONTENT_MAX_SIZE/2)}
+	o.PreSave()
+
+	if o.CreateAt == 0 {
+		t.Fatal("should have set the create time")
+	}
+
+	if len(o.Content) > FILE_CONTENT_MAX_SIZE || !utf8.ValidString(o.Content) {
+		t.Fatal("should have cut the content down without breaking a character")
+	}
+
+	if err := o.IsValid(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -12,17 +12,46 @@ import (
 	"path/filepath"
 )
 
+// FileInfo describes an uploaded file. Files uploaded before FileInfos were
+// saved only have the fields that can be worked out from the file itself.
 type FileInfo struct {
+	Id              string `json:"id,omitempty"`
+	CreatorId       string `json:"user_id,omitempty"`
+	ChannelId       string `json:"channel_id,omitempty"`
+	PostId          string `json:"post_id,omitempty"`
+	CreateAt        int64  `json:"create_at,omitempty"`
+	UpdateAt        int64  `json:"update_at,omitempty"`
+	DeleteAt        int64  `json:"delete_at,omitempty"`
+	Path            string `json:"-"`
+	ThumbnailPath   string `json:"-"`
+	PreviewPath     string `json:"-"`
 	Filename        string `json:"filename"`
-	Size            int    `json:"size"`
+	Size            int64  `json:"size"`
 	Extension       string `json:"extension"`
 	MimeType        string `json:"mime_type"`
+	Width           int    `json:"width,omitempty"`
+	Height          int    `json:"height,omitempty"`
 	HasPreviewImage bool   `json:"has_preview_image"`
 }
 
 func GetInfoForBytes(filename string, data []byte) (*FileInfo, *AppError) {
-	size := len(data)
+	info := GetInfoForFile(filename, int64(len(data)))
 
+	if info.MimeType == "image/gif" {
+		// just show the gif itself instead of a preview image for animated gifs
+		if gifImage, err := gif.DecodeAll(bytes.NewReader(data)); err != nil {
+			return nil, NewLocAppError("GetInfoForBytes", "model.file_info.get.gif.app_error", nil, "filename="+filename)
+		} else {
+			info.HasPreviewImage = len(gifImage.Image) == 1
+		}
+	}
+
+	return info, nil
+}
+
+// GetInfoForFile works out what it can about a file from its name alone. It's
+// used for files that are too large to read into memory.
+func GetInfoForFile(filename string, size int64) *FileInfo {
 	var mimeType string
 	extension := filepath.Ext(filename)
 	isImage := IsFileExtImage(extension)
@@ -37,23 +66,13 @@ func GetInfoForBytes(filename string, data []byte) (*FileInfo, *AppError) {
 		extension = extension[1:]
 	}
 
-	hasPreviewImage := isImage
-	if mimeType == "image/gif" {
-		// just show the gif itself instead of a preview image for animated gifs
-		if gifImage, err := gif.DecodeAll(bytes.NewReader(data)); err != nil {
-			return nil, NewLocAppError("GetInfoForBytes", "model.file_info.get.gif.app_error", nil, "filename="+filename)
-		} else {
-			hasPreviewImage = len(gifImage.Image) == 1
-		}
-	}
-
 	return &FileInfo{
 		Filename:        filename,
 		Size:            size,
 		Extension:       extension,
 		MimeType:        mimeType,
-		HasPreviewImage: hasPreviewImage,
-	}, nil
+		HasPreviewImage: isImage,
+	}
 }
 
 func (info *FileInfo) ToJson() string {
@@ -75,3 +94,72 @@ func FileInfoFromJson(data io.Reader) *FileInfo {
 		return &info
 	}
 }
+
+func FileInfosToJson(infos []*FileInfo) string {
+	b, err := json.Marshal(infos)
+	if err != nil {
+		return ""
+	} else {
+		return string(b)
+	}
+}
+
+func FileInfosFromJson(data io.Reader) []*FileInfo {
+	decoder := json.NewDecoder(data)
+
+	var infos []*FileInfo
+	if err := decoder.Decode(&infos); err != nil {
+		return nil
+	} else {
+		return infos
+	}
+}
+
+func (info *FileInfo) IsValid() *AppError {
+	if len(info.Id) != 26 {
+		return NewLocAppError("FileInfo.IsValid", "model.file_info.is_valid.id.app_error", nil, "")
+	}
+
+	if len(info.CreatorId) != 26 {
+		return NewLocAppError("FileInfo.IsValid", "model.file_info.is_valid.user_id.app_error", nil, "id="+info.Id)
+	}
+
+	if len(info.ChannelId) != 26 {
+		return NewLocAppError("FileInfo.IsValid", "model.file_info.is_valid.channel_id.app_error", nil, "id="+info.Id)
+	}
+
+	if len(info.PostId) != 0 && len(info.PostId) != 26 {
+		return NewLocAppError("FileInfo.IsValid", "model.file_info.is_valid.post_id.app_error", nil, "id="+info.Id)
+	}
+
+	if info.CreateAt == 0 {
+		return NewLocAppError("FileInfo.IsValid", "model.file_info.is_valid.create_at.app_error", nil, "id="+info.Id)
+	}
+
+	if info.UpdateAt == 0 {
+		return NewLocAppError("FileInfo.IsValid", "model.file_info.is_valid.update_at.app_error", nil, "id="+info.Id)
+	}
+
+	if len(info.Path) == 0 || len(info.Path) > 512 {
+		return NewLocAppError("FileInfo.IsValid", "model.file_info.is_valid.path.app_error", nil, "id="+info.Id)
+	}
+
+	if len(info.Filename) == 0 || len(info.Filename) > 256 {
+		return NewLocAppError("FileInfo.IsValid", "model.file_info.is_valid.filename.app_error", nil, "id="+info.Id)
+	}
+
+	return nil
+}
+
+func (info *FileInfo) PreSave() {
+	if info.Id == "" {
+		info.Id = NewId()
+	}
+
+	info.CreateAt = GetMillis()
+	info.UpdateAt = info.CreateAt
+}
+
+func (info *FileInfo) PreUpdate() {
+	info.UpdateAt = GetMillis()
+}
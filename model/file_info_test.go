@@ -6,6 +6,7 @@ package model
 import (
 	"encoding/base64"
 	"io/ioutil"
+	"strings"
 	"testing"
 )
 
@@ -88,3 +89,64 @@ func TestGetInfoForBytes(t *testing.T) {
 		t.Fatalf("Got HasPreviewImage = true for non-image file")
 	}
 }
+
+func TestGetInfoForFile(t *testing.T) {
+	info := GetInfoForFile("backup.tar.gz", 20000000000)
+	if info.Filename != "backup.tar.gz" || info.Size != 20000000000 || info.Extension != "gz" {
+		t.Fatal("got incorrect info", info.ToJson())
+	} else if info.HasPreviewImage {
+		t.Fatal("Got HasPreviewImage = true for non-image file")
+	}
+
+	if info := GetInfoForFile("photo.jpg", 1000); !info.HasPreviewImage || info.MimeType != "image/jpeg" {
+		t.Fatal("got incorrect info for an image", info.ToJson())
+	}
+}
+
+func TestFileInfoJson(t *testing.T) {
+	info := &FileInfo{Id: NewId(), CreatorId: NewId(), Filename: "file.txt", Path: "teams/a/file.txt", Size: 1000}
+	json := info.ToJson()
+	rinfo := FileInfoFromJson(strings.NewReader(json))
+
+	if info.Id != rinfo.Id || info.CreatorId != rinfo.CreatorId || info.Filename != rinfo.Filename || info.Size != rinfo.Size {
+		t.Fatal("Ids do not match")
+	}
+
+	if len(rinfo.Path) != 0 {
+		t.Fatal("path should not be serialized")
+	}
+
+	infos := FileInfosFromJson(strings.NewReader(FileInfosToJson([]*FileInfo{info})))
+	if len(infos) != 1 || infos[0].Id != info.Id {
+		t.Fatal("list does not match")
+	}
+}
+
+func TestFileInfoIsValid(t *testing.T) {
+	info := &FileInfo{}
+
+	if err := info.IsValid(); err == nil {
+		t.Fatal("should be invalid")
+	}
+
+	info.CreatorId = NewId()
+	info.ChannelId = NewId()
+	info.Filename = "file.txt"
+	info.Path = "teams/a/file.txt"
+	info.PreSave()
+
+	if err := info.IsValid(); err != nil {
+		t.Fatal(err)
+	}
+
+	info.PostId = "junk"
+	if err := info.IsValid(); err == nil {
+		t.Fatal("should be invalid, bad post id")
+	}
+
+	info.PostId = NewId()
+	info.Path = ""
+	if err := info.IsValid(); err == nil {
+		t.Fatal("should be invalid, no path")
+	}
+}
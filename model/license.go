@@ -37,6 +37,7 @@ type Features struct {
 	MFA         *bool `json:"mfa"`
 	GoogleSSO   *bool `json:"google_sso"`
 	Compliance  *bool `json:"compliance"`
+	SAML        *bool `json:"saml"`
 	CustomBrand *bool `json:"custom_brand"`
 }
 
@@ -66,6 +67,11 @@ func (f *Features) SetDefaults() {
 		*f.Compliance = true
 	}
 
+	if f.SAML == nil {
+		f.SAML = new(bool)
+		*f.SAML = true
+	}
+
 	if f.CustomBrand == nil {
 		f.CustomBrand = new(bool)
 		*f.CustomBrand = true
@@ -18,7 +18,13 @@ const (
 	ACTION_USER_ADDED         = "user_added"
 	ACTION_USER_REMOVED       = "user_removed"
 	ACTION_PREFERENCE_CHANGED = "preference_changed"
+	ACTION_PREFERENCE_DELETED = "preference_deleted"
 	ACTION_EPHEMERAL_MESSAGE  = "ephemeral_message"
+	ACTION_REACTION_ADDED     = "reaction_added"
+	ACTION_REACTION_REMOVED   = "reaction_removed"
+	ACTION_POST_PINNED        = "post_pinned"
+	ACTION_POST_UNPINNED      = "post_unpinned"
+	ACTION_STATUS_CHANGE      = "status_change"
 )
 
 type Message struct {
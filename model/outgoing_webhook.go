@@ -7,6 +7,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"time"
+)
+
+const (
+	OUTGOING_WEBHOOK_MAX_TIMEOUT = 60
 )
 
 type OutgoingWebhook struct {
@@ -22,6 +27,7 @@ type OutgoingWebhook struct {
 	CallbackURLs StringArray `json:"callback_urls"`
 	DisplayName  string      `json:"display_name"`
 	Description  string      `json:"description"`
+	Timeout      int         `json:"timeout"`
 }
 
 func (o *OutgoingWebhook) ToJson() string {
@@ -124,6 +130,10 @@ func (o *OutgoingWebhook) IsValid() *AppError {
 		return NewLocAppError("OutgoingWebhook.IsValid", "model.outgoing_hook.is_valid.description.app_error", nil, "")
 	}
 
+	if o.Timeout < 0 || o.Timeout > OUTGOING_WEBHOOK_MAX_TIMEOUT {
+		return NewLocAppError("OutgoingWebhook.IsValid", "model.outgoing_hook.is_valid.timeout.app_error", nil, "")
+	}
+
 	return nil
 }
 
@@ -157,3 +167,13 @@ func (o *OutgoingWebhook) HasTriggerWord(word string) bool {
 
 	return false
 }
+
+// GetTimeout returns how long to wait for the callback URLs to respond, using
+// defaultTimeout if the hook doesn't set its own.
+func (o *OutgoingWebhook) GetTimeout(defaultTimeout int) time.Duration {
+	if o.Timeout > 0 {
+		return time.Duration(o.Timeout) * time.Second
+	}
+
+	return time.Duration(defaultTimeout) * time.Second
+}
@@ -0,0 +1,193 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package model
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"unicode/utf8"
+)
+
+const (
+	OUTGOING_WEBHOOK_DELIVERY_PENDING = "pending"
+	OUTGOING_WEBHOOK_DELIVERY_SUCCESS = "success"
+	OUTGOING_WEBHOOK_DELIVERY_FAILED  = "failed"
+
+	OUTGOING_WEBHOOK_RETRY_BASE_DELAY = 30 * 1000
+	OUTGOING_WEBHOOK_RETRY_MAX_DELAY  = 60 * 60 * 1000
+
+	OUTGOING_WEBHOOK_RESPONSE_SNIPPET_SIZE = 1024
+
+	OUTGOING_WEBHOOK_SIGNATURE_PREFIX = "sha256="
+)
+
+// OutgoingWebhookDelivery is a single attempt to send a post to one of an
+// outgoing webhook's callback URLs, along with the result of the last try.
+type OutgoingWebhookDelivery struct {
+	Id              string `json:"id"`
+	CreateAt        int64  `json:"create_at"`
+	UpdateAt        int64  `json:"update_at"`
+	HookId          string `json:"hook_id"`
+	TeamId          string `json:"team_id"`
+	ChannelId       string `json:"channel_id"`
+	PostId          string `json:"post_id"`
+	URL             string `json:"url"`
+	Payload         string `json:"-"`
+	Status          string `json:"status"`
+	Attempts        int    `json:"attempts"`
+	NextAttemptAt   int64  `json:"next_attempt_at"`
+	LastAttemptAt   int64  `json:"last_attempt_at"`
+	StatusCode      int    `json:"status_code"`
+	Latency         int64  `json:"latency"`
+	ResponseSnippet string `json:"response_snippet"`
+	Error           string `json:"error"`
+	SiteURL         string `json:"-"`
+}
+
+func (o *OutgoingWebhookDelivery) ToJson() string {
+	b, err := json.Marshal(o)
+	if err != nil {
+		return ""
+	} else {
+		return string(b)
+	}
+}
+
+func OutgoingWebhookDeliveryFromJson(data io.Reader) *OutgoingWebhookDelivery {
+	decoder := json.NewDecoder(data)
+	var o OutgoingWebhookDelivery
+	err := decoder.Decode(&o)
+	if err == nil {
+		return &o
+	} else {
+		return nil
+	}
+}
+
+func OutgoingWebhookDeliveryListToJson(l []*OutgoingWebhookDelivery) string {
+	b, err := json.Marshal(l)
+	if err != nil {
+		return "[]"
+	} else {
+		return string(b)
+	}
+}
+
+func OutgoingWebhookDeliveryListFromJson(data io.Reader) []*OutgoingWebhookDelivery {
+	decoder := json.NewDecoder(data)
+	var o []*OutgoingWebhookDelivery
+	err := decoder.Decode(&o)
+	if err == nil {
+		return o
+	} else {
+		return nil
+	}
+}
+
+func (o *OutgoingWebhookDelivery) IsValid() *AppError {
+
+	if len(o.Id) != 26 {
+		return NewLocAppError("OutgoingWebhookDelivery.IsValid", "model.outgoing_hook_delivery.is_valid.id.app_error", nil, "")
+	}
+
+	if o.CreateAt == 0 {
+		return NewLocAppError("OutgoingWebhookDelivery.IsValid", "model.outgoing_hook_delivery.is_valid.create_at.app_error", nil, "id="+o.Id)
+	}
+
+	if o.UpdateAt == 0 {
+		return NewLocAppError("OutgoingWebhookDelivery.IsValid", "model.outgoing_hook_delivery.is_valid.update_at.app_error", nil, "id="+o.Id)
+	}
+
+	if len(o.HookId) != 26 {
+		return NewLocAppError("OutgoingWebhookDelivery.IsValid", "model.outgoing_hook_delivery.is_valid.hook_id.app_error", nil, "id="+o.Id)
+	}
+
+	if len(o.TeamId) != 26 {
+		return NewLocAppError("OutgoingWebhookDelivery.IsValid", "model.outgoing_hook_delivery.is_valid.team_id.app_error", nil, "id="+o.Id)
+	}
+
+	if len(o.ChannelId) != 26 {
+		return NewLocAppError("OutgoingWebhookDelivery.IsValid", "model.outgoing_hook_delivery.is_valid.channel_id.app_error", nil, "id="+o.Id)
+	}
+
+	if len(o.PostId) != 26 {
+		return NewLocAppError("OutgoingWebhookDelivery.IsValid", "model.outgoing_hook_delivery.is_valid.post_id.app_error", nil, "id="+o.Id)
+	}
+
+	if len(o.URL) == 0 || len(o.URL) > 1024 || !IsValidHttpUrl(o.URL) {
+		return NewLocAppError("OutgoingWebhookDelivery.IsValid", "model.outgoing_hook_delivery.is_valid.url.app_error", nil, "id="+o.Id)
+	}
+
+	if !(o.Status == OUTGOING_WEBHOOK_DELIVERY_PENDING || o.Status == OUTGOING_WEBHOOK_DELIVERY_SUCCESS || o.Status == OUTGOING_WEBHOOK_DELIVERY_FAILED) {
+		return NewLocAppError("OutgoingWebhookDelivery.IsValid", "model.outgoing_hook_delivery.is_valid.status.app_error", nil, "id="+o.Id)
+	}
+
+	return nil
+}
+
+func (o *OutgoingWebhookDelivery) PreSave() {
+	if o.Id == "" {
+		o.Id = NewId()
+	}
+
+	o.CreateAt = GetMillis()
+	o.UpdateAt = o.CreateAt
+
+	if o.Status == "" {
+		o.Status = OUTGOING_WEBHOOK_DELIVERY_PENDING
+	}
+
+	if o.NextAttemptAt == 0 {
+		o.NextAttemptAt = o.CreateAt
+	}
+}
+
+func (o *OutgoingWebhookDelivery) PreUpdate() {
+	o.UpdateAt = GetMillis()
+}
+
+// SetResponseSnippet records the start of the response body, cut short so
+// that the delivery log doesn't grow too large.
+func (o *OutgoingWebhookDelivery) SetResponseSnippet(body string) {
+	if len(body) > OUTGOING_WEBHOOK_RESPONSE_SNIPPET_SIZE {
+		body = body[:OUTGOING_WEBHOOK_RESPONSE_SNIPPET_SIZE]
+
+		// don't leave half of a multi-byte character on the end
+		for len(body) > 0 && !utf8.ValidString(body) {
+			body = body[:len(body)-1]
+		}
+	}
+
+	o.ResponseSnippet = body
+}
+
+// GetOutgoingWebhookRetryDelay returns how long to wait after the given number
+// of failed attempts before trying again, doubling each time up to an hour.
+func GetOutgoingWebhookRetryDelay(attempts int) int64 {
+	delay := int64(OUTGOING_WEBHOOK_RETRY_BASE_DELAY)
+
+	for i := 1; i < attempts && delay < OUTGOING_WEBHOOK_RETRY_MAX_DELAY; i++ {
+		delay *= 2
+	}
+
+	if delay > OUTGOING_WEBHOOK_RETRY_MAX_DELAY {
+		delay = OUTGOING_WEBHOOK_RETRY_MAX_DELAY
+	}
+
+	return delay
+}
+
+// SignOutgoingWebhookPayload computes the value of the signature header sent
+// with every outgoing webhook request. Receivers can verify that a request came
+// from this server by computing the HMAC-SHA256 of the request body using the
+// hook's token as the key.
+func SignOutgoingWebhookPayload(token string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(token))
+	mac.Write(payload)
+
+	return OUTGOING_WEBHOOK_SIGNATURE_PREFIX + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package model
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOutgoingWebhookDeliveryJson(t *testing.T) {
+	o := OutgoingWebhookDelivery{Id: NewId(), Payload: "token=abc", Status: OUTGOING_WEBHOOK_DELIVERY_SUCCESS}
+	json := o.ToJson()
+	ro := OutgoingWebhookDeliveryFromJson(strings.NewReader(json))
+
+	if o.Id != ro.Id || o.Status != ro.Status {
+		t.Fatal("Ids do not match")
+	}
+
+	if ro.Payload != "" {
+		t.Fatal("payload shouldn't be sent to clients")
+	}
+
+	if l := OutgoingWebhookDeliveryListFromJson(strings.NewReader(OutgoingWebhookDeliveryListToJson([]*OutgoingWebhookDelivery{&o}))); len(l) != 1 || l[0].Id != o.Id {
+		t.Fatal("list didn't round trip")
+	}
+}
+
+func TestOutgoingWebhookDeliveryIsValid(t *testing.T) {
+	o := OutgoingWebhookDelivery{}
+
+	if err := o.IsValid(); err == nil {
+		t.Fatal("should be invalid")
+	}
+
+	o.HookId = NewId()
+	o.TeamId = NewId()
+	o.ChannelId = NewId()
+	o.PostId = NewId()
+	o.URL = "http://nowhere.com/"
+	o.PreSave()
+
+	if err := o.IsValid(); err != nil {
+		t.Fatal(err)
+	}
+
+	if o.Status != OUTGOING_WEBHOOK_DELIVERY_PENDING || o.NextAttemptAt != o.CreateAt {
+		t.Fatal("should be due immediately")
+	}
+
+	o.URL = "nowhere.com/"
+	if err := o.IsValid(); err == nil {
+		t.Fatal("should be invalid")
+	}
+
+	o.URL = "http://nowhere.com/"
+	o.Status = "junk"
+	if err := o.IsValid(); err == nil {
+		t.Fatal("should be invalid")
+	}
+}
+
+func TestOutgoingWebhookDeliveryResponseSnippet(t *testing.T) {
+	o := OutgoingWebhookDelivery{}
+
+	o.SetResponseSnippet("short")
+	if o.ResponseSnippet != "short" {
+		t.Fatal("short responses should be kept")
+	}
+
+	o.SetResponseSnippet(strings.Repeat("a", OUTGOING_WEBHOOK_RESPONSE_SNIPPET_SIZE-1) + "ü" + "more")
+	if len(o.ResponseSnippet) != OUTGOING_WEBHOOK_RESPONSE_SNIPPET_SIZE-1 {
+		t.Fatalf("should have cut before the split character %v", len(o.ResponseSnippet))
+	}
+}
+
+func TestGetOutgoingWebhookRetryDelay(t *testing.T) {
+	if delay := GetOutgoingWebhookRetryDelay(1); delay != OUTGOING_WEBHOOK_RETRY_BASE_DELAY {
+		t.Fatal("first retry should use the base delay")
+	}
+
+	if delay := GetOutgoingWebhookRetryDelay(3); delay != 4*OUTGOING_WEBHOOK_RETRY_BASE_DELAY {
+		t.Fatal("delay should double after each attempt")
+	}
+
+	if delay := GetOutgoingWebhookRetryDelay(100); delay != OUTGOING_WEBHOOK_RETRY_MAX_DELAY {
+		t.Fatal("delay should be capped")
+	}
+}
+
+func TestSignOutgoingWebhookPayload(t *testing.T) {
+	// from the HMAC-SHA256 test vectors in RFC 4231
+	if signature := SignOutgoingWebhookPayload("Jefe", []byte("what do ya want for nothing?")); signature != "sha256=5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843" {
+		t.Fatalf("incorrect signature %v", signature)
+	}
+}
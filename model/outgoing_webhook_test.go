@@ -6,6 +6,7 @@ package model
 import (
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestOutgoingWebhookJson(t *testing.T) {
@@ -109,6 +110,33 @@ func TestOutgoingWebhookIsValid(t *testing.T) {
 	if err := o.IsValid(); err != nil {
 		t.Fatal(err)
 	}
+
+	o.Timeout = OUTGOING_WEBHOOK_MAX_TIMEOUT + 1
+	if err := o.IsValid(); err == nil {
+		t.Fatal("should be invalid")
+	}
+
+	o.Timeout = -1
+	if err := o.IsValid(); err == nil {
+		t.Fatal("should be invalid")
+	}
+
+	o.Timeout = 30
+	if err := o.IsValid(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOutgoingWebhookGetTimeout(t *testing.T) {
+	o := OutgoingWebhook{}
+	if o.GetTimeout(10) != 10*time.Second {
+		t.Fatal("should have used the default timeout")
+	}
+
+	o.Timeout = 30
+	if o.GetTimeout(10) != 30*time.Second {
+		t.Fatal("should have used the hook's timeout")
+	}
 }
 
 func TestOutgoingWebhookPreSave(t *testing.T) {
@@ -24,6 +24,7 @@ type Post struct {
 	CreateAt      int64           `json:"create_at"`
 	UpdateAt      int64           `json:"update_at"`
 	DeleteAt      int64           `json:"delete_at"`
+	EditAt        int64           `json:"edit_at"`
 	UserId        string          `json:"user_id"`
 	ChannelId     string          `json:"channel_id"`
 	RootId        string          `json:"root_id"`
@@ -34,7 +35,11 @@ type Post struct {
 	Props         StringInterface `json:"props"`
 	Hashtags      string          `json:"hashtags"`
 	Filenames     StringArray     `json:"filenames"`
+	ReplyCount    int64           `json:"reply_count"`
+	LastReplyAt   int64           `json:"last_reply_at"`
+	IsPinned      bool            `json:"is_pinned"`
 	PendingPostId string          `json:"pending_post_id" db:"-"`
+	Reactions     []*Reaction     `json:"reactions,omitempty" db:"-"`
 }
 
 func (o *Post) ToJson() string {
@@ -129,6 +134,10 @@ func (o *Post) PreSave() {
 	}
 
 	o.OriginalId = ""
+	o.EditAt = 0
+	o.ReplyCount = 0
+	o.LastReplyAt = 0
+	o.IsPinned = false
 
 	if o.CreateAt == 0 {
 		o.CreateAt = GetMillis()
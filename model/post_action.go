@@ -0,0 +1,204 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package model
+
+import (
+	"encoding/json"
+	"io"
+)
+
+const (
+	POST_ACTION_TYPE_BUTTON = "button"
+	POST_ACTION_TYPE_SELECT = "select"
+)
+
+// PostAction is a button or menu shown on a message attachment. When a user
+// clicks it, the server calls the integration's URL with the action's context.
+type PostAction struct {
+	Id          string                 `json:"id"`
+	Name        string                 `json:"name"`
+	Type        string                 `json:"type"`
+	Options     []*PostActionOptions   `json:"options,omitempty"`
+	Integration *PostActionIntegration `json:"integration,omitempty"`
+}
+
+type PostActionOptions struct {
+	Text  string `json:"text"`
+	Value string `json:"value"`
+}
+
+type PostActionIntegration struct {
+	URL     string          `json:"url"`
+	Context StringInterface `json:"context,omitempty"`
+}
+
+// PostActionIntegrationRequest is sent to an integration when one of its
+// actions is clicked.
+type PostActionIntegrationRequest struct {
+	UserId         string          `json:"user_id"`
+	UserName       string          `json:"user_name"`
+	TeamId         string          `json:"team_id"`
+	ChannelId      string          `json:"channel_id"`
+	PostId         string          `json:"post_id"`
+	ActionId       string          `json:"action_id"`
+	Type           string          `json:"type"`
+	SelectedOption string          `json:"selected_option,omitempty"`
+	Context        StringInterface `json:"context,omitempty"`
+}
+
+// PostActionIntegrationResponse is what an integration may send back after an
+// action is clicked, either replacing the original post or showing a message
+// to just the user who clicked.
+type PostActionIntegrationResponse struct {
+	Update        *Post  `json:"update"`
+	EphemeralText string `json:"ephemeral_text"`
+}
+
+type postActionAttachment struct {
+	Actions []*PostAction `json:"actions"`
+}
+
+func (o *PostActionIntegrationRequest) ToJson() string {
+	b, err := json.Marshal(o)
+	if err != nil {
+		return ""
+	} else {
+		return string(b)
+	}
+}
+
+func PostActionIntegrationRequestFromJson(data io.Reader) *PostActionIntegrationRequest {
+	decoder := json.NewDecoder(data)
+	var o PostActionIntegrationRequest
+	err := decoder.Decode(&o)
+	if err == nil {
+		return &o
+	} else {
+		return nil
+	}
+}
+
+func (o *PostActionIntegrationResponse) ToJson() string {
+	b, err := json.Marshal(o)
+	if err != nil {
+		return ""
+	} else {
+		return string(b)
+	}
+}
+
+func PostActionIntegrationResponseFromJson(data io.Reader) *PostActionIntegrationResponse {
+	decoder := json.NewDecoder(data)
+	var o PostActionIntegrationResponse
+	err := decoder.Decode(&o)
+	if err == nil {
+		return &o
+	} else {
+		return nil
+	}
+}
+
+// GetActions returns every action on the post's attachments.
+func (o *Post) GetActions() []*PostAction {
+	actions := []*PostAction{}
+
+	attachments, ok := o.Props["attachments"]
+	if !ok {
+		return actions
+	}
+
+	// the attachments are stored without a type so convert them through json
+	b, err := json.Marshal(attachments)
+	if err != nil {
+		return actions
+	}
+
+	var parsed []*postActionAttachment
+	if err := json.Unmarshal(b, &parsed); err != nil {
+		return actions
+	}
+
+	for _, attachment := range parsed {
+		if attachment != nil {
+			for _, action := range attachment.Actions {
+				if action != nil {
+					actions = append(actions, action)
+				}
+			}
+		}
+	}
+
+	return actions
+}
+
+func (o *Post) GetAction(id string) *PostAction {
+	for _, action := range o.GetActions() {
+		if action.Id == id {
+			return action
+		}
+	}
+
+	return nil
+}
+
+// GenerateActionIds gives every action on the post's attachments an id so
+// that clicks can be routed back to it.
+func (o *Post) GenerateActionIds() {
+	attachments, ok := o.Props["attachments"].([]interface{})
+	if !ok {
+		return
+	}
+
+	for _, attachment := range attachments {
+		if attachmentMap, ok := attachment.(map[string]interface{}); ok {
+			if actions, ok := attachmentMap["actions"].([]interface{}); ok {
+				for _, action := range actions {
+					if actionMap, ok := action.(map[string]interface{}); ok {
+						if id, _ := actionMap["id"].(string); len(id) != 26 || !IsValidAlphaNum(id, false) {
+							actionMap["id"] = NewId()
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// StripActionIntegrations removes the integration from every action on the
+// post's attachments. Only integrations can choose where clicks are sent, so
+// this is done to posts that users make.
+func (o *Post) StripActionIntegrations() {
+	attachments, ok := o.Props["attachments"].([]interface{})
+	if !ok {
+		return
+	}
+
+	for _, attachment := range attachments {
+		if attachmentMap, ok := attachment.(map[string]interface{}); ok {
+			if actions, ok := attachmentMap["actions"].([]interface{}); ok {
+				for _, action := range actions {
+					if actionMap, ok := action.(map[string]interface{}); ok {
+						delete(actionMap, "integration")
+					}
+				}
+			}
+		}
+	}
+}
+
+// IsValidSelection checks that the option picked when the action was clicked is
+// one of the action's own options. Only menus have options to pick from.
+func (o *PostAction) IsValidSelection(selectedOption string) bool {
+	if o.Type != POST_ACTION_TYPE_SELECT {
+		return selectedOption == ""
+	}
+
+	for _, option := range o.Options {
+		if option != nil && option.Value == selectedOption {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package model
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPostActionIntegrationJson(t *testing.T) {
+	o := PostActionIntegrationRequest{UserId: NewId(), Context: StringInterface{"key": "value"}}
+	ro := PostActionIntegrationRequestFromJson(strings.NewReader(o.ToJson()))
+
+	if o.UserId != ro.UserId || ro.Context["key"] != "value" {
+		t.Fatal("request didn't round trip")
+	}
+
+	r := PostActionIntegrationResponseFromJson(strings.NewReader(`{"update": {"message": "updated"}, "ephemeral_text": "clicked"}`))
+	if r.Update == nil || r.Update.Message != "updated" || r.EphemeralText != "clicked" {
+		t.Fatal("response didn't parse")
+	}
+}
+
+func TestPostGetActions(t *testing.T) {
+	post := PostFromJson(strings.NewReader(`{
+		"message": "hello",
+		"props": {
+			"attachments": [
+				{"text": "no actions"},
+				{"text": "actions", "actions": [
+					{"name": "Approve", "integration": {"url": "http://localhost/approve", "context": {"id": "123"}}},
+					{"id": "` + NewId() + `", "name": "Pick", "type": "select", "options": [{"text": "One", "value": "1"}]}
+				]}
+			]
+		}
+	}`))
+
+	post.GenerateActionIds()
+
+	actions := post.GetActions()
+	if len(actions) != 2 {
+		t.Fatalf("wrong number of actions %v", len(actions))
+	}
+
+	if len(actions[0].Id) != 26 || actions[0].Name != "Approve" || actions[0].Integration.URL != "http://localhost/approve" || actions[0].Integration.Context["id"] != "123" {
+		t.Fatal("first action wasn't parsed correctly")
+	}
+
+	if actions[1].Type != POST_ACTION_TYPE_SELECT || len(actions[1].Options) != 1 || actions[1].Options[0].Value != "1" {
+		t.Fatal("second action wasn't parsed correctly")
+	}
+
+	id := actions[1].Id
+	post.GenerateActionIds()
+	if post.GetAction(id) == nil {
+		t.Fatal("valid ids shouldn't be replaced")
+	}
+
+	if post.GetAction(NewId()) != nil {
+		t.Fatal("shouldn't find a missing action")
+	}
+
+	if actions := (&Post{}).GetActions(); len(actions) != 0 {
+		t.Fatal("post without attachments shouldn't have actions")
+	}
+}
+
+func TestPostStripActionIntegrations(t *testing.T) {
+	post := PostFromJson(strings.NewReader(`{
+		"message": "hello",
+		"props": {
+			"attachments": [
+				{"text": "actions", "actions": [
+					{"name": "Approve", "integration": {"url": "http://localhost/approve"}}
+				]}
+			]
+		}
+	}`))
+
+	post.StripActionIntegrations()
+
+	if actions := post.GetActions(); len(actions) != 1 || actions[0].Integration != nil {
+		t.Fatal("should have kept the action without its integration")
+	}
+}
+
+func TestPostActionIsValidSelection(t *testing.T) {
+	button := &PostAction{Type: POST_ACTION_TYPE_BUTTON}
+	if !button.IsValidSelection("") || button.IsValidSelection("1") {
+		t.Fatal("buttons don't have options")
+	}
+
+	menu := &PostAction{Type: POST_ACTION_TYPE_SELECT, Options: []*PostActionOptions{{Text: "One", Value: "1"}}}
+	if !menu.IsValidSelection("1") || menu.IsValidSelection("2") || menu.IsValidSelection("") {
+		t.Fatal("should have only accepted the menu's options")
+	}
+}
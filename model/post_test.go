@@ -96,6 +96,13 @@ func TestPostPreSave(t *testing.T) {
 		t.Fatal("should not be updated")
 	}
 
+	o = Post{Message: "test", IsPinned: true}
+	o.PreSave()
+
+	if o.IsPinned {
+		t.Fatal("new posts should start unpinned")
+	}
+
 	o.Etag()
 }
 
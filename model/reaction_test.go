@@ -0,0 +1,76 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package model
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReactionJson(t *testing.T) {
+	o := Reaction{UserId: NewId(), PostId: NewId(), EmojiName: "thumbsup", CreateAt: GetMillis()}
+	json := o.ToJson()
+	ro := ReactionFromJson(strings.NewReader(json))
+
+	if o != *ro {
+		t.Fatal("Ids do not match")
+	}
+
+	list := ReactionsFromJson(strings.NewReader(ReactionsToJson([]*Reaction{&o})))
+	if len(list) != 1 || *list[0] != o {
+		t.Fatal("list did not round trip")
+	}
+}
+
+func TestReactionIsValid(t *testing.T) {
+	o := Reaction{}
+
+	if err := o.IsValid(); err == nil {
+		t.Fatal("should be invalid")
+	}
+
+	o.UserId = NewId()
+	if err := o.IsValid(); err == nil {
+		t.Fatal("should be invalid")
+	}
+
+	o.PostId = NewId()
+	if err := o.IsValid(); err == nil {
+		t.Fatal("should be invalid")
+	}
+
+	o.EmojiName = "smile face"
+	if err := o.IsValid(); err == nil {
+		t.Fatal("should be invalid")
+	}
+
+	o.EmojiName = strings.Repeat("a", 65)
+	if err := o.IsValid(); err == nil {
+		t.Fatal("should be invalid")
+	}
+
+	o.EmojiName = "+1"
+	if err := o.IsValid(); err == nil {
+		t.Fatal("should be invalid")
+	}
+
+	o.PreSave()
+	if err := o.IsValid(); err != nil {
+		t.Fatal(err)
+	}
+
+	o.EmojiName = "thumbs_up-2"
+	if err := o.IsValid(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReactionPreSave(t *testing.T) {
+	o := Reaction{UserId: NewId(), PostId: NewId(), EmojiName: "smile", CreateAt: 1000}
+	o.PreSave()
+
+	if o.CreateAt == 1000 {
+		t.Fatal("should have set the time the reaction was made")
+	}
+}
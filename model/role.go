@@ -0,0 +1,244 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package model
+
+import (
+	"encoding/json"
+	"io"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	ROLE_SYSTEM_USER = "system_user"
+	ROLE_TEAM_USER   = "team_user"
+
+	PERMISSION_CREATE_PUBLIC_CHANNEL        = "create_public_channel"
+	PERMISSION_CREATE_PRIVATE_CHANNEL       = "create_private_channel"
+	PERMISSION_MANAGE_CHANNELS              = "manage_channels"
+	PERMISSION_DELETE_OTHERS_POSTS          = "delete_others_posts"
+	PERMISSION_INVITE_USER                  = "invite_user"
+	PERMISSION_ADD_USER_TO_TEAM             = "add_user_to_team"
+	PERMISSION_MANAGE_TEAM                  = "manage_team"
+	PERMISSION_MANAGE_ROLES                 = "manage_roles"
+	PERMISSION_MANAGE_USERS                 = "manage_users"
+	PERMISSION_MANAGE_WEBHOOKS              = "manage_webhooks"
+	PERMISSION_MANAGE_OTHERS_WEBHOOKS       = "manage_others_webhooks"
+	PERMISSION_MANAGE_SLASH_COMMANDS        = "manage_slash_commands"
+	PERMISSION_MANAGE_OTHERS_SLASH_COMMANDS = "manage_others_slash_commands"
+	PERMISSION_MANAGE_BOTS                  = "manage_bots"
+	PERMISSION_MANAGE_SYSTEM                = "manage_system"
+)
+
+// TeamPermissions are the permissions that can be granted within a team.
+var TeamPermissions = []string{
+	PERMISSION_CREATE_PUBLIC_CHANNEL,
+	PERMISSION_CREATE_PRIVATE_CHANNEL,
+	PERMISSION_MANAGE_CHANNELS,
+	PERMISSION_DELETE_OTHERS_POSTS,
+	PERMISSION_INVITE_USER,
+	PERMISSION_ADD_USER_TO_TEAM,
+	PERMISSION_MANAGE_TEAM,
+	PERMISSION_MANAGE_ROLES,
+	PERMISSION_MANAGE_USERS,
+	PERMISSION_MANAGE_WEBHOOKS,
+	PERMISSION_MANAGE_OTHERS_WEBHOOKS,
+	PERMISSION_MANAGE_SLASH_COMMANDS,
+	PERMISSION_MANAGE_OTHERS_SLASH_COMMANDS,
+	PERMISSION_MANAGE_BOTS,
+}
+
+// IntegrationPermissions are only granted by the admin roles while
+// EnableOnlyAdminIntegrations is turned on.
+var IntegrationPermissions = []string{
+	PERMISSION_MANAGE_WEBHOOKS,
+	PERMISSION_MANAGE_OTHERS_WEBHOOKS,
+	PERMISSION_MANAGE_SLASH_COMMANDS,
+	PERMISSION_MANAGE_OTHERS_SLASH_COMMANDS,
+}
+
+var validRoleName = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// Role is a named set of permissions. The built in roles have no team and are
+// shared by every team while custom roles belong to the team they were made in
+// and are given out on team members.
+type Role struct {
+	Id          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	Description string `json:"description"`
+	TeamId      string `json:"team_id"`
+	Permissions string `json:"permissions"`
+	CreateAt    int64  `json:"create_at"`
+	UpdateAt    int64  `json:"update_at"`
+}
+
+func (o *Role) ToJson() string {
+	b, err := json.Marshal(o)
+	if err != nil {
+		return ""
+	} else {
+		return string(b)
+	}
+}
+
+func RoleFromJson(data io.Reader) *Role {
+	decoder := json.NewDecoder(data)
+	var o Role
+	err := decoder.Decode(&o)
+	if err == nil {
+		return &o
+	} else {
+		return nil
+	}
+}
+
+func RolesToJson(o []*Role) string {
+	if b, err := json.Marshal(o); err != nil {
+		return "[]"
+	} else {
+		return string(b)
+	}
+}
+
+func RolesFromJson(data io.Reader) []*Role {
+	decoder := json.NewDecoder(data)
+	var o []*Role
+	err := decoder.Decode(&o)
+	if err == nil {
+		return o
+	} else {
+		return nil
+	}
+}
+
+func (o *Role) IsValid() *AppError {
+
+	if len(o.Id) != 26 {
+		return NewLocAppError("Role.IsValid", "model.role.is_valid.id.app_error", nil, "")
+	}
+
+	if !IsValidRoleName(o.Name) {
+		return NewLocAppError("Role.IsValid", "model.role.is_valid.name.app_error", nil, "id="+o.Id)
+	}
+
+	if len(o.TeamId) != 0 && len(o.TeamId) != 26 {
+		return NewLocAppError("Role.IsValid", "model.role.is_valid.team_id.app_error", nil, "id="+o.Id)
+	}
+
+	if len(o.TeamId) != 0 && IsBuiltInRole(o.Name) {
+		return NewLocAppError("Role.IsValid", "model.role.is_valid.built_in.app_error", nil, "id="+o.Id)
+	}
+
+	if utf8.RuneCountInString(o.DisplayName) > 64 {
+		return NewLocAppError("Role.IsValid", "model.role.is_valid.display_name.app_error", nil, "id="+o.Id)
+	}
+
+	if utf8.RuneCountInString(o.Description) > 1024 {
+		return NewLocAppError("Role.IsValid", "model.role.is_valid.description.app_error", nil, "id="+o.Id)
+	}
+
+	for _, permission := range strings.Fields(o.Permissions) {
+		// only the built in system roles can grant access to the whole system
+		if !isInList(TeamPermissions, permission) && !(len(o.TeamId) == 0 && permission == PERMISSION_MANAGE_SYSTEM) {
+			return NewLocAppError("Role.IsValid", "model.role.is_valid.permissions.app_error", map[string]interface{}{"Permission": permission}, "id="+o.Id)
+		}
+	}
+
+	if o.CreateAt == 0 {
+		return NewLocAppError("Role.IsValid", "model.role.is_valid.create_at.app_error", nil, "id="+o.Id)
+	}
+
+	if o.UpdateAt == 0 {
+		return NewLocAppError("Role.IsValid", "model.role.is_valid.update_at.app_error", nil, "id="+o.Id)
+	}
+
+	return nil
+}
+
+func (o *Role) PreSave() {
+	if o.Id == "" {
+		o.Id = NewId()
+	}
+
+	o.Permissions = strings.Join(strings.Fields(o.Permissions), " ")
+
+	o.CreateAt = GetMillis()
+	o.UpdateAt = o.CreateAt
+}
+
+func (o *Role) PreUpdate() {
+	o.Permissions = strings.Join(strings.Fields(o.Permissions), " ")
+
+	o.UpdateAt = GetMillis()
+}
+
+func (o *Role) HasPermission(permission string) bool {
+	return IsInRole(o.Permissions, permission)
+}
+
+// IsIntegrationPermission returns true if the permission is one that only the
+// admin roles grant while EnableOnlyAdminIntegrations is turned on.
+func IsIntegrationPermission(permission string) bool {
+	return isInList(IntegrationPermissions, permission)
+}
+
+func IsValidRoleName(name string) bool {
+	return len(name) > 0 && len(name) <= 64 && validRoleName.MatchString(name)
+}
+
+func IsBuiltInRole(name string) bool {
+	return name == ROLE_SYSTEM_USER || name == ROLE_SYSTEM_ADMIN || name == ROLE_GUEST || name == ROLE_TEAM_USER || name == ROLE_TEAM_ADMIN
+}
+
+// GetSystemRoleNames returns the names of the system wide roles that a user
+// with userRoles has. Everyone but guests has the system user role.
+func GetSystemRoleNames(userRoles string) []string {
+	if IsInRole(userRoles, ROLE_GUEST) {
+		return []string{ROLE_GUEST}
+	}
+
+	return append([]string{ROLE_SYSTEM_USER}, strings.Fields(userRoles)...)
+}
+
+// GetTeamRoleNames returns the names of the roles that a member has in their
+// team. Every member but guests has the team user role.
+func GetTeamRoleNames(member *TeamMember, isGuest bool) []string {
+	if isGuest {
+		return strings.Fields(member.Roles)
+	}
+
+	return append([]string{ROLE_TEAM_USER}, strings.Fields(member.Roles)...)
+}
+
+// MakeDefaultRoles returns the built in roles along with the permissions that
+// they start out with.
+func MakeDefaultRoles() []*Role {
+	teamUserPermissions := []string{
+		PERMISSION_CREATE_PUBLIC_CHANNEL,
+		PERMISSION_CREATE_PRIVATE_CHANNEL,
+		PERMISSION_INVITE_USER,
+		PERMISSION_MANAGE_WEBHOOKS,
+		PERMISSION_MANAGE_SLASH_COMMANDS,
+	}
+
+	return []*Role{
+		{Name: ROLE_SYSTEM_USER, DisplayName: "System User"},
+		{Name: ROLE_GUEST, DisplayName: "Guest"},
+		{Name: ROLE_SYSTEM_ADMIN, DisplayName: "System Admin", Permissions: strings.Join(append(TeamPermissions, PERMISSION_MANAGE_SYSTEM), " ")},
+		{Name: ROLE_TEAM_USER, DisplayName: "Team User", Permissions: strings.Join(teamUserPermissions, " ")},
+		{Name: ROLE_TEAM_ADMIN, DisplayName: "Team Admin", Permissions: strings.Join(TeamPermissions, " ")},
+	}
+}
+
+func isInList(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package model
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRoleJson(t *testing.T) {
+	o := Role{Id: NewId(), Name: "moderator", Permissions: PERMISSION_DELETE_OTHERS_POSTS}
+	json := o.ToJson()
+	ro := RoleFromJson(strings.NewReader(json))
+
+	if o.Id != ro.Id || o.Permissions != ro.Permissions {
+		t.Fatal("role didn't round trip")
+	}
+
+	if l := RolesFromJson(strings.NewReader(RolesToJson([]*Role{&o}))); len(l) != 1 || l[0].Id != o.Id {
+		t.Fatal("list didn't round trip")
+	}
+}
+
+func TestRoleIsValid(t *testing.T) {
+	o := Role{Name: "moderator", TeamId: NewId(), Permissions: PERMISSION_DELETE_OTHERS_POSTS + "  " + PERMISSION_MANAGE_CHANNELS}
+	o.PreSave()
+
+	if err := o.IsValid(); err != nil {
+		t.Fatal(err)
+	}
+
+	if o.Permissions != PERMISSION_DELETE_OTHERS_POSTS+" "+PERMISSION_MANAGE_CHANNELS {
+		t.Fatal("permissions should have been tidied up")
+	}
+
+	o.Name = "Moderator"
+	if err := o.IsValid(); err == nil {
+		t.Fatal("should be invalid")
+	}
+
+	o.Name = ROLE_TEAM_ADMIN
+	if err := o.IsValid(); err == nil {
+		t.Fatal("custom roles can't reuse built in names")
+	}
+
+	o.Name = "moderator"
+	o.Permissions = "junk"
+	if err := o.IsValid(); err == nil {
+		t.Fatal("should be invalid")
+	}
+
+	o.Permissions = PERMISSION_MANAGE_SYSTEM
+	if err := o.IsValid(); err == nil {
+		t.Fatal("team roles can't manage the system")
+	}
+
+	o.TeamId = ""
+	o.Name = ROLE_SYSTEM_ADMIN
+	if err := o.IsValid(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDefaultRoles(t *testing.T) {
+	for _, role := range MakeDefaultRoles() {
+		role.PreSave()
+		if err := role.IsValid(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGetRoleNames(t *testing.T) {
+	if names := GetSystemRoleNames(ROLE_SYSTEM_ADMIN); len(names) != 2 || names[0] != ROLE_SYSTEM_USER || names[1] != ROLE_SYSTEM_ADMIN {
+		t.Fatal("should have been a system user and admin")
+	}
+
+	if names := GetSystemRoleNames(ROLE_GUEST); len(names) != 1 || names[0] != ROLE_GUEST {
+		t.Fatal("guests should only have the guest role")
+	}
+
+	member := &TeamMember{Roles: "moderator"}
+	if names := GetTeamRoleNames(member, false); len(names) != 2 || names[0] != ROLE_TEAM_USER || names[1] != "moderator" {
+		t.Fatal("should have been a team user and moderator")
+	}
+
+	if names := GetTeamRoleNames(member, true); len(names) != 1 || names[0] != "moderator" {
+		t.Fatal("guests shouldn't be team users")
+	}
+}
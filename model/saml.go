@@ -0,0 +1,17 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package model
+
+const (
+	USER_AUTH_SERVICE_SAML      = "saml"
+	USER_AUTH_SERVICE_SAML_TEXT = "With SAML"
+)
+
+// SamlAuthRequest is the authentication request that's sent to the IdP along
+// with the URL that the user is redirected to in order to sign in.
+type SamlAuthRequest struct {
+	Base64AuthRequest string
+	URL               string
+	RelayState        string
+}
@@ -0,0 +1,242 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package model
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	SCHEDULED_POST_RECURRENCE_NONE     = ""
+	SCHEDULED_POST_RECURRENCE_DAILY    = "daily"
+	SCHEDULED_POST_RECURRENCE_WEEKDAYS = "weekdays"
+	SCHEDULED_POST_RECURRENCE_WEEKLY   = "weekly"
+
+	SCHEDULED_POST_LAST_ERROR_MAX_SIZE = 1024
+
+	SCHEDULED_POST_MAX_ATTEMPTS     = 5
+	SCHEDULED_POST_RETRY_BASE_DELAY = 5 * 60 * 1000
+	SCHEDULED_POST_RETRY_MAX_DELAY  = 6 * 60 * 60 * 1000
+)
+
+type ScheduledPost struct {
+	Id              string      `json:"id"`
+	CreateAt        int64       `json:"create_at"`
+	UpdateAt        int64       `json:"update_at"`
+	UserId          string      `json:"user_id"`
+	TeamId          string      `json:"team_id"`
+	ChannelId       string      `json:"channel_id"`
+	RootId          string      `json:"root_id"`
+	Message         string      `json:"message"`
+	Filenames       StringArray `json:"filenames"`
+	ScheduledAt     int64       `json:"scheduled_at"`
+	Recurrence      string      `json:"recurrence"`
+	Timezone        string      `json:"timezone"`
+	LastDeliveredAt int64       `json:"last_delivered_at"`
+	LastError       string      `json:"last_error"`
+	Attempts        int         `json:"attempts"`
+	SiteURL         string      `json:"-"`
+	LockedUntil     int64       `json:"-"`
+}
+
+func (o *ScheduledPost) ToJson() string {
+	b, err := json.Marshal(o)
+	if err != nil {
+		return ""
+	} else {
+		return string(b)
+	}
+}
+
+func ScheduledPostFromJson(data io.Reader) *ScheduledPost {
+	decoder := json.NewDecoder(data)
+	var o ScheduledPost
+	err := decoder.Decode(&o)
+	if err == nil {
+		return &o
+	} else {
+		return nil
+	}
+}
+
+func ScheduledPostsToJson(o []*ScheduledPost) string {
+	if b, err := json.Marshal(o); err != nil {
+		return "[]"
+	} else {
+		return string(b)
+	}
+}
+
+func ScheduledPostsFromJson(data io.Reader) []*ScheduledPost {
+	decoder := json.NewDecoder(data)
+	var o []*ScheduledPost
+	err := decoder.Decode(&o)
+	if err == nil {
+		return o
+	} else {
+		return nil
+	}
+}
+
+func (o *ScheduledPost) IsValid() *AppError {
+
+	if len(o.Id) != 26 {
+		return NewLocAppError("ScheduledPost.IsValid", "model.scheduled_post.is_valid.id.app_error", nil, "")
+	}
+
+	if o.CreateAt == 0 {
+		return NewLocAppError("ScheduledPost.IsValid", "model.scheduled_post.is_valid.create_at.app_error", nil, "id="+o.Id)
+	}
+
+	if o.UpdateAt == 0 {
+		return NewLocAppError("ScheduledPost.IsValid", "model.scheduled_post.is_valid.update_at.app_error", nil, "id="+o.Id)
+	}
+
+	if len(o.UserId) != 26 {
+		return NewLocAppError("ScheduledPost.IsValid", "model.scheduled_post.is_valid.user_id.app_error", nil, "id="+o.Id)
+	}
+
+	if len(o.TeamId) != 26 {
+		return NewLocAppError("ScheduledPost.IsValid", "model.scheduled_post.is_valid.team_id.app_error", nil, "id="+o.Id)
+	}
+
+	if len(o.ChannelId) != 26 {
+		return NewLocAppError("ScheduledPost.IsValid", "model.scheduled_post.is_valid.channel_id.app_error", nil, "id="+o.Id)
+	}
+
+	if !(len(o.RootId) == 26 || len(o.RootId) == 0) {
+		return NewLocAppError("ScheduledPost.IsValid", "model.scheduled_post.is_valid.root_id.app_error", nil, "id="+o.Id)
+	}
+
+	if (len(o.Message) == 0 && len(o.Filenames) == 0) || utf8.RuneCountInString(o.Message) > 4000 {
+		return NewLocAppError("ScheduledPost.IsValid", "model.scheduled_post.is_valid.msg.app_error", nil, "id="+o.Id)
+	}
+
+	if o.ScheduledAt == 0 {
+		return NewLocAppError("ScheduledPost.IsValid", "model.scheduled_post.is_valid.scheduled_at.app_error", nil, "id="+o.Id)
+	}
+
+	if !IsValidRecurrence(o.Recurrence) {
+		return NewLocAppError("ScheduledPost.IsValid", "model.scheduled_post.is_valid.recurrence.app_error", nil, "id="+o.Id)
+	}
+
+	if len(o.Timezone) > 64 {
+		return NewLocAppError("ScheduledPost.IsValid", "model.scheduled_post.is_valid.timezone.app_error", nil, "id="+o.Id)
+	} else if _, err := time.LoadLocation(o.Timezone); err != nil {
+		return NewLocAppError("ScheduledPost.IsValid", "model.scheduled_post.is_valid.timezone.app_error", nil, "id="+o.Id+", "+err.Error())
+	}
+
+	return nil
+}
+
+func (o *ScheduledPost) PreSave() {
+	if o.Id == "" {
+		o.Id = NewId()
+	}
+
+	o.CreateAt = GetMillis()
+	o.UpdateAt = o.CreateAt
+	o.LastDeliveredAt = 0
+	o.LastError = ""
+	o.Attempts = 0
+	o.LockedUntil = 0
+
+	if o.Filenames == nil {
+		o.Filenames = []string{}
+	}
+}
+
+// PreUpdate gives an edited post a fresh start, so that one that stopped being
+// retried is delivered again at its new time.
+func (o *ScheduledPost) PreUpdate() {
+	o.UpdateAt = GetMillis()
+	o.LastError = ""
+	o.Attempts = 0
+	o.LockedUntil = 0
+
+	if o.Filenames == nil {
+		o.Filenames = []string{}
+	}
+}
+
+func IsValidRecurrence(recurrence string) bool {
+	switch recurrence {
+	case SCHEDULED_POST_RECURRENCE_NONE, SCHEDULED_POST_RECURRENCE_DAILY, SCHEDULED_POST_RECURRENCE_WEEKDAYS, SCHEDULED_POST_RECURRENCE_WEEKLY:
+		return true
+	}
+
+	return false
+}
+
+// IsRetryable returns false once delivering the post has failed too many times
+// in a row for it to be attempted again.
+func (o *ScheduledPost) IsRetryable() bool {
+	return o.Attempts < SCHEDULED_POST_MAX_ATTEMPTS
+}
+
+// GetScheduledPostRetryDelay returns how long to wait after the given number
+// of failed deliveries before trying again, doubling each time up to six hours.
+func GetScheduledPostRetryDelay(attempts int) int64 {
+	delay := int64(SCHEDULED_POST_RETRY_BASE_DELAY)
+
+	for i := 1; i < attempts && delay < SCHEDULED_POST_RETRY_MAX_DELAY; i++ {
+		delay *= 2
+	}
+
+	if delay > SCHEDULED_POST_RETRY_MAX_DELAY {
+		delay = SCHEDULED_POST_RETRY_MAX_DELAY
+	}
+
+	return delay
+}
+
+// NextScheduledAt returns the first time after the given time at which a
+// recurring post should be delivered again, or 0 if the post doesn't recur.
+// Days are counted in the author's timezone so that the post keeps going out at
+// the same time of day for them across daylight saving changes.
+func (o *ScheduledPost) NextScheduledAt(after int64) int64 {
+	if o.Recurrence == SCHEDULED_POST_RECURRENCE_NONE || !IsValidRecurrence(o.Recurrence) {
+		return 0
+	}
+
+	location, err := time.LoadLocation(o.Timezone)
+	if err != nil {
+		location = time.UTC
+	}
+
+	next := time.Unix(0, o.ScheduledAt*int64(time.Millisecond)).In(location)
+
+	for next.UnixNano()/int64(time.Millisecond) <= after {
+		switch o.Recurrence {
+		case SCHEDULED_POST_RECURRENCE_DAILY:
+			next = next.AddDate(0, 0, 1)
+		case SCHEDULED_POST_RECURRENCE_WEEKLY:
+			next = next.AddDate(0, 0, 7)
+		case SCHEDULED_POST_RECURRENCE_WEEKDAYS:
+			next = next.AddDate(0, 0, 1)
+			for next.Weekday() == time.Saturday || next.Weekday() == time.Sunday {
+				next = next.AddDate(0, 0, 1)
+			}
+		}
+	}
+
+	return next.UnixNano() / int64(time.Millisecond)
+}
+
+// ToPost builds the post that is created when the scheduled post is delivered.
+func (o *ScheduledPost) ToPost() *Post {
+	post := &Post{
+		ChannelId: o.ChannelId,
+		RootId:    o.RootId,
+		Message:   o.Message,
+		Filenames: make(StringArray, len(o.Filenames)),
+	}
+
+	copy(post.Filenames, o.Filenames)
+
+	return post
+}
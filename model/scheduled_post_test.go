@@ -0,0 +1,171 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package model
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScheduledPostJson(t *testing.T) {
+	o := ScheduledPost{Id: NewId(), Message: NewId(), Recurrence: SCHEDULED_POST_RECURRENCE_DAILY, SiteURL: "http://localhost"}
+	json := o.ToJson()
+	ro := ScheduledPostFromJson(strings.NewReader(json))
+
+	if o.Id != ro.Id || o.Message != ro.Message || o.Recurrence != ro.Recurrence {
+		t.Fatal("Ids do not match")
+	}
+
+	if len(ro.SiteURL) != 0 {
+		t.Fatal("site url should not be serialized")
+	}
+
+	list := ScheduledPostsFromJson(strings.NewReader(ScheduledPostsToJson([]*ScheduledPost{&o})))
+	if len(list) != 1 || list[0].Id != o.Id {
+		t.Fatal("list did not round trip")
+	}
+}
+
+func TestScheduledPostIsValid(t *testing.T) {
+	o := ScheduledPost{}
+
+	if err := o.IsValid(); err == nil {
+		t.Fatal("should be invalid")
+	}
+
+	o.UserId = NewId()
+	o.TeamId = NewId()
+	o.ChannelId = NewId()
+	o.Message = "stand-up in five minutes"
+	o.ScheduledAt = GetMillis()
+	o.PreSave()
+
+	if err := o.IsValid(); err != nil {
+		t.Fatal(err)
+	}
+
+	o.RootId = "123"
+	if err := o.IsValid(); err == nil {
+		t.Fatal("should be invalid")
+	}
+
+	o.RootId = ""
+	o.Message = ""
+	if err := o.IsValid(); err == nil {
+		t.Fatal("should be invalid")
+	}
+
+	o.Message = strings.Repeat("0", 4001)
+	if err := o.IsValid(); err == nil {
+		t.Fatal("should be invalid")
+	}
+
+	o.Message = "hello"
+	o.ScheduledAt = 0
+	if err := o.IsValid(); err == nil {
+		t.Fatal("should be invalid")
+	}
+
+	o.ScheduledAt = GetMillis()
+	o.Recurrence = "hourly"
+	if err := o.IsValid(); err == nil {
+		t.Fatal("should be invalid")
+	}
+
+	o.Recurrence = SCHEDULED_POST_RECURRENCE_WEEKDAYS
+	if err := o.IsValid(); err != nil {
+		t.Fatal(err)
+	}
+
+	o.Timezone = "Not/AZone"
+	if err := o.IsValid(); err == nil {
+		t.Fatal("should be invalid")
+	}
+
+	o.Timezone = "Europe/London"
+	if err := o.IsValid(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScheduledPostNextScheduledAt(t *testing.T) {
+	millis := func(t time.Time) int64 {
+		return t.UnixNano() / int64(time.Millisecond)
+	}
+
+	// a friday morning
+	friday := time.Date(2016, time.April, 1, 9, 0, 0, 0, time.UTC)
+	o := ScheduledPost{ScheduledAt: millis(friday)}
+
+	if next := o.NextScheduledAt(millis(friday)); next != 0 {
+		t.Fatal("one-off posts should not be rescheduled")
+	}
+
+	o.Recurrence = SCHEDULED_POST_RECURRENCE_DAILY
+	if next := o.NextScheduledAt(millis(friday)); next != millis(friday.AddDate(0, 0, 1)) {
+		t.Fatal("daily post should move to the next day")
+	}
+
+	o.Recurrence = SCHEDULED_POST_RECURRENCE_WEEKDAYS
+	if next := o.NextScheduledAt(millis(friday)); next != millis(friday.AddDate(0, 0, 3)) {
+		t.Fatal("weekday post should skip the weekend")
+	}
+
+	o.Recurrence = SCHEDULED_POST_RECURRENCE_WEEKLY
+	if next := o.NextScheduledAt(millis(friday.AddDate(0, 0, 10))); next != millis(friday.AddDate(0, 0, 14)) {
+		t.Fatal("weekly post should skip any missed deliveries")
+	}
+
+	// the day before the clocks go forward in new york
+	location, _ := time.LoadLocation("America/New_York")
+	saturday := time.Date(2016, time.March, 12, 9, 0, 0, 0, location)
+	o = ScheduledPost{ScheduledAt: millis(saturday), Recurrence: SCHEDULED_POST_RECURRENCE_DAILY, Timezone: "America/New_York"}
+
+	if next := o.NextScheduledAt(millis(saturday)); next != millis(time.Date(2016, time.March, 13, 9, 0, 0, 0, location)) {
+		t.Fatal("daily post should stay at the same time of day in the author's timezone")
+	}
+}
+
+func TestGetScheduledPostRetryDelay(t *testing.T) {
+	if delay := GetScheduledPostRetryDelay(1); delay != SCHEDULED_POST_RETRY_BASE_DELAY {
+		t.Fatal("first retry should use the base delay")
+	}
+
+	if delay := GetScheduledPostRetryDelay(3); delay != 4*SCHEDULED_POST_RETRY_BASE_DELAY {
+		t.Fatal("delay should double after each attempt")
+	}
+
+	if delay := GetScheduledPostRetryDelay(100); delay != SCHEDULED_POST_RETRY_MAX_DELAY {
+		t.Fatal("delay should be capped")
+	}
+}
+
+func TestScheduledPostPreUpdate(t *testing.T) {
+	o := ScheduledPost{Attempts: SCHEDULED_POST_MAX_ATTEMPTS, LockedUntil: 1000, LastError: "channel archived"}
+
+	if o.IsRetryable() {
+		t.Fatal("shouldn't retry a post that failed too many times")
+	}
+
+	o.PreUpdate()
+
+	if !o.IsRetryable() || o.LockedUntil != 0 || o.LastError != "" {
+		t.Fatal("editing a post should give it a fresh start")
+	}
+}
+
+func TestScheduledPostToPost(t *testing.T) {
+	o := ScheduledPost{ChannelId: NewId(), RootId: NewId(), Message: "hello", Filenames: StringArray{"a.png"}}
+	post := o.ToPost()
+
+	if post.ChannelId != o.ChannelId || post.RootId != o.RootId || post.Message != o.Message || len(post.Filenames) != 1 {
+		t.Fatal("post did not match")
+	}
+
+	post.Filenames[0] = "b.png"
+	if o.Filenames[0] != "a.png" {
+		t.Fatal("filenames should have been copied")
+	}
+}
@@ -5,16 +5,24 @@ package model
 
 import (
 	"strings"
+	"time"
 )
 
+const SEARCH_DATE_FORMAT = "2006-01-02"
+
 type SearchParams struct {
 	Terms      string
 	IsHashtag  bool
 	InChannels []string
 	FromUsers  []string
+	AfterDate  string
+	BeforeDate string
+	OnDate     string
+	FileTerms  string
+	Extensions []string
 }
 
-var searchFlags = [...]string{"from", "channel", "in"}
+var searchFlags = [...]string{"from", "channel", "in", "after", "before", "on", "file", "ext"}
 
 func splitWordsNoQuotes(text string) []string {
 	words := []string{}
@@ -52,6 +60,12 @@ func splitWords(text string) []string {
 	return words
 }
 
+// SplitSearchTerms splits search terms on whitespace, keeping quoted phrases
+// together with their quotes.
+func SplitSearchTerms(terms string) []string {
+	return splitWords(terms)
+}
+
 func parseSearchFlags(input []string) ([]string, [][2]string) {
 	words := []string{}
 	flags := [][2]string{}
@@ -124,6 +138,11 @@ func ParseSearchParams(text string) []*SearchParams {
 
 	inChannels := []string{}
 	fromUsers := []string{}
+	afterDate := ""
+	beforeDate := ""
+	onDate := ""
+	fileTermList := []string{}
+	extensions := []string{}
 
 	for _, flagPair := range flags {
 		flag := flagPair[0]
@@ -133,9 +152,21 @@ func ParseSearchParams(text string) []*SearchParams {
 			inChannels = append(inChannels, value)
 		} else if flag == "from" {
 			fromUsers = append(fromUsers, value)
+		} else if flag == "after" {
+			afterDate = value
+		} else if flag == "before" {
+			beforeDate = value
+		} else if flag == "on" {
+			onDate = value
+		} else if flag == "file" {
+			fileTermList = append(fileTermList, value)
+		} else if flag == "ext" {
+			extensions = append(extensions, strings.ToLower(strings.TrimPrefix(value, ".")))
 		}
 	}
 
+	fileTerms := strings.Join(fileTermList, " ")
+
 	paramsList := []*SearchParams{}
 
 	if len(plainTerms) > 0 {
@@ -144,6 +175,11 @@ func ParseSearchParams(text string) []*SearchParams {
 			IsHashtag:  false,
 			InChannels: inChannels,
 			FromUsers:  fromUsers,
+			AfterDate:  afterDate,
+			BeforeDate: beforeDate,
+			OnDate:     onDate,
+			FileTerms:  fileTerms,
+			Extensions: extensions,
 		})
 	}
 
@@ -153,18 +189,81 @@ func ParseSearchParams(text string) []*SearchParams {
 			IsHashtag:  true,
 			InChannels: inChannels,
 			FromUsers:  fromUsers,
+			AfterDate:  afterDate,
+			BeforeDate: beforeDate,
+			OnDate:     onDate,
+			FileTerms:  fileTerms,
+			Extensions: extensions,
 		})
 	}
 
 	// special case for when no terms are specified but we still have a filter
-	if len(plainTerms) == 0 && len(hashtagTerms) == 0 && (len(inChannels) != 0 || len(fromUsers) != 0) {
+	if len(plainTerms) == 0 && len(hashtagTerms) == 0 &&
+		(len(inChannels) != 0 || len(fromUsers) != 0 || afterDate != "" || beforeDate != "" || onDate != "" || fileTerms != "" || len(extensions) != 0) {
 		paramsList = append(paramsList, &SearchParams{
 			Terms:      "",
 			IsHashtag:  true,
 			InChannels: inChannels,
 			FromUsers:  fromUsers,
+			AfterDate:  afterDate,
+			BeforeDate: beforeDate,
+			OnDate:     onDate,
+			FileTerms:  fileTerms,
+			Extensions: extensions,
 		})
 	}
 
 	return paramsList
 }
+
+// HasFilters returns true if the search is restricted by anything other than its terms.
+func (p *SearchParams) HasFilters() bool {
+	return len(p.InChannels) != 0 || len(p.FromUsers) != 0 || p.AfterDate != "" || p.BeforeDate != "" || p.OnDate != "" || p.HasFileFilters()
+}
+
+// HasFileFilters returns true if the search is restricted to posts with attachments
+// that contain certain text or are of a certain type.
+func (p *SearchParams) HasFileFilters() bool {
+	return p.FileTerms != "" || len(p.Extensions) != 0
+}
+
+// GetTimeRange converts the date flags into the range of post creation times
+// that match them. Dates are whole days in UTC, start is inclusive, end is
+// exclusive and either is 0 when unbounded. Dates that can't be parsed are
+// ignored.
+func (p *SearchParams) GetTimeRange() (int64, int64) {
+	var start, end int64
+
+	if day, ok := parseSearchDate(p.AfterDate); ok {
+		start = getDateMillis(day.AddDate(0, 0, 1))
+	}
+
+	if day, ok := parseSearchDate(p.BeforeDate); ok {
+		end = getDateMillis(day)
+	}
+
+	if day, ok := parseSearchDate(p.OnDate); ok {
+		if onStart := getDateMillis(day); onStart > start {
+			start = onStart
+		}
+
+		if onEnd := getDateMillis(day.AddDate(0, 0, 1)); end == 0 || onEnd < end {
+			end = onEnd
+		}
+	}
+
+	return start, end
+}
+
+func parseSearchDate(value string) (time.Time, bool) {
+	if value == "" {
+		return time.Time{}, false
+	}
+
+	day, err := time.Parse(SEARCH_DATE_FORMAT, value)
+	return day, err == nil
+}
+
+func getDateMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
@@ -5,6 +5,7 @@ package model
 
 import (
 	"testing"
+	"time"
 )
 
 func TestSplitWords(t *testing.T) {
@@ -221,3 +222,66 @@ func TestParseSearchParams(t *testing.T) {
 		t.Fatalf("Incorrect output from parse search params: %v", sp[0])
 	}
 }
+
+func TestParseSearchParamsDates(t *testing.T) {
+	if sp := ParseSearchParams("testing after:2016-01-02 before:2016-02-01"); len(sp) != 1 || sp[0].Terms != "testing" || sp[0].AfterDate != "2016-01-02" || sp[0].BeforeDate != "2016-02-01" {
+		t.Fatalf("Incorrect output from parse search params: %v", sp[0])
+	}
+
+	if sp := ParseSearchParams("on: 2016-01-02"); len(sp) != 1 || sp[0].Terms != "" || sp[0].OnDate != "2016-01-02" || !sp[0].HasFilters() {
+		t.Fatalf("Incorrect output from parse search params: %v", sp)
+	}
+
+	if sp := ParseSearchParams("#hashtag words ON:2016-01-02"); len(sp) != 2 || sp[0].OnDate != "2016-01-02" || sp[1].OnDate != "2016-01-02" {
+		t.Fatalf("Incorrect output from parse search params: %v", sp)
+	}
+}
+
+func TestParseSearchParamsFiles(t *testing.T) {
+	if sp := ParseSearchParams("budget file:invoice file: \"net 30\" ext:.PDF ext:docx"); len(sp) != 1 || sp[0].Terms != "budget" || sp[0].FileTerms != "invoice \"net 30\"" || len(sp[0].Extensions) != 2 || sp[0].Extensions[0] != "pdf" || sp[0].Extensions[1] != "docx" {
+		t.Fatalf("Incorrect output from parse search params: %v", sp[0])
+	}
+
+	if sp := ParseSearchParams("ext:pdf"); len(sp) != 1 || sp[0].Terms != "" || !sp[0].HasFilters() || !sp[0].HasFileFilters() {
+		t.Fatalf("Incorrect output from parse search params: %v", sp)
+	}
+
+	if sp := ParseSearchParams("file:invoice"); len(sp) != 1 || sp[0].Terms != "" || sp[0].FileTerms != "invoice" {
+		t.Fatalf("Incorrect output from parse search params: %v", sp)
+	}
+
+	if sp := ParseSearchParams("invoice in:town-square"); sp[0].HasFileFilters() {
+		t.Fatal("shouldn't have file filters")
+	}
+}
+
+func TestSearchParamsGetTimeRange(t *testing.T) {
+	day := func(s string) int64 {
+		d, _ := time.Parse(SEARCH_DATE_FORMAT, s)
+		return d.UnixNano() / int64(time.Millisecond)
+	}
+
+	if start, end := (&SearchParams{}).GetTimeRange(); start != 0 || end != 0 {
+		t.Fatal("should be unbounded without any dates")
+	}
+
+	if start, end := (&SearchParams{AfterDate: "2016-01-02"}).GetTimeRange(); start != day("2016-01-03") || end != 0 {
+		t.Fatal("after should start at the end of the day")
+	}
+
+	if start, end := (&SearchParams{BeforeDate: "2016-01-02"}).GetTimeRange(); start != 0 || end != day("2016-01-02") {
+		t.Fatal("before should end at the start of the day")
+	}
+
+	if start, end := (&SearchParams{OnDate: "2016-01-02"}).GetTimeRange(); start != day("2016-01-02") || end != day("2016-01-03") {
+		t.Fatal("on should cover the whole day")
+	}
+
+	if start, end := (&SearchParams{AfterDate: "2016-01-01", OnDate: "2016-01-05", BeforeDate: "2016-01-10"}).GetTimeRange(); start != day("2016-01-05") || end != day("2016-01-06") {
+		t.Fatal("the narrowest range should win")
+	}
+
+	if start, end := (&SearchParams{AfterDate: "yesterday"}).GetTimeRange(); start != 0 || end != 0 {
+		t.Fatal("invalid dates should be ignored")
+	}
+}
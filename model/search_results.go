@@ -0,0 +1,211 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package model
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// SearchHighlight is the range of characters [Start, End) in a post's message
+// that matched the search terms.
+type SearchHighlight struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+type PostSearchResults struct {
+	*PostList
+	Highlights map[string][]SearchHighlight `json:"highlights"`
+}
+
+func NewPostSearchResults(list *PostList) *PostSearchResults {
+	return &PostSearchResults{
+		PostList:   list,
+		Highlights: make(map[string][]SearchHighlight),
+	}
+}
+
+func (o *PostSearchResults) ToJson() string {
+	b, err := json.Marshal(o)
+	if err != nil {
+		return ""
+	} else {
+		return string(b)
+	}
+}
+
+func PostSearchResultsFromJson(data io.Reader) *PostSearchResults {
+	decoder := json.NewDecoder(data)
+	var o PostSearchResults
+	err := decoder.Decode(&o)
+	if err == nil {
+		if o.PostList == nil {
+			o.PostList = &PostList{}
+		}
+		o.PostList.MakeNonNil()
+
+		if o.Highlights == nil {
+			o.Highlights = make(map[string][]SearchHighlight)
+		}
+
+		return &o
+	} else {
+		return nil
+	}
+}
+
+// AddHighlights finds the parts of every post's message that match the given
+// search terms.
+func (o *PostSearchResults) AddHighlights(paramsList []*SearchParams) {
+	for id, post := range o.Posts {
+		highlights := []SearchHighlight{}
+
+		for _, params := range paramsList {
+			highlights = append(highlights, GetSearchHighlights(post.Message, params.Terms, params.IsHashtag)...)
+		}
+
+		if len(highlights) > 0 {
+			o.Highlights[id] = mergeSearchHighlights(highlights)
+		}
+	}
+}
+
+func isSearchWordChar(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// searchWordRanges returns the ranges of the words in text, including the
+// leading # of any hashtags.
+func searchWordRanges(text []rune) []SearchHighlight {
+	ranges := []SearchHighlight{}
+
+	start := -1
+	for i, r := range text {
+		if isSearchWordChar(r) || (r == '#' && start == -1) {
+			if start == -1 {
+				start = i
+			}
+		} else if start != -1 {
+			if !(i-start == 1 && text[start] == '#') {
+				ranges = append(ranges, SearchHighlight{start, i})
+			}
+			start = -1
+			if r == '#' {
+				start = i
+			}
+		}
+	}
+
+	if start != -1 && !(len(text)-start == 1 && text[start] == '#') {
+		ranges = append(ranges, SearchHighlight{start, len(text)})
+	}
+
+	return ranges
+}
+
+func lowerRunes(text string) []rune {
+	runes := []rune(text)
+	for i, r := range runes {
+		runes[i] = unicode.ToLower(r)
+	}
+
+	return runes
+}
+
+// GetSearchWords splits text into the lowercase words that are indexed for
+// searching. Hashtags are returned without their leading #.
+func GetSearchWords(text string) []string {
+	runes := lowerRunes(text)
+
+	words := []string{}
+	for _, r := range searchWordRanges(runes) {
+		words = append(words, strings.TrimLeft(string(runes[r.Start:r.End]), "#"))
+	}
+
+	return words
+}
+
+// GetSearchHighlights returns the ranges of text that match the search terms.
+// Quoted terms match as a phrase and a trailing * matches any word with that prefix.
+func GetSearchHighlights(text string, terms string, isHashtag bool) []SearchHighlight {
+	highlights := []SearchHighlight{}
+
+	if len(terms) == 0 {
+		return highlights
+	}
+
+	runes := lowerRunes(text)
+	words := searchWordRanges(runes)
+
+	for _, term := range splitWords(strings.ToLower(terms)) {
+		if strings.HasPrefix(term, "\"") {
+			phrase := []rune(strings.Trim(term, "\""))
+			if len(phrase) == 0 {
+				continue
+			}
+
+			for i := 0; i+len(phrase) <= len(runes); i++ {
+				if string(runes[i:i+len(phrase)]) == string(phrase) &&
+					(i == 0 || !isSearchWordChar(runes[i-1])) &&
+					(i+len(phrase) == len(runes) || !isSearchWordChar(runes[i+len(phrase)])) {
+					highlights = append(highlights, SearchHighlight{i, i + len(phrase)})
+				}
+			}
+
+			continue
+		}
+
+		prefix := strings.HasSuffix(term, "*")
+		term = strings.TrimRight(term, "*")
+		if !isHashtag {
+			term = strings.TrimLeft(term, "#")
+		}
+
+		if len(term) == 0 {
+			continue
+		}
+
+		for _, word := range words {
+			value := string(runes[word.Start:word.End])
+			if !isHashtag {
+				value = strings.TrimLeft(value, "#")
+			} else if !strings.HasPrefix(value, "#") {
+				continue
+			}
+
+			if value == term || (prefix && strings.HasPrefix(value, term)) {
+				highlights = append(highlights, word)
+			}
+		}
+	}
+
+	return highlights
+}
+
+type searchHighlightsByStart []SearchHighlight
+
+func (a searchHighlightsByStart) Len() int           { return len(a) }
+func (a searchHighlightsByStart) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a searchHighlightsByStart) Less(i, j int) bool { return a[i].Start < a[j].Start }
+
+func mergeSearchHighlights(highlights []SearchHighlight) []SearchHighlight {
+	sort.Sort(searchHighlightsByStart(highlights))
+
+	merged := []SearchHighlight{}
+	for _, highlight := range highlights {
+		if last := len(merged) - 1; last >= 0 && highlight.Start <= merged[last].End {
+			if highlight.End > merged[last].End {
+				merged[last].End = highlight.End
+			}
+		} else {
+			merged = append(merged, highlight)
+		}
+	}
+
+	return merged
+}
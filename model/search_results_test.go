@@ -0,0 +1,77 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package model
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPostSearchResultsJson(t *testing.T) {
+	post := &Post{Id: NewId(), Message: "hello world"}
+
+	list := &PostList{}
+	list.AddPost(post)
+	list.AddOrder(post.Id)
+
+	results := NewPostSearchResults(list)
+	results.AddHighlights(ParseSearchParams("world"))
+
+	rresults := PostSearchResultsFromJson(strings.NewReader(results.ToJson()))
+	if len(rresults.Order) != 1 || rresults.Posts[post.Id].Message != post.Message {
+		t.Fatal("posts didn't round trip")
+	}
+
+	if highlights := rresults.Highlights[post.Id]; len(highlights) != 1 || highlights[0].Start != 6 || highlights[0].End != 11 {
+		t.Fatal("highlights didn't round trip")
+	}
+
+	// the results are still readable as a plain post list
+	if plist := PostListFromJson(strings.NewReader(results.ToJson())); len(plist.Order) != 1 {
+		t.Fatal("should be readable as a post list")
+	}
+}
+
+func TestGetSearchWords(t *testing.T) {
+	if words := GetSearchWords("Hello, #World! it's 2016_ok"); len(words) != 5 || words[0] != "hello" || words[1] != "world" || words[2] != "it" || words[3] != "s" || words[4] != "2016_ok" {
+		t.Fatalf("incorrect words %v", words)
+	}
+
+	if words := GetSearchWords("# ## ünïcödé"); len(words) != 1 || words[0] != "ünïcödé" {
+		t.Fatalf("incorrect words %v", words)
+	}
+}
+
+func TestGetSearchHighlights(t *testing.T) {
+	check := func(text string, terms string, isHashtag bool, expected ...int) {
+		highlights := GetSearchHighlights(text, terms, isHashtag)
+		if len(highlights)*2 != len(expected) {
+			t.Fatalf("wrong highlights for %v in %v: %v", terms, text, highlights)
+		}
+
+		for i, highlight := range highlights {
+			if highlight.Start != expected[i*2] || highlight.End != expected[i*2+1] {
+				t.Fatalf("wrong highlights for %v in %v: %v", terms, text, highlights)
+			}
+		}
+	}
+
+	check("the quick brown fox", "quick", false, 4, 9)
+	check("the QUICK brown fox", "quick fox", false, 4, 9, 16, 19)
+	check("the quicker brown fox", "quick", false)
+	check("the quicker brown fox", "quick*", false, 4, 11)
+	check("the quick brown fox", "\"quick brown\"", false, 4, 15)
+	check("the quick brownie", "\"quick brown\"", false)
+	check("a #hashtag and hashtag", "#hashtag", true, 2, 10)
+	check("a #hashtag and hashtag", "hashtag", false, 2, 10, 15, 22)
+	check("ünïcödé wörds", "wörds", false, 8, 13)
+	check("nothing", "", false)
+}
+
+func TestMergeSearchHighlights(t *testing.T) {
+	merged := mergeSearchHighlights([]SearchHighlight{{10, 15}, {0, 5}, {4, 8}, {12, 14}})
+	if len(merged) != 2 || merged[0].Start != 0 || merged[0].End != 8 || merged[1].Start != 10 || merged[1].End != 15 {
+		t.Fatalf("incorrect merge %v", merged)
+	}
+}
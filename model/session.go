@@ -14,6 +14,11 @@ const (
 	SESSION_PROP_PLATFORM = "platform"
 	SESSION_PROP_OS       = "os"
 	SESSION_PROP_BROWSER  = "browser"
+
+	SESSION_PROP_TYPE                    = "type"
+	SESSION_PROP_USER_ACCESS_TOKEN_ID    = "user_access_token_id"
+	SESSION_PROP_USER_ACCESS_TOKEN_SCOPE = "user_access_token_scopes"
+	SESSION_TYPE_USER_ACCESS_TOKEN       = "UserAccessToken"
 )
 
 type Session struct {
@@ -28,6 +33,9 @@ type Session struct {
 	Roles          string    `json:"roles"`
 	IsOAuth        bool      `json:"is_oauth"`
 	Props          StringMap `json:"props"`
+
+	// the teams the user belongs to, loaded when the session is used
+	TeamMembers []*TeamMember `json:"team_members" db:"-"`
 }
 
 func (me *Session) ToJson() string {
@@ -95,6 +103,34 @@ func (me *Session) AddProp(key string, value string) {
 	me.Props[key] = value
 }
 
+// IsUserAccessToken returns true if the session was made from a personal
+// access token rather than by logging in.
+func (me *Session) IsUserAccessToken() bool {
+	return me.Props[SESSION_PROP_TYPE] == SESSION_TYPE_USER_ACCESS_TOKEN
+}
+
+// HasUserAccessTokenScope returns true unless the session was made from an
+// access token that wasn't given the scope.
+func (me *Session) HasUserAccessTokenScope(scope string) bool {
+	if !me.IsUserAccessToken() {
+		return true
+	}
+
+	return IsInRole(me.Props[SESSION_PROP_USER_ACCESS_TOKEN_SCOPE], scope)
+}
+
+// GetTeamByTeamId returns the user's membership of the team or nil if they
+// don't belong to it.
+func (me *Session) GetTeamByTeamId(teamId string) *TeamMember {
+	for _, member := range me.TeamMembers {
+		if member.TeamId == teamId && member.DeleteAt == 0 {
+			return member
+		}
+	}
+
+	return nil
+}
+
 func SessionsToJson(o []*Session) string {
 	if b, err := json.Marshal(o); err != nil {
 		return "[]"
@@ -33,3 +33,47 @@ func TestSessionJson(t *testing.T) {
 
 	session.SetExpireInDays(10)
 }
+
+func TestSessionGetTeamByTeamId(t *testing.T) {
+	teamId := NewId()
+	session := Session{TeamMembers: []*TeamMember{
+		{TeamId: NewId(), UserId: NewId()},
+		{TeamId: teamId, UserId: NewId(), Roles: ROLE_TEAM_ADMIN},
+	}}
+
+	if member := session.GetTeamByTeamId(teamId); member == nil || !member.IsTeamAdmin() {
+		t.Fatal("should have found the team")
+	}
+
+	if session.GetTeamByTeamId(NewId()) != nil {
+		t.Fatal("shouldn't have found a team the user isn't in")
+	}
+
+	session.TeamMembers[1].DeleteAt = GetMillis()
+	if session.GetTeamByTeamId(teamId) != nil {
+		t.Fatal("shouldn't have found a team the user has left")
+	}
+}
+
+func TestSessionUserAccessTokenScope(t *testing.T) {
+	session := Session{}
+
+	if session.IsUserAccessToken() || !session.HasUserAccessTokenScope(USER_ACCESS_TOKEN_SCOPE_WRITE) {
+		t.Fatal("a normal session should have every scope")
+	}
+
+	session.AddProp(SESSION_PROP_TYPE, SESSION_TYPE_USER_ACCESS_TOKEN)
+	session.AddProp(SESSION_PROP_USER_ACCESS_TOKEN_SCOPE, USER_ACCESS_TOKEN_SCOPE_READ)
+
+	if !session.IsUserAccessToken() {
+		t.Fatal("should be an access token session")
+	}
+
+	if !session.HasUserAccessTokenScope(USER_ACCESS_TOKEN_SCOPE_READ) {
+		t.Fatal("should have the read scope")
+	}
+
+	if session.HasUserAccessTokenScope(USER_ACCESS_TOKEN_SCOPE_WRITE) {
+		t.Fatal("shouldn't have the write scope")
+	}
+}
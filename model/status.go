@@ -0,0 +1,182 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package model
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	USER_DND = "dnd"
+
+	// an empty manual status means it's worked out from the user's activity
+	STATUS_AUTOMATIC = ""
+)
+
+// Status holds the presence a user has chosen for themselves along with their
+// do not disturb schedule. The schedule runs from DndStartTime to DndEndTime
+// ("15:04" in the user's timezone) on each of DndDays, given as the numbers of
+// the weekdays starting from Sunday at 0. No days means every day.
+type Status struct {
+	UserId       string `json:"user_id"`
+	Manual       string `json:"manual"`
+	DndStartTime string `json:"dnd_start_time"`
+	DndEndTime   string `json:"dnd_end_time"`
+	DndDays      string `json:"dnd_days"`
+	Timezone     string `json:"timezone"`
+	UpdateAt     int64  `json:"update_at"`
+}
+
+func (o *Status) ToJson() string {
+	b, err := json.Marshal(o)
+	if err != nil {
+		return ""
+	} else {
+		return string(b)
+	}
+}
+
+func StatusFromJson(data io.Reader) *Status {
+	decoder := json.NewDecoder(data)
+	var o Status
+	err := decoder.Decode(&o)
+	if err == nil {
+		return &o
+	} else {
+		return nil
+	}
+}
+
+func (o *Status) IsValid() *AppError {
+
+	if len(o.UserId) != 26 {
+		return NewLocAppError("Status.IsValid", "model.status.is_valid.user_id.app_error", nil, "")
+	}
+
+	if !(o.Manual == STATUS_AUTOMATIC || o.Manual == USER_ONLINE || o.Manual == USER_AWAY || o.Manual == USER_DND) {
+		return NewLocAppError("Status.IsValid", "model.status.is_valid.manual.app_error", nil, "user_id="+o.UserId)
+	}
+
+	if (len(o.DndStartTime) == 0) != (len(o.DndEndTime) == 0) {
+		return NewLocAppError("Status.IsValid", "model.status.is_valid.dnd_time.app_error", nil, "user_id="+o.UserId)
+	}
+
+	if len(o.DndStartTime) > 0 {
+		if _, ok := parseStatusClock(o.DndStartTime); !ok {
+			return NewLocAppError("Status.IsValid", "model.status.is_valid.dnd_time.app_error", nil, "user_id="+o.UserId)
+		}
+
+		if _, ok := parseStatusClock(o.DndEndTime); !ok {
+			return NewLocAppError("Status.IsValid", "model.status.is_valid.dnd_time.app_error", nil, "user_id="+o.UserId)
+		}
+	}
+
+	for _, day := range o.DndDays {
+		if day < '0' || day > '6' {
+			return NewLocAppError("Status.IsValid", "model.status.is_valid.dnd_days.app_error", nil, "user_id="+o.UserId)
+		}
+	}
+
+	if len(o.Timezone) > 64 {
+		return NewLocAppError("Status.IsValid", "model.status.is_valid.timezone.app_error", nil, "user_id="+o.UserId)
+	} else if _, err := time.LoadLocation(o.Timezone); err != nil {
+		return NewLocAppError("Status.IsValid", "model.status.is_valid.timezone.app_error", nil, "user_id="+o.UserId+", "+err.Error())
+	}
+
+	return nil
+}
+
+func (o *Status) PreSave() {
+	o.UpdateAt = GetMillis()
+}
+
+// IsDndActive returns true if the user doesn't want to be notified at the
+// given time, either because they've turned on do not disturb or because it
+// falls within their schedule.
+func (o *Status) IsDndActive(now int64) bool {
+	if o.Manual == USER_DND {
+		return true
+	}
+
+	if len(o.DndStartTime) == 0 || len(o.DndEndTime) == 0 {
+		return false
+	}
+
+	start, ok := parseStatusClock(o.DndStartTime)
+	if !ok {
+		return false
+	}
+
+	end, ok := parseStatusClock(o.DndEndTime)
+	if !ok {
+		return false
+	}
+
+	location, err := time.LoadLocation(o.Timezone)
+	if err != nil {
+		location = time.UTC
+	}
+
+	t := time.Unix(0, now*int64(time.Millisecond)).In(location)
+	minute := t.Hour()*60 + t.Minute()
+	day := int(t.Weekday())
+
+	if start <= end {
+		return minute >= start && minute < end && o.isDndDay(day)
+	}
+
+	// the schedule runs past midnight so the early hours belong to the day before
+	if minute >= start {
+		return o.isDndDay(day)
+	} else if minute < end {
+		return o.isDndDay((day + 6) % 7)
+	}
+
+	return false
+}
+
+func (o *Status) isDndDay(day int) bool {
+	return len(o.DndDays) == 0 || strings.Contains(o.DndDays, strconv.Itoa(day))
+}
+
+// GetEffectiveStatus works out the status that should be shown for the user,
+// taking into account both what they've chosen and whether they're connected.
+func (o *Status) GetEffectiveStatus(user *User, now int64) string {
+	if user.IsOffline() {
+		return USER_OFFLINE
+	}
+
+	if o != nil && o.IsDndActive(now) {
+		return USER_DND
+	}
+
+	if o != nil && o.Manual == USER_AWAY {
+		return USER_AWAY
+	}
+
+	if o != nil && o.Manual == USER_ONLINE {
+		return USER_ONLINE
+	}
+
+	if user.IsAway() {
+		return USER_AWAY
+	}
+
+	return USER_ONLINE
+}
+
+// parseStatusClock returns the number of minutes after midnight for a time of
+// day in the form "15:04".
+func parseStatusClock(clock string) (int, bool) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, false
+	}
+
+	return t.Hour()*60 + t.Minute(), true
+}
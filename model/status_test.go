@@ -0,0 +1,148 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package model
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatusJson(t *testing.T) {
+	o := Status{UserId: NewId(), Manual: USER_DND}
+	json := o.ToJson()
+	ro := StatusFromJson(strings.NewReader(json))
+
+	if o.UserId != ro.UserId || o.Manual != ro.Manual {
+		t.Fatal("Ids do not match")
+	}
+}
+
+func TestStatusIsValid(t *testing.T) {
+	o := Status{}
+
+	if err := o.IsValid(); err == nil {
+		t.Fatal("should be invalid")
+	}
+
+	o.UserId = NewId()
+	if err := o.IsValid(); err != nil {
+		t.Fatal(err)
+	}
+
+	o.Manual = "junk"
+	if err := o.IsValid(); err == nil {
+		t.Fatal("should be invalid")
+	}
+
+	o.Manual = USER_AWAY
+	o.DndStartTime = "22:00"
+	if err := o.IsValid(); err == nil {
+		t.Fatal("should need an end time")
+	}
+
+	o.DndEndTime = "25:00"
+	if err := o.IsValid(); err == nil {
+		t.Fatal("should be invalid")
+	}
+
+	o.DndEndTime = "07:30"
+	o.DndDays = "12345"
+	if err := o.IsValid(); err != nil {
+		t.Fatal(err)
+	}
+
+	o.DndDays = "7"
+	if err := o.IsValid(); err == nil {
+		t.Fatal("should be invalid")
+	}
+
+	o.DndDays = ""
+	o.Timezone = "Not/A_Timezone"
+	if err := o.IsValid(); err == nil {
+		t.Fatal("should be invalid")
+	}
+}
+
+func TestStatusIsDndActive(t *testing.T) {
+	at := func(value string) int64 {
+		tm, _ := time.Parse("2006-01-02 15:04", value)
+		return tm.UnixNano() / int64(time.Millisecond)
+	}
+
+	o := Status{UserId: NewId()}
+	if o.IsDndActive(at("2016-06-01 12:00")) {
+		t.Fatal("shouldn't be active without a schedule")
+	}
+
+	o.Manual = USER_DND
+	if !o.IsDndActive(at("2016-06-01 12:00")) {
+		t.Fatal("should always be active when set manually")
+	}
+
+	// 2016-06-03 is a Friday
+	o.Manual = STATUS_AUTOMATIC
+	o.DndStartTime = "22:00"
+	o.DndEndTime = "07:00"
+	o.DndDays = "12345"
+
+	if !o.IsDndActive(at("2016-06-03 23:00")) {
+		t.Fatal("should be active late on a scheduled day")
+	}
+
+	if !o.IsDndActive(at("2016-06-04 06:59")) {
+		t.Fatal("should be active the morning after a scheduled day")
+	}
+
+	if o.IsDndActive(at("2016-06-04 07:00")) || o.IsDndActive(at("2016-06-03 12:00")) {
+		t.Fatal("shouldn't be active outside of the schedule")
+	}
+
+	if o.IsDndActive(at("2016-06-04 23:00")) || o.IsDndActive(at("2016-06-06 06:00")) {
+		t.Fatal("shouldn't be active on the weekend")
+	}
+
+	o.DndStartTime = "09:00"
+	o.DndEndTime = "17:00"
+	o.DndDays = ""
+
+	if !o.IsDndActive(at("2016-06-04 09:00")) || o.IsDndActive(at("2016-06-04 17:00")) {
+		t.Fatal("should be active during the day on every day")
+	}
+}
+
+func TestStatusGetEffectiveStatus(t *testing.T) {
+	now := GetMillis()
+	user := &User{LastActivityAt: now, LastPingAt: now}
+
+	var o *Status
+	if o.GetEffectiveStatus(user, now) != USER_ONLINE {
+		t.Fatal("should be online without a status")
+	}
+
+	o = &Status{Manual: USER_DND}
+	if o.GetEffectiveStatus(user, now) != USER_DND {
+		t.Fatal("should be do not disturb")
+	}
+
+	o.Manual = USER_AWAY
+	if o.GetEffectiveStatus(user, now) != USER_AWAY {
+		t.Fatal("should be away")
+	}
+
+	user.LastActivityAt = now - USER_AWAY_TIMEOUT - 1000
+	if (&Status{}).GetEffectiveStatus(user, now) != USER_AWAY {
+		t.Fatal("should be away after being inactive")
+	}
+
+	o.Manual = USER_ONLINE
+	if o.GetEffectiveStatus(user, now) != USER_ONLINE {
+		t.Fatal("should stay online when set manually")
+	}
+
+	user.LastPingAt = now - USER_OFFLINE_TIMEOUT - 1000
+	if o.GetEffectiveStatus(user, now) != USER_OFFLINE {
+		t.Fatal("should be offline once disconnected")
+	}
+}
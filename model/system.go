@@ -9,11 +9,12 @@ import (
 )
 
 const (
-	SYSTEM_DIAGNOSTIC_ID        = "DiagnosticId"
-	SYSTEM_RAN_UNIT_TESTS       = "RanUnitTests"
-	SYSTEM_LAST_SECURITY_TIME   = "LastSecurityTime"
-	SYSTEM_ACTIVE_LICENSE_ID    = "ActiveLicenseId"
-	SYSTEM_LAST_COMPLIANCE_TIME = "LastComplianceTime"
+	SYSTEM_DIAGNOSTIC_ID            = "DiagnosticId"
+	SYSTEM_RAN_UNIT_TESTS           = "RanUnitTests"
+	SYSTEM_LAST_SECURITY_TIME       = "LastSecurityTime"
+	SYSTEM_ACTIVE_LICENSE_ID        = "ActiveLicenseId"
+	SYSTEM_LAST_COMPLIANCE_TIME     = "LastComplianceTime"
+	SYSTEM_MIGRATED_TO_TEAM_MEMBERS = "MigratedToTeamMembers"
 )
 
 type System struct {
@@ -0,0 +1,82 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package model
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// TeamMember records that a user belongs to a team along with the roles they
+// have in it. A user can be a member of any number of teams.
+type TeamMember struct {
+	TeamId   string `json:"team_id"`
+	UserId   string `json:"user_id"`
+	Roles    string `json:"roles"`
+	DeleteAt int64  `json:"delete_at"`
+}
+
+func (o *TeamMember) ToJson() string {
+	b, err := json.Marshal(o)
+	if err != nil {
+		return ""
+	} else {
+		return string(b)
+	}
+}
+
+func TeamMemberFromJson(data io.Reader) *TeamMember {
+	decoder := json.NewDecoder(data)
+	var o TeamMember
+	err := decoder.Decode(&o)
+	if err == nil {
+		return &o
+	} else {
+		return nil
+	}
+}
+
+func TeamMembersToJson(o []*TeamMember) string {
+	if b, err := json.Marshal(o); err != nil {
+		return "[]"
+	} else {
+		return string(b)
+	}
+}
+
+func TeamMembersFromJson(data io.Reader) []*TeamMember {
+	decoder := json.NewDecoder(data)
+	var o []*TeamMember
+	err := decoder.Decode(&o)
+	if err == nil {
+		return o
+	} else {
+		return nil
+	}
+}
+
+func (o *TeamMember) IsValid() *AppError {
+
+	if len(o.TeamId) != 26 {
+		return NewLocAppError("TeamMember.IsValid", "model.team_member.is_valid.team_id.app_error", nil, "")
+	}
+
+	if len(o.UserId) != 26 {
+		return NewLocAppError("TeamMember.IsValid", "model.team_member.is_valid.user_id.app_error", nil, "")
+	}
+
+	// besides team admin the roles are the custom roles made for the team
+	for _, role := range strings.Fields(o.Roles) {
+		if !IsValidRoleName(role) || (IsBuiltInRole(role) && role != ROLE_TEAM_ADMIN) {
+			return NewLocAppError("TeamMember.IsValid", "model.team_member.is_valid.role.app_error", nil, "role="+role)
+		}
+	}
+
+	return nil
+}
+
+func (o *TeamMember) IsTeamAdmin() bool {
+	return IsInRole(o.Roles, ROLE_TEAM_ADMIN)
+}
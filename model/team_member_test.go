@@ -0,0 +1,70 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package model
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTeamMemberJson(t *testing.T) {
+	o := TeamMember{TeamId: NewId(), UserId: NewId()}
+	json := o.ToJson()
+	ro := TeamMemberFromJson(strings.NewReader(json))
+
+	if o.TeamId != ro.TeamId || o.UserId != ro.UserId {
+		t.Fatal("Ids do not match")
+	}
+
+	if l := TeamMembersFromJson(strings.NewReader(TeamMembersToJson([]*TeamMember{&o}))); len(l) != 1 || l[0].UserId != o.UserId {
+		t.Fatal("list didn't round trip")
+	}
+}
+
+func TestTeamMemberIsValid(t *testing.T) {
+	o := TeamMember{}
+
+	if err := o.IsValid(); err == nil {
+		t.Fatal("should be invalid")
+	}
+
+	o.TeamId = NewId()
+	if err := o.IsValid(); err == nil {
+		t.Fatal("should be invalid")
+	}
+
+	o.UserId = NewId()
+	o.Roles = "Not Valid!"
+	if err := o.IsValid(); err == nil {
+		t.Fatal("should be invalid")
+	}
+
+	o.Roles = "moderator"
+	if err := o.IsValid(); err != nil {
+		t.Fatal("custom roles should be allowed", err)
+	}
+
+	o.Roles = ROLE_SYSTEM_ADMIN
+	if err := o.IsValid(); err == nil {
+		t.Fatal("system admin isn't a team role")
+	}
+
+	o.Roles = ROLE_TEAM_ADMIN
+	if err := o.IsValid(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !o.IsTeamAdmin() {
+		t.Fatal("should be a team admin")
+	}
+
+	o.Roles = ""
+	if err := o.IsValid(); err != nil {
+		t.Fatal(err)
+	}
+
+	if o.IsTeamAdmin() {
+		t.Fatal("shouldn't be a team admin")
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package model
+
+import (
+	"encoding/json"
+	"io"
+)
+
+type ThreadMember struct {
+	PostId       string `json:"post_id"`
+	UserId       string `json:"user_id"`
+	Following    bool   `json:"following"`
+	LastViewedAt int64  `json:"last_viewed_at"`
+	LastUpdateAt int64  `json:"last_update_at"`
+}
+
+type Thread struct {
+	Post         *Post `json:"post"`
+	LastViewedAt int64 `json:"last_viewed_at"`
+	Unread       bool  `json:"unread"`
+}
+
+type ThreadList []*Thread
+
+func (o *ThreadMember) ToJson() string {
+	b, err := json.Marshal(o)
+	if err != nil {
+		return ""
+	} else {
+		return string(b)
+	}
+}
+
+func ThreadMemberFromJson(data io.Reader) *ThreadMember {
+	decoder := json.NewDecoder(data)
+	var o ThreadMember
+	err := decoder.Decode(&o)
+	if err == nil {
+		return &o
+	} else {
+		return nil
+	}
+}
+
+func (o *ThreadMember) IsValid() *AppError {
+
+	if len(o.PostId) != 26 {
+		return NewLocAppError("ThreadMember.IsValid", "model.thread_member.is_valid.post_id.app_error", nil, "")
+	}
+
+	if len(o.UserId) != 26 {
+		return NewLocAppError("ThreadMember.IsValid", "model.thread_member.is_valid.user_id.app_error", nil, "")
+	}
+
+	return nil
+}
+
+func (o *ThreadMember) PreSave() {
+	o.LastUpdateAt = GetMillis()
+}
+
+func NewThread(post *Post, member *ThreadMember) *Thread {
+	thread := &Thread{Post: post}
+
+	if member != nil {
+		thread.LastViewedAt = member.LastViewedAt
+	}
+
+	thread.Unread = post.LastReplyAt > thread.LastViewedAt
+
+	return thread
+}
+
+func (o ThreadList) ToJson() string {
+	b, err := json.Marshal(o)
+	if err != nil {
+		return ""
+	} else {
+		return string(b)
+	}
+}
+
+func ThreadListFromJson(data io.Reader) ThreadList {
+	decoder := json.NewDecoder(data)
+	var o ThreadList
+	err := decoder.Decode(&o)
+	if err == nil {
+		return o
+	} else {
+		return nil
+	}
+}
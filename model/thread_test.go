@@ -0,0 +1,59 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package model
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestThreadMemberJson(t *testing.T) {
+	o := ThreadMember{PostId: NewId(), UserId: NewId(), Following: true}
+	json := o.ToJson()
+	ro := ThreadMemberFromJson(strings.NewReader(json))
+
+	if o != *ro {
+		t.Fatal("Ids do not match")
+	}
+}
+
+func TestThreadMemberIsValid(t *testing.T) {
+	o := ThreadMember{}
+
+	if err := o.IsValid(); err == nil {
+		t.Fatal("should be invalid")
+	}
+
+	o.PostId = NewId()
+	if err := o.IsValid(); err == nil {
+		t.Fatal("should be invalid")
+	}
+
+	o.UserId = NewId()
+	if err := o.IsValid(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewThread(t *testing.T) {
+	post := &Post{Id: NewId(), ReplyCount: 2, LastReplyAt: 10}
+
+	if thread := NewThread(post, nil); !thread.Unread {
+		t.Fatal("thread should be unread without a membership")
+	}
+
+	if thread := NewThread(post, &ThreadMember{LastViewedAt: 5}); !thread.Unread {
+		t.Fatal("thread should be unread")
+	}
+
+	if thread := NewThread(post, &ThreadMember{LastViewedAt: 10}); thread.Unread {
+		t.Fatal("thread should be read")
+	}
+
+	list := ThreadList{NewThread(post, nil)}
+	rlist := ThreadListFromJson(strings.NewReader(list.ToJson()))
+	if len(rlist) != 1 || rlist[0].Post.Id != post.Id {
+		t.Fatal("thread list didn't round trip")
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package model
+
+import (
+	"encoding/json"
+	"io"
+	"path/filepath"
+)
+
+const (
+	// S3 won't take the parts of a multipart upload if they're any smaller so
+	// every chunk but the last has to be at least this big
+	UPLOAD_CHUNK_MIN_SIZE = 5 * 1024 * 1024
+
+	// uploads that haven't had a chunk sent for this long are thrown away
+	UPLOAD_SESSION_EXPIRY = 24 * 60 * 60 * 1000 // 1 day
+)
+
+// UploadSession tracks a large file that's being uploaded in chunks so that
+// the upload can pick up where it left off if the connection drops.
+type UploadSession struct {
+	Id          string `json:"id"`
+	CreateAt    int64  `json:"create_at"`
+	UpdateAt    int64  `json:"update_at"`
+	UserId      string `json:"user_id"`
+	TeamId      string `json:"team_id"`
+	ChannelId   string `json:"channel_id"`
+	Filename    string `json:"filename"`
+	FileSize    int64  `json:"file_size"`
+	FileOffset  int64  `json:"file_offset"`
+	Chunks      int    `json:"-"`
+	BackendId   string `json:"-"`
+	LockedUntil int64  `json:"-"`
+}
+
+func (o *UploadSession) ToJson() string {
+	b, err := json.Marshal(o)
+	if err != nil {
+		return ""
+	} else {
+		return string(b)
+	}
+}
+
+func UploadSessionFromJson(data io.Reader) *UploadSession {
+	decoder := json.NewDecoder(data)
+	var o UploadSession
+	err := decoder.Decode(&o)
+	if err == nil {
+		return &o
+	} else {
+		return nil
+	}
+}
+
+func (o *UploadSession) IsValid() *AppError {
+
+	if len(o.Id) != 26 {
+		return NewLocAppError("UploadSession.IsValid", "model.upload_session.is_valid.id.app_error", nil, "")
+	}
+
+	if o.CreateAt == 0 {
+		return NewLocAppError("UploadSession.IsValid", "model.upload_session.is_valid.create_at.app_error", nil, "id="+o.Id)
+	}
+
+	if o.UpdateAt == 0 {
+		return NewLocAppError("UploadSession.IsValid", "model.upload_session.is_valid.update_at.app_error", nil, "id="+o.Id)
+	}
+
+	if len(o.UserId) != 26 {
+		return NewLocAppError("UploadSession.IsValid", "model.upload_session.is_valid.user_id.app_error", nil, "id="+o.Id)
+	}
+
+	if len(o.TeamId) != 26 {
+		return NewLocAppError("UploadSession.IsValid", "model.upload_session.is_valid.team_id.app_error", nil, "id="+o.Id)
+	}
+
+	if len(o.ChannelId) != 26 {
+		return NewLocAppError("UploadSession.IsValid", "model.upload_session.is_valid.channel_id.app_error", nil, "id="+o.Id)
+	}
+
+	if len(o.Filename) == 0 || len(o.Filename) > 256 || o.Filename != filepath.Base(o.Filename) || o.Filename == "." || o.Filename == ".." {
+		return NewLocAppError("UploadSession.IsValid", "model.upload_session.is_valid.filename.app_error", nil, "id="+o.Id)
+	}
+
+	if o.FileSize <= 0 {
+		return NewLocAppError("UploadSession.IsValid", "model.upload_session.is_valid.file_size.app_error", nil, "id="+o.Id)
+	}
+
+	if o.FileOffset < 0 || o.FileOffset > o.FileSize {
+		return NewLocAppError("UploadSession.IsValid", "model.upload_session.is_valid.file_offset.app_error", nil, "id="+o.Id)
+	}
+
+	return nil
+}
+
+func (o *UploadSession) PreSave() {
+	if o.Id == "" {
+		o.Id = NewId()
+	}
+
+	o.CreateAt = GetMillis()
+	o.UpdateAt = o.CreateAt
+	o.FileOffset = 0
+	o.Chunks = 0
+	o.LockedUntil = 0
+}
+
+func (o *UploadSession) PreUpdate() {
+	o.UpdateAt = GetMillis()
+}
+
+// Path is where the file is kept once it's uploaded. The session's id takes
+// the place of the random directory that normal uploads are put in.
+func (o *UploadSession) Path() string {
+	return "teams/" + o.TeamId + "/channels/" + o.ChannelId + "/users/" + o.UserId + "/" + o.Id + "/" + o.Filename
+}
+
+// IsValidChunk checks whether a chunk of the given size can be sent next. It
+// must fit in the rest of the file and only the last chunk may be smaller than
+// UPLOAD_CHUNK_MIN_SIZE.
+func (o *UploadSession) IsValidChunk(size int64) bool {
+	if size <= 0 || o.FileOffset+size > o.FileSize {
+		return false
+	}
+
+	return size >= UPLOAD_CHUNK_MIN_SIZE || o.FileOffset+size == o.FileSize
+}
+
+func (o *UploadSession) IsComplete() bool {
+	return o.FileOffset == o.FileSize
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package model
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUploadSessionJson(t *testing.T) {
+	o := UploadSession{Id: NewId(), Filename: "build.tar.gz", FileSize: 100, BackendId: NewId()}
+	json := o.ToJson()
+	ro := UploadSessionFromJson(strings.NewReader(json))
+
+	if o.Id != ro.Id || o.Filename != ro.Filename || o.FileSize != ro.FileSize {
+		t.Fatal("Ids do not match")
+	}
+
+	if len(ro.BackendId) != 0 {
+		t.Fatal("backend id should not be serialized")
+	}
+}
+
+func TestUploadSessionIsValid(t *testing.T) {
+	o := UploadSession{}
+
+	if err := o.IsValid(); err == nil {
+		t.Fatal("should be invalid")
+	}
+
+	o.UserId = NewId()
+	o.TeamId = NewId()
+	o.ChannelId = NewId()
+	o.Filename = "build.tar.gz"
+	o.FileSize = 100
+	o.PreSave()
+
+	if err := o.IsValid(); err != nil {
+		t.Fatal(err)
+	}
+
+	o.Filename = "../build.tar.gz"
+	if err := o.IsValid(); err == nil {
+		t.Fatal("should be invalid, filename has a directory")
+	}
+
+	for _, filename := range []string{".", ".."} {
+		o.Filename = filename
+		if err := o.IsValid(); err == nil {
+			t.Fatal("should be invalid, filename is a directory")
+		}
+	}
+
+	o.Filename = "build.tar.gz"
+	o.FileOffset = 101
+	if err := o.IsValid(); err == nil {
+		t.Fatal("should be invalid, offset past the end of the file")
+	}
+}
+
+func TestUploadSessionIsValidChunk(t *testing.T) {
+	o := UploadSession{FileSize: UPLOAD_CHUNK_MIN_SIZE + 10}
+
+	if o.IsValidChunk(10) {
+		t.Fatal("only the last chunk can be small")
+	}
+
+	if !o.IsValidChunk(UPLOAD_CHUNK_MIN_SIZE) {
+		t.Fatal("should take a chunk of the minimum size")
+	}
+
+	if o.IsValidChunk(UPLOAD_CHUNK_MIN_SIZE + 11) {
+		t.Fatal("shouldn't take a chunk past the end of the file")
+	}
+
+	o.FileOffset = UPLOAD_CHUNK_MIN_SIZE
+	if !o.IsValidChunk(10) || o.IsComplete() {
+		t.Fatal("should take a small last chunk")
+	}
+
+	o.FileOffset = o.FileSize
+	if !o.IsComplete() {
+		t.Fatal("should be complete")
+	}
+}
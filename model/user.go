@@ -17,6 +17,7 @@ import (
 const (
 	ROLE_TEAM_ADMIN            = "admin"
 	ROLE_SYSTEM_ADMIN          = "system_admin"
+	ROLE_GUEST                 = "guest"
 	USER_AWAY_TIMEOUT          = 5 * 60 * 1000 // 5 minutes
 	USER_OFFLINE_TIMEOUT       = 1 * 60 * 1000 // 1 minute
 	USER_OFFLINE               = "offline"
@@ -28,6 +29,9 @@ const (
 	DEFAULT_LOCALE             = "en"
 	USER_AUTH_SERVICE_EMAIL    = "email"
 	USER_AUTH_SERVICE_USERNAME = "username"
+	USER_PROP_BOT_CALLBACK_URL = "bot_callback_url"
+	USER_PROP_BOT_SECRET       = "bot_secret"
+	BOT_EMAIL_DOMAIN           = "bots.invalid"
 )
 
 type User struct {
@@ -58,6 +62,23 @@ type User struct {
 	Locale             string    `json:"locale"`
 	MfaActive          bool      `json:"mfa_active,omitempty"`
 	MfaSecret          string    `json:"mfa_secret,omitempty"`
+	IsBot              bool      `json:"is_bot,omitempty"`
+	BotOwnerId         string    `json:"bot_owner_id,omitempty"`
+	GuestExpiresAt     int64     `json:"guest_expires_at,omitempty"`
+}
+
+// NewBotUser makes the account for a bot owned by a user or an OAuth app. Bots
+// never log in so they have no password, and their email address is made up
+// from their username so that it can never receive mail.
+func NewBotUser(teamId string, username string, ownerId string) *User {
+	return &User{
+		TeamId:        teamId,
+		Username:      username,
+		Email:         strings.ToLower(username) + "@" + BOT_EMAIL_DOMAIN,
+		EmailVerified: true,
+		IsBot:         true,
+		BotOwnerId:    ownerId,
+	}
 }
 
 // IsValid validates the user and returns an error if it isn't configured
@@ -120,6 +141,14 @@ func (u *User) IsValid() *AppError {
 		return NewLocAppError("User.IsValid", "model.user.is_valid.theme.app_error", nil, "user_id="+u.Id)
 	}
 
+	if u.IsBot && (len(u.BotOwnerId) != 26 || len(u.Password) > 0 || len(u.AuthData) > 0) {
+		return NewLocAppError("User.IsValid", "model.user.is_valid.bot.app_error", nil, "user_id="+u.Id)
+	}
+
+	if !u.IsBot && len(u.BotOwnerId) > 0 {
+		return NewLocAppError("User.IsValid", "model.user.is_valid.bot_owner_id.app_error", nil, "user_id="+u.Id)
+	}
+
 	return nil
 }
 
@@ -188,6 +217,7 @@ func (u *User) PreUpdate() {
 func (u *User) SetDefaultNotifications() {
 	u.NotifyProps = make(map[string]string)
 	u.NotifyProps["email"] = "true"
+	u.NotifyProps["email_interval"] = EMAIL_INTERVAL_IMMEDIATE
 	u.NotifyProps["desktop"] = USER_NOTIFY_ALL
 	u.NotifyProps["desktop_sound"] = "true"
 	u.NotifyProps["mention_keys"] = u.Username + ",@" + u.Username
@@ -239,6 +269,16 @@ func (u *User) Sanitize(options map[string]bool) {
 	if len(options) != 0 && !options["passwordupdate"] {
 		u.LastPasswordUpdate = 0
 	}
+	if _, ok := u.Props[USER_PROP_BOT_SECRET]; ok && !options["botsecret"] {
+		// copy the props since they may be shared with a cached user
+		props := make(StringMap, len(u.Props))
+		for key, value := range u.Props {
+			if key != USER_PROP_BOT_SECRET {
+				props[key] = value
+			}
+		}
+		u.Props = props
+	}
 }
 
 func (u *User) ClearNonProfileFields() {
@@ -311,6 +351,11 @@ func IsValidRoles(userRoles string) bool {
 		}
 	}
 
+	// guests can't be given any other role
+	if IsInRole(userRoles, ROLE_GUEST) && len(strings.Fields(userRoles)) > 1 {
+		return false
+	}
+
 	return true
 }
 
@@ -327,6 +372,10 @@ func isValidRole(role string) bool {
 		return true
 	}
 
+	if role == ROLE_GUEST {
+		return true
+	}
+
 	return false
 }
 
@@ -351,6 +400,17 @@ func IsInRole(userRoles string, inRole string) bool {
 	return false
 }
 
+// IsGuest returns true if the user can only see the channels they've been
+// added to and the people in them.
+func (u *User) IsGuest() bool {
+	return u.IsInRole(ROLE_GUEST)
+}
+
+// IsGuestExpired returns true if the user is a guest whose access has run out.
+func (u *User) IsGuestExpired() bool {
+	return u.IsGuest() && u.GuestExpiresAt != 0 && u.GuestExpiresAt <= GetMillis()
+}
+
 func (u *User) IsSSOUser() bool {
 	if len(u.AuthData) != 0 && len(u.AuthService) != 0 && u.AuthService != USER_AUTH_SERVICE_LDAP {
 		return true
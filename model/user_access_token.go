@@ -0,0 +1,142 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+const (
+	USER_ACCESS_TOKEN_SCOPE_READ  = "read"
+	USER_ACCESS_TOKEN_SCOPE_WRITE = "write"
+)
+
+// UserAccessToken lets scripts act as a user without logging in with their
+// password. Only a hash of the token is kept so the token itself is returned
+// just once, when it is created.
+type UserAccessToken struct {
+	Id          string `json:"id"`
+	Token       string `json:"token,omitempty" db:"-"`
+	TokenHash   string `json:"-"`
+	UserId      string `json:"user_id"`
+	Description string `json:"description"`
+	Scopes      string `json:"scopes"`
+	CreateAt    int64  `json:"create_at"`
+	LastUsedAt  int64  `json:"last_used_at"`
+}
+
+func (o *UserAccessToken) ToJson() string {
+	b, err := json.Marshal(o)
+	if err != nil {
+		return ""
+	} else {
+		return string(b)
+	}
+}
+
+func UserAccessTokenFromJson(data io.Reader) *UserAccessToken {
+	decoder := json.NewDecoder(data)
+	var o UserAccessToken
+	err := decoder.Decode(&o)
+	if err == nil {
+		return &o
+	} else {
+		return nil
+	}
+}
+
+func UserAccessTokensToJson(o []*UserAccessToken) string {
+	if b, err := json.Marshal(o); err != nil {
+		return "[]"
+	} else {
+		return string(b)
+	}
+}
+
+func UserAccessTokensFromJson(data io.Reader) []*UserAccessToken {
+	decoder := json.NewDecoder(data)
+	var o []*UserAccessToken
+	err := decoder.Decode(&o)
+	if err == nil {
+		return o
+	} else {
+		return nil
+	}
+}
+
+func (o *UserAccessToken) IsValid() *AppError {
+
+	if len(o.Id) != 26 {
+		return NewLocAppError("UserAccessToken.IsValid", "model.user_access_token.is_valid.id.app_error", nil, "")
+	}
+
+	if len(o.TokenHash) != 64 {
+		return NewLocAppError("UserAccessToken.IsValid", "model.user_access_token.is_valid.token.app_error", nil, "id="+o.Id)
+	}
+
+	if len(o.UserId) != 26 {
+		return NewLocAppError("UserAccessToken.IsValid", "model.user_access_token.is_valid.user_id.app_error", nil, "id="+o.Id)
+	}
+
+	if len(o.Description) > 256 {
+		return NewLocAppError("UserAccessToken.IsValid", "model.user_access_token.is_valid.description.app_error", nil, "id="+o.Id)
+	}
+
+	if !IsValidUserAccessTokenScopes(o.Scopes) {
+		return NewLocAppError("UserAccessToken.IsValid", "model.user_access_token.is_valid.scopes.app_error", nil, "id="+o.Id)
+	}
+
+	if o.CreateAt == 0 {
+		return NewLocAppError("UserAccessToken.IsValid", "model.user_access_token.is_valid.create_at.app_error", nil, "id="+o.Id)
+	}
+
+	return nil
+}
+
+// PreSave generates the token and keeps its hash. The token should be handed
+// to the user straight after saving since it can't be recovered later.
+func (o *UserAccessToken) PreSave() {
+	if o.Id == "" {
+		o.Id = NewId()
+	}
+
+	o.Token = NewId()
+	o.TokenHash = HashUserAccessToken(o.Token)
+
+	o.CreateAt = GetMillis()
+	o.LastUsedAt = 0
+}
+
+func (o *UserAccessToken) Sanitize() {
+	o.Token = ""
+}
+
+func (o *UserAccessToken) HasScope(scope string) bool {
+	return IsInRole(o.Scopes, scope)
+}
+
+// HashUserAccessToken is how tokens are looked up. They are random so a plain
+// hash is enough to keep them from being usable if the database leaks.
+func HashUserAccessToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+func IsValidUserAccessTokenScopes(scopes string) bool {
+	if len(strings.Fields(scopes)) == 0 {
+		return false
+	}
+
+	for _, scope := range strings.Fields(scopes) {
+		if scope != USER_ACCESS_TOKEN_SCOPE_READ && scope != USER_ACCESS_TOKEN_SCOPE_WRITE {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package model
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUserAccessTokenJson(t *testing.T) {
+	o := UserAccessToken{Id: NewId(), UserId: NewId(), Description: "script", Scopes: USER_ACCESS_TOKEN_SCOPE_READ}
+	json := o.ToJson()
+	ro := UserAccessTokenFromJson(strings.NewReader(json))
+
+	if o.Id != ro.Id || o.Scopes != ro.Scopes {
+		t.Fatal("Ids do not match")
+	}
+
+	list := UserAccessTokensFromJson(strings.NewReader(UserAccessTokensToJson([]*UserAccessToken{&o})))
+	if len(list) != 1 || list[0].Id != o.Id {
+		t.Fatal("list did not round trip")
+	}
+}
+
+func TestUserAccessTokenPreSave(t *testing.T) {
+	o := UserAccessToken{UserId: NewId(), Scopes: USER_ACCESS_TOKEN_SCOPE_READ}
+	o.PreSave()
+
+	if len(o.Token) != 26 || o.TokenHash != HashUserAccessToken(o.Token) {
+		t.Fatal("should have generated a token")
+	}
+
+	if strings.Contains(o.ToJson(), o.TokenHash) {
+		t.Fatal("the hash shouldn't be sent to clients")
+	}
+
+	o.Sanitize()
+	if o.Token != "" {
+		t.Fatal("should have removed the token")
+	}
+}
+
+func TestUserAccessTokenIsValid(t *testing.T) {
+	o := UserAccessToken{}
+
+	if err := o.IsValid(); err == nil {
+		t.Fatal("should be invalid")
+	}
+
+	o.Id = NewId()
+	if err := o.IsValid(); err == nil {
+		t.Fatal("should be invalid")
+	}
+
+	o.TokenHash = HashUserAccessToken(NewId())
+	if err := o.IsValid(); err == nil {
+		t.Fatal("should be invalid")
+	}
+
+	o.UserId = NewId()
+	if err := o.IsValid(); err == nil {
+		t.Fatal("should be invalid")
+	}
+
+	o.Scopes = "read admin"
+	if err := o.IsValid(); err == nil {
+		t.Fatal("should be invalid")
+	}
+
+	o.Scopes = USER_ACCESS_TOKEN_SCOPE_READ + " " + USER_ACCESS_TOKEN_SCOPE_WRITE
+	if err := o.IsValid(); err == nil {
+		t.Fatal("should be invalid")
+	}
+
+	o.CreateAt = GetMillis()
+	if err := o.IsValid(); err != nil {
+		t.Fatal(err)
+	}
+
+	o.Description = strings.Repeat("a", 257)
+	if err := o.IsValid(); err == nil {
+		t.Fatal("should be invalid")
+	}
+}
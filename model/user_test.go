@@ -108,6 +108,40 @@ func TestUserIsValid(t *testing.T) {
 	}
 }
 
+func TestBotUserIsValid(t *testing.T) {
+	user := NewBotUser(NewId(), "Bot"+NewId()[:10], NewId())
+	user.PreSave()
+
+	if err := user.IsValid(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasSuffix(user.Email, "@"+BOT_EMAIL_DOMAIN) || user.Email != strings.ToLower(user.Email) {
+		t.Fatal("bot should have been given an unusable email address")
+	}
+
+	user.Password = HashPassword("password")
+	if err := user.IsValid(); err == nil {
+		t.Fatal("bots shouldn't be able to have a password")
+	}
+
+	user.Password = ""
+	user.BotOwnerId = ""
+	if err := user.IsValid(); err == nil {
+		t.Fatal("bots should have an owner")
+	}
+
+	user.IsBot = false
+	if err := user.IsValid(); err != nil {
+		t.Fatal(err)
+	}
+
+	user.BotOwnerId = NewId()
+	if err := user.IsValid(); err == nil {
+		t.Fatal("only bots should have an owner")
+	}
+}
+
 func TestUserGetFullName(t *testing.T) {
 	user := User{}
 
@@ -215,3 +249,33 @@ func TestRoles(t *testing.T) {
 		t.Fatal()
 	}
 }
+
+func TestGuestRoles(t *testing.T) {
+	if !IsValidRoles("guest") {
+		t.Fatal()
+	}
+
+	if IsValidRoles("guest admin") || IsValidRoles("system_admin guest") {
+		t.Fatal("guests shouldn't be able to have other roles")
+	}
+
+	user := User{Roles: ROLE_GUEST}
+	if !user.IsGuest() || user.IsGuestExpired() {
+		t.Fatal("guests without an expiry date shouldn't expire")
+	}
+
+	user.GuestExpiresAt = GetMillis() + 60*1000
+	if user.IsGuestExpired() {
+		t.Fatal("shouldn't have expired yet")
+	}
+
+	user.GuestExpiresAt = GetMillis() - 1
+	if !user.IsGuestExpired() {
+		t.Fatal("should have expired")
+	}
+
+	user.Roles = ""
+	if user.IsGuest() || user.IsGuestExpired() {
+		t.Fatal("only guests should expire")
+	}
+}
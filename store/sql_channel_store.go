@@ -614,6 +614,45 @@ func (s SqlChannelStore) GetMemberCount(channelId string) StoreChannel {
 	return storeChannel
 }
 
+// GetUserIdsInSharedChannels returns the ids of everyone who is in at least
+// one of the same channels as the user in the team, including the user.
+func (s SqlChannelStore) GetUserIdsInSharedChannels(teamId string, userId string) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		var userIds []string
+		if _, err := s.GetReplica().Select(&userIds, `
+			SELECT DISTINCT
+				Others.UserId
+			FROM
+				ChannelMembers Mine,
+				ChannelMembers Others,
+				Channels
+			WHERE
+				Mine.UserId = :UserId
+				AND Others.ChannelId = Mine.ChannelId
+				AND Channels.Id = Mine.ChannelId
+				AND Channels.TeamId = :TeamId
+				AND Channels.DeleteAt = 0`, map[string]interface{}{"TeamId": teamId, "UserId": userId}); err != nil {
+			result.Err = model.NewLocAppError("SqlChannelStore.GetUserIdsInSharedChannels", "store.sql_channel.get_user_ids_in_shared_channels.app_error", nil, "team_id="+teamId+", user_id="+userId+", "+err.Error())
+		} else {
+			userIdMap := map[string]bool{userId: true}
+			for _, id := range userIds {
+				userIdMap[id] = true
+			}
+
+			result.Data = userIdMap
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
 func (s SqlChannelStore) GetExtraMembers(channelId string, limit int) StoreChannel {
 	storeChannel := make(StoreChannel)
 
@@ -932,3 +932,40 @@ func TestUpdateExtrasByUser(t *testing.T) {
 		t.Fatal("got incorrect member count %v", len(result.Data.([]model.ExtraMember)))
 	}
 }
+
+func TestChannelStoreGetUserIdsInSharedChannels(t *testing.T) {
+	Setup()
+
+	teamId := model.NewId()
+
+	c1 := model.Channel{TeamId: teamId, DisplayName: "Channel1", Name: "a" + model.NewId() + "b", Type: model.CHANNEL_OPEN}
+	Must(store.Channel().Save(&c1))
+
+	c2 := model.Channel{TeamId: teamId, DisplayName: "Channel2", Name: "a" + model.NewId() + "b", Type: model.CHANNEL_OPEN}
+	Must(store.Channel().Save(&c2))
+
+	u1 := model.User{TeamId: teamId, Email: model.NewId()}
+	Must(store.User().Save(&u1))
+
+	u2 := model.User{TeamId: teamId, Email: model.NewId()}
+	Must(store.User().Save(&u2))
+
+	u3 := model.User{TeamId: teamId, Email: model.NewId()}
+	Must(store.User().Save(&u3))
+
+	Must(store.Channel().SaveMember(&model.ChannelMember{ChannelId: c1.Id, UserId: u1.Id, NotifyProps: model.GetDefaultChannelNotifyProps()}))
+	Must(store.Channel().SaveMember(&model.ChannelMember{ChannelId: c1.Id, UserId: u2.Id, NotifyProps: model.GetDefaultChannelNotifyProps()}))
+	Must(store.Channel().SaveMember(&model.ChannelMember{ChannelId: c2.Id, UserId: u3.Id, NotifyProps: model.GetDefaultChannelNotifyProps()}))
+
+	if result := <-store.Channel().GetUserIdsInSharedChannels(teamId, u1.Id); result.Err != nil {
+		t.Fatal(result.Err)
+	} else if userIds := result.Data.(map[string]bool); len(userIds) != 2 || !userIds[u1.Id] || !userIds[u2.Id] {
+		t.Fatal("should only have returned the users in the same channel")
+	}
+
+	if result := <-store.Channel().GetUserIdsInSharedChannels(model.NewId(), u1.Id); result.Err != nil {
+		t.Fatal(result.Err)
+	} else if userIds := result.Data.(map[string]bool); len(userIds) != 1 || !userIds[u1.Id] {
+		t.Fatal("shouldn't have returned users from channels in other teams")
+	}
+}
@@ -29,6 +29,14 @@ func NewSqlCommandStore(sqlStore *SqlStore) CommandStore {
 		tableo.ColMap("AutoCompleteHint").SetMaxSize(1024)
 		tableo.ColMap("DisplayName").SetMaxSize(64)
 		tableo.ColMap("Description").SetMaxSize(128)
+
+		tablew := db.AddTableWithName(model.CommandWebhook{}, "CommandWebhooks").SetKeys(false, "Id")
+		tablew.ColMap("Id").SetMaxSize(26)
+		tablew.ColMap("CommandId").SetMaxSize(26)
+		tablew.ColMap("UserId").SetMaxSize(26)
+		tablew.ColMap("TeamId").SetMaxSize(26)
+		tablew.ColMap("ChannelId").SetMaxSize(26)
+		tablew.ColMap("SiteURL").SetMaxSize(1024)
 	}
 
 	return s
@@ -40,6 +48,7 @@ func (s SqlCommandStore) UpgradeSchemaIfNeeded() {
 
 func (s SqlCommandStore) CreateIndexesIfNotExists() {
 	s.CreateIndexIfNotExists("idx_command_team_id", "Commands", "TeamId")
+	s.CreateIndexIfNotExists("idx_command_webhook_create_at", "CommandWebhooks", "CreateAt")
 }
 
 func (s SqlCommandStore) Save(command *model.Command) StoreChannel {
@@ -174,6 +183,101 @@ func (s SqlCommandStore) Update(cmd *model.Command) StoreChannel {
 	return storeChannel
 }
 
+func (s SqlCommandStore) SaveWebhook(webhook *model.CommandWebhook) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		if len(webhook.Id) > 0 {
+			result.Err = model.NewLocAppError("SqlCommandStore.SaveWebhook", "store.sql_command.save_webhook.existing.app_error", nil, "id="+webhook.Id)
+			storeChannel <- result
+			close(storeChannel)
+			return
+		}
+
+		webhook.PreSave()
+		if result.Err = webhook.IsValid(); result.Err != nil {
+			storeChannel <- result
+			close(storeChannel)
+			return
+		}
+
+		if err := s.GetMaster().Insert(webhook); err != nil {
+			result.Err = model.NewLocAppError("SqlCommandStore.SaveWebhook", "store.sql_command.save_webhook.app_error", nil, "id="+webhook.Id+", "+err.Error())
+		} else {
+			result.Data = webhook
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+func (s SqlCommandStore) GetWebhook(id string) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		var webhook model.CommandWebhook
+
+		if err := s.GetMaster().SelectOne(&webhook, "SELECT * FROM CommandWebhooks WHERE Id = :Id", map[string]interface{}{"Id": id}); err != nil {
+			result.Err = model.NewLocAppError("SqlCommandStore.GetWebhook", "store.sql_command.get_webhook.app_error", nil, "id="+id+", err="+err.Error())
+		} else {
+			result.Data = &webhook
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+// UseWebhook records a response being posted to a command's response URL. The
+// update only applies if the URL hasn't already been used, so when several
+// responses race for the same URL only one of them gets true back.
+func (s SqlCommandStore) UseWebhook(id string) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		if sqlResult, err := s.GetMaster().Exec("UPDATE CommandWebhooks SET UseCount = UseCount + 1 WHERE Id = :Id AND UseCount = 0", map[string]interface{}{"Id": id}); err != nil {
+			result.Err = model.NewLocAppError("SqlCommandStore.UseWebhook", "store.sql_command.use_webhook.app_error", nil, "id="+id+", err="+err.Error())
+		} else if rows, err := sqlResult.RowsAffected(); err != nil {
+			result.Err = model.NewLocAppError("SqlCommandStore.UseWebhook", "store.sql_command.use_webhook.app_error", nil, "id="+id+", err="+err.Error())
+		} else {
+			result.Data = rows == 1
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+func (s SqlCommandStore) PermanentDeleteWebhooksBefore(time int64) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		if _, err := s.GetMaster().Exec("DELETE FROM CommandWebhooks WHERE CreateAt < :Time", map[string]interface{}{"Time": time}); err != nil {
+			result.Err = model.NewLocAppError("SqlCommandStore.PermanentDeleteWebhooksBefore", "store.sql_command.permanent_delete_webhooks_before.app_error", nil, err.Error())
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
 func (s SqlCommandStore) AnalyticsCommandCount(teamId string) StoreChannel {
 	storeChannel := make(StoreChannel)
 
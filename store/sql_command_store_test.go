@@ -181,3 +181,45 @@ func TestCommandCount(t *testing.T) {
 		}
 	}
 }
+
+func TestCommandStoreWebhooks(t *testing.T) {
+	Setup()
+
+	o1 := &model.CommandWebhook{}
+	o1.CommandId = model.NewId()
+	o1.UserId = model.NewId()
+	o1.TeamId = model.NewId()
+	o1.ChannelId = model.NewId()
+
+	if err := (<-store.Command().SaveWebhook(o1)).Err; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := (<-store.Command().SaveWebhook(o1)).Err; err == nil {
+		t.Fatal("shouldn't be able to update from save")
+	}
+
+	if r := <-store.Command().GetWebhook(o1.Id); r.Err != nil {
+		t.Fatal(r.Err)
+	} else if r.Data.(*model.CommandWebhook).CommandId != o1.CommandId {
+		t.Fatal("invalid returned webhook")
+	}
+
+	if err := (<-store.Command().GetWebhook("123")).Err; err == nil {
+		t.Fatal("Missing id should have failed")
+	}
+
+	if used := Must(store.Command().UseWebhook(o1.Id)).(bool); !used {
+		t.Fatal("should have been able to use the webhook")
+	}
+
+	if used := Must(store.Command().UseWebhook(o1.Id)).(bool); used {
+		t.Fatal("shouldn't be able to use the webhook twice")
+	}
+
+	Must(store.Command().PermanentDeleteWebhooksBefore(o1.CreateAt + 1))
+
+	if err := (<-store.Command().GetWebhook(o1.Id)).Err; err == nil {
+		t.Fatal("should have removed the old webhook")
+	}
+}
@@ -193,6 +193,7 @@ func (s SqlComplianceStore) ComplianceExport(job *model.Compliance) StoreChannel
 			    Posts.Id AS PostId,
 			    Posts.CreateAt AS PostCreateAt,
 			    Posts.UpdateAt AS PostUpdateAt,
+			    Posts.EditAt AS PostEditAt,
 			    Posts.DeleteAt AS PostDeleteAt,
 			    Posts.RootId AS PostRootId,
 			    Posts.ParentId AS PostParentId,
@@ -211,11 +212,12 @@ func (s SqlComplianceStore) ComplianceExport(job *model.Compliance) StoreChannel
 			    Teams.Id = Channels.TeamId
 			        AND Posts.ChannelId = Channels.Id
 			        AND Posts.UserId = Users.Id
-			        AND Posts.CreateAt > :StartTime
-			        AND Posts.CreateAt <= :EndTime
+			        AND ((Posts.CreateAt > :StartTime AND Posts.CreateAt <= :EndTime)
+			            OR (Posts.EditAt > :StartTime AND Posts.EditAt <= :EndTime)
+			            OR (Posts.DeleteAt > :StartTime AND Posts.DeleteAt <= :EndTime))
 			        ` + emailQuery + `
 			        ` + keywordQuery + `
-			ORDER BY Posts.CreateAt
+			ORDER BY Posts.CreateAt, Posts.EditAt
 			LIMIT 30000`
 
 		var cposts []*model.CompliancePost
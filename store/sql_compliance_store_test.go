@@ -208,3 +208,80 @@ func TestComplianceExport(t *testing.T) {
 		}
 	}
 }
+
+func TestComplianceExportRevisions(t *testing.T) {
+	Setup()
+
+	t1 := &model.Team{}
+	t1.DisplayName = "DisplayName"
+	t1.Name = "a" + model.NewId() + "b"
+	t1.Email = model.NewId() + "@nowhere.com"
+	t1.Type = model.TEAM_OPEN
+	t1 = Must(store.Team().Save(t1)).(*model.Team)
+
+	u1 := &model.User{}
+	u1.TeamId = t1.Id
+	u1.Email = model.NewId()
+	u1.Username = model.NewId()
+	u1 = Must(store.User().Save(u1)).(*model.User)
+
+	c1 := &model.Channel{}
+	c1.TeamId = t1.Id
+	c1.DisplayName = "Channel2"
+	c1.Name = "a" + model.NewId() + "b"
+	c1.Type = model.CHANNEL_OPEN
+	c1 = Must(store.Channel().Save(c1)).(*model.Channel)
+
+	// the post was written long before the export window
+	o1 := &model.Post{}
+	o1.ChannelId = c1.Id
+	o1.UserId = u1.Id
+	o1.CreateAt = model.GetMillis() - 1000*60*60
+	o1.Message = "a" + model.NewId() + "b"
+	o1 = Must(store.Post().Save(o1)).(*model.Post)
+	originalMessage := o1.Message
+
+	o2 := &model.Post{}
+	o2.ChannelId = c1.Id
+	o2.UserId = u1.Id
+	o2.CreateAt = model.GetMillis() - 1000*60*60
+	o2.Message = "a" + model.NewId() + "b"
+	o2 = Must(store.Post().Save(o2)).(*model.Post)
+
+	start := model.GetMillis()
+	time.Sleep(10 * time.Millisecond)
+
+	edited := Must(store.Post().Update(o1, "a"+model.NewId()+"b", "")).(*model.Post)
+
+	// pinning changes UpdateAt but isn't an edit of the message
+	Must(store.Post().UpdatePinned(o2, true))
+
+	time.Sleep(10 * time.Millisecond)
+	Must(store.Post().Delete(edited.Id, model.GetMillis()))
+	time.Sleep(10 * time.Millisecond)
+
+	cr1 := &model.Compliance{Desc: "test" + model.NewId(), StartAt: start, EndAt: model.GetMillis(), Emails: u1.Email}
+	if r1 := <-store.Compliance().ComplianceExport(cr1); r1.Err != nil {
+		t.Fatal(r1.Err)
+	} else {
+		cposts := r1.Data.([]*model.CompliancePost)
+
+		if len(cposts) != 2 {
+			t.Fatal("should have only exported the revision and the deleted post")
+		}
+
+		foundRevision := false
+		foundDeleted := false
+		for _, cpost := range cposts {
+			if cpost.PostOriginalId == edited.Id && cpost.PostMessage == originalMessage {
+				foundRevision = true
+			} else if cpost.PostId == edited.Id && cpost.PostDeleteAt > 0 && cpost.PostEditAt == edited.EditAt && cpost.PostMessage == edited.Message {
+				foundDeleted = true
+			}
+		}
+
+		if !foundRevision || !foundDeleted {
+			t.Fatal("export should include every revision and deletion")
+		}
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package store
+
+import (
+	"github.com/mattermost/platform/model"
+)
+
+type SqlEmailNotificationStore struct {
+	*SqlStore
+}
+
+func NewSqlEmailNotificationStore(sqlStore *SqlStore) EmailNotificationStore {
+	s := &SqlEmailNotificationStore{sqlStore}
+
+	for _, db := range sqlStore.GetAllConns() {
+		table := db.AddTableWithName(model.EmailNotification{}, "EmailNotifications").SetKeys(false, "Id")
+		table.ColMap("Id").SetMaxSize(26)
+		table.ColMap("UserId").SetMaxSize(26)
+		table.ColMap("TeamId").SetMaxSize(26)
+		table.ColMap("ChannelId").SetMaxSize(26)
+		table.ColMap("PostId").SetMaxSize(26)
+		table.ColMap("TeamName").SetMaxSize(64)
+		table.ColMap("TeamDisplayName").SetMaxSize(64)
+		table.ColMap("ChannelName").SetMaxSize(64)
+		table.ColMap("ChannelType").SetMaxSize(1)
+		table.ColMap("ChannelDisplayName").SetMaxSize(64)
+		table.ColMap("SenderName").SetMaxSize(128)
+		table.ColMap("Message").SetMaxSize(4000)
+		table.ColMap("SiteURL").SetMaxSize(1024)
+	}
+
+	return s
+}
+
+func (s SqlEmailNotificationStore) UpgradeSchemaIfNeeded() {
+	s.CreateColumnIfNotExists("EmailNotifications", "LockedUntil", "bigint(20)", "bigint", "0")
+}
+
+func (s SqlEmailNotificationStore) CreateIndexesIfNotExists() {
+	s.CreateIndexIfNotExists("idx_emailnotifications_user_id", "EmailNotifications", "UserId")
+	s.CreateIndexIfNotExists("idx_emailnotifications_send_at", "EmailNotifications", "SendAt")
+}
+
+func (s SqlEmailNotificationStore) Save(notification *model.EmailNotification) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		if len(notification.Id) > 0 {
+			result.Err = model.NewLocAppError("SqlEmailNotificationStore.Save", "store.sql_email_notification.save.existing.app_error", nil, "id="+notification.Id)
+			storeChannel <- result
+			close(storeChannel)
+			return
+		}
+
+		notification.PreSave()
+		if result.Err = notification.IsValid(); result.Err != nil {
+			storeChannel <- result
+			close(storeChannel)
+			return
+		}
+
+		if err := s.GetMaster().Insert(notification); err != nil {
+			result.Err = model.NewLocAppError("SqlEmailNotificationStore.Save", "store.sql_email_notification.save.app_error", nil, "id="+notification.Id+", "+err.Error())
+		} else {
+			result.Data = notification
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+// GetDueUserIds returns the users with at least one notification that should
+// have been sent by the given time and isn't already being sent.
+func (s SqlEmailNotificationStore) GetDueUserIds(time int64, limit int) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		var userIds []string
+		if _, err := s.GetMaster().Select(&userIds, "SELECT DISTINCT UserId FROM EmailNotifications WHERE SendAt <= :Time AND LockedUntil < :Time LIMIT :Limit",
+			map[string]interface{}{"Time": time, "Limit": limit}); err != nil {
+			result.Err = model.NewLocAppError("SqlEmailNotificationStore.GetDueUserIds", "store.sql_email_notification.get_due_user_ids.app_error", nil, err.Error())
+		} else {
+			result.Data = userIds
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+func (s SqlEmailNotificationStore) GetForUser(userId string) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		var notifications []*model.EmailNotification
+		if _, err := s.GetMaster().Select(&notifications, "SELECT * FROM EmailNotifications WHERE UserId = :UserId ORDER BY CreateAt ASC",
+			map[string]interface{}{"UserId": userId}); err != nil {
+			result.Err = model.NewLocAppError("SqlEmailNotificationStore.GetForUser", "store.sql_email_notification.get_for_user.app_error", nil, "user_id="+userId+", "+err.Error())
+		} else {
+			result.Data = notifications
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+// Claim locks a notification that is about to be sent until leaseUntil. When
+// several app servers race to send the same digest, only the one that locked
+// the notification gets true back. A server that dies while sending leaves the
+// lock to run out so that the notification is sent again later.
+func (s SqlEmailNotificationStore) Claim(id string, leaseUntil int64) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		if sqlResult, err := s.GetMaster().Exec("UPDATE EmailNotifications SET LockedUntil = :LeaseUntil WHERE Id = :Id AND LockedUntil < :Now",
+			map[string]interface{}{"LeaseUntil": leaseUntil, "Id": id, "Now": model.GetMillis()}); err != nil {
+			result.Err = model.NewLocAppError("SqlEmailNotificationStore.Claim", "store.sql_email_notification.claim.app_error", nil, "id="+id+", "+err.Error())
+		} else if rows, err := sqlResult.RowsAffected(); err != nil {
+			result.Err = model.NewLocAppError("SqlEmailNotificationStore.Claim", "store.sql_email_notification.claim.app_error", nil, "id="+id+", "+err.Error())
+		} else {
+			result.Data = rows == 1
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+// Release unlocks a claimed notification without sending it, which is done
+// when the digest couldn't be sent so that it is tried again. Nothing happens
+// if the lease has already been taken over by another server.
+func (s SqlEmailNotificationStore) Release(id string, leaseUntil int64) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		if _, err := s.GetMaster().Exec("UPDATE EmailNotifications SET LockedUntil = 0 WHERE Id = :Id AND LockedUntil = :LeaseUntil",
+			map[string]interface{}{"Id": id, "LeaseUntil": leaseUntil}); err != nil {
+			result.Err = model.NewLocAppError("SqlEmailNotificationStore.Release", "store.sql_email_notification.release.app_error", nil, "id="+id+", "+err.Error())
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+func (s SqlEmailNotificationStore) Delete(id string) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		if _, err := s.GetMaster().Exec("DELETE FROM EmailNotifications WHERE Id = :Id", map[string]interface{}{"Id": id}); err != nil {
+			result.Err = model.NewLocAppError("SqlEmailNotificationStore.Delete", "store.sql_email_notification.delete.app_error", nil, "id="+id+", "+err.Error())
+		} else {
+			result.Data = id
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+func (s SqlEmailNotificationStore) PermanentDeleteByUser(userId string) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		if _, err := s.GetMaster().Exec("DELETE FROM EmailNotifications WHERE UserId = :UserId", map[string]interface{}{"UserId": userId}); err != nil {
+			result.Err = model.NewLocAppError("SqlEmailNotificationStore.PermanentDeleteByUser", "store.sql_email_notification.permanent_delete_by_user.app_error", nil, "user_id="+userId+", "+err.Error())
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
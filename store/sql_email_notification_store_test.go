@@ -0,0 +1,101 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package store
+
+import (
+	"testing"
+
+	"github.com/mattermost/platform/model"
+)
+
+func TestEmailNotificationStore(t *testing.T) {
+	Setup()
+
+	o1 := &model.EmailNotification{}
+	o1.UserId = model.NewId()
+	o1.TeamId = model.NewId()
+	o1.ChannelId = model.NewId()
+	o1.PostId = model.NewId()
+	o1.Message = "a" + model.NewId() + "b"
+	o1.SendAt = 1000
+
+	if err := (<-store.EmailNotification().Save(o1)).Err; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := (<-store.EmailNotification().Save(o1)).Err; err == nil {
+		t.Fatal("shouldn't be able to update from save")
+	}
+
+	o2 := &model.EmailNotification{}
+	o2.UserId = o1.UserId
+	o2.TeamId = o1.TeamId
+	o2.ChannelId = model.NewId()
+	o2.PostId = model.NewId()
+	o2.Message = "a" + model.NewId() + "b"
+	o2.SendAt = model.GetMillis() + 60000
+	Must(store.EmailNotification().Save(o2))
+
+	o3 := &model.EmailNotification{}
+	o3.UserId = model.NewId()
+	o3.TeamId = o1.TeamId
+	o3.ChannelId = o1.ChannelId
+	o3.PostId = model.NewId()
+	o3.SendAt = model.GetMillis() + 60000
+	Must(store.EmailNotification().Save(o3))
+
+	userIds := Must(store.EmailNotification().GetDueUserIds(2000, 1000)).([]string)
+	found := false
+	for _, userId := range userIds {
+		if userId == o3.UserId {
+			t.Fatal("shouldn't have returned a user without anything due")
+		} else if userId == o1.UserId {
+			found = true
+		}
+	}
+
+	if !found {
+		t.Fatal("should have returned the user with a due notification")
+	}
+
+	list := Must(store.EmailNotification().GetForUser(o1.UserId)).([]*model.EmailNotification)
+	if len(list) != 2 || list[0].Id != o1.Id || list[1].Message != o2.Message {
+		t.Fatal("should have returned every notification for the user oldest first")
+	}
+
+	leaseUntil := model.GetMillis() + 60000
+	if !Must(store.EmailNotification().Claim(o1.Id, leaseUntil)).(bool) {
+		t.Fatal("should have claimed the notification")
+	}
+
+	if Must(store.EmailNotification().Claim(o1.Id, leaseUntil)).(bool) {
+		t.Fatal("shouldn't claim a notification twice")
+	}
+
+	for _, userId := range Must(store.EmailNotification().GetDueUserIds(2000, 1000)).([]string) {
+		if userId == o1.UserId {
+			t.Fatal("shouldn't have returned a user whose notifications are being sent")
+		}
+	}
+
+	Must(store.EmailNotification().Release(o1.Id, leaseUntil))
+
+	if !Must(store.EmailNotification().Claim(o1.Id, leaseUntil)).(bool) {
+		t.Fatal("should have claimed the released notification again")
+	}
+
+	Must(store.EmailNotification().Delete(o1.Id))
+
+	if list := Must(store.EmailNotification().GetForUser(o1.UserId)).([]*model.EmailNotification); len(list) != 1 || list[0].Id != o2.Id {
+		t.Fatal("should have deleted the sent notification")
+	}
+
+	Must(store.EmailNotification().PermanentDeleteByUser(o1.UserId))
+
+	if list := Must(store.EmailNotification().GetForUser(o1.UserId)).([]*model.EmailNotification); len(list) != 0 {
+		t.Fatal("should have deleted the user's notifications")
+	}
+
+	Must(store.EmailNotification().PermanentDeleteByUser(o3.UserId))
+}
@@ -0,0 +1,171 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package store
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/mattermost/platform/model"
+)
+
+type SqlFileContentStore struct {
+	*SqlStore
+}
+
+func NewSqlFileContentStore(sqlStore *SqlStore) FileContentStore {
+	s := &SqlFileContentStore{sqlStore}
+
+	for _, db := range sqlStore.GetAllConns() {
+		table := db.AddTableWithName(model.FileContent{}, "FileContent").SetKeys(false, "FileId")
+		table.ColMap("FileId").SetMaxSize(26)
+		table.ColMap("Content").SetMaxSize(model.FILE_CONTENT_MAX_SIZE)
+	}
+
+	return s
+}
+
+func (s SqlFileContentStore) UpgradeSchemaIfNeeded() {
+}
+
+func (s SqlFileContentStore) CreateIndexesIfNotExists() {
+	s.CreateFullTextIndexIfNotExists("idx_filecontent_content_txt", "FileContent", "Content")
+}
+
+func (s SqlFileContentStore) Save(content *model.FileContent) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		content.PreSave()
+		if result.Err = content.IsValid(); result.Err != nil {
+			storeChannel <- result
+			close(storeChannel)
+			return
+		}
+
+		if err := s.GetMaster().Insert(content); err != nil {
+			result.Err = model.NewLocAppError("SqlFileContentStore.Save", "store.sql_file_content.save.app_error", nil, "file_id="+content.FileId+", "+err.Error())
+		} else {
+			result.Data = content
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+func (s SqlFileContentStore) Get(fileId string) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		if obj, err := s.GetReplica().Get(model.FileContent{}, fileId); err != nil {
+			result.Err = model.NewLocAppError("SqlFileContentStore.Get", "store.sql_file_content.get.app_error", nil, "file_id="+fileId+", "+err.Error())
+		} else if obj == nil {
+			result.Err = model.NewLocAppError("SqlFileContentStore.Get", "store.sql_file_content.get.missing.app_error", nil, "file_id="+fileId)
+		} else {
+			result.Data = obj.(*model.FileContent)
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+// SearchPostIds gets the ids of the posts in the user's channels that have
+// attachments matching the file terms and extensions of a search.
+func (s SqlFileContentStore) SearchPostIds(teamId string, userId string, params *model.SearchParams) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		if !params.HasFileFilters() {
+			result.Data = []string{}
+			storeChannel <- result
+			close(storeChannel)
+			return
+		}
+
+		queryParams := map[string]interface{}{
+			"TeamId": teamId,
+			"UserId": userId,
+		}
+
+		query := `
+			SELECT DISTINCT
+				Posts.Id
+			FROM
+				Posts,
+				ChannelMembers,
+				Channels
+			WHERE
+				Posts.ChannelId = Channels.Id
+				AND Channels.Id = ChannelMembers.ChannelId
+				AND Channels.TeamId = :TeamId
+				AND ChannelMembers.UserId = :UserId
+				AND Channels.DeleteAt = 0
+				AND Posts.DeleteAt = 0
+				AND Posts.Id IN (` + fileSearchQuery(params, queryParams) + `)`
+
+		var postIds []string
+		if _, err := s.GetReplica().Select(&postIds, query, queryParams); err != nil {
+			result.Err = model.NewLocAppError("SqlFileContentStore.SearchPostIds", "store.sql_file_content.search.app_error", nil, "teamId="+teamId+", err="+err.Error())
+		} else {
+			result.Data = postIds
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+// fileSearchQuery builds a query for the ids of the posts with attachments that
+// match the file terms and extensions of a search. Its parameters are added to
+// queryParams.
+func fileSearchQuery(params *model.SearchParams, queryParams map[string]interface{}) string {
+	query := `
+		SELECT
+			FileInfo.PostId
+		FROM
+			FileInfo
+		LEFT JOIN
+			FileContent ON FileContent.FileId = FileInfo.Id
+		WHERE
+			FileInfo.PostId != ''
+			AND FileInfo.DeleteAt = 0
+			FILE_FILTER`
+
+	if len(params.Extensions) > 0 {
+		inClause := ""
+		for i, extension := range params.Extensions {
+			paramName := "Extension" + strconv.FormatInt(int64(i), 10)
+			if i > 0 {
+				inClause += ", "
+			}
+			inClause += ":" + paramName
+			queryParams[paramName] = strings.ToLower(extension)
+		}
+
+		query = strings.Replace(query, "FILE_FILTER", "AND LOWER(FileInfo.Extension) IN ("+inClause+") FILE_FILTER", 1)
+	}
+
+	if params.FileTerms != "" {
+		queryParams["FileTerms"] = fullTextSearchTerms(params.FileTerms)
+		query = strings.Replace(query, "FILE_FILTER", fullTextSearchClause("FileContent.Content", "FileTerms"), 1)
+	} else {
+		query = strings.Replace(query, "FILE_FILTER", "", 1)
+	}
+
+	return query
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package store
+
+import (
+	"testing"
+
+	"github.com/mattermost/platform/model"
+)
+
+func TestFileContentStore(t *testing.T) {
+	Setup()
+
+	o1 := &model.FileContent{FileId: model.NewId(), Content: "quarterly budget"}
+	Must(store.FileContent().Save(o1))
+
+	if r := <-store.FileContent().Get(o1.FileId); r.Err != nil {
+		t.Fatal(r.Err)
+	} else if content := r.Data.(*model.FileContent); content.Content != o1.Content || content.CreateAt == 0 {
+		t.Fatal("should have saved the content")
+	}
+
+	if err := (<-store.FileContent().Get(model.NewId())).Err; err == nil {
+		t.Fatal("Missing id should have failed")
+	}
+
+	if err := (<-store.FileContent().Save(&model.FileContent{})).Err; err == nil {
+		t.Fatal("should have failed, no file id")
+	}
+}
+
+func TestFileContentStoreSearch(t *testing.T) {
+	Setup()
+
+	teamId := model.NewId()
+	userId := model.NewId()
+
+	c1 := &model.Channel{}
+	c1.TeamId = teamId
+	c1.DisplayName = "Channel1"
+	c1.Name = "a" + model.NewId() + "b"
+	c1.Type = model.CHANNEL_OPEN
+	c1 = (<-store.Channel().Save(c1)).Data.(*model.Channel)
+
+	m1 := model.ChannelMember{}
+	m1.ChannelId = c1.Id
+	m1.UserId = userId
+	m1.NotifyProps = model.GetDefaultChannelNotifyProps()
+	Must(store.Channel().SaveMember(&m1))
+
+	c2 := &model.Channel{}
+	c2.TeamId = teamId
+	c2.DisplayName = "Channel2"
+	c2.Name = "a" + model.NewId() + "b"
+	c2.Type = model.CHANNEL_OPEN
+	c2 = (<-store.Channel().Save(c2)).Data.(*model.Channel)
+
+	p1 := (<-store.Post().Save(&model.Post{ChannelId: c1.Id, UserId: userId, Message: "the report"})).Data.(*model.Post)
+	p2 := (<-store.Post().Save(&model.Post{ChannelId: c2.Id, UserId: userId, Message: "the report"})).Data.(*model.Post)
+	p3 := (<-store.Post().Save(&model.Post{ChannelId: c1.Id, UserId: userId, Message: "some notes"})).Data.(*model.Post)
+
+	f1 := &model.FileInfo{CreatorId: userId, ChannelId: c1.Id, PostId: p1.Id, Filename: "report.PDF", Extension: "PDF", Path: "a/report.PDF"}
+	f1 = (<-store.FileInfo().Save(f1)).Data.(*model.FileInfo)
+	Must(store.FileContent().Save(&model.FileContent{FileId: f1.Id, Content: "the quarterly budget is attached"}))
+
+	f2 := &model.FileInfo{CreatorId: userId, ChannelId: c2.Id, PostId: p2.Id, Filename: "report.pdf", Extension: "pdf", Path: "a/report.pdf"}
+	f2 = (<-store.FileInfo().Save(f2)).Data.(*model.FileInfo)
+	Must(store.FileContent().Save(&model.FileContent{FileId: f2.Id, Content: "the quarterly budget is attached"}))
+
+	f3 := &model.FileInfo{CreatorId: userId, ChannelId: c1.Id, PostId: p3.Id, Filename: "notes.txt", Extension: "txt", Path: "a/notes.txt"}
+	f3 = (<-store.FileInfo().Save(f3)).Data.(*model.FileInfo)
+	Must(store.FileContent().Save(&model.FileContent{FileId: f3.Id, Content: "budget meeting notes"}))
+
+	search := func(terms string) []string {
+		return (<-store.FileContent().SearchPostIds(teamId, userId, model.ParseSearchParams(terms)[0])).Data.([]string)
+	}
+
+	if ids := search("file:budget"); len(ids) != 2 {
+		t.Fatal("should have found the posts in the user's channels", ids)
+	}
+
+	if ids := search("file:quarterly file:budget"); len(ids) != 1 || ids[0] != p1.Id {
+		t.Fatal("should have matched every term", ids)
+	}
+
+	if ids := search("ext:pdf"); len(ids) != 1 || ids[0] != p1.Id {
+		t.Fatal("should have matched the extension ignoring case", ids)
+	}
+
+	if ids := search("file:budget ext:txt"); len(ids) != 1 || ids[0] != p3.Id {
+		t.Fatal("should have matched the terms and extension of the same file", ids)
+	}
+
+	if ids := search("file:missing"); len(ids) != 0 {
+		t.Fatal("shouldn't have found anything", ids)
+	}
+
+	if r := <-store.Post().Search(teamId, userId, model.ParseSearchParams("report file:budget")[0], 0, 10); r.Err != nil {
+		t.Fatal(r.Err)
+	} else if list := r.Data.(*model.PostList); len(list.Order) != 1 || list.Order[0] != p1.Id {
+		t.Fatal("should have searched the message and attachments", list.Order)
+	}
+
+	if r := <-store.Post().Search(teamId, userId, model.ParseSearchParams("ext:txt")[0], 0, 10); r.Err != nil {
+		t.Fatal(r.Err)
+	} else if list := r.Data.(*model.PostList); len(list.Order) != 1 || list.Order[0] != p3.Id {
+		t.Fatal("should have found posts by the type of their attachments", list.Order)
+	}
+}
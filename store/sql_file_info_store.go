@@ -0,0 +1,326 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package store
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/mattermost/platform/model"
+)
+
+type SqlFileInfoStore struct {
+	*SqlStore
+}
+
+func NewSqlFileInfoStore(sqlStore *SqlStore) FileInfoStore {
+	s := &SqlFileInfoStore{sqlStore}
+
+	for _, db := range sqlStore.GetAllConns() {
+		table := db.AddTableWithName(model.FileInfo{}, "FileInfo").SetKeys(false, "Id")
+		table.ColMap("Id").SetMaxSize(26)
+		table.ColMap("CreatorId").SetMaxSize(26)
+		table.ColMap("ChannelId").SetMaxSize(26)
+		table.ColMap("PostId").SetMaxSize(26)
+		table.ColMap("Path").SetMaxSize(512)
+		table.ColMap("ThumbnailPath").SetMaxSize(512)
+		table.ColMap("PreviewPath").SetMaxSize(512)
+		table.ColMap("Filename").SetMaxSize(256)
+		table.ColMap("Extension").SetMaxSize(64)
+		table.ColMap("MimeType").SetMaxSize(256)
+	}
+
+	return s
+}
+
+func (s SqlFileInfoStore) UpgradeSchemaIfNeeded() {
+}
+
+func (s SqlFileInfoStore) CreateIndexesIfNotExists() {
+	s.CreateIndexIfNotExists("idx_fileinfo_channel_id", "FileInfo", "ChannelId")
+	s.CreateIndexIfNotExists("idx_fileinfo_post_id", "FileInfo", "PostId")
+	s.CreateIndexIfNotExists("idx_fileinfo_create_at", "FileInfo", "CreateAt")
+}
+
+func (s SqlFileInfoStore) Save(info *model.FileInfo) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		info.PreSave()
+		if result.Err = info.IsValid(); result.Err != nil {
+			storeChannel <- result
+			close(storeChannel)
+			return
+		}
+
+		if err := s.GetMaster().Insert(info); err != nil {
+			result.Err = model.NewLocAppError("SqlFileInfoStore.Save", "store.sql_file_info.save.app_error", nil, "id="+info.Id+", "+err.Error())
+		} else {
+			result.Data = info
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+func (s SqlFileInfoStore) Update(info *model.FileInfo) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		info.PreUpdate()
+		if result.Err = info.IsValid(); result.Err != nil {
+			storeChannel <- result
+			close(storeChannel)
+			return
+		}
+
+		if count, err := s.GetMaster().Update(info); err != nil {
+			result.Err = model.NewLocAppError("SqlFileInfoStore.Update", "store.sql_file_info.update.app_error", nil, "id="+info.Id+", "+err.Error())
+		} else if count == 0 {
+			result.Err = model.NewLocAppError("SqlFileInfoStore.Update", "store.sql_file_info.get.missing.app_error", nil, "id="+info.Id)
+		} else {
+			result.Data = info
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+func (s SqlFileInfoStore) Get(id string) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		if obj, err := s.GetReplica().Get(model.FileInfo{}, id); err != nil {
+			result.Err = model.NewLocAppError("SqlFileInfoStore.Get", "store.sql_file_info.get.app_error", nil, "id="+id+", "+err.Error())
+		} else if obj == nil {
+			result.Err = model.NewLocAppError("SqlFileInfoStore.Get", "store.sql_file_info.get.missing.app_error", nil, "id="+id)
+		} else {
+			result.Data = obj.(*model.FileInfo)
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+func (s SqlFileInfoStore) GetForPost(postId string) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		var infos []*model.FileInfo
+		if _, err := s.GetReplica().Select(&infos,
+			`SELECT * FROM FileInfo WHERE PostId = :PostId AND DeleteAt = 0 ORDER BY CreateAt`,
+			map[string]interface{}{"PostId": postId}); err != nil {
+			result.Err = model.NewLocAppError("SqlFileInfoStore.GetForPost", "store.sql_file_info.get_for_post.app_error", nil, "post_id="+postId+", "+err.Error())
+		} else {
+			result.Data = infos
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+// GetForChannel gets the files that have been posted in a channel, newest
+// first. Files that have been uploaded but not posted yet are left out.
+func (s SqlFileInfoStore) GetForChannel(channelId string, offset int, limit int) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		var infos []*model.FileInfo
+		if _, err := s.GetReplica().Select(&infos,
+			`SELECT
+				*
+			FROM
+				FileInfo
+			WHERE
+				ChannelId = :ChannelId
+				AND PostId != ''
+				AND DeleteAt = 0
+			ORDER BY CreateAt DESC
+			LIMIT :Limit OFFSET :Offset`,
+			map[string]interface{}{"ChannelId": channelId, "Offset": offset, "Limit": limit}); err != nil {
+			result.Err = model.NewLocAppError("SqlFileInfoStore.GetForChannel", "store.sql_file_info.get_for_channel.app_error", nil, "channel_id="+channelId+", "+err.Error())
+		} else {
+			result.Data = infos
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+// Search finds the files in the user's channels on the team whose names contain
+// every one of the terms. Files that haven't been posted yet are only found by
+// the user who uploaded them.
+func (s SqlFileInfoStore) Search(teamId string, userId string, terms string, offset int, limit int) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		queryParams := map[string]interface{}{
+			"TeamId": teamId,
+			"UserId": userId,
+			"Offset": offset,
+			"Limit":  limit,
+		}
+
+		searchClause := ""
+		for i, term := range strings.Fields(strings.ToLower(terms)) {
+			// the wildcards in LIKE need escaping so that they're matched literally
+			term = strings.Replace(term, "\\", "\\\\", -1)
+			term = strings.Replace(term, "%", "\\%", -1)
+			term = strings.Replace(term, "_", "\\_", -1)
+
+			paramName := "Term" + strconv.Itoa(i)
+			searchClause += " AND LOWER(FileInfo.Filename) LIKE :" + paramName
+			queryParams[paramName] = "%" + term + "%"
+		}
+
+		if len(searchClause) == 0 {
+			result.Data = []*model.FileInfo{}
+			storeChannel <- result
+			close(storeChannel)
+			return
+		}
+
+		var infos []*model.FileInfo
+		if _, err := s.GetReplica().Select(&infos,
+			`SELECT
+				FileInfo.*
+			FROM
+				FileInfo,
+				Channels,
+				ChannelMembers
+			WHERE
+				FileInfo.ChannelId = Channels.Id
+				AND Channels.Id = ChannelMembers.ChannelId
+				AND Channels.TeamId = :TeamId
+				AND Channels.DeleteAt = 0
+				AND ChannelMembers.UserId = :UserId
+				AND FileInfo.DeleteAt = 0
+				AND (FileInfo.PostId != '' OR FileInfo.CreatorId = :UserId)`+searchClause+`
+			ORDER BY FileInfo.CreateAt DESC
+			LIMIT :Limit OFFSET :Offset`, queryParams); err != nil {
+			result.Err = model.NewLocAppError("SqlFileInfoStore.Search", "store.sql_file_info.search.app_error", nil, "terms="+terms+", "+err.Error())
+		} else {
+			result.Data = infos
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+// AttachToPost marks the files as belonging to a post. Only files that were
+// uploaded to the post's channel by its author and aren't already part of a
+// post are changed.
+func (s SqlFileInfoStore) AttachToPost(fileIds []string, postId string, channelId string, creatorId string) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		if len(fileIds) == 0 {
+			storeChannel <- result
+			close(storeChannel)
+			return
+		}
+
+		queryParams := map[string]interface{}{
+			"PostId":    postId,
+			"ChannelId": channelId,
+			"CreatorId": creatorId,
+			"UpdateAt":  model.GetMillis(),
+		}
+
+		inClause := ":FileId0"
+		queryParams["FileId0"] = fileIds[0]
+
+		for i := 1; i < len(fileIds); i++ {
+			paramName := "FileId" + strconv.Itoa(i)
+			inClause += ", :" + paramName
+			queryParams[paramName] = fileIds[i]
+		}
+
+		if _, err := s.GetMaster().Exec(
+			`UPDATE
+				FileInfo
+			SET
+				PostId = :PostId, UpdateAt = :UpdateAt
+			WHERE
+				Id IN (`+inClause+`)
+				AND ChannelId = :ChannelId
+				AND CreatorId = :CreatorId
+				AND PostId = ''`, queryParams); err != nil {
+			result.Err = model.NewLocAppError("SqlFileInfoStore.AttachToPost", "store.sql_file_info.attach_to_post.app_error", nil, "post_id="+postId+", "+err.Error())
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+// SetPreviewInfo records the size of an image, where the thumbnail and preview
+// drawn of a file were written and whether it should be shown with its preview
+// once they've been made. Only those columns are touched so that
+// the file can be attached to a post in the meantime.
+func (s SqlFileInfoStore) SetPreviewInfo(id string, width int, height int, thumbnailPath string, previewPath string, hasPreviewImage bool) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		if _, err := s.GetMaster().Exec(
+			`UPDATE
+				FileInfo
+			SET
+				Width = :Width, Height = :Height, ThumbnailPath = :ThumbnailPath, PreviewPath = :PreviewPath, HasPreviewImage = :HasPreviewImage, UpdateAt = :UpdateAt
+			WHERE
+				Id = :Id`,
+			map[string]interface{}{
+				"Id":              id,
+				"Width":           width,
+				"Height":          height,
+				"ThumbnailPath":   thumbnailPath,
+				"PreviewPath":     previewPath,
+				"HasPreviewImage": hasPreviewImage,
+				"UpdateAt":        model.GetMillis(),
+			}); err != nil {
+			result.Err = model.NewLocAppError("SqlFileInfoStore.SetPreviewInfo", "store.sql_file_info.set_preview_info.app_error", nil, "id="+id+", "+err.Error())
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
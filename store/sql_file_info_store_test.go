@@ -0,0 +1,122 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package store
+
+import (
+	"testing"
+
+	"github.com/mattermost/platform/model"
+)
+
+func TestFileInfoStore(t *testing.T) {
+	Setup()
+
+	o1 := &model.FileInfo{}
+	o1.CreatorId = model.NewId()
+	o1.ChannelId = model.NewId()
+	o1.Filename = "report.pdf"
+	o1.Path = "teams/a/channels/b/users/c/d/report.pdf"
+	o1.Size = 1000
+	o1 = (<-store.FileInfo().Save(o1)).Data.(*model.FileInfo)
+
+	Must(store.FileInfo().SetPreviewInfo(o1.Id, 10, 20, "thumb.jpg", "preview.jpg", true))
+
+	if r := <-store.FileInfo().Get(o1.Id); r.Err != nil {
+		t.Fatal(r.Err)
+	} else if info := r.Data.(*model.FileInfo); info.Filename != o1.Filename || info.Width != 10 || info.Height != 20 || info.ThumbnailPath != "thumb.jpg" || info.PreviewPath != "preview.jpg" || !info.HasPreviewImage {
+		t.Fatal("should have saved the preview info")
+	}
+
+	if err := (<-store.FileInfo().Get("123")).Err; err == nil {
+		t.Fatal("Missing id should have failed")
+	}
+
+	postId := model.NewId()
+	Must(store.FileInfo().AttachToPost([]string{o1.Id}, postId, o1.ChannelId, model.NewId()))
+
+	if infos := (<-store.FileInfo().GetForPost(postId)).Data.([]*model.FileInfo); len(infos) != 0 {
+		t.Fatal("shouldn't attach a file uploaded by someone else")
+	}
+
+	Must(store.FileInfo().AttachToPost([]string{o1.Id}, postId, model.NewId(), o1.CreatorId))
+
+	if infos := (<-store.FileInfo().GetForPost(postId)).Data.([]*model.FileInfo); len(infos) != 0 {
+		t.Fatal("shouldn't attach a file uploaded to another channel")
+	}
+
+	Must(store.FileInfo().AttachToPost([]string{o1.Id}, postId, o1.ChannelId, o1.CreatorId))
+
+	if infos := (<-store.FileInfo().GetForPost(postId)).Data.([]*model.FileInfo); len(infos) != 1 || infos[0].Id != o1.Id {
+		t.Fatal("should have attached the file")
+	}
+
+	Must(store.FileInfo().AttachToPost([]string{o1.Id}, model.NewId(), o1.ChannelId, o1.CreatorId))
+
+	if infos := (<-store.FileInfo().GetForPost(postId)).Data.([]*model.FileInfo); len(infos) != 1 {
+		t.Fatal("shouldn't move a file to another post")
+	}
+
+	if infos := (<-store.FileInfo().GetForChannel(o1.ChannelId, 0, 10)).Data.([]*model.FileInfo); len(infos) != 1 {
+		t.Fatal("should have found the file in the channel")
+	}
+
+	o1.DeleteAt = model.GetMillis()
+	Must(store.FileInfo().Update(o1))
+
+	if infos := (<-store.FileInfo().GetForChannel(o1.ChannelId, 0, 10)).Data.([]*model.FileInfo); len(infos) != 0 {
+		t.Fatal("shouldn't list deleted files")
+	}
+}
+
+func TestFileInfoStoreSearch(t *testing.T) {
+	Setup()
+
+	teamId := model.NewId()
+	userId := model.NewId()
+
+	c1 := &model.Channel{}
+	c1.TeamId = teamId
+	c1.DisplayName = "Channel1"
+	c1.Name = "a" + model.NewId() + "b"
+	c1.Type = model.CHANNEL_OPEN
+	c1 = (<-store.Channel().Save(c1)).Data.(*model.Channel)
+
+	m1 := model.ChannelMember{}
+	m1.ChannelId = c1.Id
+	m1.UserId = userId
+	m1.NotifyProps = model.GetDefaultChannelNotifyProps()
+	Must(store.Channel().SaveMember(&m1))
+
+	c2 := &model.Channel{}
+	c2.TeamId = teamId
+	c2.DisplayName = "Channel2"
+	c2.Name = "a" + model.NewId() + "b"
+	c2.Type = model.CHANNEL_OPEN
+	c2 = (<-store.Channel().Save(c2)).Data.(*model.Channel)
+
+	o1 := &model.FileInfo{CreatorId: model.NewId(), ChannelId: c1.Id, PostId: model.NewId(), Filename: "Quarterly Report.pdf", Path: "a/Quarterly Report.pdf"}
+	o1 = (<-store.FileInfo().Save(o1)).Data.(*model.FileInfo)
+
+	o2 := &model.FileInfo{CreatorId: model.NewId(), ChannelId: c2.Id, PostId: model.NewId(), Filename: "quarterly_report.pdf", Path: "a/quarterly_report.pdf"}
+	Must(store.FileInfo().Save(o2))
+
+	o3 := &model.FileInfo{CreatorId: model.NewId(), ChannelId: c1.Id, Filename: "quarterly draft.pdf", Path: "a/quarterly draft.pdf"}
+	Must(store.FileInfo().Save(o3))
+
+	if infos := (<-store.FileInfo().Search(teamId, userId, "quarterly", 0, 10)).Data.([]*model.FileInfo); len(infos) != 1 || infos[0].Id != o1.Id {
+		t.Fatal("should only find posted files in the user's channels")
+	}
+
+	if infos := (<-store.FileInfo().Search(teamId, userId, "REPORT quarterly", 0, 10)).Data.([]*model.FileInfo); len(infos) != 1 {
+		t.Fatal("should have matched every term")
+	}
+
+	if infos := (<-store.FileInfo().Search(teamId, userId, "y_r", 0, 10)).Data.([]*model.FileInfo); len(infos) != 0 {
+		t.Fatal("underscore should have been matched literally")
+	}
+
+	if infos := (<-store.FileInfo().Search(teamId, userId, "", 0, 10)).Data.([]*model.FileInfo); len(infos) != 0 {
+		t.Fatal("shouldn't find anything without any terms")
+	}
+}
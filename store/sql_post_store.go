@@ -9,6 +9,7 @@ import (
 	"strconv"
 	"strings"
 
+	l4g "github.com/alecthomas/log4go"
 	"github.com/mattermost/platform/model"
 	"github.com/mattermost/platform/utils"
 )
@@ -38,6 +39,13 @@ func NewSqlPostStore(sqlStore *SqlStore) PostStore {
 }
 
 func (s SqlPostStore) UpgradeSchemaIfNeeded() {
+	replyCountCreated := s.CreateColumnIfNotExists("Posts", "ReplyCount", "bigint(20)", "bigint", "0")
+	lastReplyAtCreated := s.CreateColumnIfNotExists("Posts", "LastReplyAt", "bigint(20)", "bigint", "0")
+	if replyCountCreated || lastReplyAtCreated {
+		s.backfillReplyCounts()
+	}
+	s.CreateColumnIfNotExists("Posts", "IsPinned", "tinyint(1)", "boolean", "0")
+	s.CreateColumnIfNotExists("Posts", "EditAt", "bigint(20)", "bigint", "0")
 }
 
 func (s SqlPostStore) CreateIndexesIfNotExists() {
@@ -45,6 +53,9 @@ func (s SqlPostStore) CreateIndexesIfNotExists() {
 	s.CreateIndexIfNotExists("idx_posts_create_at", "Posts", "CreateAt")
 	s.CreateIndexIfNotExists("idx_posts_channel_id", "Posts", "ChannelId")
 	s.CreateIndexIfNotExists("idx_posts_root_id", "Posts", "RootId")
+	s.CreateIndexIfNotExists("idx_posts_original_id", "Posts", "OriginalId")
+	s.CreateIndexIfNotExists("idx_posts_edit_at", "Posts", "EditAt")
+	s.CreateIndexIfNotExists("idx_posts_delete_at", "Posts", "DeleteAt")
 
 	s.CreateFullTextIndexIfNotExists("idx_posts_message_txt", "Posts", "Message")
 	s.CreateFullTextIndexIfNotExists("idx_posts_hashtags_txt", "Posts", "Hashtags")
@@ -84,7 +95,7 @@ func (s SqlPostStore) Save(post *model.Post) StoreChannel {
 			}
 
 			if len(post.RootId) > 0 {
-				s.GetMaster().Exec("UPDATE Posts SET UpdateAt = :UpdateAt WHERE Id = :RootId", map[string]interface{}{"UpdateAt": time, "RootId": post.RootId})
+				s.GetMaster().Exec("UPDATE Posts SET UpdateAt = :UpdateAt, ReplyCount = ReplyCount + 1, LastReplyAt = :LastReplyAt WHERE Id = :RootId", map[string]interface{}{"UpdateAt": time, "LastReplyAt": post.CreateAt, "RootId": post.RootId})
 			}
 
 			result.Data = post
@@ -98,15 +109,25 @@ func (s SqlPostStore) Save(post *model.Post) StoreChannel {
 }
 
 func (s SqlPostStore) Update(oldPost *model.Post, newMessage string, newHashtags string) StoreChannel {
+	return s.UpdateWithProps(oldPost, newMessage, newHashtags, oldPost.Props)
+}
+
+// UpdateWithProps edits a post like Update but also replaces its props. The
+// previous revision keeps the old props.
+func (s SqlPostStore) UpdateWithProps(oldPost *model.Post, newMessage string, newHashtags string, newProps model.StringInterface) StoreChannel {
 	storeChannel := make(StoreChannel)
 
 	go func() {
 		result := StoreResult{}
 
+		oldUpdateAt := oldPost.UpdateAt
+
 		editPost := *oldPost
 		editPost.Message = newMessage
 		editPost.UpdateAt = model.GetMillis()
+		editPost.EditAt = editPost.UpdateAt
 		editPost.Hashtags = newHashtags
+		editPost.Props = newProps
 
 		oldPost.DeleteAt = editPost.UpdateAt
 		oldPost.UpdateAt = editPost.UpdateAt
@@ -119,8 +140,29 @@ func (s SqlPostStore) Update(oldPost *model.Post, newMessage string, newHashtags
 			return
 		}
 
-		if _, err := s.GetMaster().Update(&editPost); err != nil {
+		// keep the previous revision as a deleted post pointing back at the
+		// edited one so the edit history is never lost. Both are written in one
+		// transaction and the edit only applies if the post hasn't changed since
+		// it was read, so a failed or concurrent edit leaves no revision behind.
+		// Only the edited fields are written so that the reply count isn't
+		// overwritten.
+		if transaction, err := s.GetMaster().Begin(); err != nil {
+			result.Err = model.NewLocAppError("SqlPostStore.Update", "store.sql_post.update.open_transaction.app_error", nil, "id="+editPost.Id+", "+err.Error())
+		} else if err := transaction.Insert(oldPost); err != nil {
+			transaction.Rollback()
+			result.Err = model.NewLocAppError("SqlPostStore.Update", "store.sql_post.update.revision.app_error", nil, "id="+editPost.Id+", "+err.Error())
+		} else if sqlResult, err := transaction.Exec("UPDATE Posts SET Message = :Message, Hashtags = :Hashtags, Props = :Props, EditAt = :EditAt, UpdateAt = :UpdateAt WHERE Id = :Id AND DeleteAt = 0 AND UpdateAt = :OldUpdateAt",
+			map[string]interface{}{"Message": editPost.Message, "Hashtags": editPost.Hashtags, "Props": model.StringInterfaceToJson(editPost.Props), "EditAt": editPost.EditAt, "UpdateAt": editPost.UpdateAt, "Id": editPost.Id, "OldUpdateAt": oldUpdateAt}); err != nil {
+			transaction.Rollback()
 			result.Err = model.NewLocAppError("SqlPostStore.Update", "store.sql_post.update.app_error", nil, "id="+editPost.Id+", "+err.Error())
+		} else if rows, err := sqlResult.RowsAffected(); err != nil {
+			transaction.Rollback()
+			result.Err = model.NewLocAppError("SqlPostStore.Update", "store.sql_post.update.app_error", nil, "id="+editPost.Id+", "+err.Error())
+		} else if rows != 1 {
+			transaction.Rollback()
+			result.Err = model.NewLocAppError("SqlPostStore.Update", "store.sql_post.update.changed.app_error", nil, "id="+editPost.Id)
+		} else if err := transaction.Commit(); err != nil {
+			result.Err = model.NewLocAppError("SqlPostStore.Update", "store.sql_post.update.commit_transaction.app_error", nil, "id="+editPost.Id+", "+err.Error())
 		} else {
 			time := model.GetMillis()
 			s.GetMaster().Exec("UPDATE Channels SET LastPostAt = :LastPostAt  WHERE Id = :ChannelId", map[string]interface{}{"LastPostAt": time, "ChannelId": editPost.ChannelId})
@@ -129,9 +171,6 @@ func (s SqlPostStore) Update(oldPost *model.Post, newMessage string, newHashtags
 				s.GetMaster().Exec("UPDATE Posts SET UpdateAt = :UpdateAt WHERE Id = :RootId", map[string]interface{}{"UpdateAt": time, "RootId": editPost.RootId})
 			}
 
-			// mark the old post as deleted
-			s.GetMaster().Insert(oldPost)
-
 			result.Data = &editPost
 		}
 
@@ -215,9 +254,241 @@ func (s SqlPostStore) Delete(postId string, time int64) StoreChannel {
 	go func() {
 		result := StoreResult{}
 
-		_, err := s.GetMaster().Exec("Update Posts SET DeleteAt = :DeleteAt, UpdateAt = :UpdateAt WHERE Id = :Id OR ParentId = :ParentId OR RootId = :RootId", map[string]interface{}{"DeleteAt": time, "UpdateAt": time, "Id": postId, "ParentId": postId, "RootId": postId})
+		rootId, _ := s.GetMaster().SelectStr("SELECT RootId FROM Posts WHERE Id = :Id AND DeleteAt = 0", map[string]interface{}{"Id": postId})
+
+		// posts that are already deleted, including earlier revisions, keep the time they were deleted at
+		_, err := s.GetMaster().Exec("Update Posts SET DeleteAt = :DeleteAt, UpdateAt = :UpdateAt WHERE (Id = :Id OR ParentId = :ParentId OR RootId = :RootId) AND DeleteAt = 0", map[string]interface{}{"DeleteAt": time, "UpdateAt": time, "Id": postId, "ParentId": postId, "RootId": postId})
 		if err != nil {
 			result.Err = model.NewLocAppError("SqlPostStore.Delete", "store.sql_post.delete.app_error", nil, "id="+postId+", err="+err.Error())
+		} else if len(rootId) > 0 {
+			s.updateReplyCount(rootId)
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+// backfillReplyCounts sets the reply counts of the threads that were posted
+// before the columns existed.
+func (s SqlPostStore) backfillReplyCounts() {
+	replies := `
+		SELECT
+			RootId, COUNT(*) AS ReplyCount, MAX(CreateAt) AS LastReplyAt
+		FROM
+			Posts
+		WHERE
+			RootId != ''
+				AND DeleteAt = 0
+		GROUP BY RootId`
+
+	var query string
+	if utils.Cfg.SqlSettings.DriverName == model.DATABASE_DRIVER_POSTGRES {
+		query = "UPDATE Posts SET ReplyCount = Replies.ReplyCount, LastReplyAt = Replies.LastReplyAt FROM (" + replies + ") AS Replies WHERE Posts.Id = Replies.RootId"
+	} else {
+		query = "UPDATE Posts INNER JOIN (" + replies + ") AS Replies ON Posts.Id = Replies.RootId SET Posts.ReplyCount = Replies.ReplyCount, Posts.LastReplyAt = Replies.LastReplyAt"
+	}
+
+	if _, err := s.GetMaster().Exec(query); err != nil {
+		l4g.Error(utils.T("store.sql_post.backfill_reply_counts.error"), err)
+	}
+}
+
+type replyStats struct {
+	ReplyCount  int64
+	LastReplyAt int64
+}
+
+func (s SqlPostStore) updateReplyCount(rootId string) {
+	var stats replyStats
+	if err := s.GetMaster().SelectOne(&stats, "SELECT COUNT(*) AS ReplyCount, COALESCE(MAX(CreateAt), 0) AS LastReplyAt FROM Posts WHERE RootId = :RootId AND DeleteAt = 0", map[string]interface{}{"RootId": rootId}); err != nil {
+		return
+	}
+
+	s.GetMaster().Exec("UPDATE Posts SET ReplyCount = :ReplyCount, LastReplyAt = :LastReplyAt WHERE Id = :RootId", map[string]interface{}{"ReplyCount": stats.ReplyCount, "LastReplyAt": stats.LastReplyAt, "RootId": rootId})
+}
+
+func (s SqlPostStore) GetThread(rootId string) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		var posts []*model.Post
+		_, err := s.GetReplica().Select(&posts, "SELECT * FROM Posts WHERE (Id = :Id OR RootId = :RootId) AND DeleteAt = 0 ORDER BY CreateAt DESC", map[string]interface{}{"Id": rootId, "RootId": rootId})
+		if err != nil {
+			result.Err = model.NewLocAppError("SqlPostStore.GetThread", "store.sql_post.get_thread.app_error", nil, "root_id="+rootId+", err="+err.Error())
+		} else if len(posts) == 0 {
+			result.Err = model.NewLocAppError("SqlPostStore.GetThread", "store.sql_post.get_thread.missing.app_error", nil, "root_id="+rootId)
+		} else {
+			list := &model.PostList{Order: make([]string, 0, len(posts))}
+
+			for _, p := range posts {
+				list.AddPost(p)
+				list.AddOrder(p.Id)
+			}
+
+			list.MakeNonNil()
+
+			result.Data = list
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+func (s SqlPostStore) GetEditHistory(postId string) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		var revisions []*model.Post
+		if _, err := s.GetReplica().Select(&revisions, "SELECT * FROM Posts WHERE OriginalId = :OriginalId ORDER BY UpdateAt DESC",
+			map[string]interface{}{"OriginalId": postId}); err != nil {
+			result.Err = model.NewLocAppError("SqlPostStore.GetEditHistory", "store.sql_post.get_edit_history.app_error", nil, "id="+postId+", "+err.Error())
+		} else {
+			for _, revision := range revisions {
+				revision.MakeNonNil()
+			}
+
+			result.Data = revisions
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+func (s SqlPostStore) UpdatePinned(post *model.Post, pinned bool) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		time := model.GetMillis()
+
+		if _, err := s.GetMaster().Exec("UPDATE Posts SET IsPinned = :IsPinned, UpdateAt = :UpdateAt WHERE Id = :Id AND DeleteAt = 0",
+			map[string]interface{}{"IsPinned": pinned, "UpdateAt": time, "Id": post.Id}); err != nil {
+			result.Err = model.NewLocAppError("SqlPostStore.UpdatePinned", "store.sql_post.update_pinned.app_error", nil, "id="+post.Id+", "+err.Error())
+		} else {
+			// the pinned post count is part of the channel's extra info
+			s.GetMaster().Exec("UPDATE Channels SET ExtraUpdateAt = :Time WHERE Id = :ChannelId", map[string]interface{}{"Time": time, "ChannelId": post.ChannelId})
+
+			post.IsPinned = pinned
+			post.UpdateAt = time
+			result.Data = post
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+func (s SqlPostStore) GetPinnedPosts(channelId string) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		var posts []*model.Post
+		if _, err := s.GetReplica().Select(&posts, "SELECT * FROM Posts WHERE ChannelId = :ChannelId AND IsPinned = :IsPinned AND DeleteAt = 0 ORDER BY CreateAt DESC",
+			map[string]interface{}{"ChannelId": channelId, "IsPinned": true}); err != nil {
+			result.Err = model.NewLocAppError("SqlPostStore.GetPinnedPosts", "store.sql_post.get_pinned_posts.app_error", nil, "channelId="+channelId+", "+err.Error())
+		} else {
+			list := &model.PostList{Order: make([]string, 0, len(posts))}
+
+			for _, p := range posts {
+				list.AddPost(p)
+				list.AddOrder(p.Id)
+			}
+
+			list.MakeNonNil()
+
+			result.Data = list
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+func (s SqlPostStore) GetPinnedPostCount(channelId string) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		if count, err := s.GetReplica().SelectInt("SELECT COUNT(*) FROM Posts WHERE ChannelId = :ChannelId AND IsPinned = :IsPinned AND DeleteAt = 0",
+			map[string]interface{}{"ChannelId": channelId, "IsPinned": true}); err != nil {
+			result.Err = model.NewLocAppError("SqlPostStore.GetPinnedPostCount", "store.sql_post.get_pinned_post_count.app_error", nil, "channelId="+channelId+", "+err.Error())
+		} else {
+			result.Data = count
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+func (s SqlPostStore) GetFlaggedPosts(teamId string, userId string, offset int, limit int) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		var posts []*model.Post
+		_, err := s.GetReplica().Select(&posts,
+			`SELECT
+			    Posts.*
+			FROM
+			    Posts,
+			    Preferences
+			WHERE
+			    Preferences.UserId = :UserId
+			        AND Preferences.Category = :Category
+			        AND Preferences.Name = Posts.Id
+			        AND Posts.DeleteAt = 0
+			        AND Posts.ChannelId IN (
+			            SELECT
+			                Id
+			            FROM
+			                Channels,
+			                ChannelMembers
+			            WHERE
+			                Id = ChannelId
+			                    AND TeamId = :TeamId
+			                    AND UserId = :UserId
+			                    AND DeleteAt = 0)
+			ORDER BY Posts.CreateAt DESC
+			LIMIT :Limit OFFSET :Offset`,
+			map[string]interface{}{"UserId": userId, "TeamId": teamId, "Category": model.PREFERENCE_CATEGORY_FLAGGED_POST, "Limit": limit, "Offset": offset})
+		if err != nil {
+			result.Err = model.NewLocAppError("SqlPostStore.GetFlaggedPosts", "store.sql_post.get_flagged_posts.app_error", nil, "userId="+userId+", "+err.Error())
+		} else {
+			list := &model.PostList{Order: make([]string, 0, len(posts))}
+
+			for _, p := range posts {
+				list.AddPost(p)
+				list.AddOrder(p.Id)
+			}
+
+			list.MakeNonNil()
+
+			result.Data = list
 		}
 
 		storeChannel <- result
@@ -589,6 +860,43 @@ func (s SqlPostStore) getParentsPosts(channelId string, offset int, limit int) S
 	return storeChannel
 }
 
+// fullTextSearchClause matches a column against the search terms in the
+// parameter with the given name.
+func fullTextSearchClause(column string, paramName string) string {
+	if utils.Cfg.SqlSettings.DriverName == model.DATABASE_DRIVER_POSTGRES {
+		return fmt.Sprintf("AND %s @@  to_tsquery(:%s)", column, paramName)
+	}
+
+	return fmt.Sprintf("AND MATCH (%s) AGAINST (:%s IN BOOLEAN MODE)", column, paramName)
+}
+
+// fullTextSearchTerms converts search terms into the form that the database's
+// full text search expects where every term has to match.
+func fullTextSearchTerms(terms string) string {
+	// these chars have speical meaning and can be treated as spaces
+	for _, c := range specialSearchChar {
+		terms = strings.Replace(terms, c, " ", -1)
+	}
+
+	if utils.Cfg.SqlSettings.DriverName == model.DATABASE_DRIVER_POSTGRES {
+		// Parse text for wildcards
+		if wildcard, err := regexp.Compile("\\*($| )"); err == nil {
+			terms = wildcard.ReplaceAllLiteralString(terms, ":* ")
+		}
+
+		terms = strings.Join(strings.Fields(terms), " & ")
+	} else if utils.Cfg.SqlSettings.DriverName == model.DATABASE_DRIVER_MYSQL {
+		splitTerms := strings.Fields(terms)
+		for i, t := range strings.Fields(terms) {
+			splitTerms[i] = "+" + t
+		}
+
+		terms = strings.Join(splitTerms, " ")
+	}
+
+	return terms
+}
+
 var specialSearchChar = []string{
 	"<",
 	">",
@@ -600,7 +908,7 @@ var specialSearchChar = []string{
 	"@",
 }
 
-func (s SqlPostStore) Search(teamId string, userId string, params *model.SearchParams) StoreChannel {
+func (s SqlPostStore) Search(teamId string, userId string, params *model.SearchParams, offset int, limit int) StoreChannel {
 	storeChannel := make(StoreChannel)
 
 	go func() {
@@ -609,14 +917,19 @@ func (s SqlPostStore) Search(teamId string, userId string, params *model.SearchP
 		queryParams := map[string]interface{}{
 			"TeamId": teamId,
 			"UserId": userId,
+			"Offset": offset,
+			"Limit":  limit,
 		}
 
 		termMap := map[string]bool{}
 		terms := params.Terms
 
-		if terms == "" && len(params.InChannels) == 0 && len(params.FromUsers) == 0 {
-			result.Data = []*model.Post{}
+		if terms == "" && !params.HasFilters() {
+			list := &model.PostList{}
+			list.MakeNonNil()
+			result.Data = list
 			storeChannel <- result
+			close(storeChannel)
 			return
 		}
 
@@ -628,11 +941,6 @@ func (s SqlPostStore) Search(teamId string, userId string, params *model.SearchP
 			}
 		}
 
-		// these chars have speical meaning and can be treated as spaces
-		for _, c := range specialSearchChar {
-			terms = strings.Replace(terms, c, " ", -1)
-		}
-
 		var posts []*model.Post
 
 		searchQuery := `
@@ -658,7 +966,23 @@ func (s SqlPostStore) Search(teamId string, userId string, params *model.SearchP
 							CHANNEL_FILTER)
 				SEARCH_CLAUSE
 				ORDER BY CreateAt DESC
-			LIMIT 100`
+			LIMIT :Limit OFFSET :Offset`
+
+		if start, end := params.GetTimeRange(); start > 0 && end > 0 {
+			queryParams["StartTime"] = start
+			queryParams["EndTime"] = end
+			searchQuery = strings.Replace(searchQuery, "POST_FILTER", "AND CreateAt >= :StartTime AND CreateAt < :EndTime POST_FILTER", 1)
+		} else if start > 0 {
+			queryParams["StartTime"] = start
+			searchQuery = strings.Replace(searchQuery, "POST_FILTER", "AND CreateAt >= :StartTime POST_FILTER", 1)
+		} else if end > 0 {
+			queryParams["EndTime"] = end
+			searchQuery = strings.Replace(searchQuery, "POST_FILTER", "AND CreateAt < :EndTime POST_FILTER", 1)
+		}
+
+		if params.HasFileFilters() {
+			searchQuery = strings.Replace(searchQuery, "POST_FILTER", "AND Id IN ("+fileSearchQuery(params, queryParams)+") POST_FILTER", 1)
+		}
 
 		if len(params.InChannels) > 1 {
 			inClause := ":InChannel0"
@@ -715,26 +1039,9 @@ func (s SqlPostStore) Search(teamId string, userId string, params *model.SearchP
 		if terms == "" {
 			// we've already confirmed that we have a channel or user to search for
 			searchQuery = strings.Replace(searchQuery, "SEARCH_CLAUSE", "", 1)
-		} else if utils.Cfg.SqlSettings.DriverName == model.DATABASE_DRIVER_POSTGRES {
-			// Parse text for wildcards
-			if wildcard, err := regexp.Compile("\\*($| )"); err == nil {
-				terms = wildcard.ReplaceAllLiteralString(terms, ":* ")
-			}
-
-			terms = strings.Join(strings.Fields(terms), " & ")
-
-			searchClause := fmt.Sprintf("AND %s @@  to_tsquery(:Terms)", searchType)
-			searchQuery = strings.Replace(searchQuery, "SEARCH_CLAUSE", searchClause, 1)
-		} else if utils.Cfg.SqlSettings.DriverName == model.DATABASE_DRIVER_MYSQL {
-			searchClause := fmt.Sprintf("AND MATCH (%s) AGAINST (:Terms IN BOOLEAN MODE)", searchType)
-			searchQuery = strings.Replace(searchQuery, "SEARCH_CLAUSE", searchClause, 1)
-
-			splitTerms := strings.Fields(terms)
-			for i, t := range strings.Fields(terms) {
-				splitTerms[i] = "+" + t
-			}
-
-			terms = strings.Join(splitTerms, " ")
+		} else {
+			searchQuery = strings.Replace(searchQuery, "SEARCH_CLAUSE", fullTextSearchClause(searchType, "Terms"), 1)
+			terms = fullTextSearchTerms(terms)
 		}
 
 		queryParams["Terms"] = terms
@@ -747,7 +1054,7 @@ func (s SqlPostStore) Search(teamId string, userId string, params *model.SearchP
 		list := &model.PostList{Order: make([]string, 0, len(posts))}
 
 		for _, p := range posts {
-			if searchType == "Hashtags" {
+			if searchType == "Hashtags" && len(params.Terms) > 0 {
 				exactMatch := false
 				for _, tag := range strings.Split(p.Hashtags, " ") {
 					if termMap[strings.ToUpper(tag)] {
@@ -773,6 +1080,85 @@ func (s SqlPostStore) Search(teamId string, userId string, params *model.SearchP
 	return storeChannel
 }
 
+func (s SqlPostStore) GetPostsByIds(postIds []string) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		posts := []*model.Post{}
+
+		if len(postIds) > 0 {
+			params := map[string]interface{}{}
+			inClause := ""
+			for i, postId := range postIds {
+				paramName := "PostId" + strconv.Itoa(i)
+				if i > 0 {
+					inClause += ", "
+				}
+				inClause += ":" + paramName
+				params[paramName] = postId
+			}
+
+			if _, err := s.GetReplica().Select(&posts, "SELECT * FROM Posts WHERE Id IN ("+inClause+") AND DeleteAt = 0", params); err != nil {
+				result.Err = model.NewLocAppError("SqlPostStore.GetPostsByIds", "store.sql_post.get_posts_by_ids.app_error", nil, err.Error())
+			}
+		}
+
+		if result.Err == nil {
+			for _, post := range posts {
+				post.MakeNonNil()
+			}
+
+			result.Data = posts
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+// GetPostsForIndexing returns a batch of live, user-visible posts that come
+// after the given post in (CreateAt, Id) order, for building a search index.
+// Paging by both columns means that no post is skipped or returned twice when
+// many posts share the same creation time.
+func (s SqlPostStore) GetPostsForIndexing(afterTime int64, afterId string, limit int) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		var posts []*model.Post
+		if _, err := s.GetReplica().Select(&posts,
+			`SELECT
+				*
+			FROM
+				Posts
+			WHERE
+				(CreateAt > :AfterTime OR (CreateAt = :AfterTime AND Id > :AfterId))
+				AND DeleteAt = 0
+				AND Type NOT LIKE '`+model.POST_SYSTEM_MESSAGE_PREFIX+`%'
+			ORDER BY CreateAt ASC, Id ASC
+			LIMIT :Limit`,
+			map[string]interface{}{"AfterTime": afterTime, "AfterId": afterId, "Limit": limit}); err != nil {
+			result.Err = model.NewLocAppError("SqlPostStore.GetPostsForIndexing", "store.sql_post.get_posts_for_indexing.app_error", nil, err.Error())
+		} else {
+			for _, post := range posts {
+				post.MakeNonNil()
+			}
+
+			result.Data = posts
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
 func (s SqlPostStore) GetForExport(channelId string) StoreChannel {
 	storeChannel := make(StoreChannel)
 
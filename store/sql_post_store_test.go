@@ -126,6 +126,34 @@ func TestPostStoreUpdate(t *testing.T) {
 		t.Fatal("Failed to update/get")
 	}
 
+	revisions := Must(store.Post().GetEditHistory(o1.Id)).([]*model.Post)
+	if len(revisions) != 1 || revisions[0].Message != o1.Message || revisions[0].OriginalId != o1.Id || revisions[0].DeleteAt == 0 {
+		t.Fatal("should have kept the previous revision")
+	}
+
+	ro3.Message = msg + "EEEEEEE"
+	if result := <-store.Post().Update(ro3, ro3.Message, ""); result.Err != nil {
+		t.Fatal(result.Err)
+	}
+
+	revisions = Must(store.Post().GetEditHistory(o1.Id)).([]*model.Post)
+	if len(revisions) != 2 || revisions[0].Message != msg || revisions[1].Message != o1.Message {
+		t.Fatal("should have kept every revision newest first")
+	}
+
+	ro7 := (<-store.Post().Get(o1.Id)).Data.(*model.PostList).Posts[o1.Id]
+	if result := <-store.Post().UpdateWithProps(ro7, ro7.Message, "", model.StringInterface{"key": "value"}); result.Err != nil {
+		t.Fatal(result.Err)
+	}
+
+	if ro8 := (<-store.Post().Get(o1.Id)).Data.(*model.PostList).Posts[o1.Id]; ro8.Props["key"] != "value" {
+		t.Fatal("should have updated the props")
+	}
+
+	revisions = Must(store.Post().GetEditHistory(o1.Id)).([]*model.Post)
+	if len(revisions) != 3 || revisions[0].Props["key"] != nil {
+		t.Fatal("previous revision should have kept its props")
+	}
 }
 
 func TestPostStoreDelete(t *testing.T) {
@@ -196,6 +224,182 @@ func TestPostStoreDelete1Level(t *testing.T) {
 	}
 }
 
+func TestPostStoreGetThread(t *testing.T) {
+	Setup()
+
+	o1 := &model.Post{}
+	o1.ChannelId = model.NewId()
+	o1.UserId = model.NewId()
+	o1.Message = "a" + model.NewId() + "b"
+	o1 = (<-store.Post().Save(o1)).Data.(*model.Post)
+
+	o2 := &model.Post{}
+	o2.ChannelId = o1.ChannelId
+	o2.UserId = model.NewId()
+	o2.Message = "a" + model.NewId() + "b"
+	o2.ParentId = o1.Id
+	o2.RootId = o1.Id
+	o2 = (<-store.Post().Save(o2)).Data.(*model.Post)
+
+	o3 := &model.Post{}
+	o3.ChannelId = o1.ChannelId
+	o3.UserId = model.NewId()
+	o3.Message = "a" + model.NewId() + "b"
+	o3.ParentId = o2.Id
+	o3.RootId = o1.Id
+	o3 = (<-store.Post().Save(o3)).Data.(*model.Post)
+
+	list := Must(store.Post().GetThread(o1.Id)).(*model.PostList)
+	if len(list.Order) != 3 || list.Order[0] != o3.Id || list.Order[2] != o1.Id {
+		t.Fatal("thread should have been ordered newest first")
+	}
+
+	if root := list.Posts[o1.Id]; root.ReplyCount != 2 || root.LastReplyAt != o3.CreateAt {
+		t.Fatal("reply count wasn't tracked")
+	}
+
+	Must(store.Post().Delete(o3.Id, model.GetMillis()))
+
+	list = Must(store.Post().GetThread(o1.Id)).(*model.PostList)
+	if root := list.Posts[o1.Id]; root.ReplyCount != 1 || root.LastReplyAt != o2.CreateAt {
+		t.Fatal("reply count wasn't updated on delete")
+	}
+
+	// editing the root from a copy loaded before the replies came in is
+	// refused without leaving a revision behind
+	stale := *o1
+	if r := <-store.Post().Update(&stale, "edited", ""); r.Err == nil {
+		t.Fatal("shouldn't have applied an edit to a post that changed since it was read")
+	}
+
+	if revisions := Must(store.Post().GetEditHistory(o1.Id)).([]*model.Post); len(revisions) != 0 {
+		t.Fatal("a refused edit shouldn't have left a revision behind")
+	}
+
+	root := Must(store.Post().GetThread(o1.Id)).(*model.PostList).Posts[o1.Id]
+	Must(store.Post().Update(root, "edited", ""))
+
+	list = Must(store.Post().GetThread(o1.Id)).(*model.PostList)
+	if root := list.Posts[o1.Id]; root.Message != "edited" || root.ReplyCount != 1 || root.LastReplyAt != o2.CreateAt {
+		t.Fatal("editing the root shouldn't have overwritten its reply count")
+	}
+
+	if r := <-store.Post().GetThread(model.NewId()); r.Err == nil {
+		t.Fatal("should have failed on missing thread")
+	}
+}
+
+func TestPostStorePinned(t *testing.T) {
+	Setup()
+
+	c1 := &model.Channel{}
+	c1.TeamId = model.NewId()
+	c1.DisplayName = "Channel1"
+	c1.Name = "a" + model.NewId() + "b"
+	c1.Type = model.CHANNEL_OPEN
+	c1 = Must(store.Channel().Save(c1)).(*model.Channel)
+
+	o1 := &model.Post{}
+	o1.ChannelId = c1.Id
+	o1.UserId = model.NewId()
+	o1.Message = "a" + model.NewId() + "b"
+	o1 = (<-store.Post().Save(o1)).Data.(*model.Post)
+
+	o2 := &model.Post{}
+	o2.ChannelId = c1.Id
+	o2.UserId = model.NewId()
+	o2.Message = "a" + model.NewId() + "b"
+	o2 = (<-store.Post().Save(o2)).Data.(*model.Post)
+
+	if post := Must(store.Post().UpdatePinned(o1, true)).(*model.Post); !post.IsPinned {
+		t.Fatal("post should have been pinned")
+	}
+
+	list := Must(store.Post().GetPinnedPosts(c1.Id)).(*model.PostList)
+	if len(list.Order) != 1 || list.Order[0] != o1.Id {
+		t.Fatal("should have returned only the pinned post")
+	}
+
+	if count := Must(store.Post().GetPinnedPostCount(c1.Id)).(int64); count != 1 {
+		t.Fatal("should have counted the pinned post")
+	}
+
+	if channel := Must(store.Channel().Get(c1.Id)).(*model.Channel); channel.ExtraUpdateAt == c1.ExtraUpdateAt {
+		t.Fatal("pinning should have changed the channel's extra info")
+	}
+
+	Must(store.Post().UpdatePinned(o1, false))
+
+	if count := Must(store.Post().GetPinnedPostCount(c1.Id)).(int64); count != 0 {
+		t.Fatal("should have unpinned the post")
+	}
+}
+
+func TestPostStoreGetFlaggedPosts(t *testing.T) {
+	Setup()
+
+	teamId := model.NewId()
+	userId := model.NewId()
+
+	c1 := &model.Channel{}
+	c1.TeamId = teamId
+	c1.DisplayName = "Channel1"
+	c1.Name = "a" + model.NewId() + "b"
+	c1.Type = model.CHANNEL_OPEN
+	c1 = Must(store.Channel().Save(c1)).(*model.Channel)
+
+	m1 := model.ChannelMember{}
+	m1.ChannelId = c1.Id
+	m1.UserId = userId
+	m1.NotifyProps = model.GetDefaultChannelNotifyProps()
+	Must(store.Channel().SaveMember(&m1))
+
+	c2 := &model.Channel{}
+	c2.TeamId = teamId
+	c2.DisplayName = "Channel2"
+	c2.Name = "a" + model.NewId() + "b"
+	c2.Type = model.CHANNEL_OPEN
+	c2 = Must(store.Channel().Save(c2)).(*model.Channel)
+
+	o1 := &model.Post{}
+	o1.ChannelId = c1.Id
+	o1.UserId = model.NewId()
+	o1.Message = "a" + model.NewId() + "b"
+	o1 = (<-store.Post().Save(o1)).Data.(*model.Post)
+
+	o2 := &model.Post{}
+	o2.ChannelId = c1.Id
+	o2.UserId = model.NewId()
+	o2.Message = "a" + model.NewId() + "b"
+	o2 = (<-store.Post().Save(o2)).Data.(*model.Post)
+
+	// the user isn't a member of this channel any more
+	o3 := &model.Post{}
+	o3.ChannelId = c2.Id
+	o3.UserId = model.NewId()
+	o3.Message = "a" + model.NewId() + "b"
+	o3 = (<-store.Post().Save(o3)).Data.(*model.Post)
+
+	preferences := model.Preferences{
+		{UserId: userId, Category: model.PREFERENCE_CATEGORY_FLAGGED_POST, Name: o1.Id, Value: "true"},
+		{UserId: userId, Category: model.PREFERENCE_CATEGORY_FLAGGED_POST, Name: o3.Id, Value: "true"},
+		{UserId: model.NewId(), Category: model.PREFERENCE_CATEGORY_FLAGGED_POST, Name: o2.Id, Value: "true"},
+	}
+	Must(store.Preference().Save(&preferences))
+
+	list := Must(store.Post().GetFlaggedPosts(teamId, userId, 0, 10)).(*model.PostList)
+	if len(list.Order) != 1 || list.Order[0] != o1.Id {
+		t.Fatal("should have returned only the flagged post in a channel the user belongs to")
+	}
+
+	Must(store.Post().Delete(o1.Id, model.GetMillis()))
+
+	list = Must(store.Post().GetFlaggedPosts(teamId, userId, 0, 10)).(*model.PostList)
+	if len(list.Order) != 0 {
+		t.Fatal("should not have returned a deleted post")
+	}
+}
+
 func TestPostStoreDelete2Level(t *testing.T) {
 	Setup()
 
@@ -708,65 +912,156 @@ func TestPostStoreSearch(t *testing.T) {
 	o5.Hashtags = "#secret #howdy"
 	o5 = (<-store.Post().Save(o5)).Data.(*model.Post)
 
-	r1 := (<-store.Post().Search(teamId, userId, &model.SearchParams{Terms: "corey", IsHashtag: false})).Data.(*model.PostList)
+	r1 := (<-store.Post().Search(teamId, userId, &model.SearchParams{Terms: "corey", IsHashtag: false}, 0, 100)).Data.(*model.PostList)
 	if len(r1.Order) != 1 || r1.Order[0] != o1.Id {
 		t.Fatal("returned wrong search result")
 	}
 
-	r3 := (<-store.Post().Search(teamId, userId, &model.SearchParams{Terms: "new", IsHashtag: false})).Data.(*model.PostList)
+	r3 := (<-store.Post().Search(teamId, userId, &model.SearchParams{Terms: "new", IsHashtag: false}, 0, 100)).Data.(*model.PostList)
 	if len(r3.Order) != 2 || (r3.Order[0] != o1.Id && r3.Order[1] != o1.Id) {
 		t.Fatal("returned wrong search result")
 	}
 
-	r4 := (<-store.Post().Search(teamId, userId, &model.SearchParams{Terms: "john", IsHashtag: false})).Data.(*model.PostList)
+	r4 := (<-store.Post().Search(teamId, userId, &model.SearchParams{Terms: "john", IsHashtag: false}, 0, 100)).Data.(*model.PostList)
 	if len(r4.Order) != 1 || r4.Order[0] != o2.Id {
 		t.Fatal("returned wrong search result")
 	}
 
-	r5 := (<-store.Post().Search(teamId, userId, &model.SearchParams{Terms: "matter*", IsHashtag: false})).Data.(*model.PostList)
+	r5 := (<-store.Post().Search(teamId, userId, &model.SearchParams{Terms: "matter*", IsHashtag: false}, 0, 100)).Data.(*model.PostList)
 	if len(r5.Order) != 1 || r5.Order[0] != o1.Id {
 		t.Fatal("returned wrong search result")
 	}
 
-	r6 := (<-store.Post().Search(teamId, userId, &model.SearchParams{Terms: "#hashtag", IsHashtag: true})).Data.(*model.PostList)
+	r6 := (<-store.Post().Search(teamId, userId, &model.SearchParams{Terms: "#hashtag", IsHashtag: true}, 0, 100)).Data.(*model.PostList)
 	if len(r6.Order) != 1 || r6.Order[0] != o4.Id {
 		t.Fatal("returned wrong search result")
 	}
 
-	r7 := (<-store.Post().Search(teamId, userId, &model.SearchParams{Terms: "#secret", IsHashtag: true})).Data.(*model.PostList)
+	r7 := (<-store.Post().Search(teamId, userId, &model.SearchParams{Terms: "#secret", IsHashtag: true}, 0, 100)).Data.(*model.PostList)
 	if len(r7.Order) != 1 || r7.Order[0] != o5.Id {
 		t.Fatal("returned wrong search result")
 	}
 
-	r8 := (<-store.Post().Search(teamId, userId, &model.SearchParams{Terms: "@thisshouldmatchnothing", IsHashtag: true})).Data.(*model.PostList)
+	r8 := (<-store.Post().Search(teamId, userId, &model.SearchParams{Terms: "@thisshouldmatchnothing", IsHashtag: true}, 0, 100)).Data.(*model.PostList)
 	if len(r8.Order) != 0 {
 		t.Fatal("returned wrong search result")
 	}
 
-	r9 := (<-store.Post().Search(teamId, userId, &model.SearchParams{Terms: "mattermost jersey", IsHashtag: false})).Data.(*model.PostList)
+	r9 := (<-store.Post().Search(teamId, userId, &model.SearchParams{Terms: "mattermost jersey", IsHashtag: false}, 0, 100)).Data.(*model.PostList)
 	if len(r9.Order) != 0 {
 		t.Fatal("returned wrong search result")
 	}
 
-	r9a := (<-store.Post().Search(teamId, userId, &model.SearchParams{Terms: "corey new york", IsHashtag: false})).Data.(*model.PostList)
+	r9a := (<-store.Post().Search(teamId, userId, &model.SearchParams{Terms: "corey new york", IsHashtag: false}, 0, 100)).Data.(*model.PostList)
 	if len(r9a.Order) != 1 {
 		t.Fatal("returned wrong search result")
 	}
 
-	r10 := (<-store.Post().Search(teamId, userId, &model.SearchParams{Terms: "matter* jer*", IsHashtag: false})).Data.(*model.PostList)
+	r10 := (<-store.Post().Search(teamId, userId, &model.SearchParams{Terms: "matter* jer*", IsHashtag: false}, 0, 100)).Data.(*model.PostList)
 	if len(r10.Order) != 0 {
 		t.Fatal("returned wrong search result")
 	}
 
-	r11 := (<-store.Post().Search(teamId, userId, &model.SearchParams{Terms: "message blargh", IsHashtag: false})).Data.(*model.PostList)
+	r11 := (<-store.Post().Search(teamId, userId, &model.SearchParams{Terms: "message blargh", IsHashtag: false}, 0, 100)).Data.(*model.PostList)
 	if len(r11.Order) != 1 {
 		t.Fatal("returned wrong search result")
 	}
 
-	r12 := (<-store.Post().Search(teamId, userId, &model.SearchParams{Terms: "blargh>", IsHashtag: false})).Data.(*model.PostList)
+	r12 := (<-store.Post().Search(teamId, userId, &model.SearchParams{Terms: "blargh>", IsHashtag: false}, 0, 100)).Data.(*model.PostList)
 	if len(r12.Order) != 1 {
 		t.Fatal("returned wrong search result")
 	}
+
+	r13 := (<-store.Post().Search(teamId, userId, &model.SearchParams{Terms: "new", IsHashtag: false}, 1, 1)).Data.(*model.PostList)
+	if len(r13.Order) != 1 || r13.Order[0] != r3.Order[1] {
+		t.Fatal("returned wrong page of search results")
+	}
+
+	today := time.Unix(0, o1.CreateAt*int64(time.Millisecond)).UTC().Format(model.SEARCH_DATE_FORMAT)
+
+	r14 := (<-store.Post().Search(teamId, userId, &model.SearchParams{Terms: "corey", IsHashtag: false, OnDate: today}, 0, 100)).Data.(*model.PostList)
+	if len(r14.Order) != 1 || r14.Order[0] != o1.Id {
+		t.Fatal("returned wrong search result")
+	}
+
+	r15 := (<-store.Post().Search(teamId, userId, &model.SearchParams{Terms: "corey", IsHashtag: false, BeforeDate: today}, 0, 100)).Data.(*model.PostList)
+	if len(r15.Order) != 0 {
+		t.Fatal("returned wrong search result")
+	}
+
+	r16 := (<-store.Post().Search(teamId, userId, &model.SearchParams{Terms: "", IsHashtag: true, AfterDate: "2000-01-01"}, 0, 100)).Data.(*model.PostList)
+	if len(r16.Order) != 4 {
+		t.Fatal("should have searched by date alone")
+	}
+}
+
+func TestPostStoreGetPostsByIds(t *testing.T) {
+	Setup()
+
+	o1 := &model.Post{}
+	o1.ChannelId = model.NewId()
+	o1.UserId = model.NewId()
+	o1.Message = "a" + model.NewId() + "b"
+	o1 = (<-store.Post().Save(o1)).Data.(*model.Post)
+
+	o2 := &model.Post{}
+	o2.ChannelId = o1.ChannelId
+	o2.UserId = model.NewId()
+	o2.Message = "a" + model.NewId() + "b"
+	o2 = (<-store.Post().Save(o2)).Data.(*model.Post)
+
+	o3 := &model.Post{}
+	o3.ChannelId = o1.ChannelId
+	o3.UserId = model.NewId()
+	o3.Message = "a" + model.NewId() + "b"
+	o3 = (<-store.Post().Save(o3)).Data.(*model.Post)
+
+	Must(store.Post().Delete(o3.Id, model.GetMillis()))
+
+	if posts := Must(store.Post().GetPostsByIds([]string{o1.Id, o2.Id, o3.Id})).([]*model.Post); len(posts) != 2 {
+		t.Fatal("should have returned only the live posts")
+	}
+
+	if posts := Must(store.Post().GetPostsByIds([]string{})).([]*model.Post); len(posts) != 0 {
+		t.Fatal("should have returned nothing")
+	}
+
+	posts := Must(store.Post().GetPostsForIndexing(o1.CreateAt-1, "", 1000)).([]*model.Post)
+	foundO1, foundO3 := false, false
+	for _, post := range posts {
+		if post.Id == o1.Id {
+			foundO1 = true
+		} else if post.Id == o3.Id {
+			foundO3 = true
+		}
+	}
+
+	if !foundO1 || foundO3 {
+		t.Fatal("should have returned the live posts to index")
+	}
+
+	// posts created in the same millisecond are paged through one at a time
+	createAt := model.GetMillis() + 100000
+	ids := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		post := &model.Post{ChannelId: o1.ChannelId, UserId: model.NewId(), Message: "a" + model.NewId() + "b", CreateAt: createAt}
+		ids[Must(store.Post().Save(post)).(*model.Post).Id] = true
+	}
+
+	afterTime, afterId := createAt-1, ""
+	for i := 0; i < 3; i++ {
+		batch := Must(store.Post().GetPostsForIndexing(afterTime, afterId, 1)).([]*model.Post)
+		if len(batch) != 1 || !ids[batch[0].Id] {
+			t.Fatal("should have returned the next post with the same creation time")
+		}
+
+		delete(ids, batch[0].Id)
+		afterTime, afterId = batch[0].CreateAt, batch[0].Id
+	}
+
+	if len(ids) != 0 {
+		t.Fatal("should have returned every post created in the same millisecond")
+	}
 }
 
 func TestUserCountsWithPostsByDay(t *testing.T) {
@@ -228,6 +228,18 @@ func TestPreferenceDelete(t *testing.T) {
 
 	Must(store.Preference().Save(&preferences))
 
+	if result := <-store.Preference().Delete(userId, category, name); result.Err != nil {
+		t.Fatal(result.Err)
+	}
+
+	if result := <-store.Preference().Get(userId, category, name); result.Err == nil {
+		t.Fatal("should have deleted the preference")
+	}
+
+	if prefs := Must(store.Preference().GetAll(userId)).(model.Preferences); len(prefs) != 2 {
+		t.Fatal("should only have deleted the one preference")
+	}
+
 	if result := <-store.Preference().PermanentDeleteByUser(userId); result.Err != nil {
 		t.Fatal(result.Err)
 	}
@@ -0,0 +1,202 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package store
+
+import (
+	"strconv"
+
+	"github.com/mattermost/platform/model"
+)
+
+const (
+	REACTION_EXISTS_ERROR = "store.sql_reaction.save.exists.app_error"
+)
+
+type SqlReactionStore struct {
+	*SqlStore
+}
+
+func NewSqlReactionStore(sqlStore *SqlStore) ReactionStore {
+	s := &SqlReactionStore{sqlStore}
+
+	for _, db := range sqlStore.GetAllConns() {
+		table := db.AddTableWithName(model.Reaction{}, "Reactions").SetKeys(false, "UserId", "PostId", "EmojiName")
+		table.ColMap("UserId").SetMaxSize(26)
+		table.ColMap("PostId").SetMaxSize(26)
+		table.ColMap("EmojiName").SetMaxSize(64)
+	}
+
+	return s
+}
+
+func (s SqlReactionStore) UpgradeSchemaIfNeeded() {
+}
+
+func (s SqlReactionStore) CreateIndexesIfNotExists() {
+	s.CreateIndexIfNotExists("idx_reactions_post_id", "Reactions", "PostId")
+	s.CreateIndexIfNotExists("idx_reactions_user_id", "Reactions", "UserId")
+}
+
+func (s SqlReactionStore) Save(reaction *model.Reaction) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		reaction.PreSave()
+		if result.Err = reaction.IsValid(); result.Err != nil {
+			storeChannel <- result
+			close(storeChannel)
+			return
+		}
+
+		if err := s.GetMaster().Insert(reaction); err != nil {
+			if IsUniqueConstraintError(err.Error(), "PRIMARY", "reactions_pkey") {
+				// the user has already reacted with this emoji, possibly from
+				// another request that arrived at the same time
+				result.Err = model.NewLocAppError("SqlReactionStore.Save", REACTION_EXISTS_ERROR, nil, "post_id="+reaction.PostId+", "+err.Error())
+			} else {
+				result.Err = model.NewLocAppError("SqlReactionStore.Save", "store.sql_reaction.save.app_error", nil, "post_id="+reaction.PostId+", "+err.Error())
+			}
+		} else {
+			s.touchPost(reaction.PostId)
+			result.Data = reaction
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+func (s SqlReactionStore) Delete(reaction *model.Reaction) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		if _, err := s.GetMaster().Exec("DELETE FROM Reactions WHERE UserId = :UserId AND PostId = :PostId AND EmojiName = :EmojiName",
+			map[string]interface{}{"UserId": reaction.UserId, "PostId": reaction.PostId, "EmojiName": reaction.EmojiName}); err != nil {
+			result.Err = model.NewLocAppError("SqlReactionStore.Delete", "store.sql_reaction.delete.app_error", nil, "post_id="+reaction.PostId+", "+err.Error())
+		} else {
+			s.touchPost(reaction.PostId)
+			result.Data = reaction
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+// touchPost bumps UpdateAt on the post so that cached post lists are refetched
+func (s SqlReactionStore) touchPost(postId string) {
+	s.GetMaster().Exec("UPDATE Posts SET UpdateAt = :UpdateAt WHERE Id = :PostId", map[string]interface{}{"UpdateAt": model.GetMillis(), "PostId": postId})
+}
+
+func (s SqlReactionStore) GetForPost(postId string) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		var reactions []*model.Reaction
+		if _, err := s.GetReplica().Select(&reactions, "SELECT * FROM Reactions WHERE PostId = :PostId ORDER BY CreateAt", map[string]interface{}{"PostId": postId}); err != nil {
+			result.Err = model.NewLocAppError("SqlReactionStore.GetForPost", "store.sql_reaction.get_for_post.app_error", nil, "post_id="+postId+", "+err.Error())
+		} else {
+			result.Data = reactions
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+func (s SqlReactionStore) GetForPosts(postIds []string) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		reactions := []*model.Reaction{}
+
+		if len(postIds) > 0 {
+			params := map[string]interface{}{}
+			inClause := ""
+			for i, postId := range postIds {
+				paramName := "PostId" + strconv.Itoa(i)
+				if i > 0 {
+					inClause += ", "
+				}
+				inClause += ":" + paramName
+				params[paramName] = postId
+			}
+
+			if _, err := s.GetReplica().Select(&reactions, "SELECT * FROM Reactions WHERE PostId IN ("+inClause+") ORDER BY CreateAt", params); err != nil {
+				result.Err = model.NewLocAppError("SqlReactionStore.GetForPosts", "store.sql_reaction.get_for_post.app_error", nil, err.Error())
+			}
+		}
+
+		if result.Err == nil {
+			result.Data = reactions
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+func (s SqlReactionStore) GetForExport(channelId string) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		var reactions []*model.Reaction
+		if _, err := s.GetReplica().Select(&reactions,
+			`SELECT
+			    Reactions.*
+			FROM
+			    Reactions,
+			    Posts
+			WHERE
+			    Reactions.PostId = Posts.Id
+			        AND Posts.ChannelId = :ChannelId
+			        AND Posts.DeleteAt = 0
+			ORDER BY Reactions.CreateAt`,
+			map[string]interface{}{"ChannelId": channelId}); err != nil {
+			result.Err = model.NewLocAppError("SqlReactionStore.GetForExport", "store.sql_reaction.get_for_export.app_error", nil, "channel_id="+channelId+", "+err.Error())
+		} else {
+			result.Data = reactions
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+func (s SqlReactionStore) PermanentDeleteByUser(userId string) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		if _, err := s.GetMaster().Exec("DELETE FROM Reactions WHERE UserId = :UserId", map[string]interface{}{"UserId": userId}); err != nil {
+			result.Err = model.NewLocAppError("SqlReactionStore.PermanentDeleteByUser", "store.sql_reaction.permanent_delete_by_user.app_error", nil, "user_id="+userId+", "+err.Error())
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package store
+
+import (
+	"testing"
+
+	"github.com/mattermost/platform/model"
+)
+
+func TestReactionStoreSaveDelete(t *testing.T) {
+	Setup()
+
+	post := &model.Post{ChannelId: model.NewId(), UserId: model.NewId(), Message: "a" + model.NewId() + "b"}
+	post = Must(store.Post().Save(post)).(*model.Post)
+
+	r1 := &model.Reaction{UserId: model.NewId(), PostId: post.Id, EmojiName: "smile"}
+	r1 = Must(store.Reaction().Save(r1)).(*model.Reaction)
+
+	// the same reaction saved again, including by several requests at once
+	channels := []StoreChannel{}
+	for i := 0; i < 5; i++ {
+		channels = append(channels, store.Reaction().Save(&model.Reaction{UserId: r1.UserId, PostId: post.Id, EmojiName: "smile"}))
+	}
+
+	for _, channel := range channels {
+		if r := <-channel; r.Err == nil || r.Err.Id != REACTION_EXISTS_ERROR {
+			t.Fatal("should have reported that the reaction already existed", r.Err)
+		}
+	}
+
+	r2 := &model.Reaction{UserId: model.NewId(), PostId: post.Id, EmojiName: "frowning"}
+	Must(store.Reaction().Save(r2))
+
+	if reactions := Must(store.Reaction().GetForPost(post.Id)).([]*model.Reaction); len(reactions) != 2 {
+		t.Fatal("should have saved two distinct reactions")
+	}
+
+	if reactions := Must(store.Reaction().GetForPosts([]string{post.Id, model.NewId()})).([]*model.Reaction); len(reactions) != 2 {
+		t.Fatal("should have found reactions for the post")
+	}
+
+	if reactions := Must(store.Reaction().GetForExport(post.ChannelId)).([]*model.Reaction); len(reactions) != 2 {
+		t.Fatal("should have exported reactions for the channel")
+	}
+
+	Must(store.Reaction().Delete(r1))
+
+	if reactions := Must(store.Reaction().GetForPost(post.Id)).([]*model.Reaction); len(reactions) != 1 || reactions[0].UserId != r2.UserId {
+		t.Fatal("should have deleted the reaction")
+	}
+
+	Must(store.Reaction().PermanentDeleteByUser(r2.UserId))
+
+	if reactions := Must(store.Reaction().GetForPost(post.Id)).([]*model.Reaction); len(reactions) != 0 {
+		t.Fatal("should have deleted the user's reactions")
+	}
+
+	if r := <-store.Reaction().Save(&model.Reaction{UserId: model.NewId(), PostId: post.Id, EmojiName: "no spaces"}); r.Err == nil {
+		t.Fatal("should have failed on invalid emoji name")
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package store
+
+import (
+	"database/sql"
+
+	l4g "github.com/alecthomas/log4go"
+	"github.com/mattermost/platform/model"
+	"github.com/mattermost/platform/utils"
+)
+
+type SqlRoleStore struct {
+	*SqlStore
+}
+
+func NewSqlRoleStore(sqlStore *SqlStore) RoleStore {
+	s := &SqlRoleStore{sqlStore}
+
+	for _, db := range sqlStore.GetAllConns() {
+		table := db.AddTableWithName(model.Role{}, "Roles").SetKeys(false, "Id")
+		table.ColMap("Id").SetMaxSize(26)
+		table.ColMap("Name").SetMaxSize(64)
+		table.ColMap("DisplayName").SetMaxSize(64)
+		table.ColMap("Description").SetMaxSize(1024)
+		table.ColMap("TeamId").SetMaxSize(26)
+		table.ColMap("Permissions").SetMaxSize(1024)
+		table.SetUniqueTogether("Name", "TeamId")
+	}
+
+	return s
+}
+
+func (s SqlRoleStore) UpgradeSchemaIfNeeded() {
+}
+
+func (s SqlRoleStore) CreateIndexesIfNotExists() {
+	s.CreateIndexIfNotExists("idx_roles_team_id", "Roles", "TeamId")
+}
+
+// CreateDefaultRolesIfNotExist adds any of the built in roles that are missing
+// so that a new or upgraded server starts out with the permissions that used to
+// be hard coded.
+func (s SqlRoleStore) CreateDefaultRolesIfNotExist() {
+	existing := make(map[string]bool)
+	if result := <-s.GetByTeam(""); result.Err != nil {
+		l4g.Critical(utils.T("store.sql_role.create_default_roles.critical"), result.Err)
+		return
+	} else {
+		for _, role := range result.Data.([]*model.Role) {
+			existing[role.Name] = true
+		}
+	}
+
+	for _, role := range model.MakeDefaultRoles() {
+		if existing[role.Name] {
+			continue
+		}
+
+		if result := <-s.Save(role); result.Err != nil {
+			l4g.Critical(utils.T("store.sql_role.create_default_roles.critical"), result.Err)
+		}
+	}
+}
+
+func (s SqlRoleStore) Save(role *model.Role) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		if len(role.Id) > 0 {
+			result.Err = model.NewLocAppError("SqlRoleStore.Save", "store.sql_role.save.existing.app_error", nil, "id="+role.Id)
+			storeChannel <- result
+			close(storeChannel)
+			return
+		}
+
+		role.PreSave()
+		if result.Err = role.IsValid(); result.Err != nil {
+			storeChannel <- result
+			close(storeChannel)
+			return
+		}
+
+		if err := s.GetMaster().Insert(role); err != nil {
+			if IsUniqueConstraintError(err.Error(), "Name", "roles_name_teamid_key") {
+				result.Err = model.NewLocAppError("SqlRoleStore.Save", "store.sql_role.save.exists.app_error", nil, "name="+role.Name+", "+err.Error())
+			} else {
+				result.Err = model.NewLocAppError("SqlRoleStore.Save", "store.sql_role.save.app_error", nil, "name="+role.Name+", "+err.Error())
+			}
+		} else {
+			result.Data = role
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+// Update saves a role's display name, description and permissions. Its name and
+// team can't be changed.
+func (s SqlRoleStore) Update(role *model.Role) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		var oldRole model.Role
+		if err := s.GetMaster().SelectOne(&oldRole, "SELECT * FROM Roles WHERE Id = :Id", map[string]interface{}{"Id": role.Id}); err != nil {
+			result.Err = model.NewLocAppError("SqlRoleStore.Update", "store.sql_role.update.find.app_error", nil, "id="+role.Id+", "+err.Error())
+			storeChannel <- result
+			close(storeChannel)
+			return
+		}
+
+		// restore the fields that can't be changed before validating so that
+		// whether the role is built in is decided by the saved role
+		role.Name = oldRole.Name
+		role.TeamId = oldRole.TeamId
+		role.CreateAt = oldRole.CreateAt
+
+		role.PreUpdate()
+		if result.Err = role.IsValid(); result.Err != nil {
+			storeChannel <- result
+			close(storeChannel)
+			return
+		}
+
+		if count, err := s.GetMaster().Update(role); err != nil {
+			result.Err = model.NewLocAppError("SqlRoleStore.Update", "store.sql_role.update.updating.app_error", nil, "id="+role.Id+", "+err.Error())
+		} else if count != 1 {
+			result.Err = model.NewLocAppError("SqlRoleStore.Update", "store.sql_role.update.app_error", nil, "id="+role.Id)
+		} else {
+			result.Data = role
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+func (s SqlRoleStore) Get(id string) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		var role model.Role
+		if err := s.GetReplica().SelectOne(&role, "SELECT * FROM Roles WHERE Id = :Id", map[string]interface{}{"Id": id}); err != nil {
+			if err == sql.ErrNoRows {
+				result.Err = model.NewLocAppError("SqlRoleStore.Get", "store.sql_role.get.missing.app_error", nil, "id="+id)
+			} else {
+				result.Err = model.NewLocAppError("SqlRoleStore.Get", "store.sql_role.get.app_error", nil, "id="+id+", "+err.Error())
+			}
+		} else {
+			result.Data = &role
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+// GetByTeam returns the custom roles made in a team. The built in roles are the
+// ones with an empty team id.
+func (s SqlRoleStore) GetByTeam(teamId string) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		var roles []*model.Role
+		if _, err := s.GetReplica().Select(&roles, "SELECT * FROM Roles WHERE TeamId = :TeamId ORDER BY Name", map[string]interface{}{"TeamId": teamId}); err != nil {
+			result.Err = model.NewLocAppError("SqlRoleStore.GetByTeam", "store.sql_role.get_by_team.app_error", nil, "team_id="+teamId+", "+err.Error())
+		} else {
+			result.Data = roles
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+func (s SqlRoleStore) Delete(id string) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		if _, err := s.GetMaster().Exec("DELETE FROM Roles WHERE Id = :Id", map[string]interface{}{"Id": id}); err != nil {
+			result.Err = model.NewLocAppError("SqlRoleStore.Delete", "store.sql_role.delete.app_error", nil, "id="+id+", "+err.Error())
+		} else {
+			result.Data = id
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package store
+
+import (
+	"testing"
+
+	"github.com/mattermost/platform/model"
+)
+
+func TestRoleStore(t *testing.T) {
+	Setup()
+
+	builtIn := Must(store.Role().GetByTeam("")).([]*model.Role)
+	if len(builtIn) != len(model.MakeDefaultRoles()) {
+		t.Fatal("should have made the default roles")
+	}
+
+	teamId := model.NewId()
+
+	r1 := &model.Role{Name: "moderator", DisplayName: "Moderator", TeamId: teamId, Permissions: model.PERMISSION_DELETE_OTHERS_POSTS}
+	r1 = Must(store.Role().Save(r1)).(*model.Role)
+
+	if r := <-store.Role().Save(&model.Role{Name: "moderator", TeamId: teamId}); r.Err == nil {
+		t.Fatal("shouldn't be able to make two roles with the same name in a team")
+	}
+
+	Must(store.Role().Save(&model.Role{Name: "moderator", TeamId: model.NewId()}))
+
+	if r := <-store.Role().Save(&model.Role{Name: "manager", TeamId: teamId, Permissions: model.PERMISSION_MANAGE_SYSTEM}); r.Err == nil {
+		t.Fatal("a team role shouldn't be able to manage the system")
+	}
+
+	r1.Name = "renamed"
+	r1.Permissions = model.PERMISSION_DELETE_OTHERS_POSTS + " " + model.PERMISSION_MANAGE_CHANNELS
+	Must(store.Role().Update(r1))
+
+	if role := Must(store.Role().Get(r1.Id)).(*model.Role); role.Name != "moderator" || !role.HasPermission(model.PERMISSION_MANAGE_CHANNELS) {
+		t.Fatal("should have updated the permissions but not the name")
+	}
+
+	if roles := Must(store.Role().GetByTeam(teamId)).([]*model.Role); len(roles) != 1 || roles[0].Id != r1.Id {
+		t.Fatal("should have only found the team's role")
+	}
+
+	r1.TeamId = ""
+	r1.Permissions = model.PERMISSION_MANAGE_SYSTEM
+	if r := <-store.Role().Update(r1); r.Err == nil {
+		t.Fatal("a team role shouldn't be able to manage the system by being moved out of its team")
+	}
+
+	Must(store.Role().Delete(r1.Id))
+
+	if r := <-store.Role().Get(r1.Id); r.Err == nil {
+		t.Fatal("should have deleted the role")
+	}
+}
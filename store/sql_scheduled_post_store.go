@@ -0,0 +1,298 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package store
+
+import (
+	"github.com/mattermost/platform/model"
+)
+
+type SqlScheduledPostStore struct {
+	*SqlStore
+}
+
+func NewSqlScheduledPostStore(sqlStore *SqlStore) ScheduledPostStore {
+	s := &SqlScheduledPostStore{sqlStore}
+
+	for _, db := range sqlStore.GetAllConns() {
+		table := db.AddTableWithName(model.ScheduledPost{}, "ScheduledPosts").SetKeys(false, "Id")
+		table.ColMap("Id").SetMaxSize(26)
+		table.ColMap("UserId").SetMaxSize(26)
+		table.ColMap("TeamId").SetMaxSize(26)
+		table.ColMap("ChannelId").SetMaxSize(26)
+		table.ColMap("RootId").SetMaxSize(26)
+		table.ColMap("Message").SetMaxSize(4000)
+		table.ColMap("Filenames").SetMaxSize(4000)
+		table.ColMap("Recurrence").SetMaxSize(26)
+		table.ColMap("Timezone").SetMaxSize(64)
+		table.ColMap("LastError").SetMaxSize(model.SCHEDULED_POST_LAST_ERROR_MAX_SIZE)
+		table.ColMap("SiteURL").SetMaxSize(1024)
+	}
+
+	return s
+}
+
+func (s SqlScheduledPostStore) UpgradeSchemaIfNeeded() {
+	s.CreateColumnIfNotExists("ScheduledPosts", "LastError", "varchar(1024)", "varchar(1024)", "")
+	s.CreateColumnIfNotExists("ScheduledPosts", "Timezone", "varchar(64)", "varchar(64)", "")
+	s.CreateColumnIfNotExists("ScheduledPosts", "LockedUntil", "bigint(20)", "bigint", "0")
+	s.CreateColumnIfNotExists("ScheduledPosts", "Attempts", "int", "integer", "0")
+}
+
+func (s SqlScheduledPostStore) CreateIndexesIfNotExists() {
+	s.CreateIndexIfNotExists("idx_scheduledposts_user_id", "ScheduledPosts", "UserId")
+	s.CreateIndexIfNotExists("idx_scheduledposts_scheduled_at", "ScheduledPosts", "ScheduledAt")
+}
+
+func (s SqlScheduledPostStore) Save(scheduledPost *model.ScheduledPost) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		if len(scheduledPost.Id) > 0 {
+			result.Err = model.NewLocAppError("SqlScheduledPostStore.Save", "store.sql_scheduled_post.save.existing.app_error", nil, "id="+scheduledPost.Id)
+			storeChannel <- result
+			close(storeChannel)
+			return
+		}
+
+		scheduledPost.PreSave()
+		if result.Err = scheduledPost.IsValid(); result.Err != nil {
+			storeChannel <- result
+			close(storeChannel)
+			return
+		}
+
+		if err := s.GetMaster().Insert(scheduledPost); err != nil {
+			result.Err = model.NewLocAppError("SqlScheduledPostStore.Save", "store.sql_scheduled_post.save.app_error", nil, "id="+scheduledPost.Id+", "+err.Error())
+		} else {
+			result.Data = scheduledPost
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+func (s SqlScheduledPostStore) Update(scheduledPost *model.ScheduledPost) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		scheduledPost.PreUpdate()
+		if result.Err = scheduledPost.IsValid(); result.Err != nil {
+			storeChannel <- result
+			close(storeChannel)
+			return
+		}
+
+		if count, err := s.GetMaster().Update(scheduledPost); err != nil {
+			result.Err = model.NewLocAppError("SqlScheduledPostStore.Update", "store.sql_scheduled_post.update.app_error", nil, "id="+scheduledPost.Id+", "+err.Error())
+		} else if count == 0 {
+			// the post was delivered or cancelled while it was being edited
+			result.Err = model.NewLocAppError("SqlScheduledPostStore.Update", "store.sql_scheduled_post.update.missing.app_error", nil, "id="+scheduledPost.Id)
+		} else {
+			result.Data = scheduledPost
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+func (s SqlScheduledPostStore) Get(id string) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		if obj, err := s.GetReplica().Get(model.ScheduledPost{}, id); err != nil {
+			result.Err = model.NewLocAppError("SqlScheduledPostStore.Get", "store.sql_scheduled_post.get.app_error", nil, "id="+id+", "+err.Error())
+		} else if obj == nil {
+			result.Err = model.NewLocAppError("SqlScheduledPostStore.Get", "store.sql_scheduled_post.get.missing.app_error", nil, "id="+id)
+		} else {
+			result.Data = obj.(*model.ScheduledPost)
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+func (s SqlScheduledPostStore) GetForUser(teamId string, userId string) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		var scheduledPosts []*model.ScheduledPost
+		if _, err := s.GetReplica().Select(&scheduledPosts, "SELECT * FROM ScheduledPosts WHERE TeamId = :TeamId AND UserId = :UserId ORDER BY ScheduledAt ASC",
+			map[string]interface{}{"TeamId": teamId, "UserId": userId}); err != nil {
+			result.Err = model.NewLocAppError("SqlScheduledPostStore.GetForUser", "store.sql_scheduled_post.get_for_user.app_error", nil, "user_id="+userId+", "+err.Error())
+		} else {
+			result.Data = scheduledPosts
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+func (s SqlScheduledPostStore) GetDue(time int64, limit int) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		var scheduledPosts []*model.ScheduledPost
+		if _, err := s.GetMaster().Select(&scheduledPosts, "SELECT * FROM ScheduledPosts WHERE ScheduledAt <= :Time AND LockedUntil <= :Time AND Attempts < :MaxAttempts ORDER BY ScheduledAt ASC LIMIT :Limit",
+			map[string]interface{}{"Time": time, "MaxAttempts": model.SCHEDULED_POST_MAX_ATTEMPTS, "Limit": limit}); err != nil {
+			result.Err = model.NewLocAppError("SqlScheduledPostStore.GetDue", "store.sql_scheduled_post.get_due.app_error", nil, err.Error())
+		} else {
+			result.Data = scheduledPosts
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+// Claim takes a lease on a due scheduled post until leaseUntil. The update only
+// applies if neither the schedule nor the lease have changed since the post was
+// read, so when several app servers race for the same post only one of them
+// gets true back. If the server delivering it goes away, the post becomes due
+// again once the lease runs out. The lease is kept apart from ScheduledAt so
+// that recurring posts keep counting from the time they were scheduled for.
+func (s SqlScheduledPostStore) Claim(scheduledPost *model.ScheduledPost, leaseUntil int64) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		if sqlResult, err := s.GetMaster().Exec("UPDATE ScheduledPosts SET LockedUntil = :LeaseUntil WHERE Id = :Id AND ScheduledAt = :ScheduledAt AND LockedUntil = :LockedUntil",
+			map[string]interface{}{"LeaseUntil": leaseUntil, "Id": scheduledPost.Id, "ScheduledAt": scheduledPost.ScheduledAt, "LockedUntil": scheduledPost.LockedUntil}); err != nil {
+			result.Err = model.NewLocAppError("SqlScheduledPostStore.Claim", "store.sql_scheduled_post.claim.app_error", nil, "id="+scheduledPost.Id+", "+err.Error())
+		} else if rows, err := sqlResult.RowsAffected(); err != nil {
+			result.Err = model.NewLocAppError("SqlScheduledPostStore.Claim", "store.sql_scheduled_post.claim.app_error", nil, "id="+scheduledPost.Id+", "+err.Error())
+		} else {
+			if rows == 1 {
+				scheduledPost.LockedUntil = leaseUntil
+			}
+
+			result.Data = rows == 1
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+// Delivered finishes a claimed delivery by moving the post to its next delivery
+// time, or removing it when it doesn't recur. Nothing changes if the post was
+// edited while it was being delivered.
+func (s SqlScheduledPostStore) Delivered(scheduledPost *model.ScheduledPost, nextScheduledAt int64) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		params := map[string]interface{}{"Id": scheduledPost.Id, "ScheduledAt": scheduledPost.ScheduledAt, "LockedUntil": scheduledPost.LockedUntil}
+
+		var query string
+		if nextScheduledAt == 0 {
+			query = "DELETE FROM ScheduledPosts WHERE Id = :Id AND ScheduledAt = :ScheduledAt AND LockedUntil = :LockedUntil"
+		} else {
+			query = "UPDATE ScheduledPosts SET ScheduledAt = :NextScheduledAt, LockedUntil = 0, Attempts = 0, LastDeliveredAt = :LastDeliveredAt, LastError = '' WHERE Id = :Id AND ScheduledAt = :ScheduledAt AND LockedUntil = :LockedUntil"
+			params["NextScheduledAt"] = nextScheduledAt
+			params["LastDeliveredAt"] = model.GetMillis()
+		}
+
+		if _, err := s.GetMaster().Exec(query, params); err != nil {
+			result.Err = model.NewLocAppError("SqlScheduledPostStore.Delivered", "store.sql_scheduled_post.delivered.app_error", nil, "id="+scheduledPost.Id+", "+err.Error())
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+// DeliveryFailed counts a failed attempt at a claimed delivery and holds on to
+// it until retryAt so that it is attempted again then, keeping the error so
+// that the author can see why it wasn't posted. The time the post was
+// scheduled for is left as it is. Once SCHEDULED_POST_MAX_ATTEMPTS attempts
+// have failed the post is no longer due until it is edited.
+func (s SqlScheduledPostStore) DeliveryFailed(scheduledPost *model.ScheduledPost, retryAt int64, reason string) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		if len(reason) > model.SCHEDULED_POST_LAST_ERROR_MAX_SIZE {
+			reason = reason[:model.SCHEDULED_POST_LAST_ERROR_MAX_SIZE]
+		}
+
+		if _, err := s.GetMaster().Exec("UPDATE ScheduledPosts SET LockedUntil = :RetryAt, Attempts = Attempts + 1, LastError = :LastError WHERE Id = :Id AND ScheduledAt = :ScheduledAt AND LockedUntil = :LockedUntil",
+			map[string]interface{}{"RetryAt": retryAt, "LastError": reason, "Id": scheduledPost.Id, "ScheduledAt": scheduledPost.ScheduledAt, "LockedUntil": scheduledPost.LockedUntil}); err != nil {
+			result.Err = model.NewLocAppError("SqlScheduledPostStore.DeliveryFailed", "store.sql_scheduled_post.delivery_failed.app_error", nil, "id="+scheduledPost.Id+", "+err.Error())
+		} else {
+			scheduledPost.Attempts++
+			scheduledPost.LockedUntil = retryAt
+			scheduledPost.LastError = reason
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+func (s SqlScheduledPostStore) Delete(id string) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		if _, err := s.GetMaster().Exec("DELETE FROM ScheduledPosts WHERE Id = :Id", map[string]interface{}{"Id": id}); err != nil {
+			result.Err = model.NewLocAppError("SqlScheduledPostStore.Delete", "store.sql_scheduled_post.delete.app_error", nil, "id="+id+", "+err.Error())
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+func (s SqlScheduledPostStore) PermanentDeleteByUser(userId string) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		if _, err := s.GetMaster().Exec("DELETE FROM ScheduledPosts WHERE UserId = :UserId", map[string]interface{}{"UserId": userId}); err != nil {
+			result.Err = model.NewLocAppError("SqlScheduledPostStore.PermanentDeleteByUser", "store.sql_scheduled_post.permanent_delete_by_user.app_error", nil, "user_id="+userId+", "+err.Error())
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
@@ -0,0 +1,245 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mattermost/platform/model"
+)
+
+func TestScheduledPostStoreSaveGet(t *testing.T) {
+	Setup()
+
+	o1 := &model.ScheduledPost{}
+	o1.UserId = model.NewId()
+	o1.TeamId = model.NewId()
+	o1.ChannelId = model.NewId()
+	o1.Message = "a" + model.NewId() + "b"
+	o1.ScheduledAt = model.GetMillis() + 60000
+
+	if err := (<-store.ScheduledPost().Save(o1)).Err; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := (<-store.ScheduledPost().Save(o1)).Err; err == nil {
+		t.Fatal("shouldn't be able to update from save")
+	}
+
+	if r := <-store.ScheduledPost().Get(o1.Id); r.Err != nil {
+		t.Fatal(r.Err)
+	} else if r.Data.(*model.ScheduledPost).Message != o1.Message {
+		t.Fatal("invalid returned scheduled post")
+	}
+
+	if err := (<-store.ScheduledPost().Get("123")).Err; err == nil {
+		t.Fatal("Missing id should have failed")
+	}
+
+	o1.Message = "a" + model.NewId() + "b"
+	o1.Recurrence = model.SCHEDULED_POST_RECURRENCE_DAILY
+	Must(store.ScheduledPost().Update(o1))
+
+	o2 := &model.ScheduledPost{}
+	o2.UserId = o1.UserId
+	o2.TeamId = o1.TeamId
+	o2.ChannelId = model.NewId()
+	o2.Message = "a" + model.NewId() + "b"
+	o2.ScheduledAt = o1.ScheduledAt - 30000
+	Must(store.ScheduledPost().Save(o2))
+
+	list := Must(store.ScheduledPost().GetForUser(o1.TeamId, o1.UserId)).([]*model.ScheduledPost)
+	if len(list) != 2 || list[0].Id != o2.Id || list[1].Message != o1.Message || list[1].Recurrence != o1.Recurrence {
+		t.Fatal("should have returned both scheduled posts in delivery order")
+	}
+
+	Must(store.ScheduledPost().Delete(o2.Id))
+
+	if err := (<-store.ScheduledPost().Update(o2)).Err; err == nil {
+		t.Fatal("shouldn't be able to update a cancelled post")
+	}
+
+	Must(store.ScheduledPost().PermanentDeleteByUser(o1.UserId))
+
+	if list := Must(store.ScheduledPost().GetForUser(o1.TeamId, o1.UserId)).([]*model.ScheduledPost); len(list) != 0 {
+		t.Fatal("should have deleted the user's scheduled posts")
+	}
+}
+
+func TestScheduledPostStoreClaim(t *testing.T) {
+	Setup()
+
+	o1 := &model.ScheduledPost{}
+	o1.UserId = model.NewId()
+	o1.TeamId = model.NewId()
+	o1.ChannelId = model.NewId()
+	o1.Message = "a" + model.NewId() + "b"
+	o1.ScheduledAt = 1000
+	o1.Recurrence = model.SCHEDULED_POST_RECURRENCE_DAILY
+	Must(store.ScheduledPost().Save(o1))
+
+	o2 := &model.ScheduledPost{}
+	o2.UserId = o1.UserId
+	o2.TeamId = o1.TeamId
+	o2.ChannelId = model.NewId()
+	o2.Message = "a" + model.NewId() + "b"
+	o2.ScheduledAt = 2000
+	Must(store.ScheduledPost().Save(o2))
+
+	due := Must(store.ScheduledPost().GetDue(1500, 100)).([]*model.ScheduledPost)
+	found := false
+	for _, sp := range due {
+		if sp.Id == o2.Id {
+			t.Fatal("shouldn't have returned a post that isn't due")
+		} else if sp.Id == o1.Id {
+			found = true
+		}
+	}
+
+	if !found {
+		t.Fatal("should have returned the due post")
+	}
+
+	stale := *o1
+
+	if claimed := Must(store.ScheduledPost().Claim(o1, 3000)).(bool); !claimed || o1.LockedUntil != 3000 || o1.ScheduledAt != 1000 {
+		t.Fatal("should have claimed the post")
+	}
+
+	if claimed := Must(store.ScheduledPost().Claim(&stale, 3000)).(bool); claimed {
+		t.Fatal("shouldn't be able to claim the same delivery twice")
+	}
+
+	Must(store.ScheduledPost().DeliveryFailed(o1, 4000, "channel archived"))
+
+	if sp := Must(store.ScheduledPost().Get(o1.Id)).(*model.ScheduledPost); sp.ScheduledAt != 1000 || sp.LockedUntil != 4000 || sp.LastError != "channel archived" || sp.LastDeliveredAt != 0 {
+		t.Fatal("failed delivery should have been held for another attempt without moving its schedule")
+	}
+
+	for _, sp := range Must(store.ScheduledPost().GetDue(3500, 100)).([]*model.ScheduledPost) {
+		if sp.Id == o1.Id {
+			t.Fatal("shouldn't have returned a post before it is retried")
+		}
+	}
+
+	o1 = Must(store.ScheduledPost().Get(o1.Id)).(*model.ScheduledPost)
+	if claimed := Must(store.ScheduledPost().Claim(o1, 6000)).(bool); !claimed {
+		t.Fatal("should have claimed the post again")
+	}
+
+	Must(store.ScheduledPost().Delivered(o1, 5000))
+
+	if sp := Must(store.ScheduledPost().Get(o1.Id)).(*model.ScheduledPost); sp.ScheduledAt != 5000 || sp.LockedUntil != 0 || sp.LastDeliveredAt == 0 || sp.LastError != "" {
+		t.Fatal("recurring post should have been rescheduled")
+	}
+
+	if claimed := Must(store.ScheduledPost().Claim(o2, 3000)).(bool); !claimed {
+		t.Fatal("should have claimed the post")
+	}
+
+	if err := (<-store.ScheduledPost().Get(o2.Id)).Err; err != nil {
+		t.Fatal("one-off post should be kept until it has been delivered")
+	}
+
+	Must(store.ScheduledPost().Delivered(o2, 0))
+
+	if err := (<-store.ScheduledPost().Get(o2.Id)).Err; err == nil {
+		t.Fatal("one-off post should have been removed once delivered")
+	}
+
+	Must(store.ScheduledPost().PermanentDeleteByUser(o1.UserId))
+}
+
+func TestScheduledPostStoreGivesUp(t *testing.T) {
+	Setup()
+
+	o1 := &model.ScheduledPost{}
+	o1.UserId = model.NewId()
+	o1.TeamId = model.NewId()
+	o1.ChannelId = model.NewId()
+	o1.Message = "a" + model.NewId() + "b"
+	o1.ScheduledAt = 1000
+	Must(store.ScheduledPost().Save(o1))
+
+	isDue := func() bool {
+		for _, sp := range Must(store.ScheduledPost().GetDue(1000000, 100)).([]*model.ScheduledPost) {
+			if sp.Id == o1.Id {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	for i := 0; i < model.SCHEDULED_POST_MAX_ATTEMPTS; i++ {
+		if !isDue() {
+			t.Fatal("should still be retrying the post", i)
+		}
+
+		sp := Must(store.ScheduledPost().Get(o1.Id)).(*model.ScheduledPost)
+		if claimed := Must(store.ScheduledPost().Claim(sp, 2000)).(bool); !claimed {
+			t.Fatal("should have claimed the post")
+		}
+
+		Must(store.ScheduledPost().DeliveryFailed(sp, 3000, "root post deleted"))
+	}
+
+	if isDue() {
+		t.Fatal("should have stopped retrying the post")
+	}
+
+	sp := Must(store.ScheduledPost().Get(o1.Id)).(*model.ScheduledPost)
+	if sp.Attempts != model.SCHEDULED_POST_MAX_ATTEMPTS || sp.LastError != "root post deleted" {
+		t.Fatal("should have kept the post with its last error")
+	}
+
+	Must(store.ScheduledPost().Update(sp))
+
+	if !isDue() {
+		t.Fatal("editing the post should have let it be delivered again")
+	}
+
+	Must(store.ScheduledPost().PermanentDeleteByUser(o1.UserId))
+}
+
+func TestScheduledPostStoreRetryKeepsSchedule(t *testing.T) {
+	Setup()
+
+	nineAm := time.Date(2016, time.March, 1, 9, 0, 0, 0, time.UTC)
+	millis := func(at time.Time) int64 {
+		return at.UnixNano() / int64(time.Millisecond)
+	}
+
+	o1 := &model.ScheduledPost{}
+	o1.UserId = model.NewId()
+	o1.TeamId = model.NewId()
+	o1.ChannelId = model.NewId()
+	o1.Message = "a" + model.NewId() + "b"
+	o1.ScheduledAt = millis(nineAm)
+	o1.Recurrence = model.SCHEDULED_POST_RECURRENCE_DAILY
+	o1.Timezone = "UTC"
+	Must(store.ScheduledPost().Save(o1))
+
+	// the first delivery fails and is retried five minutes later
+	if claimed := Must(store.ScheduledPost().Claim(o1, millis(nineAm.Add(time.Minute)))).(bool); !claimed {
+		t.Fatal("should have claimed the post")
+	}
+
+	Must(store.ScheduledPost().DeliveryFailed(o1, millis(nineAm.Add(5*time.Minute)), "channel archived"))
+
+	retry := Must(store.ScheduledPost().Get(o1.Id)).(*model.ScheduledPost)
+	if claimed := Must(store.ScheduledPost().Claim(retry, millis(nineAm.Add(6*time.Minute)))).(bool); !claimed {
+		t.Fatal("should have claimed the post again")
+	}
+
+	next := retry.NextScheduledAt(millis(nineAm.Add(5 * time.Minute)))
+	Must(store.ScheduledPost().Delivered(retry, next))
+
+	if sp := Must(store.ScheduledPost().Get(o1.Id)).(*model.ScheduledPost); sp.ScheduledAt != millis(nineAm.AddDate(0, 0, 1)) {
+		t.Fatal("the next delivery should still be at 09:00", sp.ScheduledAt)
+	}
+
+	Must(store.ScheduledPost().PermanentDeleteByUser(o1.UserId))
+}
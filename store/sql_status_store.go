@@ -0,0 +1,150 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package store
+
+import (
+	"strconv"
+
+	"github.com/mattermost/platform/model"
+)
+
+type SqlStatusStore struct {
+	*SqlStore
+}
+
+func NewSqlStatusStore(sqlStore *SqlStore) StatusStore {
+	s := &SqlStatusStore{sqlStore}
+
+	for _, db := range sqlStore.GetAllConns() {
+		table := db.AddTableWithName(model.Status{}, "Status").SetKeys(false, "UserId")
+		table.ColMap("UserId").SetMaxSize(26)
+		table.ColMap("Manual").SetMaxSize(32)
+		table.ColMap("DndStartTime").SetMaxSize(5)
+		table.ColMap("DndEndTime").SetMaxSize(5)
+		table.ColMap("DndDays").SetMaxSize(7)
+		table.ColMap("Timezone").SetMaxSize(64)
+	}
+
+	return s
+}
+
+func (s SqlStatusStore) UpgradeSchemaIfNeeded() {
+}
+
+func (s SqlStatusStore) CreateIndexesIfNotExists() {
+}
+
+func (s SqlStatusStore) SaveOrUpdate(status *model.Status) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		status.PreSave()
+		if result.Err = status.IsValid(); result.Err != nil {
+			storeChannel <- result
+			close(storeChannel)
+			return
+		}
+
+		if count, err := s.GetMaster().Update(status); err != nil {
+			result.Err = model.NewLocAppError("SqlStatusStore.SaveOrUpdate", "store.sql_status.update.app_error", nil, "user_id="+status.UserId+", "+err.Error())
+		} else if count == 0 {
+			if err := s.GetMaster().Insert(status); err != nil {
+				result.Err = model.NewLocAppError("SqlStatusStore.SaveOrUpdate", "store.sql_status.save.app_error", nil, "user_id="+status.UserId+", "+err.Error())
+			}
+		}
+
+		if result.Err == nil {
+			result.Data = status
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+func (s SqlStatusStore) Get(userId string) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		if obj, err := s.GetReplica().Get(model.Status{}, userId); err != nil {
+			result.Err = model.NewLocAppError("SqlStatusStore.Get", "store.sql_status.get.app_error", nil, "user_id="+userId+", "+err.Error())
+		} else if obj == nil {
+			result.Err = model.NewLocAppError("SqlStatusStore.Get", "store.sql_status.get.missing.app_error", nil, "user_id="+userId)
+		} else {
+			result.Data = obj.(*model.Status)
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+// GetByUserIds returns the statuses that have been set by any of the users,
+// keyed by user id. Users that haven't set a status are left out.
+func (s SqlStatusStore) GetByUserIds(userIds []string) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		statusMap := map[string]*model.Status{}
+
+		if len(userIds) > 0 {
+			params := map[string]interface{}{}
+			inClause := ""
+			for i, userId := range userIds {
+				paramName := "UserId" + strconv.Itoa(i)
+				if i > 0 {
+					inClause += ", "
+				}
+				inClause += ":" + paramName
+				params[paramName] = userId
+			}
+
+			var statuses []*model.Status
+			if _, err := s.GetReplica().Select(&statuses, "SELECT * FROM Status WHERE UserId IN ("+inClause+")", params); err != nil {
+				result.Err = model.NewLocAppError("SqlStatusStore.GetByUserIds", "store.sql_status.get_by_user_ids.app_error", nil, err.Error())
+				storeChannel <- result
+				close(storeChannel)
+				return
+			}
+
+			for _, status := range statuses {
+				statusMap[status.UserId] = status
+			}
+		}
+
+		result.Data = statusMap
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+func (s SqlStatusStore) PermanentDeleteByUser(userId string) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		if _, err := s.GetMaster().Exec("DELETE FROM Status WHERE UserId = :UserId", map[string]interface{}{"UserId": userId}); err != nil {
+			result.Err = model.NewLocAppError("SqlStatusStore.PermanentDeleteByUser", "store.sql_status.permanent_delete_by_user.app_error", nil, "user_id="+userId+", "+err.Error())
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
@@ -0,0 +1,52 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package store
+
+import (
+	"testing"
+
+	"github.com/mattermost/platform/model"
+)
+
+func TestStatusStore(t *testing.T) {
+	Setup()
+
+	o1 := &model.Status{UserId: model.NewId(), Manual: model.USER_AWAY}
+	Must(store.Status().SaveOrUpdate(o1))
+
+	o1.Manual = model.USER_DND
+	o1.DndStartTime = "22:00"
+	o1.DndEndTime = "07:00"
+	Must(store.Status().SaveOrUpdate(o1))
+
+	if status := Must(store.Status().Get(o1.UserId)).(*model.Status); status.Manual != model.USER_DND || status.DndEndTime != "07:00" {
+		t.Fatal("should have updated the status")
+	}
+
+	if err := (<-store.Status().Get(model.NewId())).Err; err == nil {
+		t.Fatal("Missing id should have failed")
+	}
+
+	o2 := &model.Status{UserId: model.NewId(), Manual: model.USER_ONLINE}
+	if err := (<-store.Status().SaveOrUpdate(&model.Status{UserId: o2.UserId, Manual: "junk"})).Err; err == nil {
+		t.Fatal("shouldn't save an invalid status")
+	}
+	Must(store.Status().SaveOrUpdate(o2))
+
+	statuses := Must(store.Status().GetByUserIds([]string{o1.UserId, o2.UserId, model.NewId()})).(map[string]*model.Status)
+	if len(statuses) != 2 || statuses[o1.UserId].Manual != model.USER_DND || statuses[o2.UserId].Manual != model.USER_ONLINE {
+		t.Fatal("should have returned the statuses that were set")
+	}
+
+	if statuses := Must(store.Status().GetByUserIds([]string{})).(map[string]*model.Status); len(statuses) != 0 {
+		t.Fatal("shouldn't return anything without any users")
+	}
+
+	Must(store.Status().PermanentDeleteByUser(o1.UserId))
+	Must(store.Status().PermanentDeleteByUser(o2.UserId))
+
+	if err := (<-store.Status().Get(o1.UserId)).Err; err == nil {
+		t.Fatal("should have deleted the status")
+	}
+}
@@ -36,21 +36,31 @@ const (
 )
 
 type SqlStore struct {
-	master     *gorp.DbMap
-	replicas   []*gorp.DbMap
-	team       TeamStore
-	channel    ChannelStore
-	post       PostStore
-	user       UserStore
-	audit      AuditStore
-	compliance ComplianceStore
-	session    SessionStore
-	oauth      OAuthStore
-	system     SystemStore
-	webhook    WebhookStore
-	command    CommandStore
-	preference PreferenceStore
-	license    LicenseStore
+	master            *gorp.DbMap
+	replicas          []*gorp.DbMap
+	team              TeamStore
+	channel           ChannelStore
+	post              PostStore
+	user              UserStore
+	audit             AuditStore
+	compliance        ComplianceStore
+	session           SessionStore
+	oauth             OAuthStore
+	system            SystemStore
+	webhook           WebhookStore
+	command           CommandStore
+	preference        PreferenceStore
+	license           LicenseStore
+	thread            ThreadStore
+	reaction          ReactionStore
+	scheduledPost     ScheduledPostStore
+	emailNotification EmailNotificationStore
+	status            StatusStore
+	userAccessToken   UserAccessTokenStore
+	role              RoleStore
+	uploadSession     UploadSessionStore
+	fileInfo          FileInfoStore
+	fileContent       FileContentStore
 }
 
 func NewSqlStore() Store {
@@ -107,6 +117,16 @@ func NewSqlStore() Store {
 	sqlStore.command = NewSqlCommandStore(sqlStore)
 	sqlStore.preference = NewSqlPreferenceStore(sqlStore)
 	sqlStore.license = NewSqlLicenseStore(sqlStore)
+	sqlStore.thread = NewSqlThreadStore(sqlStore)
+	sqlStore.reaction = NewSqlReactionStore(sqlStore)
+	sqlStore.scheduledPost = NewSqlScheduledPostStore(sqlStore)
+	sqlStore.emailNotification = NewSqlEmailNotificationStore(sqlStore)
+	sqlStore.status = NewSqlStatusStore(sqlStore)
+	sqlStore.userAccessToken = NewSqlUserAccessTokenStore(sqlStore)
+	sqlStore.role = NewSqlRoleStore(sqlStore)
+	sqlStore.uploadSession = NewSqlUploadSessionStore(sqlStore)
+	sqlStore.fileInfo = NewSqlFileInfoStore(sqlStore)
+	sqlStore.fileContent = NewSqlFileContentStore(sqlStore)
 
 	err := sqlStore.master.CreateTablesIfNotExists()
 	if err != nil {
@@ -126,6 +146,18 @@ func NewSqlStore() Store {
 	sqlStore.command.(*SqlCommandStore).UpgradeSchemaIfNeeded()
 	sqlStore.preference.(*SqlPreferenceStore).UpgradeSchemaIfNeeded()
 	sqlStore.license.(*SqlLicenseStore).UpgradeSchemaIfNeeded()
+	sqlStore.thread.(*SqlThreadStore).UpgradeSchemaIfNeeded()
+	sqlStore.reaction.(*SqlReactionStore).UpgradeSchemaIfNeeded()
+	sqlStore.scheduledPost.(*SqlScheduledPostStore).UpgradeSchemaIfNeeded()
+	sqlStore.emailNotification.(*SqlEmailNotificationStore).UpgradeSchemaIfNeeded()
+	sqlStore.status.(*SqlStatusStore).UpgradeSchemaIfNeeded()
+	sqlStore.userAccessToken.(*SqlUserAccessTokenStore).UpgradeSchemaIfNeeded()
+	sqlStore.role.(*SqlRoleStore).UpgradeSchemaIfNeeded()
+	sqlStore.uploadSession.(*SqlUploadSessionStore).UpgradeSchemaIfNeeded()
+	sqlStore.fileInfo.(*SqlFileInfoStore).UpgradeSchemaIfNeeded()
+	sqlStore.fileContent.(*SqlFileContentStore).UpgradeSchemaIfNeeded()
+
+	sqlStore.MigrateToTeamMembers()
 
 	sqlStore.team.(*SqlTeamStore).CreateIndexesIfNotExists()
 	sqlStore.channel.(*SqlChannelStore).CreateIndexesIfNotExists()
@@ -140,8 +172,19 @@ func NewSqlStore() Store {
 	sqlStore.command.(*SqlCommandStore).CreateIndexesIfNotExists()
 	sqlStore.preference.(*SqlPreferenceStore).CreateIndexesIfNotExists()
 	sqlStore.license.(*SqlLicenseStore).CreateIndexesIfNotExists()
+	sqlStore.thread.(*SqlThreadStore).CreateIndexesIfNotExists()
+	sqlStore.reaction.(*SqlReactionStore).CreateIndexesIfNotExists()
+	sqlStore.scheduledPost.(*SqlScheduledPostStore).CreateIndexesIfNotExists()
+	sqlStore.emailNotification.(*SqlEmailNotificationStore).CreateIndexesIfNotExists()
+	sqlStore.status.(*SqlStatusStore).CreateIndexesIfNotExists()
+	sqlStore.userAccessToken.(*SqlUserAccessTokenStore).CreateIndexesIfNotExists()
+	sqlStore.role.(*SqlRoleStore).CreateIndexesIfNotExists()
+	sqlStore.uploadSession.(*SqlUploadSessionStore).CreateIndexesIfNotExists()
+	sqlStore.fileInfo.(*SqlFileInfoStore).CreateIndexesIfNotExists()
+	sqlStore.fileContent.(*SqlFileContentStore).CreateIndexesIfNotExists()
 
 	sqlStore.preference.(*SqlPreferenceStore).DeleteUnusedFeatures()
+	sqlStore.role.(*SqlRoleStore).CreateDefaultRolesIfNotExist()
 
 	if model.IsPreviousVersionsSupported(schemaVersion) && !model.IsCurrentVersion(schemaVersion) {
 		sqlStore.system.Update(&model.System{Name: "Version", Value: model.CurrentVersion})
@@ -623,6 +666,46 @@ func (ss SqlStore) License() LicenseStore {
 	return ss.license
 }
 
+func (ss SqlStore) Thread() ThreadStore {
+	return ss.thread
+}
+
+func (ss SqlStore) Reaction() ReactionStore {
+	return ss.reaction
+}
+
+func (ss SqlStore) ScheduledPost() ScheduledPostStore {
+	return ss.scheduledPost
+}
+
+func (ss SqlStore) EmailNotification() EmailNotificationStore {
+	return ss.emailNotification
+}
+
+func (ss SqlStore) Status() StatusStore {
+	return ss.status
+}
+
+func (ss SqlStore) UserAccessToken() UserAccessTokenStore {
+	return ss.userAccessToken
+}
+
+func (ss SqlStore) Role() RoleStore {
+	return ss.role
+}
+
+func (ss SqlStore) UploadSession() UploadSessionStore {
+	return ss.uploadSession
+}
+
+func (ss SqlStore) FileInfo() FileInfoStore {
+	return ss.fileInfo
+}
+
+func (ss SqlStore) FileContent() FileContentStore {
+	return ss.fileContent
+}
+
 type mattermConverter struct{}
 
 func (me mattermConverter) ToDb(val interface{}) (interface{}, error) {
@@ -0,0 +1,331 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package store
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	l4g "github.com/alecthomas/log4go"
+	"github.com/go-gorp/gorp"
+	"github.com/mattermost/platform/model"
+	"github.com/mattermost/platform/utils"
+)
+
+// the columns that point at a user and need to follow them when two accounts
+// are merged, see mergeUsers
+var userReferenceColumns = [][2]string{
+	{"Posts", "UserId"},
+	{"ChannelMembers", "UserId"},
+	{"Channels", "CreatorId"},
+	{"Reactions", "UserId"},
+	{"ThreadMembers", "UserId"},
+	{"ScheduledPosts", "UserId"},
+	{"EmailNotifications", "UserId"},
+	{"IncomingWebhooks", "UserId"},
+	{"OutgoingWebhooks", "CreatorId"},
+	{"Commands", "CreatorId"},
+	{"CommandWebhooks", "UserId"},
+	{"OAuthApps", "CreatorId"},
+	{"OAuthAuthData", "UserId"},
+	{"Compliances", "UserId"},
+	{"Audits", "UserId"},
+}
+
+// MigrateToTeamMembers moves from one account per team to accounts that can
+// belong to many teams, see planTeamMemberMigration. The users and their team
+// members are moved over in one transaction and the migration is only marked
+// as done once the unique constraints have been replaced, so a server that
+// stops part way through picks it up again on its next start.
+func (ss SqlStore) MigrateToTeamMembers() {
+	if result := <-ss.system.GetByName(model.SYSTEM_MIGRATED_TO_TEAM_MEMBERS); result.Err == nil {
+		return
+	}
+
+	var users []*model.User
+	if _, err := ss.GetMaster().Select(&users, "SELECT * FROM Users ORDER BY DeleteAt, CreateAt"); err != nil {
+		ss.migrationFailed(err)
+	}
+
+	if len(users) > 0 {
+		l4g.Warn(utils.T("store.sql.migrate_team_members.start.warn"), len(users))
+	}
+
+	if err := ss.migrateUsersToTeamMembers(users); err != nil {
+		ss.migrationFailed(err)
+	}
+
+	if err := ss.replaceUserUniqueConstraints(); err != nil {
+		ss.migrationFailed(err)
+	}
+
+	if result := <-ss.system.Save(&model.System{Name: model.SYSTEM_MIGRATED_TO_TEAM_MEMBERS, Value: strconv.FormatInt(model.GetMillis(), 10)}); result.Err != nil {
+		ss.migrationFailed(result.Err)
+	}
+}
+
+// teamMemberMigration is what happens to a single user when moving to team
+// members.
+type teamMemberMigration struct {
+	User     *model.User
+	Member   *model.TeamMember
+	Survivor *model.User // the account that User is merged into, if any
+
+	OldUsername string
+	OldEmail    string
+	OldRoles    string
+}
+
+// planTeamMemberMigration works out what happens to each user, which should be
+// ordered by DeleteAt and then CreateAt. Every user becomes a member of the team
+// they were created in, taking any team admin role with them.
+//
+// Accounts in different teams that share a verified email address are merged
+// into a single one. An SSO account is kept over one that signs in with a
+// password, then an active account over a deactivated one and then the oldest.
+// The kept account holds on to its own password and SSO login. An account that
+// hasn't verified the address, or that signs in through a different SSO login,
+// is never merged since that would hand it to whoever owns the other account.
+// Those accounts are given a unique email address instead, as are all but the
+// first of a set of accounts where none have been verified. Usernames that clash
+// across teams are made unique too.
+func planTeamMemberMigration(users []*model.User) []*teamMemberMigration {
+	survivors := make(map[string]*model.User)
+	emails := make(map[string]bool)
+	for _, user := range users {
+		email := strings.ToLower(user.Email)
+		emails[email] = true
+
+		if !user.EmailVerified {
+			continue
+		}
+
+		if survivor, ok := survivors[email]; !ok || (survivor.AuthService == "" && user.AuthService != "") {
+			survivors[email] = user
+		}
+	}
+
+	kept := make(map[string]bool)
+	usernames := make(map[string]bool)
+	migrations := make([]*teamMemberMigration, 0, len(users))
+
+	for _, user := range users {
+		migration := &teamMemberMigration{
+			User:        user,
+			Member:      &model.TeamMember{TeamId: user.TeamId, UserId: user.Id},
+			OldUsername: user.Username,
+			OldEmail:    user.Email,
+			OldRoles:    user.Roles,
+		}
+		migrations = append(migrations, migration)
+
+		if model.IsInRole(user.Roles, model.ROLE_TEAM_ADMIN) {
+			migration.Member.Roles = model.ROLE_TEAM_ADMIN
+		}
+
+		email := strings.ToLower(user.Email)
+		survivor := survivors[email]
+
+		if survivor != nil && survivor != user && user.EmailVerified &&
+			(user.AuthService == "" || (user.AuthService == survivor.AuthService && user.AuthData == survivor.AuthData)) {
+			migration.Survivor = survivor
+			migration.Member.UserId = survivor.Id
+
+			// an account that had been deactivated stays out of its team
+			migration.Member.DeleteAt = user.DeleteAt
+			continue
+		}
+
+		if (survivor == nil && kept[email]) || (survivor != nil && survivor != user) {
+			local, domain := email, ""
+			if i := strings.LastIndex(email, "@"); i >= 0 {
+				local, domain = email[:i], email[i:]
+			}
+
+			for i := 1; emails[email]; i++ {
+				email = fmt.Sprintf("%v+%v%v", local, i, domain)
+			}
+			emails[email] = true
+
+			user.Email = email
+			user.EmailVerified = false
+		}
+		kept[email] = true
+
+		for i := 1; usernames[user.Username]; i++ {
+			user.Username = fmt.Sprintf("%v-%v", migration.OldUsername, i)
+		}
+		usernames[user.Username] = true
+
+		// team admin is now a role on the team member
+		roles := []string{}
+		for _, role := range strings.Fields(user.Roles) {
+			if role != model.ROLE_TEAM_ADMIN {
+				roles = append(roles, role)
+			}
+		}
+		user.Roles = strings.Join(roles, " ")
+	}
+
+	return migrations
+}
+
+// migrateUsersToTeamMembers carries out the plan for the given users in a
+// single transaction. Team members that already exist are left alone so that it
+// can run again over users that have been moved already.
+func (ss SqlStore) migrateUsersToTeamMembers(users []*model.User) error {
+	transaction, err := ss.GetMaster().Begin()
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range planTeamMemberMigration(users) {
+		user := migration.User
+
+		if migration.Survivor != nil {
+			if err := mergeUsers(transaction, user, migration.Survivor); err != nil {
+				transaction.Rollback()
+				return err
+			}
+		} else if user.Username != migration.OldUsername || user.Email != migration.OldEmail || user.Roles != migration.OldRoles {
+			if _, err := transaction.Exec("UPDATE Users SET Username = :Username, Email = :Email, EmailVerified = :EmailVerified, Roles = :Roles WHERE Id = :Id",
+				map[string]interface{}{"Username": user.Username, "Email": user.Email, "EmailVerified": user.EmailVerified, "Roles": user.Roles, "Id": user.Id}); err != nil {
+				transaction.Rollback()
+				return err
+			}
+
+			if user.Username != migration.OldUsername {
+				l4g.Info(utils.T("store.sql.migrate_team_members.username.info"), user.Id, migration.OldUsername, user.Username)
+			}
+
+			if user.Email != migration.OldEmail {
+				l4g.Info(utils.T("store.sql.migrate_team_members.email.info"), user.Id, migration.OldEmail, user.Email)
+			}
+		}
+
+		member := migration.Member
+		if count, err := transaction.SelectInt("SELECT COUNT(0) FROM TeamMembers WHERE TeamId = :TeamId AND UserId = :UserId",
+			map[string]interface{}{"TeamId": member.TeamId, "UserId": member.UserId}); err != nil {
+			transaction.Rollback()
+			return err
+		} else if count == 0 {
+			if err := transaction.Insert(member); err != nil {
+				transaction.Rollback()
+				return err
+			}
+		}
+	}
+
+	return transaction.Commit()
+}
+
+// mergeUsers moves everything owned by user over to survivor and then removes
+// user.
+func mergeUsers(transaction *gorp.Transaction, user *model.User, survivor *model.User) error {
+	params := map[string]interface{}{"OldId": user.Id, "NewId": survivor.Id}
+
+	for _, column := range userReferenceColumns {
+		if _, err := transaction.Exec("UPDATE "+column[0]+" SET "+column[1]+" = :NewId WHERE "+column[1]+" = :OldId", params); err != nil {
+			return err
+		}
+	}
+
+	// direct channels are named after the two users in them
+	var channels []*model.Channel
+	if _, err := transaction.Select(&channels, "SELECT * FROM Channels WHERE Type = :Type AND Name LIKE :Name",
+		map[string]interface{}{"Type": model.CHANNEL_DIRECT, "Name": "%" + user.Id + "%"}); err != nil {
+		return err
+	}
+
+	for _, channel := range channels {
+		ids := strings.Split(channel.Name, "__")
+		if len(ids) != 2 {
+			continue
+		}
+
+		for i := range ids {
+			if ids[i] == user.Id {
+				ids[i] = survivor.Id
+			}
+		}
+
+		if _, err := transaction.Exec("UPDATE Channels SET Name = :Name WHERE Id = :Id",
+			map[string]interface{}{"Name": model.GetDMNameFromIds(ids[0], ids[1]), "Id": channel.Id}); err != nil {
+			return err
+		}
+	}
+
+	// keep the survivor's preferences where both accounts have one
+	var preferences []*model.Preference
+	if _, err := transaction.Select(&preferences, "SELECT * FROM Preferences WHERE UserId = :OldId", params); err != nil {
+		return err
+	}
+
+	for _, preference := range preferences {
+		if count, err := transaction.SelectInt("SELECT COUNT(0) FROM Preferences WHERE UserId = :NewId AND Category = :Category AND Name = :Name",
+			map[string]interface{}{"NewId": survivor.Id, "Category": preference.Category, "Name": preference.Name}); err != nil {
+			return err
+		} else if count == 0 {
+			preference.UserId = survivor.Id
+			if err := transaction.Insert(preference); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, table := range []string{"Preferences", "Sessions", "Status", "Users"} {
+		column := "UserId"
+		if table == "Users" {
+			column = "Id"
+		}
+
+		if _, err := transaction.Exec("DELETE FROM "+table+" WHERE "+column+" = :OldId", params); err != nil {
+			return err
+		}
+	}
+
+	l4g.Info(utils.T("store.sql.migrate_team_members.merged.info"), user.Id, survivor.Id, user.Email)
+
+	return nil
+}
+
+// replaceUserUniqueConstraints swaps the per team unique constraints on email
+// and username for ones that cover every user. New databases are created with
+// the right constraints already.
+func (ss SqlStore) replaceUserUniqueConstraints() error {
+	for _, column := range []string{"Email", "Username"} {
+		if utils.Cfg.SqlSettings.DriverName == model.DATABASE_DRIVER_POSTGRES {
+			oldName := "users_" + strings.ToLower(column) + "_teamid_key"
+			newName := "users_" + strings.ToLower(column) + "_key"
+
+			if count, err := ss.GetMaster().SelectInt("SELECT COUNT(0) FROM pg_constraint WHERE conname = $1", oldName); err != nil {
+				return err
+			} else if count > 0 {
+				if _, err := ss.GetMaster().Exec("ALTER TABLE Users DROP CONSTRAINT " + oldName + ", ADD CONSTRAINT " + newName + " UNIQUE (" + column + ")"); err != nil {
+					return err
+				}
+			}
+		} else if utils.Cfg.SqlSettings.DriverName == model.DATABASE_DRIVER_MYSQL {
+			// mysql names the index after the first column in the constraint
+			if count, err := ss.GetMaster().SelectInt("SELECT COUNT(0) FROM information_schema.statistics WHERE TABLE_SCHEMA = DATABASE() AND table_name = 'Users' AND index_name = ? AND column_name = 'TeamId'", column); err != nil {
+				return err
+			} else if count > 0 {
+				if _, err := ss.GetMaster().Exec("ALTER TABLE Users DROP INDEX " + column + ", ADD UNIQUE INDEX " + column + " (" + column + ")"); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func (ss SqlStore) migrationFailed(err interface{}) {
+	l4g.Critical(utils.T("store.sql.migrate_team_members.critical"), err)
+	time.Sleep(time.Second)
+	os.Exit(1)
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package store
+
+import (
+	"testing"
+
+	"github.com/mattermost/platform/model"
+)
+
+func TestPlanTeamMemberMigration(t *testing.T) {
+	password := &model.User{Id: model.NewId(), TeamId: model.NewId(), Username: "alice", Email: "alice@example.com", EmailVerified: true, Roles: model.ROLE_TEAM_ADMIN}
+	sso := &model.User{Id: model.NewId(), TeamId: model.NewId(), Username: "alice", Email: "alice@example.com", EmailVerified: true, AuthService: model.USER_AUTH_SERVICE_SAML, AuthData: "1"}
+	unverified := &model.User{Id: model.NewId(), TeamId: model.NewId(), Username: "alice", Email: "alice@example.com"}
+	otherSso := &model.User{Id: model.NewId(), TeamId: model.NewId(), Username: "alice", Email: "alice@example.com", EmailVerified: true, AuthService: model.USER_AUTH_SERVICE_SAML, AuthData: "2"}
+	first := &model.User{Id: model.NewId(), TeamId: model.NewId(), Username: "bob", Email: "bob@example.com"}
+	second := &model.User{Id: model.NewId(), TeamId: model.NewId(), Username: "bob", Email: "bob@example.com"}
+
+	migrations := planTeamMemberMigration([]*model.User{password, sso, unverified, otherSso, first, second})
+
+	if migrations[0].Survivor != sso || migrations[0].Member.UserId != sso.Id || migrations[0].Member.Roles != model.ROLE_TEAM_ADMIN {
+		t.Fatal("should have merged the password account into the sso one")
+	}
+
+	if migrations[1].Survivor != nil || sso.AuthData != "1" || sso.Email != "alice@example.com" || sso.Username != "alice" {
+		t.Fatal("should have kept the sso account as it was")
+	}
+
+	if migrations[2].Survivor != nil || unverified.Email != "alice+1@example.com" || unverified.Username != "alice-1" {
+		t.Fatal("shouldn't have merged an unverified account", unverified.Email, unverified.Username)
+	}
+
+	if migrations[3].Survivor != nil || otherSso.Email != "alice+2@example.com" || otherSso.AuthData != "2" {
+		t.Fatal("shouldn't have merged an account with a different sso login", otherSso.Email)
+	}
+
+	if migrations[4].Survivor != nil || first.Email != "bob@example.com" {
+		t.Fatal("should have kept the first unverified account's email")
+	}
+
+	if migrations[5].Survivor != nil || second.Email != "bob+1@example.com" || second.EmailVerified {
+		t.Fatal("should have given the second unverified account a unique email", second.Email)
+	}
+
+	for _, migration := range migrations {
+		if migration.Survivor == nil && model.IsInRole(migration.User.Roles, model.ROLE_TEAM_ADMIN) {
+			t.Fatal("should have moved team admin onto the team member")
+		}
+	}
+}
+
+func TestMigrateUsersToTeamMembers(t *testing.T) {
+	Setup()
+
+	ss := store.(*SqlStore)
+
+	u1 := &model.User{TeamId: model.NewId(), Email: model.NewId(), Username: model.NewId()}
+	u1 = Must(store.User().Save(u1)).(*model.User)
+	Must(store.User().VerifyEmail(u1.Id))
+	u1.EmailVerified = true
+
+	u2 := &model.User{TeamId: model.NewId(), Email: model.NewId(), Username: model.NewId(), Roles: model.ROLE_TEAM_ADMIN}
+	u2 = Must(store.User().Save(u2)).(*model.User)
+
+	p1 := Must(store.Post().Save(&model.Post{ChannelId: model.NewId(), UserId: u2.Id, Message: "a"})).(*model.Post)
+
+	a1 := &model.AuthData{ClientId: model.NewId(), UserId: u2.Id, Code: model.NewId()}
+	a1 = Must(store.OAuth().SaveAuthData(a1)).(*model.AuthData)
+
+	// the email can't be shared in the database anymore so only the
+	// migration sees the accounts as sharing it
+	u2.Email = u1.Email
+	u2.EmailVerified = true
+
+	for i := 0; i < 2; i++ {
+		users := []*model.User{u1, u2}
+		if i > 0 {
+			// the merged account is gone the second time around
+			users = users[:1]
+		}
+
+		if err := ss.migrateUsersToTeamMembers(users); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if r := <-store.User().Get(u2.Id); r.Err == nil {
+		t.Fatal("should have removed the merged account")
+	}
+
+	if post := Must(store.Post().Get(p1.Id)).(*model.PostList).Posts[p1.Id]; post.UserId != u1.Id {
+		t.Fatal("should have moved the post to the kept account")
+	}
+
+	if authData := Must(store.OAuth().GetAuthData(a1.Code)).(*model.AuthData); authData.UserId != u1.Id {
+		t.Fatal("should have moved the oauth grant to the kept account")
+	}
+
+	if member := Must(store.Team().GetMember(u1.TeamId, u1.Id)).(*model.TeamMember); member.Roles != "" {
+		t.Fatal("should have made the kept account a member of its team")
+	}
+
+	if member := Must(store.Team().GetMember(u2.TeamId, u1.Id)).(*model.TeamMember); member.Roles != model.ROLE_TEAM_ADMIN {
+		t.Fatal("should have made the kept account a member of the merged account's team")
+	}
+
+	if members := Must(store.Team().GetTeamsForUser(u1.Id)).([]*model.TeamMember); len(members) != 2 {
+		t.Fatal("shouldn't have added the members twice", len(members))
+	}
+}
@@ -4,6 +4,7 @@
 package store
 
 import (
+	"database/sql"
 	"github.com/mattermost/platform/model"
 	"github.com/mattermost/platform/utils"
 	"strings"
@@ -25,6 +26,11 @@ func NewSqlTeamStore(sqlStore *SqlStore) TeamStore {
 		table.ColMap("CompanyName").SetMaxSize(64)
 		table.ColMap("AllowedDomains").SetMaxSize(500)
 		table.ColMap("InviteId").SetMaxSize(32)
+
+		tablem := db.AddTableWithName(model.TeamMember{}, "TeamMembers").SetKeys(false, "TeamId", "UserId")
+		tablem.ColMap("TeamId").SetMaxSize(26)
+		tablem.ColMap("UserId").SetMaxSize(26)
+		tablem.ColMap("Roles").SetMaxSize(64)
 	}
 
 	return s
@@ -36,6 +42,9 @@ func (s SqlTeamStore) UpgradeSchemaIfNeeded() {
 func (s SqlTeamStore) CreateIndexesIfNotExists() {
 	s.CreateIndexIfNotExists("idx_teams_name", "Teams", "Name")
 	s.CreateIndexIfNotExists("idx_teams_invite_id", "Teams", "InviteId")
+
+	s.CreateIndexIfNotExists("idx_teammembers_team_id", "TeamMembers", "TeamId")
+	s.CreateIndexIfNotExists("idx_teammembers_user_id", "TeamMembers", "UserId")
 }
 
 func (s SqlTeamStore) Save(team *model.Team) StoreChannel {
@@ -227,7 +236,7 @@ func (s SqlTeamStore) GetTeamsForEmail(email string) StoreChannel {
 		email = strings.ToLower(email)
 
 		var data []*model.Team
-		if _, err := s.GetReplica().Select(&data, "SELECT Teams.* FROM Teams, Users WHERE Teams.Id = Users.TeamId AND Users.Email = :Email", map[string]interface{}{"Email": email}); err != nil {
+		if _, err := s.GetReplica().Select(&data, "SELECT Teams.* FROM Teams, TeamMembers, Users WHERE Teams.Id = TeamMembers.TeamId AND TeamMembers.UserId = Users.Id AND TeamMembers.DeleteAt = 0 AND Users.Email = :Email", map[string]interface{}{"Email": email}); err != nil {
 			result.Err = model.NewLocAppError("SqlTeamStore.GetTeamsForEmail", "store.sql_team.get_teams_for_email.app_error", nil, "email="+email+", "+err.Error())
 		}
 
@@ -310,7 +319,9 @@ func (s SqlTeamStore) PermanentDelete(teamId string) StoreChannel {
 	go func() {
 		result := StoreResult{}
 
-		if _, err := s.GetMaster().Exec("DELETE FROM Teams WHERE Id = :TeamId", map[string]interface{}{"TeamId": teamId}); err != nil {
+		if _, err := s.GetMaster().Exec("DELETE FROM TeamMembers WHERE TeamId = :TeamId", map[string]interface{}{"TeamId": teamId}); err != nil {
+			result.Err = model.NewLocAppError("SqlTeamStore.Delete", "store.sql_team.permanent_delete.app_error", nil, "teamId="+teamId+", "+err.Error())
+		} else if _, err := s.GetMaster().Exec("DELETE FROM Teams WHERE Id = :TeamId", map[string]interface{}{"TeamId": teamId}); err != nil {
 			result.Err = model.NewLocAppError("SqlTeamStore.Delete", "store.sql_team.permanent_delete.app_error", nil, "teamId="+teamId+", "+err.Error())
 		}
 
@@ -339,3 +350,171 @@ func (s SqlTeamStore) AnalyticsTeamCount() StoreChannel {
 
 	return storeChannel
 }
+
+func (s SqlTeamStore) SaveMember(member *model.TeamMember) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		if result.Err = member.IsValid(); result.Err != nil {
+			storeChannel <- result
+			close(storeChannel)
+			return
+		}
+
+		if count, err := s.GetMaster().SelectInt("SELECT COUNT(0) FROM TeamMembers WHERE TeamId = :TeamId AND DeleteAt = 0", map[string]interface{}{"TeamId": member.TeamId}); err != nil {
+			result.Err = model.NewLocAppError("SqlTeamStore.SaveMember", "store.sql_team.save_member.member_count.app_error", nil, "teamId="+member.TeamId+", "+err.Error())
+			storeChannel <- result
+			close(storeChannel)
+			return
+		} else if int(count) >= utils.Cfg.TeamSettings.MaxUsersPerTeam {
+			result.Err = model.NewLocAppError("SqlTeamStore.SaveMember", "store.sql_team.save_member.max_accounts.app_error", nil, "teamId="+member.TeamId)
+			storeChannel <- result
+			close(storeChannel)
+			return
+		}
+
+		if err := s.GetMaster().Insert(member); err != nil {
+			if IsUniqueConstraintError(err.Error(), "TeamId", "teammembers_pkey") {
+				result.Err = model.NewLocAppError("SqlTeamStore.SaveMember", "store.sql_team.save_member.exists.app_error", nil, "team_id="+member.TeamId+", user_id="+member.UserId+", "+err.Error())
+			} else {
+				result.Err = model.NewLocAppError("SqlTeamStore.SaveMember", "store.sql_team.save_member.save.app_error", nil, "team_id="+member.TeamId+", user_id="+member.UserId+", "+err.Error())
+			}
+		} else {
+			result.Data = member
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+func (s SqlTeamStore) UpdateMember(member *model.TeamMember) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		if result.Err = member.IsValid(); result.Err != nil {
+			storeChannel <- result
+			close(storeChannel)
+			return
+		}
+
+		if _, err := s.GetMaster().Update(member); err != nil {
+			result.Err = model.NewLocAppError("SqlTeamStore.UpdateMember", "store.sql_team.update_member.app_error", nil,
+				"team_id="+member.TeamId+", user_id="+member.UserId+", "+err.Error())
+		} else {
+			result.Data = member
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+func (s SqlTeamStore) GetMember(teamId string, userId string) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		var member model.TeamMember
+		if err := s.GetReplica().SelectOne(&member, "SELECT * FROM TeamMembers WHERE TeamId = :TeamId AND UserId = :UserId", map[string]interface{}{"TeamId": teamId, "UserId": userId}); err != nil {
+			if err == sql.ErrNoRows {
+				result.Err = model.NewLocAppError("SqlTeamStore.GetMember", "store.sql_team.get_member.missing.app_error", nil, "team_id="+teamId+", user_id="+userId+", "+err.Error())
+			} else {
+				result.Err = model.NewLocAppError("SqlTeamStore.GetMember", "store.sql_team.get_member.app_error", nil, "team_id="+teamId+", user_id="+userId+", "+err.Error())
+			}
+		} else {
+			result.Data = &member
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+func (s SqlTeamStore) GetMembers(teamId string) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		var members []*model.TeamMember
+		if _, err := s.GetReplica().Select(&members, "SELECT * FROM TeamMembers WHERE TeamId = :TeamId AND DeleteAt = 0", map[string]interface{}{"TeamId": teamId}); err != nil {
+			result.Err = model.NewLocAppError("SqlTeamStore.GetMembers", "store.sql_team.get_members.app_error", nil, "teamId="+teamId+", "+err.Error())
+		} else {
+			result.Data = members
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+func (s SqlTeamStore) GetTeamsForUser(userId string) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		var members []*model.TeamMember
+		if _, err := s.GetReplica().Select(&members, "SELECT * FROM TeamMembers WHERE UserId = :UserId AND DeleteAt = 0", map[string]interface{}{"UserId": userId}); err != nil {
+			result.Err = model.NewLocAppError("SqlTeamStore.GetTeamsForUser", "store.sql_team.get_teams_for_user.app_error", nil, "userId="+userId+", "+err.Error())
+		} else {
+			result.Data = members
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+// RemoveMember marks the user as having left the team. The member is kept so
+// that they can be brought back with their roles, see JoinUserToTeam.
+func (s SqlTeamStore) RemoveMember(teamId string, userId string) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		if _, err := s.GetMaster().Exec("UPDATE TeamMembers SET DeleteAt = :DeleteAt WHERE TeamId = :TeamId AND UserId = :UserId AND DeleteAt = 0",
+			map[string]interface{}{"DeleteAt": model.GetMillis(), "TeamId": teamId, "UserId": userId}); err != nil {
+			result.Err = model.NewLocAppError("SqlTeamStore.RemoveMember", "store.sql_team.remove_member.app_error", nil, "team_id="+teamId+", user_id="+userId+", "+err.Error())
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+func (s SqlTeamStore) RemoveAllMembersByUser(userId string) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		if _, err := s.GetMaster().Exec("DELETE FROM TeamMembers WHERE UserId = :UserId", map[string]interface{}{"UserId": userId}); err != nil {
+			result.Err = model.NewLocAppError("SqlTeamStore.RemoveAllMembersByUser", "store.sql_team.remove_member.app_error", nil, "user_id="+userId+", "+err.Error())
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
@@ -5,6 +5,7 @@ package store
 
 import (
 	"github.com/mattermost/platform/model"
+	"github.com/mattermost/platform/utils"
 	"testing"
 	"time"
 )
@@ -195,6 +196,8 @@ func TestTeamStoreGetForEmail(t *testing.T) {
 	u1.Email = model.NewId()
 	Must(store.User().Save(&u1))
 
+	Must(store.Team().SaveMember(&model.TeamMember{TeamId: o1.Id, UserId: u1.Id}))
+
 	if r1 := <-store.Team().GetTeamsForEmail(u1.Email); r1.Err != nil {
 		t.Fatal(r1.Err)
 	} else {
@@ -281,3 +284,94 @@ func TestTeamCount(t *testing.T) {
 		}
 	}
 }
+
+func TestTeamMembers(t *testing.T) {
+	Setup()
+
+	teamId1 := model.NewId()
+	teamId2 := model.NewId()
+
+	m1 := &model.TeamMember{TeamId: teamId1, UserId: model.NewId()}
+	m2 := &model.TeamMember{TeamId: teamId1, UserId: model.NewId(), Roles: model.ROLE_TEAM_ADMIN}
+	m3 := &model.TeamMember{TeamId: teamId2, UserId: m1.UserId}
+
+	if r1 := <-store.Team().SaveMember(m1); r1.Err != nil {
+		t.Fatal(r1.Err)
+	}
+
+	Must(store.Team().SaveMember(m2))
+	Must(store.Team().SaveMember(m3))
+
+	if r1 := <-store.Team().SaveMember(m1); r1.Err == nil {
+		t.Fatal("shouldn't be able to join the same team twice")
+	}
+
+	if r1 := <-store.Team().GetMembers(teamId1); r1.Err != nil {
+		t.Fatal(r1.Err)
+	} else if ms := r1.Data.([]*model.TeamMember); len(ms) != 2 {
+		t.Fatal("wrong number of members")
+	}
+
+	if r1 := <-store.Team().GetTeamsForUser(m1.UserId); r1.Err != nil {
+		t.Fatal(r1.Err)
+	} else if ms := r1.Data.([]*model.TeamMember); len(ms) != 2 {
+		t.Fatal("should belong to both teams")
+	}
+
+	if r1 := <-store.Team().GetMember(teamId1, m2.UserId); r1.Err != nil {
+		t.Fatal(r1.Err)
+	} else if !r1.Data.(*model.TeamMember).IsTeamAdmin() {
+		t.Fatal("should be a team admin")
+	}
+
+	if r1 := <-store.Team().GetMember(teamId2, m2.UserId); r1.Err == nil {
+		t.Fatal("shouldn't be a member")
+	}
+
+	m2.Roles = ""
+	if r1 := <-store.Team().UpdateMember(m2); r1.Err != nil {
+		t.Fatal(r1.Err)
+	}
+
+	if r1 := <-store.Team().GetMember(teamId1, m2.UserId); r1.Err != nil {
+		t.Fatal(r1.Err)
+	} else if r1.Data.(*model.TeamMember).IsTeamAdmin() {
+		t.Fatal("roles should have been updated")
+	}
+
+	Must(store.Team().RemoveMember(teamId1, m1.UserId))
+
+	if r1 := <-store.Team().GetMembers(teamId1); r1.Err != nil {
+		t.Fatal(r1.Err)
+	} else if ms := r1.Data.([]*model.TeamMember); len(ms) != 1 || ms[0].UserId != m2.UserId {
+		t.Fatal("member should have been removed")
+	}
+
+	if member := Must(store.Team().GetMember(teamId1, m1.UserId)).(*model.TeamMember); member.DeleteAt == 0 {
+		t.Fatal("member should have been kept as having left the team")
+	}
+
+	Must(store.Team().RemoveAllMembersByUser(m1.UserId))
+
+	if r1 := <-store.Team().GetTeamsForUser(m1.UserId); r1.Err != nil {
+		t.Fatal(r1.Err)
+	} else if ms := r1.Data.([]*model.TeamMember); len(ms) != 0 {
+		t.Fatal("should have been removed from every team")
+	}
+}
+
+func TestTeamMembersMaxUsers(t *testing.T) {
+	Setup()
+
+	teamId := model.NewId()
+
+	for i := 0; i < utils.Cfg.TeamSettings.MaxUsersPerTeam; i++ {
+		if r1 := <-store.Team().SaveMember(&model.TeamMember{TeamId: teamId, UserId: model.NewId()}); r1.Err != nil {
+			t.Fatal("couldn't save member", r1.Err)
+		}
+	}
+
+	if r1 := <-store.Team().SaveMember(&model.TeamMember{TeamId: teamId, UserId: model.NewId()}); r1.Err == nil {
+		t.Fatal("should be the limit")
+	}
+}
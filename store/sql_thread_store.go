@@ -0,0 +1,204 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package store
+
+import (
+	"strconv"
+
+	"github.com/mattermost/platform/model"
+)
+
+type SqlThreadStore struct {
+	*SqlStore
+}
+
+func NewSqlThreadStore(sqlStore *SqlStore) ThreadStore {
+	s := &SqlThreadStore{sqlStore}
+
+	for _, db := range sqlStore.GetAllConns() {
+		table := db.AddTableWithName(model.ThreadMember{}, "ThreadMembers").SetKeys(false, "PostId", "UserId")
+		table.ColMap("PostId").SetMaxSize(26)
+		table.ColMap("UserId").SetMaxSize(26)
+	}
+
+	return s
+}
+
+func (s SqlThreadStore) UpgradeSchemaIfNeeded() {
+}
+
+func (s SqlThreadStore) CreateIndexesIfNotExists() {
+	s.CreateIndexIfNotExists("idx_threadmembers_user_id", "ThreadMembers", "UserId")
+}
+
+func (s SqlThreadStore) SaveMember(member *model.ThreadMember) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		member.PreSave()
+		if result.Err = member.IsValid(); result.Err != nil {
+			storeChannel <- result
+			close(storeChannel)
+			return
+		}
+
+		if count, err := s.GetMaster().Update(member); err != nil {
+			result.Err = model.NewLocAppError("SqlThreadStore.SaveMember", "store.sql_thread.save_member.update.app_error", nil, "post_id="+member.PostId+", user_id="+member.UserId+", "+err.Error())
+		} else if count == 0 {
+			if err := s.GetMaster().Insert(member); err != nil {
+				result.Err = model.NewLocAppError("SqlThreadStore.SaveMember", "store.sql_thread.save_member.save.app_error", nil, "post_id="+member.PostId+", user_id="+member.UserId+", "+err.Error())
+			} else {
+				result.Data = member
+			}
+		} else {
+			result.Data = member
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+func (s SqlThreadStore) GetMember(postId string, userId string) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		var member model.ThreadMember
+		err := s.GetReplica().SelectOne(&member, "SELECT * FROM ThreadMembers WHERE PostId = :PostId AND UserId = :UserId", map[string]interface{}{"PostId": postId, "UserId": userId})
+		if err != nil {
+			result.Err = model.NewLocAppError("SqlThreadStore.GetMember", "store.sql_thread.get_member.app_error", nil, "post_id="+postId+", user_id="+userId+", "+err.Error())
+		} else {
+			result.Data = &member
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+func (s SqlThreadStore) UpdateLastViewedAt(postId string, userId string) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		time := model.GetMillis()
+
+		_, err := s.GetMaster().Exec("UPDATE ThreadMembers SET LastViewedAt = :LastViewedAt, LastUpdateAt = :LastUpdateAt WHERE PostId = :PostId AND UserId = :UserId",
+			map[string]interface{}{"LastViewedAt": time, "LastUpdateAt": time, "PostId": postId, "UserId": userId})
+		if err != nil {
+			result.Err = model.NewLocAppError("SqlThreadStore.UpdateLastViewedAt", "store.sql_thread.update_last_viewed_at.app_error", nil, "post_id="+postId+", user_id="+userId+", "+err.Error())
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+func (s SqlThreadStore) GetThreadsForUser(teamId string, userId string, offset int, limit int) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		var members []*model.ThreadMember
+		_, err := s.GetReplica().Select(&members,
+			`SELECT
+			    ThreadMembers.*
+			FROM
+			    ThreadMembers,
+			    Posts,
+			    Channels,
+			    ChannelMembers
+			WHERE
+			    ThreadMembers.UserId = :UserId
+			        AND ThreadMembers.Following = :Following
+			        AND Posts.Id = ThreadMembers.PostId
+			        AND Posts.DeleteAt = 0
+			        AND Channels.Id = Posts.ChannelId
+			        AND Channels.TeamId = :TeamId
+			        AND Channels.DeleteAt = 0
+			        AND ChannelMembers.ChannelId = Channels.Id
+			        AND ChannelMembers.UserId = ThreadMembers.UserId
+			ORDER BY Posts.LastReplyAt DESC
+			LIMIT :Limit OFFSET :Offset`,
+			map[string]interface{}{"UserId": userId, "TeamId": teamId, "Following": true, "Limit": limit, "Offset": offset})
+		if err != nil {
+			result.Err = model.NewLocAppError("SqlThreadStore.GetThreadsForUser", "store.sql_thread.get_threads_for_user.app_error", nil, "user_id="+userId+", "+err.Error())
+			storeChannel <- result
+			close(storeChannel)
+			return
+		}
+
+		threads := model.ThreadList{}
+
+		if len(members) > 0 {
+			params := map[string]interface{}{}
+			inClause := ""
+			for i, member := range members {
+				paramName := "PostId" + strconv.Itoa(i)
+				if i > 0 {
+					inClause += ", "
+				}
+				inClause += ":" + paramName
+				params[paramName] = member.PostId
+			}
+
+			var posts []*model.Post
+			if _, err := s.GetReplica().Select(&posts, "SELECT * FROM Posts WHERE Id IN ("+inClause+")", params); err != nil {
+				result.Err = model.NewLocAppError("SqlThreadStore.GetThreadsForUser", "store.sql_thread.get_threads_for_user.app_error", nil, "user_id="+userId+", "+err.Error())
+				storeChannel <- result
+				close(storeChannel)
+				return
+			}
+
+			postMap := make(map[string]*model.Post, len(posts))
+			for _, post := range posts {
+				post.MakeNonNil()
+				postMap[post.Id] = post
+			}
+
+			// keep the ordering of the membership query
+			for _, member := range members {
+				if post, ok := postMap[member.PostId]; ok {
+					threads = append(threads, model.NewThread(post, member))
+				}
+			}
+		}
+
+		result.Data = threads
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+func (s SqlThreadStore) PermanentDeleteByUser(userId string) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		if _, err := s.GetMaster().Exec("DELETE FROM ThreadMembers WHERE UserId = :UserId", map[string]interface{}{"UserId": userId}); err != nil {
+			result.Err = model.NewLocAppError("SqlThreadStore.PermanentDeleteByUser", "store.sql_thread.permanent_delete_by_user.app_error", nil, "user_id="+userId+", "+err.Error())
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
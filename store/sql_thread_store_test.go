@@ -0,0 +1,89 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package store
+
+import (
+	"testing"
+
+	"github.com/mattermost/platform/model"
+)
+
+func TestThreadStoreSaveGetMember(t *testing.T) {
+	Setup()
+
+	m1 := &model.ThreadMember{PostId: model.NewId(), UserId: model.NewId(), Following: true}
+	Must(store.Thread().SaveMember(m1))
+
+	if r1 := <-store.Thread().GetMember(m1.PostId, m1.UserId); r1.Err != nil {
+		t.Fatal(r1.Err)
+	} else if !r1.Data.(*model.ThreadMember).Following {
+		t.Fatal("should be following")
+	}
+
+	m1.Following = false
+	Must(store.Thread().SaveMember(m1))
+
+	if r2 := <-store.Thread().GetMember(m1.PostId, m1.UserId); r2.Err != nil {
+		t.Fatal(r2.Err)
+	} else if r2.Data.(*model.ThreadMember).Following {
+		t.Fatal("should have unfollowed")
+	}
+
+	if r3 := <-store.Thread().GetMember(m1.PostId, model.NewId()); r3.Err == nil {
+		t.Fatal("should have failed on missing member")
+	}
+}
+
+func TestThreadStoreGetThreadsForUser(t *testing.T) {
+	Setup()
+
+	c1 := &model.Channel{TeamId: model.NewId(), DisplayName: "Channel1", Name: "a" + model.NewId() + "b", Type: model.CHANNEL_OPEN}
+	c1 = Must(store.Channel().Save(c1)).(*model.Channel)
+
+	root := &model.Post{ChannelId: c1.Id, UserId: model.NewId(), Message: "a" + model.NewId() + "b"}
+	root = Must(store.Post().Save(root)).(*model.Post)
+
+	reply := &model.Post{ChannelId: c1.Id, UserId: model.NewId(), Message: "a" + model.NewId() + "b", RootId: root.Id, ParentId: root.Id}
+	reply = Must(store.Post().Save(reply)).(*model.Post)
+
+	Must(store.Thread().SaveMember(&model.ThreadMember{PostId: root.Id, UserId: root.UserId, Following: true, LastViewedAt: root.CreateAt}))
+
+	if threads := Must(store.Thread().GetThreadsForUser(c1.TeamId, root.UserId, 0, 10)).(model.ThreadList); len(threads) != 0 {
+		t.Fatal("should not have returned threads from channels the user isn't a member of")
+	}
+
+	Must(store.Channel().SaveMember(&model.ChannelMember{ChannelId: c1.Id, UserId: root.UserId, NotifyProps: model.GetDefaultChannelNotifyProps()}))
+
+	threads := Must(store.Thread().GetThreadsForUser(c1.TeamId, root.UserId, 0, 10)).(model.ThreadList)
+	if len(threads) != 1 {
+		t.Fatal("should have returned one thread")
+	}
+
+	if threads[0].Post.Id != root.Id || threads[0].Post.ReplyCount != 1 || !threads[0].Unread {
+		t.Fatal("thread didn't match")
+	}
+
+	Must(store.Thread().UpdateLastViewedAt(root.Id, root.UserId))
+
+	threads = Must(store.Thread().GetThreadsForUser(c1.TeamId, root.UserId, 0, 10)).(model.ThreadList)
+	if len(threads) != 1 || threads[0].Unread {
+		t.Fatal("thread should have been read")
+	}
+
+	if threads := Must(store.Thread().GetThreadsForUser(model.NewId(), root.UserId, 0, 10)).(model.ThreadList); len(threads) != 0 {
+		t.Fatal("should not have returned threads from another team")
+	}
+
+	Must(store.Channel().RemoveMember(c1.Id, root.UserId))
+
+	if threads := Must(store.Thread().GetThreadsForUser(c1.TeamId, root.UserId, 0, 10)).(model.ThreadList); len(threads) != 0 {
+		t.Fatal("should not have returned threads from a channel the user has left")
+	}
+
+	Must(store.Thread().PermanentDeleteByUser(root.UserId))
+
+	if threads := Must(store.Thread().GetThreadsForUser(c1.TeamId, root.UserId, 0, 10)).(model.ThreadList); len(threads) != 0 {
+		t.Fatal("should have removed the memberships")
+	}
+}
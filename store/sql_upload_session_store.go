@@ -0,0 +1,268 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package store
+
+import (
+	"github.com/mattermost/platform/model"
+)
+
+type SqlUploadSessionStore struct {
+	*SqlStore
+}
+
+func NewSqlUploadSessionStore(sqlStore *SqlStore) UploadSessionStore {
+	s := &SqlUploadSessionStore{sqlStore}
+
+	for _, db := range sqlStore.GetAllConns() {
+		table := db.AddTableWithName(model.UploadSession{}, "UploadSessions").SetKeys(false, "Id")
+		table.ColMap("Id").SetMaxSize(26)
+		table.ColMap("UserId").SetMaxSize(26)
+		table.ColMap("TeamId").SetMaxSize(26)
+		table.ColMap("ChannelId").SetMaxSize(26)
+		table.ColMap("Filename").SetMaxSize(256)
+		table.ColMap("BackendId").SetMaxSize(512)
+	}
+
+	return s
+}
+
+func (s SqlUploadSessionStore) UpgradeSchemaIfNeeded() {
+	s.CreateColumnIfNotExists("UploadSessions", "LockedUntil", "bigint(20)", "bigint", "0")
+}
+
+func (s SqlUploadSessionStore) CreateIndexesIfNotExists() {
+	s.CreateIndexIfNotExists("idx_uploadsessions_user_id", "UploadSessions", "UserId")
+	s.CreateIndexIfNotExists("idx_uploadsessions_update_at", "UploadSessions", "UpdateAt")
+}
+
+func (s SqlUploadSessionStore) Save(session *model.UploadSession) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		if len(session.Id) > 0 {
+			result.Err = model.NewLocAppError("SqlUploadSessionStore.Save", "store.sql_upload_session.save.existing.app_error", nil, "id="+session.Id)
+			storeChannel <- result
+			close(storeChannel)
+			return
+		}
+
+		session.PreSave()
+		if result.Err = session.IsValid(); result.Err != nil {
+			storeChannel <- result
+			close(storeChannel)
+			return
+		}
+
+		if err := s.GetMaster().Insert(session); err != nil {
+			result.Err = model.NewLocAppError("SqlUploadSessionStore.Save", "store.sql_upload_session.save.app_error", nil, "id="+session.Id+", "+err.Error())
+		} else {
+			result.Data = session
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+func (s SqlUploadSessionStore) Update(session *model.UploadSession) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		session.PreUpdate()
+		if result.Err = session.IsValid(); result.Err != nil {
+			storeChannel <- result
+			close(storeChannel)
+			return
+		}
+
+		if count, err := s.GetMaster().Update(session); err != nil {
+			result.Err = model.NewLocAppError("SqlUploadSessionStore.Update", "store.sql_upload_session.update.app_error", nil, "id="+session.Id+", "+err.Error())
+		} else if count == 0 {
+			// the upload was finished or cancelled while the chunk was being sent
+			result.Err = model.NewLocAppError("SqlUploadSessionStore.Update", "store.sql_upload_session.update.missing.app_error", nil, "id="+session.Id)
+		} else {
+			result.Data = session
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+func (s SqlUploadSessionStore) Get(id string) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		if obj, err := s.GetReplica().Get(model.UploadSession{}, id); err != nil {
+			result.Err = model.NewLocAppError("SqlUploadSessionStore.Get", "store.sql_upload_session.get.app_error", nil, "id="+id+", "+err.Error())
+		} else if obj == nil {
+			result.Err = model.NewLocAppError("SqlUploadSessionStore.Get", "store.sql_upload_session.get.missing.app_error", nil, "id="+id)
+		} else {
+			result.Data = obj.(*model.UploadSession)
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+func (s SqlUploadSessionStore) Delete(id string) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		if _, err := s.GetMaster().Exec("DELETE FROM UploadSessions WHERE Id = :Id", map[string]interface{}{"Id": id}); err != nil {
+			result.Err = model.NewLocAppError("SqlUploadSessionStore.Delete", "store.sql_upload_session.delete.app_error", nil, "id="+id+", "+err.Error())
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+// ClaimChunk locks the session so that only one chunk is written at a time. It
+// only succeeds if nothing has been added to the file since the session was
+// read and no other request holds the lock. The result is true if the session
+// was claimed.
+func (s SqlUploadSessionStore) ClaimChunk(session *model.UploadSession, leaseUntil int64) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		if sqlResult, err := s.GetMaster().Exec(
+			`UPDATE
+				UploadSessions
+			SET
+				LockedUntil = :LeaseUntil
+			WHERE
+				Id = :Id AND FileOffset = :FileOffset AND LockedUntil < :Now`,
+			map[string]interface{}{"LeaseUntil": leaseUntil, "Id": session.Id, "FileOffset": session.FileOffset, "Now": model.GetMillis()}); err != nil {
+			result.Err = model.NewLocAppError("SqlUploadSessionStore.ClaimChunk", "store.sql_upload_session.claim_chunk.app_error", nil, "id="+session.Id+", "+err.Error())
+		} else if rows, err := sqlResult.RowsAffected(); err != nil {
+			result.Err = model.NewLocAppError("SqlUploadSessionStore.ClaimChunk", "store.sql_upload_session.claim_chunk.app_error", nil, "id="+session.Id+", "+err.Error())
+		} else {
+			if rows == 1 {
+				session.LockedUntil = leaseUntil
+			}
+
+			result.Data = rows == 1
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+// SaveChunk records the chunk that was written while the session was claimed
+// and unlocks it. The result is false if the lock ran out or the upload was
+// finished or cancelled in the meantime.
+func (s SqlUploadSessionStore) SaveChunk(session *model.UploadSession) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		session.PreUpdate()
+		if result.Err = session.IsValid(); result.Err != nil {
+			storeChannel <- result
+			close(storeChannel)
+			return
+		}
+
+		if sqlResult, err := s.GetMaster().Exec(
+			`UPDATE
+				UploadSessions
+			SET
+				FileOffset = :FileOffset, Chunks = :Chunks, UpdateAt = :UpdateAt, LockedUntil = 0
+			WHERE
+				Id = :Id AND LockedUntil = :LockedUntil`,
+			map[string]interface{}{"FileOffset": session.FileOffset, "Chunks": session.Chunks, "UpdateAt": session.UpdateAt, "Id": session.Id, "LockedUntil": session.LockedUntil}); err != nil {
+			result.Err = model.NewLocAppError("SqlUploadSessionStore.SaveChunk", "store.sql_upload_session.save_chunk.app_error", nil, "id="+session.Id+", "+err.Error())
+		} else if rows, err := sqlResult.RowsAffected(); err != nil {
+			result.Err = model.NewLocAppError("SqlUploadSessionStore.SaveChunk", "store.sql_upload_session.save_chunk.app_error", nil, "id="+session.Id+", "+err.Error())
+		} else {
+			if rows == 1 {
+				session.LockedUntil = 0
+			}
+
+			result.Data = rows == 1
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+// ReleaseChunk unlocks a session without changing it, which is done when a
+// chunk couldn't be written.
+func (s SqlUploadSessionStore) ReleaseChunk(session *model.UploadSession) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		if _, err := s.GetMaster().Exec("UPDATE UploadSessions SET LockedUntil = 0 WHERE Id = :Id AND LockedUntil = :LockedUntil",
+			map[string]interface{}{"Id": session.Id, "LockedUntil": session.LockedUntil}); err != nil {
+			result.Err = model.NewLocAppError("SqlUploadSessionStore.ReleaseChunk", "store.sql_upload_session.release_chunk.app_error", nil, "id="+session.Id+", "+err.Error())
+		} else {
+			session.LockedUntil = 0
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+// GetExpired returns sessions that haven't had a chunk sent since updatedBefore
+// and aren't having one written right now.
+func (s SqlUploadSessionStore) GetExpired(updatedBefore int64, limit int) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		var sessions []*model.UploadSession
+		if _, err := s.GetMaster().Select(&sessions,
+			`SELECT
+				*
+			FROM
+				UploadSessions
+			WHERE
+				UpdateAt < :UpdatedBefore AND LockedUntil < :Now
+			ORDER BY UpdateAt
+			LIMIT :Limit`,
+			map[string]interface{}{"UpdatedBefore": updatedBefore, "Now": model.GetMillis(), "Limit": limit}); err != nil {
+			result.Err = model.NewLocAppError("SqlUploadSessionStore.GetExpired", "store.sql_upload_session.get_expired.app_error", nil, err.Error())
+		} else {
+			result.Data = sessions
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package store
+
+import (
+	"testing"
+
+	"github.com/mattermost/platform/model"
+)
+
+func TestUploadSessionStore(t *testing.T) {
+	Setup()
+
+	o1 := &model.UploadSession{}
+	o1.UserId = model.NewId()
+	o1.TeamId = model.NewId()
+	o1.ChannelId = model.NewId()
+	o1.Filename = "build.tar.gz"
+	o1.FileSize = 3 * model.UPLOAD_CHUNK_MIN_SIZE
+	o1.BackendId = model.NewId()
+
+	if err := (<-store.UploadSession().Save(o1)).Err; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := (<-store.UploadSession().Save(o1)).Err; err == nil {
+		t.Fatal("shouldn't be able to update from save")
+	}
+
+	o1.FileOffset = model.UPLOAD_CHUNK_MIN_SIZE
+	o1.Chunks = 1
+	Must(store.UploadSession().Update(o1))
+
+	if r := <-store.UploadSession().Get(o1.Id); r.Err != nil {
+		t.Fatal(r.Err)
+	} else if session := r.Data.(*model.UploadSession); session.FileOffset != o1.FileOffset || session.Chunks != 1 || session.BackendId != o1.BackendId {
+		t.Fatal("should have saved the upload's progress")
+	}
+
+	if err := (<-store.UploadSession().Get("123")).Err; err == nil {
+		t.Fatal("Missing id should have failed")
+	}
+
+	stale := *o1
+	if !Must(store.UploadSession().ClaimChunk(o1, model.GetMillis()+60000)).(bool) {
+		t.Fatal("should have claimed the session")
+	}
+
+	if Must(store.UploadSession().ClaimChunk(&stale, model.GetMillis()+60000)).(bool) {
+		t.Fatal("shouldn't be able to claim a session that's locked")
+	}
+
+	Must(store.UploadSession().ReleaseChunk(o1))
+
+	if !Must(store.UploadSession().ClaimChunk(o1, model.GetMillis()+60000)).(bool) {
+		t.Fatal("should have claimed the released session")
+	}
+
+	o1.FileOffset += model.UPLOAD_CHUNK_MIN_SIZE
+	o1.Chunks++
+	if !Must(store.UploadSession().SaveChunk(o1)).(bool) {
+		t.Fatal("should have saved the chunk")
+	}
+
+	if Must(store.UploadSession().ClaimChunk(&stale, model.GetMillis()+60000)).(bool) {
+		t.Fatal("shouldn't be able to claim a session at an old offset")
+	}
+
+	if Must(store.UploadSession().SaveChunk(&stale)).(bool) {
+		t.Fatal("shouldn't be able to save a chunk without claiming the session")
+	}
+
+	if r := <-store.UploadSession().Get(o1.Id); r.Err != nil {
+		t.Fatal(r.Err)
+	} else if session := r.Data.(*model.UploadSession); session.FileOffset != 2*model.UPLOAD_CHUNK_MIN_SIZE || session.Chunks != 2 {
+		t.Fatal("should have saved the chunk's progress")
+	}
+
+	found := false
+	for _, session := range Must(store.UploadSession().GetExpired(o1.UpdateAt+1, 1000)).([]*model.UploadSession) {
+		found = found || session.Id == o1.Id
+	}
+
+	if !found {
+		t.Fatal("should have found the expired upload")
+	}
+
+	for _, session := range Must(store.UploadSession().GetExpired(o1.UpdateAt, 1000)).([]*model.UploadSession) {
+		if session.Id == o1.Id {
+			t.Fatal("shouldn't have found an upload that's still going")
+		}
+	}
+
+	Must(store.UploadSession().Delete(o1.Id))
+
+	if err := (<-store.UploadSession().Update(o1)).Err; err == nil {
+		t.Fatal("shouldn't be able to update a finished upload")
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package store
+
+import (
+	"database/sql"
+
+	"github.com/mattermost/platform/model"
+)
+
+type SqlUserAccessTokenStore struct {
+	*SqlStore
+}
+
+func NewSqlUserAccessTokenStore(sqlStore *SqlStore) UserAccessTokenStore {
+	s := &SqlUserAccessTokenStore{sqlStore}
+
+	for _, db := range sqlStore.GetAllConns() {
+		table := db.AddTableWithName(model.UserAccessToken{}, "UserAccessTokens").SetKeys(false, "Id")
+		table.ColMap("Id").SetMaxSize(26)
+		table.ColMap("TokenHash").SetMaxSize(64).SetUnique(true)
+		table.ColMap("UserId").SetMaxSize(26)
+		table.ColMap("Description").SetMaxSize(256)
+		table.ColMap("Scopes").SetMaxSize(64)
+	}
+
+	return s
+}
+
+func (s SqlUserAccessTokenStore) UpgradeSchemaIfNeeded() {
+}
+
+func (s SqlUserAccessTokenStore) CreateIndexesIfNotExists() {
+	s.CreateIndexIfNotExists("idx_user_access_tokens_user_id", "UserAccessTokens", "UserId")
+}
+
+func (s SqlUserAccessTokenStore) Save(token *model.UserAccessToken) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		if len(token.Id) > 0 {
+			result.Err = model.NewLocAppError("SqlUserAccessTokenStore.Save", "store.sql_user_access_token.save.existing.app_error", nil, "id="+token.Id)
+			storeChannel <- result
+			close(storeChannel)
+			return
+		}
+
+		token.PreSave()
+		if result.Err = token.IsValid(); result.Err != nil {
+			storeChannel <- result
+			close(storeChannel)
+			return
+		}
+
+		if err := s.GetMaster().Insert(token); err != nil {
+			result.Err = model.NewLocAppError("SqlUserAccessTokenStore.Save", "store.sql_user_access_token.save.app_error", nil, "user_id="+token.UserId+", "+err.Error())
+		} else {
+			result.Data = token
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+func (s SqlUserAccessTokenStore) Get(id string) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		var token model.UserAccessToken
+		if err := s.GetReplica().SelectOne(&token, "SELECT * FROM UserAccessTokens WHERE Id = :Id", map[string]interface{}{"Id": id}); err != nil {
+			if err == sql.ErrNoRows {
+				result.Err = model.NewLocAppError("SqlUserAccessTokenStore.Get", "store.sql_user_access_token.get.missing.app_error", nil, "id="+id)
+			} else {
+				result.Err = model.NewLocAppError("SqlUserAccessTokenStore.Get", "store.sql_user_access_token.get.app_error", nil, "id="+id+", "+err.Error())
+			}
+		} else {
+			result.Data = &token
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+// GetByToken looks a token up by its value. Only the hash is stored so that's
+// what gets compared.
+func (s SqlUserAccessTokenStore) GetByToken(tokenString string) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		var token model.UserAccessToken
+		if err := s.GetReplica().SelectOne(&token, "SELECT * FROM UserAccessTokens WHERE TokenHash = :TokenHash",
+			map[string]interface{}{"TokenHash": model.HashUserAccessToken(tokenString)}); err != nil {
+			if err == sql.ErrNoRows {
+				result.Err = model.NewLocAppError("SqlUserAccessTokenStore.GetByToken", "store.sql_user_access_token.get.missing.app_error", nil, "")
+			} else {
+				result.Err = model.NewLocAppError("SqlUserAccessTokenStore.GetByToken", "store.sql_user_access_token.get.app_error", nil, err.Error())
+			}
+		} else {
+			result.Data = &token
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+func (s SqlUserAccessTokenStore) GetByUser(userId string) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		var tokens []*model.UserAccessToken
+		if _, err := s.GetReplica().Select(&tokens, "SELECT * FROM UserAccessTokens WHERE UserId = :UserId ORDER BY CreateAt", map[string]interface{}{"UserId": userId}); err != nil {
+			result.Err = model.NewLocAppError("SqlUserAccessTokenStore.GetByUser", "store.sql_user_access_token.get_by_user.app_error", nil, "user_id="+userId+", "+err.Error())
+		} else {
+			result.Data = tokens
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+func (s SqlUserAccessTokenStore) UpdateLastUsedAt(id string, time int64) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		if _, err := s.GetMaster().Exec("UPDATE UserAccessTokens SET LastUsedAt = :LastUsedAt WHERE Id = :Id", map[string]interface{}{"LastUsedAt": time, "Id": id}); err != nil {
+			result.Err = model.NewLocAppError("SqlUserAccessTokenStore.UpdateLastUsedAt", "store.sql_user_access_token.update_last_used_at.app_error", nil, "id="+id+", "+err.Error())
+		} else {
+			result.Data = id
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+func (s SqlUserAccessTokenStore) Delete(id string) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		if _, err := s.GetMaster().Exec("DELETE FROM UserAccessTokens WHERE Id = :Id", map[string]interface{}{"Id": id}); err != nil {
+			result.Err = model.NewLocAppError("SqlUserAccessTokenStore.Delete", "store.sql_user_access_token.delete.app_error", nil, "id="+id+", "+err.Error())
+		} else {
+			result.Data = id
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+func (s SqlUserAccessTokenStore) PermanentDeleteByUser(userId string) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		if _, err := s.GetMaster().Exec("DELETE FROM UserAccessTokens WHERE UserId = :UserId", map[string]interface{}{"UserId": userId}); err != nil {
+			result.Err = model.NewLocAppError("SqlUserAccessTokenStore.PermanentDeleteByUser", "store.sql_user_access_token.permanent_delete_by_user.app_error", nil, "user_id="+userId+", "+err.Error())
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package store
+
+import (
+	"testing"
+
+	"github.com/mattermost/platform/model"
+)
+
+func TestUserAccessTokenStore(t *testing.T) {
+	Setup()
+
+	t1 := &model.UserAccessToken{UserId: model.NewId(), Description: "script", Scopes: model.USER_ACCESS_TOKEN_SCOPE_READ}
+	t1 = Must(store.UserAccessToken().Save(t1)).(*model.UserAccessToken)
+
+	t2 := &model.UserAccessToken{UserId: t1.UserId, Scopes: model.USER_ACCESS_TOKEN_SCOPE_READ + " " + model.USER_ACCESS_TOKEN_SCOPE_WRITE}
+	t2 = Must(store.UserAccessToken().Save(t2)).(*model.UserAccessToken)
+
+	if r := <-store.UserAccessToken().Save(&model.UserAccessToken{UserId: t1.UserId, Scopes: "admin"}); r.Err == nil {
+		t.Fatal("should have failed on an invalid scope")
+	}
+
+	if r := <-store.UserAccessToken().Save(&model.UserAccessToken{Id: t1.Id, UserId: t1.UserId, Scopes: model.USER_ACCESS_TOKEN_SCOPE_READ}); r.Err == nil {
+		t.Fatal("shouldn't be able to save a token with an existing id")
+	}
+
+	if token := Must(store.UserAccessToken().GetByToken(t1.Token)).(*model.UserAccessToken); token.Id != t1.Id || token.Token != "" {
+		t.Fatal("should have found the token by its value")
+	}
+
+	if r := <-store.UserAccessToken().GetByToken(t1.TokenHash); r.Err == nil {
+		t.Fatal("shouldn't be able to use the hash as a token")
+	}
+
+	if tokens := Must(store.UserAccessToken().GetByUser(t1.UserId)).([]*model.UserAccessToken); len(tokens) != 2 {
+		t.Fatal("should have found both tokens")
+	}
+
+	Must(store.UserAccessToken().UpdateLastUsedAt(t1.Id, 1234))
+
+	if token := Must(store.UserAccessToken().Get(t1.Id)).(*model.UserAccessToken); token.LastUsedAt != 1234 {
+		t.Fatal("should have updated the last use")
+	}
+
+	Must(store.UserAccessToken().Delete(t1.Id))
+
+	if r := <-store.UserAccessToken().Get(t1.Id); r.Err == nil {
+		t.Fatal("should have deleted the token")
+	}
+
+	Must(store.UserAccessToken().PermanentDeleteByUser(t1.UserId))
+
+	if tokens := Must(store.UserAccessToken().GetByUser(t1.UserId)).([]*model.UserAccessToken); len(tokens) != 0 {
+		t.Fatal("should have deleted the user's tokens")
+	}
+}
@@ -7,7 +7,6 @@ import (
 	"database/sql"
 	"fmt"
 	"github.com/mattermost/platform/model"
-	"github.com/mattermost/platform/utils"
 	"strings"
 )
 
@@ -41,8 +40,9 @@ func NewSqlUserStore(sqlStore *SqlStore) UserStore {
 		table.ColMap("ThemeProps").SetMaxSize(2000)
 		table.ColMap("Locale").SetMaxSize(5)
 		table.ColMap("MfaSecret").SetMaxSize(128)
-		table.SetUniqueTogether("Email", "TeamId")
-		table.SetUniqueTogether("Username", "TeamId")
+		table.ColMap("BotOwnerId").SetMaxSize(26)
+		table.ColMap("Email").SetUnique(true)
+		table.ColMap("Username").SetUnique(true)
 	}
 
 	return us
@@ -54,6 +54,10 @@ func (us SqlUserStore) UpgradeSchemaIfNeeded() {
 	// ADDED for 2.2 REMOVE for 2.6
 	us.CreateColumnIfNotExists("Users", "MfaActive", "tinyint(1)", "boolean", "0")
 	us.CreateColumnIfNotExists("Users", "MfaSecret", "varchar(128)", "character varying(128)", "")
+	// ADDED for 2.3 REMOVE for 2.7
+	us.CreateColumnIfNotExists("Users", "IsBot", "tinyint(1)", "boolean", "0")
+	us.CreateColumnIfNotExists("Users", "BotOwnerId", "varchar(26)", "character varying(26)", "")
+	us.CreateColumnIfNotExists("Users", "GuestExpiresAt", "bigint(20)", "bigint", "0")
 }
 
 func (us SqlUserStore) CreateIndexesIfNotExists() {
@@ -82,22 +86,10 @@ func (us SqlUserStore) Save(user *model.User) StoreChannel {
 			return
 		}
 
-		if count, err := us.GetMaster().SelectInt("SELECT COUNT(0) FROM Users WHERE TeamId = :TeamId AND DeleteAt = 0", map[string]interface{}{"TeamId": user.TeamId}); err != nil {
-			result.Err = model.NewLocAppError("SqlUserStore.Save", "store.sql_user.save.member_count.app_error", nil, "teamId="+user.TeamId+", "+err.Error())
-			storeChannel <- result
-			close(storeChannel)
-			return
-		} else if int(count) > utils.Cfg.TeamSettings.MaxUsersPerTeam {
-			result.Err = model.NewLocAppError("SqlUserStore.Save", "store.sql_user.save.max_accounts.app_error", nil, "teamId="+user.TeamId)
-			storeChannel <- result
-			close(storeChannel)
-			return
-		}
-
 		if err := us.GetMaster().Insert(user); err != nil {
-			if IsUniqueConstraintError(err.Error(), "Email", "users_email_teamid_key") {
+			if IsUniqueConstraintError(err.Error(), "Email", "users_email_key") {
 				result.Err = model.NewLocAppError("SqlUserStore.Save", "store.sql_user.save.email_exists.app_error", nil, "user_id="+user.Id+", "+err.Error())
-			} else if IsUniqueConstraintError(err.Error(), "Username", "users_username_teamid_key") {
+			} else if IsUniqueConstraintError(err.Error(), "Username", "users_username_key") {
 				result.Err = model.NewLocAppError("SqlUserStore.Save", "store.sql_user.save.username_exists.app_error", nil, "user_id="+user.Id+", "+err.Error())
 			} else {
 				result.Err = model.NewLocAppError("SqlUserStore.Save", "store.sql_user.save.app_error", nil, "user_id="+user.Id+", "+err.Error())
@@ -147,6 +139,9 @@ func (us SqlUserStore) Update(user *model.User, allowActiveUpdate bool) StoreCha
 			user.FailedAttempts = oldUser.FailedAttempts
 			user.MfaSecret = oldUser.MfaSecret
 			user.MfaActive = oldUser.MfaActive
+			user.IsBot = oldUser.IsBot
+			user.BotOwnerId = oldUser.BotOwnerId
+			user.GuestExpiresAt = oldUser.GuestExpiresAt
 
 			if !allowActiveUpdate {
 				user.Roles = oldUser.Roles
@@ -171,9 +166,9 @@ func (us SqlUserStore) Update(user *model.User, allowActiveUpdate bool) StoreCha
 			}
 
 			if count, err := us.GetMaster().Update(user); err != nil {
-				if IsUniqueConstraintError(err.Error(), "Email", "users_email_teamid_key") {
+				if IsUniqueConstraintError(err.Error(), "Email", "users_email_key") {
 					result.Err = model.NewLocAppError("SqlUserStore.Update", "store.sql_user.update.email_taken.app_error", nil, "user_id="+user.Id+", "+err.Error())
-				} else if IsUniqueConstraintError(err.Error(), "Username", "users_username_teamid_key") {
+				} else if IsUniqueConstraintError(err.Error(), "Username", "users_username_key") {
 					result.Err = model.NewLocAppError("SqlUserStore.Update", "store.sql_user.update.username_taken.app_error", nil, "user_id="+user.Id+", "+err.Error())
 				} else {
 					result.Err = model.NewLocAppError("SqlUserStore.Update", "store.sql_user.update.updating.app_error", nil, "user_id="+user.Id+", "+err.Error())
@@ -398,6 +393,28 @@ func (us SqlUserStore) UpdateMfaActive(userId string, active bool) StoreChannel
 	return storeChannel
 }
 
+func (us SqlUserStore) UpdateGuestExpiresAt(userId string, expiresAt int64) StoreChannel {
+
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		updateAt := model.GetMillis()
+
+		if _, err := us.GetMaster().Exec("UPDATE Users SET GuestExpiresAt = :ExpiresAt, UpdateAt = :UpdateAt WHERE Id = :UserId", map[string]interface{}{"ExpiresAt": expiresAt, "UpdateAt": updateAt, "UserId": userId}); err != nil {
+			result.Err = model.NewLocAppError("SqlUserStore.UpdateGuestExpiresAt", "store.sql_user.update_guest_expires_at.app_error", nil, "id="+userId+", "+err.Error())
+		} else {
+			result.Data = userId
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
 func (us SqlUserStore) Get(id string) StoreChannel {
 
 	storeChannel := make(StoreChannel)
@@ -427,7 +444,7 @@ func (s SqlUserStore) GetEtagForProfiles(teamId string) StoreChannel {
 	go func() {
 		result := StoreResult{}
 
-		updateAt, err := s.GetReplica().SelectInt("SELECT UpdateAt FROM Users WHERE TeamId = :TeamId ORDER BY UpdateAt DESC LIMIT 1", map[string]interface{}{"TeamId": teamId})
+		updateAt, err := s.GetReplica().SelectInt("SELECT Users.UpdateAt FROM Users, TeamMembers WHERE TeamMembers.TeamId = :TeamId AND TeamMembers.UserId = Users.Id AND TeamMembers.DeleteAt = 0 ORDER BY Users.UpdateAt DESC LIMIT 1", map[string]interface{}{"TeamId": teamId})
 		if err != nil {
 			result.Data = fmt.Sprintf("%v.%v", model.CurrentVersion, model.GetMillis())
 		} else {
@@ -450,7 +467,7 @@ func (us SqlUserStore) GetProfiles(teamId string) StoreChannel {
 
 		var users []*model.User
 
-		if _, err := us.GetReplica().Select(&users, "SELECT * FROM Users WHERE TeamId = :TeamId", map[string]interface{}{"TeamId": teamId}); err != nil {
+		if _, err := us.GetReplica().Select(&users, "SELECT Users.* FROM Users, TeamMembers WHERE TeamMembers.TeamId = :TeamId AND TeamMembers.UserId = Users.Id AND TeamMembers.DeleteAt = 0", map[string]interface{}{"TeamId": teamId}); err != nil {
 			result.Err = model.NewLocAppError("SqlUserStore.GetProfiles", "store.sql_user.get_profiles.app_error", nil, err.Error())
 		} else {
 
@@ -503,7 +520,35 @@ func (us SqlUserStore) GetSystemAdminProfiles() StoreChannel {
 	return storeChannel
 }
 
-func (us SqlUserStore) GetByEmail(teamId string, email string) StoreChannel {
+func (us SqlUserStore) GetBotsByOwner(ownerId string) StoreChannel {
+
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		var users []*model.User
+
+		if _, err := us.GetReplica().Select(&users, "SELECT * FROM Users WHERE IsBot = :IsBot AND BotOwnerId = :OwnerId ORDER BY Username",
+			map[string]interface{}{"IsBot": true, "OwnerId": ownerId}); err != nil {
+			result.Err = model.NewLocAppError("SqlUserStore.GetBotsByOwner", "store.sql_user.get_bots_by_owner.app_error", nil, "owner_id="+ownerId+", "+err.Error())
+		} else {
+			for _, u := range users {
+				u.Password = ""
+				u.AuthData = ""
+			}
+
+			result.Data = users
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+func (us SqlUserStore) GetByEmail(email string) StoreChannel {
 
 	storeChannel := make(StoreChannel)
 
@@ -514,8 +559,8 @@ func (us SqlUserStore) GetByEmail(teamId string, email string) StoreChannel {
 
 		user := model.User{}
 
-		if err := us.GetReplica().SelectOne(&user, "SELECT * FROM Users WHERE TeamId = :TeamId AND Email = :Email", map[string]interface{}{"TeamId": teamId, "Email": email}); err != nil {
-			result.Err = model.NewLocAppError("SqlUserStore.GetByEmail", MISSING_ACCOUNT_ERROR, nil, "teamId="+teamId+", email="+email+", "+err.Error())
+		if err := us.GetReplica().SelectOne(&user, "SELECT * FROM Users WHERE Email = :Email", map[string]interface{}{"Email": email}); err != nil {
+			result.Err = model.NewLocAppError("SqlUserStore.GetByEmail", MISSING_ACCOUNT_ERROR, nil, "email="+email+", "+err.Error())
 		}
 
 		result.Data = &user
@@ -527,7 +572,7 @@ func (us SqlUserStore) GetByEmail(teamId string, email string) StoreChannel {
 	return storeChannel
 }
 
-func (us SqlUserStore) GetByAuth(teamId string, authData string, authService string) StoreChannel {
+func (us SqlUserStore) GetByAuth(authData string, authService string) StoreChannel {
 
 	storeChannel := make(StoreChannel)
 
@@ -536,11 +581,11 @@ func (us SqlUserStore) GetByAuth(teamId string, authData string, authService str
 
 		user := model.User{}
 
-		if err := us.GetReplica().SelectOne(&user, "SELECT * FROM Users WHERE TeamId = :TeamId AND AuthData = :AuthData AND AuthService = :AuthService", map[string]interface{}{"TeamId": teamId, "AuthData": authData, "AuthService": authService}); err != nil {
+		if err := us.GetReplica().SelectOne(&user, "SELECT * FROM Users WHERE AuthData = :AuthData AND AuthService = :AuthService", map[string]interface{}{"AuthData": authData, "AuthService": authService}); err != nil {
 			if err == sql.ErrNoRows {
-				result.Err = model.NewLocAppError("SqlUserStore.GetByAuth", MISSING_AUTH_ACCOUNT_ERROR, nil, "teamId="+teamId+", authData="+authData+", authService="+authService+", "+err.Error())
+				result.Err = model.NewLocAppError("SqlUserStore.GetByAuth", MISSING_AUTH_ACCOUNT_ERROR, nil, "authData="+authData+", authService="+authService+", "+err.Error())
 			} else {
-				result.Err = model.NewLocAppError("SqlUserStore.GetByAuth", "store.sql_user.get_by_auth.other.app_error", nil, "teamId="+teamId+", authData="+authData+", authService="+authService+", "+err.Error())
+				result.Err = model.NewLocAppError("SqlUserStore.GetByAuth", "store.sql_user.get_by_auth.other.app_error", nil, "authData="+authData+", authService="+authService+", "+err.Error())
 			}
 		}
 
@@ -553,7 +598,7 @@ func (us SqlUserStore) GetByAuth(teamId string, authData string, authService str
 	return storeChannel
 }
 
-func (us SqlUserStore) GetByUsername(teamId string, username string) StoreChannel {
+func (us SqlUserStore) GetByUsername(username string) StoreChannel {
 
 	storeChannel := make(StoreChannel)
 
@@ -562,9 +607,9 @@ func (us SqlUserStore) GetByUsername(teamId string, username string) StoreChanne
 
 		user := model.User{}
 
-		if err := us.GetReplica().SelectOne(&user, "SELECT * FROM Users WHERE TeamId = :TeamId AND Username = :Username", map[string]interface{}{"TeamId": teamId, "Username": username}); err != nil {
+		if err := us.GetReplica().SelectOne(&user, "SELECT * FROM Users WHERE Username = :Username", map[string]interface{}{"Username": username}); err != nil {
 			result.Err = model.NewLocAppError("SqlUserStore.GetByUsername", "store.sql_user.get_by_username.app_error",
-				nil, "teamId="+teamId+", username="+username+", "+err.Error())
+				nil, "username="+username+", "+err.Error())
 		}
 
 		result.Data = &user
@@ -604,7 +649,7 @@ func (us SqlUserStore) GetForExport(teamId string) StoreChannel {
 
 		var users []*model.User
 
-		if _, err := us.GetReplica().Select(&users, "SELECT * FROM Users WHERE TeamId = :TeamId", map[string]interface{}{"TeamId": teamId}); err != nil {
+		if _, err := us.GetReplica().Select(&users, "SELECT Users.* FROM Users, TeamMembers WHERE TeamMembers.TeamId = :TeamId AND TeamMembers.UserId = Users.Id AND TeamMembers.DeleteAt = 0", map[string]interface{}{"TeamId": teamId}); err != nil {
 			result.Err = model.NewLocAppError("SqlUserStore.GetProfiles", "store.sql_user.get_for_export.app_error", nil, err.Error())
 		} else {
 			for _, u := range users {
@@ -649,7 +694,7 @@ func (us SqlUserStore) GetTotalActiveUsersCount() StoreChannel {
 
 		time := model.GetMillis() - (1000 * 60 * 60 * 24)
 
-		if count, err := us.GetReplica().SelectInt("SELECT COUNT(Id) FROM Users WHERE LastActivityAt > :Time", map[string]interface{}{"Time": time}); err != nil {
+		if count, err := us.GetReplica().SelectInt("SELECT COUNT(Id) FROM Users WHERE LastActivityAt > :Time AND IsBot = :IsBot", map[string]interface{}{"Time": time, "IsBot": false}); err != nil {
 			result.Err = model.NewLocAppError("SqlUserStore.GetTotalActiveUsersCount", "store.sql_user.get_total_active_users_count.app_error", nil, err.Error())
 		} else {
 			result.Data = count
@@ -687,13 +732,14 @@ func (us SqlUserStore) AnalyticsUniqueUserCount(teamId string) StoreChannel {
 	go func() {
 		result := StoreResult{}
 
-		query := "SELECT COUNT(DISTINCT Email) FROM Users"
+		// bots don't count towards the licensed number of users
+		query := "SELECT COUNT(DISTINCT Email) FROM Users WHERE IsBot = :IsBot"
 
 		if len(teamId) > 0 {
-			query += " WHERE TeamId = :TeamId"
+			query = "SELECT COUNT(DISTINCT Users.Email) FROM Users, TeamMembers WHERE TeamMembers.TeamId = :TeamId AND TeamMembers.UserId = Users.Id AND TeamMembers.DeleteAt = 0 AND Users.IsBot = :IsBot"
 		}
 
-		v, err := us.GetReplica().SelectInt(query, map[string]interface{}{"TeamId": teamId})
+		v, err := us.GetReplica().SelectInt(query, map[string]interface{}{"TeamId": teamId, "IsBot": false})
 		if err != nil {
 			result.Err = model.NewLocAppError("SqlUserStore.AnalyticsUniqueUserCount", "store.sql_user.analytics_unique_user_count.app_error", nil, err.Error())
 		} else {
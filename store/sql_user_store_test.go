@@ -42,20 +42,20 @@ func TestUserStoreSave(t *testing.T) {
 		t.Fatal("should be unique username")
 	}
 
-	for i := 0; i < 50; i++ {
-		u1.Id = ""
-		u1.Email = model.NewId()
-		u1.Username = model.NewId()
-		if err := (<-store.User().Save(&u1)).Err; err != nil {
-			t.Fatal("couldn't save item", err)
-		}
-	}
-
 	u1.Id = ""
 	u1.Email = model.NewId()
 	u1.Username = model.NewId()
-	if err := (<-store.User().Save(&u1)).Err; err == nil {
-		t.Fatal("should be the limit", err)
+	u1.TeamId = model.NewId()
+	if err := (<-store.User().Save(&u1)).Err; err != nil {
+		t.Fatal("couldn't save user", err)
+	}
+
+	u2 := model.User{}
+	u2.Email = u1.Email
+	u2.Username = model.NewId()
+	u2.TeamId = model.NewId()
+	if err := (<-store.User().Save(&u2)).Err; err == nil {
+		t.Fatal("should be unique email across teams")
 	}
 }
 
@@ -242,6 +242,65 @@ func TestActiveUserCount(t *testing.T) {
 	}
 }
 
+func TestActiveUserCountExcludesBots(t *testing.T) {
+	Setup()
+
+	u1 := model.User{}
+	u1.TeamId = model.NewId()
+	u1.Email = model.NewId()
+	u1.LastActivityAt = model.GetMillis()
+	Must(store.User().Save(&u1))
+
+	var before int64
+	if result := <-store.User().GetTotalActiveUsersCount(); result.Err != nil {
+		t.Fatal(result.Err)
+	} else {
+		before = result.Data.(int64)
+	}
+
+	bot := model.NewBotUser(u1.TeamId, "b"+model.NewId(), u1.Id)
+	Must(store.User().Save(bot))
+	Must(store.User().UpdateLastActivityAt(bot.Id, model.GetMillis()))
+
+	if result := <-store.User().GetTotalActiveUsersCount(); result.Err != nil {
+		t.Fatal(result.Err)
+	} else if result.Data.(int64) != before {
+		t.Fatal("bots shouldn't be counted as active users")
+	}
+}
+
+func TestUserStoreGetBotsByOwner(t *testing.T) {
+	Setup()
+
+	u1 := model.User{}
+	u1.TeamId = model.NewId()
+	u1.Email = model.NewId()
+	Must(store.User().Save(&u1))
+
+	bot := model.NewBotUser(u1.TeamId, "b"+model.NewId(), u1.Id)
+	Must(store.User().Save(bot))
+
+	Must(store.User().Save(model.NewBotUser(u1.TeamId, "b"+model.NewId(), model.NewId())))
+
+	if result := <-store.User().GetBotsByOwner(u1.Id); result.Err != nil {
+		t.Fatal(result.Err)
+	} else if bots := result.Data.([]*model.User); len(bots) != 1 || bots[0].Id != bot.Id {
+		t.Fatal("should only have found the bot owned by the user")
+	} else if !bots[0].IsBot || bots[0].BotOwnerId != u1.Id {
+		t.Fatal("bot fields weren't saved")
+	}
+
+	bot.IsBot = false
+	bot.BotOwnerId = ""
+	Must(store.User().Update(bot, false))
+
+	if result := <-store.User().Get(bot.Id); result.Err != nil {
+		t.Fatal(result.Err)
+	} else if user := result.Data.(*model.User); !user.IsBot || user.BotOwnerId != u1.Id {
+		t.Fatal("updating a user shouldn't change whether it is a bot")
+	}
+}
+
 func TestUserStoreGetProfiles(t *testing.T) {
 	Setup()
 
@@ -255,6 +314,15 @@ func TestUserStoreGetProfiles(t *testing.T) {
 	u2.Email = model.NewId()
 	Must(store.User().Save(&u2))
 
+	u3 := model.User{}
+	u3.TeamId = model.NewId()
+	u3.Email = model.NewId()
+	Must(store.User().Save(&u3))
+
+	Must(store.Team().SaveMember(&model.TeamMember{TeamId: u1.TeamId, UserId: u1.Id}))
+	Must(store.Team().SaveMember(&model.TeamMember{TeamId: u1.TeamId, UserId: u2.Id}))
+	Must(store.Team().SaveMember(&model.TeamMember{TeamId: u1.TeamId, UserId: u3.Id, DeleteAt: model.GetMillis()}))
+
 	if r1 := <-store.User().GetProfiles(u1.TeamId); r1.Err != nil {
 		t.Fatal(r1.Err)
 	} else {
@@ -308,11 +376,11 @@ func TestUserStoreGetByEmail(t *testing.T) {
 	u1.Email = model.NewId()
 	Must(store.User().Save(&u1))
 
-	if err := (<-store.User().GetByEmail(u1.TeamId, u1.Email)).Err; err != nil {
+	if err := (<-store.User().GetByEmail(u1.Email)).Err; err != nil {
 		t.Fatal(err)
 	}
 
-	if err := (<-store.User().GetByEmail("", "")).Err; err == nil {
+	if err := (<-store.User().GetByEmail("")).Err; err == nil {
 		t.Fatal("Should have failed because of missing email")
 	}
 }
@@ -327,11 +395,11 @@ func TestUserStoreGetByAuthData(t *testing.T) {
 	u1.AuthService = "service"
 	Must(store.User().Save(&u1))
 
-	if err := (<-store.User().GetByAuth(u1.TeamId, u1.AuthData, u1.AuthService)).Err; err != nil {
+	if err := (<-store.User().GetByAuth(u1.AuthData, u1.AuthService)).Err; err != nil {
 		t.Fatal(err)
 	}
 
-	if err := (<-store.User().GetByAuth("", "", "")).Err; err == nil {
+	if err := (<-store.User().GetByAuth("", "")).Err; err == nil {
 		t.Fatal("Should have failed because of missing auth data")
 	}
 }
@@ -345,11 +413,11 @@ func TestUserStoreGetByUsername(t *testing.T) {
 	u1.Username = model.NewId()
 	Must(store.User().Save(&u1))
 
-	if err := (<-store.User().GetByUsername(u1.TeamId, u1.Username)).Err; err != nil {
+	if err := (<-store.User().GetByUsername(u1.Username)).Err; err != nil {
 		t.Fatal(err)
 	}
 
-	if err := (<-store.User().GetByUsername("", "")).Err; err == nil {
+	if err := (<-store.User().GetByUsername("")).Err; err == nil {
 		t.Fatal("Should have failed because of missing username")
 	}
 }
@@ -368,7 +436,7 @@ func TestUserStoreUpdatePassword(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if r1 := <-store.User().GetByEmail(u1.TeamId, u1.Email); r1.Err != nil {
+	if r1 := <-store.User().GetByEmail(u1.Email); r1.Err != nil {
 		t.Fatal(r1.Err)
 	} else {
 		user := r1.Data.(*model.User)
@@ -406,7 +474,7 @@ func TestUserStoreUpdateAuthData(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if r1 := <-store.User().GetByEmail(u1.TeamId, u1.Email); r1.Err != nil {
+	if r1 := <-store.User().GetByEmail(u1.Email); r1.Err != nil {
 		t.Fatal(r1.Err)
 	} else {
 		user := r1.Data.(*model.User)
@@ -546,3 +614,26 @@ func TestUserStoreUpdateMfaActive(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestUserStoreUpdateGuestExpiresAt(t *testing.T) {
+	Setup()
+
+	u1 := model.User{}
+	u1.TeamId = model.NewId()
+	u1.Email = model.NewId()
+	u1.Roles = model.ROLE_GUEST
+	Must(store.User().Save(&u1))
+
+	expiresAt := model.GetMillis() + 60*60*1000
+	if err := (<-store.User().UpdateGuestExpiresAt(u1.Id, expiresAt)).Err; err != nil {
+		t.Fatal(err)
+	}
+
+	Must(store.User().Update(&u1, false))
+
+	if result := <-store.User().Get(u1.Id); result.Err != nil {
+		t.Fatal(result.Err)
+	} else if result.Data.(*model.User).GuestExpiresAt != expiresAt {
+		t.Fatal("expiry date should have been kept when updating the user")
+	}
+}
@@ -33,6 +33,19 @@ func NewSqlWebhookStore(sqlStore *SqlStore) WebhookStore {
 		tableo.ColMap("CallbackURLs").SetMaxSize(1024)
 		tableo.ColMap("DisplayName").SetMaxSize(64)
 		tableo.ColMap("Description").SetMaxSize(128)
+
+		tabled := db.AddTableWithName(model.OutgoingWebhookDelivery{}, "OutgoingWebhookDeliveries").SetKeys(false, "Id")
+		tabled.ColMap("Id").SetMaxSize(26)
+		tabled.ColMap("HookId").SetMaxSize(26)
+		tabled.ColMap("TeamId").SetMaxSize(26)
+		tabled.ColMap("ChannelId").SetMaxSize(26)
+		tabled.ColMap("PostId").SetMaxSize(26)
+		tabled.ColMap("URL").SetMaxSize(1024)
+		tabled.ColMap("Payload").SetMaxSize(16000)
+		tabled.ColMap("Status").SetMaxSize(26)
+		tabled.ColMap("ResponseSnippet").SetMaxSize(model.OUTGOING_WEBHOOK_RESPONSE_SNIPPET_SIZE)
+		tabled.ColMap("Error").SetMaxSize(1024)
+		tabled.ColMap("SiteURL").SetMaxSize(1024)
 	}
 
 	return s
@@ -44,12 +57,17 @@ func (s SqlWebhookStore) UpgradeSchemaIfNeeded() {
 
 	s.CreateColumnIfNotExists("OutgoingWebhooks", "DisplayName", "varchar(64)", "varchar(64)", "")
 	s.CreateColumnIfNotExists("OutgoingWebhooks", "Description", "varchar(128)", "varchar(128)", "")
+	s.CreateColumnIfNotExists("OutgoingWebhooks", "Timeout", "int", "integer", "0")
 }
 
 func (s SqlWebhookStore) CreateIndexesIfNotExists() {
 	s.CreateIndexIfNotExists("idx_incoming_webhook_user_id", "IncomingWebhooks", "UserId")
 	s.CreateIndexIfNotExists("idx_incoming_webhook_team_id", "IncomingWebhooks", "TeamId")
 	s.CreateIndexIfNotExists("idx_outgoing_webhook_team_id", "OutgoingWebhooks", "TeamId")
+
+	s.CreateIndexIfNotExists("idx_outgoing_webhook_deliveries_hook_id", "OutgoingWebhookDeliveries", "HookId")
+	s.CreateIndexIfNotExists("idx_outgoing_webhook_deliveries_next_attempt_at", "OutgoingWebhookDeliveries", "NextAttemptAt")
+	s.CreateIndexIfNotExists("idx_outgoing_webhook_deliveries_create_at", "OutgoingWebhookDeliveries", "CreateAt")
 }
 
 func (s SqlWebhookStore) SaveIncoming(webhook *model.IncomingWebhook) StoreChannel {
@@ -306,6 +324,13 @@ func (s SqlWebhookStore) PermanentDeleteOutgoingByUser(userId string) StoreChann
 	go func() {
 		result := StoreResult{}
 
+		if _, err := s.GetMaster().Exec("DELETE FROM OutgoingWebhookDeliveries WHERE HookId IN (SELECT Id FROM OutgoingWebhooks WHERE CreatorId = :UserId)", map[string]interface{}{"UserId": userId}); err != nil {
+			result.Err = model.NewLocAppError("SqlWebhookStore.DeleteOutgoingByUser", "store.sql_webhooks.permanent_delete_outgoing_by_user.app_error", nil, "id="+userId+", err="+err.Error())
+			storeChannel <- result
+			close(storeChannel)
+			return
+		}
+
 		_, err := s.GetMaster().Exec("DELETE FROM OutgoingWebhooks WHERE CreatorId = :UserId", map[string]interface{}{"UserId": userId})
 		if err != nil {
 			result.Err = model.NewLocAppError("SqlWebhookStore.DeleteOutgoingByUser", "store.sql_webhooks.permanent_delete_outgoing_by_user.app_error", nil, "id="+userId+", err="+err.Error())
@@ -339,6 +364,172 @@ func (s SqlWebhookStore) UpdateOutgoing(hook *model.OutgoingWebhook) StoreChanne
 	return storeChannel
 }
 
+func (s SqlWebhookStore) SaveDelivery(delivery *model.OutgoingWebhookDelivery) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		if len(delivery.Id) > 0 {
+			result.Err = model.NewLocAppError("SqlWebhookStore.SaveDelivery",
+				"store.sql_webhooks.save_delivery.existing.app_error", nil, "id="+delivery.Id)
+			storeChannel <- result
+			close(storeChannel)
+			return
+		}
+
+		delivery.PreSave()
+		if result.Err = delivery.IsValid(); result.Err != nil {
+			storeChannel <- result
+			close(storeChannel)
+			return
+		}
+
+		if err := s.GetMaster().Insert(delivery); err != nil {
+			result.Err = model.NewLocAppError("SqlWebhookStore.SaveDelivery", "store.sql_webhooks.save_delivery.app_error", nil, "id="+delivery.Id+", "+err.Error())
+		} else {
+			result.Data = delivery
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+func (s SqlWebhookStore) UpdateDelivery(delivery *model.OutgoingWebhookDelivery) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		delivery.PreUpdate()
+		if result.Err = delivery.IsValid(); result.Err != nil {
+			storeChannel <- result
+			close(storeChannel)
+			return
+		}
+
+		if _, err := s.GetMaster().Update(delivery); err != nil {
+			result.Err = model.NewLocAppError("SqlWebhookStore.UpdateDelivery", "store.sql_webhooks.update_delivery.app_error", nil, "id="+delivery.Id+", "+err.Error())
+		} else {
+			result.Data = delivery
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+func (s SqlWebhookStore) GetDeliveries(hookId string, offset int, limit int) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		var deliveries []*model.OutgoingWebhookDelivery
+
+		if _, err := s.GetReplica().Select(&deliveries, "SELECT * FROM OutgoingWebhookDeliveries WHERE HookId = :HookId ORDER BY CreateAt DESC LIMIT :Limit OFFSET :Offset",
+			map[string]interface{}{"HookId": hookId, "Limit": limit, "Offset": offset}); err != nil {
+			result.Err = model.NewLocAppError("SqlWebhookStore.GetDeliveries", "store.sql_webhooks.get_deliveries.app_error", nil, "hookId="+hookId+", err="+err.Error())
+		} else {
+			result.Data = deliveries
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+func (s SqlWebhookStore) GetDueDeliveries(time int64, limit int) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		var deliveries []*model.OutgoingWebhookDelivery
+
+		if _, err := s.GetMaster().Select(&deliveries, "SELECT * FROM OutgoingWebhookDeliveries WHERE Status = :Status AND NextAttemptAt <= :Time ORDER BY NextAttemptAt ASC LIMIT :Limit",
+			map[string]interface{}{"Status": model.OUTGOING_WEBHOOK_DELIVERY_PENDING, "Time": time, "Limit": limit}); err != nil {
+			result.Err = model.NewLocAppError("SqlWebhookStore.GetDueDeliveries", "store.sql_webhooks.get_due_deliveries.app_error", nil, err.Error())
+		} else {
+			result.Data = deliveries
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+// ClaimDelivery marks an attempt at a pending delivery as started and pushes
+// its next attempt back to leaseUntil so that it is retried if this server goes
+// away before recording the result. The update only applies if the delivery is
+// still due at the time it was read with, so when several app servers race for
+// the same delivery only one of them gets true back.
+func (s SqlWebhookStore) ClaimDelivery(delivery *model.OutgoingWebhookDelivery, leaseUntil int64) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		now := model.GetMillis()
+
+		if sqlResult, err := s.GetMaster().Exec(
+			`UPDATE
+				OutgoingWebhookDeliveries
+			SET
+				Attempts = Attempts + 1, LastAttemptAt = :Now, NextAttemptAt = :LeaseUntil, UpdateAt = :Now
+			WHERE
+				Id = :Id AND Status = :Status AND NextAttemptAt = :NextAttemptAt`,
+			map[string]interface{}{"Now": now, "LeaseUntil": leaseUntil, "Id": delivery.Id, "Status": model.OUTGOING_WEBHOOK_DELIVERY_PENDING, "NextAttemptAt": delivery.NextAttemptAt}); err != nil {
+			result.Err = model.NewLocAppError("SqlWebhookStore.ClaimDelivery", "store.sql_webhooks.claim_delivery.app_error", nil, "id="+delivery.Id+", "+err.Error())
+		} else if rows, err := sqlResult.RowsAffected(); err != nil {
+			result.Err = model.NewLocAppError("SqlWebhookStore.ClaimDelivery", "store.sql_webhooks.claim_delivery.app_error", nil, "id="+delivery.Id+", "+err.Error())
+		} else {
+			if rows == 1 {
+				delivery.Attempts++
+				delivery.LastAttemptAt = now
+				delivery.NextAttemptAt = leaseUntil
+				delivery.UpdateAt = now
+			}
+
+			result.Data = rows == 1
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
+// PermanentDeleteDeliveriesBefore removes finished deliveries created before
+// the given time from the delivery log.
+func (s SqlWebhookStore) PermanentDeleteDeliveriesBefore(time int64) StoreChannel {
+	storeChannel := make(StoreChannel)
+
+	go func() {
+		result := StoreResult{}
+
+		if _, err := s.GetMaster().Exec("DELETE FROM OutgoingWebhookDeliveries WHERE CreateAt < :Time AND Status != :Status",
+			map[string]interface{}{"Time": time, "Status": model.OUTGOING_WEBHOOK_DELIVERY_PENDING}); err != nil {
+			result.Err = model.NewLocAppError("SqlWebhookStore.PermanentDeleteDeliveriesBefore", "store.sql_webhooks.permanent_delete_deliveries_before.app_error", nil, err.Error())
+		}
+
+		storeChannel <- result
+		close(storeChannel)
+	}()
+
+	return storeChannel
+}
+
 func (s SqlWebhookStore) AnalyticsIncomingCount(teamId string) StoreChannel {
 	storeChannel := make(StoreChannel)
 
@@ -343,3 +343,75 @@ func TestWebhookStoreCountOutgoing(t *testing.T) {
 		}
 	}
 }
+
+func TestWebhookStoreDeliveries(t *testing.T) {
+	Setup()
+
+	o1 := &model.OutgoingWebhookDelivery{}
+	o1.HookId = model.NewId()
+	o1.TeamId = model.NewId()
+	o1.ChannelId = model.NewId()
+	o1.PostId = model.NewId()
+	o1.URL = "http://nowhere.com/"
+	o1.Payload = "token=abc"
+
+	if err := (<-store.Webhook().SaveDelivery(o1)).Err; err != nil {
+		t.Fatal("couldn't save item", err)
+	}
+
+	if err := (<-store.Webhook().SaveDelivery(o1)).Err; err == nil {
+		t.Fatal("shouldn't be able to update from save")
+	}
+
+	due := Must(store.Webhook().GetDueDeliveries(o1.NextAttemptAt, 1000)).([]*model.OutgoingWebhookDelivery)
+	found := false
+	for _, d := range due {
+		if d.Id == o1.Id {
+			found = true
+		}
+	}
+
+	if !found {
+		t.Fatal("new delivery should be due")
+	}
+
+	o2 := *o1
+	if claimed := Must(store.Webhook().ClaimDelivery(o1, o1.NextAttemptAt+60000)).(bool); !claimed {
+		t.Fatal("should have claimed the delivery")
+	}
+
+	if o1.Attempts != 1 {
+		t.Fatal("should have counted the attempt")
+	}
+
+	if claimed := Must(store.Webhook().ClaimDelivery(&o2, o2.NextAttemptAt+60000)).(bool); claimed {
+		t.Fatal("shouldn't be able to claim the same attempt twice")
+	}
+
+	o1.Status = model.OUTGOING_WEBHOOK_DELIVERY_SUCCESS
+	o1.StatusCode = 200
+	o1.SetResponseSnippet("{}")
+	Must(store.Webhook().UpdateDelivery(o1))
+
+	o3 := &model.OutgoingWebhookDelivery{}
+	o3.HookId = o1.HookId
+	o3.TeamId = o1.TeamId
+	o3.ChannelId = o1.ChannelId
+	o3.PostId = model.NewId()
+	o3.URL = "http://nowhere.com/"
+	Must(store.Webhook().SaveDelivery(o3))
+
+	if deliveries := Must(store.Webhook().GetDeliveries(o1.HookId, 0, 10)).([]*model.OutgoingWebhookDelivery); len(deliveries) != 2 || deliveries[1].Id != o1.Id || deliveries[1].StatusCode != 200 || deliveries[1].Attempts != 1 {
+		t.Fatal("should have returned both deliveries, newest first")
+	}
+
+	if deliveries := Must(store.Webhook().GetDeliveries(o1.HookId, 1, 10)).([]*model.OutgoingWebhookDelivery); len(deliveries) != 1 || deliveries[0].Id != o1.Id {
+		t.Fatal("should have paged the deliveries")
+	}
+
+	Must(store.Webhook().PermanentDeleteDeliveriesBefore(o3.CreateAt + 1))
+
+	if deliveries := Must(store.Webhook().GetDeliveries(o1.HookId, 0, 10)).([]*model.OutgoingWebhookDelivery); len(deliveries) != 1 || deliveries[0].Id != o3.Id {
+		t.Fatal("should only have removed finished deliveries")
+	}
+}
@@ -41,6 +41,16 @@ type Store interface {
 	Command() CommandStore
 	Preference() PreferenceStore
 	License() LicenseStore
+	Thread() ThreadStore
+	Reaction() ReactionStore
+	ScheduledPost() ScheduledPostStore
+	EmailNotification() EmailNotificationStore
+	Status() StatusStore
+	UserAccessToken() UserAccessTokenStore
+	Role() RoleStore
+	UploadSession() UploadSessionStore
+	FileInfo() FileInfoStore
+	FileContent() FileContentStore
 	MarkSystemRanUnitTests()
 	Close()
 }
@@ -57,6 +67,13 @@ type TeamStore interface {
 	GetByInviteId(inviteId string) StoreChannel
 	PermanentDelete(teamId string) StoreChannel
 	AnalyticsTeamCount() StoreChannel
+	SaveMember(member *model.TeamMember) StoreChannel
+	UpdateMember(member *model.TeamMember) StoreChannel
+	GetMember(teamId string, userId string) StoreChannel
+	GetMembers(teamId string) StoreChannel
+	GetTeamsForUser(userId string) StoreChannel
+	RemoveMember(teamId string, userId string) StoreChannel
+	RemoveAllMembersByUser(userId string) StoreChannel
 }
 
 type ChannelStore interface {
@@ -78,6 +95,7 @@ type ChannelStore interface {
 	GetMembers(channelId string) StoreChannel
 	GetMember(channelId string, userId string) StoreChannel
 	GetMemberCount(channelId string) StoreChannel
+	GetUserIdsInSharedChannels(teamId string, userId string) StoreChannel
 	RemoveMember(channelId string, userId string) StoreChannel
 	PermanentDeleteMembersByUser(userId string) StoreChannel
 	GetExtraMembers(channelId string, limit int) StoreChannel
@@ -93,7 +111,16 @@ type ChannelStore interface {
 type PostStore interface {
 	Save(post *model.Post) StoreChannel
 	Update(post *model.Post, newMessage string, newHashtags string) StoreChannel
+	UpdateWithProps(post *model.Post, newMessage string, newHashtags string, newProps model.StringInterface) StoreChannel
 	Get(id string) StoreChannel
+	GetThread(rootId string) StoreChannel
+	GetEditHistory(postId string) StoreChannel
+	GetPostsByIds(postIds []string) StoreChannel
+	GetPostsForIndexing(afterTime int64, afterId string, limit int) StoreChannel
+	UpdatePinned(post *model.Post, pinned bool) StoreChannel
+	GetPinnedPosts(channelId string) StoreChannel
+	GetPinnedPostCount(channelId string) StoreChannel
+	GetFlaggedPosts(teamId string, userId string, offset int, limit int) StoreChannel
 	Delete(postId string, time int64) StoreChannel
 	PermanentDeleteByUser(userId string) StoreChannel
 	GetPosts(channelId string, offset int, limit int) StoreChannel
@@ -101,7 +128,7 @@ type PostStore interface {
 	GetPostsAfter(channelId string, postId string, numPosts int, offset int) StoreChannel
 	GetPostsSince(channelId string, time int64) StoreChannel
 	GetEtag(channelId string) StoreChannel
-	Search(teamId string, userId string, params *model.SearchParams) StoreChannel
+	Search(teamId string, userId string, params *model.SearchParams, offset int, limit int) StoreChannel
 	GetForExport(channelId string) StoreChannel
 	AnalyticsUserCountsWithPostsByDay(teamId string) StoreChannel
 	AnalyticsPostCountsByDay(teamId string) StoreChannel
@@ -121,9 +148,9 @@ type UserStore interface {
 	UpdateMfaActive(userId string, active bool) StoreChannel
 	Get(id string) StoreChannel
 	GetProfiles(teamId string) StoreChannel
-	GetByEmail(teamId string, email string) StoreChannel
-	GetByAuth(teamId string, authData string, authService string) StoreChannel
-	GetByUsername(teamId string, username string) StoreChannel
+	GetByEmail(email string) StoreChannel
+	GetByAuth(authData string, authService string) StoreChannel
+	GetByUsername(username string) StoreChannel
 	VerifyEmail(userId string) StoreChannel
 	GetEtagForProfiles(teamId string) StoreChannel
 	UpdateFailedPasswordAttempts(userId string, attempts int) StoreChannel
@@ -131,6 +158,8 @@ type UserStore interface {
 	GetTotalUsersCount() StoreChannel
 	GetTotalActiveUsersCount() StoreChannel
 	GetSystemAdminProfiles() StoreChannel
+	GetBotsByOwner(ownerId string) StoreChannel
+	UpdateGuestExpiresAt(userId string, expiresAt int64) StoreChannel
 	PermanentDelete(userId string) StoreChannel
 	AnalyticsUniqueUserCount(teamId string) StoreChannel
 
@@ -201,6 +230,12 @@ type WebhookStore interface {
 	DeleteOutgoing(webhookId string, time int64) StoreChannel
 	PermanentDeleteOutgoingByUser(userId string) StoreChannel
 	UpdateOutgoing(hook *model.OutgoingWebhook) StoreChannel
+	SaveDelivery(delivery *model.OutgoingWebhookDelivery) StoreChannel
+	UpdateDelivery(delivery *model.OutgoingWebhookDelivery) StoreChannel
+	GetDeliveries(hookId string, offset int, limit int) StoreChannel
+	GetDueDeliveries(time int64, limit int) StoreChannel
+	ClaimDelivery(delivery *model.OutgoingWebhookDelivery, leaseUntil int64) StoreChannel
+	PermanentDeleteDeliveriesBefore(time int64) StoreChannel
 	AnalyticsIncomingCount(teamId string) StoreChannel
 	AnalyticsOutgoingCount(teamId string) StoreChannel
 }
@@ -213,6 +248,10 @@ type CommandStore interface {
 	PermanentDeleteByUser(userId string) StoreChannel
 	Update(hook *model.Command) StoreChannel
 	AnalyticsCommandCount(teamId string) StoreChannel
+	SaveWebhook(webhook *model.CommandWebhook) StoreChannel
+	GetWebhook(id string) StoreChannel
+	UseWebhook(id string) StoreChannel
+	PermanentDeleteWebhooksBefore(time int64) StoreChannel
 }
 
 type PreferenceStore interface {
@@ -220,6 +259,7 @@ type PreferenceStore interface {
 	Get(userId string, category string, name string) StoreChannel
 	GetCategory(userId string, category string) StoreChannel
 	GetAll(userId string) StoreChannel
+	Delete(userId, category, name string) StoreChannel
 	PermanentDeleteByUser(userId string) StoreChannel
 	IsFeatureEnabled(feature, userId string) StoreChannel
 }
@@ -228,3 +268,96 @@ type LicenseStore interface {
 	Save(license *model.LicenseRecord) StoreChannel
 	Get(id string) StoreChannel
 }
+
+type ThreadStore interface {
+	SaveMember(member *model.ThreadMember) StoreChannel
+	GetMember(postId string, userId string) StoreChannel
+	UpdateLastViewedAt(postId string, userId string) StoreChannel
+	GetThreadsForUser(teamId string, userId string, offset int, limit int) StoreChannel
+	PermanentDeleteByUser(userId string) StoreChannel
+}
+
+type ReactionStore interface {
+	Save(reaction *model.Reaction) StoreChannel
+	Delete(reaction *model.Reaction) StoreChannel
+	GetForPost(postId string) StoreChannel
+	GetForPosts(postIds []string) StoreChannel
+	GetForExport(channelId string) StoreChannel
+	PermanentDeleteByUser(userId string) StoreChannel
+}
+
+type ScheduledPostStore interface {
+	Save(scheduledPost *model.ScheduledPost) StoreChannel
+	Update(scheduledPost *model.ScheduledPost) StoreChannel
+	Get(id string) StoreChannel
+	GetForUser(teamId string, userId string) StoreChannel
+	GetDue(time int64, limit int) StoreChannel
+	Claim(scheduledPost *model.ScheduledPost, leaseUntil int64) StoreChannel
+	Delivered(scheduledPost *model.ScheduledPost, nextScheduledAt int64) StoreChannel
+	DeliveryFailed(scheduledPost *model.ScheduledPost, retryAt int64, reason string) StoreChannel
+	Delete(id string) StoreChannel
+	PermanentDeleteByUser(userId string) StoreChannel
+}
+
+type EmailNotificationStore interface {
+	Save(notification *model.EmailNotification) StoreChannel
+	GetDueUserIds(time int64, limit int) StoreChannel
+	GetForUser(userId string) StoreChannel
+	Claim(id string, leaseUntil int64) StoreChannel
+	Release(id string, leaseUntil int64) StoreChannel
+	Delete(id string) StoreChannel
+	PermanentDeleteByUser(userId string) StoreChannel
+}
+
+type StatusStore interface {
+	SaveOrUpdate(status *model.Status) StoreChannel
+	Get(userId string) StoreChannel
+	GetByUserIds(userIds []string) StoreChannel
+	PermanentDeleteByUser(userId string) StoreChannel
+}
+
+type UserAccessTokenStore interface {
+	Save(token *model.UserAccessToken) StoreChannel
+	Get(id string) StoreChannel
+	GetByToken(token string) StoreChannel
+	GetByUser(userId string) StoreChannel
+	UpdateLastUsedAt(id string, time int64) StoreChannel
+	Delete(id string) StoreChannel
+	PermanentDeleteByUser(userId string) StoreChannel
+}
+
+type RoleStore interface {
+	Save(role *model.Role) StoreChannel
+	Update(role *model.Role) StoreChannel
+	Get(id string) StoreChannel
+	GetByTeam(teamId string) StoreChannel
+	Delete(id string) StoreChannel
+}
+
+type UploadSessionStore interface {
+	Save(session *model.UploadSession) StoreChannel
+	Update(session *model.UploadSession) StoreChannel
+	Get(id string) StoreChannel
+	Delete(id string) StoreChannel
+	ClaimChunk(session *model.UploadSession, leaseUntil int64) StoreChannel
+	SaveChunk(session *model.UploadSession) StoreChannel
+	ReleaseChunk(session *model.UploadSession) StoreChannel
+	GetExpired(updatedBefore int64, limit int) StoreChannel
+}
+
+type FileInfoStore interface {
+	Save(info *model.FileInfo) StoreChannel
+	Update(info *model.FileInfo) StoreChannel
+	Get(id string) StoreChannel
+	GetForPost(postId string) StoreChannel
+	GetForChannel(channelId string, offset int, limit int) StoreChannel
+	Search(teamId string, userId string, terms string, offset int, limit int) StoreChannel
+	AttachToPost(fileIds []string, postId string, channelId string, creatorId string) StoreChannel
+	SetPreviewInfo(id string, width int, height int, thumbnailPath string, previewPath string, hasPreviewImage bool) StoreChannel
+}
+
+type FileContentStore interface {
+	Save(content *model.FileContent) StoreChannel
+	Get(fileId string) StoreChannel
+	SearchPostIds(teamId string, userId string, params *model.SearchParams) StoreChannel
+}
@@ -244,6 +244,9 @@ func getClientConfig(c *model.Config) map[string]string {
 	props["LdapLoginFieldName"] = *c.LdapSettings.LoginFieldName
 	props["LdapPasswordFieldName"] = *c.LdapSettings.PasswordFieldName
 
+	props["EnableSaml"] = strconv.FormatBool(*c.SamlSettings.Enable)
+	props["SamlLoginButtonText"] = *c.SamlSettings.LoginButtonText
+
 	props["WebsocketPort"] = fmt.Sprintf("%v", *c.ServiceSettings.WebsocketPort)
 	props["WebsocketSecurePort"] = fmt.Sprintf("%v", *c.ServiceSettings.WebsocketSecurePort)
 
@@ -0,0 +1,102 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package utils
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/mattermost/platform/model"
+)
+
+// FileBackend stores the files that are uploaded to the server. Paths are
+// relative to the root of the backend and always use forward slashes.
+type FileBackend interface {
+	// Read opens the file at path. The caller must close it when done.
+	Read(path string) (io.ReadCloser, *model.AppError)
+
+	// Write stores everything that can be read from data at path, creating any
+	// directories that are needed and replacing the file if it exists.
+	Write(path string, data io.Reader) *model.AppError
+
+	Move(oldPath, newPath string) *model.AppError
+	Remove(path string) *model.AppError
+
+	// List returns the names of the files and directories directly inside the
+	// directory at path. The names of directories end in a slash.
+	List(path string) ([]string, *model.AppError)
+
+	Stat(path string) (*FileStat, *model.AppError)
+
+	// SignedURL returns a link that can be used to download the file without
+	// logging in until expires has passed. Not every backend supports them.
+	SignedURL(path string, expires time.Duration) (string, *model.AppError)
+
+	// StartUpload begins an upload to path that's sent in chunks. The id it
+	// returns is needed to send the rest of the upload, even after a restart.
+	StartUpload(path string) (string, *model.AppError)
+
+	// WriteChunk stores the n'th chunk of an upload, counting from 1, which
+	// begins offset bytes into the file. Sending a chunk again replaces it.
+	WriteChunk(path string, uploadId string, n int, offset int64, data io.Reader) *model.AppError
+
+	// FinishUpload puts the chunks together into the file at path.
+	FinishUpload(path string, uploadId string) *model.AppError
+
+	// AbortUpload throws away the chunks sent so far.
+	AbortUpload(path string, uploadId string) *model.AppError
+}
+
+type FileStat struct {
+	Size    int64
+	ModTime time.Time
+}
+
+// NewFileBackend makes the backend for the driver chosen in settings.
+func NewFileBackend(settings *model.FileSettings) (FileBackend, *model.AppError) {
+	switch settings.DriverName {
+	case model.IMAGE_DRIVER_LOCAL:
+		return NewLocalFileBackend(settings), nil
+	case model.IMAGE_DRIVER_S3:
+		return NewS3FileBackend(settings), nil
+	case model.IMAGE_DRIVER_WEBDAV:
+		return NewWebDAVFileBackend(settings), nil
+	}
+
+	return nil, model.NewLocAppError("NewFileBackend", "utils.file.new_backend.configured.app_error", nil, "driver="+settings.DriverName)
+}
+
+// UPLOADS_DIR holds the uploads that are still being sent for the backends that
+// need somewhere to keep them.
+const UPLOADS_DIR = "uploads/"
+
+// ReadFile reads the whole of the file at path into memory.
+func ReadFile(backend FileBackend, path string) ([]byte, *model.AppError) {
+	r, err := backend.Read(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	if data, readErr := ioutil.ReadAll(r); readErr != nil {
+		return nil, model.NewLocAppError("ReadFile", "utils.file.read_file.reading.app_error", nil, "path="+path+", err="+readErr.Error())
+	} else {
+		return data, nil
+	}
+}
+
+// parentDirs returns the directories above path from the top down, each with a
+// trailing slash.
+func parentDirs(path string) []string {
+	dirs := []string{}
+
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	for i := 1; i < len(parts); i++ {
+		dirs = append(dirs, strings.Join(parts[:i], "/")+"/")
+	}
+
+	return dirs
+}
@@ -0,0 +1,166 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package utils
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/mattermost/platform/model"
+)
+
+// LocalFileBackend keeps files in a directory on the server's disk.
+type LocalFileBackend struct {
+	directory string
+}
+
+func NewLocalFileBackend(settings *model.FileSettings) *LocalFileBackend {
+	return &LocalFileBackend{directory: settings.Directory}
+}
+
+func (b *LocalFileBackend) fullPath(path string) string {
+	return filepath.Join(b.directory, filepath.FromSlash(path))
+}
+
+func (b *LocalFileBackend) Read(path string) (io.ReadCloser, *model.AppError) {
+	if f, err := os.Open(b.fullPath(path)); err != nil {
+		return nil, model.NewLocAppError("Read", "utils.file.local.reading.app_error", nil, err.Error())
+	} else {
+		return f, nil
+	}
+}
+
+func (b *LocalFileBackend) Write(path string, data io.Reader) *model.AppError {
+	fullPath := b.fullPath(path)
+
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0774); err != nil {
+		return model.NewLocAppError("Write", "utils.file.local.create_dir.app_error", nil, err.Error())
+	}
+
+	f, err := os.OpenFile(fullPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return model.NewLocAppError("Write", "utils.file.local.writing.app_error", nil, err.Error())
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, data); err != nil {
+		return model.NewLocAppError("Write", "utils.file.local.writing.app_error", nil, err.Error())
+	}
+
+	return nil
+}
+
+func (b *LocalFileBackend) Move(oldPath, newPath string) *model.AppError {
+	if err := os.MkdirAll(filepath.Dir(b.fullPath(newPath)), 0774); err != nil {
+		return model.NewLocAppError("Move", "utils.file.local.create_dir.app_error", nil, err.Error())
+	}
+
+	if err := os.Rename(b.fullPath(oldPath), b.fullPath(newPath)); err != nil {
+		return model.NewLocAppError("Move", "utils.file.local.moving.app_error", nil, err.Error())
+	}
+
+	return nil
+}
+
+func (b *LocalFileBackend) Remove(path string) *model.AppError {
+	if err := os.Remove(b.fullPath(path)); err != nil {
+		return model.NewLocAppError("Remove", "utils.file.local.removing.app_error", nil, err.Error())
+	}
+
+	return nil
+}
+
+func (b *LocalFileBackend) List(path string) ([]string, *model.AppError) {
+	dir, err := os.Open(b.fullPath(path))
+	if err != nil {
+		return nil, model.NewLocAppError("List", "utils.file.local.listing.app_error", nil, err.Error())
+	}
+	defer dir.Close()
+
+	infos, err := dir.Readdir(0)
+	if err != nil {
+		return nil, model.NewLocAppError("List", "utils.file.local.listing.app_error", nil, err.Error())
+	}
+
+	names := make([]string, 0, len(infos))
+	for _, info := range infos {
+		if info.IsDir() {
+			names = append(names, info.Name()+"/")
+		} else {
+			names = append(names, info.Name())
+		}
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+func (b *LocalFileBackend) Stat(path string) (*FileStat, *model.AppError) {
+	if info, err := os.Stat(b.fullPath(path)); err != nil {
+		return nil, model.NewLocAppError("Stat", "utils.file.local.stat.app_error", nil, err.Error())
+	} else {
+		return &FileStat{Size: info.Size(), ModTime: info.ModTime()}, nil
+	}
+}
+
+func (b *LocalFileBackend) SignedURL(path string, expires time.Duration) (string, *model.AppError) {
+	return "", model.NewLocAppError("SignedURL", "utils.file.signed_url.not_supported.app_error", nil, "driver="+model.IMAGE_DRIVER_LOCAL)
+}
+
+// StartUpload makes an empty file under UPLOADS_DIR that the chunks are added
+// to as they arrive. It's moved into place once they've all been sent.
+func (b *LocalFileBackend) StartUpload(path string) (string, *model.AppError) {
+	uploadId := model.NewId()
+
+	if err := b.Write(UPLOADS_DIR+uploadId, bytes.NewReader(nil)); err != nil {
+		return "", err
+	}
+
+	return uploadId, nil
+}
+
+func (b *LocalFileBackend) WriteChunk(path string, uploadId string, n int, offset int64, data io.Reader) *model.AppError {
+	f, err := os.OpenFile(b.fullPath(UPLOADS_DIR+uploadId), os.O_WRONLY, 0644)
+	if err != nil {
+		return model.NewLocAppError("WriteChunk", "utils.file.local.upload_missing.app_error", nil, err.Error())
+	}
+	defer f.Close()
+
+	if info, err := f.Stat(); err != nil || info.Size() < offset {
+		return model.NewLocAppError("WriteChunk", "utils.file.local.upload_offset.app_error", nil, "upload_id="+uploadId)
+	}
+
+	// throw away anything left over from an earlier attempt to send this chunk
+	if err := f.Truncate(offset); err != nil {
+		return model.NewLocAppError("WriteChunk", "utils.file.local.writing.app_error", nil, err.Error())
+	}
+
+	if _, err := f.Seek(offset, 0); err != nil {
+		return model.NewLocAppError("WriteChunk", "utils.file.local.writing.app_error", nil, err.Error())
+	}
+
+	if _, err := io.Copy(f, data); err != nil {
+		return model.NewLocAppError("WriteChunk", "utils.file.local.writing.app_error", nil, err.Error())
+	}
+
+	return nil
+}
+
+func (b *LocalFileBackend) FinishUpload(path string, uploadId string) *model.AppError {
+	return b.Move(UPLOADS_DIR+uploadId, path)
+}
+
+// AbortUpload removes the partial file. It's not an error if it's already gone
+// since an earlier attempt may have removed it.
+func (b *LocalFileBackend) AbortUpload(path string, uploadId string) *model.AppError {
+	if err := os.Remove(b.fullPath(UPLOADS_DIR + uploadId)); err != nil && !os.IsNotExist(err) {
+		return model.NewLocAppError("AbortUpload", "utils.file.local.removing.app_error", nil, err.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,262 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package utils
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/goamz/goamz/aws"
+	"github.com/goamz/goamz/s3"
+	"github.com/mattermost/platform/model"
+)
+
+// S3FileBackend keeps files in an Amazon S3 bucket or in anything else that
+// speaks the S3 API.
+type S3FileBackend struct {
+	bucket *s3.Bucket
+}
+
+func NewS3FileBackend(settings *model.FileSettings) *S3FileBackend {
+	auth := aws.Auth{
+		AccessKey: settings.AmazonS3AccessKeyId,
+		SecretKey: settings.AmazonS3SecretAccessKey,
+	}
+
+	return &S3FileBackend{bucket: s3.New(auth, awsRegion(settings)).Bucket(settings.AmazonS3Bucket)}
+}
+
+func awsRegion(settings *model.FileSettings) aws.Region {
+	if region, ok := aws.Regions[settings.AmazonS3Region]; ok {
+		return region
+	}
+
+	return aws.Region{
+		Name:                 settings.AmazonS3Region,
+		S3Endpoint:           settings.AmazonS3Endpoint,
+		S3BucketEndpoint:     settings.AmazonS3BucketEndpoint,
+		S3LocationConstraint: *settings.AmazonS3LocationConstraint,
+		S3LowercaseBucket:    *settings.AmazonS3LowercaseBucket,
+	}
+}
+
+func s3ContentType(path string) string {
+	if ext := filepath.Ext(path); model.IsFileExtImage(ext) {
+		return model.GetImageMimeType(ext)
+	}
+
+	return "binary/octet-stream"
+}
+
+func (b *S3FileBackend) Read(path string) (io.ReadCloser, *model.AppError) {
+	// try to get the file from S3 with some basic retry logic
+	tries := 0
+	for {
+		tries++
+
+		r, err := b.bucket.GetReader(path)
+
+		if err == nil {
+			return r, nil
+		} else if tries >= 3 {
+			return nil, model.NewLocAppError("Read", "utils.file.s3.reading.app_error", nil, "path="+path+", err="+err.Error())
+		}
+		time.Sleep(3000 * time.Millisecond)
+	}
+}
+
+// Write uploads the file in one request. S3 needs to know how big it is up
+// front so data that can't say how long it is gets saved to a temporary file
+// first.
+func (b *S3FileBackend) Write(path string, data io.Reader) *model.AppError {
+	var length int64
+
+	if sized, ok := data.(interface {
+		Len() int
+	}); ok {
+		length = int64(sized.Len())
+	} else {
+		tmp, err := ioutil.TempFile("", "s3upload")
+		if err != nil {
+			return model.NewLocAppError("Write", "utils.file.s3.buffering.app_error", nil, err.Error())
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+
+		if length, err = io.Copy(tmp, data); err != nil {
+			return model.NewLocAppError("Write", "utils.file.s3.buffering.app_error", nil, err.Error())
+		}
+
+		if _, err := tmp.Seek(0, 0); err != nil {
+			return model.NewLocAppError("Write", "utils.file.s3.buffering.app_error", nil, err.Error())
+		}
+
+		data = tmp
+	}
+
+	if err := b.bucket.PutReader(path, data, length, s3ContentType(path), s3.Private, s3.Options{}); err != nil {
+		return model.NewLocAppError("Write", "utils.file.s3.writing.app_error", nil, "path="+path+", err="+err.Error())
+	}
+
+	return nil
+}
+
+// Move copies the file to its new path and then deletes the original since
+// S3 has no way to rename an object.
+func (b *S3FileBackend) Move(oldPath, newPath string) *model.AppError {
+	resp, err := b.bucket.GetResponse(oldPath)
+	if err != nil {
+		return model.NewLocAppError("Move", "utils.file.s3.reading.app_error", nil, "path="+oldPath+", err="+err.Error())
+	}
+	defer resp.Body.Close()
+
+	if err := b.bucket.PutReader(newPath, resp.Body, resp.ContentLength, s3ContentType(newPath), s3.Private, s3.Options{}); err != nil {
+		return model.NewLocAppError("Move", "utils.file.s3.writing.app_error", nil, "path="+newPath+", err="+err.Error())
+	}
+
+	return b.Remove(oldPath)
+}
+
+func (b *S3FileBackend) Remove(path string) *model.AppError {
+	if err := b.bucket.Del(path); err != nil {
+		return model.NewLocAppError("Remove", "utils.file.s3.removing.app_error", nil, "path="+path+", err="+err.Error())
+	}
+
+	return nil
+}
+
+func (b *S3FileBackend) List(path string) ([]string, *model.AppError) {
+	prefix := strings.Trim(path, "/")
+	if len(prefix) > 0 {
+		prefix += "/"
+	}
+
+	names := []string{}
+
+	marker := ""
+	for {
+		resp, err := b.bucket.List(prefix, "/", marker, 0)
+		if err != nil {
+			return nil, model.NewLocAppError("List", "utils.file.s3.listing.app_error", nil, "path="+path+", err="+err.Error())
+		}
+
+		for _, key := range resp.Contents {
+			names = append(names, strings.TrimPrefix(key.Key, prefix))
+			marker = key.Key
+		}
+
+		for _, dir := range resp.CommonPrefixes {
+			names = append(names, strings.TrimPrefix(dir, prefix))
+			if dir > marker {
+				marker = dir
+			}
+		}
+
+		if !resp.IsTruncated {
+			break
+		}
+
+		if len(resp.NextMarker) > 0 {
+			marker = resp.NextMarker
+		}
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+func (b *S3FileBackend) Stat(path string) (*FileStat, *model.AppError) {
+	resp, err := b.bucket.Head(path, nil)
+	if err != nil {
+		return nil, model.NewLocAppError("Stat", "utils.file.s3.stat.app_error", nil, "path="+path+", err="+err.Error())
+	}
+	resp.Body.Close()
+
+	stat := &FileStat{Size: resp.ContentLength}
+
+	// some servers that speak the S3 API don't give the time in GMT
+	lastModified := resp.Header.Get("Last-Modified")
+	if modTime, err := http.ParseTime(lastModified); err == nil {
+		stat.ModTime = modTime
+	} else if modTime, err := time.Parse(time.RFC1123, lastModified); err == nil {
+		stat.ModTime = modTime
+	}
+
+	return stat, nil
+}
+
+func (b *S3FileBackend) SignedURL(path string, expires time.Duration) (string, *model.AppError) {
+	return b.bucket.SignedURL(path, time.Now().Add(expires)), nil
+}
+
+// StartUpload begins a multipart upload. Each chunk is sent to S3 as a part so
+// the server never holds more than one chunk at a time.
+func (b *S3FileBackend) StartUpload(path string) (string, *model.AppError) {
+	if multi, err := b.bucket.InitMulti(path, s3ContentType(path), s3.Private); err != nil {
+		return "", model.NewLocAppError("StartUpload", "utils.file.s3.start_upload.app_error", nil, "path="+path+", err="+err.Error())
+	} else {
+		return multi.UploadId, nil
+	}
+}
+
+func (b *S3FileBackend) multi(path string, uploadId string) *s3.Multi {
+	return &s3.Multi{Bucket: b.bucket, Key: path, UploadId: uploadId}
+}
+
+// WriteChunk saves the chunk to a temporary file first since S3 needs the size
+// and checksum of a part before it's sent.
+func (b *S3FileBackend) WriteChunk(path string, uploadId string, n int, offset int64, data io.Reader) *model.AppError {
+	tmp, err := ioutil.TempFile("", "s3upload")
+	if err != nil {
+		return model.NewLocAppError("WriteChunk", "utils.file.s3.buffering.app_error", nil, err.Error())
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if _, err := io.Copy(tmp, data); err != nil {
+		return model.NewLocAppError("WriteChunk", "utils.file.s3.buffering.app_error", nil, err.Error())
+	}
+
+	if _, err := b.multi(path, uploadId).PutPart(n, tmp); err != nil {
+		return model.NewLocAppError("WriteChunk", "utils.file.s3.writing.app_error", nil, "path="+path+", err="+err.Error())
+	}
+
+	return nil
+}
+
+func (b *S3FileBackend) FinishUpload(path string, uploadId string) *model.AppError {
+	multi := b.multi(path, uploadId)
+
+	parts, err := multi.ListParts()
+	if err != nil {
+		return model.NewLocAppError("FinishUpload", "utils.file.s3.finish_upload.app_error", nil, "path="+path+", err="+err.Error())
+	}
+
+	if err := multi.Complete(parts); err != nil {
+		return model.NewLocAppError("FinishUpload", "utils.file.s3.finish_upload.app_error", nil, "path="+path+", err="+err.Error())
+	}
+
+	return nil
+}
+
+// AbortUpload throws away the multipart upload and its parts. It's not an error
+// if S3 no longer knows about the upload since an earlier attempt may have
+// aborted it.
+func (b *S3FileBackend) AbortUpload(path string, uploadId string) *model.AppError {
+	if err := b.multi(path, uploadId).Abort(); err != nil {
+		if s3Err, ok := err.(*s3.Error); ok && s3Err.Code == "NoSuchUpload" {
+			return nil
+		}
+
+		return model.NewLocAppError("AbortUpload", "utils.file.s3.abort_upload.app_error", nil, "path="+path+", err="+err.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,428 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package utils
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/goamz/goamz/s3"
+	"github.com/goamz/goamz/s3/s3test"
+	"github.com/mattermost/platform/model"
+)
+
+// testFileBackend checks that backend behaves the way the rest of the server
+// expects. Every backend should pass it.
+func testFileBackend(t *testing.T, backend FileBackend) {
+	dir := "tests/" + model.NewId()
+
+	if err := backend.Write(dir+"/a.txt", bytes.NewReader([]byte("first"))); err != nil {
+		t.Fatal(err)
+	}
+
+	if data, err := ReadFile(backend, dir+"/a.txt"); err != nil {
+		t.Fatal(err)
+	} else if string(data) != "first" {
+		t.Fatal("should have read back what was written", string(data))
+	}
+
+	if err := backend.Write(dir+"/a.txt", strings.NewReader("second")); err != nil {
+		t.Fatal(err)
+	}
+
+	if data, err := ReadFile(backend, dir+"/a.txt"); err != nil {
+		t.Fatal(err)
+	} else if string(data) != "second" {
+		t.Fatal("should have replaced the file", string(data))
+	}
+
+	// a reader that can't say how long it is, like the ones used to stream exports
+	if err := backend.Write(dir+"/sub/b.txt", io.MultiReader(strings.NewReader("one "), strings.NewReader("two"))); err != nil {
+		t.Fatal(err)
+	}
+
+	if stat, err := backend.Stat(dir + "/sub/b.txt"); err != nil {
+		t.Fatal(err)
+	} else if stat.Size != int64(len("one two")) {
+		t.Fatal("should have the size of the streamed file", stat.Size)
+	} else if stat.ModTime.IsZero() {
+		t.Fatal("should have a modification time")
+	}
+
+	if names, err := backend.List(dir); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(names, []string{"a.txt", "sub/"}) {
+		t.Fatal("should have listed the file and the directory", names)
+	}
+
+	if err := backend.Move(dir+"/a.txt", dir+"/moved/c.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := backend.Stat(dir + "/a.txt"); err == nil {
+		t.Fatal("should have moved the file away")
+	}
+
+	if data, err := ReadFile(backend, dir+"/moved/c.txt"); err != nil {
+		t.Fatal(err)
+	} else if string(data) != "second" {
+		t.Fatal("should have moved the file's contents", string(data))
+	}
+
+	if link, err := backend.SignedURL(dir+"/moved/c.txt", time.Minute); err == nil {
+		if resp, err := http.Get(link); err != nil {
+			t.Fatal(err)
+		} else if data, _ := ioutil.ReadAll(resp.Body); resp.StatusCode != http.StatusOK || string(data) != "second" {
+			t.Fatal("should have downloaded the file from the signed link", resp.Status)
+		}
+	}
+
+	if err := backend.Remove(dir + "/moved/c.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := backend.Stat(dir + "/moved/c.txt"); err == nil {
+		t.Fatal("should have removed the file")
+	}
+
+	testFileBackendUpload(t, backend, dir)
+}
+
+func testFileBackendUpload(t *testing.T, backend FileBackend, dir string) {
+	uploadId, err := backend.StartUpload(dir + "/upload.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := backend.WriteChunk(dir+"/upload.txt", uploadId, 1, 0, strings.NewReader("cut off")); err != nil {
+		t.Fatal(err)
+	}
+
+	// the first chunk is sent again as if the connection dropped part way through
+	if err := backend.WriteChunk(dir+"/upload.txt", uploadId, 1, 0, strings.NewReader("first ")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := backend.WriteChunk(dir+"/upload.txt", uploadId, 2, int64(len("first ")), strings.NewReader("second")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := backend.Stat(dir + "/upload.txt"); err == nil {
+		t.Fatal("shouldn't have made the file before the upload is finished")
+	}
+
+	if err := backend.FinishUpload(dir+"/upload.txt", uploadId); err != nil {
+		t.Fatal(err)
+	}
+
+	if data, err := ReadFile(backend, dir+"/upload.txt"); err != nil {
+		t.Fatal(err)
+	} else if string(data) != "first second" {
+		t.Fatal("should have put the chunks together", string(data))
+	}
+
+	uploadId, err = backend.StartUpload(dir + "/aborted.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := backend.WriteChunk(dir+"/aborted.txt", uploadId, 1, 0, strings.NewReader("first")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := backend.AbortUpload(dir+"/aborted.txt", uploadId); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := backend.Stat(dir + "/aborted.txt"); err == nil {
+		t.Fatal("shouldn't have made the file for an aborted upload")
+	}
+
+	if err := backend.AbortUpload(dir+"/aborted.txt", uploadId); err != nil {
+		t.Fatal("aborting an upload again should succeed", err)
+	}
+}
+
+func TestLocalFileBackend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filebackend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	testFileBackend(t, NewLocalFileBackend(&model.FileSettings{DriverName: model.IMAGE_DRIVER_LOCAL, Directory: dir}))
+}
+
+func TestS3FileBackend(t *testing.T) {
+	srv, err := s3test.NewServer(&s3test.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Quit()
+
+	locationConstraint := true
+	lowercaseBucket := false
+	settings := &model.FileSettings{
+		DriverName:                 model.IMAGE_DRIVER_S3,
+		AmazonS3Bucket:             "filebackend",
+		AmazonS3Region:             "faux-region-1",
+		AmazonS3Endpoint:           srv.URL(),
+		AmazonS3LocationConstraint: &locationConstraint,
+		AmazonS3LowercaseBucket:    &lowercaseBucket,
+	}
+
+	// s3test doesn't know about multipart uploads so they're handled in front of it
+	proxy := httptest.NewServer(newTestS3MultipartServer(srv.URL()))
+	defer proxy.Close()
+	settings.AmazonS3Endpoint = proxy.URL
+
+	backend := NewS3FileBackend(settings)
+	if err := backend.bucket.PutBucket(s3.Private); err != nil {
+		t.Fatal(err)
+	}
+
+	testFileBackend(t, backend)
+}
+
+func TestWebDAVFileBackend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filebackend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	srv := httptest.NewServer(&testWebDAVServer{root: dir})
+	defer srv.Close()
+
+	davUrl := srv.URL + "/dav"
+	username := "user"
+	password := "pass"
+	os.Mkdir(filepath.Join(dir, "dav"), 0700)
+
+	testFileBackend(t, NewWebDAVFileBackend(&model.FileSettings{
+		DriverName:     model.IMAGE_DRIVER_WEBDAV,
+		WebDAVUrl:      &davUrl,
+		WebDAVUsername: &username,
+		WebDAVPassword: &password,
+	}))
+}
+
+// testS3MultipartServer handles the calls for multipart uploads itself and
+// passes everything else on to an s3test server.
+type testS3MultipartServer struct {
+	s3Url   string
+	proxy   *httputil.ReverseProxy
+	mutex   sync.Mutex
+	uploads map[string]map[int][]byte
+}
+
+func newTestS3MultipartServer(s3Url string) *testS3MultipartServer {
+	target, _ := url.Parse(s3Url)
+
+	return &testS3MultipartServer{
+		s3Url:   s3Url,
+		proxy:   httputil.NewSingleHostReverseProxy(target),
+		uploads: make(map[string]map[int][]byte),
+	}
+}
+
+func (s *testS3MultipartServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	if _, ok := query["uploads"]; ok && r.Method == "POST" {
+		uploadId := model.NewId()
+
+		s.mutex.Lock()
+		s.uploads[uploadId] = make(map[int][]byte)
+		s.mutex.Unlock()
+
+		w.Write([]byte("<InitiateMultipartUploadResult><UploadId>" + uploadId + "</UploadId></InitiateMultipartUploadResult>"))
+		return
+	}
+
+	uploadId := query.Get("uploadId")
+	if len(uploadId) == 0 {
+		s.proxy.ServeHTTP(w, r)
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	parts, ok := s.uploads[uploadId]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("<Error><Code>NoSuchUpload</Code></Error>"))
+		return
+	}
+
+	switch r.Method {
+	case "PUT":
+		n, _ := strconv.Atoi(query.Get("partNumber"))
+		parts[n], _ = ioutil.ReadAll(r.Body)
+		w.Header().Set("ETag", `"`+strconv.Itoa(n)+`"`)
+	case "GET":
+		numbers := []int{}
+		for n := range parts {
+			numbers = append(numbers, n)
+		}
+		sort.Ints(numbers)
+
+		result := "<ListPartsResult><IsTruncated>false</IsTruncated>"
+		for _, n := range numbers {
+			result += "<Part><PartNumber>" + strconv.Itoa(n) + "</PartNumber><ETag>\"" + strconv.Itoa(n) + "\"</ETag><Size>" + strconv.Itoa(len(parts[n])) + "</Size></Part>"
+		}
+		w.Write([]byte(result + "</ListPartsResult>"))
+	case "POST":
+		var complete struct {
+			Parts []struct {
+				PartNumber int
+			} `xml:"Part"`
+		}
+		xml.NewDecoder(r.Body).Decode(&complete)
+
+		var data []byte
+		for _, part := range complete.Parts {
+			data = append(data, parts[part.PartNumber]...)
+		}
+
+		req, _ := http.NewRequest("PUT", s.s3Url+r.URL.Path, bytes.NewReader(data))
+		if resp, err := http.DefaultClient.Do(req); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		} else {
+			resp.Body.Close()
+		}
+
+		delete(s.uploads, uploadId)
+		w.Write([]byte("<CompleteMultipartUploadResult></CompleteMultipartUploadResult>"))
+	case "DELETE":
+		delete(s.uploads, uploadId)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// testWebDAVServer is just enough of a WebDAV server to run the backend
+// against, keeping its files in root.
+type testWebDAVServer struct {
+	root string
+}
+
+func (s *testWebDAVServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if username, password, ok := r.BasicAuth(); !ok || username != "user" || password != "pass" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	path := filepath.Join(s.root, filepath.FromSlash(r.URL.Path))
+
+	switch r.Method {
+	case "GET":
+		if f, err := os.Open(path); err != nil {
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			defer f.Close()
+			io.Copy(w, f)
+		}
+	case "PUT":
+		if f, err := os.Create(path); err != nil {
+			w.WriteHeader(http.StatusConflict)
+		} else {
+			defer f.Close()
+			io.Copy(f, r.Body)
+			w.WriteHeader(http.StatusCreated)
+		}
+	case "MKCOL":
+		if _, err := os.Stat(path); err == nil {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		} else if err := os.Mkdir(path, 0700); err != nil {
+			w.WriteHeader(http.StatusConflict)
+		} else {
+			w.WriteHeader(http.StatusCreated)
+		}
+	case "DELETE":
+		if _, err := os.Stat(path); err != nil {
+			w.WriteHeader(http.StatusNotFound)
+		} else if err := os.RemoveAll(path); err != nil {
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	case "MOVE":
+		destination, err := url.Parse(r.Header.Get("Destination"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+		} else if err := os.Rename(path, filepath.Join(s.root, filepath.FromSlash(destination.Path))); err != nil {
+			w.WriteHeader(http.StatusConflict)
+		} else {
+			w.WriteHeader(http.StatusCreated)
+		}
+	case "PROPFIND":
+		s.propfind(w, r, path)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *testWebDAVServer) propfind(w http.ResponseWriter, r *http.Request, path string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	type prop struct {
+		Collection    *struct{} `xml:"D:resourcetype>D:collection,omitempty"`
+		ContentLength string    `xml:"D:getcontentlength,omitempty"`
+		LastModified  string    `xml:"D:getlastmodified"`
+	}
+
+	type response struct {
+		Href string `xml:"D:href"`
+		Prop prop   `xml:"D:propstat>D:prop"`
+	}
+
+	makeResponse := func(href string, info os.FileInfo) response {
+		res := response{Href: href, Prop: prop{LastModified: info.ModTime().UTC().Format(http.TimeFormat)}}
+		if info.IsDir() {
+			res.Prop.Collection = &struct{}{}
+		} else {
+			res.Prop.ContentLength = strconv.FormatInt(info.Size(), 10)
+		}
+		return res
+	}
+
+	responses := []response{makeResponse(r.URL.EscapedPath(), info)}
+
+	if info.IsDir() && r.Header.Get("Depth") == "1" {
+		children, _ := ioutil.ReadDir(path)
+		for _, child := range children {
+			href := &url.URL{Path: strings.TrimSuffix(r.URL.Path, "/") + "/" + child.Name()}
+			responses = append(responses, makeResponse(href.EscapedPath(), child))
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	xml.NewEncoder(w).Encode(struct {
+		XMLName   xml.Name   `xml:"D:multistatus"`
+		Namespace string     `xml:"xmlns:D,attr"`
+		Responses []response `xml:"D:response"`
+	}{Namespace: "DAV:", Responses: responses})
+}
@@ -0,0 +1,296 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package utils
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattermost/platform/model"
+)
+
+// WebDAVFileBackend keeps files on a WebDAV server such as the ones built in to
+// ownCloud, Nextcloud and Apache's mod_dav.
+type WebDAVFileBackend struct {
+	baseUrl  string
+	username string
+	password string
+	client   *http.Client
+}
+
+func NewWebDAVFileBackend(settings *model.FileSettings) *WebDAVFileBackend {
+	return &WebDAVFileBackend{
+		baseUrl:  strings.TrimRight(*settings.WebDAVUrl, "/") + "/",
+		username: *settings.WebDAVUsername,
+		password: *settings.WebDAVPassword,
+		client:   &http.Client{},
+	}
+}
+
+type webDAVMultistatus struct {
+	Responses []webDAVResponse `xml:"response"`
+}
+
+type webDAVResponse struct {
+	Href          string    `xml:"href"`
+	Collection    *struct{} `xml:"propstat>prop>resourcetype>collection"`
+	ContentLength string    `xml:"propstat>prop>getcontentlength"`
+	LastModified  string    `xml:"propstat>prop>getlastmodified"`
+}
+
+const webDAVPropfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<propfind xmlns="DAV:"><prop><resourcetype/><getcontentlength/><getlastmodified/></prop></propfind>`
+
+func (b *WebDAVFileBackend) url(path string) string {
+	u := &url.URL{Path: strings.TrimLeft(path, "/")}
+	return b.baseUrl + u.EscapedPath()
+}
+
+// do sends a request to the server and returns the response if its status is
+// one of expected. Otherwise the response is closed and an error is returned.
+func (b *WebDAVFileBackend) do(method string, path string, body io.Reader, headers map[string]string, expected ...int) (*http.Response, error) {
+	req, err := http.NewRequest(method, b.url(path), body)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	if len(b.username) > 0 {
+		req.SetBasicAuth(b.username, b.password)
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, status := range expected {
+		if resp.StatusCode == status {
+			return resp, nil
+		}
+	}
+
+	resp.Body.Close()
+	return nil, &webDAVError{method: method, status: resp.Status}
+}
+
+type webDAVError struct {
+	method string
+	status string
+}
+
+func (e *webDAVError) Error() string {
+	return e.method + " returned " + e.status
+}
+
+// makeParentDirs makes the collections above path since WebDAV servers won't
+// make them on their own. Collections that already exist are left alone.
+func (b *WebDAVFileBackend) makeParentDirs(path string) error {
+	for _, dir := range parentDirs(path) {
+		if resp, err := b.do("MKCOL", dir, nil, nil, http.StatusCreated, http.StatusMethodNotAllowed); err != nil {
+			return err
+		} else {
+			resp.Body.Close()
+		}
+	}
+
+	return nil
+}
+
+func (b *WebDAVFileBackend) propfind(path string, depth string) (*webDAVMultistatus, error) {
+	resp, err := b.do("PROPFIND", path, strings.NewReader(webDAVPropfindBody), map[string]string{"Depth": depth, "Content-Type": "application/xml"}, http.StatusMultiStatus)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var multistatus webDAVMultistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&multistatus); err != nil {
+		return nil, err
+	}
+
+	return &multistatus, nil
+}
+
+func (b *WebDAVFileBackend) Read(path string) (io.ReadCloser, *model.AppError) {
+	if resp, err := b.do("GET", path, nil, nil, http.StatusOK); err != nil {
+		return nil, model.NewLocAppError("Read", "utils.file.webdav.reading.app_error", nil, "path="+path+", err="+err.Error())
+	} else {
+		return resp.Body, nil
+	}
+}
+
+func (b *WebDAVFileBackend) Write(path string, data io.Reader) *model.AppError {
+	if err := b.makeParentDirs(path); err != nil {
+		return model.NewLocAppError("Write", "utils.file.webdav.create_dir.app_error", nil, "path="+path+", err="+err.Error())
+	}
+
+	if resp, err := b.do("PUT", path, data, nil, http.StatusOK, http.StatusCreated, http.StatusNoContent); err != nil {
+		return model.NewLocAppError("Write", "utils.file.webdav.writing.app_error", nil, "path="+path+", err="+err.Error())
+	} else {
+		resp.Body.Close()
+	}
+
+	return nil
+}
+
+func (b *WebDAVFileBackend) Move(oldPath, newPath string) *model.AppError {
+	if err := b.makeParentDirs(newPath); err != nil {
+		return model.NewLocAppError("Move", "utils.file.webdav.create_dir.app_error", nil, "path="+newPath+", err="+err.Error())
+	}
+
+	headers := map[string]string{"Destination": b.url(newPath), "Overwrite": "T"}
+	if resp, err := b.do("MOVE", oldPath, nil, headers, http.StatusCreated, http.StatusNoContent); err != nil {
+		return model.NewLocAppError("Move", "utils.file.webdav.moving.app_error", nil, "path="+oldPath+", err="+err.Error())
+	} else {
+		resp.Body.Close()
+	}
+
+	return nil
+}
+
+func (b *WebDAVFileBackend) Remove(path string) *model.AppError {
+	if resp, err := b.do("DELETE", path, nil, nil, http.StatusOK, http.StatusNoContent); err != nil {
+		return model.NewLocAppError("Remove", "utils.file.webdav.removing.app_error", nil, "path="+path+", err="+err.Error())
+	} else {
+		resp.Body.Close()
+	}
+
+	return nil
+}
+
+func (b *WebDAVFileBackend) List(path string) ([]string, *model.AppError) {
+	dir := strings.Trim(path, "/")
+	if len(dir) > 0 {
+		dir += "/"
+	}
+
+	multistatus, err := b.propfind(dir, "1")
+	if err != nil {
+		return nil, model.NewLocAppError("List", "utils.file.webdav.listing.app_error", nil, "path="+path+", err="+err.Error())
+	}
+
+	base, _ := url.Parse(b.url(dir))
+
+	names := []string{}
+	for _, response := range multistatus.Responses {
+		href, err := url.Parse(response.Href)
+		if err != nil {
+			continue
+		}
+
+		name := strings.TrimPrefix(strings.TrimSuffix(href.Path, "/"), strings.TrimSuffix(base.Path, "/")+"/")
+		if len(name) == 0 || name == href.Path || strings.Contains(name, "/") {
+			// the listing includes the directory itself
+			continue
+		}
+
+		if response.Collection != nil {
+			name += "/"
+		}
+
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+func (b *WebDAVFileBackend) Stat(path string) (*FileStat, *model.AppError) {
+	multistatus, err := b.propfind(path, "0")
+	if err != nil {
+		return nil, model.NewLocAppError("Stat", "utils.file.webdav.stat.app_error", nil, "path="+path+", err="+err.Error())
+	} else if len(multistatus.Responses) == 0 {
+		return nil, model.NewLocAppError("Stat", "utils.file.webdav.stat.app_error", nil, "path="+path)
+	}
+
+	response := multistatus.Responses[0]
+
+	stat := &FileStat{}
+	stat.Size, _ = strconv.ParseInt(response.ContentLength, 10, 64)
+	if modTime, err := http.ParseTime(response.LastModified); err == nil {
+		stat.ModTime = modTime
+	}
+
+	return stat, nil
+}
+
+func (b *WebDAVFileBackend) SignedURL(path string, expires time.Duration) (string, *model.AppError) {
+	return "", model.NewLocAppError("SignedURL", "utils.file.signed_url.not_supported.app_error", nil, "driver="+model.IMAGE_DRIVER_WEBDAV)
+}
+
+// StartUpload makes a collection under UPLOADS_DIR to keep the chunks in
+// since WebDAV has no way to add to the end of a file.
+func (b *WebDAVFileBackend) StartUpload(path string) (string, *model.AppError) {
+	uploadId := model.NewId()
+
+	if err := b.makeParentDirs(UPLOADS_DIR + uploadId + "/chunk"); err != nil {
+		return "", model.NewLocAppError("StartUpload", "utils.file.webdav.create_dir.app_error", nil, "path="+path+", err="+err.Error())
+	}
+
+	return uploadId, nil
+}
+
+func (b *WebDAVFileBackend) WriteChunk(path string, uploadId string, n int, offset int64, data io.Reader) *model.AppError {
+	// pad the number so that the chunks are listed in order
+	return b.Write(fmt.Sprintf("%v%v/%08d", UPLOADS_DIR, uploadId, n), data)
+}
+
+// FinishUpload streams the chunks one after another into the file at path.
+func (b *WebDAVFileBackend) FinishUpload(path string, uploadId string) *model.AppError {
+	dir := UPLOADS_DIR + uploadId
+
+	chunks, err := b.List(dir)
+	if err != nil {
+		return err
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		for _, chunk := range chunks {
+			r, err := b.Read(dir + "/" + chunk)
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+
+			_, copyErr := io.Copy(pw, r)
+			r.Close()
+			if copyErr != nil {
+				pw.CloseWithError(copyErr)
+				return
+			}
+		}
+		pw.Close()
+	}()
+
+	if err := b.Write(path, pr); err != nil {
+		pr.CloseWithError(err)
+		return err
+	}
+
+	return b.Remove(dir + "/")
+}
+
+// AbortUpload removes the collection of chunks. It's not an error if it's
+// already gone since an earlier attempt may have removed it.
+func (b *WebDAVFileBackend) AbortUpload(path string, uploadId string) *model.AppError {
+	if resp, err := b.do("DELETE", UPLOADS_DIR+uploadId+"/", nil, nil, http.StatusOK, http.StatusNoContent, http.StatusNotFound); err != nil {
+		return model.NewLocAppError("AbortUpload", "utils.file.webdav.removing.app_error", nil, "path="+path+", err="+err.Error())
+	} else {
+		resp.Body.Close()
+	}
+
+	return nil
+}
@@ -0,0 +1,443 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package utils
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/mattermost/platform/model"
+)
+
+const (
+	// how far into a pdf text is looked for
+	PDF_TEXT_MAX_PAGES = 500
+
+	// the text of a TJ operation is split into words when it moves this far
+	// along, measured in thousandths of the font size. Spaces are usually at
+	// least 200 while kerning is much less.
+	pdfTextWordSpacing = 150
+)
+
+// windows-1252 characters that differ from latin-1 and are common in pdfs
+// that use the standard encoding
+var pdfWinAnsiRunes = map[byte]rune{
+	0x80: '€', 0x85: '…', 0x91: '‘', 0x92: '’', 0x93: '“', 0x94: '”', 0x95: '•', 0x96: '–', 0x97: '—', 0x99: '™',
+}
+
+// the text of the glyph names that simple fonts can give their codes in their
+// encoding's differences, other than the names that are the character itself
+var pdfGlyphNames = map[string]string{
+	"ff": "ff", "fi": "fi", "fl": "fl", "ffi": "ffi", "ffl": "ffl",
+	"space": " ", "exclam": "!", "quotedbl": "\"", "numbersign": "#", "dollar": "$", "percent": "%", "ampersand": "&",
+	"quotesingle": "'", "quoteright": "’", "quoteleft": "‘", "quotedblleft": "“", "quotedblright": "”",
+	"parenleft": "(", "parenright": ")", "asterisk": "*", "plus": "+", "comma": ",", "hyphen": "-", "period": ".", "slash": "/",
+	"colon": ":", "semicolon": ";", "less": "<", "equal": "=", "greater": ">", "question": "?", "at": "@",
+	"bracketleft": "[", "backslash": "\\", "bracketright": "]", "underscore": "_", "braceleft": "{", "bar": "|", "braceright": "}",
+	"endash": "–", "emdash": "—", "bullet": "•", "ellipsis": "…",
+	"zero": "0", "one": "1", "two": "2", "three": "3", "four": "4", "five": "5", "six": "6", "seven": "7", "eight": "8", "nine": "9",
+}
+
+// CanExtractText returns true if ExtractText can get the text out of the file.
+func CanExtractText(filename string) bool {
+	switch extension := strings.ToLower(filepath.Ext(filename)); extension {
+	case ".pdf", ".docx":
+		return true
+	default:
+		return isTextFileExtension(extension)
+	}
+}
+
+func isTextFileExtension(extension string) bool {
+	if _, ok := codeLanguages[extension]; ok {
+		return true
+	}
+
+	for _, textExtension := range TEXT_PREVIEW_EXTENSIONS {
+		if extension == textExtension {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ExtractText gets the text out of plain text, source code, pdf and docx files
+// so that they can be searched. Text past model.FILE_CONTENT_MAX_SIZE is dropped.
+func ExtractText(filename string, data []byte) (string, *model.AppError) {
+	var text string
+	var err error
+
+	switch extension := strings.ToLower(filepath.Ext(filename)); extension {
+	case ".pdf":
+		text, err = extractPdfText(data)
+	case ".docx":
+		text, err = extractDocxText(data)
+	default:
+		if !isTextFileExtension(extension) {
+			return "", model.NewLocAppError("ExtractText", "utils.file_text.unsupported.app_error", nil, "filename="+filename)
+		}
+
+		if len(data) > model.FILE_CONTENT_MAX_SIZE {
+			data = trimPartialRune(data[:model.FILE_CONTENT_MAX_SIZE])
+		}
+
+		if bytes.IndexByte(data, 0) != -1 || !utf8.Valid(data) {
+			return "", model.NewLocAppError("ExtractText", "utils.file_text.binary.app_error", nil, "filename="+filename)
+		}
+
+		text = string(data)
+	}
+
+	if err != nil {
+		return "", model.NewLocAppError("ExtractText", "utils.file_text.extract.app_error", nil, "filename="+filename+", err="+err.Error())
+	}
+
+	return text, nil
+}
+
+// pdfTextFont is what's needed to turn the strings shown with a font back into text.
+type pdfTextFont struct {
+	composite   bool
+	codeLength  int
+	toUnicode   map[string]string
+	differences map[byte]string
+}
+
+type pdfTextExtractor struct {
+	doc   *pdfDocument
+	buf   *bytes.Buffer
+	font  *pdfTextFont
+	fonts map[pdfName]*pdfTextFont
+}
+
+func extractPdfText(data []byte) (text string, err error) {
+	// malformed files shouldn't take the server down with them
+	defer func() {
+		if r := recover(); r != nil {
+			text = ""
+			err = fmt.Errorf("pdf: %v", r)
+		}
+	}()
+
+	doc, err := parsePdf(data)
+	if err != nil {
+		return "", err
+	}
+
+	buf := &bytes.Buffer{}
+	for _, page := range doc.pages(PDF_TEXT_MAX_PAGES) {
+		extractor := &pdfTextExtractor{doc: doc, buf: buf, fonts: map[pdfName]*pdfTextFont{}}
+		eachPdfOperation(doc.contents(page), func(op string, operands []interface{}) {
+			extractor.do(op, operands, page.resources)
+		})
+		buf.WriteByte('\n')
+
+		if buf.Len() >= model.FILE_CONTENT_MAX_SIZE {
+			break
+		}
+	}
+
+	return cleanExtractedText(buf.String()), nil
+}
+
+func (e *pdfTextExtractor) do(op string, operands []interface{}, resources pdfDict) {
+	switch op {
+	case "Tf":
+		if len(operands) == 2 {
+			if name, ok := operands[0].(pdfName); ok {
+				e.font = e.loadFont(resources, name)
+			}
+		}
+	case "Td", "TD":
+		if len(operands) == 2 {
+			if ty, _ := pdfNumber(operands[1]); ty != 0 {
+				e.buf.WriteByte('\n')
+			} else {
+				e.buf.WriteByte(' ')
+			}
+		}
+	case "T*", "ET":
+		e.buf.WriteByte('\n')
+	case "Tj":
+		if len(operands) == 1 {
+			e.showText(operands[0])
+		}
+	case "'", "\"":
+		e.buf.WriteByte('\n')
+		if len(operands) > 0 {
+			e.showText(operands[len(operands)-1])
+		}
+	case "TJ":
+		if len(operands) == 1 {
+			if array, ok := operands[0].([]interface{}); ok {
+				for _, item := range array {
+					if n, ok := pdfNumber(item); ok && n <= -pdfTextWordSpacing {
+						e.buf.WriteByte(' ')
+					} else {
+						e.showText(item)
+					}
+				}
+			}
+		}
+	}
+}
+
+func (e *pdfTextExtractor) loadFont(resources pdfDict, name pdfName) *pdfTextFont {
+	if font, ok := e.fonts[name]; ok {
+		return font
+	}
+
+	dict := e.doc.resolveDict(e.doc.resolveDict(resources["Font"])[name])
+
+	font := &pdfTextFont{codeLength: 1}
+	if dict["Subtype"] == pdfName("Type0") {
+		font.composite = true
+		font.codeLength = 2
+	}
+
+	if encoding := e.doc.resolveDict(dict["Encoding"]); encoding != nil && !font.composite {
+		font.differences = e.readDifferences(encoding)
+	}
+
+	if stream, ok := e.doc.resolve(dict["ToUnicode"]).(*pdfStream); ok {
+		if cmap, filter, err := e.doc.decodeStream(stream); err == nil && filter == "" {
+			font.toUnicode = parsePdfCMap(cmap, &font.codeLength)
+		}
+	}
+
+	e.fonts[name] = font
+	return font
+}
+
+// readDifferences gets the text of the codes that an encoding gives glyph
+// names to. Names that can't be turned into text are left out.
+func (e *pdfTextExtractor) readDifferences(encoding pdfDict) map[byte]string {
+	differences := map[byte]string{}
+
+	code := 0
+	for _, item := range e.doc.resolveArray(encoding["Differences"]) {
+		switch v := e.doc.resolve(item).(type) {
+		case float64:
+			code = int(v)
+		case pdfName:
+			if text := pdfGlyphText(string(v)); text != "" && code >= 0 && code < 256 {
+				differences[byte(code)] = text
+			}
+			code++
+		}
+	}
+
+	return differences
+}
+
+func pdfGlyphText(name string) string {
+	if text, ok := pdfGlyphNames[name]; ok {
+		return text
+	} else if utf8.RuneCountInString(name) == 1 {
+		return name
+	} else if strings.HasPrefix(name, "uni") && len(name) == 7 {
+		if n, err := strconv.ParseUint(name[3:], 16, 16); err == nil {
+			return string(rune(n))
+		}
+	}
+
+	return ""
+}
+
+func (e *pdfTextExtractor) showText(operand interface{}) {
+	s, ok := operand.(string)
+	if !ok {
+		return
+	}
+
+	font := e.font
+	if font == nil {
+		font = &pdfTextFont{codeLength: 1}
+	}
+
+	for i := 0; i+font.codeLength <= len(s); i += font.codeLength {
+		code := s[i : i+font.codeLength]
+
+		if text, ok := font.toUnicode[code]; ok {
+			e.buf.WriteString(text)
+		} else if text, ok := font.differences[code[0]]; ok && !font.composite {
+			e.buf.WriteString(text)
+		} else if font.composite {
+			// the codes of composite fonts can't be read without a ToUnicode map
+			continue
+		} else if r, ok := pdfWinAnsiRunes[code[0]]; ok {
+			e.buf.WriteRune(r)
+		} else if code[0] >= ' ' {
+			e.buf.WriteRune(rune(code[0]))
+		}
+	}
+}
+
+// parsePdfCMap reads the characters that each code maps to out of a ToUnicode
+// CMap. The length of the codes is set from the CMap's code space.
+func parsePdfCMap(data []byte, codeLength *int) map[string]string {
+	cmap := map[string]string{}
+
+	eachPdfOperation(data, func(op string, operands []interface{}) {
+		switch op {
+		case "endcodespacerange":
+			if len(operands) > 0 {
+				if code, ok := operands[0].(string); ok && len(code) > 0 {
+					*codeLength = len(code)
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				code, ok := operands[i].(string)
+				text, ok2 := operands[i+1].(string)
+				if ok && ok2 {
+					cmap[code] = decodeUtf16(text)
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				low, ok := operands[i].(string)
+				high, ok2 := operands[i+1].(string)
+				if !ok || !ok2 || len(low) != len(high) || len(low) == 0 {
+					continue
+				}
+
+				start, end := pdfCode(low), pdfCode(high)
+				for code := start; code <= end && code-start < 0x10000; code++ {
+					var text string
+					if array, ok := operands[i+2].([]interface{}); ok {
+						if int(code-start) >= len(array) {
+							break
+						}
+						text, _ = array[code-start].(string)
+					} else if first, ok := operands[i+2].(string); ok && len(first) >= 2 {
+						// the last character of the destination counts up along with the code
+						last := []byte(first)
+						last[len(last)-1] += byte(code - start)
+						text = string(last)
+					}
+
+					cmap[pdfCodeString(code, len(low))] = decodeUtf16(text)
+				}
+			}
+		}
+	})
+
+	return cmap
+}
+
+func pdfCode(s string) uint32 {
+	var code uint32
+	for i := 0; i < len(s); i++ {
+		code = code<<8 | uint32(s[i])
+	}
+
+	return code
+}
+
+func pdfCodeString(code uint32, length int) string {
+	b := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		b[i] = byte(code)
+		code >>= 8
+	}
+
+	return string(b)
+}
+
+func decodeUtf16(s string) string {
+	units := make([]uint16, 0, len(s)/2)
+	for i := 0; i+1 < len(s); i += 2 {
+		units = append(units, uint16(s[i])<<8|uint16(s[i+1]))
+	}
+
+	return string(utf16.Decode(units))
+}
+
+func extractDocxText(data []byte) (string, error) {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", err
+	}
+
+	for _, file := range reader.File {
+		if file.Name != "word/document.xml" {
+			continue
+		}
+
+		rc, err := file.Open()
+		if err != nil {
+			return "", err
+		}
+		defer rc.Close()
+
+		buf := &bytes.Buffer{}
+		decoder := xml.NewDecoder(rc)
+		inText := false
+
+		for buf.Len() < model.FILE_CONTENT_MAX_SIZE {
+			token, err := decoder.Token()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return "", err
+			}
+
+			switch t := token.(type) {
+			case xml.StartElement:
+				switch t.Name.Local {
+				case "t":
+					inText = true
+				case "tab":
+					buf.WriteByte('\t')
+				case "br", "cr":
+					buf.WriteByte('\n')
+				}
+			case xml.EndElement:
+				switch t.Name.Local {
+				case "t":
+					inText = false
+				case "p":
+					buf.WriteByte('\n')
+				}
+			case xml.CharData:
+				if inText {
+					buf.Write(t)
+				}
+			}
+		}
+
+		return cleanExtractedText(buf.String()), nil
+	}
+
+	return "", errors.New("docx: missing word/document.xml")
+}
+
+// cleanExtractedText collapses the whitespace in each line, drops empty lines
+// and cuts the text down to what can be stored.
+func cleanExtractedText(text string) string {
+	lines := []string{}
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	text = strings.Join(lines, "\n")
+	if len(text) > model.FILE_CONTENT_MAX_SIZE {
+		text = string(trimPartialRune([]byte(text[:model.FILE_CONTENT_MAX_SIZE])))
+	}
+
+	return text
+}
@@ -0,0 +1,153 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package utils
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/platform/model"
+)
+
+func TestCanExtractText(t *testing.T) {
+	for _, filename := range []string{"notes.txt", "README.md", "main.go", "report.PDF", "letter.docx"} {
+		if !CanExtractText(filename) {
+			t.Fatal("should be able to extract text from " + filename)
+		}
+	}
+
+	for _, filename := range []string{"photo.jpg", "setup.exe", "Makefile", "letter.doc"} {
+		if CanExtractText(filename) {
+			t.Fatal("shouldn't be able to extract text from " + filename)
+		}
+	}
+}
+
+func TestExtractText(t *testing.T) {
+	if text, err := ExtractText("notes.txt", []byte("some notes\n")); err != nil {
+		t.Fatal(err)
+	} else if text != "some notes\n" {
+		t.Fatal("should have kept the text as it is", text)
+	}
+
+	if _, err := ExtractText("notes.txt", []byte{'a', 0, 'b'}); err == nil {
+		t.Fatal("should have failed, binary file")
+	}
+
+	if _, err := ExtractText("photo.jpg", []byte("text")); err == nil {
+		t.Fatal("should have failed, unsupported file")
+	}
+
+	if text, err := ExtractText("large.txt", []byte(strings.Repeat("é", model.FILE_CONTENT_MAX_SIZE))); err != nil {
+		t.Fatal(err)
+	} else if len(text) > model.FILE_CONTENT_MAX_SIZE {
+		t.Fatal("should have cut the text down")
+	}
+}
+
+func TestExtractPdfText(t *testing.T) {
+	content := "BT /F1 12 Tf 10 80 Td (Hello) Tj [(wor) -20 (ld) -400 (again)] TJ 0 -14 Td (\\223quoted\\224) Tj ET"
+
+	text, err := ExtractText("test.pdf", makeTestPdf(content, true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if text != "Helloworld again\n“quoted”" {
+		t.Fatal("got incorrect text", text)
+	}
+
+	if _, err := ExtractText("test.pdf", []byte("not a pdf")); err == nil {
+		t.Fatal("should have failed, not a pdf")
+	}
+
+	if pdfGlyphText("fi") != "fi" || pdfGlyphText("a") != "a" || pdfGlyphText("uni00E9") != "é" || pdfGlyphText("g123") != "" {
+		t.Fatal("got incorrect text for glyph names")
+	}
+}
+
+func TestParsePdfCMap(t *testing.T) {
+	cmap := `/CIDInit /ProcSet findresource begin
+12 dict begin
+begincmap
+1 begincodespacerange
+<0000> <FFFF>
+endcodespacerange
+2 beginbfchar
+<0003> <0020>
+<0011> <FB01>
+endbfchar
+2 beginbfrange
+<0024> <0026> <0041>
+<0044> <0045> [<0064> <00650301>]
+endbfrange
+endcmap`
+
+	codeLength := 1
+	toUnicode := parsePdfCMap([]byte(cmap), &codeLength)
+
+	if codeLength != 2 {
+		t.Fatal("should have read the length of the codes")
+	}
+
+	expected := map[string]string{
+		"\x00\x03": " ",
+		"\x00\x11": "ﬁ",
+		"\x00\x24": "A",
+		"\x00\x25": "B",
+		"\x00\x26": "C",
+		"\x00\x44": "d",
+		"\x00\x45": "é",
+	}
+
+	if len(toUnicode) != len(expected) {
+		t.Fatal("got incorrect map", toUnicode)
+	}
+
+	for code, text := range expected {
+		if toUnicode[code] != text {
+			t.Fatal("got incorrect text for code", []byte(code), toUnicode[code])
+		}
+	}
+
+	extractor := &pdfTextExtractor{buf: &bytes.Buffer{}, font: &pdfTextFont{composite: true, codeLength: 2, toUnicode: toUnicode}}
+	extractor.showText("\x00\x24\x00\x03\x00\x11\x00\x99")
+	if extractor.buf.String() != "A ﬁ" {
+		t.Fatal("should have skipped codes that aren't in the map", extractor.buf.String())
+	}
+}
+
+func TestExtractDocxText(t *testing.T) {
+	document := `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">
+<w:body>
+<w:p><w:r><w:t>Meeting</w:t></w:r><w:r><w:t xml:space="preserve"> minutes</w:t></w:r></w:p>
+<w:p><w:r><w:t>Item</w:t><w:tab/><w:t>Owner &amp; date</w:t></w:r></w:p>
+<w:p><w:pPr><w:pStyle w:val="Normal"/></w:pPr></w:p>
+</w:body>
+</w:document>`
+
+	buf := &bytes.Buffer{}
+	writer := zip.NewWriter(buf)
+	if w, err := writer.Create("word/document.xml"); err != nil {
+		t.Fatal(err)
+	} else {
+		w.Write([]byte(document))
+	}
+	writer.Close()
+
+	if text, err := ExtractText("minutes.docx", buf.Bytes()); err != nil {
+		t.Fatal(err)
+	} else if text != "Meeting minutes\nItem Owner & date" {
+		t.Fatal("got incorrect text", text)
+	}
+
+	empty := &bytes.Buffer{}
+	zip.NewWriter(empty).Close()
+	if _, err := ExtractText("empty.docx", empty.Bytes()); err == nil {
+		t.Fatal("should have failed, missing the document")
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package utils
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var reservedIPRanges []*net.IPNet
+
+func init() {
+	for _, cidr := range []string{
+		"0.0.0.0/8",
+		"10.0.0.0/8",
+		"100.64.0.0/10",
+		"127.0.0.0/8",
+		"169.254.0.0/16",
+		"172.16.0.0/12",
+		"192.168.0.0/16",
+		"::/128",
+		"::1/128",
+		"fc00::/7",
+		"fe80::/10",
+	} {
+		_, ipNet, _ := net.ParseCIDR(cidr)
+		reservedIPRanges = append(reservedIPRanges, ipNet)
+	}
+}
+
+// IsReservedIP returns true for loopback, private and link-local addresses,
+// which are only reachable from inside the server's own network.
+func IsReservedIP(ip net.IP) bool {
+	for _, ipNet := range reservedIPRanges {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isAllowedInternalHost checks whether a host has been listed in
+// AllowedUntrustedInternalConnections by the system admin.
+func isAllowedInternalHost(host string) bool {
+	for _, allowed := range strings.Fields(*Cfg.ServiceSettings.AllowedUntrustedInternalConnections) {
+		if strings.EqualFold(host, allowed) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsValidUntrustedUrl checks that a URL supplied by a user or integration is an
+// absolute http or https URL that the server can be asked to make requests to.
+func IsValidUntrustedUrl(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil {
+		return false
+	}
+
+	host := strings.Trim(u.Host, "[]")
+	if h, _, err := net.SplitHostPort(u.Host); err == nil {
+		host = h
+	}
+
+	if ip := net.ParseIP(host); ip != nil && IsReservedIP(ip) && !isAllowedInternalHost(host) {
+		return false
+	}
+
+	return true
+}
+
+// dialUntrusted connects to addr unless the host resolves to a reserved address
+// that hasn't been allowed. The address that was checked is the one that is
+// dialed so the host can't resolve somewhere else in between.
+func dialUntrusted(dialer *net.Dialer, network string, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := isAllowedInternalHost(host)
+
+	for _, ip := range ips {
+		if IsReservedIP(ip) && !allowed && !isAllowedInternalHost(ip.String()) {
+			continue
+		}
+
+		return dialer.Dial(network, net.JoinHostPort(ip.String(), port))
+	}
+
+	return nil, errors.New("address forbidden, you may need to set AllowedUntrustedInternalConnections to allow an integration access to your internal network")
+}
+
+// NewUntrustedHttpClient creates a client for requests to URLs that come from
+// users or integrations. It won't connect to the server's internal network
+// unless the host has been allowed in the config.
+func NewUntrustedHttpClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Dial: func(network string, addr string) (net.Conn, error) {
+				return dialUntrusted(dialer, network, addr)
+			},
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: *Cfg.ServiceSettings.EnableInsecureOutgoingConnections},
+		},
+	}
+}
@@ -119,6 +119,7 @@ func getClientLicense(l *model.License) map[string]string {
 		props["MFA"] = strconv.FormatBool(*l.Features.MFA)
 		props["GoogleSSO"] = strconv.FormatBool(*l.Features.GoogleSSO)
 		props["Compliance"] = strconv.FormatBool(*l.Features.Compliance)
+		props["SAML"] = strconv.FormatBool(*l.Features.SAML)
 		props["CustomBrand"] = strconv.FormatBool(*l.Features.CustomBrand)
 		props["IssuedAt"] = strconv.FormatInt(l.IssuedAt, 10)
 		props["StartsAt"] = strconv.FormatInt(l.StartsAt, 10)
@@ -0,0 +1,641 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package utils
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+)
+
+// This is a small reader for PDF files. It only goes as far as finding the
+// pages of a document and decoding their content streams, which is all that
+// previews and search need. Encrypted documents aren't supported.
+
+type pdfName string
+type pdfKeyword string
+type pdfDict map[pdfName]interface{}
+
+type pdfRef struct {
+	num int
+	gen int
+}
+
+type pdfStream struct {
+	dict pdfDict
+	raw  []byte
+}
+
+type pdfPage struct {
+	dict      pdfDict
+	resources pdfDict
+	mediaBox  [4]float64
+}
+
+type pdfDocument struct {
+	objects map[int]interface{}
+}
+
+const (
+	// how far references and nested objects are followed before giving up
+	pdfMaxDepth = 32
+
+	// the most a single stream can decompress to, which is enough for the
+	// largest image that is drawn with 4 bytes for each pixel
+	pdfMaxStreamSize = pdfMaxImageSize * 4
+)
+
+var pdfObjectRegexp = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+
+var errPdfSyntax = errors.New("pdf: syntax error")
+
+// parsePdf finds every object in the file. Objects are found by scanning for
+// them rather than by reading the cross-reference table, which copes better
+// with damaged files and incremental updates.
+func parsePdf(data []byte) (*pdfDocument, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n"), []byte("%PDF-")) {
+		return nil, errors.New("pdf: not a pdf file")
+	}
+
+	doc := &pdfDocument{objects: make(map[int]interface{})}
+
+	skipUntil := 0
+	for _, match := range pdfObjectRegexp.FindAllSubmatchIndex(data, -1) {
+		if match[0] < skipUntil {
+			// this is part of a stream that happens to look like an object
+			continue
+		}
+
+		num, _ := strconv.Atoi(string(data[match[2]:match[3]]))
+
+		lexer := &pdfLexer{data: data, pos: match[1]}
+		obj, err := lexer.readObject(0)
+		if err != nil {
+			continue
+		}
+
+		if dict, ok := obj.(pdfDict); ok {
+			if stream := lexer.readStream(dict); stream != nil {
+				obj = stream
+				skipUntil = lexer.pos
+			}
+		}
+
+		doc.objects[num] = obj
+	}
+
+	// objects can also be packed together into compressed object streams
+	for _, obj := range doc.objects {
+		if stream, ok := obj.(*pdfStream); ok && stream.dict["Type"] == pdfName("ObjStm") {
+			doc.readObjectStream(stream)
+		}
+	}
+
+	if doc.catalog() == nil {
+		return nil, errors.New("pdf: no document catalog")
+	}
+
+	return doc, nil
+}
+
+func (doc *pdfDocument) readObjectStream(stream *pdfStream) {
+	data, _, err := doc.decodeStream(stream)
+	if err != nil {
+		return
+	}
+
+	count, _ := pdfNumber(doc.resolve(stream.dict["N"]))
+	first, _ := pdfNumber(doc.resolve(stream.dict["First"]))
+
+	header := &pdfLexer{data: data}
+	for i := 0; i < int(count); i++ {
+		num, ok1 := pdfNumber(header.readToken())
+		offset, ok2 := pdfNumber(header.readToken())
+		if !ok1 || !ok2 {
+			return
+		}
+
+		if _, ok := doc.objects[int(num)]; ok {
+			continue
+		}
+
+		lexer := &pdfLexer{data: data, pos: int(first) + int(offset)}
+		if lexer.pos < len(data) {
+			if obj, err := lexer.readObject(0); err == nil {
+				doc.objects[int(num)] = obj
+			}
+		}
+	}
+}
+
+// resolve follows obj if it's a reference to another object.
+func (doc *pdfDocument) resolve(obj interface{}) interface{} {
+	for i := 0; i < pdfMaxDepth; i++ {
+		if ref, ok := obj.(pdfRef); ok {
+			obj = doc.objects[ref.num]
+		} else {
+			return obj
+		}
+	}
+
+	return nil
+}
+
+func (doc *pdfDocument) resolveDict(obj interface{}) pdfDict {
+	switch v := doc.resolve(obj).(type) {
+	case pdfDict:
+		return v
+	case *pdfStream:
+		return v.dict
+	}
+
+	return nil
+}
+
+func (doc *pdfDocument) resolveArray(obj interface{}) []interface{} {
+	if array, ok := doc.resolve(obj).([]interface{}); ok {
+		return array
+	}
+
+	return nil
+}
+
+func (doc *pdfDocument) catalog() pdfDict {
+	for _, obj := range doc.objects {
+		if dict, ok := obj.(pdfDict); ok && dict["Type"] == pdfName("Catalog") {
+			return dict
+		}
+	}
+
+	return nil
+}
+
+// pages returns up to limit pages from the start of the document along with
+// the attributes that they inherit from the page tree.
+func (doc *pdfDocument) pages(limit int) []*pdfPage {
+	pages := []*pdfPage{}
+
+	var walk func(node pdfDict, resources pdfDict, mediaBox [4]float64, depth int)
+	walk = func(node pdfDict, resources pdfDict, mediaBox [4]float64, depth int) {
+		if node == nil || depth > pdfMaxDepth || len(pages) >= limit {
+			return
+		}
+
+		if r := doc.resolveDict(node["Resources"]); r != nil {
+			resources = r
+		}
+
+		if box := doc.resolveArray(node["MediaBox"]); len(box) == 4 {
+			for i := range box {
+				mediaBox[i], _ = pdfNumber(doc.resolve(box[i]))
+			}
+		}
+
+		if kids := doc.resolveArray(node["Kids"]); kids != nil {
+			for _, kid := range kids {
+				walk(doc.resolveDict(kid), resources, mediaBox, depth+1)
+			}
+		} else if node["Type"] == pdfName("Page") || node["Contents"] != nil {
+			pages = append(pages, &pdfPage{dict: node, resources: resources, mediaBox: mediaBox})
+		}
+	}
+
+	if catalog := doc.catalog(); catalog != nil {
+		// US Letter is the default when a document doesn't give a size
+		walk(doc.resolveDict(catalog["Pages"]), pdfDict{}, [4]float64{0, 0, 612, 792}, 0)
+	}
+
+	return pages
+}
+
+// contents joins together the content streams that draw a page.
+func (doc *pdfDocument) contents(page *pdfPage) []byte {
+	var streams []interface{}
+	if array := doc.resolveArray(page.dict["Contents"]); array != nil {
+		streams = array
+	} else {
+		streams = []interface{}{page.dict["Contents"]}
+	}
+
+	buf := &bytes.Buffer{}
+	for _, obj := range streams {
+		if stream, ok := doc.resolve(obj).(*pdfStream); ok {
+			if data, _, err := doc.decodeStream(stream); err == nil {
+				buf.Write(data)
+				buf.WriteByte('\n')
+			}
+		}
+	}
+
+	return buf.Bytes()
+}
+
+// decodeStream undoes the filters on a stream. Filters for image formats are
+// left for the caller to deal with and the first of them is returned.
+func (doc *pdfDocument) decodeStream(stream *pdfStream) ([]byte, pdfName, error) {
+	var filters []interface{}
+	if array := doc.resolveArray(stream.dict["Filter"]); array != nil {
+		filters = array
+	} else if filter := doc.resolve(stream.dict["Filter"]); filter != nil {
+		filters = []interface{}{filter}
+	}
+
+	data := stream.raw
+	for _, filter := range filters {
+		name, _ := doc.resolve(filter).(pdfName)
+
+		switch name {
+		case "FlateDecode", "Fl":
+			reader, err := zlib.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return nil, "", err
+			}
+
+			// damaged streams are common so keep whatever could be read
+			decoded, err := ioutil.ReadAll(io.LimitReader(reader, pdfMaxStreamSize+1))
+			if err != nil && len(decoded) == 0 {
+				return nil, "", err
+			} else if len(decoded) > pdfMaxStreamSize {
+				return nil, "", errors.New("pdf: stream is too large")
+			}
+			data = decoded
+		case "ASCIIHexDecode", "AHx":
+			data = pdfDecodeHex(data)
+		case "ASCII85Decode", "A85":
+			data = bytes.TrimPrefix(bytes.TrimSpace(data), []byte("<~"))
+			if end := bytes.Index(data, []byte("~>")); end != -1 {
+				data = data[:end]
+			}
+
+			decoded := make([]byte, len(data)*4/5+4)
+			n, _, err := ascii85.Decode(decoded, data, true)
+			if err != nil {
+				return nil, "", err
+			}
+			data = decoded[:n]
+		case "DCTDecode", "DCT", "JPXDecode", "CCITTFaxDecode", "CCF", "JBIG2Decode":
+			return data, name, nil
+		default:
+			return nil, "", errors.New("pdf: unsupported filter " + string(name))
+		}
+	}
+
+	return data, "", nil
+}
+
+func pdfNumber(obj interface{}) (float64, bool) {
+	n, ok := obj.(float64)
+	return n, ok
+}
+
+func pdfDecodeHex(data []byte) []byte {
+	digits := make([]byte, 0, len(data))
+	for _, c := range data {
+		if c == '>' {
+			break
+		} else if isPdfHexDigit(c) {
+			digits = append(digits, c)
+		}
+	}
+
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+
+	decoded := make([]byte, len(digits)/2)
+	hex.Decode(decoded, digits)
+	return decoded
+}
+
+func isPdfHexDigit(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func isPdfSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f' || c == 0
+}
+
+func isPdfDelimiter(c byte) bool {
+	return c == '(' || c == ')' || c == '<' || c == '>' || c == '[' || c == ']' || c == '{' || c == '}' || c == '/' || c == '%'
+}
+
+// pdfLexer reads the objects in a file or a content stream. Operators in
+// content streams come back as pdfKeywords.
+type pdfLexer struct {
+	data []byte
+	pos  int
+}
+
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.data) {
+		if c := l.data[l.pos]; isPdfSpace(c) {
+			l.pos++
+		} else if c == '%' {
+			for l.pos < len(l.data) && l.data[l.pos] != '\r' && l.data[l.pos] != '\n' {
+				l.pos++
+			}
+		} else {
+			return
+		}
+	}
+}
+
+// readToken reads the next number, string, name or keyword. Arrays and
+// dictionaries come back as the keywords that open and close them. It returns
+// nil at the end of the data.
+func (l *pdfLexer) readToken() interface{} {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil
+	}
+
+	switch c := l.data[l.pos]; c {
+	case '(':
+		return l.readLiteralString()
+	case '<':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '<' {
+			l.pos += 2
+			return pdfKeyword("<<")
+		}
+
+		start := l.pos + 1
+		for l.pos < len(l.data) && l.data[l.pos] != '>' {
+			l.pos++
+		}
+		l.pos++
+		return string(pdfDecodeHex(l.data[start:minInt(l.pos, len(l.data))]))
+	case '>':
+		l.pos++
+		if l.pos < len(l.data) && l.data[l.pos] == '>' {
+			l.pos++
+			return pdfKeyword(">>")
+		}
+		return pdfKeyword(">")
+	case '[', ']', '{', '}', ')':
+		l.pos++
+		return pdfKeyword(string(c))
+	case '/':
+		l.pos++
+		return pdfName(l.readName())
+	}
+
+	start := l.pos
+	for l.pos < len(l.data) && !isPdfSpace(l.data[l.pos]) && !isPdfDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	word := string(l.data[start:l.pos])
+
+	if c := word[0]; c == '+' || c == '-' || c == '.' || '0' <= c && c <= '9' {
+		if n, err := strconv.ParseFloat(word, 64); err == nil {
+			return n
+		}
+	}
+
+	switch word {
+	case "true":
+		return true
+	case "false":
+		return false
+	case "null":
+		return pdfKeyword("null")
+	}
+
+	return pdfKeyword(word)
+}
+
+func (l *pdfLexer) readName() string {
+	buf := []byte{}
+	for l.pos < len(l.data) && !isPdfSpace(l.data[l.pos]) && !isPdfDelimiter(l.data[l.pos]) {
+		if c := l.data[l.pos]; c == '#' && l.pos+2 < len(l.data) && isPdfHexDigit(l.data[l.pos+1]) && isPdfHexDigit(l.data[l.pos+2]) {
+			n, _ := strconv.ParseUint(string(l.data[l.pos+1:l.pos+3]), 16, 8)
+			buf = append(buf, byte(n))
+			l.pos += 3
+		} else {
+			buf = append(buf, c)
+			l.pos++
+		}
+	}
+
+	return string(buf)
+}
+
+func (l *pdfLexer) readLiteralString() string {
+	buf := []byte{}
+	depth := 0
+
+	for l.pos++; l.pos < len(l.data); l.pos++ {
+		c := l.data[l.pos]
+
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				l.pos++
+				return string(buf)
+			}
+			depth--
+		case '\\':
+			l.pos++
+			if l.pos >= len(l.data) {
+				return string(buf)
+			}
+
+			switch c = l.data[l.pos]; c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				// a backslash at the end of a line continues the string on the next one
+				if l.pos+1 < len(l.data) && l.data[l.pos+1] == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if '0' <= c && c <= '7' {
+					n := 0
+					for i := 0; i < 3 && l.pos < len(l.data) && '0' <= l.data[l.pos] && l.data[l.pos] <= '7'; i++ {
+						n = n*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					l.pos--
+					c = byte(n)
+				}
+			}
+		}
+
+		buf = append(buf, c)
+	}
+
+	return string(buf)
+}
+
+// readObject reads a whole object, including any arrays and dictionaries that
+// it contains.
+func (l *pdfLexer) readObject(depth int) (interface{}, error) {
+	if depth > pdfMaxDepth {
+		return nil, errPdfSyntax
+	}
+
+	token := l.readToken()
+
+	switch token {
+	case nil:
+		return nil, errPdfSyntax
+	case pdfKeyword("null"):
+		return nil, nil
+	case pdfKeyword("["):
+		array := []interface{}{}
+		for {
+			save := l.pos
+			if l.readToken() == pdfKeyword("]") {
+				return array, nil
+			}
+			l.pos = save
+
+			obj, err := l.readObject(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, obj)
+		}
+	case pdfKeyword("<<"):
+		dict := pdfDict{}
+		for {
+			key := l.readToken()
+			if key == pdfKeyword(">>") {
+				return dict, nil
+			}
+
+			name, ok := key.(pdfName)
+			if !ok {
+				return nil, errPdfSyntax
+			}
+
+			obj, err := l.readObject(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			dict[name] = obj
+		}
+	}
+
+	// an integer may be the start of a reference like "12 0 R"
+	if n, ok := token.(float64); ok && n == float64(int(n)) && n >= 0 {
+		save := l.pos
+		if gen, ok := l.readToken().(float64); ok && l.readToken() == pdfKeyword("R") {
+			return pdfRef{num: int(n), gen: int(gen)}, nil
+		}
+		l.pos = save
+	}
+
+	if keyword, ok := token.(pdfKeyword); ok && (keyword == "]" || keyword == ">>" || keyword == ")") {
+		return nil, errPdfSyntax
+	}
+
+	return token, nil
+}
+
+// readStream reads the data of a stream if one follows the dictionary that was
+// just read.
+func (l *pdfLexer) readStream(dict pdfDict) *pdfStream {
+	save := l.pos
+	if l.readToken() != pdfKeyword("stream") {
+		l.pos = save
+		return nil
+	}
+
+	if l.pos < len(l.data) && l.data[l.pos] == '\r' {
+		l.pos++
+	}
+	if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+		l.pos++
+	}
+	start := l.pos
+
+	// the length is only trusted if it's direct and endstream comes right after
+	if length, ok := dict["Length"].(float64); ok && start+int(length) <= len(l.data) {
+		end := start + int(length)
+		rest := bytes.TrimLeft(l.data[end:minInt(end+32, len(l.data))], " \t\r\n")
+		if bytes.HasPrefix(rest, []byte("endstream")) {
+			l.pos = end
+			return &pdfStream{dict: dict, raw: l.data[start:end]}
+		}
+	}
+
+	end := bytes.Index(l.data[start:], []byte("endstream"))
+	if end == -1 {
+		l.pos = len(l.data)
+		return &pdfStream{dict: dict, raw: l.data[start:]}
+	}
+
+	l.pos = start + end
+	raw := bytes.TrimSuffix(l.data[start:start+end], []byte("\n"))
+	raw = bytes.TrimSuffix(raw, []byte("\r"))
+	return &pdfStream{dict: dict, raw: raw}
+}
+
+// eachPdfOperation calls fn with each operator in a content stream and the
+// operands that came before it. Inline images are skipped over.
+func eachPdfOperation(content []byte, fn func(op string, operands []interface{})) {
+	lexer := &pdfLexer{data: content}
+	operands := []interface{}{}
+
+	for {
+		save := lexer.pos
+		token := lexer.readToken()
+		if token == nil {
+			return
+		}
+
+		keyword, isKeyword := token.(pdfKeyword)
+		if !isKeyword || keyword == "[" || keyword == "<<" {
+			lexer.pos = save
+			if obj, err := lexer.readObject(0); err != nil {
+				// skip past whatever couldn't be read
+				lexer.pos = save + 1
+				operands = operands[:0]
+			} else {
+				operands = append(operands, obj)
+			}
+			continue
+		}
+
+		if keyword == "BI" {
+			if end := pdfInlineImageEnd.FindIndex(content[lexer.pos:]); end != nil {
+				lexer.pos += end[1]
+			} else {
+				return
+			}
+		} else {
+			fn(string(keyword), operands)
+		}
+
+		operands = operands[:0]
+	}
+}
+
+var pdfInlineImageEnd = regexp.MustCompile(`\sEI(\s|$)`)
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package utils
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/mattermost/platform/model"
+)
+
+// PreviewGenerator draws a picture of a file that the thumbnail and preview
+// shown in place of the file are made from.
+type PreviewGenerator interface {
+	GeneratePreview(data []byte) (image.Image, *model.AppError)
+}
+
+var previewGenerators = map[string]PreviewGenerator{}
+var previewGeneratorsLock sync.RWMutex
+
+// RegisterPreviewGenerator sets the generator used for files with the given
+// extension, replacing the one that was there before.
+func RegisterPreviewGenerator(extension string, generator PreviewGenerator) {
+	previewGeneratorsLock.Lock()
+	defer previewGeneratorsLock.Unlock()
+
+	previewGenerators[strings.ToLower(extension)] = generator
+}
+
+// GetPreviewGenerator gets the generator for a file based on its extension. It
+// returns nil if there isn't one.
+func GetPreviewGenerator(filename string) PreviewGenerator {
+	previewGeneratorsLock.RLock()
+	defer previewGeneratorsLock.RUnlock()
+
+	return previewGenerators[strings.ToLower(filepath.Ext(filename))]
+}
+
+func init() {
+	RegisterPreviewGenerator(".gif", GifPreviewGenerator{})
+	RegisterPreviewGenerator(".pdf", PdfPreviewGenerator{})
+
+	for _, extension := range TEXT_PREVIEW_EXTENSIONS {
+		RegisterPreviewGenerator(extension, TextPreviewGenerator{})
+	}
+
+	for extension, language := range codeLanguages {
+		RegisterPreviewGenerator(extension, TextPreviewGenerator{language: language})
+	}
+}
+
+// GifPreviewGenerator draws the first frame of a gif. Frames can be smaller
+// than the gif itself so it's drawn onto a background the size of the whole gif.
+type GifPreviewGenerator struct{}
+
+func (g GifPreviewGenerator) GeneratePreview(data []byte) (image.Image, *model.AppError) {
+	gifImage, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil || len(gifImage.Image) == 0 {
+		return nil, model.NewLocAppError("GifPreviewGenerator.GeneratePreview", "utils.preview.gif.decode.app_error", nil, errorString(err))
+	}
+
+	bounds := image.Rect(0, 0, gifImage.Config.Width, gifImage.Config.Height)
+	if bounds.Empty() {
+		bounds = gifImage.Image[0].Bounds()
+	}
+
+	img := image.NewRGBA(bounds)
+	draw.Draw(img, bounds, image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(img, gifImage.Image[0].Bounds(), gifImage.Image[0], gifImage.Image[0].Bounds().Min, draw.Over)
+
+	return img, nil
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	return err.Error()
+}
@@ -0,0 +1,797 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"io/ioutil"
+	"math"
+	"sync"
+
+	"github.com/disintegration/imaging"
+	"github.com/golang/freetype"
+	"github.com/golang/freetype/raster"
+	"github.com/golang/freetype/truetype"
+	"github.com/mattermost/platform/model"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	// the width that the first page is drawn at, which is about the size of the
+	// largest preview
+	PDF_PREVIEW_WIDTH = 1024
+
+	// forms can draw other forms so this stops a document that loops forever
+	pdfMaxFormDepth = 8
+
+	// the most pixels an image in the document can have, which matches the
+	// limit on uploaded images
+	pdfMaxImageSize = 6048 * 4032
+)
+
+// PdfPreviewGenerator draws the first page of a pdf. Only the common parts of
+// pdf are drawn: paths, images and text, which is drawn in a standard font
+// instead of the one the document uses. Clipping, patterns, shadings and
+// transparency are ignored.
+type PdfPreviewGenerator struct{}
+
+func (g PdfPreviewGenerator) GeneratePreview(data []byte) (img image.Image, appErr *model.AppError) {
+	// malformed files shouldn't take the server down with them
+	defer func() {
+		if r := recover(); r != nil {
+			img = nil
+			appErr = model.NewLocAppError("PdfPreviewGenerator.GeneratePreview", "utils.preview.pdf.draw.app_error", nil, fmt.Sprint(r))
+		}
+	}()
+
+	doc, err := parsePdf(data)
+	if err != nil {
+		return nil, model.NewLocAppError("PdfPreviewGenerator.GeneratePreview", "utils.preview.pdf.parse.app_error", nil, err.Error())
+	}
+
+	pages := doc.pages(1)
+	if len(pages) == 0 {
+		return nil, model.NewLocAppError("PdfPreviewGenerator.GeneratePreview", "utils.preview.pdf.no_pages.app_error", nil, "")
+	}
+
+	renderer := newPdfRenderer(doc, pages[0])
+	renderer.draw(doc.contents(pages[0]), pages[0].resources, 0)
+
+	return renderer.img, nil
+}
+
+type pdfMatrix [6]float64
+
+var pdfIdentity = pdfMatrix{1, 0, 0, 1, 0, 0}
+
+// multiply returns the matrix that applies m and then n.
+func (m pdfMatrix) multiply(n pdfMatrix) pdfMatrix {
+	return pdfMatrix{
+		m[0]*n[0] + m[1]*n[2],
+		m[0]*n[1] + m[1]*n[3],
+		m[2]*n[0] + m[3]*n[2],
+		m[2]*n[1] + m[3]*n[3],
+		m[4]*n[0] + m[5]*n[2] + n[4],
+		m[4]*n[1] + m[5]*n[3] + n[5],
+	}
+}
+
+func (m pdfMatrix) apply(x, y float64) (float64, float64) {
+	return x*m[0] + y*m[2] + m[4], x*m[1] + y*m[3] + m[5]
+}
+
+// scale is roughly how much longer lines get when drawn through m.
+func (m pdfMatrix) scale() float64 {
+	return math.Sqrt(math.Abs(m[0]*m[3] - m[1]*m[2]))
+}
+
+type pdfGraphicsState struct {
+	ctm         pdfMatrix
+	fillColor   color.Color
+	strokeColor color.Color
+	lineWidth   float64
+
+	font        pdfDict
+	fontSize    float64
+	charSpacing float64
+	wordSpacing float64
+	hScale      float64
+	leading     float64
+	rise        float64
+	renderMode  int
+}
+
+type pdfSegment struct {
+	points []fixed.Point26_6
+}
+
+type pdfSubpath struct {
+	start    fixed.Point26_6
+	segments []pdfSegment
+	closed   bool
+}
+
+type pdfRenderer struct {
+	doc   *pdfDocument
+	img   *image.RGBA
+	state pdfGraphicsState
+	stack []pdfGraphicsState
+
+	path    []*pdfSubpath
+	current fixed.Point26_6
+
+	textMatrix     pdfMatrix
+	textLineMatrix pdfMatrix
+
+	rasterizer *raster.Rasterizer
+	painter    *raster.RGBAPainter
+
+	font  *truetype.Font
+	faces map[int]font.Face
+}
+
+func newPdfRenderer(doc *pdfDocument, page *pdfPage) *pdfRenderer {
+	box := page.mediaBox
+	boxWidth := math.Abs(box[2] - box[0])
+	boxHeight := math.Abs(box[3] - box[1])
+	if boxWidth < 1 || boxHeight < 1 {
+		boxWidth, boxHeight = 612, 792
+	}
+
+	scale := PDF_PREVIEW_WIDTH / boxWidth
+	width := PDF_PREVIEW_WIDTH
+	height := int(math.Min(boxHeight*scale, PDF_PREVIEW_WIDTH*4))
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+
+	r := &pdfRenderer{
+		doc:        doc,
+		img:        img,
+		rasterizer: raster.NewRasterizer(width, height),
+		painter:    raster.NewRGBAPainter(img),
+		font:       loadPdfFont(),
+		faces:      map[int]font.Face{},
+	}
+
+	// pdf measures up from the bottom of the page while images go down from the top
+	r.state = pdfGraphicsState{
+		ctm:         pdfMatrix{scale, 0, 0, -scale, -math.Min(box[0], box[2]) * scale, math.Max(box[1], box[3]) * scale},
+		fillColor:   color.Black,
+		strokeColor: color.Black,
+		lineWidth:   1,
+		hScale:      1,
+	}
+
+	return r
+}
+
+func (r *pdfRenderer) draw(content []byte, resources pdfDict, depth int) {
+	eachPdfOperation(content, func(op string, operands []interface{}) {
+		r.do(op, operands, resources, depth)
+	})
+}
+
+func (r *pdfRenderer) numbers(operands []interface{}) []float64 {
+	numbers := make([]float64, 0, len(operands))
+	for _, operand := range operands {
+		if n, ok := operand.(float64); ok {
+			numbers = append(numbers, n)
+		}
+	}
+
+	return numbers
+}
+
+func (r *pdfRenderer) point(x, y float64) fixed.Point26_6 {
+	x, y = r.state.ctm.apply(x, y)
+	return fixed.Point26_6{X: fixed.Int26_6(x * 64), Y: fixed.Int26_6(y * 64)}
+}
+
+func (r *pdfRenderer) do(op string, operands []interface{}, resources pdfDict, depth int) {
+	n := r.numbers(operands)
+
+	switch op {
+	// graphics state
+	case "q":
+		r.stack = append(r.stack, r.state)
+	case "Q":
+		if len(r.stack) > 0 {
+			r.state = r.stack[len(r.stack)-1]
+			r.stack = r.stack[:len(r.stack)-1]
+		}
+	case "cm":
+		if len(n) == 6 {
+			r.state.ctm = pdfMatrix{n[0], n[1], n[2], n[3], n[4], n[5]}.multiply(r.state.ctm)
+		}
+	case "w":
+		if len(n) == 1 {
+			r.state.lineWidth = n[0]
+		}
+
+	// colours
+	case "g", "rg", "k", "sc", "scn":
+		if c := pdfColor(n); c != nil {
+			r.state.fillColor = c
+		}
+	case "G", "RG", "K", "SC", "SCN":
+		if c := pdfColor(n); c != nil {
+			r.state.strokeColor = c
+		}
+	case "cs":
+		r.state.fillColor = color.Black
+	case "CS":
+		r.state.strokeColor = color.Black
+
+	// paths
+	case "m":
+		if len(n) == 2 {
+			r.current = r.point(n[0], n[1])
+			r.path = append(r.path, &pdfSubpath{start: r.current})
+		}
+	case "l":
+		if len(n) == 2 {
+			r.addSegment(r.point(n[0], n[1]))
+		}
+	case "c":
+		if len(n) == 6 {
+			r.addSegment(r.point(n[0], n[1]), r.point(n[2], n[3]), r.point(n[4], n[5]))
+		}
+	case "v":
+		if len(n) == 4 {
+			r.addSegment(r.current, r.point(n[0], n[1]), r.point(n[2], n[3]))
+		}
+	case "y":
+		if len(n) == 4 {
+			end := r.point(n[2], n[3])
+			r.addSegment(r.point(n[0], n[1]), end, end)
+		}
+	case "h":
+		if len(r.path) > 0 {
+			subpath := r.path[len(r.path)-1]
+			subpath.closed = true
+			r.current = subpath.start
+		}
+	case "re":
+		if len(n) == 4 {
+			r.current = r.point(n[0], n[1])
+			r.path = append(r.path, &pdfSubpath{start: r.current})
+			r.addSegment(r.point(n[0]+n[2], n[1]))
+			r.addSegment(r.point(n[0]+n[2], n[1]+n[3]))
+			r.addSegment(r.point(n[0], n[1]+n[3]))
+			r.path[len(r.path)-1].closed = true
+		}
+
+	// painting
+	case "f", "F", "f*":
+		r.fill(op == "f*")
+		r.path = nil
+	case "S":
+		r.stroke()
+		r.path = nil
+	case "s":
+		r.do("h", nil, resources, depth)
+		r.stroke()
+		r.path = nil
+	case "B", "B*":
+		r.fill(op == "B*")
+		r.stroke()
+		r.path = nil
+	case "b", "b*":
+		r.do("h", nil, resources, depth)
+		r.fill(op == "b*")
+		r.stroke()
+		r.path = nil
+	case "n":
+		r.path = nil
+
+	// text
+	case "BT":
+		r.textMatrix = pdfIdentity
+		r.textLineMatrix = pdfIdentity
+	case "Tf":
+		if len(operands) == 2 && len(n) == 1 {
+			if name, ok := operands[0].(pdfName); ok {
+				r.state.font = r.doc.resolveDict(r.doc.resolveDict(resources["Font"])[name])
+			}
+			r.state.fontSize = n[0]
+		}
+	case "Tc":
+		if len(n) == 1 {
+			r.state.charSpacing = n[0]
+		}
+	case "Tw":
+		if len(n) == 1 {
+			r.state.wordSpacing = n[0]
+		}
+	case "Tz":
+		if len(n) == 1 {
+			r.state.hScale = n[0] / 100
+		}
+	case "TL":
+		if len(n) == 1 {
+			r.state.leading = n[0]
+		}
+	case "Ts":
+		if len(n) == 1 {
+			r.state.rise = n[0]
+		}
+	case "Tr":
+		if len(n) == 1 {
+			r.state.renderMode = int(n[0])
+		}
+	case "Td":
+		if len(n) == 2 {
+			r.moveText(n[0], n[1])
+		}
+	case "TD":
+		if len(n) == 2 {
+			r.state.leading = -n[1]
+			r.moveText(n[0], n[1])
+		}
+	case "Tm":
+		if len(n) == 6 {
+			r.textMatrix = pdfMatrix{n[0], n[1], n[2], n[3], n[4], n[5]}
+			r.textLineMatrix = r.textMatrix
+		}
+	case "T*":
+		r.moveText(0, -r.state.leading)
+	case "Tj":
+		if len(operands) == 1 {
+			if s, ok := operands[0].(string); ok {
+				r.showText(s)
+			}
+		}
+	case "'":
+		r.moveText(0, -r.state.leading)
+		if len(operands) == 1 {
+			if s, ok := operands[0].(string); ok {
+				r.showText(s)
+			}
+		}
+	case "\"":
+		if len(operands) == 3 {
+			r.state.wordSpacing, _ = pdfNumber(operands[0])
+			r.state.charSpacing, _ = pdfNumber(operands[1])
+			r.moveText(0, -r.state.leading)
+			if s, ok := operands[2].(string); ok {
+				r.showText(s)
+			}
+		}
+	case "TJ":
+		if len(operands) == 1 {
+			if array, ok := operands[0].([]interface{}); ok {
+				for _, item := range array {
+					switch v := item.(type) {
+					case string:
+						r.showText(v)
+					case float64:
+						// numbers move the next glyphs back by thousandths of the font size
+						r.textMatrix = pdfMatrix{1, 0, 0, 1, -v / 1000 * r.state.fontSize * r.state.hScale, 0}.multiply(r.textMatrix)
+					}
+				}
+			}
+		}
+
+	// images and forms
+	case "Do":
+		if len(operands) == 1 {
+			if name, ok := operands[0].(pdfName); ok {
+				if stream, ok := r.doc.resolve(r.doc.resolveDict(resources["XObject"])[name]).(*pdfStream); ok {
+					r.drawXObject(stream, resources, depth)
+				}
+			}
+		}
+	}
+}
+
+func (r *pdfRenderer) addSegment(points ...fixed.Point26_6) {
+	if len(r.path) == 0 {
+		r.path = append(r.path, &pdfSubpath{start: r.current})
+	}
+
+	subpath := r.path[len(r.path)-1]
+	subpath.segments = append(subpath.segments, pdfSegment{points: points})
+	r.current = points[len(points)-1]
+}
+
+// rasterPath converts the current path for the rasterizer. Filled shapes are
+// always closed.
+func (r *pdfRenderer) rasterPath(closeAll bool) raster.Path {
+	var path raster.Path
+
+	for _, subpath := range r.path {
+		if len(subpath.segments) == 0 {
+			continue
+		}
+
+		path.Start(subpath.start)
+		for _, segment := range subpath.segments {
+			switch len(segment.points) {
+			case 1:
+				path.Add1(segment.points[0])
+			case 3:
+				path.Add3(segment.points[0], segment.points[1], segment.points[2])
+			}
+		}
+
+		if closeAll || subpath.closed {
+			path.Add1(subpath.start)
+		}
+	}
+
+	return path
+}
+
+func (r *pdfRenderer) paint(c color.Color) {
+	r.painter.SetColor(c)
+	r.rasterizer.Rasterize(r.painter)
+	r.rasterizer.Clear()
+}
+
+func (r *pdfRenderer) fill(evenOdd bool) {
+	path := r.rasterPath(true)
+	if len(path) == 0 {
+		return
+	}
+
+	r.rasterizer.UseNonZeroWinding = !evenOdd
+	r.rasterizer.AddPath(path)
+	r.paint(r.state.fillColor)
+}
+
+func (r *pdfRenderer) stroke() {
+	path := r.rasterPath(false)
+	if len(path) == 0 {
+		return
+	}
+
+	// a width of zero means the thinnest line that can be drawn
+	width := math.Max(r.state.lineWidth*r.state.ctm.scale(), 1)
+
+	r.rasterizer.UseNonZeroWinding = true
+	r.rasterizer.AddStroke(path, fixed.Int26_6(width*64), raster.ButtCapper, raster.BevelJoiner)
+	r.paint(r.state.strokeColor)
+}
+
+func (r *pdfRenderer) moveText(x, y float64) {
+	r.textLineMatrix = pdfMatrix{1, 0, 0, 1, x, y}.multiply(r.textLineMatrix)
+	r.textMatrix = r.textLineMatrix
+}
+
+// showText draws a string of glyphs and moves past them. Composite fonts use
+// two bytes for each glyph and can't be mapped back to characters without
+// reading the font, so their glyphs are drawn as grey blocks instead.
+func (r *pdfRenderer) showText(s string) {
+	font := r.state.font
+	composite := font["Subtype"] == pdfName("Type0")
+
+	firstChar, _ := pdfNumber(r.doc.resolve(font["FirstChar"]))
+	widths := r.doc.resolveArray(font["Widths"])
+
+	codeSize := 1
+	if composite {
+		codeSize = 2
+	}
+
+	for i := 0; i+codeSize <= len(s); i += codeSize {
+		code := int(s[i])
+		if composite {
+			code = code<<8 | int(s[i+1])
+		}
+
+		// widths are in thousandths of the font size
+		width := 0.5
+		if index := code - int(firstChar); index >= 0 && index < len(widths) {
+			if w, ok := pdfNumber(r.doc.resolve(widths[index])); ok && w > 0 {
+				width = w / 1000
+			}
+		} else if composite {
+			width = 1
+		}
+
+		if r.state.renderMode != 3 && r.state.renderMode != 7 {
+			if composite || code < 32 {
+				r.drawGlyphBlock(width)
+			} else {
+				r.drawGlyph(rune(code))
+			}
+		}
+
+		advance := width*r.state.fontSize + r.state.charSpacing
+		if code == ' ' && !composite {
+			advance += r.state.wordSpacing
+		}
+		r.textMatrix = pdfMatrix{1, 0, 0, 1, advance * r.state.hScale, 0}.multiply(r.textMatrix)
+	}
+}
+
+func (r *pdfRenderer) textRenderingMatrix() pdfMatrix {
+	return pdfMatrix{r.state.fontSize * r.state.hScale, 0, 0, r.state.fontSize, 0, r.state.rise}.multiply(r.textMatrix).multiply(r.state.ctm)
+}
+
+func (r *pdfRenderer) drawGlyph(ch rune) {
+	trm := r.textRenderingMatrix()
+	size := trm.scale()
+	x, y := trm.apply(0, 0)
+
+	if size < 4 {
+		// too small to read anyway
+		r.drawGlyphBlock(0.5)
+		return
+	}
+
+	face := r.fontFace(size)
+	if face == nil {
+		r.drawGlyphBlock(0.5)
+		return
+	}
+
+	drawer := &font.Drawer{
+		Dst:  r.img,
+		Src:  image.NewUniform(r.state.fillColor),
+		Face: face,
+		Dot:  fixed.Point26_6{X: fixed.Int26_6(x * 64), Y: fixed.Int26_6(y * 64)},
+	}
+	drawer.DrawString(string(ch))
+}
+
+// drawGlyphBlock draws a block where a glyph would go, the way layouts are
+// often sketched out with greeked text.
+func (r *pdfRenderer) drawGlyphBlock(width float64) {
+	trm := r.textRenderingMatrix()
+
+	var path raster.Path
+	start := pdfFixedPoint(trm.apply(0.05, 0))
+	path.Start(start)
+	path.Add1(pdfFixedPoint(trm.apply(width-0.05, 0)))
+	path.Add1(pdfFixedPoint(trm.apply(width-0.05, 0.5)))
+	path.Add1(pdfFixedPoint(trm.apply(0.05, 0.5)))
+	path.Add1(start)
+
+	r.rasterizer.UseNonZeroWinding = true
+	r.rasterizer.AddPath(path)
+	r.paint(color.RGBA{180, 180, 180, 255})
+}
+
+func pdfFixedPoint(x, y float64) fixed.Point26_6 {
+	return fixed.Point26_6{X: fixed.Int26_6(x * 64), Y: fixed.Int26_6(y * 64)}
+}
+
+func (r *pdfRenderer) drawXObject(stream *pdfStream, resources pdfDict, depth int) {
+	switch stream.dict["Subtype"] {
+	case pdfName("Image"):
+		if img := r.doc.decodeImage(stream); img != nil {
+			r.drawImage(img)
+		}
+	case pdfName("Form"):
+		if depth >= pdfMaxFormDepth {
+			return
+		}
+
+		data, _, err := r.doc.decodeStream(stream)
+		if err != nil {
+			return
+		}
+
+		saved := r.state
+		savedStack := len(r.stack)
+
+		if matrix := r.doc.resolveArray(stream.dict["Matrix"]); len(matrix) == 6 {
+			if n := r.numbers(matrix); len(n) == 6 {
+				r.state.ctm = pdfMatrix{n[0], n[1], n[2], n[3], n[4], n[5]}.multiply(r.state.ctm)
+			}
+		}
+
+		formResources := resources
+		if dict := r.doc.resolveDict(stream.dict["Resources"]); dict != nil {
+			formResources = dict
+		}
+
+		r.draw(data, formResources, depth+1)
+
+		r.state = saved
+		r.stack = r.stack[:minInt(savedStack, len(r.stack))]
+	}
+}
+
+// drawImage draws an image into the unit square of the current matrix. Images
+// that have been rotated or skewed are drawn into the box around them.
+func (r *pdfRenderer) drawImage(img image.Image) {
+	ctm := r.state.ctm
+	x0, y0 := ctm.apply(0, 1)
+	x1, y1 := ctm.apply(1, 0)
+
+	bounds := image.Rect(int(math.Min(x0, x1)), int(math.Min(y0, y1)), int(math.Ceil(math.Max(x0, x1))), int(math.Ceil(math.Max(y0, y1))))
+	if bounds.Dx() < 1 || bounds.Dy() < 1 || !bounds.Overlaps(r.img.Bounds()) {
+		return
+	}
+
+	// don't scale anything up past what could be seen on the page
+	if bounds.Dx() > r.img.Bounds().Dx()*4 || bounds.Dy() > r.img.Bounds().Dy()*4 {
+		return
+	}
+
+	var scaled image.Image = imaging.Resize(img, bounds.Dx(), bounds.Dy(), imaging.Linear)
+	if x0 > x1 {
+		scaled = imaging.FlipH(scaled)
+	}
+	if y0 > y1 {
+		// the top of the image ended up at the bottom of the page
+		scaled = imaging.FlipV(scaled)
+	}
+
+	draw.Draw(r.img, bounds, scaled, image.Point{}, draw.Over)
+}
+
+// decodeImage reads an image XObject. Jpegs and images with 8 bits for each
+// colour component are supported.
+func (doc *pdfDocument) decodeImage(stream *pdfStream) image.Image {
+	data, imageFilter, err := doc.decodeStream(stream)
+	if err != nil {
+		return nil
+	}
+
+	if imageFilter == "DCTDecode" || imageFilter == "DCT" {
+		// check the size first since decoding allocates the whole image
+		if config, err := jpeg.DecodeConfig(bytes.NewReader(data)); err != nil || config.Width*config.Height > pdfMaxImageSize {
+			return nil
+		}
+
+		if img, err := jpeg.Decode(bytes.NewReader(data)); err == nil {
+			return img
+		}
+		return nil
+	} else if imageFilter != "" {
+		return nil
+	}
+
+	if mask, _ := doc.resolve(stream.dict["ImageMask"]).(bool); mask {
+		return nil
+	}
+
+	width, _ := pdfNumber(doc.resolve(stream.dict["Width"]))
+	height, _ := pdfNumber(doc.resolve(stream.dict["Height"]))
+	bits, _ := pdfNumber(doc.resolve(stream.dict["BitsPerComponent"]))
+	if width < 1 || height < 1 || bits != 8 || width*height > pdfMaxImageSize {
+		return nil
+	}
+
+	components, lookup := doc.colorSpace(doc.resolve(stream.dict["ColorSpace"]))
+	if components == 0 || len(data) < int(width*height)*components {
+		return nil
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, int(width), int(height)))
+	for y := 0; y < int(height); y++ {
+		for x := 0; x < int(width); x++ {
+			i := (y*int(width) + x) * components
+
+			if lookup != nil {
+				j := int(data[i]) * 3
+				if j+2 < len(lookup) {
+					img.Set(x, y, color.RGBA{lookup[j], lookup[j+1], lookup[j+2], 255})
+				}
+				continue
+			}
+
+			values := make([]float64, components)
+			for k := range values {
+				values[k] = float64(data[i+k]) / 255
+			}
+			img.Set(x, y, pdfColor(values))
+		}
+	}
+
+	return img
+}
+
+// colorSpace returns the number of components in each pixel and, for indexed
+// colours, the table of rgb values that the pixels index.
+func (doc *pdfDocument) colorSpace(space interface{}) (int, []byte) {
+	switch v := space.(type) {
+	case pdfName:
+		switch v {
+		case "DeviceGray", "G", "CalGray":
+			return 1, nil
+		case "DeviceRGB", "RGB", "CalRGB":
+			return 3, nil
+		case "DeviceCMYK", "CMYK":
+			return 4, nil
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			return 0, nil
+		}
+
+		switch doc.resolve(v[0]) {
+		case pdfName("ICCBased"):
+			if len(v) > 1 {
+				if n, ok := pdfNumber(doc.resolve(doc.resolveDict(v[1])["N"])); ok {
+					return int(n), nil
+				}
+			}
+		case pdfName("Indexed"), pdfName("I"):
+			if len(v) < 4 {
+				return 0, nil
+			}
+
+			if base, _ := doc.colorSpace(doc.resolve(v[1])); base != 3 {
+				return 0, nil
+			}
+
+			switch lookup := doc.resolve(v[3]).(type) {
+			case string:
+				return 1, []byte(lookup)
+			case *pdfStream:
+				if data, _, err := doc.decodeStream(lookup); err == nil {
+					return 1, data
+				}
+			}
+		}
+	}
+
+	return 0, nil
+}
+
+// pdfColor makes a gray, rgb or cmyk colour from its components, which range
+// from 0 to 1.
+func pdfColor(n []float64) color.Color {
+	c := func(v float64) uint8 {
+		return uint8(math.Max(0, math.Min(1, v)) * 255)
+	}
+
+	switch len(n) {
+	case 1:
+		return color.RGBA{c(n[0]), c(n[0]), c(n[0]), 255}
+	case 3:
+		return color.RGBA{c(n[0]), c(n[1]), c(n[2]), 255}
+	case 4:
+		k := 1 - n[3]
+		return color.RGBA{c((1 - n[0]) * k), c((1 - n[1]) * k), c((1 - n[2]) * k), 255}
+	}
+
+	return nil
+}
+
+var pdfFont *truetype.Font
+var pdfFontLock sync.Mutex
+
+// loadPdfFont reads the font that text is drawn in, which is the one used to
+// make profile pictures.
+func loadPdfFont() *truetype.Font {
+	pdfFontLock.Lock()
+	defer pdfFontLock.Unlock()
+
+	if pdfFont == nil {
+		if fontBytes, err := ioutil.ReadFile(FindDir("fonts") + Cfg.FileSettings.InitialFont); err == nil {
+			pdfFont, _ = freetype.ParseFont(fontBytes)
+		}
+	}
+
+	return pdfFont
+}
+
+// fontFace gets the font at a size in pixels. Faces cache the glyphs that they
+// draw so each renderer keeps its own.
+func (r *pdfRenderer) fontFace(size float64) font.Face {
+	if r.font == nil {
+		return nil
+	}
+
+	key := int(math.Min(size, 256) + 0.5)
+	if face, ok := r.faces[key]; ok {
+		return face
+	}
+
+	face := truetype.NewFace(r.font, &truetype.Options{Size: float64(key), DPI: 72})
+	r.faces[key] = face
+	return face
+}
@@ -0,0 +1,231 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package utils
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"testing"
+)
+
+// makeTestPdf builds a one page pdf that's 200 by 100 points and draws content.
+func makeTestPdf(content string, compress bool) []byte {
+	stream := []byte(content)
+	filter := ""
+	if compress {
+		buf := &bytes.Buffer{}
+		w := zlib.NewWriter(buf)
+		w.Write(stream)
+		w.Close()
+		stream = buf.Bytes()
+		filter = " /Filter /FlateDecode"
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteString("%PDF-1.4\n")
+	buf.WriteString("1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n")
+	buf.WriteString("2 0 obj\n<< /Type /Pages /Kids [3 0 R] /Count 1 /MediaBox [0 0 200 100] >>\nendobj\n")
+	buf.WriteString("3 0 obj\n<< /Type /Page /Parent 2 0 R /Resources << /Font << /F1 5 0 R >> >> /Contents 4 0 R >>\nendobj\n")
+	buf.WriteString(fmt.Sprintf("4 0 obj\n<< /Length %v%v >>\nstream\n", len(stream), filter))
+	buf.Write(stream)
+	buf.WriteString("\nendstream\nendobj\n")
+	buf.WriteString("5 0 obj\n<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>\nendobj\n")
+	buf.WriteString("trailer\n<< /Root 1 0 R >>\n%%EOF\n")
+
+	return buf.Bytes()
+}
+
+func isRed(c color.Color) bool {
+	r, g, b, _ := c.RGBA()
+	return r > 0xf000 && g < 0x1000 && b < 0x1000
+}
+
+func TestGetPreviewGenerator(t *testing.T) {
+	if _, ok := GetPreviewGenerator("report.PDF").(PdfPreviewGenerator); !ok {
+		t.Fatal("should have gotten the pdf generator")
+	}
+
+	if _, ok := GetPreviewGenerator("main.go").(TextPreviewGenerator); !ok {
+		t.Fatal("should have gotten the text generator for code")
+	}
+
+	if GetPreviewGenerator("setup.exe") != nil || GetPreviewGenerator("Makefile") != nil {
+		t.Fatal("shouldn't have a generator for unknown files")
+	}
+
+	RegisterPreviewGenerator(".exe", GifPreviewGenerator{})
+	defer func() {
+		previewGeneratorsLock.Lock()
+		delete(previewGenerators, ".exe")
+		previewGeneratorsLock.Unlock()
+	}()
+
+	if GetPreviewGenerator("setup.exe") == nil {
+		t.Fatal("should have registered the generator")
+	}
+}
+
+func TestPdfPreviewGenerator(t *testing.T) {
+	LoadConfig("config.json")
+
+	content := "1 0 0 rg 10 10 50 30 re f\nBT /F1 24 Tf 0 0 1 rg 100 50 Td (Hello \\(world\\)) Tj ET\n0 0 0 RG 2 w 0 90 m 200 90 l S"
+
+	for _, compress := range []bool{false, true} {
+		img, err := PdfPreviewGenerator{}.GeneratePreview(makeTestPdf(content, compress))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if bounds := img.Bounds(); bounds.Dx() != PDF_PREVIEW_WIDTH || bounds.Dy() != PDF_PREVIEW_WIDTH/2 {
+			t.Fatal("should have kept the shape of the page", bounds)
+		}
+
+		// the page is drawn at 5.12 pixels a point, measuring down from the top
+		if !isRed(img.At(150, 400)) {
+			t.Fatal("should have filled the rectangle", img.At(150, 400))
+		}
+
+		if isRed(img.At(150, 200)) {
+			t.Fatal("shouldn't have filled outside of the rectangle")
+		}
+
+		if r, _, _, _ := img.At(500, 51).RGBA(); r > 0x8000 {
+			t.Fatal("should have stroked the line")
+		}
+	}
+
+	if _, err := (PdfPreviewGenerator{}).GeneratePreview([]byte("not a pdf")); err == nil {
+		t.Fatal("should have failed, not a pdf")
+	}
+
+	if _, err := (PdfPreviewGenerator{}).GeneratePreview([]byte("%PDF-1.4\n1 0 obj\n<< /Type /Catalog /Pages [ >>")); err == nil {
+		t.Fatal("should have failed, no pages")
+	}
+}
+
+func TestParsePdf(t *testing.T) {
+	doc, err := parsePdf(makeTestPdf("BT /F1 12 Tf (A) Tj ET", true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pages := doc.pages(10)
+	if len(pages) != 1 || pages[0].mediaBox != [4]float64{0, 0, 200, 100} {
+		t.Fatal("should have found the page and inherited its size")
+	}
+
+	if doc.resolveDict(pages[0].resources["Font"]) == nil {
+		t.Fatal("should have found the page's resources")
+	}
+
+	ops := []string{}
+	eachPdfOperation(doc.contents(pages[0]), func(op string, operands []interface{}) {
+		ops = append(ops, op)
+		if op == "Tj" && operands[0] != "A" {
+			t.Fatal("should have read the string", operands)
+		}
+	})
+
+	if fmt.Sprint(ops) != "[BT Tf Tj ET]" {
+		t.Fatal("should have read the operators", ops)
+	}
+
+	lexer := &pdfLexer{data: []byte(`<< /Name#20A (a\(b\)\101) /Hex <48 49> /Array [1 -2.5 3 0 R] /B true >>`)}
+	if obj, err := lexer.readObject(0); err != nil {
+		t.Fatal(err)
+	} else if dict := obj.(pdfDict); dict["Name A"] != "a(b)A" || dict["Hex"] != "HI" || dict["B"] != true {
+		t.Fatal("should have read the escapes", dict)
+	} else if array := dict["Array"].([]interface{}); len(array) != 3 || array[1] != -2.5 || array[2] != (pdfRef{num: 3}) {
+		t.Fatal("should have read the array", array)
+	}
+}
+
+func TestPdfDecodeStreamLimit(t *testing.T) {
+	var compressed bytes.Buffer
+	writer := zlib.NewWriter(&compressed)
+	writer.Write(make([]byte, pdfMaxStreamSize+1))
+	writer.Close()
+
+	doc := &pdfDocument{objects: map[int]interface{}{}}
+	if _, _, err := doc.decodeStream(&pdfStream{dict: pdfDict{"Filter": pdfName("FlateDecode")}, raw: compressed.Bytes()}); err == nil {
+		t.Fatal("should have refused to decompress a stream that's too large")
+	}
+}
+
+func TestGifPreviewGenerator(t *testing.T) {
+	data, err := ioutil.ReadFile(FindDir("tests") + "testgif.gif")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, appErr := GifPreviewGenerator{}.GeneratePreview(data)
+	if appErr != nil {
+		t.Fatal(appErr)
+	}
+
+	config, _, _ := image.DecodeConfig(bytes.NewReader(data))
+	if img.Bounds().Dx() != config.Width || img.Bounds().Dy() != config.Height {
+		t.Fatal("should have drawn the first frame at the size of the gif")
+	}
+
+	if _, err := (GifPreviewGenerator{}).GeneratePreview([]byte("GIF89a")); err == nil {
+		t.Fatal("should have failed, not a whole gif")
+	}
+}
+
+func TestTextPreviewGenerator(t *testing.T) {
+	lines := &bytes.Buffer{}
+	for i := 0; i < TEXT_PREVIEW_MAX_LINES*2; i++ {
+		lines.WriteString("line\twith a tab\n")
+	}
+
+	img, err := TextPreviewGenerator{}.GeneratePreview(lines.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if img.Bounds().Dy() != textPreviewPadding*2+TEXT_PREVIEW_MAX_LINES*textPreviewLineHeight {
+		t.Fatal("should only have drawn the first lines")
+	}
+
+	if _, err := (TextPreviewGenerator{}).GeneratePreview([]byte{'a', 0, 'b'}); err == nil {
+		t.Fatal("should have failed, binary file")
+	}
+
+	if _, err := GetPreviewGenerator("main.go").GeneratePreview([]byte("package main\n\nfunc main() {}\n")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCodeHighlighting(t *testing.T) {
+	spans, inComment := goLanguage.highlight(`x := "a // b" + 12 // done`, false)
+	if inComment {
+		t.Fatal("shouldn't be in a comment")
+	}
+
+	expected := []textSpan{
+		{`x := `, textPreviewForeground},
+		{`"a // b"`, textPreviewString},
+		{` + `, textPreviewForeground},
+		{`12`, textPreviewNumber},
+		{` `, textPreviewForeground},
+		{`// done`, textPreviewComment},
+	}
+
+	if fmt.Sprint(spans) != fmt.Sprint(expected) {
+		t.Fatal("got incorrect spans", spans)
+	}
+
+	if spans, inComment = goLanguage.highlight(`return /* start`, false); !inComment || spans[0].color != textPreviewKeyword {
+		t.Fatal("should have started a comment", spans)
+	}
+
+	if spans, inComment = goLanguage.highlight(`end */ nil`, true); inComment || spans[0].text != "end */" || spans[2].color != textPreviewKeyword {
+		t.Fatal("should have finished the comment", spans)
+	}
+}
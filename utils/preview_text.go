@@ -0,0 +1,297 @@
+// Copyright (c) 2016 Mattermost, Inc. All Rights Reserved.
+// See License.txt for license information.
+
+package utils
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mattermost/platform/model"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	TEXT_PREVIEW_MAX_LINES   = 40
+	TEXT_PREVIEW_MAX_COLUMNS = 100
+	TEXT_PREVIEW_MAX_BYTES   = 64 * 1024
+	TEXT_PREVIEW_TAB_WIDTH   = 4
+
+	textPreviewPadding    = 12
+	textPreviewLineHeight = 15
+)
+
+var TEXT_PREVIEW_EXTENSIONS = []string{".txt", ".text", ".md", ".markdown", ".log", ".csv", ".tsv", ".json", ".xml", ".yml", ".yaml", ".ini", ".conf", ".cfg", ".html", ".htm", ".css", ".diff", ".patch"}
+
+var (
+	textPreviewBackground = color.RGBA{255, 255, 255, 255}
+	textPreviewForeground = color.RGBA{51, 51, 51, 255}
+	textPreviewKeyword    = color.RGBA{166, 38, 164, 255}
+	textPreviewString     = color.RGBA{80, 161, 79, 255}
+	textPreviewComment    = color.RGBA{160, 161, 167, 255}
+	textPreviewNumber     = color.RGBA{152, 104, 1, 255}
+)
+
+// codeLanguage describes enough of a programming language's syntax to colour
+// in its keywords, strings, comments and numbers.
+type codeLanguage struct {
+	keywords     map[string]bool
+	lineComments []string
+	blockComment [2]string
+	quotes       string
+}
+
+func newCodeLanguage(keywords string, lineComments []string, blockComment [2]string, quotes string) *codeLanguage {
+	language := &codeLanguage{keywords: map[string]bool{}, lineComments: lineComments, blockComment: blockComment, quotes: quotes}
+	for _, keyword := range strings.Fields(keywords) {
+		language.keywords[keyword] = true
+	}
+
+	return language
+}
+
+var (
+	cStyleComment  = [2]string{"/*", "*/"}
+	noBlockComment = [2]string{}
+
+	goLanguage = newCodeLanguage("break case chan const continue default defer else fallthrough for func go goto if import interface map package range return select struct switch type var nil true false",
+		[]string{"//"}, cStyleComment, "\"'`")
+	cLanguage = newCodeLanguage("auto break case char const continue default do double else enum extern float for goto if inline int long register return short signed sizeof static struct switch typedef union unsigned void volatile while class namespace template typename public private protected virtual new delete this true false nullptr include define",
+		[]string{"//"}, cStyleComment, "\"'")
+	javaLanguage = newCodeLanguage("abstract boolean break byte case catch char class const continue default do double else enum extends final finally float for if implements import instanceof int interface long native new package private protected public return short static super switch synchronized this throw throws try void volatile while true false null var val fun using namespace",
+		[]string{"//"}, cStyleComment, "\"'")
+	javascriptLanguage = newCodeLanguage("break case catch class const continue debugger default delete do else export extends finally for function if import in instanceof let new return super switch this throw try typeof var void while with yield async await true false null undefined interface type",
+		[]string{"//"}, cStyleComment, "\"'`")
+	pythonLanguage = newCodeLanguage("and as assert break class continue def del elif else except finally for from global if import in is lambda nonlocal not or pass raise return try while with yield True False None",
+		[]string{"#"}, noBlockComment, "\"'")
+	rubyLanguage = newCodeLanguage("alias and begin break case class def defined do else elsif end ensure false for if in module next nil not or redo rescue retry return self super then true undef unless until when while yield require",
+		[]string{"#"}, noBlockComment, "\"'")
+	shellLanguage = newCodeLanguage("if then else elif fi case esac for while until do done in function select return exit export local",
+		[]string{"#"}, noBlockComment, "\"'")
+	sqlLanguage = newCodeLanguage("select from where and or not insert into values update set delete create table alter drop index join left right inner outer on as group by order having limit offset null is in like distinct union SELECT FROM WHERE AND OR NOT INSERT INTO VALUES UPDATE SET DELETE CREATE TABLE ALTER DROP INDEX JOIN LEFT RIGHT INNER OUTER ON AS GROUP BY ORDER HAVING LIMIT OFFSET NULL IS IN LIKE DISTINCT UNION",
+		[]string{"--"}, cStyleComment, "'\"")
+	rustLanguage = newCodeLanguage("as break const continue crate else enum extern false fn for if impl in let loop match mod move mut pub ref return self Self static struct super trait true type unsafe use where while",
+		[]string{"//"}, cStyleComment, "\"")
+)
+
+var codeLanguages = map[string]*codeLanguage{
+	".go":    goLanguage,
+	".c":     cLanguage,
+	".h":     cLanguage,
+	".cc":    cLanguage,
+	".cpp":   cLanguage,
+	".hpp":   cLanguage,
+	".m":     cLanguage,
+	".java":  javaLanguage,
+	".kt":    javaLanguage,
+	".scala": javaLanguage,
+	".cs":    javaLanguage,
+	".js":    javascriptLanguage,
+	".jsx":   javascriptLanguage,
+	".ts":    javascriptLanguage,
+	".tsx":   javascriptLanguage,
+	".py":    pythonLanguage,
+	".rb":    rubyLanguage,
+	".sh":    shellLanguage,
+	".bash":  shellLanguage,
+	".sql":   sqlLanguage,
+	".rs":    rustLanguage,
+}
+
+// TextPreviewGenerator draws the first lines of a text file. Source code is
+// drawn with its syntax highlighted when the language is known.
+type TextPreviewGenerator struct {
+	language *codeLanguage
+}
+
+type textSpan struct {
+	text  string
+	color color.Color
+}
+
+func (g TextPreviewGenerator) GeneratePreview(data []byte) (image.Image, *model.AppError) {
+	if len(data) > TEXT_PREVIEW_MAX_BYTES {
+		data = trimPartialRune(data[:TEXT_PREVIEW_MAX_BYTES])
+	}
+
+	if bytes.IndexByte(data, 0) != -1 || !utf8.Valid(data) {
+		return nil, model.NewLocAppError("TextPreviewGenerator.GeneratePreview", "utils.preview.text.binary.app_error", nil, "")
+	}
+
+	lines := strings.Split(strings.Replace(string(data), "\r\n", "\n", -1), "\n")
+	if len(lines) > TEXT_PREVIEW_MAX_LINES {
+		lines = lines[:TEXT_PREVIEW_MAX_LINES]
+	}
+
+	columns := 40
+	for i, line := range lines {
+		line = expandTabs(line)
+		if utf8.RuneCountInString(line) > TEXT_PREVIEW_MAX_COLUMNS {
+			line = string([]rune(line)[:TEXT_PREVIEW_MAX_COLUMNS])
+		}
+
+		if n := utf8.RuneCountInString(line); n > columns {
+			columns = n
+		}
+		lines[i] = line
+	}
+
+	face := basicfont.Face7x13
+	width := textPreviewPadding*2 + columns*face.Advance
+	height := textPreviewPadding*2 + len(lines)*textPreviewLineHeight
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(textPreviewBackground), image.Point{}, draw.Src)
+
+	drawer := &font.Drawer{Dst: img, Face: face}
+
+	inComment := false
+	for i, line := range lines {
+		var spans []textSpan
+		if g.language != nil {
+			spans, inComment = g.language.highlight(line, inComment)
+		} else {
+			spans = []textSpan{{line, textPreviewForeground}}
+		}
+
+		drawer.Dot = fixed.P(textPreviewPadding, textPreviewPadding+i*textPreviewLineHeight+face.Ascent)
+		for _, span := range spans {
+			drawer.Src = image.NewUniform(span.color)
+			drawer.DrawString(span.text)
+		}
+	}
+
+	return img, nil
+}
+
+// trimPartialRune drops the end of a character that was cut in half.
+func trimPartialRune(data []byte) []byte {
+	for i := 0; i < utf8.UTFMax-1 && len(data) > 0; i++ {
+		if r, size := utf8.DecodeLastRune(data); r != utf8.RuneError || size != 1 {
+			break
+		}
+		data = data[:len(data)-1]
+	}
+
+	return data
+}
+
+func expandTabs(line string) string {
+	if !strings.Contains(line, "\t") {
+		return line
+	}
+
+	buf := &bytes.Buffer{}
+	column := 0
+	for _, r := range line {
+		if r == '\t' {
+			for spaces := TEXT_PREVIEW_TAB_WIDTH - column%TEXT_PREVIEW_TAB_WIDTH; spaces > 0; spaces-- {
+				buf.WriteByte(' ')
+				column++
+			}
+		} else {
+			buf.WriteRune(r)
+			column++
+		}
+	}
+
+	return buf.String()
+}
+
+// highlight splits a line into spans that are each drawn in one colour. Block
+// comments can carry on past the end of a line so whether the line starts in
+// one is passed in and whether the next line does is returned.
+func (language *codeLanguage) highlight(line string, inComment bool) ([]textSpan, bool) {
+	spans := []textSpan{}
+	start := 0
+
+	add := func(end int, c color.Color) {
+		if end > start {
+			spans = append(spans, textSpan{line[start:end], c})
+			start = end
+		}
+	}
+
+	i := 0
+	for i < len(line) {
+		if inComment {
+			if end := strings.Index(line[i:], language.blockComment[1]); end == -1 {
+				i = len(line)
+			} else {
+				i += end + len(language.blockComment[1])
+				inComment = false
+			}
+			add(i, textPreviewComment)
+			continue
+		}
+
+		rest := line[i:]
+
+		isLineComment := false
+		for _, prefix := range language.lineComments {
+			if strings.HasPrefix(rest, prefix) {
+				isLineComment = true
+			}
+		}
+
+		if isLineComment {
+			add(i, textPreviewForeground)
+			i = len(line)
+			add(i, textPreviewComment)
+		} else if len(language.blockComment[0]) > 0 && strings.HasPrefix(rest, language.blockComment[0]) {
+			add(i, textPreviewForeground)
+			i += len(language.blockComment[0])
+			inComment = true
+		} else if c := line[i]; strings.IndexByte(language.quotes, c) != -1 {
+			add(i, textPreviewForeground)
+			for i++; i < len(line) && line[i] != c; i++ {
+				if line[i] == '\\' {
+					i++
+				}
+			}
+			i = minInt(i+1, len(line))
+			add(i, textPreviewString)
+		} else if isIdentifierStart(c) {
+			end := i
+			for end < len(line) && (isIdentifierStart(line[end]) || isDigit(line[end])) {
+				end++
+			}
+
+			if language.keywords[line[i:end]] {
+				add(i, textPreviewForeground)
+				add(end, textPreviewKeyword)
+			}
+			i = end
+		} else if isDigit(c) {
+			add(i, textPreviewForeground)
+			for i < len(line) && (isDigit(line[i]) || isIdentifierStart(line[i]) || line[i] == '.') {
+				i++
+			}
+			add(i, textPreviewNumber)
+		} else {
+			i++
+		}
+	}
+
+	if inComment {
+		add(len(line), textPreviewComment)
+	} else {
+		add(len(line), textPreviewForeground)
+	}
+
+	return spans, inComment
+}
+
+func isIdentifierStart(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c == '_' || c >= utf8.RuneSelf
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}